@@ -0,0 +1,122 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+
+	"github.com/aixiasang/bitcask/index"
+	"github.com/aixiasang/bitcask/wal"
+)
+
+// walSnapshot 备份时某个WAL文件或blob文件的快照范围
+type walSnapshot struct {
+	fileId uint32
+	wal    *wal.Wal
+	size   uint32
+}
+
+// Backup 在线备份到 destDir，生成的目录可以直接用 NewBitcask 打开
+//
+// 备份期间持有锁阻止文件轮转：已封存的WAL文件完整复制，活跃文件同步后
+// 只复制当前已写入的部分。由于WAL只追加，这些文件组成一个一致的时间点镜像。
+// hint文件根据复制出的WAL重新生成，不会引用备份之后写入的数据。
+// blob文件同样只追加，与WAL一起复制到当前已写入的部分。
+func (bc *Bitcask) Backup(destDir string) error {
+	if entries, err := os.ReadDir(destDir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("备份目录不为空: %s", destDir)
+	}
+	destWalDir := filepath.Join(destDir, bc.conf.WalDir)
+	if err := os.MkdirAll(destWalDir, 0755); err != nil {
+		return fmt.Errorf("创建备份目录失败: %v", err)
+	}
+
+	bc.mu.Lock()
+	if err := bc.activeWal.Sync(); err != nil {
+		bc.mu.Unlock()
+		return fmt.Errorf("同步活跃WAL失败: %v", err)
+	}
+	snapshots := make([]walSnapshot, 0, len(bc.oldWal)+1)
+	for fileId, w := range bc.oldWal {
+		snapshots = append(snapshots, walSnapshot{fileId: fileId, wal: w, size: w.Size()})
+	}
+	snapshots = append(snapshots, walSnapshot{fileId: bc.fileId, wal: bc.activeWal, size: bc.activeWal.Size()})
+	nextFileId := bc.nextFileId
+	err := copyWalSnapshots(destWalDir, "wal-%d.log", snapshots)
+	if err == nil {
+		err = bc.copyBlobs(filepath.Join(destDir, bc.conf.BlobDir))
+	}
+	bc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// 从复制出的WAL重建索引并写入hint
+	destConf := *bc.conf
+	destConf.DataDir = destDir
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].fileId < snapshots[j].fileId })
+	memTable := index.NewBTreeIndex(destConf.BTreeOrder)
+	var txnId atomic.Uint32
+	replay := wal.NewReplayState()
+	for _, snap := range snapshots {
+		w, err := wal.NewWal(&destConf, snap.fileId)
+		if err != nil {
+			return fmt.Errorf("打开备份WAL文件 %d 失败: %v", snap.fileId, err)
+		}
+		err = w.ReadAllWithState(memTable, &txnId, replay)
+		w.Close()
+		if err != nil {
+			return fmt.Errorf("读取备份WAL文件 %d 失败: %v", snap.fileId, err)
+		}
+	}
+	if _, err := writeHint(filepath.Join(destDir, destConf.HintDir), memTable, txnId.Load(), nextFileId); err != nil {
+		return fmt.Errorf("生成备份hint文件失败: %v", err)
+	}
+	return nil
+}
+
+// copyBlobs 将所有blob文件当前已写入的部分复制到 destBlobDir，调用方需要持有 bc.mu 写锁
+func (bc *Bitcask) copyBlobs(destBlobDir string) error {
+	if bc.activeBlob == nil && len(bc.blobs) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(destBlobDir, 0755); err != nil {
+		return fmt.Errorf("创建备份blob目录失败: %v", err)
+	}
+	snapshots := make([]walSnapshot, 0, len(bc.blobs)+1)
+	for fileId, blob := range bc.blobs {
+		snapshots = append(snapshots, walSnapshot{fileId: fileId, wal: blob, size: blob.Size()})
+	}
+	if bc.activeBlob != nil {
+		if err := bc.activeBlob.Sync(); err != nil {
+			return fmt.Errorf("同步活跃blob文件失败: %v", err)
+		}
+		snapshots = append(snapshots, walSnapshot{fileId: bc.activeBlob.FileId(), wal: bc.activeBlob, size: bc.activeBlob.Size()})
+	}
+	return copyWalSnapshots(destBlobDir, "blob-%d.log", snapshots)
+}
+
+// copyWalSnapshots 将每个文件的快照范围复制到 destDir，文件名由 nameFormat 和文件ID生成
+func copyWalSnapshots(destDir, nameFormat string, snapshots []walSnapshot) error {
+	for _, snap := range snapshots {
+		destPath := filepath.Join(destDir, fmt.Sprintf(nameFormat, snap.fileId))
+		fp, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("创建备份WAL文件失败: %v", err)
+		}
+		if err := snap.wal.CopyTo(fp, snap.size); err != nil {
+			fp.Close()
+			return err
+		}
+		if err := fp.Sync(); err != nil {
+			fp.Close()
+			return fmt.Errorf("同步备份WAL文件失败: %v", err)
+		}
+		if err := fp.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aixiasang/bitcask/utils"
+)
+
+func TestBitcask_Backup(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	backupRoot, cleanupBackup := setupTestDir(t)
+	defer cleanupBackup()
+	backupDir := filepath.Join(backupRoot, "backup")
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// 写入足够多的数据以产生多个WAL文件
+	const total = 300
+	for i := 0; i < total; i++ {
+		if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if _, err := db.Delete(utils.GetKey(0)); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	// 备份期间并发读取
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; ; i = i%(total-1) + 1 {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, ok := db.Get(utils.GetKey(i)); !ok {
+					t.Errorf("并发读取失败: key=%s", utils.GetKey(i))
+					return
+				}
+			}
+		}()
+	}
+	err = db.Backup(backupDir)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("备份失败: %v", err)
+	}
+
+	// 备份之后的写入不应出现在备份中
+	if err := db.Put([]byte("after-backup"), []byte("v")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	// 非空目录不能作为备份目标
+	if err := db.Backup(backupDir); err == nil {
+		t.Fatalf("期望备份到非空目录返回错误")
+	}
+
+	if _, err := os.Stat(filepath.Join(backupDir, conf.HintDir, "keys.hint")); err != nil {
+		t.Fatalf("备份中缺少hint文件: %v", err)
+	}
+
+	backupConf := getTestConfig(backupDir)
+	backupConf.Debug = false
+	backup, err := NewBitcask(backupConf)
+	if err != nil {
+		t.Fatalf("打开备份失败: %v", err)
+	}
+	defer backup.Close()
+
+	for i := 1; i < total; i++ {
+		value, ok := backup.Get(utils.GetKey(i))
+		if !ok || string(value) != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("备份中数据不匹配: key=%s, value=%s", utils.GetKey(i), value)
+		}
+	}
+	if _, ok := backup.Get(utils.GetKey(0)); ok {
+		t.Fatalf("备份中已删除的键仍然可读")
+	}
+	if _, ok := backup.Get([]byte("after-backup")); ok {
+		t.Fatalf("备份中出现了备份之后写入的数据")
+	}
+}
@@ -1,11 +1,13 @@
 package bitcask
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/aixiasang/bitcask/config"
+	"github.com/aixiasang/bitcask/record"
 	"github.com/aixiasang/bitcask/utils"
 )
 
@@ -17,108 +19,299 @@ type Batch struct {
 	mp    map[string][]byte // 存储写入的key-value
 	keys  [][]byte          // 存储删除的key
 	txnId uint32            // 事务id
+
+	// 乐观并发模式下每个键第一次被读取或写入时的索引位置，nil 表示键当时不存在；
+	// 普通批处理中为nil，不做冲突检测
+	tracked map[string]*record.Pos
 }
 
 func NewBatch(db *Bitcask) *Batch {
 	return &Batch{db: db, txnId: db.txnId.Load(), conf: db.conf, mp: make(map[string][]byte)}
 }
 
+// NewOptimisticBatch 创建开启冲突检测的批处理：Get/Put/Delete 第一次访问某个键时记录它在索引中的位置，
+// Commit 时如果其中任意一个键已经被其他写入修改（包括其他批处理、Put、Delete 和 Merge 重写），
+// 返回 ErrConflict 且不写入任何数据，调用方可以 Discard 后重新读取并重试
+func NewOptimisticBatch(db *Bitcask) *Batch {
+	b := NewBatch(db)
+	b.tracked = make(map[string]*record.Pos)
+	return b
+}
+
 func (b *Batch) Put(key, value []byte) error {
 	b.log()
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	b.mp[string(key)] = value
-	b.keys = append(b.keys, key)
+	if err := b.db.CheckSize(key, value); err != nil {
+		return err
+	}
+	if err := b.track(key); err != nil {
+		return err
+	}
+	b.stage(key, value)
+	return nil
+}
+
+// Get 读取键在批处理中的最新值：优先返回批处理中暂存的写入，暂存了删除时视为不存在，
+// 批处理中没有该键时读取数据库。提交前其他读取方看不到这些暂存的修改
+func (b *Batch) Get(key []byte) ([]byte, bool) {
+	b.mu.Lock()
+	value, ok := b.mp[string(key)]
+	if !ok && b.track(key) != nil {
+		// 无法记录位置时不能保证冲突检测，视为读取失败
+		b.mu.Unlock()
+		return nil, false
+	}
+	b.mu.Unlock()
+	if ok {
+		return value, value != nil
+	}
+	return b.db.Get(key)
+}
+
+// ScanPrefix 与 Bitcask.ScanPrefix 相同，但能看到批处理中暂存的修改：暂存了写入的键返回暂存的值，
+// 暂存了删除的键被跳过，数据库中不存在的暂存键在数据库中的键之后按第一次写入的顺序返回。
+// 遍历的是调用时暂存内容的快照，扫描不会被记录用于乐观并发的冲突检测
+func (b *Batch) ScanPrefix(prefix []byte, fn func(key, value []byte) error) error {
+	b.mu.RLock()
+	staged := make(map[string][]byte)
+	var added [][]byte
+	for _, key := range b.keys {
+		value, ok := b.mp[string(key)]
+		if _, seen := staged[string(key)]; !ok || seen || !bytes.HasPrefix(key, prefix) {
+			continue
+		}
+		staged[string(key)] = value
+		added = append(added, key)
+	}
+	b.mu.RUnlock()
+
+	err := b.db.ScanPrefix(prefix, func(key, value []byte) error {
+		if v, ok := staged[string(key)]; ok {
+			delete(staged, string(key))
+			if v == nil {
+				return nil
+			}
+			value = v
+		}
+		return fn(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range added {
+		// 数据库中已经存在的键在上面返回过
+		value, ok := staged[string(key)]
+		if !ok || value == nil {
+			continue
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (b *Batch) Delete(key []byte) error {
 	b.log()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if value, ok := b.mp[string(key)]; ok && value == nil {
+		// 批处理中已经删除过
+		return nil
+	}
+	if err := b.track(key); err != nil {
+		return err
+	}
 	if _, ok := b.db.Get(key); !ok {
-		// 如果在批处理之中 删除 不在就不需要处理
-		b.mu.Lock()
-		defer b.mu.Unlock()
-		if _, ok := b.mp[string(key)]; ok {
-			delete(b.mp, string(key))
-			return nil
-		}
+		// 数据库中不存在，只需要撤销批处理中暂存的写入
+		delete(b.mp, string(key))
 		return nil
 	}
-	// 如果key存在数据库中 则将key从批处理中删除
-	b.mu.Lock()
-	defer b.mu.Unlock()
-	b.mp[string(key)] = nil
-	b.keys = append(b.keys, key)
+	// 数据库中存在，提交时写入删除记录
+	b.stage(key, nil)
+	return nil
+}
+
+// track 乐观并发模式下记录键第一次被访问时的索引位置，调用方需要持有写锁
+func (b *Batch) track(key []byte) error {
+	if b.tracked == nil {
+		return nil
+	}
+	if _, ok := b.tracked[string(key)]; ok {
+		return nil
+	}
+	pos, err := b.db.memTable.Get(key)
+	if err != nil {
+		return err
+	}
+	b.tracked[string(key)] = pos
+	return nil
+}
+
+// checkConflicts 检查记录过的键在索引中的位置是否变化，调用方需要持有 db.writeMu
+func (b *Batch) checkConflicts() error {
+	for key, want := range b.tracked {
+		pos, err := b.db.memTable.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		if !samePos(pos, want) {
+			return fmt.Errorf("%w: key=%s", ErrConflict, key)
+		}
+	}
 	return nil
 }
+
+func samePos(a, b *record.Pos) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.FileId == b.FileId && a.Offset == b.Offset
+}
+
+// stage 暂存键的写入，value 为nil表示删除，提交时写入最后暂存的值
+func (b *Batch) stage(key, value []byte) {
+	if _, ok := b.mp[string(key)]; !ok {
+		b.keys = append(b.keys, key)
+	}
+	b.mp[string(key)] = value
+}
+
+// Limit 返回单个批处理最多能包含的键数量（含），超过时 Commit 返回 ErrBatchTooLarge
+func (b *Batch) Limit() int {
+	return b.conf.BatchSize
+}
+
+// bytes 返回暂存的所有键和值的总字节数，删除只计算键，调用方需要持有锁
+func (b *Batch) bytes() int64 {
+	var n int64
+	for key, value := range b.mp {
+		n += int64(len(key) + len(value))
+	}
+	return n
+}
+
 func (b *Batch) log() {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	if len(b.mp) > b.conf.BatchSize {
-		fmt.Printf("警告: 批处理大小超过限制, 当前大小: %d, 限制大小: %d\n", len(b.mp), b.conf.BatchSize)
-		fmt.Println(b.conf)
+		b.conf.Warnf("批处理大小超过限制, 当前大小: %d, 限制大小: %d", len(b.mp), b.conf.BatchSize)
 	}
 }
 func (b *Batch) Commit() error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if b.conf.Debug {
-		fmt.Printf("开始提交事务, 事务ID: %d\n", b.txnId)
+	b.conf.Debugf("开始提交事务, 事务ID: %d", b.txnId)
+	if b.conf.ReadOnly {
+		return ErrReadOnly
 	}
-	if len(b.mp) >= b.conf.BatchSize {
-		if b.conf.Debug {
-			fmt.Printf("警告: 批处理大小超过限制, 当前大小: %d, 限制大小: %d\n", len(b.mp), b.conf.BatchSize)
+	// 在写入任何WAL记录之前检查限制，超过限制时不会有任何修改
+	if len(b.mp) > b.conf.BatchSize {
+		b.conf.Debugf("批处理大小超过限制, 当前大小: %d, 限制大小: %d", len(b.mp), b.conf.BatchSize)
+		return fmt.Errorf("%w: 包含 %d 个键, 限制 %d 个", ErrBatchTooLarge, len(b.mp), b.conf.BatchSize)
+	}
+	if b.conf.BatchMaxBytes > 0 {
+		if n := b.bytes(); n > b.conf.BatchMaxBytes {
+			return fmt.Errorf("%w: 共 %d 字节, 限制 %d 字节", ErrBatchTooManyBytes, n, b.conf.BatchMaxBytes)
 		}
-		return errors.New("批处理大小超过限制")
+	}
+
+	// 普通写入和批处理提交持有同一个锁，冲突检测和写入之间不会插入其他写入，事务记录也不会交错
+	b.db.writeMu.Lock()
+	defer b.db.writeMu.Unlock()
+	if err := b.checkConflicts(); err != nil {
+		return err
+	}
+	if b.db.commitHook != nil {
+		b.db.commitHook()
 	}
 	if len(b.mp) == 0 {
-		if b.conf.Debug {
-			fmt.Printf("警告: 批处理中没有操作, 事务ID: %d\n", b.txnId)
-		}
+		b.conf.Debugf("批处理中没有操作, 事务ID: %d", b.txnId)
 		return nil
 	}
 	if err := b.db.putTxnBegin([]byte("txn_begin"), b.txnId); err != nil {
 		return err
 	}
+	// 写入后撤销再写入的键会在 keys 中出现多次，只需要写入一次
+	written := make(map[string]struct{}, len(b.mp))
+	events := make([]Event, 0, len(b.mp))
+	staged := make([]txnEntry, 0, len(b.mp))
 	for _, key := range b.keys {
+		if _, ok := written[string(key)]; ok {
+			continue
+		}
+		written[string(key)] = struct{}{}
 		if value, ok := b.mp[string(key)]; ok {
+			events = append(events, changeEvent(key, value))
+			var pos *record.Pos
+			var err error
 			if value == nil {
-				if err := b.db.deleteTxn(key, b.txnId); err != nil {
-					return err
-				}
+				pos, err = b.db.deleteTxn(key, b.txnId)
 			} else {
-				if err := b.db.putTxn(key, value, b.txnId); err != nil {
-					return err
-				}
+				pos, err = b.db.putTxn(key, value, b.txnId)
+			}
+			if err != nil {
+				return err
+			}
+			if pos != nil {
+				staged = append(staged, txnEntry{key: key, pos: pos})
 			}
 		}
 	}
 	if err := b.db.putTxnCommit([]byte("txn_commit"), b.txnId); err != nil {
 		return err
 	}
+	// 提交记录写入之后才更新索引，持有 bc.mu 写锁时一次更新全部键，读取方不会看到只生效了一部分的批处理
+	if err := b.db.applyTxn(staged); err != nil {
+		return err
+	}
+	// 持有 writeMu 时发布，不同批处理的事件不会交错
+	b.db.publish(events...)
 
-	b.db.txnId.Add(1)
-	b.keys = nil
-	b.mp = nil
+	// 提交后批处理可以继续使用，之后的操作属于新的事务
+	b.txnId = b.db.txnId.Add(1)
+	b.reset()
 	return nil
 }
-func (bc *Bitcask) putTxn(key, value []byte, txnId uint32) error {
+
+// Discard 丢弃批处理中暂存的所有操作，不写入任何数据，之后批处理可以继续使用
+func (b *Batch) Discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reset()
+}
+
+// reset 清空暂存的操作，调用方需要持有写锁
+func (b *Batch) reset() {
+	b.mp = make(map[string][]byte)
+	b.keys = nil
+	if b.tracked != nil {
+		b.tracked = make(map[string]*record.Pos)
+	}
+}
+
+// txnEntry 批处理写入的键及其记录位置，提交记录写入之后才更新到索引
+type txnEntry struct {
+	key []byte
+	pos *record.Pos
+}
+
+// putTxn 写入事务记录，返回记录的位置，不更新索引
+func (bc *Bitcask) putTxn(key, value []byte, txnId uint32) (*record.Pos, error) {
 	if key == nil {
-		return errors.New("key cannot be nil")
+		return nil, errors.New("key cannot be nil")
 	}
 	if err := bc.tryRotate(); err != nil {
-		return err
+		return nil, err
 	}
-	encKey := utils.EncodeTxnId(txnId, key)
-	pos, err := bc.activeWal.WriteTxn(encKey, value)
-	if err != nil {
-		return err
-	}
-	if err := bc.memTable.Put(key, pos); err != nil {
-		return err
+	rec := record.NewTxnRecord(utils.EncodeTxnId(txnId, key), value)
+	if err := bc.separate(key, rec); err != nil {
+		return nil, err
 	}
-	return nil
+	return bc.active().WriteRecord(rec)
 }
 func (bc *Bitcask) putTxnBegin(key []byte, txnId uint32) error {
 	if key == nil {
@@ -128,7 +321,7 @@ func (bc *Bitcask) putTxnBegin(key []byte, txnId uint32) error {
 		return err
 	}
 	encKey := utils.EncodeTxnId(txnId, key)
-	if _, err := bc.activeWal.WriteTxnBegin(encKey); err != nil {
+	if _, err := bc.active().WriteTxnBegin(encKey); err != nil {
 		return err
 	}
 	return nil
@@ -142,29 +335,37 @@ func (bc *Bitcask) putTxnCommit(key []byte, txnId uint32) error {
 		return err
 	}
 	encKey := utils.EncodeTxnId(txnId, key)
-	if _, err := bc.activeWal.WriteTxnCommit(encKey); err != nil {
+	if _, err := bc.active().WriteTxnCommit(encKey); err != nil {
 		return err
 	}
 	return nil
 }
-func (bc *Bitcask) deleteTxn(key []byte, txnId uint32) error {
 
+// deleteTxn 写入事务删除记录，返回记录的位置，不更新索引；键不存在时不写入并返回nil
+func (bc *Bitcask) deleteTxn(key []byte, txnId uint32) (*record.Pos, error) {
 	pos, err := bc.memTable.Get(key)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if pos == nil {
-		return nil
+		return nil, nil
 	}
 	if err := bc.tryRotate(); err != nil {
-		return err
+		return nil, err
 	}
 	encKey := utils.EncodeTxnId(txnId, key)
-	if _, err = bc.activeWal.WriteTxn(encKey, nil); err != nil {
-		return err
-	}
-	if err := bc.memTable.Delete(key); err != nil {
-		return err
+	return bc.active().WriteTxn(encKey, nil)
+}
+
+// applyTxn 把已提交的批处理写入的位置更新到索引，删除的键保留删除标记的位置，直到Merge时清理
+func (bc *Bitcask) applyTxn(entries []txnEntry) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	for _, e := range entries {
+		if err := bc.memTable.Put(e.key, e.pos); err != nil {
+			return err
+		}
 	}
+	bc.dirty.Store(true)
 	return nil
 }
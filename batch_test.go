@@ -2,7 +2,13 @@ package bitcask
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/aixiasang/bitcask/config"
 	"github.com/aixiasang/bitcask/utils"
@@ -106,6 +112,7 @@ func TestBatch_Put_And_Delete(t *testing.T) {
 	if err != nil {
 		t.Fatalf("创建数据库失败: %v", err)
 	}
+	defer db.Close()
 	if err := db.Scan(func(key []byte, value []byte) error {
 		t.Fatalf("读取失败: %v, %v, %v", err, string(key), string(value))
 		return nil
@@ -169,6 +176,7 @@ func TestBatch_Get(t *testing.T) {
 	if err != nil {
 		t.Fatalf("创建数据库失败: %v", err)
 	}
+	defer db.Close()
 	for i := range 100 {
 		key := utils.GetKey(i)
 		value, ok := db.Get(key)
@@ -180,3 +188,497 @@ func TestBatch_Get(t *testing.T) {
 		}
 	}
 }
+
+func TestBatch_ReadYourWrites(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	db, err := NewBitcask(getTestConfig(testDir))
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("existing"), []byte("old")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	batch := NewBatch(db)
+	batch.Put([]byte("new"), []byte("v1"))
+	batch.Put([]byte("new"), []byte("v2"))
+	batch.Put([]byte("existing"), []byte("updated"))
+
+	// 提交前批处理中可以读到暂存的写入，数据库中读不到
+	if value, ok := batch.Get([]byte("new")); !ok || string(value) != "v2" {
+		t.Fatalf("批处理中读取暂存的写入失败: %q, %v", value, ok)
+	}
+	if value, ok := batch.Get([]byte("existing")); !ok || string(value) != "updated" {
+		t.Fatalf("批处理中读取覆盖的值失败: %q, %v", value, ok)
+	}
+	if _, ok := db.Get([]byte("new")); ok {
+		t.Fatalf("提交前数据库中不应该读到批处理的写入")
+	}
+	if value, ok := db.Get([]byte("existing")); !ok || string(value) != "old" {
+		t.Fatalf("提交前数据库中的值不应该改变: %q, %v", value, ok)
+	}
+	if value, ok := batch.Get([]byte("missing")); ok {
+		t.Fatalf("不存在的键不应该读到: %q", value)
+	}
+
+	// 暂存的删除视为不存在，删除后再写入能读到新值
+	batch.Delete([]byte("existing"))
+	if _, ok := batch.Get([]byte("existing")); ok {
+		t.Fatalf("批处理中删除的键不应该读到")
+	}
+	batch.Delete([]byte("existing"))
+	batch.Delete([]byte("new"))
+	if _, ok := batch.Get([]byte("new")); ok {
+		t.Fatalf("撤销暂存的写入后不应该读到")
+	}
+	batch.Put([]byte("new"), []byte("v3"))
+	if value, ok := batch.Get([]byte("new")); !ok || string(value) != "v3" {
+		t.Fatalf("删除后重新写入读取失败: %q, %v", value, ok)
+	}
+
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if value, ok := db.Get([]byte("new")); !ok || string(value) != "v3" {
+		t.Fatalf("提交后读取失败: %q, %v", value, ok)
+	}
+	if _, ok := db.Get([]byte("existing")); ok {
+		t.Fatalf("提交后删除的键不应该读到")
+	}
+}
+
+func TestBatch_DiscardAndReuse(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+
+	// 丢弃后提交不写入任何数据
+	batch := NewBatch(db)
+	batch.Put([]byte("discarded"), []byte("v"))
+	batch.Discard()
+	if _, ok := batch.Get([]byte("discarded")); ok {
+		t.Fatalf("丢弃后批处理中不应该读到暂存的写入")
+	}
+	sizeBefore := db.activeWal.Size()
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if _, ok := db.Get([]byte("discarded")); ok {
+		t.Fatalf("丢弃的写入不应该被提交")
+	}
+	if db.activeWal.Size() != sizeBefore {
+		t.Fatalf("提交空批处理不应该写入WAL")
+	}
+
+	// 提交后继续使用同一个批处理，每次提交使用新的事务ID
+	batch.Put([]byte("first"), []byte("1"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	firstTxnId := batch.txnId
+	batch.Put([]byte("second"), []byte("2"))
+	batch.Delete([]byte("first"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("再次提交事务失败: %v", err)
+	}
+	if batch.txnId == firstTxnId {
+		t.Fatalf("再次提交应该使用新的事务ID")
+	}
+	if _, ok := db.Get([]byte("first")); ok {
+		t.Fatalf("第二次提交中删除的键不应该读到")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	// 重启后两次提交的结果都被正确重放
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if value, ok := db.Get([]byte("second")); !ok || string(value) != "2" {
+		t.Fatalf("重启后读取失败: %q, %v", value, ok)
+	}
+	if _, ok := db.Get([]byte("first")); ok {
+		t.Fatalf("重启后删除的键不应该读到")
+	}
+}
+
+func TestBatch_Limits(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.BatchSize = 10
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// 恰好 BatchSize 个键可以提交，同一个键多次写入只计一次
+	batch := NewBatch(db)
+	if batch.Limit() != conf.BatchSize {
+		t.Fatalf("Limit 应该等于 BatchSize: %d", batch.Limit())
+	}
+	for i := 0; i < conf.BatchSize; i++ {
+		batch.Put(utils.GetKey(i), []byte("v"))
+		batch.Put(utils.GetKey(i), []byte("v"))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交 BatchSize 个键失败: %v", err)
+	}
+
+	// 多一个键时整个批处理被拒绝，不写入任何记录
+	sizeBefore := db.activeWal.Size()
+	batch = NewBatch(db)
+	for i := 0; i <= conf.BatchSize; i++ {
+		batch.Put(utils.GetKey(100+i), []byte("v"))
+	}
+	if err := batch.Commit(); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("超过 BatchSize 应该返回 ErrBatchTooLarge: %v", err)
+	}
+	if db.activeWal.Size() != sizeBefore {
+		t.Fatalf("被拒绝的批处理不应该写入WAL")
+	}
+	if _, ok := db.Get(utils.GetKey(100)); ok {
+		t.Fatalf("被拒绝的批处理中的键不应该读到")
+	}
+
+	// 字节数限制包含边界值，删除只计算键
+	conf.BatchMaxBytes = int64(len("abc") + len("12345") + len(utils.GetKey(0)))
+	batch = NewBatch(db)
+	batch.Put([]byte("abc"), []byte("12345"))
+	batch.Delete(utils.GetKey(0))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("恰好达到字节数限制时应该可以提交: %v", err)
+	}
+
+	sizeBefore = db.activeWal.Size()
+	batch = NewBatch(db)
+	batch.Put([]byte("big"), make([]byte, conf.BatchMaxBytes))
+	if err := batch.Commit(); !errors.Is(err, ErrBatchTooManyBytes) {
+		t.Fatalf("超过 BatchMaxBytes 应该返回 ErrBatchTooManyBytes: %v", err)
+	}
+	if db.activeWal.Size() != sizeBefore {
+		t.Fatalf("被拒绝的批处理不应该写入WAL")
+	}
+	if _, ok := db.Get([]byte("big")); ok {
+		t.Fatalf("被拒绝的批处理中的键不应该读到")
+	}
+}
+
+func TestBatch_SpanWalFiles(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.MaxFileSize = 256
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+
+	// 小文件大小使一个批处理的记录分布在多个WAL文件中
+	filesBefore := len(db.oldWal)
+	batch := NewBatch(db)
+	mp := make(map[string][]byte)
+	for i := 0; i < 50; i++ {
+		key, value := utils.GetKey(i), utils.GetValue(16)
+		batch.Put(key, value)
+		mp[string(key)] = value
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if len(db.oldWal)-filesBefore < 2 {
+		t.Fatalf("批处理应该跨越多个WAL文件, 新增文件数: %d", len(db.oldWal)-filesBefore)
+	}
+	batch = NewBatch(db)
+	for i := 0; i < 10; i++ {
+		batch.Delete(utils.GetKey(i))
+		delete(mp, string(utils.GetKey(i)))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if err := db.Put([]byte("plain"), []byte("value")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	mp["plain"] = []byte("value")
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	// 删除hint文件，只通过重放WAL恢复索引
+	if err := os.Remove(filepath.Join(testDir, conf.HintDir, "keys.hint")); err != nil {
+		t.Fatalf("删除hint文件失败: %v", err)
+	}
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for key, want := range mp {
+		value, ok := db.Get([]byte(key))
+		if !ok || !bytes.Equal(value, want) {
+			t.Fatalf("重放后读取 %s 失败: %q, %v", key, value, ok)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := db.Get(utils.GetKey(i)); ok {
+			t.Fatalf("重放后删除的键 %d 不应该读到", i)
+		}
+	}
+}
+
+func TestBatch_OptimisticConflict(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("counter"), []byte("1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	// 两个批处理读取并修改同一个键，后提交的被拒绝
+	first, second := NewOptimisticBatch(db), NewOptimisticBatch(db)
+	if _, ok := first.Get([]byte("counter")); !ok {
+		t.Fatalf("读取失败")
+	}
+	if _, ok := second.Get([]byte("counter")); !ok {
+		t.Fatalf("读取失败")
+	}
+	first.Put([]byte("counter"), []byte("2"))
+	second.Put([]byte("counter"), []byte("3"))
+	second.Put([]byte("other"), []byte("x"))
+	if err := first.Commit(); err != nil {
+		t.Fatalf("第一个批处理提交失败: %v", err)
+	}
+	if err := second.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("第二个批处理应该返回 ErrConflict: %v", err)
+	}
+	if value, _ := db.Get([]byte("counter")); string(value) != "2" {
+		t.Fatalf("冲突的批处理不应该生效: %q", value)
+	}
+	if _, ok := db.Get([]byte("other")); ok {
+		t.Fatalf("冲突的批处理中的其他键也不应该生效")
+	}
+
+	// 丢弃后重新读取可以提交成功
+	second.Discard()
+	value, _ := second.Get([]byte("counter"))
+	second.Put([]byte("counter"), append(value, '3'))
+	if err := second.Commit(); err != nil {
+		t.Fatalf("重试提交失败: %v", err)
+	}
+	if value, _ := db.Get([]byte("counter")); string(value) != "23" {
+		t.Fatalf("重试后读取失败: %q", value)
+	}
+
+	// 读取时不存在的键被普通写入创建，或只读的键被删除，也算冲突
+	batch := NewOptimisticBatch(db)
+	if _, ok := batch.Get([]byte("created")); ok {
+		t.Fatalf("不存在的键不应该读到")
+	}
+	batch.Put([]byte("created"), []byte("batch"))
+	if err := db.Put([]byte("created"), []byte("plain")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := batch.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("键在读取后被创建应该返回 ErrConflict: %v", err)
+	}
+	batch = NewOptimisticBatch(db)
+	batch.Get([]byte("counter"))
+	if _, err := db.Delete([]byte("counter")); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := batch.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("只读的键被删除应该返回 ErrConflict: %v", err)
+	}
+
+	// 普通批处理不做冲突检测，后提交的覆盖先提交的
+	first, second = NewBatch(db), NewBatch(db)
+	first.Put([]byte("created"), []byte("first"))
+	second.Put([]byte("created"), []byte("second"))
+	if err := first.Commit(); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	if err := second.Commit(); err != nil {
+		t.Fatalf("普通批处理不应该检测冲突: %v", err)
+	}
+	if value, _ := db.Get([]byte("created")); string(value) != "second" {
+		t.Fatalf("读取失败: %q", value)
+	}
+}
+
+// 测试批处理检查冲突之后、写入之前到达的普通写入等待提交完成，不会被批处理覆盖
+func TestBatch_ConflictWithPlainPut(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("counter"), []byte("1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	batch := NewOptimisticBatch(db)
+	if _, ok := batch.Get([]byte("counter")); !ok {
+		t.Fatalf("读取失败")
+	}
+	batch.Put([]byte("counter"), []byte("batch"))
+
+	done := make(chan error, 1)
+	db.commitHook = func() {
+		go func() { done <- db.Put([]byte("counter"), []byte("plain")) }()
+		select {
+		case err := <-done:
+			t.Errorf("普通写入不应该在批处理提交期间完成: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	db.commitHook = nil
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("提交完成后普通写入仍未完成")
+	}
+	if value, _ := db.Get([]byte("counter")); string(value) != "plain" {
+		t.Fatalf("之后的普通写入被批处理覆盖: %q", value)
+	}
+}
+
+// 测试提交过程中其他读取方看到的要么是批处理提交前的值，要么是提交后的值，不会只看到一部分键生效
+func TestBatch_CommitVisibility(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	keys := make([][]byte, 20)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key-%d", i))
+		if err := db.Put(keys[i], []byte("v0")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			values, found := db.GetMulti(keys)
+			for i := range keys {
+				if !found[i] || !bytes.Equal(values[i], values[0]) {
+					errCh <- fmt.Errorf("读到只生效了一部分的批处理: %s=%q, %s=%q", keys[0], values[0], keys[i], values[i])
+					return
+				}
+			}
+		}
+	}()
+	for round := 1; round <= 200; round++ {
+		batch := NewBatch(db)
+		for _, key := range keys {
+			batch.Put(key, []byte(fmt.Sprintf("v%d", round)))
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatalf("提交失败: %v", err)
+		}
+	}
+	close(done)
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatch_ScanPrefix(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	db, err := NewBitcask(getTestConfig(testDir))
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	for _, key := range []string{"user:1", "user:2", "user:3", "other:1"} {
+		if err := db.Put([]byte(key), []byte("old")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	batch := NewBatch(db)
+	batch.Put([]byte("user:2"), []byte("updated"))
+	batch.Delete([]byte("user:3"))
+	batch.Put([]byte("user:5"), []byte("new"))
+	batch.Put([]byte("user:4"), []byte("new"))
+	batch.Put([]byte("gone:1"), []byte("new"))
+	batch.Delete([]byte("gone:1"))
+	batch.Put([]byte("other:2"), []byte("new"))
+
+	scan := func(prefix string) []string {
+		var got []string
+		if err := batch.ScanPrefix([]byte(prefix), func(key, value []byte) error {
+			got = append(got, string(key)+"="+string(value))
+			return nil
+		}); err != nil {
+			t.Fatalf("扫描失败: %v", err)
+		}
+		return got
+	}
+
+	// 暂存的写入覆盖数据库中的值，暂存的删除被跳过，新键按写入顺序排在最后
+	want := []string{"user:1=old", "user:2=updated", "user:5=new", "user:4=new"}
+	if got := scan("user:"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("扫描结果错误: %v, 期望 %v", got, want)
+	}
+	if got := scan("gone:"); len(got) != 0 {
+		t.Fatalf("撤销的写入不应该被扫描到: %v", got)
+	}
+
+	// 数据库本身看不到暂存的修改，丢弃后批处理的扫描与数据库相同
+	var dbKeys []string
+	db.ScanPrefix([]byte("user:"), func(key, value []byte) error {
+		dbKeys = append(dbKeys, string(key)+"="+string(value))
+		return nil
+	})
+	if !reflect.DeepEqual(dbKeys, []string{"user:1=old", "user:2=old", "user:3=old"}) {
+		t.Fatalf("提交前数据库不应该改变: %v", dbKeys)
+	}
+	batch.Discard()
+	if got := scan("user:"); !reflect.DeepEqual(got, dbKeys) {
+		t.Fatalf("丢弃后扫描结果错误: %v", got)
+	}
+}
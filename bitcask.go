@@ -1,18 +1,22 @@
 package bitcask
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"hash/fnv"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/aixiasang/bitcask/config"
 	"github.com/aixiasang/bitcask/index"
@@ -23,200 +27,755 @@ import (
 )
 
 var (
-	ErrKeyNotFound    = errors.New("key not found")
-	ErrKeyHasDeleted  = errors.New("key has deleted")
-	ErrReachLimit     = errors.New("reach scan limit")
-	ErrExceedEndRange = errors.New("exceed end range")
+	ErrKeyNotFound       = errors.New("key not found")
+	ErrKeyHasDeleted     = errors.New("key has deleted")
+	ErrReachLimit        = errors.New("reach scan limit")
+	ErrExceedEndRange    = errors.New("exceed end range")
+	ErrCorruptHint       = errors.New("corrupt hint file")
+	ErrBatchTooLarge     = errors.New("批处理大小超过限制")
+	ErrBatchTooManyBytes = errors.New("批处理字节数超过限制")
+	ErrConflict          = errors.New("事务冲突: 键已被其他写入修改")
+	ErrReadOnly          = errors.New("数据库以只读模式打开")
+	ErrLocked            = errors.New("数据目录已被其他实例锁定")
+	ErrKeyTooLarge       = errors.New("key 长度超过限制")
+	ErrValueTooLarge     = errors.New("value 长度超过限制")
+)
+
+const (
+	hintMagic      uint32 = 0x42434854 // hint文件魔数 "BCHT"
+	hintVersion    byte   = 2          // hint文件格式版本，版本2在事务ID之后记录下一个文件ID
+	hintVersionV1  byte   = 1          // 不包含下一个文件ID的旧版本，仍可读取
+	hintHeaderSize        = 5          // 魔数(4) + 版本(1)
 )
 
 // Bitcask
 type Bitcask struct {
-	conf       *config.Config       // 配置
-	activeWal  *wal.Wal             // 活跃的WAL文件
-	oldWal     map[uint32]*wal.Wal  // 旧的WAL文件
-	memTable   index.Index          // 内存索引
-	fileId     uint32               // 当前文件ID
-	mu         sync.RWMutex         // 互斥锁
-	fileIds    []uint32             // 文件ID列表
-	txnId      atomic.Uint32        // 事务ID
-	comparator *utils.KeyComparator // 键比较器
-	flock      *flock.Flock         // 文件锁
+	conf       *config.Config           // 配置
+	activeWal  *wal.Wal                 // 活跃的WAL文件
+	oldWal     map[uint32]*wal.Wal      // 旧的WAL文件
+	activeBlob *wal.Wal                 // 活跃的blob文件，第一次写入超过 BlobThreshold 的 value 时创建
+	blobs      map[uint32]*wal.Wal      // 已封存的blob文件
+	nextBlobId uint32                   // 下一个新建blob文件使用的ID
+	memTable   index.Index              // 内存索引
+	fileId     uint32                   // 当前文件ID
+	nextFileId uint32                   // 下一个新建WAL文件使用的ID，只增不减，随hint文件持久化
+	mu         sync.RWMutex             // 互斥锁
+	writeMu    sync.Mutex               // 串行化写入：写WAL文件和更新索引都在锁内完成，批处理从冲突检测到提交、Merge 封存和交换文件时不会插入其他写入
+	mergeMu    sync.Mutex               // 串行化 Merge
+	fileIds    []uint32                 // 文件ID列表
+	txnId      atomic.Uint32            // 事务ID
+	comparator *utils.KeyComparator     // 键比较器
+	flock      *flock.Flock             // 文件锁
+	bgStop     chan struct{}            // 通知后台协程退出
+	bgWg       sync.WaitGroup           // 等待后台协程退出
+	dirty      atomic.Bool              // 上次生成hint文件之后索引是否有变化
+	loadedHint *hintSummary             // 启动时加载的hint文件摘要，没有hint文件时为nil
+	subMu      sync.RWMutex             // 保护 subs
+	subs       map[*subscriber]struct{} // 变更事件的订阅方
+	mergeFault func(stage string) error // 测试用：在 Merge 的各个阶段返回错误，模拟崩溃
+	commitHook func()                   // 测试用：批处理提交检查冲突之后、写入之前调用
+}
+
+// hintSummary hint文件内容的摘要，用于判断重放WAL之后的索引与hint文件是否一致
+type hintSummary struct {
+	txnId      uint32
+	nextFileId uint32
+	entries    int
+	digest     uint64 // 所有键及其位置的哈希之和，与遍历顺序无关
+}
+
+// add 将一个键及其位置计入摘要
+func (s *hintSummary) add(key []byte, pos *record.Pos) {
+	h := fnv.New64a()
+	h.Write(key)
+	var buf [12]byte
+	binary.BigEndian.PutUint32(buf[0:4], pos.FileId)
+	binary.BigEndian.PutUint32(buf[4:8], pos.Offset)
+	binary.BigEndian.PutUint32(buf[8:12], pos.Length)
+	h.Write(buf[:])
+	s.digest += h.Sum64()
+	s.entries++
 }
 
 func NewBitcask(conf *config.Config) (*Bitcask, error) {
-	// 创建 WAL 目录
-	walPath := filepath.Join(conf.DataDir, conf.WalDir)
-	if err := os.MkdirAll(walPath, 0755); err != nil {
+	if err := conf.Validate(); err != nil {
 		return nil, err
 	}
 
-	// 创建 hint 目录
-	hintPath := filepath.Join(conf.DataDir, conf.HintDir)
-	if err := os.MkdirAll(hintPath, 0755); err != nil {
-		return nil, err
+	// 只读模式不创建任何目录，数据目录必须已经存在
+	if !conf.ReadOnly {
+		// 创建 WAL 目录
+		walPath := filepath.Join(conf.DataDir, conf.WalDir)
+		if err := os.MkdirAll(walPath, 0755); err != nil {
+			return nil, err
+		}
+
+		// 创建 hint 目录
+		hintPath := filepath.Join(conf.DataDir, conf.HintDir)
+		if err := os.MkdirAll(hintPath, 0755); err != nil {
+			return nil, err
+		}
 	}
 
 	bc := &Bitcask{
 		conf:       conf,
 		oldWal:     make(map[uint32]*wal.Wal),
-		memTable:   index.NewBTreeIndex(conf.BTreeOrder),
+		blobs:      make(map[uint32]*wal.Wal),
+		memTable:   newMemTable(conf),
 		fileId:     0,
 		txnId:      atomic.Uint32{},
 		comparator: utils.NewKeyComparator(),
 		flock:      flock.New(filepath.Join(conf.DataDir, "bitcask.lock")),
 	}
 
+	// 读写实例持有排他锁，只读实例持有共享锁：多个只读实例可以共存，但不能与读写实例同时打开
+	tryLock := bc.flock.TryLock
+	if conf.ReadOnly {
+		tryLock = bc.flock.TryRLock
+	}
+	locked, err := tryLock()
+	if err != nil {
+		return nil, fmt.Errorf("锁定数据目录失败: %v", err)
+	}
+	if !locked {
+		return nil, fmt.Errorf("%w: %s", ErrLocked, conf.DataDir)
+	}
+	if err := bc.load(); err != nil {
+		bc.flock.Unlock()
+		return nil, err
+	}
+	if !conf.ReadOnly && !conf.AutoSync && conf.SyncInterval > 0 {
+		bc.runEvery(conf.SyncInterval, "同步WAL", bc.Sync)
+	}
+	if conf.ExpireSweepInterval > 0 {
+		bc.runEvery(conf.ExpireSweepInterval, "清理过期键", bc.purgeExpired)
+	}
+	return bc, nil
+}
+
+// load 从hint文件和WAL文件重建索引，并准备好活跃WAL文件
+func (bc *Bitcask) load() error {
+	// 先完成或丢弃上次没有完成的合并，之后加载的文件处于合并前或合并后的完整状态
+	if err := bc.recoverMerge(); err != nil {
+		return err
+	}
 	// 尝试从 hint 文件加载索引作为基础状态
+	// hint文件只是索引的快照，损坏时索引没有被修改，忽略它从WAL完整重放，关闭时会重新生成
 	if err := bc.LoadHint(); err != nil {
-		return nil, fmt.Errorf("从hint文件加载索引失败: %v", err)
-	}
-	if bc.conf.Debug {
-		fmt.Printf("hint文件加载成功，最新的事务ID: %d\n", bc.txnId.Load())
+		if !errors.Is(err, ErrCorruptHint) {
+			return fmt.Errorf("从hint文件加载索引失败: %w", err)
+		}
+		bc.conf.Warnf("hint文件损坏，回退到WAL重放: %v", err)
 	}
+	bc.conf.Debugf("hint文件加载成功，最新的事务ID: %d", bc.txnId.Load())
 	// 然后处理所有WAL文件以获取最新更新
 	// 这确保即使存在hint文件，也能应用最新的变更
 	if err := bc.loadWalFiles(); err != nil {
-		return nil, err
+		return err
+	}
+	if err := bc.loadBlobFiles(); err != nil {
+		return err
 	}
 
 	if bc.activeWal == nil {
+		if bc.conf.ReadOnly {
+			return fmt.Errorf("只读模式下没有可打开的WAL文件: %s", filepath.Join(bc.conf.DataDir, bc.conf.WalDir))
+		}
+		// 没有WAL文件时从hint记录的下一个文件ID开始，不复用hint中可能引用过的ID
+		bc.fileId = bc.nextFileId
+		bc.nextFileId++
 		activeWal, err := wal.NewWal(bc.conf, bc.fileId)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		bc.activeWal = activeWal
 	}
+	if err := bc.dropStaleEntries(); err != nil {
+		return err
+	}
+	unchanged, err := bc.matchesLoadedHint()
+	if err != nil {
+		return err
+	}
+	bc.dirty.Store(!unchanged)
 	if bc.txnId.Load() != 0 {
 		bc.txnId.Add(1)
 	}
-	return bc, nil
+	return nil
+}
+
+// dropStaleEntries 删除索引中指向已不存在的WAL文件的键
+//
+// 旧版本的 Merge 不会更新hint文件，hint中已删除的键仍指向被合并删除的文件，
+// 而这些键的删除标记已经随旧文件一起删除，重放无法覆盖它们
+func (bc *Bitcask) dropStaleEntries() error {
+	var stale [][]byte
+	if err := bc.memTable.Foreach(func(key []byte, pos *record.Pos) error {
+		if _, ok := bc.oldWal[pos.FileId]; !ok && pos.FileId != bc.fileId {
+			stale = append(stale, key)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if err := bc.memTable.Delete(key); err != nil {
+			return fmt.Errorf("清理过期的hint记录失败: %v", err)
+		}
+	}
+	if len(stale) > 0 {
+		bc.conf.Warnf("hint文件中有%d个键指向已删除的WAL文件，已从索引中移除", len(stale))
+	}
+	return nil
+}
+
+// matchesLoadedHint 判断启动完成后的索引、事务ID和下一个文件ID是否与加载的hint文件一致，
+// 一致时关闭前没有写入就不需要重新生成hint文件
+func (bc *Bitcask) matchesLoadedHint() (bool, error) {
+	if bc.loadedHint == nil {
+		return false, nil
+	}
+	cur := hintSummary{txnId: bc.txnId.Load(), nextFileId: bc.nextFileId}
+	if err := bc.memTable.Foreach(func(key []byte, pos *record.Pos) error {
+		cur.add(key, pos)
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	return cur == *bc.loadedHint, nil
+}
+
+// Sync 将活跃WAL文件和活跃blob文件同步到磁盘
+func (bc *Bitcask) Sync() error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if bc.activeBlob != nil {
+		if err := bc.activeBlob.Sync(); err != nil {
+			return err
+		}
+	}
+	return bc.activeWal.Sync()
+}
+
+// runEvery 启动后台协程，按固定间隔执行 fn，直到 Close
+func (bc *Bitcask) runEvery(interval time.Duration, name string, fn func() error) {
+	if bc.bgStop == nil {
+		bc.bgStop = make(chan struct{})
+	}
+	stop := bc.bgStop
+	bc.bgWg.Add(1)
+	go func() {
+		defer bc.bgWg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := fn(); err != nil {
+					bc.conf.Warnf("后台%s失败: %v", name, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
 }
 
+// stopBackground 停止所有后台协程并等待其退出
+func (bc *Bitcask) stopBackground() {
+	if bc.bgStop == nil {
+		return
+	}
+	close(bc.bgStop)
+	bc.bgWg.Wait()
+	bc.bgStop = nil
+}
+
+// purgeExpired 从索引中移除已过期的键，磁盘上的记录在下次 Merge 时清理
+func (bc *Bitcask) purgeExpired() error {
+	type expiredEntry struct {
+		key []byte
+		pos *record.Pos
+	}
+	var expired []expiredEntry
+	now := time.Now()
+
+	bc.mu.RLock()
+	err := bc.memTable.Foreach(func(key []byte, pos *record.Pos) error {
+		// 只需要过期时间，不读取 blob 文件中的 value
+		rec, err := bc.readRawRecord(pos)
+		if err != nil {
+			return err
+		}
+		if rec.IsExpired(now) {
+			expired = append(expired, expiredEntry{key: key, pos: pos})
+		}
+		return nil
+	})
+	bc.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+	for _, e := range expired {
+		// 仅当索引仍指向过期记录时才删除，避免误删期间重新写入的键
+		if cur, err := bc.memTable.Get(e.key); err == nil && cur == e.pos {
+			if err := bc.memTable.Delete(e.key); err != nil {
+				return err
+			}
+			bc.dirty.Store(true)
+		}
+	}
+	return nil
+}
+
+// newMemTable 根据配置创建内存索引
+func newMemTable(conf *config.Config) index.Index {
+	switch conf.IndexType {
+	case config.IndexTypeHashMap:
+		return index.NewHashMapIndex(index.DefaultHashMapShards)
+	default:
+		// 跳表索引尚未实现，回退到BTree
+		return index.NewBTreeIndex(conf.BTreeOrder)
+	}
+}
+
+// active 返回当前的活跃WAL文件
+func (bc *Bitcask) active() *wal.Wal {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.activeWal
+}
+
+// tryRotate 活跃文件达到 MaxFileSize 时轮转
 func (bc *Bitcask) tryRotate() error {
-	if bc.activeWal.Size() < bc.conf.MaxFileSize {
+	if bc.active().Size() < bc.conf.MaxFileSize {
 		return nil
 	}
-	return bc.mustRotate()
+	return bc.rotate(false)
 }
+
+// mustRotate 无论活跃文件大小都轮转
 func (bc *Bitcask) mustRotate() error {
+	return bc.rotate(true)
+}
+
+// rotate 封存活跃文件并切换到新文件。新文件创建成功后才在锁内同时更新 fileId 和 activeWal，
+// 读取方不会看到指向尚未创建的文件的 fileId；多个写入同时发现文件已满时只轮转一次
+func (bc *Bitcask) rotate(force bool) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if !force && bc.activeWal.Size() < bc.conf.MaxFileSize {
+		return nil
+	}
 	if err := bc.activeWal.Sync(); err != nil {
 		return err
 	}
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
-
-	// 保存当前的 fileId
-	oldFileId := bc.fileId
-
-	// 将当前的 WAL 文件添加到旧文件列表
-	bc.oldWal[oldFileId] = bc.activeWal
 
-	// 创建新的 WAL 文件
-	bc.fileIds = append(bc.fileIds, bc.fileId)
-	bc.fileId++
-	activeWal, err := wal.NewWal(bc.conf, bc.fileId)
+	// 创建新的 WAL 文件，ID 由单调递增的计数器分配，不会复用已删除文件的ID
+	activeWal, err := wal.NewWal(bc.conf, bc.nextFileId)
 	if err != nil {
 		return err
 	}
+
+	// 将当前的 WAL 文件添加到旧文件列表
+	bc.oldWal[bc.fileId] = bc.activeWal
+	bc.fileIds = append(bc.fileIds, bc.fileId)
+	bc.fileId = bc.nextFileId
+	bc.nextFileId++
 	bc.activeWal = activeWal
+	bc.dirty.Store(true)
 	return nil
 }
 func (bc *Bitcask) Put(key, value []byte) error {
+	if err := bc.CheckSize(key, value); err != nil {
+		return err
+	}
+	return bc.put(key, value, 0, 0)
+}
+
+// PutString 与 Put 相同，key 和 value 为字符串；空字符串的 value 是空值而不是删除
+func (bc *Bitcask) PutString(key, value string) error {
+	return bc.Put([]byte(key), []byte(value))
+}
+
+// CheckSize 检查key和value的长度是否超过 MaxKeySize/MaxValueSize，返回与 Put 相同的
+// ErrKeyTooLarge/ErrValueTooLarge，调用方可以在写入多个相关的键之前先检查
+// 只在对外的写入接口中检查，Merge 重写已有记录时不受调小后的上限影响
+func (bc *Bitcask) CheckSize(key, value []byte) error {
+	if uint64(len(key)) > uint64(bc.conf.MaxKeySize) {
+		return fmt.Errorf("%w: %d > %d", ErrKeyTooLarge, len(key), bc.conf.MaxKeySize)
+	}
+	if uint64(len(value)) > uint64(bc.conf.MaxValueSize) {
+		return fmt.Errorf("%w: %d > %d", ErrValueTooLarge, len(value), bc.conf.MaxValueSize)
+	}
+	return nil
+}
+
+// PutWithTTL 写入带过期时间的键值对，过期后读取视为不存在
+func (bc *Bitcask) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	if value == nil {
+		return errors.New("value cannot be nil")
+	}
+	if err := bc.CheckSize(key, value); err != nil {
+		return err
+	}
+	return bc.put(key, value, time.Now().Add(ttl).UnixNano(), 0)
+}
+
+// put 写入一条记录，timestamp 为0时使用当前时间
+func (bc *Bitcask) put(key, value []byte, expireAt, timestamp int64) error {
+	if bc.conf.ReadOnly {
+		return ErrReadOnly
+	}
 	if key == nil {
 		return errors.New("key cannot be nil")
 	}
+	rec := record.NewRecordWithExpire(key, value, expireAt)
+	rec.Timestamp = timestamp
+	return bc.putRecord(key, rec, false)
+}
+
+// putRecord 写入记录并更新索引，超过 BlobThreshold 的 value 先写入blob文件；
+// noSync 为 true 时忽略 AutoSync，由调用方负责之后同步
+//
+// 变更事件在 writeMu 内发布，订阅方收到事件的顺序与记录在 WAL 中的顺序一致
+func (bc *Bitcask) putRecord(key []byte, rec *record.Record, noSync bool) error {
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+	// 分离到blob文件后 rec.Value 变为blob位置，事件使用原始的 value
+	event := changeEvent(key, rec.Value)
 	if err := bc.tryRotate(); err != nil {
 		return err
 	}
-	pos, err := bc.activeWal.Write(key, value)
+	if err := bc.separate(key, rec); err != nil {
+		return err
+	}
+	activeWal := bc.active()
+	write := activeWal.WriteRecord
+	if noSync {
+		write = activeWal.WriteRecordNoSync
+	}
+	pos, err := write(rec)
 	if err != nil {
 		return err
 	}
 	if err := bc.memTable.Put(key, pos); err != nil {
 		return err
 	}
+	bc.dirty.Store(true)
+	bc.publish(event)
 	return nil
 }
 func (bc *Bitcask) Get(key []byte) ([]byte, bool) {
-	value, ok, err := bc.get(key)
+	value, err := bc.GetE(key)
 	if err != nil {
-		if err == ErrKeyNotFound || err == ErrKeyHasDeleted {
-			return nil, false
-		}
 		return nil, false
 	}
-	return value, ok
+	return value, true
 }
+
+// GetString 与 Get 相同，返回字符串形式的值
+func (bc *Bitcask) GetString(key string) (string, bool) {
+	value, ok := bc.Get([]byte(key))
+	if !ok {
+		return "", false
+	}
+	return string(value), true
+}
+
+// GetE 获取key对应的值，返回具体的错误：
+// 从未写入返回 ErrKeyNotFound，已删除返回 ErrKeyHasDeleted
+func (bc *Bitcask) GetE(key []byte) ([]byte, error) {
+	value, _, err := bc.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// TTL 返回key的剩余过期时间，hasTTL 为 false 表示key永不过期；
+// key不存在或已过期返回 ErrKeyNotFound，已删除返回 ErrKeyHasDeleted
+func (bc *Bitcask) TTL(key []byte) (ttl time.Duration, hasTTL bool, err error) {
+	rec, err := bc.liveRecord(key)
+	if err != nil {
+		return 0, false, err
+	}
+	if rec.ExpireAt == 0 {
+		return 0, false, nil
+	}
+	return time.Until(time.Unix(0, rec.ExpireAt)), true, nil
+}
+
+// GetWithMeta 获取key对应的值及其写入时间（UnixNano），Merge 会保留原来的写入时间；
+// 旧格式的记录没有时间戳，ts 为0，直到 Merge 以合并时的时间重写
+func (bc *Bitcask) GetWithMeta(key []byte) (value []byte, ts int64, ok bool) {
+	rec, err := bc.liveRecord(key)
+	if err != nil {
+		return nil, 0, false
+	}
+	return rec.Value, rec.Timestamp, true
+}
+
 func (bc *Bitcask) get(key []byte) ([]byte, bool, error) {
+	rec, err := bc.liveRecord(key)
+	if err != nil {
+		return nil, false, err
+	}
+	return rec.Value, true, nil
+}
+
+// liveRecord 读取key当前有效的记录，已删除或已过期的记录返回对应的错误
+func (bc *Bitcask) liveRecord(key []byte) (*record.Record, error) {
 	if key == nil {
-		return nil, false, errors.New("key cannot be nil")
+		return nil, errors.New("key cannot be nil")
 	}
 
+	// 查询索引和读取记录都在读锁内完成，Merge 不会在两者之间切换索引并删除旧文件
+	bc.mu.RLock()
 	pos, err := bc.memTable.Get(key)
 	if err != nil {
-		return nil, false, err
+		bc.mu.RUnlock()
+		return nil, err
 	}
 	if pos == nil {
-		return nil, false, ErrKeyNotFound
+		bc.mu.RUnlock()
+		return nil, ErrKeyNotFound
+	}
+	rec, err := bc.readRecord(pos)
+	bc.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if rec.IsDeleted() {
+		return nil, ErrKeyHasDeleted
+	}
+	if rec.IsExpired(time.Now()) {
+		return nil, ErrKeyNotFound
+	}
+	return rec, nil
+}
+
+// readRecord 根据位置信息从对应的WAL文件读取记录，value 保存在blob文件中时一并读取，调用方需要持有 bc.mu 读锁
+func (bc *Bitcask) readRecord(pos *record.Pos) (*record.Record, error) {
+	rec, err := bc.readRawRecord(pos)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.resolveBlob(rec); err != nil {
+		return nil, fmt.Errorf("error reading blob of file %d at offset %d: %w", pos.FileId, pos.Offset, err)
 	}
+	return rec, nil
+}
+
+// readRawRecord 根据位置信息从对应的WAL文件读取记录，blob 引用记录的 value 是blob文件中的位置，
+// 调用方需要持有 bc.mu 读锁
+func (bc *Bitcask) readRawRecord(pos *record.Pos) (*record.Record, error) {
 	var targetWal *wal.Wal
 	if pos.FileId == bc.fileId {
 		targetWal = bc.activeWal
 	} else if w, ok := bc.oldWal[pos.FileId]; ok {
 		targetWal = w
 	} else {
-		return nil, false, fmt.Errorf("file not found: fileId=%d", pos.FileId)
+		return nil, fmt.Errorf("file not found: fileId=%d", pos.FileId)
 	}
 
 	rec, err := targetWal.ReadPos(pos)
 	if err != nil {
-		return nil, false, fmt.Errorf("error reading from file %d at offset %d: %v",
+		return nil, fmt.Errorf("error reading from file %d at offset %d: %w",
 			pos.FileId, pos.Offset, err)
 	}
-	if rec.RecordType == record.RecordTypeDelete {
-		return nil, false, ErrKeyHasDeleted
+	return rec, nil
+}
+
+// GetMulti 批量读取，先统一查询索引再读取数据
+// values[i] 和 found[i] 与 keys[i] 一一对应
+func (bc *Bitcask) GetMulti(keys [][]byte) ([][]byte, []bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	positions := make([]*record.Pos, len(keys))
+	for i, key := range keys {
+		if key == nil {
+			continue
+		}
+		pos, err := bc.memTable.Get(key)
+		if err != nil {
+			continue
+		}
+		positions[i] = pos
 	}
-	return rec.Value, true, nil
+
+	values := make([][]byte, len(keys))
+	found := make([]bool, len(keys))
+	for i, pos := range positions {
+		if pos == nil {
+			continue
+		}
+		rec, err := bc.readRecord(pos)
+		if err != nil || rec.IsDeleted() || rec.IsExpired(time.Now()) {
+			continue
+		}
+		values[i] = rec.Value
+		found[i] = true
+	}
+	return values, found
 }
 
-func (bc *Bitcask) Delete(key []byte) error {
+// PutMulti 批量写入，不保证原子性
+// 写入过程中不逐条同步，全部写完后统一同步一次
+func (bc *Bitcask) PutMulti(pairs map[string][]byte) error {
+	if bc.conf.ReadOnly {
+		return ErrReadOnly
+	}
+	// 写入前检查全部键值对，避免超限时只写入了一部分
+	for key, value := range pairs {
+		if err := bc.CheckSize([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	for key, value := range pairs {
+		if err := bc.putRecord([]byte(key), record.NewRecord([]byte(key), value), true); err != nil {
+			return err
+		}
+	}
+	// 轮转时旧文件已同步，这里只需同步活跃文件
+	if bc.conf.AutoSync {
+		if err := bc.active().Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	pos, err := bc.memTable.Get(key)
-	if err != nil {
-		return err
+// Delete 删除key，仅当key存在且写入了删除标记时返回true
+func (bc *Bitcask) Delete(key []byte) (bool, error) {
+	if bc.conf.ReadOnly {
+		return false, ErrReadOnly
 	}
-	if pos == nil {
-		return nil
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+	if _, err := bc.GetE(key); err != nil {
+		if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrKeyHasDeleted) {
+			return false, nil
+		}
+		return false, err
 	}
 	if err := bc.tryRotate(); err != nil {
-		return err
+		return false, err
 	}
-	if _, err = bc.activeWal.Write(key, nil); err != nil {
+	pos, err := bc.active().Write(key, nil)
+	if err != nil {
+		return false, err
+	}
+	// 索引保留删除标记的位置，直到Merge时清理
+	if err := bc.memTable.Put(key, pos); err != nil {
+		return false, err
+	}
+	bc.dirty.Store(true)
+	bc.publish(Event{Type: EventDelete, Key: key})
+	return true, nil
+}
+
+// DeleteString 与 Delete 相同，key 为字符串
+func (bc *Bitcask) DeleteString(key string) (bool, error) {
+	return bc.Delete([]byte(key))
+}
+
+// scanEntry Scan 开始时索引中某个键的位置快照
+type scanEntry struct {
+	key []byte
+	pos *record.Pos
+}
+
+// Scan 按索引顺序遍历所有有效键值对
+//
+// 遍历前在索引锁内复制所有键的位置，之后逐条在 bc.mu 读锁内读取记录，
+// 回调在锁外执行，因此回调中可以写入或删除键。遍历的是 Scan 开始时的索引快照，
+// 之后写入的新键不会被遍历，并发的轮转和 Merge 不会导致读取失败
+func (bc *Bitcask) Scan(fn func(key []byte, value []byte) error) error {
+	var entries []scanEntry
+	if err := bc.memTable.Foreach(func(key []byte, pos *record.Pos) error {
+		entries = append(entries, scanEntry{key: key, pos: pos})
+		return nil
+	}); err != nil {
 		return err
 	}
-	if err := bc.memTable.Delete(key); err != nil {
+	return bc.scanSnapshot(entries, fn)
+}
+
+// ScanPrefix 按索引顺序遍历所有以 prefix 开头的有效键值对
+//
+// 由索引的 ScanPrefix 直接定位到带前缀的键，不会扫描无关的键；
+// 与 Scan 一样遍历的是开始时的快照，回调中可以写入或删除键
+func (bc *Bitcask) ScanPrefix(prefix []byte, fn func(key, value []byte) error) error {
+	var entries []scanEntry
+	if err := bc.memTable.ScanPrefix(prefix, func(key []byte, pos *record.Pos) error {
+		entries = append(entries, scanEntry{key: key, pos: pos})
+		return nil
+	}); err != nil {
 		return err
 	}
-	return nil
+	return bc.scanSnapshot(entries, fn)
 }
 
-// 支持Scan进行扫描查找
-func (bc *Bitcask) Scan(fn func(key []byte, value []byte) error) error {
-	return bc.memTable.ForeachUnSafe(func(key []byte, pos *record.Pos) error {
-		var targetWal *wal.Wal
-		if pos.FileId == bc.fileId {
-			targetWal = bc.activeWal
-		} else if w, ok := bc.oldWal[pos.FileId]; ok {
-			targetWal = w
-		} else {
-			return fmt.Errorf("file not found: fileId=%d", pos.FileId)
+// Fold 按索引顺序把所有有效键值对依次累积到 acc 上，返回最终结果，用于计算总数、总大小等聚合值
+//
+// 基于 Scan 的快照实现，并发安全；fn 返回错误时停止遍历，返回当时的累积值和该错误
+func (bc *Bitcask) Fold(acc interface{}, fn func(acc interface{}, key, value []byte) (interface{}, error)) (interface{}, error) {
+	err := bc.Scan(func(key []byte, value []byte) error {
+		next, err := fn(acc, key, value)
+		if err != nil {
+			return err
 		}
-		rec, err := targetWal.ReadPos(pos)
+		acc = next
+		return nil
+	})
+	return acc, err
+}
+
+// scanSnapshot 依次读取快照中的记录，跳过删除标记和已过期的记录
+func (bc *Bitcask) scanSnapshot(entries []scanEntry, fn func(key []byte, value []byte) error) error {
+	for _, entry := range entries {
+		rec, err := bc.readSnapshot(entry)
 		if err != nil {
 			return fmt.Errorf("读取WAL文件失败: %v", err)
 		}
-		return fn(rec.Key, rec.Value)
-	})
+		// 跳过删除标记和已过期的记录
+		if rec == nil || rec.IsDeleted() || rec.IsExpired(time.Now()) {
+			continue
+		}
+		if err := fn(rec.Key, rec.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSnapshot 读取快照中的记录。快照之后 Merge 可能已经删除了记录所在的文件，
+// 读取失败且索引中的位置已经变化时改为读取最新位置，键已从索引删除时返回 nil
+//
+// 重新查询索引和读取最新位置在同一个读锁内完成，两者之间不会有新的 Merge 删除文件
+func (bc *Bitcask) readSnapshot(entry scanEntry) (*record.Record, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	rec, err := bc.readRecord(entry.pos)
+	if err == nil {
+		return rec, nil
+	}
+
+	current, _ := bc.memTable.Get(entry.key)
+	if current == nil {
+		return nil, nil
+	}
+	if samePos(current, entry.pos) {
+		return nil, err
+	}
+	return bc.readRecord(current)
 }
 
 type ScanRangeResult struct {
@@ -236,56 +795,39 @@ func (bc *Bitcask) ScanRange(start, end []byte) ([]*ScanRangeResult, error) {
 	return bc.ScanRangeOptimized(start, end, 0)
 }
 
-// 优化的范围查找方法，利用KeyComparator的InRange方法
+// ScanRangeOptimized 返回 [start, end] 范围内的键值对，limit 大于0时最多返回 limit 个
+//
+// 范围选择交给索引的 Scan 完成，结果已经按先长度后内容的顺序排列，
+// 这里只读取范围内的记录并跳过删除标记和已过期的键，不再扫描全部数据或重新排序
 func (bc *Bitcask) ScanRangeOptimized(start, end []byte, limit int) ([]*ScanRangeResult, error) {
 	results := make([]*ScanRangeResult, 0, limit)
-	count := 0
-
-	// 先收集符合条件的键值对
-	keys := make([][]byte, 0)
-	values := make(map[string][]byte)
-
-	err := bc.Scan(func(key []byte, value []byte) error {
-		// 使用comparator.InRange直接判断key是否在[start, end]范围内
-		if bc.comparator.InRange(key, start, end) {
-			keys = append(keys, key)
-			values[string(key)] = value
-		} else if bc.comparator.Greater(key, end) {
-			// 超出范围，提前终止
-			return ErrExceedEndRange
-		}
-
-		return nil
-	})
+	if bc.comparator.Greater(start, end) {
+		return results, nil
+	}
 
-	// 只返回真正的错误，忽略我们用于控制流程的特殊错误
-	if err != nil && err != ErrReachLimit && err != ErrExceedEndRange {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	entries, err := bc.memTable.Scan(start, end)
+	if err != nil {
 		return nil, err
 	}
-
-	// 对键进行排序
-	// 注意我们需要使用自定义的排序方式，与比较器保持一致
-	sort.Slice(keys, func(i, j int) bool {
-		// 先比较长度
-		if len(keys[i]) != len(keys[j]) {
-			return len(keys[i]) < len(keys[j])
-		}
-		// 长度相同，比较内容
-		return bytes.Compare(keys[i], keys[j]) < 0
-	})
-
-	// 按照排序后的顺序添加到结果中
-	for _, key := range keys {
-		if limit > 0 && count >= limit {
+	now := time.Now()
+	for _, entry := range entries {
+		if limit > 0 && len(results) >= limit {
 			break
 		}
+		rec, err := bc.readRecord(&entry.Pos)
+		if err != nil {
+			return nil, err
+		}
+		if rec.IsDeleted() || rec.IsExpired(now) {
+			continue
+		}
 		results = append(results, &ScanRangeResult{
-			Key:   key,
-			Value: values[string(key)],
+			Key:   []byte(entry.Key),
+			Value: rec.Value,
 		})
-		count++
 	}
-
 	return results, nil
 }
 
@@ -305,17 +847,20 @@ func (bc *Bitcask) loadWalFiles() error {
 		// fmt.Sprintf("wal-%d.log", fileId)
 		fileName := fp.Name()
 		if !strings.HasPrefix(fileName, "wal-") || !strings.HasSuffix(fileName, ".log") {
-			fmt.Printf("跳过非WAL文件: %s\n", fileName)
+			bc.conf.Warnf("跳过非WAL文件: %s", fileName)
 			continue // 跳过不合规文件，而不是返回错误
 		}
 		fileName = strings.TrimSuffix(fileName, ".log")
 		fileName = strings.TrimPrefix(fileName, "wal-")
 		fileId, err := strconv.ParseUint(fileName, 10, 32)
 		if err != nil {
-			fmt.Printf("无法解析文件ID: %s, 错误: %v\n", fileName, err)
+			bc.conf.Warnf("无法解析文件ID: %s, 错误: %v", fileName, err)
 			continue // 跳过无法解析ID的文件
 		}
 		bc.fileIds = append(bc.fileIds, uint32(fileId))
+		if uint32(fileId) >= bc.nextFileId {
+			bc.nextFileId = uint32(fileId) + 1
+		}
 	}
 
 	// 确保按照ID排序，这样可以按正确顺序处理文件
@@ -323,44 +868,142 @@ func (bc *Bitcask) loadWalFiles() error {
 		return bc.fileIds[i] < bc.fileIds[j]
 	})
 
-	fmt.Printf("找到 %d 个WAL文件，按顺序处理: %v\n", len(bc.fileIds), bc.fileIds)
+	bc.conf.Debugf("找到 %d 个WAL文件，按顺序处理: %v", len(bc.fileIds), bc.fileIds)
 
-	// 从最旧到最新处理WAL文件
+	wals := make([]*wal.Wal, 0, len(bc.fileIds))
 	for i, fileId := range bc.fileIds {
 		curWal, err := wal.NewWal(bc.conf, uint32(fileId))
 		if err != nil {
-			return fmt.Errorf("无法打开WAL文件 %d: %v", fileId, err)
+			return fmt.Errorf("无法打开WAL文件 %d: %w", fileId, err)
 		}
+		wals = append(wals, curWal)
 
-		fmt.Printf("正在处理WAL文件 %d (索引 %d/%d), 事务ID: %d\n", fileId, i+1, len(bc.fileIds), bc.txnId.Load())
-
-		if bc.conf.LoadHint {
-			if err := curWal.ReadAll(bc.memTable, &bc.txnId); err != nil {
-				return fmt.Errorf("读取WAL文件 %d 失败: %v", fileId, err)
-			}
-			curWal.UpdateOffset()
-		}
 		bc.mu.Lock()
 		if i == len(bc.fileIds)-1 {
 			// 最后一个文件成为活跃WAL
-			fmt.Printf("设置文件 %d 为活跃WAL\n", fileId)
+			bc.conf.Debugf("设置文件 %d 为活跃WAL", fileId)
 			bc.activeWal = curWal
 			bc.fileId = uint32(fileId)
 		} else {
 			// 其他文件存储为旧WAL
-			fmt.Printf("添加文件 %d 到旧WAL映射\n", fileId)
+			bc.conf.Debugf("添加文件 %d 到旧WAL映射", fileId)
 			bc.oldWal[uint32(fileId)] = curWal
 		}
 		bc.mu.Unlock()
 	}
+	if !bc.conf.LoadHint {
+		return nil
+	}
+	return bc.replayWals(wals)
+}
+
+// replayWals 从最旧到最新重放WAL文件，批处理可能跨越多个文件，所有文件共用一个重放状态
+//
+// 解析文件（读取和CRC校验）由多个协程并行进行，解析结果仍按文件ID顺序更新索引，
+// 后写入的记录覆盖先写入的记录，与逐个文件重放的结果相同
+func (bc *Bitcask) replayWals(wals []*wal.Wal) error {
+	workers := bc.conf.ReplayWorkers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	replay := wal.NewReplayState()
+	apply := func(i int, segment *wal.Segment) error {
+		curWal := wals[i]
+		bc.conf.Debugf("正在处理WAL文件 %d (索引 %d/%d), 事务ID: %d", curWal.FileId(), i+1, len(wals), bc.txnId.Load())
+		if err := segment.Apply(bc.memTable, &bc.txnId, replay); err != nil {
+			return fmt.Errorf("读取WAL文件 %d 失败: %v", curWal.FileId(), err)
+		}
+		if i < len(wals)-1 || bc.conf.ReadOnly {
+			curWal.UpdateOffset()
+			return nil
+		}
+		// 新的写入追加在活跃文件末尾，先截掉停止解析之后的数据，否则它们会在下次重放时被一起忽略
+		n, err := curWal.TruncateTail()
+		if errors.Is(err, wal.ErrCorruptRecord) {
+			// 损坏的记录在文件中间，保留该文件供 Verify 排查，新的写入追加到新的活跃文件
+			bc.conf.Warnf("WAL文件 %d 中间有损坏的记录，之后的记录已被忽略，保留该文件并切换到新文件: %v", curWal.FileId(), err)
+			curWal.UpdateOffset()
+			return bc.mustRotate()
+		}
+		if err != nil {
+			return fmt.Errorf("截断WAL文件 %d 失败: %v", curWal.FileId(), err)
+		}
+		if n > 0 {
+			bc.conf.Warnf("WAL文件 %d 末尾有 %d 字节无法解析，已截断", curWal.FileId(), n)
+		}
+		return nil
+	}
+	if workers == 1 || len(wals) == 1 {
+		for i, curWal := range wals {
+			segment, err := curWal.Decode()
+			if err != nil {
+				return fmt.Errorf("读取WAL文件 %d 失败: %v", curWal.FileId(), err)
+			}
+			if err := apply(i, segment); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	type decoded struct {
+		segment *wal.Segment
+		err     error
+	}
+	results := make([]chan decoded, len(wals))
+	for i := range results {
+		results[i] = make(chan decoded, 1)
+	}
+	// 已解析但尚未应用的文件最多 workers 个，解析结果不会因为文件很多而占用过多内存
+	window := make(chan struct{}, workers)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	// 出错提前返回时，等待正在解析的协程结束后再返回，调用方随后会关闭这些文件
+	defer wg.Wait()
+	defer close(done)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, curWal := range wals {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				segment, err := curWal.Decode()
+				results[i] <- decoded{segment: segment, err: err}
+			}()
+		}
+	}()
+
+	for i, curWal := range wals {
+		result := <-results[i]
+		if result.err != nil {
+			return fmt.Errorf("读取WAL文件 %d 失败: %v", curWal.FileId(), result.err)
+		}
+		if err := apply(i, result.segment); err != nil {
+			return err
+		}
+		<-window
+	}
 	return nil
 }
 
 func (bc *Bitcask) Close() error {
-	// 始终在关闭时生成 hint 文件，不再依赖 LoadHint 配置
-	// 这样可以确保下次启动时有最新的索引快照
-	if err := bc.Hint(); err != nil {
-		return err
+	// 先停止后台协程，避免访问已关闭的文件
+	bc.stopBackground()
+	bc.closeSubscribers()
+
+	// 索引自上次生成 hint 文件后有变化时才重新生成，只读的会话关闭时不会重写 hint 文件；
+	// 只读模式下从不写入 hint 文件
+	if !bc.conf.ReadOnly && bc.conf.HintOnClose && bc.dirty.Load() {
+		if err := bc.Hint(); err != nil {
+			return err
+		}
 	}
 
 	// 关闭活跃的 WAL 文件
@@ -378,6 +1021,9 @@ func (bc *Bitcask) Close() error {
 			return err
 		}
 	}
+	if err := bc.closeBlobs(); err != nil {
+		return err
+	}
 	if err := bc.flock.Unlock(); err != nil {
 		return err
 	}
@@ -385,49 +1031,91 @@ func (bc *Bitcask) Close() error {
 	return nil
 }
 func (bc *Bitcask) Hint() error {
+	if bc.conf.ReadOnly {
+		return ErrReadOnly
+	}
+	bc.mu.RLock()
+	nextFileId := bc.nextFileId
+	bc.mu.RUnlock()
+	// 先清除标记再遍历索引，遍历期间的写入会重新设置标记，不会被遗漏
+	bc.dirty.Store(false)
+	entries, err := writeHint(filepath.Join(bc.conf.DataDir, bc.conf.HintDir), bc.memTable, bc.txnId.Load(), nextFileId)
+	if err != nil {
+		bc.dirty.Store(true)
+		return err
+	}
+	bc.conf.Infof("成功生成hint文件，共%d个键值对", entries)
+	return nil
+}
+
+// hintSource 生成hint文件需要遍历的键和位置，可以是索引，也可以是 Merge 写入新文件的键
+type hintSource interface {
+	Foreach(fn func(key []byte, pos *record.Pos) error) error
+}
+
+// writeHint 将索引、事务ID和下一个文件ID写入 hintDir 下的hint文件，返回写入的键数量
+//
+// 先写入临时文件并同步，再重命名替换旧文件，写入中途崩溃时旧的hint文件仍然完整
+func writeHint(hintDir string, memTable hintSource, txnId, nextFileId uint32) (uint32, error) {
 	// 创建hint目录
-	hintDir := filepath.Join(bc.conf.DataDir, bc.conf.HintDir)
 	if err := os.MkdirAll(hintDir, 0755); err != nil {
-		return fmt.Errorf("创建hint目录失败: %v", err)
+		return 0, fmt.Errorf("创建hint目录失败: %v", err)
 	}
 
-	// 创建hint文件
+	// 创建临时hint文件
 	hintPath := filepath.Join(hintDir, "keys.hint")
-	hintFile, err := os.OpenFile(hintPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	tmpPath := hintPath + ".tmp"
+	hintFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
-		return fmt.Errorf("创建hint文件失败: %v", err)
+		return 0, fmt.Errorf("创建hint文件失败: %v", err)
 	}
 	defer hintFile.Close()
 
-	// 1.先写入txnId
-	if err := binary.Write(hintFile, binary.BigEndian, bc.txnId.Load()); err != nil {
-		return fmt.Errorf("写入事务ID失败: %v", err)
+	// 0.写入文件头：魔数 + 版本号
+	writer := bufio.NewWriter(hintFile)
+	if err := binary.Write(writer, binary.BigEndian, hintMagic); err != nil {
+		return 0, fmt.Errorf("写入hint魔数失败: %v", err)
+	}
+	if err := writer.WriteByte(hintVersion); err != nil {
+		return 0, fmt.Errorf("写入hint版本失败: %v", err)
+	}
+
+	// 文件体同时写入CRC计算器，最后追加校验和
+	hasher := crc32.NewIEEE()
+	body := io.MultiWriter(writer, hasher)
+
+	// 1.先写入txnId和下一个文件ID
+	if err := binary.Write(body, binary.BigEndian, txnId); err != nil {
+		return 0, fmt.Errorf("写入事务ID失败: %v", err)
+	}
+	if err := binary.Write(body, binary.BigEndian, nextFileId); err != nil {
+		return 0, fmt.Errorf("写入文件ID失败: %v", err)
 	}
 	// 2.遍历内存索引，将键和位置信息写入hint文件
 	var entries uint32 = 0
-	err = bc.memTable.Foreach(func(key []byte, pos *record.Pos) error {
+	err = memTable.Foreach(func(key []byte, pos *record.Pos) error {
 		// 写入键长度
-		if err := binary.Write(hintFile, binary.BigEndian, uint32(len(key))); err != nil {
+		if err := binary.Write(body, binary.BigEndian, uint32(len(key))); err != nil {
 			return fmt.Errorf("写入键长度失败: %v", err)
 		}
 
 		// 写入文件ID
-		if err := binary.Write(hintFile, binary.BigEndian, pos.FileId); err != nil {
+		if err := binary.Write(body, binary.BigEndian, pos.FileId); err != nil {
 			return fmt.Errorf("写入文件ID失败: %v", err)
 		}
 
 		// 写入偏移量
-		if err := binary.Write(hintFile, binary.BigEndian, pos.Offset); err != nil {
+		if err := binary.Write(body, binary.BigEndian, pos.Offset); err != nil {
 			return fmt.Errorf("写入偏移量失败: %v", err)
 		}
 
 		// 写入长度
-		if err := binary.Write(hintFile, binary.BigEndian, pos.Length); err != nil {
+		if err := binary.Write(body, binary.BigEndian, pos.Length); err != nil {
 			return fmt.Errorf("写入记录长度失败: %v", err)
 		}
 
 		// 写入键
-		if _, err := hintFile.Write(key); err != nil {
+		if _, err := body.Write(key); err != nil {
 			return fmt.Errorf("写入键失败: %v", err)
 		}
 
@@ -436,58 +1124,38 @@ func (bc *Bitcask) Hint() error {
 	})
 
 	if err != nil {
-		return fmt.Errorf("遍历内存索引失败: %v", err)
+		return 0, fmt.Errorf("遍历内存索引失败: %v", err)
+	}
+
+	// 3.追加文件体的CRC32
+	if err := binary.Write(writer, binary.BigEndian, hasher.Sum32()); err != nil {
+		return 0, fmt.Errorf("写入hint校验和失败: %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return 0, fmt.Errorf("刷新hint文件失败: %v", err)
 	}
 
 	// 同步文件确保持久化
 	if err := hintFile.Sync(); err != nil {
-		return fmt.Errorf("同步hint文件失败: %v", err)
+		return 0, fmt.Errorf("同步hint文件失败: %v", err)
 	}
-
-	fmt.Printf("成功生成hint文件，共%d个键值对\n", entries)
-	return nil
-}
-
-// Merge 合并WAL文件，删除冗余数据，提高效率
-func (bc *Bitcask) Merge() error {
-	oldFileIds := bc.fileIds
-	bc.mu.Lock()
-	bc.fileIds = make([]uint32, 0)
-	bc.mu.Unlock()
-	if err := bc.mustRotate(); err != nil {
-		return err
+	if err := hintFile.Close(); err != nil {
+		return 0, fmt.Errorf("关闭hint文件失败: %v", err)
 	}
-	if err := bc.memTable.ForeachUnSafe(func(key []byte, pos *record.Pos) error {
-		var targetWal *wal.Wal
-		if pos.FileId == bc.fileId {
-			targetWal = bc.activeWal
-		} else if w, ok := bc.oldWal[pos.FileId]; ok {
-			targetWal = w
-		} else {
-			return fmt.Errorf("file not found: fileId=%d", pos.FileId)
-		}
-		rec, err := targetWal.ReadPos(pos)
-		if err != nil {
-			return fmt.Errorf("读取WAL文件失败: %v", err)
-		}
-		if err := bc.Put(key, rec.Value); err != nil {
-			return fmt.Errorf("写入数据失败: %v", err)
-		}
-		return nil
-	}); err != nil {
-		return fmt.Errorf("合并WAL文件失败: %v", err)
+	if err := os.Rename(tmpPath, hintPath); err != nil {
+		return 0, fmt.Errorf("替换hint文件失败: %v", err)
 	}
-
-	for _, fileId := range oldFileIds {
-		if err := bc.oldWal[fileId].Delete(); err != nil {
-			return fmt.Errorf("删除WAL文件失败: %v", err)
-		}
-		delete(bc.oldWal, fileId)
+	if err := syncDir(hintDir); err != nil {
+		return 0, fmt.Errorf("同步hint目录失败: %v", err)
 	}
-	return nil
+
+	return entries, nil
 }
 
 // LoadHint 从hint文件加载索引
+// hint文件格式: [magic(4)][version(1)][txnId(4)][nextFileId(4)][entry...][crc32(4)]
+// 其中crc32覆盖txnId、nextFileId与全部entry，版本1没有nextFileId。任何格式错误或校验失败都返回 ErrCorruptHint，
+// 此时内存索引不会被修改，打开数据库时会忽略损坏的hint文件回退到WAL重放
 func (bc *Bitcask) LoadHint() error {
 	hintPath := filepath.Join(bc.conf.DataDir, bc.conf.HintDir, "keys.hint")
 
@@ -500,76 +1168,90 @@ func (bc *Bitcask) LoadHint() error {
 		return fmt.Errorf("检查hint文件状态失败: %v", err)
 	}
 
-	// 打开hint文件
-	hintFile, err := os.Open(hintPath)
+	// 读取整个hint文件，校验通过后再更新索引
+	data, err := os.ReadFile(hintPath)
 	if err != nil {
-		return fmt.Errorf("打开hint文件失败: %v", err)
+		return fmt.Errorf("读取hint文件失败: %v", err)
 	}
-	defer hintFile.Close()
-
-	// 读取事务ID
-	var txnId uint32
-	if err := binary.Read(hintFile, binary.BigEndian, &txnId); err != nil {
-		return fmt.Errorf("读取事务ID失败: %v", err)
+	if len(data) < hintHeaderSize+4+4 {
+		return fmt.Errorf("%w: 文件长度不足 %d 字节", ErrCorruptHint, len(data))
+	}
+	if magic := binary.BigEndian.Uint32(data[0:4]); magic != hintMagic {
+		return fmt.Errorf("%w: 魔数不匹配 %#x", ErrCorruptHint, magic)
+	}
+	version := data[4]
+	if version != hintVersion && version != hintVersionV1 {
+		return fmt.Errorf("%w: 不支持的版本 %d", ErrCorruptHint, version)
+	}
+	body := data[hintHeaderSize : len(data)-4]
+	storedCrc := binary.BigEndian.Uint32(data[len(data)-4:])
+	if computedCrc := crc32.ChecksumIEEE(body); storedCrc != computedCrc {
+		return fmt.Errorf("%w: CRC校验失败, 存储的: %d, 计算的: %d", ErrCorruptHint, storedCrc, computedCrc)
 	}
-	bc.txnId.Store(txnId)
-
-	var entries uint32 = 0
-	for {
-		// 读取键长度
-		var keyLength uint32
-		err = binary.Read(hintFile, binary.BigEndian, &keyLength)
-		if err == io.EOF {
-			break // 读取完毕
-		}
-		if err != nil {
-			return fmt.Errorf("读取键长度失败: %v", err)
-		}
 
-		// 读取文件ID
-		var fileId uint32
-		if err := binary.Read(hintFile, binary.BigEndian, &fileId); err != nil {
-			return fmt.Errorf("读取文件ID失败: %v", err)
+	// 读取事务ID，版本2之后是下一个文件ID
+	txnId := binary.BigEndian.Uint32(body[0:4])
+	offset := 4
+	var nextFileId uint32
+	if version == hintVersion {
+		if len(body) < 8 {
+			return fmt.Errorf("%w: 缺少文件ID", ErrCorruptHint)
 		}
+		nextFileId = binary.BigEndian.Uint32(body[4:8])
+		offset = 8
+	}
 
-		// 读取偏移量
-		var offset uint32
-		if err := binary.Read(hintFile, binary.BigEndian, &offset); err != nil {
-			return fmt.Errorf("读取偏移量失败: %v", err)
+	// 键引用同一个字符串中的子串，位置保存在同一个切片中，避免每个条目单独分配
+	keys := string(body)
+	var hintEntries []index.Data
+	summary := &hintSummary{txnId: txnId}
+	var maxFileId uint32
+	for offset < len(body) {
+		// 键长度、文件ID、偏移量、记录长度各4字节
+		if offset+16 > len(body) {
+			return fmt.Errorf("%w: 条目头部不完整 (offset=%d)", ErrCorruptHint, offset)
 		}
-
-		// 读取长度
-		var length uint32
-		if err := binary.Read(hintFile, binary.BigEndian, &length); err != nil {
-			return fmt.Errorf("读取记录长度失败: %v", err)
+		keyLength := binary.BigEndian.Uint32(body[offset : offset+4])
+		pos := record.Pos{
+			FileId: binary.BigEndian.Uint32(body[offset+4 : offset+8]),
+			Offset: binary.BigEndian.Uint32(body[offset+8 : offset+12]),
+			Length: binary.BigEndian.Uint32(body[offset+12 : offset+16]),
 		}
+		offset += 16
 
 		// 读取键
-		key := make([]byte, keyLength)
-		if _, err := io.ReadFull(hintFile, key); err != nil {
-			return fmt.Errorf("读取键失败: %v", err)
-		}
-
-		// 创建位置信息
-		pos := &record.Pos{
-			FileId: fileId,
-			Offset: offset,
-			Length: length,
+		if uint64(offset)+uint64(keyLength) > uint64(len(body)) {
+			return fmt.Errorf("%w: 键数据不完整 (offset=%d, keyLength=%d)", ErrCorruptHint, offset, keyLength)
 		}
-
-		// 更新内存索引
-		if err := bc.memTable.Put(key, pos); err != nil {
-			return fmt.Errorf("更新内存索引失败: %v", err)
+		summary.add(body[offset:offset+int(keyLength)], &pos)
+		hintEntries = append(hintEntries, index.Data{Key: keys[offset : offset+int(keyLength)], Pos: pos})
+		offset += int(keyLength)
+		if pos.FileId > maxFileId {
+			maxFileId = pos.FileId
 		}
+	}
 
-		// 更新fileId，确保新文件ID大于已有文件ID
-		if fileId >= bc.fileId {
-			bc.fileId = fileId + 1
+	// 校验全部通过，更新内存索引。BTree 索引生成的 hint 文件按索引顺序排列，
+	// 启动时的空索引可以一次性载入，其他情况逐个写入
+	bc.txnId.Store(txnId)
+	if nextFileId > bc.nextFileId {
+		bc.nextFileId = nextFileId
+	}
+	if bt, ok := bc.memTable.(*index.BTreeIndex); !ok || !bt.Load(hintEntries) {
+		for i := range hintEntries {
+			if err := bc.memTable.Put([]byte(hintEntries[i].Key), &hintEntries[i].Pos); err != nil {
+				return fmt.Errorf("更新内存索引失败: %v", err)
+			}
 		}
+	}
 
-		entries++
+	// 旧版本hint没有记录下一个文件ID，确保新文件ID大于hint引用的文件ID
+	if len(hintEntries) > 0 && maxFileId >= bc.nextFileId {
+		bc.nextFileId = maxFileId + 1
 	}
 
-	fmt.Printf("从hint文件加载了%d个键值对\n", entries)
+	summary.nextFileId = bc.nextFileId
+	bc.loadedHint = summary
+	bc.conf.Infof("从hint文件加载了%d个键值对", len(hintEntries))
 	return nil
 }
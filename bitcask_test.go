@@ -2,9 +2,13 @@ package bitcask
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -12,7 +16,9 @@ import (
 	"time"
 
 	"github.com/aixiasang/bitcask/config"
+	"github.com/aixiasang/bitcask/record"
 	"github.com/aixiasang/bitcask/utils"
+	"github.com/aixiasang/bitcask/wal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,6 +49,13 @@ func getTestConfig(dataDir string) *config.Config {
 	return conf
 }
 
+// simulateCrash 模拟进程崩溃：停止后台协程并释放文件锁（进程退出时由操作系统释放），
+// 不生成hint文件也不做最终同步，之后可以在同一个进程中重新打开数据目录
+func simulateCrash(db *Bitcask) {
+	db.stopBackground()
+	db.flock.Unlock()
+}
+
 // 原有的 Put 测试
 func TestBitcask_Put(t *testing.T) {
 	conf := config.NewConfig()
@@ -261,13 +274,13 @@ func TestBitcask_Delete_Case(t *testing.T) {
 	}
 
 	// 删除数据
-	if err := bc.Delete(key); err != nil {
+	if _, err := bc.Delete(key); err != nil {
 		t.Fatalf("删除数据失败: %v", err)
 	}
 
 	// 确认数据已删除
 	_, ok = bc.Get(key)
-	if !ok {
+	if ok {
 		t.Fatalf("期望删除后读取返回错误，但未返回错误")
 	}
 }
@@ -515,13 +528,13 @@ func TestBitcask_Delete(t *testing.T) {
 	}
 
 	// 删除数据
-	if err := bc.Delete(key); err != nil {
+	if _, err := bc.Delete(key); err != nil {
 		t.Fatalf("删除数据失败: %v", err)
 	}
 
 	// 确认数据已删除
 	_, ok = bc.Get(key)
-	if !ok {
+	if ok {
 		t.Fatalf("期望删除后读取返回错误，但未返回错误")
 	}
 }
@@ -790,6 +803,237 @@ func TestBitcask_Merge(t *testing.T) {
 	}
 }
 
+// 测试删除的键在合并、继续写入、崩溃重启后不会复活，包括hint文件早于合并生成的情况
+func TestBitcask_MergeKeepsDeletes(t *testing.T) {
+	for _, staleHint := range []bool{false, true} {
+		t.Run(fmt.Sprintf("staleHint=%v", staleHint), func(t *testing.T) {
+			testDir, cleanup := setupTestDir(t)
+			defer cleanup()
+			conf := getTestConfig(testDir)
+			conf.Debug = false
+			db, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("创建数据库失败: %v", err)
+			}
+			for i := 0; i < 100; i++ {
+				if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			// 合并前生成的hint文件仍包含即将删除的键
+			if err := db.Hint(); err != nil {
+				t.Fatalf("生成hint文件失败: %v", err)
+			}
+			hintPath := filepath.Join(testDir, conf.HintDir, "keys.hint")
+			oldHint, err := os.ReadFile(hintPath)
+			if err != nil {
+				t.Fatalf("读取hint文件失败: %v", err)
+			}
+
+			deleted := utils.GetKey(1)
+			if _, err := db.Delete(deleted); err != nil {
+				t.Fatalf("删除失败: %v", err)
+			}
+			if err := db.Merge(); err != nil {
+				t.Fatalf("合并失败: %v", err)
+			}
+			for i := 100; i < 200; i++ {
+				if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+
+			// 崩溃：不调用 Close，关闭时不会重新生成hint文件
+			simulateCrash(db)
+			if staleHint {
+				// 模拟旧版本合并后留下的hint文件
+				if err := os.WriteFile(hintPath, oldHint, 0644); err != nil {
+					t.Fatalf("恢复旧hint文件失败: %v", err)
+				}
+			}
+
+			reopened, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer reopened.Close()
+			if _, err := reopened.GetE(deleted); !errors.Is(err, ErrKeyNotFound) {
+				t.Fatalf("删除的键在合并后复活: %v", err)
+			}
+			count := 0
+			if err := reopened.Scan(func(_, _ []byte) error {
+				count++
+				return nil
+			}); err != nil {
+				t.Fatalf("重启后扫描失败: %v", err)
+			}
+			if count != 199 {
+				t.Fatalf("重启后键数量不正确: 期望 199, 实际 %d", count)
+			}
+			if _, err := reopened.Stats(); err != nil {
+				t.Fatalf("重启后获取统计失败: %v", err)
+			}
+		})
+	}
+}
+
+// 测试多次合并、重启和崩溃后文件ID始终严格递增，从不复用
+func TestBitcask_MonotonicFileIds(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.MaxFileSize = 1024
+
+	seen := make(map[uint32]bool)
+	var maxSeen uint32
+	// check 记录实例当前的所有文件ID，新出现的ID必须大于之前见过的所有ID
+	check := func(db *Bitcask, step string) {
+		t.Helper()
+		db.mu.RLock()
+		ids := []uint32{db.fileId}
+		for id := range db.oldWal {
+			ids = append(ids, id)
+		}
+		active, next := db.fileId, db.nextFileId
+		db.mu.RUnlock()
+		if next <= active {
+			t.Fatalf("%s: 下一个文件ID %d 不大于活跃文件ID %d", step, next, active)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			if len(seen) > 0 && id <= maxSeen {
+				t.Fatalf("%s: 新文件ID %d 不大于已使用过的最大ID %d", step, id, maxSeen)
+			}
+			seen[id] = true
+			maxSeen = id
+		}
+	}
+
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 100; i++ {
+			if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d-%d", round, i))); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			check(db, fmt.Sprintf("第%d轮写入", round))
+		}
+		if err := db.Merge(); err != nil {
+			t.Fatalf("合并失败: %v", err)
+		}
+		check(db, fmt.Sprintf("第%d轮合并", round))
+
+		switch round {
+		case 1:
+			// 正常关闭后重新打开
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+		case 3:
+			// 崩溃后重新打开
+			simulateCrash(db)
+		default:
+			continue
+		}
+		if db, err = NewBitcask(conf); err != nil {
+			t.Fatalf("重新打开失败: %v", err)
+		}
+		check(db, fmt.Sprintf("第%d轮重启", round))
+	}
+
+	// 删除所有键并合并后，hint中没有任何条目引用文件，下一个文件ID仍然被保留
+	for i := 0; i < 100; i++ {
+		if _, err := db.Delete(utils.GetKey(i)); err != nil {
+			t.Fatalf("删除失败: %v", err)
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	check(db, "删除全部键后合并")
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	walDir := filepath.Join(testDir, conf.WalDir)
+	if err := os.RemoveAll(walDir); err != nil {
+		t.Fatalf("清空WAL目录失败: %v", err)
+	}
+	if err := os.MkdirAll(walDir, 0755); err != nil {
+		t.Fatalf("创建WAL目录失败: %v", err)
+	}
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	check(db, "清空WAL目录后重启")
+}
+
+// 重新打开后连续合并：已删除的文件不能再次删除，合并前的活跃文件也要被回收
+func TestBitcask_MergeAfterReopen(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建Bitcask实例失败: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		if err := bc.Put(utils.GetKey(i), utils.GetValue(16)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatalf("关闭Bitcask失败: %v", err)
+	}
+
+	bc, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开Bitcask失败: %v", err)
+	}
+	for round := 0; round < 3; round++ {
+		if err := bc.Merge(); err != nil {
+			t.Fatalf("第%d次合并失败: %v", round+1, err)
+		}
+		stats, err := bc.Stats()
+		if err != nil {
+			t.Fatalf("获取统计失败: %v", err)
+		}
+		if stats.Keys != 200 || stats.ReclaimableBytes != 0 {
+			t.Fatalf("第%d次合并后仍有可回收数据: %+v", round+1, stats)
+		}
+		walFiles, err := os.ReadDir(filepath.Join(testDir, conf.WalDir))
+		if err != nil {
+			t.Fatalf("读取WAL目录失败: %v", err)
+		}
+		if len(walFiles) != stats.DataFiles {
+			t.Fatalf("第%d次合并后WAL文件数量不一致: 目录中%d个, 统计%d个", round+1, len(walFiles), stats.DataFiles)
+		}
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatalf("关闭Bitcask失败: %v", err)
+	}
+
+	bc, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开Bitcask失败: %v", err)
+	}
+	defer bc.Close()
+	for i := 0; i < 200; i++ {
+		if _, ok := bc.Get(utils.GetKey(i)); !ok {
+			t.Fatalf("合并后重新打开读取键 %d 失败", i)
+		}
+	}
+}
+
 func TestWalFileGeneration(t *testing.T) {
 	// 创建临时目录
 	tmpDir, err := os.MkdirTemp("", "bitcask-wal-test-*")
@@ -863,3 +1107,2169 @@ func TestWalFileGeneration(t *testing.T) {
 		assert.Equal(t, values[i], string(value))
 	}
 }
+
+// 测试hint文件损坏时忽略它并从WAL完整恢复，关闭时重新生成完整的hint文件
+func TestBitcask_CorruptHint(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建Bitcask失败: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("写入数据失败: %v", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	hintPath := filepath.Join(testDir, conf.HintDir, "keys.hint")
+	original, err := os.ReadFile(hintPath)
+	if err != nil {
+		t.Fatalf("读取hint文件失败: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		corrupt func([]byte) []byte
+	}{
+		{"翻转文件体字节", func(b []byte) []byte { b[len(b)/2] ^= 0xff; return b }},
+		{"翻转校验和字节", func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b }},
+		{"错误的魔数", func(b []byte) []byte { b[0] ^= 0xff; return b }},
+		{"错误的版本", func(b []byte) []byte { b[4] = 0xff; return b }},
+		{"文件被截断", func(b []byte) []byte { return b[:len(b)-7] }},
+		{"文件过短", func(b []byte) []byte { return b[:3] }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := make([]byte, len(original))
+			copy(data, original)
+			if err := os.WriteFile(hintPath, tc.corrupt(data), 0644); err != nil {
+				t.Fatalf("写入损坏的hint文件失败: %v", err)
+			}
+
+			db, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("回退到WAL重放失败: %v", err)
+			}
+			for i := 0; i < 20; i++ {
+				value, ok := db.Get(utils.GetKey(i))
+				if !ok || string(value) != fmt.Sprintf("value-%d", i) {
+					t.Fatalf("WAL重放后数据不匹配: key=%s, value=%s", utils.GetKey(i), value)
+				}
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭数据库失败: %v", err)
+			}
+
+			// 关闭时替换了损坏的hint文件，没有留下临时文件
+			db, err = NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("重新打开数据库失败: %v", err)
+			}
+			loaded := db.loadedHint != nil
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭数据库失败: %v", err)
+			}
+			if !loaded {
+				t.Fatal("重新生成的hint文件应该可以加载")
+			}
+			if _, err := os.Stat(hintPath + ".tmp"); !os.IsNotExist(err) {
+				t.Fatalf("不应留下临时hint文件: %v", err)
+			}
+		})
+	}
+}
+
+// 测试仍然可以读取不包含下一个文件ID的版本1 hint文件
+func TestBitcask_LoadHintV1(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("写入数据失败: %v", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	// 去掉事务ID之后的下一个文件ID，改写为版本1并重新计算校验和
+	hintPath := filepath.Join(testDir, conf.HintDir, "keys.hint")
+	data, err := os.ReadFile(hintPath)
+	if err != nil {
+		t.Fatalf("读取hint文件失败: %v", err)
+	}
+	body := append(append([]byte{}, data[hintHeaderSize:hintHeaderSize+4]...), data[hintHeaderSize+8:len(data)-4]...)
+	v1 := append([]byte{}, data[:hintHeaderSize]...)
+	v1[4] = hintVersionV1
+	v1 = append(v1, body...)
+	v1 = binary.BigEndian.AppendUint32(v1, crc32.ChecksumIEEE(body))
+	if err := os.WriteFile(hintPath, v1, 0644); err != nil {
+		t.Fatalf("写入版本1 hint文件失败: %v", err)
+	}
+
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("加载版本1 hint文件失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 20; i++ {
+		value, ok := db.Get(utils.GetKey(i))
+		if !ok || string(value) != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("数据不匹配: key=%s, value=%s", utils.GetKey(i), value)
+		}
+	}
+	if db.nextFileId <= db.fileId {
+		t.Fatalf("下一个文件ID %d 应大于活跃文件ID %d", db.nextFileId, db.fileId)
+	}
+}
+
+func TestBitcask_HashMapIndex(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.IndexType = config.IndexTypeHashMap
+
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建Bitcask失败: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("写入数据失败: %v", err)
+		}
+	}
+	if _, err := db.Delete(utils.GetKey(50)); err != nil {
+		t.Fatalf("删除数据失败: %v", err)
+	}
+
+	// 范围查询在无序索引上也必须返回完整且有序的结果
+	results, err := db.ScanRange(utils.GetKey(10), utils.GetKey(60))
+	if err != nil {
+		t.Fatalf("范围查询失败: %v", err)
+	}
+	if len(results) != 50 {
+		t.Fatalf("范围查询结果数量不正确: 期望 50, 实际 %d", len(results))
+	}
+	for i := 1; i < len(results); i++ {
+		if string(results[i-1].Key) >= string(results[i].Key) {
+			t.Fatalf("范围查询结果无序: %s >= %s", results[i-1].Key, results[i].Key)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	// 重新打开后数据一致
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开Bitcask失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		value, ok := db.Get(utils.GetKey(i))
+		if i == 50 {
+			if ok {
+				t.Fatalf("已删除的键仍然可以读取: %s", utils.GetKey(i))
+			}
+			continue
+		}
+		if !ok || string(value) != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("重新打开后数据不匹配: key=%s, value=%s", utils.GetKey(i), value)
+		}
+	}
+}
+
+func TestBitcask_GetE(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建 Bitcask 实例失败: %v", err)
+	}
+
+	liveKey := []byte("live-key")
+	deletedKey := []byte("deleted-key")
+	missingKey := []byte("missing-key")
+	if err := bc.Put(liveKey, []byte("value")); err != nil {
+		t.Fatalf("写入数据失败: %v", err)
+	}
+	if err := bc.Put(deletedKey, []byte("value")); err != nil {
+		t.Fatalf("写入数据失败: %v", err)
+	}
+	if _, err := bc.Delete(deletedKey); err != nil {
+		t.Fatalf("删除数据失败: %v", err)
+	}
+
+	check := func(stage string) {
+		if value, err := bc.GetE(liveKey); err != nil || string(value) != "value" {
+			t.Fatalf("%s: 读取存在的键失败: value=%s, err=%v", stage, value, err)
+		}
+		if _, err := bc.GetE(deletedKey); !errors.Is(err, ErrKeyHasDeleted) {
+			t.Fatalf("%s: 期望 ErrKeyHasDeleted, 实际: %v", stage, err)
+		}
+		if _, err := bc.GetE(missingKey); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("%s: 期望 ErrKeyNotFound, 实际: %v", stage, err)
+		}
+		// 布尔版本的 Get 对两种情况都返回 false
+		if _, ok := bc.Get(deletedKey); ok {
+			t.Fatalf("%s: 已删除的键仍然可以读取", stage)
+		}
+		// Scan 跳过删除标记
+		if err := bc.Scan(func(key []byte, value []byte) error {
+			if bytes.Equal(key, deletedKey) {
+				return fmt.Errorf("扫描到已删除的键")
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("%s: %v", stage, err)
+		}
+	}
+	check("写入后")
+
+	// 重启后（hint + WAL重放）删除标记仍然保留
+	if err := bc.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	bc, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开 Bitcask 失败: %v", err)
+	}
+	defer bc.Close()
+	check("重启后")
+
+	// Merge 之后删除标记被清理，已删除的键变为不存在
+	if err := bc.Merge(); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	if _, err := bc.GetE(deletedKey); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("合并后期望 ErrKeyNotFound, 实际: %v", err)
+	}
+	if value, err := bc.GetE(liveKey); err != nil || string(value) != "value" {
+		t.Fatalf("合并后读取存在的键失败: value=%s, err=%v", value, err)
+	}
+}
+
+func TestBitcask_DeleteReportsExistence(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建 Bitcask 实例失败: %v", err)
+	}
+	defer bc.Close()
+
+	key := []byte("present-key")
+	if err := bc.Put(key, []byte("value")); err != nil {
+		t.Fatalf("写入数据失败: %v", err)
+	}
+
+	// 存在的键
+	existed, err := bc.Delete(key)
+	if err != nil || !existed {
+		t.Fatalf("删除存在的键: 期望 existed=true, 实际 existed=%v, err=%v", existed, err)
+	}
+
+	// 重复删除不再写入删除标记
+	sizeBefore := bc.activeWal.Size()
+	existed, err = bc.Delete(key)
+	if err != nil || existed {
+		t.Fatalf("重复删除: 期望 existed=false, 实际 existed=%v, err=%v", existed, err)
+	}
+	if bc.activeWal.Size() != sizeBefore {
+		t.Fatalf("重复删除不应写入新的记录")
+	}
+
+	// 从未写入的键
+	existed, err = bc.Delete([]byte("absent-key"))
+	if err != nil || existed {
+		t.Fatalf("删除不存在的键: 期望 existed=false, 实际 existed=%v, err=%v", existed, err)
+	}
+}
+
+// 测试字符串形式的接口与字节切片接口读写的是同一份数据，空字符串的值不等同于删除
+func TestBitcask_StringOps(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建 Bitcask 实例失败: %v", err)
+	}
+	defer bc.Close()
+
+	if err := bc.PutString("name", "bitcask"); err != nil {
+		t.Fatalf("写入数据失败: %v", err)
+	}
+	if value, ok := bc.Get([]byte("name")); !ok || string(value) != "bitcask" {
+		t.Fatalf("Get 读取 PutString 写入的值: value=%q, ok=%v", value, ok)
+	}
+	if err := bc.Put([]byte("bytes"), []byte("value")); err != nil {
+		t.Fatalf("写入数据失败: %v", err)
+	}
+	if value, ok := bc.GetString("bytes"); !ok || value != "value" {
+		t.Fatalf("GetString 读取 Put 写入的值: value=%q, ok=%v", value, ok)
+	}
+
+	// 空字符串的值和空字符串的键都是普通的键值
+	if err := bc.PutString("empty", ""); err != nil {
+		t.Fatalf("写入空值失败: %v", err)
+	}
+	if value, ok := bc.GetString("empty"); !ok || value != "" {
+		t.Fatalf("读取空值: value=%q, ok=%v", value, ok)
+	}
+	if err := bc.PutString("", "empty-key"); err != nil {
+		t.Fatalf("写入空键失败: %v", err)
+	}
+	if value, ok := bc.GetString(""); !ok || value != "empty-key" {
+		t.Fatalf("读取空键: value=%q, ok=%v", value, ok)
+	}
+
+	// 不存在的键返回空字符串和 false
+	if value, ok := bc.GetString("absent"); ok || value != "" {
+		t.Fatalf("读取不存在的键: value=%q, ok=%v", value, ok)
+	}
+
+	existed, err := bc.DeleteString("name")
+	if err != nil || !existed {
+		t.Fatalf("删除存在的键: existed=%v, err=%v", existed, err)
+	}
+	if _, err := bc.GetE([]byte("name")); !errors.Is(err, ErrKeyHasDeleted) {
+		t.Fatalf("删除后读取: 期望 ErrKeyHasDeleted, 实际 %v", err)
+	}
+	existed, err = bc.DeleteString("absent")
+	if err != nil || existed {
+		t.Fatalf("删除不存在的键: existed=%v, err=%v", existed, err)
+	}
+	if existed, err := bc.DeleteString("empty"); err != nil || !existed {
+		t.Fatalf("删除空值的键: existed=%v, err=%v", existed, err)
+	}
+}
+
+func TestBitcask_MultiOps(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建 Bitcask 实例失败: %v", err)
+	}
+
+	// 写入足够多的数据以触发文件轮转
+	pairs := make(map[string][]byte)
+	for i := 0; i < 200; i++ {
+		pairs[string(utils.GetKey(i))] = []byte(fmt.Sprintf("value-%d", i))
+	}
+	if err := bc.PutMulti(pairs); err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+	if _, err := bc.Delete(utils.GetKey(5)); err != nil {
+		t.Fatalf("删除数据失败: %v", err)
+	}
+
+	keys := [][]byte{utils.GetKey(0), utils.GetKey(5), []byte("missing"), utils.GetKey(199), nil}
+	check := func(stage string) {
+		values, found := bc.GetMulti(keys)
+		if len(values) != len(keys) || len(found) != len(keys) {
+			t.Fatalf("%s: 结果长度不正确", stage)
+		}
+		expected := []bool{true, false, false, true, false}
+		for i := range keys {
+			if found[i] != expected[i] {
+				t.Fatalf("%s: key=%s 期望 found=%v, 实际 %v", stage, keys[i], expected[i], found[i])
+			}
+		}
+		if string(values[0]) != "value-0" || string(values[3]) != "value-199" {
+			t.Fatalf("%s: 批量读取的值不匹配: %s, %s", stage, values[0], values[3])
+		}
+	}
+	check("写入后")
+
+	// 重启后批量写入的数据仍然可读
+	if err := bc.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	bc, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开 Bitcask 失败: %v", err)
+	}
+	defer bc.Close()
+	check("重启后")
+}
+
+func benchmarkBitcask(b *testing.B) *Bitcask {
+	dir, err := os.MkdirTemp("", "bitcask-bench-*")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+	conf := config.NewConfig()
+	conf.DataDir = dir
+	conf.Debug = false
+	conf.MaxFileSize = 64 * 1024 * 1024
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { bc.Close() })
+	return bc
+}
+
+// 对比逐条 Put 与 PutMulti（AutoSync 开启时每条 Put 都会同步）
+func BenchmarkBitcask_PutLoop(b *testing.B) {
+	bc := benchmarkBitcask(b)
+	value := []byte("benchmark-value")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 100; j++ {
+			if err := bc.Put(utils.GetKey(j), value); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkBitcask_PutMulti(b *testing.B) {
+	bc := benchmarkBitcask(b)
+	value := []byte("benchmark-value")
+	pairs := make(map[string][]byte, 100)
+	for j := 0; j < 100; j++ {
+		pairs[string(utils.GetKey(j))] = value
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := bc.PutMulti(pairs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBitcask_GetLoop(b *testing.B) {
+	bc := benchmarkBitcask(b)
+	keys := make([][]byte, 100)
+	for j := range keys {
+		keys[j] = utils.GetKey(j)
+		if err := bc.Put(keys[j], []byte("benchmark-value")); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			bc.Get(key)
+		}
+	}
+}
+
+func BenchmarkBitcask_GetMulti(b *testing.B) {
+	bc := benchmarkBitcask(b)
+	keys := make([][]byte, 100)
+	for j := range keys {
+		keys[j] = utils.GetKey(j)
+		if err := bc.Put(keys[j], []byte("benchmark-value")); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bc.GetMulti(keys)
+	}
+}
+
+// 模拟进程崩溃：不调用 Close（不生成hint、不做最终同步），直接重新打开
+// 注意：进程崩溃时已写入操作系统缓存的数据不会丢失，只有掉电才会丢失未同步的数据，
+// 因此这里验证的是各模式下重放路径的正确性以及后台同步协程的生命周期
+func TestBitcask_SyncModes(t *testing.T) {
+	testCases := []struct {
+		name         string
+		autoSync     bool
+		syncInterval time.Duration
+		manualSync   bool
+	}{
+		{"每次写入同步", true, 0, false},
+		{"后台定时同步", false, 10 * time.Millisecond, false},
+		{"手动同步", false, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testDir, cleanup := setupTestDir(t)
+			defer cleanup()
+
+			conf := getTestConfig(testDir)
+			conf.Debug = false
+			conf.AutoSync = tc.autoSync
+			conf.SyncInterval = tc.syncInterval
+
+			bc, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("创建 Bitcask 实例失败: %v", err)
+			}
+			if (bc.bgStop != nil) != (tc.syncInterval > 0) {
+				t.Fatalf("后台同步协程状态不符合配置")
+			}
+			for i := 0; i < 50; i++ {
+				if err := bc.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+					t.Fatalf("写入数据失败: %v", err)
+				}
+			}
+			if tc.manualSync {
+				if err := bc.Sync(); err != nil {
+					t.Fatalf("手动同步失败: %v", err)
+				}
+			}
+			if tc.syncInterval > 0 {
+				time.Sleep(5 * tc.syncInterval)
+			}
+
+			// 崩溃：停止后台协程后直接丢弃实例
+			simulateCrash(bc)
+
+			recovered, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("崩溃后重新打开失败: %v", err)
+			}
+			for i := 0; i < 50; i++ {
+				value, ok := recovered.Get(utils.GetKey(i))
+				if !ok || string(value) != fmt.Sprintf("value-%d", i) {
+					t.Fatalf("崩溃后数据丢失: key=%s, value=%s", utils.GetKey(i), value)
+				}
+			}
+
+			if err := recovered.Close(); err != nil {
+				t.Fatalf("关闭数据库失败: %v", err)
+			}
+			if recovered.bgStop != nil {
+				t.Fatalf("关闭后后台同步协程未退出")
+			}
+		})
+	}
+}
+
+func TestBitcask_PutWithTTL(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建 Bitcask 实例失败: %v", err)
+	}
+
+	if err := bc.PutWithTTL([]byte("bad"), []byte("v"), 0); err == nil {
+		t.Fatalf("期望非正数TTL返回错误")
+	}
+	if err := bc.PutWithTTL([]byte("short"), []byte("short-value"), 50*time.Millisecond); err != nil {
+		t.Fatalf("写入TTL数据失败: %v", err)
+	}
+	if err := bc.PutWithTTL([]byte("long"), []byte("long-value"), time.Hour); err != nil {
+		t.Fatalf("写入TTL数据失败: %v", err)
+	}
+	if err := bc.Put([]byte("forever"), []byte("forever-value")); err != nil {
+		t.Fatalf("写入数据失败: %v", err)
+	}
+
+	// 过期前可读
+	if value, ok := bc.Get([]byte("short")); !ok || string(value) != "short-value" {
+		t.Fatalf("过期前读取失败: value=%s", value)
+	}
+
+	// 过期后读取视为不存在
+	time.Sleep(80 * time.Millisecond)
+	if _, err := bc.GetE([]byte("short")); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("过期后期望 ErrKeyNotFound, 实际: %v", err)
+	}
+	count := 0
+	if err := bc.Scan(func(key []byte, value []byte) error {
+		if string(key) == "short" {
+			t.Fatalf("扫描到已过期的键")
+		}
+		count++
+		return nil
+	}); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("扫描结果数量不正确: 期望 2, 实际 %d", count)
+	}
+
+	// 重启后过期时间仍然有效
+	if err := bc.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	bc, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开 Bitcask 失败: %v", err)
+	}
+	defer bc.Close()
+	if _, ok := bc.Get([]byte("short")); ok {
+		t.Fatalf("重启后已过期的键仍然可读")
+	}
+	if value, ok := bc.Get([]byte("long")); !ok || string(value) != "long-value" {
+		t.Fatalf("重启后未过期的键读取失败: value=%s", value)
+	}
+
+	// Merge 后保留未过期键的TTL，并清理已过期的键
+	if err := bc.Merge(); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	if pos, _ := bc.memTable.Get([]byte("short")); pos != nil {
+		t.Fatalf("合并后过期键仍在索引中")
+	}
+	pos, _ := bc.memTable.Get([]byte("long"))
+	rec, err := bc.readRecord(pos)
+	if err != nil || rec.ExpireAt == 0 {
+		t.Fatalf("合并后丢失了过期时间: rec=%+v, err=%v", rec, err)
+	}
+}
+
+func TestBitcask_TTL(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建 Bitcask 实例失败: %v", err)
+	}
+	defer bc.Close()
+
+	if err := bc.PutWithTTL([]byte("ttl"), []byte("v"), time.Hour); err != nil {
+		t.Fatalf("写入TTL数据失败: %v", err)
+	}
+	if err := bc.Put([]byte("forever"), []byte("v")); err != nil {
+		t.Fatalf("写入数据失败: %v", err)
+	}
+
+	ttl, hasTTL, err := bc.TTL([]byte("ttl"))
+	if err != nil || !hasTTL || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Fatalf("剩余过期时间不正确: ttl=%v, hasTTL=%v, err=%v", ttl, hasTTL, err)
+	}
+	if _, hasTTL, err := bc.TTL([]byte("forever")); err != nil || hasTTL {
+		t.Fatalf("永不过期的键不应有TTL: hasTTL=%v, err=%v", hasTTL, err)
+	}
+	if _, _, err := bc.TTL([]byte("missing")); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("不存在的键期望 ErrKeyNotFound, 实际: %v", err)
+	}
+
+	// 已过期和已删除的键返回对应的错误
+	if err := bc.PutWithTTL([]byte("short"), []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatalf("写入TTL数据失败: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, _, err := bc.TTL([]byte("short")); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("过期的键期望 ErrKeyNotFound, 实际: %v", err)
+	}
+	if _, err := bc.Delete([]byte("forever")); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if _, _, err := bc.TTL([]byte("forever")); !errors.Is(err, ErrKeyHasDeleted) {
+		t.Fatalf("删除的键期望 ErrKeyHasDeleted, 实际: %v", err)
+	}
+}
+
+func TestBitcask_ExpireSweeper(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.ExpireSweepInterval = 10 * time.Millisecond
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建 Bitcask 实例失败: %v", err)
+	}
+	defer bc.Close()
+
+	if err := bc.PutWithTTL([]byte("ttl-key"), []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatalf("写入TTL数据失败: %v", err)
+	}
+	if err := bc.Put([]byte("plain-key"), []byte("v")); err != nil {
+		t.Fatalf("写入数据失败: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		pos, _ := bc.memTable.Get([]byte("ttl-key"))
+		if pos == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("后台清理未移除过期键")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := bc.Get([]byte("plain-key")); !ok {
+		t.Fatalf("后台清理误删了未设置TTL的键")
+	}
+}
+
+// 统计WAL目录的总大小
+func walDirSize(t *testing.T, conf *config.Config) int64 {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(conf.DataDir, conf.WalDir))
+	if err != nil {
+		t.Fatalf("读取WAL目录失败: %v", err)
+	}
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatalf("获取文件信息失败: %v", err)
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+func TestBitcask_Compression(t *testing.T) {
+	row := func(i int) []byte {
+		return []byte(fmt.Sprintf(`{"id":%d,"name":"user-%d","email":"user-%d@example.com","bio":"%s"}`,
+			i, i, i, strings.Repeat("lorem ipsum dolor sit amet ", 10)))
+	}
+	writeRows := func(t *testing.T, conf *config.Config, from, to int) {
+		bc, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("创建 Bitcask 实例失败: %v", err)
+		}
+		for i := from; i < to; i++ {
+			if err := bc.Put(utils.GetKey(i), row(i)); err != nil {
+				t.Fatalf("写入数据失败: %v", err)
+			}
+		}
+		if err := bc.Close(); err != nil {
+			t.Fatalf("关闭数据库失败: %v", err)
+		}
+	}
+	verifyRows := func(t *testing.T, conf *config.Config, n int) {
+		bc, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("重新打开 Bitcask 失败: %v", err)
+		}
+		defer bc.Close()
+		for i := 0; i < n; i++ {
+			value, ok := bc.Get(utils.GetKey(i))
+			if !ok || !bytes.Equal(value, row(i)) {
+				t.Fatalf("数据不匹配: key=%s", utils.GetKey(i))
+			}
+		}
+	}
+
+	plainDir, cleanupPlain := setupTestDir(t)
+	defer cleanupPlain()
+	plainConf := getTestConfig(plainDir)
+	plainConf.Debug = false
+	writeRows(t, plainConf, 0, 100)
+
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.Compression = config.CompressionSnappy
+	writeRows(t, conf, 0, 100)
+
+	// 压缩后磁盘占用明显变小
+	plainSize, compressedSize := walDirSize(t, plainConf), walDirSize(t, conf)
+	if compressedSize >= plainSize/2 {
+		t.Fatalf("压缩效果不明显: 未压缩 %d 字节, 压缩后 %d 字节", plainSize, compressedSize)
+	}
+	verifyRows(t, conf, 100)
+
+	// 关闭压缩后重启：旧的压缩记录仍可读取，新记录不压缩
+	conf.Compression = config.CompressionNone
+	verifyRows(t, conf, 100)
+	writeRows(t, conf, 100, 150)
+
+	// 再次开启压缩：混合格式的文件都能正确读取
+	conf.Compression = config.CompressionSnappy
+	verifyRows(t, conf, 150)
+}
+
+func TestBitcask_Encryption(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.EncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+	secret := []byte("top-secret-value")
+
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建 Bitcask 实例失败: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := bc.Put(utils.GetKey(i), secret); err != nil {
+			t.Fatalf("写入数据失败: %v", err)
+		}
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	// 磁盘上不应出现明文 value
+	walDir := filepath.Join(testDir, conf.WalDir)
+	entries, err := os.ReadDir(walDir)
+	if err != nil {
+		t.Fatalf("读取WAL目录失败: %v", err)
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(walDir, entry.Name()))
+		if err != nil {
+			t.Fatalf("读取WAL文件失败: %v", err)
+		}
+		if bytes.Contains(data, secret) {
+			t.Fatalf("WAL文件 %s 中包含明文 value", entry.Name())
+		}
+	}
+
+	// 正确的密钥
+	bc, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("使用正确密钥打开失败: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		value, err := bc.GetE(utils.GetKey(i))
+		if err != nil || !bytes.Equal(value, secret) {
+			t.Fatalf("使用正确密钥读取失败: value=%s, err=%v", value, err)
+		}
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	// 错误的密钥和未配置密钥都返回解密错误
+	for name, key := range map[string][]byte{
+		"错误的密钥": []byte("fedcba9876543210fedcba9876543210"),
+		"未配置密钥": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			wrongConf := getTestConfig(testDir)
+			wrongConf.Debug = false
+			wrongConf.EncryptionKey = key
+			bc, err := NewBitcask(wrongConf)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			defer bc.Close()
+			if _, err := bc.GetE(utils.GetKey(0)); !errors.Is(err, record.ErrDecrypt) {
+				t.Fatalf("期望 record.ErrDecrypt, 实际: %v", err)
+			}
+		})
+	}
+
+	// 非法长度的密钥在打开时报错
+	badConf := getTestConfig(testDir)
+	badConf.EncryptionKey = []byte("short")
+	if _, err := NewBitcask(badConf); err == nil {
+		t.Fatalf("期望非法密钥长度返回错误")
+	}
+}
+
+// 测试 Scan 与并发写入、文件轮转和合并同时进行时不会出错
+func TestBitcask_ScanConcurrentWrites(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.AutoSync = false
+	conf.MaxFileSize = 512 // 频繁轮转
+	bc, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer bc.Close()
+
+	const keys = 200
+	for i := 0; i < keys; i++ {
+		if err := bc.Put(utils.GetKey(i), utils.GetValue(16)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	// 写入协程交替执行写入、删除和合并，期间不断触发文件轮转
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			key := utils.GetKey(i % keys)
+			switch {
+			case i%500 == 499:
+				err = bc.Merge()
+			case i%5 == 0:
+				_, err = bc.Delete(key)
+			default:
+				err = bc.Put(key, utils.GetValue(16))
+			}
+			if err != nil {
+				t.Errorf("并发写入失败: %v", err)
+				return
+			}
+		}
+	}()
+
+	for round := 0; round < 50; round++ {
+		if err := bc.Scan(func(key []byte, value []byte) error {
+			if len(value) != 16 {
+				return fmt.Errorf("值长度不正确: key=%s, len=%d", key, len(value))
+			}
+			return nil
+		}); err != nil {
+			close(stop)
+			wg.Wait()
+			t.Fatalf("并发扫描第 %d 轮失败: %v", round, err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	// 回调中删除键不会死锁，也不会破坏遍历
+	deleted := 0
+	if err := bc.Scan(func(key []byte, _ []byte) error {
+		deleted++
+		_, err := bc.Delete(key)
+		return err
+	}); err != nil {
+		t.Fatalf("回调中删除失败: %v", err)
+	}
+	count := 0
+	bc.Scan(func(_, _ []byte) error {
+		count++
+		return nil
+	})
+	if count != 0 || deleted == 0 {
+		t.Fatalf("回调中删除后应没有剩余键: 删除 %d, 剩余 %d", deleted, count)
+	}
+}
+
+// 测试范围扫描在不同长度的键跨越边界时结果完整且有序
+func TestBitcask_ScanRangeMixedLengths(t *testing.T) {
+	for name, indexType := range map[string]config.IndexType{
+		"btree":   config.IndexTypeBTree,
+		"hashmap": config.IndexTypeHashMap,
+	} {
+		t.Run(name, func(t *testing.T) {
+			testDir, cleanup := setupTestDir(t)
+			defer cleanup()
+			conf := getTestConfig(testDir)
+			conf.Debug = false
+			conf.IndexType = indexType
+			bc, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("创建数据库失败: %v", err)
+			}
+			defer bc.Close()
+
+			// 索引顺序为 a < b < c < d < aa < ab < ba < aaa，范围 [b, ab] 跨越长度1和长度2
+			for _, k := range []string{"ba", "aaa", "c", "a", "ab", "d", "aa", "b"} {
+				if err := bc.Put([]byte(k), []byte("v-"+k)); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			if _, err := bc.Delete([]byte("c")); err != nil {
+				t.Fatalf("删除失败: %v", err)
+			}
+
+			keysOf := func(results []*ScanRangeResult) string {
+				var keys []string
+				for _, r := range results {
+					if string(r.Value) != "v-"+string(r.Key) {
+						t.Fatalf("值不匹配: key=%s, value=%s", r.Key, r.Value)
+					}
+					keys = append(keys, string(r.Key))
+				}
+				return strings.Join(keys, ",")
+			}
+
+			results, err := bc.ScanRange([]byte("b"), []byte("ab"))
+			if err != nil {
+				t.Fatalf("范围扫描失败: %v", err)
+			}
+			if got := keysOf(results); got != "b,d,aa,ab" {
+				t.Fatalf("范围扫描结果不正确: 期望 b,d,aa,ab, 实际 %s", got)
+			}
+
+			// limit 按顺序截断，跳过的删除标记不占用名额
+			results, err = bc.ScanRangeLimit([]byte("b"), []byte("ab"), 2)
+			if err != nil {
+				t.Fatalf("范围扫描失败: %v", err)
+			}
+			if got := keysOf(results); got != "b,d" {
+				t.Fatalf("限制数量的范围扫描结果不正确: 期望 b,d, 实际 %s", got)
+			}
+
+			// 起始键大于结束键时结果为空
+			results, err = bc.ScanRange([]byte("aa"), []byte("d"))
+			if err != nil || len(results) != 0 {
+				t.Fatalf("起始键大于结束键时应返回空结果: %v, %v", keysOf(results), err)
+			}
+		})
+	}
+}
+
+func TestBitcask_ScanPrefix(t *testing.T) {
+	for name, indexType := range map[string]config.IndexType{
+		"btree":   config.IndexTypeBTree,
+		"hashmap": config.IndexTypeHashMap,
+	} {
+		t.Run(name, func(t *testing.T) {
+			testDir, cleanup := setupTestDir(t)
+			defer cleanup()
+			conf := getTestConfig(testDir)
+			conf.Debug = false
+			conf.IndexType = indexType
+			bc, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("创建数据库失败: %v", err)
+			}
+			defer bc.Close()
+
+			// 不同长度的前缀键与无关键交错分布在索引中
+			keys := []string{
+				"h:a:1", "h:a:22", "h:a:333", "h:ab:1", "h:b:1", "h:a", "g:a:1",
+				"h:a:4444", "z", "i:a:55555", "h:a:",
+			}
+			for _, k := range keys {
+				if err := bc.Put([]byte(k), []byte("v-"+k)); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			if _, err := bc.Delete([]byte("h:a:333")); err != nil {
+				t.Fatalf("删除失败: %v", err)
+			}
+
+			var got []string
+			err = bc.ScanPrefix([]byte("h:a:"), func(key, value []byte) error {
+				if string(value) != "v-"+string(key) {
+					t.Fatalf("值不匹配: key=%s, value=%s", key, value)
+				}
+				got = append(got, string(key))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("前缀扫描失败: %v", err)
+			}
+			expected := []string{"h:a:", "h:a:1", "h:a:22", "h:a:4444"}
+			if strings.Join(got, ",") != strings.Join(expected, ",") {
+				t.Fatalf("前缀扫描结果不正确: 期望 %v, 实际 %v", expected, got)
+			}
+
+			// 空前缀遍历全部有效键
+			count := 0
+			bc.ScanPrefix(nil, func(_, _ []byte) error {
+				count++
+				return nil
+			})
+			if count != len(keys)-1 {
+				t.Fatalf("空前缀扫描数量不正确: 期望 %d, 实际 %d", len(keys)-1, count)
+			}
+
+			// 回调返回错误时停止
+			stop := errors.New("stop")
+			if err := bc.ScanPrefix([]byte("h:"), func(_, _ []byte) error { return stop }); err != stop {
+				t.Fatalf("期望返回回调错误, 实际: %v", err)
+			}
+		})
+	}
+}
+
+// 对比全量 Scan 过滤前缀与 ScanPrefix
+func benchmarkPrefixBitcask(b *testing.B) *Bitcask {
+	bc := benchmarkBitcask(b)
+	pairs := make(map[string][]byte)
+	for i := 0; i < 10000; i++ {
+		pairs[fmt.Sprintf("other:%d", i)] = []byte("v")
+	}
+	for i := 0; i < 100; i++ {
+		pairs[fmt.Sprintf("hash:bench:%d", i)] = []byte("v")
+	}
+	if err := bc.PutMulti(pairs); err != nil {
+		b.Fatal(err)
+	}
+	return bc
+}
+
+func BenchmarkBitcask_ScanHasPrefix(b *testing.B) {
+	bc := benchmarkPrefixBitcask(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		bc.Scan(func(key, _ []byte) error {
+			if bytes.HasPrefix(key, []byte("hash:bench:")) {
+				count++
+			}
+			return nil
+		})
+		if count != 100 {
+			b.Fatalf("期望 100, 实际 %d", count)
+		}
+	}
+}
+
+func BenchmarkBitcask_ScanPrefix(b *testing.B) {
+	bc := benchmarkPrefixBitcask(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		bc.ScanPrefix([]byte("hash:bench:"), func(_, _ []byte) error {
+			count++
+			return nil
+		})
+		if count != 100 {
+			b.Fatalf("期望 100, 实际 %d", count)
+		}
+	}
+}
+
+// recordingLogger 记录每条日志的级别和内容
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) record(level, format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Debugf(format string, args ...any) { l.record("DEBUG", format, args...) }
+func (l *recordingLogger) Infof(format string, args ...any)  { l.record("INFO", format, args...) }
+func (l *recordingLogger) Warnf(format string, args ...any)  { l.record("WARN", format, args...) }
+
+func (l *recordingLogger) count(level string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, entry := range l.entries {
+		if strings.HasPrefix(entry, level+" ") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBitcask_Logger(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	// 引擎的输出全部经过 Logger，不再直接写标准输出
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("创建管道失败: %v", err)
+	}
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	logger := &recordingLogger{}
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.MaxFileSize = 256
+	conf.Logger = logger
+	open := func() *Bitcask {
+		db, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("创建Bitcask实例失败: %v", err)
+		}
+		return db
+	}
+	db := open()
+	batch := NewBatch(db)
+	for i := 0; i < 20; i++ {
+		batch.Put(utils.GetKey(i), utils.GetValue(16))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭Bitcask失败: %v", err)
+	}
+
+	// 关闭 Debug 时重新打开只输出常规日志
+	db = open()
+	if logger.count("DEBUG") != 0 {
+		t.Fatalf("关闭Debug时不应该输出调试日志: %v", logger.entries)
+	}
+	if logger.count("INFO") == 0 {
+		t.Fatalf("应该通过Logger输出常规日志")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭Bitcask失败: %v", err)
+	}
+
+	// 开启 Debug 后原来无条件打印的WAL加载信息作为调试日志输出
+	conf.Debug = true
+	db = open()
+	if logger.count("DEBUG") == 0 {
+		t.Fatalf("开启Debug时应该输出调试日志")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭Bitcask失败: %v", err)
+	}
+
+	// NopLogger 丢弃所有日志
+	conf.Logger = config.NopLogger{}
+	db = open()
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭Bitcask失败: %v", err)
+	}
+
+	w.Close()
+	os.Stdout = stdout
+	var printed bytes.Buffer
+	if _, err := printed.ReadFrom(r); err != nil {
+		t.Fatalf("读取标准输出失败: %v", err)
+	}
+	if printed.Len() != 0 {
+		t.Fatalf("引擎不应该直接写标准输出: %q", printed.String())
+	}
+}
+
+// 测试非法配置在创建任何文件之前被拒绝
+func TestBitcask_InvalidConfig(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	cases := []struct {
+		name   string
+		modify func(c *config.Config)
+	}{
+		{"空DataDir", func(c *config.Config) { c.DataDir = "" }},
+		{"空WalDir", func(c *config.Config) { c.WalDir = "" }},
+		{"空HintDir", func(c *config.Config) { c.HintDir = "" }},
+		{"MaxFileSize为0", func(c *config.Config) { c.MaxFileSize = 0 }},
+		{"BTreeOrder小于2", func(c *config.Config) { c.BTreeOrder = 1 }},
+		{"未知索引类型", func(c *config.Config) { c.IndexType = config.IndexTypeHashMap + 1 }},
+		{"BatchSize为0", func(c *config.Config) { c.BatchSize = 0 }},
+		{"BatchMaxBytes为负数", func(c *config.Config) { c.BatchMaxBytes = -1 }},
+		{"SyncInterval为负数", func(c *config.Config) { c.SyncInterval = -time.Second }},
+		{"ExpireSweepInterval为负数", func(c *config.Config) { c.ExpireSweepInterval = -time.Second }},
+		{"未知压缩类型", func(c *config.Config) { c.Compression = config.CompressionSnappy + 1 }},
+		{"密钥长度错误", func(c *config.Config) { c.EncryptionKey = []byte("short") }},
+		{"同时关闭LoadHint和HintOnClose", func(c *config.Config) { c.LoadHint, c.HintOnClose = false, false }},
+		{"MaxKeySize为0", func(c *config.Config) { c.MaxKeySize = 0 }},
+		{"MaxValueSize为0", func(c *config.Config) { c.MaxValueSize = 0 }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := filepath.Join(testDir, tc.name)
+			conf := getTestConfig(dir)
+			tc.modify(conf)
+
+			db, err := NewBitcask(conf)
+			if !errors.Is(err, config.ErrInvalidConfig) {
+				if db != nil {
+					db.Close()
+				}
+				t.Fatalf("期望返回 ErrInvalidConfig, 实际为: %v", err)
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Fatalf("配置非法时不应创建数据目录: %v", err)
+			}
+		})
+	}
+
+	// 默认配置可以直接通过校验
+	if err := getTestConfig(testDir).Validate(); err != nil {
+		t.Fatalf("默认配置校验失败: %v", err)
+	}
+}
+
+// 测试索引没有变化时 Close 不重写hint文件
+func TestBitcask_CloseSkipsUnchangedHint(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	hintPath := filepath.Join(testDir, conf.HintDir, "keys.hint")
+	open := func() *Bitcask {
+		t.Helper()
+		db, err := NewBitcask(conf)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		return db
+	}
+	// 把hint文件的修改时间设为过去的时间，之后仍为该时间说明 Close 没有重写
+	past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	markHint := func() {
+		t.Helper()
+		if err := os.Chtimes(hintPath, past, past); err != nil {
+			t.Fatalf("修改hint文件时间失败: %v", err)
+		}
+	}
+	hintRewritten := func() bool {
+		t.Helper()
+		info, err := os.Stat(hintPath)
+		if err != nil {
+			t.Fatalf("读取hint文件状态失败: %v", err)
+		}
+		return !info.ModTime().Equal(past)
+	}
+
+	db := open()
+	for i := 0; i < 200; i++ {
+		if err := db.Put(utils.GetKey(i), utils.GetValue(64)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if _, err := db.Delete(utils.GetKey(0)); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	want, err := os.ReadFile(hintPath)
+	if err != nil {
+		t.Fatalf("写入后关闭应该生成hint文件: %v", err)
+	}
+
+	// 只读的会话关闭时不重写hint文件
+	markHint()
+	db = open()
+	if _, ok := db.Get(utils.GetKey(1)); !ok {
+		t.Fatal("读取已写入的键失败")
+	}
+	if err := db.Scan(func(key, value []byte) error { return nil }); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	if hintRewritten() {
+		t.Fatal("索引没有变化时 Close 不应重写hint文件")
+	}
+	if got, _ := os.ReadFile(hintPath); !bytes.Equal(got, want) {
+		t.Fatal("hint文件内容不应变化")
+	}
+
+	// 有写入时重新生成
+	db = open()
+	if err := db.Put([]byte("new-key"), []byte("new-value")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	if !hintRewritten() {
+		t.Fatal("有写入时 Close 应该重新生成hint文件")
+	}
+
+	// 关闭 HintOnClose 后即使有写入也不生成，重启时通过重放WAL恢复
+	conf.HintOnClose = false
+	markHint()
+	db = open()
+	if _, err := db.Delete([]byte("new-key")); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	if hintRewritten() {
+		t.Fatal("关闭 HintOnClose 时 Close 不应生成hint文件")
+	}
+	db = open()
+	defer db.Close()
+	if _, ok := db.Get([]byte("new-key")); ok {
+		t.Fatal("重启后删除应该通过重放WAL恢复")
+	}
+	if _, ok := db.Get(utils.GetKey(0)); ok {
+		t.Fatal("已删除的键不应复活")
+	}
+	if _, ok := db.Get(utils.GetKey(199)); !ok {
+		t.Fatal("重启后读取已写入的键失败")
+	}
+}
+
+// 测试只读模式拒绝写入、多个只读实例可以共存，且不修改数据目录中的任何文件
+func TestBitcask_ReadOnly(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		if err := db.Put(utils.GetKey(i), utils.GetValue(64)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	// 读写实例持有排他锁，只读实例无法同时打开
+	roConf := getTestConfig(testDir)
+	roConf.Debug = false
+	roConf.ReadOnly = true
+	if _, err := NewBitcask(roConf); !errors.Is(err, ErrLocked) {
+		t.Fatalf("读写实例打开时只读实例应该返回 ErrLocked, 实际为: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	listFiles := func() map[string]time.Time {
+		t.Helper()
+		files := make(map[string]time.Time)
+		for _, dir := range []string{conf.WalDir, conf.HintDir} {
+			entries, err := os.ReadDir(filepath.Join(testDir, dir))
+			if err != nil {
+				t.Fatalf("读取目录失败: %v", err)
+			}
+			for _, entry := range entries {
+				info, err := entry.Info()
+				if err != nil {
+					t.Fatalf("读取文件信息失败: %v", err)
+				}
+				files[filepath.Join(dir, entry.Name())] = info.ModTime()
+			}
+		}
+		return files
+	}
+	// 修改hint文件的时间，检查只读实例关闭时没有重写
+	past := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(testDir, conf.HintDir, "keys.hint"), past, past); err != nil {
+		t.Fatalf("修改hint文件时间失败: %v", err)
+	}
+	before := listFiles()
+
+	// 两个只读实例可以同时打开
+	ro1, err := NewBitcask(roConf)
+	if err != nil {
+		t.Fatalf("打开只读实例失败: %v", err)
+	}
+	ro2, err := NewBitcask(roConf)
+	if err != nil {
+		t.Fatalf("打开第二个只读实例失败: %v", err)
+	}
+	if _, err := NewBitcask(conf); !errors.Is(err, ErrLocked) {
+		t.Fatalf("只读实例打开时读写实例应该返回 ErrLocked, 实际为: %v", err)
+	}
+
+	for _, ro := range []*Bitcask{ro1, ro2} {
+		if _, ok := ro.Get(utils.GetKey(199)); !ok {
+			t.Fatal("只读实例读取失败")
+		}
+		count := 0
+		if err := ro.Scan(func(key, value []byte) error {
+			count++
+			return nil
+		}); err != nil {
+			t.Fatalf("只读实例扫描失败: %v", err)
+		}
+		if count != 200 {
+			t.Fatalf("只读实例扫描数量不正确: 期望 200, 实际 %d", count)
+		}
+
+		if err := ro.Put([]byte("k"), []byte("v")); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("Put 应该返回 ErrReadOnly, 实际为: %v", err)
+		}
+		if err := ro.PutWithTTL([]byte("k"), []byte("v"), time.Minute); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("PutWithTTL 应该返回 ErrReadOnly, 实际为: %v", err)
+		}
+		if err := ro.PutMulti(map[string][]byte{"k": []byte("v")}); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("PutMulti 应该返回 ErrReadOnly, 实际为: %v", err)
+		}
+		if _, err := ro.Delete(utils.GetKey(1)); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("Delete 应该返回 ErrReadOnly, 实际为: %v", err)
+		}
+		if err := ro.Merge(); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("Merge 应该返回 ErrReadOnly, 实际为: %v", err)
+		}
+		if err := ro.Hint(); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("Hint 应该返回 ErrReadOnly, 实际为: %v", err)
+		}
+		batch := NewBatch(ro)
+		if err := batch.Put([]byte("k"), []byte("v")); err != nil {
+			t.Fatalf("暂存写入失败: %v", err)
+		}
+		if err := batch.Commit(); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("Commit 应该返回 ErrReadOnly, 实际为: %v", err)
+		}
+	}
+
+	if err := ro1.Close(); err != nil {
+		t.Fatalf("关闭只读实例失败: %v", err)
+	}
+	if err := ro2.Close(); err != nil {
+		t.Fatalf("关闭只读实例失败: %v", err)
+	}
+	after := listFiles()
+	if len(after) != len(before) {
+		t.Fatalf("只读实例不应创建或删除文件: 之前 %v, 之后 %v", before, after)
+	}
+	for name, modTime := range before {
+		if !after[name].Equal(modTime) {
+			t.Fatalf("只读实例不应修改文件: %s", name)
+		}
+	}
+
+	// 只读实例全部关闭后可以重新以读写模式打开
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("只读实例关闭后打开读写实例失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	// 只读模式不会创建数据目录
+	missing := filepath.Join(testDir, "missing")
+	missingConf := getTestConfig(missing)
+	missingConf.ReadOnly = true
+	if db, err := NewBitcask(missingConf); err == nil {
+		db.Close()
+		t.Fatal("只读模式打开不存在的目录应该返回错误")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf("只读模式不应创建数据目录: %v", err)
+	}
+}
+
+// 测试记录的写入时间戳在会话内严格递增，并在重启和合并后保持不变
+func TestBitcask_GetWithMeta(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+
+	before := time.Now().UnixNano()
+	want := make(map[string]int64)
+	var last int64
+	check := func(key []byte) int64 {
+		t.Helper()
+		_, ts, ok := db.GetWithMeta(key)
+		if !ok {
+			t.Fatalf("读取键 %s 失败", key)
+		}
+		if ts <= last {
+			t.Fatalf("时间戳应该严格递增: 上一个 %d, 当前 %d", last, ts)
+		}
+		last = ts
+		want[string(key)] = ts
+		return ts
+	}
+	for i := 0; i < 200; i++ {
+		if err := db.Put(utils.GetKey(i), utils.GetValue(32)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+		check(utils.GetKey(i))
+	}
+	if first := want[string(utils.GetKey(0))]; first < before || last > time.Now().UnixNano() {
+		t.Fatalf("时间戳应该为写入时的时间: %d ~ %d", first, last)
+	}
+	// 覆盖写入、带过期时间的写入和批处理写入同样带有更新的时间戳
+	if err := db.Put(utils.GetKey(0), []byte("new")); err != nil {
+		t.Fatalf("覆盖写入失败: %v", err)
+	}
+	check(utils.GetKey(0))
+	if err := db.PutWithTTL([]byte("ttl-key"), []byte("v"), time.Hour); err != nil {
+		t.Fatalf("写入带过期时间的键失败: %v", err)
+	}
+	check([]byte("ttl-key"))
+	batch := NewBatch(db)
+	if err := batch.Put([]byte("batch-key"), []byte("v")); err != nil {
+		t.Fatalf("暂存写入失败: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交批处理失败: %v", err)
+	}
+	check([]byte("batch-key"))
+	if _, _, ok := db.GetWithMeta([]byte("missing")); ok {
+		t.Fatal("不存在的键应该返回 ok=false")
+	}
+
+	verify := func(stage string) {
+		t.Helper()
+		for key, ts := range want {
+			_, got, ok := db.GetWithMeta([]byte(key))
+			if !ok || got != ts {
+				t.Fatalf("%s后键 %s 的时间戳不一致: 期望 %d, 实际 %d", stage, key, ts, got)
+			}
+		}
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	verify("合并")
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	verify("重启")
+}
+
+// 测试没有时间戳的旧格式记录仍可读取，时间戳为0
+func TestBitcask_GetWithMetaOldRecord(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	if err := os.MkdirAll(filepath.Join(testDir, conf.WalDir), 0755); err != nil {
+		t.Fatalf("创建WAL目录失败: %v", err)
+	}
+	encoded, err := record.NewRecord([]byte("old-key"), []byte("old-value")).Encode()
+	if err != nil {
+		t.Fatalf("编码记录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(testDir, conf.WalDir, "wal-0.log"), encoded, 0644); err != nil {
+		t.Fatalf("写入旧格式WAL失败: %v", err)
+	}
+
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	value, ts, ok := db.GetWithMeta([]byte("old-key"))
+	if !ok || string(value) != "old-value" {
+		t.Fatalf("读取旧格式记录失败: %q, %v", value, ok)
+	}
+	if ts != 0 {
+		t.Fatalf("旧格式记录的时间戳应该为0, 实际 %d", ts)
+	}
+}
+
+func TestBitcask_MaxKeyValueSize(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	// 在默认上限下写入一条较大的记录，之后调小上限重新打开仍应能读取
+	large := bytes.Repeat([]byte("v"), 200)
+	if err := db.Put([]byte("large"), large); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	conf.MaxKeySize = 8
+	conf.MaxValueSize = 100
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("调小上限后重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if value, ok := db.Get([]byte("large")); !ok || !bytes.Equal(value, large) {
+		t.Fatal("调小上限后应该仍能读取之前写入的记录")
+	}
+
+	// 恰好等于上限可以写入
+	if err := db.Put(bytes.Repeat([]byte("k"), 8), bytes.Repeat([]byte("v"), 100)); err != nil {
+		t.Fatalf("长度等于上限时写入失败: %v", err)
+	}
+
+	longKey := bytes.Repeat([]byte("k"), 9)
+	if err := db.Put(longKey, []byte("v")); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("key 超过上限应返回 ErrKeyTooLarge, 实际为: %v", err)
+	}
+	if err := db.PutWithTTL([]byte("ttl"), bytes.Repeat([]byte("v"), 101), time.Minute); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("value 超过上限应返回 ErrValueTooLarge, 实际为: %v", err)
+	}
+	err = db.PutMulti(map[string][]byte{"a": []byte("1"), "b": bytes.Repeat([]byte("v"), 101)})
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("PutMulti 中 value 超过上限应返回 ErrValueTooLarge, 实际为: %v", err)
+	}
+	if _, ok := db.Get([]byte("a")); ok {
+		t.Fatal("PutMulti 超过上限时不应写入任何键")
+	}
+	for _, key := range [][]byte{longKey, []byte("ttl")} {
+		if _, ok := db.Get(key); ok {
+			t.Fatalf("超过上限的键 %q 不应被写入", key)
+		}
+	}
+
+	batch := NewBatch(db)
+	if err := batch.Put([]byte("batch"), bytes.Repeat([]byte("v"), 101)); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("批处理中 value 超过上限应返回 ErrValueTooLarge, 实际为: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交批处理失败: %v", err)
+	}
+	if _, ok := db.Get([]byte("batch")); ok {
+		t.Fatal("批处理中超过上限的键不应被写入")
+	}
+
+	// Merge 重写旧记录不受调小后的上限影响
+	if err := db.Merge(); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	if value, ok := db.Get([]byte("large")); !ok || !bytes.Equal(value, large) {
+		t.Fatal("合并后应该仍能读取之前写入的记录")
+	}
+}
+
+func TestBitcask_Fold(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	want := 0
+	for i := 0; i < 100; i++ {
+		value := bytes.Repeat([]byte("v"), i)
+		if err := db.Put(utils.GetKey(i), value); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+		want += len(value)
+	}
+	// 删除和覆盖写入的值不应被计入
+	if _, err := db.Delete(utils.GetKey(10)); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	want -= 10
+	if err := db.Put(utils.GetKey(20), []byte("x")); err != nil {
+		t.Fatalf("覆盖写入失败: %v", err)
+	}
+	want -= 19
+
+	total, err := db.Fold(0, func(acc interface{}, key, value []byte) (interface{}, error) {
+		return acc.(int) + len(value), nil
+	})
+	if err != nil {
+		t.Fatalf("Fold 失败: %v", err)
+	}
+	if total.(int) != want {
+		t.Fatalf("值的总字节数不正确: 期望 %d, 实际 %d", want, total)
+	}
+
+	// 回调返回错误时停止遍历，返回当时的累积值
+	stop := errors.New("stop")
+	count, err := db.Fold(0, func(acc interface{}, key, value []byte) (interface{}, error) {
+		if acc.(int) == 5 {
+			return acc, stop
+		}
+		return acc.(int) + 1, nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("应返回回调的错误, 实际为: %v", err)
+	}
+	if count.(int) != 5 {
+		t.Fatalf("出错时应返回当时的累积值: 期望 5, 实际 %d", count)
+	}
+}
+
+// 测试WAL目录中名称合规但内容不是WAL文件的文件会导致打开失败，而不是被当作空文件
+func TestBitcask_RejectForeignWalFile(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+
+	foreign := filepath.Join(testDir, conf.WalDir, "wal-100.log")
+	if err := os.WriteFile(foreign, []byte("not a wal file"), 0644); err != nil {
+		t.Fatalf("写入外来文件失败: %v", err)
+	}
+	if db, err := NewBitcask(conf); !errors.Is(err, wal.ErrInvalidFile) {
+		if db != nil {
+			db.Close()
+		}
+		t.Fatalf("期望返回 wal.ErrInvalidFile, 实际为: %v", err)
+	}
+
+	// 移除外来文件后可以正常打开
+	if err := os.Remove(foreign); err != nil {
+		t.Fatalf("删除外来文件失败: %v", err)
+	}
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if value, ok := db.Get([]byte("key")); !ok || string(value) != "value" {
+		t.Fatalf("重新打开后读取失败: %q, %v", value, ok)
+	}
+}
+
+// 启动时从 hint 文件加载 100 万个键的耗时，只包括读取、校验 hint 文件和重建索引
+func BenchmarkBitcask_LoadHint(b *testing.B) {
+	dir, err := os.MkdirTemp("", "bitcask-bench-*")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+	conf := config.NewConfig()
+	conf.DataDir = dir
+	conf.Debug = false
+	memTable := newMemTable(conf)
+	for i := 0; i < 1000000; i++ {
+		memTable.Put([]byte(fmt.Sprintf("key_%09d", i)), &record.Pos{FileId: 1, Offset: uint32(i), Length: 32})
+	}
+	if _, err := writeHint(filepath.Join(dir, conf.HintDir), memTable, 1, 2); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bc := &Bitcask{conf: conf, memTable: newMemTable(conf)}
+		if err := bc.LoadHint(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// replayIndex 用给定的 ReplayWorkers 重新打开数据目录，返回重放得到的索引内容和事务ID
+func replayIndex(t *testing.T, conf *config.Config, workers int) (map[string]record.Pos, uint32) {
+	t.Helper()
+	replayConf := *conf
+	replayConf.ReplayWorkers = workers
+	replayConf.HintOnClose = true
+	db, err := NewBitcask(&replayConf)
+	if err != nil {
+		t.Fatalf("ReplayWorkers=%d 打开数据库失败: %v", workers, err)
+	}
+	defer simulateCrash(db) // 不生成hint文件，下一次打开仍然重放WAL
+	positions := make(map[string]record.Pos)
+	if err := db.memTable.Foreach(func(key []byte, pos *record.Pos) error {
+		positions[string(key)] = *pos
+		return nil
+	}); err != nil {
+		t.Fatalf("遍历索引失败: %v", err)
+	}
+	return positions, db.txnId.Load()
+}
+
+// 测试并行解析WAL文件重放得到的索引与逐个文件重放的完全相同
+func TestBitcask_ParallelReplay(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.AutoSync = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	// 同一批键反复覆盖和删除，写入散布在多个WAL文件中；批处理较大，会跨越文件边界
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 300; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i))
+			if i%7 == round {
+				if _, err := db.Delete(key); err != nil {
+					t.Fatalf("删除失败: %v", err)
+				}
+				continue
+			}
+			if err := db.Put(key, []byte(fmt.Sprintf("value-%d-%d", i, round))); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+		}
+		batch := NewBatch(db)
+		for i := 0; i < 150; i++ {
+			key := []byte(fmt.Sprintf("key-%d", i*2))
+			if i%5 == round {
+				err = batch.Delete(key)
+			} else {
+				err = batch.Put(key, []byte(fmt.Sprintf("batch-%d-%d", i, round)))
+			}
+			if err != nil {
+				t.Fatalf("批处理写入失败: %v", err)
+			}
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatalf("提交批处理失败: %v", err)
+		}
+	}
+	if len(db.oldWal) < 10 {
+		t.Fatalf("只生成了 %d 个旧WAL文件，无法覆盖跨文件的重放", len(db.oldWal))
+	}
+	expected := make(map[string][]byte)
+	if err := db.Scan(func(key, value []byte) error {
+		expected[string(key)] = append([]byte(nil), value...)
+		return nil
+	}); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	wantTxnId := db.txnId.Load()
+	// 模拟提交过程中崩溃：事务记录跨越文件边界但没有提交记录，重放时应被丢弃
+	txnId := wantTxnId + 1
+	if err := db.putTxnBegin([]byte("txn_begin"), txnId); err != nil {
+		t.Fatalf("写入事务开始记录失败: %v", err)
+	}
+	for i := 0; i < 150; i++ {
+		if _, err := db.putTxn([]byte(fmt.Sprintf("key-%d", i)), []byte("uncommitted"), txnId); err != nil {
+			t.Fatalf("写入事务记录失败: %v", err)
+		}
+	}
+	if err := db.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	simulateCrash(db)
+
+	sequential, seqTxnId := replayIndex(t, conf, 1)
+	parallel, parTxnId := replayIndex(t, conf, 8)
+	if seqTxnId != wantTxnId || parTxnId != wantTxnId {
+		t.Fatalf("重放后的事务ID不一致: 逐个 %d, 并行 %d, 期望 %d", seqTxnId, parTxnId, wantTxnId)
+	}
+	if len(sequential) != len(parallel) {
+		t.Fatalf("索引大小不一致: 逐个 %d, 并行 %d", len(sequential), len(parallel))
+	}
+	for key, pos := range sequential {
+		if parallel[key] != pos {
+			t.Fatalf("%s 的位置不一致: 逐个 %+v, 并行 %+v", key, pos, parallel[key])
+		}
+	}
+
+	// 并行重放后读取到的数据与崩溃前相同
+	replayConf := *conf
+	replayConf.ReplayWorkers = 8
+	db, err = NewBitcask(&replayConf)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	count := 0
+	if err := db.Scan(func(key, value []byte) error {
+		if !bytes.Equal(value, expected[string(key)]) {
+			return fmt.Errorf("%s 的值为 %q, 期望 %q", key, value, expected[string(key)])
+		}
+		count++
+		return nil
+	}); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if count != len(expected) {
+		t.Fatalf("重放后有 %d 个键, 期望 %d 个", count, len(expected))
+	}
+}
+
+// 对比逐个文件和并行解析重放大量WAL文件
+func BenchmarkBitcask_ReplayWals(b *testing.B) {
+	dir, err := os.MkdirTemp("", "bitcask-bench-*")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { os.RemoveAll(dir) })
+	conf := config.NewConfig()
+	conf.DataDir = dir
+	conf.Debug = false
+	conf.AutoSync = false
+	conf.MaxFileSize = 256 * 1024
+	db, err := NewBitcask(conf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	value := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < 500000; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key_%09d", i%200000)), value); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := db.Sync(); err != nil {
+		b.Fatal(err)
+	}
+	simulateCrash(db)
+
+	for _, workers := range []int{1, 0} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			replayConf := *conf
+			replayConf.ReplayWorkers = workers
+			for i := 0; i < b.N; i++ {
+				bc := &Bitcask{conf: &replayConf, memTable: newMemTable(&replayConf), oldWal: make(map[uint32]*wal.Wal)}
+				if err := bc.loadWalFiles(); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				bc.activeWal.Close()
+				for _, w := range bc.oldWal {
+					w.Close()
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// 测试活跃文件末尾有写入不完整的记录时，恢复后的写入在再次重新打开后仍然存在
+func TestBitcask_TornTailWriteAfterRecovery(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("写入数据失败: %v", err)
+		}
+	}
+	activePath := filepath.Join(testDir, conf.WalDir, wal.FileName(db.fileId))
+	simulateCrash(db)
+
+	// 模拟崩溃时最后一条记录只写入了一部分
+	rec, err := record.NewRecord([]byte("torn"), []byte("torn-value")).Encode()
+	if err != nil {
+		t.Fatalf("编码记录失败: %v", err)
+	}
+	fp, err := os.OpenFile(activePath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("打开WAL文件失败: %v", err)
+	}
+	if _, err := fp.Write(rec[:len(rec)-3]); err != nil {
+		t.Fatalf("写入不完整的记录失败: %v", err)
+	}
+	fp.Close()
+
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("崩溃后重新打开失败: %v", err)
+	}
+	if _, ok := db.Get([]byte("torn")); ok {
+		t.Fatalf("不完整的记录不应该被读到")
+	}
+	if err := db.Put([]byte("after"), []byte("after-recovery")); err != nil {
+		t.Fatalf("恢复后写入失败: %v", err)
+	}
+	simulateCrash(db)
+
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("再次重新打开失败: %v", err)
+	}
+	defer db.Close()
+	if value, ok := db.Get([]byte("after")); !ok || string(value) != "after-recovery" {
+		t.Fatalf("恢复后的写入丢失: %q", value)
+	}
+	for i := 0; i < 20; i++ {
+		if value, ok := db.Get(utils.GetKey(i)); !ok || string(value) != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("数据不匹配: key=%s, value=%s", utils.GetKey(i), value)
+		}
+	}
+}
+
+// 测试活跃文件中间的记录损坏时不截断之后完整的记录，保留该文件并把新的写入追加到新文件
+func TestBitcask_MidFileCorruptionKeepsFile(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("写入数据失败: %v", err)
+		}
+	}
+	pos, err := db.memTable.Get(utils.GetKey(1))
+	if err != nil {
+		t.Fatalf("读取索引失败: %v", err)
+	}
+	corruptId := db.fileId
+	activePath := filepath.Join(testDir, conf.WalDir, wal.FileName(corruptId))
+	simulateCrash(db)
+
+	// 翻转中间一条记录 CRC 之前的字节
+	data, err := os.ReadFile(activePath)
+	if err != nil {
+		t.Fatalf("读取WAL文件失败: %v", err)
+	}
+	data[pos.Offset+pos.Length-5] ^= 0xff
+	if err := os.WriteFile(activePath, data, 0644); err != nil {
+		t.Fatalf("写入损坏的WAL文件失败: %v", err)
+	}
+
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	if db.fileId == corruptId {
+		t.Fatalf("应该切换到新的活跃文件")
+	}
+	if err := db.Put([]byte("after"), []byte("after-recovery")); err != nil {
+		t.Fatalf("恢复后写入失败: %v", err)
+	}
+	simulateCrash(db)
+	if info, err := os.Stat(activePath); err != nil || info.Size() != int64(len(data)) {
+		t.Fatalf("损坏的文件不应被截断: %v", err)
+	}
+
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("再次重新打开失败: %v", err)
+	}
+	defer db.Close()
+	if value, ok := db.Get([]byte("after")); !ok || string(value) != "after-recovery" {
+		t.Fatalf("恢复后的写入丢失: %q", value)
+	}
+	if value, ok := db.Get(utils.GetKey(0)); !ok || string(value) != "value-0" {
+		t.Fatalf("损坏之前的记录丢失: %q", value)
+	}
+}
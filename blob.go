@@ -0,0 +1,167 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aixiasang/bitcask/record"
+	"github.com/aixiasang/bitcask/wal"
+)
+
+// 超过 BlobThreshold 的 value 单独写入 blob 文件，WAL 中的记录只保存 value 在 blob 文件中的位置。
+// Merge 只重写这些位置，不复制大 value；blob 文件中的 value 全部失效后，文件随 Merge 删除
+
+// loadBlobFiles 打开 blob 目录下的所有 blob 文件，ID 最大的文件继续用于写入
+func (bc *Bitcask) loadBlobFiles() error {
+	if bc.conf.BlobDir == "" {
+		// 手动构造的配置可能没有设置 BlobDir，此时也不会开启 BlobThreshold
+		return nil
+	}
+	files, err := os.ReadDir(filepath.Join(bc.conf.DataDir, bc.conf.BlobDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, fp := range files {
+		// fmt.Sprintf("blob-%d.log", fileId)
+		name := fp.Name()
+		if !strings.HasPrefix(name, "blob-") || !strings.HasSuffix(name, ".log") {
+			bc.conf.Warnf("跳过非blob文件: %s", name)
+			continue
+		}
+		fileId, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "blob-"), ".log"), 10, 32)
+		if err != nil {
+			bc.conf.Warnf("无法解析blob文件ID: %s, 错误: %v", name, err)
+			continue
+		}
+		blob, err := wal.NewBlobFile(bc.conf, uint32(fileId))
+		if err != nil {
+			return fmt.Errorf("无法打开blob文件 %d: %w", fileId, err)
+		}
+		bc.blobs[uint32(fileId)] = blob
+		if uint32(fileId) >= bc.nextBlobId {
+			bc.nextBlobId = uint32(fileId) + 1
+		}
+	}
+	if last, ok := bc.blobs[bc.nextBlobId-1]; ok {
+		delete(bc.blobs, bc.nextBlobId-1)
+		bc.activeBlob = last
+	}
+	return nil
+}
+
+// blobForWrite 返回用于写入的 blob 文件，活跃文件不存在或超过 MaxFileSize 时创建新文件
+func (bc *Bitcask) blobForWrite() (*wal.Wal, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if bc.activeBlob != nil && bc.activeBlob.Size() < bc.conf.MaxFileSize {
+		return bc.activeBlob, nil
+	}
+	if err := os.MkdirAll(filepath.Join(bc.conf.DataDir, bc.conf.BlobDir), 0755); err != nil {
+		return nil, err
+	}
+	if bc.activeBlob != nil {
+		if err := bc.activeBlob.Sync(); err != nil {
+			return nil, err
+		}
+		bc.blobs[bc.activeBlob.FileId()] = bc.activeBlob
+		bc.activeBlob = nil
+	}
+	blob, err := wal.NewBlobFile(bc.conf, bc.nextBlobId)
+	if err != nil {
+		return nil, err
+	}
+	bc.nextBlobId++
+	bc.activeBlob = blob
+	return blob, nil
+}
+
+// separate 开启 BlobThreshold 且 value 超过阈值时，将写入记录的 value 写入 blob 文件，
+// 记录转换为只保存位置的引用。key 为不含事务ID的键，与 blob 文件中的记录一致
+func (bc *Bitcask) separate(key []byte, rec *record.Record) error {
+	if bc.conf.BlobThreshold == 0 || uint64(len(rec.Value)) <= uint64(bc.conf.BlobThreshold) {
+		return nil
+	}
+	if rec.RecordType != record.RecordTypePut && rec.RecordType != record.RecordTypeTxnPut {
+		return nil
+	}
+	blob, err := bc.blobForWrite()
+	if err != nil {
+		return fmt.Errorf("创建blob文件失败: %v", err)
+	}
+	// 先写入 value，WAL 中的引用不会指向尚未写入的数据
+	ref, err := blob.Write(key, rec.Value)
+	if err != nil {
+		return fmt.Errorf("写入blob文件失败: %v", err)
+	}
+	rec.ToBlobRef(ref)
+	return nil
+}
+
+// resolveBlob 读取引用记录指向的 value，其他记录保持不变
+func (bc *Bitcask) resolveBlob(rec *record.Record) error {
+	if !rec.IsBlobRef() {
+		return nil
+	}
+	ref, err := record.DecodeBlobRef(rec.Value)
+	if err != nil {
+		return err
+	}
+	blob := bc.blobs[ref.FileId]
+	if active := bc.activeBlob; active != nil && active.FileId() == ref.FileId {
+		blob = active
+	}
+	if blob == nil {
+		return fmt.Errorf("blob file not found: fileId=%d", ref.FileId)
+	}
+	blobRec, err := blob.ReadPos(ref)
+	if err != nil {
+		return fmt.Errorf("error reading from blob file %d at offset %d: %w", ref.FileId, ref.Offset, err)
+	}
+	if !bytes.Equal(blobRec.Key, rec.Key) {
+		return fmt.Errorf("blob record key mismatch: fileId=%d, offset=%d", ref.FileId, ref.Offset)
+	}
+	rec.ResolveBlob(blobRec.Value)
+	return nil
+}
+
+// removeDeadBlobs 删除 candidates 中没有被 live 引用的 blob 文件，调用方需要持有 bc.mu 写锁
+//
+// candidates 必须是已经封存的文件：新的 value 只写入活跃文件，封存后的文件不会再被新的记录引用
+func (bc *Bitcask) removeDeadBlobs(candidates []uint32, live map[uint32]struct{}) error {
+	for _, fileId := range candidates {
+		if _, ok := live[fileId]; ok {
+			continue
+		}
+		blob, ok := bc.blobs[fileId]
+		if !ok {
+			continue
+		}
+		if err := blob.Delete(); err != nil {
+			return fmt.Errorf("删除blob文件失败: %v", err)
+		}
+		delete(bc.blobs, fileId)
+	}
+	return nil
+}
+
+// closeBlobs 关闭所有 blob 文件
+func (bc *Bitcask) closeBlobs() error {
+	if bc.activeBlob != nil {
+		if err := bc.activeBlob.Close(); err != nil {
+			return err
+		}
+	}
+	for _, blob := range bc.blobs {
+		if err := blob.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
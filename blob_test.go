@@ -0,0 +1,254 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// blobValue 生成超过阈值的 value，内容与 key 和版本相关
+func blobValue(i, version int) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("large-%d-v%d|", i, version)), 500)
+}
+
+// blobSizes 返回 blob 目录下每个文件的大小
+func blobSizes(t *testing.T, dir string) map[string]int64 {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("读取blob目录失败: %v", err)
+	}
+	sizes := make(map[string]int64)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatalf("读取blob文件信息失败: %v", err)
+		}
+		sizes[entry.Name()] = info.Size()
+	}
+	return sizes
+}
+
+// walBytes 返回 WAL 目录下所有文件的总大小
+func walBytes(t *testing.T, dir string) int64 {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("读取WAL目录失败: %v", err)
+	}
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatalf("读取WAL文件信息失败: %v", err)
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+// 测试超过 BlobThreshold 的 value 写入 blob 文件，Merge 只重写引用，不重写大 value
+func TestBitcask_BlobSeparation(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.BlobThreshold = 1024
+	conf.MaxFileSize = 4096 // 每个大 value 都超过文件大小，单独占用一个 blob 文件
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+
+	expected := make(map[string][]byte)
+	const large = 6
+	for i := 0; i < large; i++ {
+		key := fmt.Sprintf("large-%d", i)
+		expected[key] = blobValue(i, 0)
+		if err := db.Put([]byte(key), expected[key]); err != nil {
+			t.Fatalf("写入大value失败: %v", err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("small-%d", i)
+		expected[key] = []byte(fmt.Sprintf("small-value-%d", i))
+		if err := db.Put([]byte(key), expected[key]); err != nil {
+			t.Fatalf("写入小value失败: %v", err)
+		}
+	}
+	// 等于阈值的 value 不分离
+	expected["edge"] = bytes.Repeat([]byte("e"), int(conf.BlobThreshold))
+	if err := db.Put([]byte("edge"), expected["edge"]); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	// 覆盖 large-0、删除 large-1 后，它们原来所在的 blob 文件不再有有效 value
+	expected["large-0"] = blobValue(0, 1)
+	if err := db.Put([]byte("large-0"), expected["large-0"]); err != nil {
+		t.Fatalf("覆盖大value失败: %v", err)
+	}
+	if _, err := db.Delete([]byte("large-1")); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	delete(expected, "large-1")
+	// 批处理和带过期时间的写入同样分离
+	batch := NewBatch(db)
+	expected["large-txn"] = blobValue(100, 0)
+	if err := batch.Put([]byte("large-txn"), expected["large-txn"]); err != nil {
+		t.Fatalf("批处理写入失败: %v", err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交批处理失败: %v", err)
+	}
+	expected["large-ttl"] = blobValue(101, 0)
+	if err := db.PutWithTTL([]byte("large-ttl"), expected["large-ttl"], time.Hour); err != nil {
+		t.Fatalf("写入带过期时间的大value失败: %v", err)
+	}
+
+	verify := func(db *Bitcask, stage string) {
+		t.Helper()
+		for key, want := range expected {
+			value, err := db.GetE([]byte(key))
+			if err != nil {
+				t.Fatalf("%s读取 %s 失败: %v", stage, key, err)
+			}
+			if !bytes.Equal(value, want) {
+				t.Fatalf("%s %s 的值不一致: 长度 %d, 期望长度 %d", stage, key, len(value), len(want))
+			}
+		}
+		if _, ok := db.Get([]byte("large-1")); ok {
+			t.Fatalf("%s已删除的键仍然存在", stage)
+		}
+		count := 0
+		if err := db.Scan(func(key, value []byte) error {
+			if !bytes.Equal(value, expected[string(key)]) {
+				return fmt.Errorf("扫描到的 %s 的值不一致", key)
+			}
+			count++
+			return nil
+		}); err != nil {
+			t.Fatalf("%s扫描失败: %v", stage, err)
+		}
+		if count != len(expected) {
+			t.Fatalf("%s扫描到 %d 个键, 期望 %d 个", stage, count, len(expected))
+		}
+	}
+	verify(db, "合并前")
+
+	// 只有超过阈值的 value 以引用的形式写入WAL
+	for key, wantRef := range map[string]bool{"large-2": true, "large-txn": true, "small-0": false, "edge": false} {
+		pos, _ := db.memTable.Get([]byte(key))
+		rec, err := db.readRawRecord(pos)
+		if err != nil {
+			t.Fatalf("读取 %s 的记录失败: %v", key, err)
+		}
+		if rec.IsBlobRef() != wantRef {
+			t.Fatalf("%s 是否为blob引用: %v, 期望 %v", key, rec.IsBlobRef(), wantRef)
+		}
+	}
+	ttl, hasTTL, err := db.TTL([]byte("large-ttl"))
+	if err != nil || !hasTTL || ttl <= 0 {
+		t.Fatalf("大value的过期时间丢失: ttl=%v, hasTTL=%v, err=%v", ttl, hasTTL, err)
+	}
+
+	blobDir := filepath.Join(testDir, conf.BlobDir)
+	walDir := filepath.Join(testDir, conf.WalDir)
+	before := blobSizes(t, blobDir)
+	if len(before) != large+3 {
+		t.Fatalf("合并前blob文件数量为 %d, 期望 %d", len(before), large+3)
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	verify(db, "合并后")
+
+	// 仍有有效 value 的 blob 文件没有被重写，只保存被覆盖和删除的 value 的文件被删除
+	after := blobSizes(t, blobDir)
+	if len(after) != len(before)-2 {
+		t.Fatalf("合并后blob文件数量为 %d, 期望 %d", len(after), len(before)-2)
+	}
+	for name, size := range after {
+		if before[name] != size {
+			t.Fatalf("blob文件 %s 在合并时被修改: 大小 %d -> %d", name, before[name], size)
+		}
+	}
+	for _, name := range []string{"blob-0.log", "blob-1.log"} {
+		if _, ok := after[name]; ok {
+			t.Fatalf("没有有效value的blob文件 %s 没有被删除", name)
+		}
+	}
+	// 合并后的WAL只包含引用和小value，比一个大value还小
+	if size := walBytes(t, walDir); size >= int64(len(blobValue(0, 0))) {
+		t.Fatalf("合并后WAL文件共 %d 字节，大value可能被重写到WAL中", size)
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("获取统计失败: %v", err)
+	}
+	if stats.BlobFiles != len(after) || stats.Keys != len(expected) {
+		t.Fatalf("统计不正确: %+v", stats)
+	}
+
+	// 重新打开后从hint和WAL恢复，blob文件中的value仍然可以读取
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	verify(db, "重新打开后")
+
+	// 重新打开后继续写入新的 blob 文件，不覆盖已有文件
+	expected["large-new"] = blobValue(200, 0)
+	if err := db.Put([]byte("large-new"), expected["large-new"]); err != nil {
+		t.Fatalf("写入大value失败: %v", err)
+	}
+	verify(db, "继续写入后")
+}
+
+// 测试备份包含 blob 文件，备份可以独立打开
+func TestBitcask_BackupWithBlobs(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	backupRoot, cleanupBackup := setupTestDir(t)
+	defer cleanupBackup()
+	backupDir := filepath.Join(backupRoot, "backup")
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.BlobThreshold = 1024
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("large-%d", i)), blobValue(i, 0)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Backup(backupDir); err != nil {
+		t.Fatalf("备份失败: %v", err)
+	}
+
+	backupConf := getTestConfig(backupDir)
+	backupConf.Debug = false
+	backupConf.BlobThreshold = conf.BlobThreshold
+	restored, err := NewBitcask(backupConf)
+	if err != nil {
+		t.Fatalf("打开备份失败: %v", err)
+	}
+	defer restored.Close()
+	for i := 0; i < 5; i++ {
+		value, err := restored.GetE([]byte(fmt.Sprintf("large-%d", i)))
+		if err != nil || !bytes.Equal(value, blobValue(i, 0)) {
+			t.Fatalf("备份中的 large-%d 不正确: err=%v", i, err)
+		}
+	}
+}
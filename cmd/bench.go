@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// benchOptions bench 命令的参数
+type benchOptions struct {
+	ops       int   // 总操作数，按读写协程数量比例分配给 Get 和 Put
+	valueSize int   // 每次写入的值大小（字节）
+	readers   int   // 执行 Get 的协程数
+	writers   int   // 执行 Put 的协程数
+	keys      int   // 键空间大小，开始计时前预先写入
+	seed      int64 // 随机数种子，相同的种子生成相同的访问序列
+}
+
+// benchOpStats 某一类操作的统计结果
+type benchOpStats struct {
+	name      string
+	latencies []time.Duration // 已排序的单次操作耗时
+	errors    int             // Put 失败或 Get 未命中的次数
+}
+
+// percentile 返回第 p 百分位的耗时，p 取值为 0~100
+func (s *benchOpStats) percentile(p float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	idx := int(float64(len(s.latencies)-1) * p / 100)
+	return s.latencies[idx]
+}
+
+// benchResult 一次基准测试的结果
+type benchResult struct {
+	elapsed time.Duration
+	ops     []*benchOpStats
+}
+
+var benchOpts benchOptions
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "对临时实例执行读写基准测试",
+	Long: `在临时目录中创建实例，预先写入 --keys 个键后由 --writers 个协程执行 Put、
+--readers 个协程执行 Get，总操作数为 --ops，输出吞吐量和耗时分位数，结束后删除临时目录。
+索引类型、--auto-sync、--max-file-size 等全局选项同样生效，便于比较不同配置。
+
+示例:
+  bitcask bench --ops 100000 --value-size 128 --readers 4 --writers 4
+  bitcask bench --index-type skiplist --auto-sync=false --max-file-size 67108864`,
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := runBench(benchOpts)
+		if err != nil {
+			fmt.Printf("基准测试失败: %v\n", err)
+			return
+		}
+		printBenchResult(os.Stdout, benchOpts, result)
+	},
+}
+
+// runBench 在临时目录中创建实例并执行基准测试，返回前删除临时目录
+func runBench(opts benchOptions) (*benchResult, error) {
+	if opts.ops <= 0 || opts.valueSize < 0 || opts.readers < 0 || opts.writers < 0 || opts.keys <= 0 {
+		return nil, errors.New("ops 和 keys 必须大于0，value-size、readers 和 writers 不能为负数")
+	}
+	if opts.readers+opts.writers == 0 {
+		return nil, errors.New("readers 和 writers 不能同时为0")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "bitcask-bench-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// createBitcask 使用全局的 dataDir，创建实例后立即恢复
+	savedDataDir := dataDir
+	dataDir = tmpDir
+	bc, err := createBitcask()
+	dataDir = savedDataDir
+	if err != nil {
+		return nil, fmt.Errorf("创建 Bitcask 实例失败: %v", err)
+	}
+	defer bc.Close()
+
+	value := make([]byte, opts.valueSize)
+	rand.New(rand.NewSource(opts.seed)).Read(value)
+	benchKey := func(i int) []byte { return []byte(fmt.Sprintf("bench-key-%010d", i)) }
+	for i := 0; i < opts.keys; i++ {
+		if err := bc.Put(benchKey(i), value); err != nil {
+			return nil, fmt.Errorf("预写入失败: %v", err)
+		}
+	}
+
+	// 按协程数量比例把操作分配给写协程和读协程，余数交给最后一个协程
+	writeOps := opts.ops * opts.writers / (opts.readers + opts.writers)
+	readOps := opts.ops - writeOps
+	split := func(total, workers, id int) int {
+		n := total / workers
+		if id == workers-1 {
+			n += total % workers
+		}
+		return n
+	}
+
+	workers := opts.readers + opts.writers
+	latencies := make([][]time.Duration, workers)
+	failures := make([]int, workers)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for id := 0; id < workers; id++ {
+		isWriter := id < opts.writers
+		var n int
+		if isWriter {
+			n = split(writeOps, opts.writers, id)
+		} else {
+			n = split(readOps, opts.readers, id-opts.writers)
+		}
+		wg.Add(1)
+		go func(id, n int, isWriter bool) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(opts.seed + int64(id) + 1))
+			samples := make([]time.Duration, 0, n)
+			for i := 0; i < n; i++ {
+				key := benchKey(rnd.Intn(opts.keys))
+				opStart := time.Now()
+				if isWriter {
+					if err := bc.Put(key, value); err != nil {
+						failures[id]++
+					}
+				} else if _, ok := bc.Get(key); !ok {
+					failures[id]++
+				}
+				samples = append(samples, time.Since(opStart))
+			}
+			latencies[id] = samples
+		}(id, n, isWriter)
+	}
+	wg.Wait()
+	result := &benchResult{elapsed: time.Since(start)}
+
+	put := &benchOpStats{name: "put"}
+	get := &benchOpStats{name: "get"}
+	for id := 0; id < workers; id++ {
+		s := get
+		if id < opts.writers {
+			s = put
+		}
+		s.latencies = append(s.latencies, latencies[id]...)
+		s.errors += failures[id]
+	}
+	for _, s := range []*benchOpStats{put, get} {
+		if len(s.latencies) == 0 {
+			continue
+		}
+		sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+		result.ops = append(result.ops, s)
+	}
+	return result, nil
+}
+
+// printBenchResult 以表格形式输出基准测试结果
+func printBenchResult(w io.Writer, opts benchOptions, result *benchResult) {
+	total := 0
+	for _, s := range result.ops {
+		total += len(s.latencies)
+	}
+	fmt.Fprintf(w, "ops=%d value-size=%d readers=%d writers=%d keys=%d elapsed=%s throughput=%.0f ops/s\n",
+		total, opts.valueSize, opts.readers, opts.writers, opts.keys,
+		result.elapsed.Round(time.Millisecond), float64(total)/result.elapsed.Seconds())
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "op\tcount\terrors\tops/s\tp50\tp95\tp99\tmax")
+	for _, s := range result.ops {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.0f\t%s\t%s\t%s\t%s\n",
+			s.name, len(s.latencies), s.errors, float64(len(s.latencies))/result.elapsed.Seconds(),
+			s.percentile(50), s.percentile(95), s.percentile(99), s.percentile(100))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunBench(t *testing.T) {
+	before, _ := filepath.Glob(filepath.Join(os.TempDir(), "bitcask-bench-*"))
+
+	opts := benchOptions{ops: 200, valueSize: 16, readers: 2, writers: 3, keys: 50, seed: 1}
+	result, err := runBench(opts)
+	if err != nil {
+		t.Fatalf("基准测试失败: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, s := range result.ops {
+		counts[s.name] = len(s.latencies)
+		if s.errors != 0 {
+			t.Fatalf("%s 不应该失败或未命中: %d", s.name, s.errors)
+		}
+		if s.percentile(50) > s.percentile(99) || s.percentile(99) > s.percentile(100) {
+			t.Fatalf("%s 的分位数应该单调递增", s.name)
+		}
+	}
+	if counts["put"] != 120 || counts["get"] != 80 {
+		t.Fatalf("操作数应按读写协程比例分配: %v", counts)
+	}
+
+	var out bytes.Buffer
+	printBenchResult(&out, opts, result)
+	if !strings.Contains(out.String(), "p99") || !strings.Contains(out.String(), "ops/s") {
+		t.Fatalf("输出缺少吞吐量或分位数: %s", out.String())
+	}
+
+	after, _ := filepath.Glob(filepath.Join(os.TempDir(), "bitcask-bench-*"))
+	if len(after) != len(before) {
+		t.Fatalf("临时目录没有被删除: %v", after)
+	}
+
+	if _, err := runBench(benchOptions{ops: 10, keys: 10}); err == nil {
+		t.Fatal("readers 和 writers 同时为0时应该返回错误")
+	}
+}
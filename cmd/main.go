@@ -2,12 +2,13 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 
 	"github.com/aixiasang/bitcask"
 	"github.com/aixiasang/bitcask/config"
@@ -24,6 +25,8 @@ var (
 	btreeOrder  int
 	autoSync    bool
 	debug       bool
+	strictCRC   bool
+	indexType   string
 )
 
 // rootCmd 表示没有子命令时调用的基础命令
@@ -37,7 +40,13 @@ var rootCmd = &cobra.Command{
   bitcask put mykey myvalue --data-dir ./mydata
   bitcask get mykey --data-dir ./mydata
   bitcask delete mykey --data-dir ./mydata
+  bitcask stats --data-dir ./mydata  # 查看存储统计信息
+  bitcask export --out dump.jsonl --data-dir ./mydata  # 导出所有键值对
+  bitcask import --in dump.jsonl --data-dir ./newdata  # 导入键值对
+  bitcask bench --ops 100000 --readers 4 --writers 4  # 对临时实例执行基准测试
+  bitcask verify --data-dir ./mydata  # 检查WAL文件是否损坏
   bitcask shell --data-dir ./mydata  # 进入交互式模式
+  bitcask watch user: --data-dir ./mydata  # 进入交互式模式并实时输出变更
   bitcask http --addr :8080 --data-dir ./mydata  # 启动HTTP服务
   bitcask sql "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"  # 执行SQL语句
   bitcask sqlshell  # 进入SQL交互式模式`,
@@ -54,10 +63,12 @@ func Execute() {
 func init() {
 	// 全局标志
 	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", "./data", "数据存储目录")
-	rootCmd.PersistentFlags().Uint32Var(&maxFileSize, "max-file-size", 1024, "数据文件最大大小(字节)")
+	rootCmd.PersistentFlags().Uint32Var(&maxFileSize, "max-file-size", 1024, "数据文件最大大小(字节)，必须大于0；默认值很小，生产环境建议调大")
 	rootCmd.PersistentFlags().IntVar(&btreeOrder, "btree-order", 128, "B树阶数")
 	rootCmd.PersistentFlags().BoolVar(&autoSync, "auto-sync", true, "自动同步写入")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "开启调试模式")
+	rootCmd.PersistentFlags().BoolVar(&strictCRC, "strict-crc", false, "WAL重放时CRC校验失败直接报错")
+	rootCmd.PersistentFlags().StringVar(&indexType, "index-type", "btree", "索引类型(btree、skiplist或hashmap)")
 
 	// 添加所有命令
 	rootCmd.AddCommand(getCmd)
@@ -67,11 +78,32 @@ func init() {
 	rootCmd.AddCommand(scanRangeCmd)
 	rootCmd.AddCommand(mergeCmd)
 	rootCmd.AddCommand(hintCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(benchCmd)
+	rootCmd.AddCommand(verifyCmd)
 	rootCmd.AddCommand(shellCmd)
+	rootCmd.AddCommand(watchCmd)
 
 	// 设置scanRange的limit标志
 	scanRangeCmd.Flags().IntVar(&scanLimit, "limit", 100, "最大扫描记录数")
 
+	// 设置stats的输出格式标志
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "以JSON格式输出")
+
+	// 设置export/import的文件标志
+	exportCmd.Flags().StringVar(&exportOut, "out", "", "导出文件路径，为空时输出到标准输出")
+	importCmd.Flags().StringVar(&importIn, "in", "", "导入文件路径，为空时从标准输入读取")
+
+	// 设置bench的参数标志
+	benchCmd.Flags().IntVar(&benchOpts.ops, "ops", 100000, "总操作数")
+	benchCmd.Flags().IntVar(&benchOpts.valueSize, "value-size", 128, "写入的值大小(字节)")
+	benchCmd.Flags().IntVar(&benchOpts.readers, "readers", 4, "执行Get的协程数")
+	benchCmd.Flags().IntVar(&benchOpts.writers, "writers", 4, "执行Put的协程数")
+	benchCmd.Flags().IntVar(&benchOpts.keys, "keys", 10000, "键空间大小，开始计时前预先写入")
+	benchCmd.Flags().Int64Var(&benchOpts.seed, "seed", 1, "随机数种子")
+
 	// 注册HTTP命令
 	http.RegisterCommand(rootCmd, createBitcask, &scanLimit)
 
@@ -90,32 +122,25 @@ func createBitcask() (*bitcask.Bitcask, error) {
 	conf.BTreeOrder = btreeOrder
 	conf.AutoSync = autoSync
 	conf.Debug = debug
+	conf.StrictCRC = strictCRC
+	switch strings.ToLower(indexType) {
+	case "btree":
+		conf.IndexType = config.IndexTypeBTree
+	case "skiplist":
+		conf.IndexType = config.IndexTypeSkipList
+	case "hashmap":
+		conf.IndexType = config.IndexTypeHashMap
+	default:
+		return nil, fmt.Errorf("未知的索引类型: %s", indexType)
+	}
 
 	// 创建数据目录
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, fmt.Errorf("创建数据目录失败: %v", err)
 	}
 
-	bc, err := bitcask.NewBitcask(conf)
-	if err != nil {
-		// 检查是否是hint文件导致的错误
-		if strings.Contains(err.Error(), "从hint文件加载索引失败") {
-			fmt.Println("警告: hint文件加载失败，将创建新的存储实例")
-
-			// 尝试删除可能损坏的hint文件
-			hintFile := filepath.Join(dataDir, "hint")
-			if _, err := os.Stat(hintFile); err == nil {
-				if err := os.Remove(hintFile); err != nil {
-					fmt.Printf("警告: 无法删除hint文件: %v\n", err)
-				}
-			}
-
-			// 重新尝试创建实例，但这次不会尝试加载hint文件
-			return bitcask.NewBitcask(conf)
-		}
-		return nil, err
-	}
-	return bc, nil
+	// hint文件损坏时 NewBitcask 会忽略它并回退到WAL重放
+	return bitcask.NewBitcask(conf)
 }
 
 // getCmd 表示 get 命令
@@ -178,10 +203,15 @@ var deleteCmd = &cobra.Command{
 		defer bc.Close()
 
 		key := []byte(args[0])
-		if err := bc.Delete(key); err != nil {
+		existed, err := bc.Delete(key)
+		if err != nil {
 			fmt.Printf("删除失败: %v\n", err)
 			return
 		}
+		if !existed {
+			fmt.Println("键不存在")
+			return
+		}
 		fmt.Println("删除成功")
 	},
 }
@@ -285,6 +315,194 @@ var hintCmd = &cobra.Command{
 	},
 }
 
+// verifyCmd 表示 verify 命令
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "检查所有WAL文件中的记录是否损坏",
+	Long: `读取每个WAL文件中的每条记录并重新计算CRC，列出所有损坏记录的文件ID和偏移量，不修改任何数据。
+启动时的重放遇到CRC错误只会忽略该文件的剩余部分，可以用该命令确认受影响的范围。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bc, err := createBitcask()
+		if err != nil {
+			fmt.Printf("创建 Bitcask 实例失败: %v\n", err)
+			return
+		}
+		defer bc.Close()
+
+		reports, err := bc.Verify()
+		if err != nil {
+			fmt.Printf("检查失败: %v\n", err)
+			return
+		}
+		if len(reports) == 0 {
+			fmt.Println("未发现损坏")
+			return
+		}
+		for _, r := range reports {
+			fmt.Printf("wal-%d.log offset=%d: %s\n", r.FileId, r.Offset, r.Reason)
+		}
+		fmt.Printf("共发现 %d 处损坏\n", len(reports))
+	},
+}
+
+// statsCmd 表示 stats 命令
+var (
+	statsJSON bool
+)
+
+// statsOutput stats 命令的JSON输出，字段名与HTTP接口 /api/admin/stats 一致
+type statsOutput struct {
+	KeyCount        int    `json:"key_count"`
+	WalFiles        int    `json:"wal_files"`
+	DiskSize        uint64 `json:"disk_size"`
+	ReclaimableSize uint64 `json:"reclaimable_size"`
+	ActiveFileId    uint32 `json:"active_file_id"`
+	TxnId           uint32 `json:"txn_id"`
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "查看存储统计信息",
+	Long: `打开实例并输出有效键数量、WAL文件数量、磁盘占用和可回收字节数，
+可据此判断是否需要执行 merge。使用 --json 输出便于脚本处理的格式。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bc, err := createBitcask()
+		if err != nil {
+			fmt.Printf("创建 Bitcask 实例失败: %v\n", err)
+			return
+		}
+		defer bc.Close()
+
+		stats, err := bc.Stats()
+		if err != nil {
+			fmt.Printf("获取统计信息失败: %v\n", err)
+			return
+		}
+
+		if statsJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(statsOutput{
+				KeyCount:        stats.Keys,
+				WalFiles:        stats.DataFiles,
+				DiskSize:        stats.DiskBytes,
+				ReclaimableSize: stats.ReclaimableBytes,
+				ActiveFileId:    stats.ActiveFileID,
+				TxnId:           stats.TxnID,
+			})
+			return
+		}
+
+		var reclaimable float64
+		if stats.DiskBytes > 0 {
+			reclaimable = float64(stats.ReclaimableBytes) / float64(stats.DiskBytes) * 100
+		}
+		// 标签使用 Stats 的字段名，避免中文宽度导致表格无法对齐
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "Keys\t%d\n", stats.Keys)
+		fmt.Fprintf(tw, "DataFiles\t%d\n", stats.DataFiles)
+		fmt.Fprintf(tw, "DiskBytes\t%s\n", formatBytes(stats.DiskBytes))
+		fmt.Fprintf(tw, "ReclaimableBytes\t%s (%.1f%%)\n", formatBytes(stats.ReclaimableBytes), reclaimable)
+		fmt.Fprintf(tw, "ActiveFileID\t%d\n", stats.ActiveFileID)
+		fmt.Fprintf(tw, "TxnID\t%d\n", stats.TxnID)
+		tw.Flush()
+	},
+}
+
+// formatBytes 将字节数格式化为带单位的字符串，同时保留原始字节数
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB (%d B)", float64(n)/float64(div), "KMGTPE"[exp], n)
+}
+
+// exportCmd 表示 export 命令
+var (
+	exportOut string
+	importIn  string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "导出所有 key-value 对为 JSON Lines 文件",
+	Long: `导出所有有效的 key-value 对，每行一个 {"key":...,"value":...} 对象，
+key 和 value 使用 base64 编码。导出格式与磁盘格式无关，可用于备份和迁移，不保留过期时间。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bc, err := createBitcask()
+		if err != nil {
+			fmt.Printf("创建 Bitcask 实例失败: %v\n", err)
+			return
+		}
+		defer bc.Close()
+
+		if exportOut == "" {
+			if _, err := bc.Export(os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "导出失败: %v\n", err)
+			}
+			return
+		}
+
+		f, err := os.Create(exportOut)
+		if err != nil {
+			fmt.Printf("创建导出文件失败: %v\n", err)
+			return
+		}
+		count, err := bc.Export(f)
+		if err == nil {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fmt.Printf("导出失败: %v\n", err)
+			return
+		}
+		fmt.Printf("共导出 %d 条记录到 %s\n", count, exportOut)
+	},
+}
+
+// importCmd 表示 import 命令
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "从 export 生成的文件导入 key-value 对",
+	Long: `读取 export 生成的 JSON Lines 文件并通过批处理写入，已存在的键会被覆盖。
+每个批处理最多包含 BatchSize 个键，出错时之前已提交的批次会保留。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		bc, err := createBitcask()
+		if err != nil {
+			fmt.Printf("创建 Bitcask 实例失败: %v\n", err)
+			return
+		}
+		defer bc.Close()
+
+		in := os.Stdin
+		if importIn != "" {
+			f, err := os.Open(importIn)
+			if err != nil {
+				fmt.Printf("打开导入文件失败: %v\n", err)
+				return
+			}
+			defer f.Close()
+			in = f
+		}
+
+		count, err := bc.Import(in)
+		if err != nil {
+			fmt.Printf("导入失败（已导入 %d 条记录）: %v\n", count, err)
+			return
+		}
+		fmt.Printf("共导入 %d 条记录\n", count)
+	},
+}
+
 // shellCmd 表示交互式命令行模式
 var shellCmd = &cobra.Command{
 	Use:   "shell",
@@ -297,178 +515,217 @@ var shellCmd = &cobra.Command{
   > put mykey newvalue
   > delete mykey
   > scan
+  > watch user: (实时输出以 user: 开头的键的变更)
   > quit 或 exit (退出交互式模式)
   > help (显示帮助信息)`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// 创建一个bitcask实例并保持打开状态
-		bc, err := createBitcask()
-		if err != nil {
-			fmt.Printf("创建 Bitcask 实例失败: %v\n", err)
-			return
-		}
+		runShell(nil)
+	},
+}
+
+// runShell 运行交互式模式，watchPrefix 不为nil时启动后立即输出以它开头的键的变更
+func runShell(watchPrefix *string) {
+	// 创建一个bitcask实例并保持打开状态
+	bc, err := createBitcask()
+	if err != nil {
+		fmt.Printf("创建 Bitcask 实例失败: %v\n", err)
+		return
+	}
 
-		// 设置一个通道，用于接收用户退出信号
-		exitChan := make(chan struct{})
-
-		// 设置信号处理
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-		// Windows下的信号处理需要在主goroutine中进行，
-		// 避免使用os.Exit直接退出，而是通过通道通知主循环结束
-		go func() {
-			<-sigChan
-			fmt.Println("\n接收到中断信号，正在安全关闭...")
-			// 通知主循环退出
-			close(exitChan)
-		}()
-
-		// 确保程序结束时关闭实例
-		defer func() {
-			signal.Stop(sigChan)
-			bc.Close()
-			fmt.Println("已安全关闭 Bitcask 实例")
-		}()
-
-		fmt.Println("Bitcask 交互式模式已启动。输入 'help' 查看可用命令，输入 'exit' 或 'quit' 退出。")
-		fmt.Println("按 Ctrl+C 可安全退出程序。")
-		fmt.Print("> ")
-
-		// 启动一个单独的goroutine来读取用户输入
-		inputChan := make(chan string)
-		go func() {
-			scanner := bufio.NewScanner(os.Stdin)
-			for scanner.Scan() {
-				input := scanner.Text()
-				inputChan <- input
+	// 停止输出变更的函数，没有开启 watch 时为nil
+	var stopWatch func()
+	if watchPrefix != nil {
+		stopWatch = startWatch(bc, []byte(*watchPrefix), os.Stdout)
+	}
+
+	// 设置一个通道，用于接收用户退出信号
+	exitChan := make(chan struct{})
+
+	// 设置信号处理
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	// Windows下的信号处理需要在主goroutine中进行，
+	// 避免使用os.Exit直接退出，而是通过通道通知主循环结束
+	go func() {
+		<-sigChan
+		fmt.Println("\n接收到中断信号，正在安全关闭...")
+		// 通知主循环退出
+		close(exitChan)
+	}()
+
+	// 确保程序结束时关闭实例
+	defer func() {
+		signal.Stop(sigChan)
+		if stopWatch != nil {
+			stopWatch()
+		}
+		bc.Close()
+		fmt.Println("已安全关闭 Bitcask 实例")
+	}()
+
+	fmt.Println("Bitcask 交互式模式已启动。输入 'help' 查看可用命令，输入 'exit' 或 'quit' 退出。")
+	fmt.Println("按 Ctrl+C 可安全退出程序。")
+	fmt.Print("> ")
+
+	// 启动一个单独的goroutine来读取用户输入
+	inputChan := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			input := scanner.Text()
+			inputChan <- input
+		}
+		// 如果scanner.Scan()返回false，可能是因为标准输入被关闭
+		if err := scanner.Err(); err != nil {
+			fmt.Printf("\n读取输入错误: %v\n", err)
+		}
+		close(inputChan)
+	}()
+
+	// 主循环
+	for {
+		select {
+		case <-exitChan:
+			// 接收到退出信号
+			return
+		case input, ok := <-inputChan:
+			// 接收到用户输入或输入通道关闭
+			if !ok {
+				// 输入通道已关闭
+				return
 			}
-			// 如果scanner.Scan()返回false，可能是因为标准输入被关闭
-			if err := scanner.Err(); err != nil {
-				fmt.Printf("\n读取输入错误: %v\n", err)
+
+			input = strings.TrimSpace(input)
+
+			if input == "" {
+				fmt.Print("> ")
+				continue
 			}
-			close(inputChan)
-		}()
-
-		// 主循环
-		for {
-			select {
-			case <-exitChan:
-				// 接收到退出信号
+
+			tokens := strings.Fields(input)
+			command := tokens[0]
+			cmdArgs := tokens[1:]
+
+			switch strings.ToLower(command) {
+			case "exit", "quit":
+				fmt.Println("再见!")
 				return
-			case input, ok := <-inputChan:
-				// 接收到用户输入或输入通道关闭
+			case "help":
+				printShellHelp()
+			case "get":
+				if len(cmdArgs) != 1 {
+					fmt.Println("用法: get [key]")
+					break
+				}
+				key := []byte(cmdArgs[0])
+				value, ok := bc.Get(key)
 				if !ok {
-					// 输入通道已关闭
-					return
+					fmt.Printf("获取值失败: %v\n", err)
+				} else {
+					fmt.Printf("%s\n", value)
 				}
-
-				input = strings.TrimSpace(input)
-
-				if input == "" {
-					fmt.Print("> ")
-					continue
+			case "put":
+				if len(cmdArgs) < 2 {
+					fmt.Println("用法: put [key] [value]")
+					break
 				}
+				key := []byte(cmdArgs[0])
+				// 将剩余的所有token作为value，支持带空格的值
+				value := []byte(strings.Join(cmdArgs[1:], " "))
+				if err := bc.Put(key, value); err != nil {
+					fmt.Printf("存储值失败: %v\n", err)
+				} else {
+					fmt.Println("存储成功")
+				}
+			case "delete":
+				if len(cmdArgs) != 1 {
+					fmt.Println("用法: delete [key]")
+					break
+				}
+				key := []byte(cmdArgs[0])
+				if existed, err := bc.Delete(key); err != nil {
+					fmt.Printf("删除失败: %v\n", err)
+				} else if !existed {
+					fmt.Println("键不存在")
+				} else {
+					fmt.Println("删除成功")
+				}
+			case "scan":
+				count := 0
+				err = bc.Scan(func(key []byte, value []byte) error {
+					fmt.Printf("Key: %s, Value: %s\n", key, value)
+					count++
+					return nil
+				})
+				if err != nil {
+					fmt.Printf("扫描失败: %v\n", err)
+				} else {
+					fmt.Printf("共扫描到 %d 条记录\n", count)
+				}
+			case "scanrange":
+				if len(cmdArgs) < 2 {
+					fmt.Println("用法: scanrange [startKey] [endKey] [limit]")
+					break
+				}
+				startKey := []byte(cmdArgs[0])
+				endKey := []byte(cmdArgs[1])
+				limit := scanLimit // 使用全局scanLimit
 
-				tokens := strings.Fields(input)
-				command := tokens[0]
-				cmdArgs := tokens[1:]
-
-				switch strings.ToLower(command) {
-				case "exit", "quit":
-					fmt.Println("再见!")
-					return
-				case "help":
-					printShellHelp()
-				case "get":
-					if len(cmdArgs) != 1 {
-						fmt.Println("用法: get [key]")
-						break
-					}
-					key := []byte(cmdArgs[0])
-					value, ok := bc.Get(key)
-					if !ok {
-						fmt.Printf("获取值失败: %v\n", err)
-					} else {
-						fmt.Printf("%s\n", value)
-					}
-				case "put":
-					if len(cmdArgs) < 2 {
-						fmt.Println("用法: put [key] [value]")
-						break
-					}
-					key := []byte(cmdArgs[0])
-					// 将剩余的所有token作为value，支持带空格的值
-					value := []byte(strings.Join(cmdArgs[1:], " "))
-					if err := bc.Put(key, value); err != nil {
-						fmt.Printf("存储值失败: %v\n", err)
-					} else {
-						fmt.Println("存储成功")
-					}
-				case "delete":
-					if len(cmdArgs) != 1 {
-						fmt.Println("用法: delete [key]")
-						break
-					}
-					key := []byte(cmdArgs[0])
-					if err := bc.Delete(key); err != nil {
-						fmt.Printf("删除失败: %v\n", err)
-					} else {
-						fmt.Println("删除成功")
-					}
-				case "scan":
-					count := 0
-					err = bc.Scan(func(key []byte, value []byte) error {
-						fmt.Printf("Key: %s, Value: %s\n", key, value)
-						count++
-						return nil
-					})
-					if err != nil {
-						fmt.Printf("扫描失败: %v\n", err)
-					} else {
-						fmt.Printf("共扫描到 %d 条记录\n", count)
-					}
-				case "scanrange":
-					if len(cmdArgs) < 2 {
-						fmt.Println("用法: scanrange [startKey] [endKey] [limit]")
-						break
-					}
-					startKey := []byte(cmdArgs[0])
-					endKey := []byte(cmdArgs[1])
-					limit := scanLimit // 使用全局scanLimit
-
-					if len(cmdArgs) > 2 {
-						fmt.Sscanf(cmdArgs[2], "%d", &limit)
-					}
+				if len(cmdArgs) > 2 {
+					fmt.Sscanf(cmdArgs[2], "%d", &limit)
+				}
 
-					results, err := bc.ScanRangeLimit(startKey, endKey, limit)
-					if err != nil && err != bitcask.ErrReachLimit && err != bitcask.ErrExceedEndRange {
-						fmt.Printf("范围扫描失败: %v\n", err)
-					} else {
-						for _, result := range results {
-							fmt.Printf("Key: %s, Value: %s\n", result.Key, result.Value)
-						}
-						fmt.Printf("共扫描到 %d 条记录\n", len(results))
-					}
-				case "merge":
-					if err := bc.Merge(); err != nil {
-						fmt.Printf("合并失败: %v\n", err)
-					} else {
-						fmt.Println("合并成功")
-					}
-				case "hint":
-					if err := bc.Hint(); err != nil {
-						fmt.Printf("生成 hint 文件失败: %v\n", err)
-					} else {
-						fmt.Println("生成 hint 文件成功")
+				results, err := bc.ScanRangeLimit(startKey, endKey, limit)
+				if err != nil && err != bitcask.ErrReachLimit && err != bitcask.ErrExceedEndRange {
+					fmt.Printf("范围扫描失败: %v\n", err)
+				} else {
+					for _, result := range results {
+						fmt.Printf("Key: %s, Value: %s\n", result.Key, result.Value)
 					}
-				default:
-					fmt.Printf("未知命令: %s\n", command)
-					fmt.Println("输入 'help' 查看可用命令")
+					fmt.Printf("共扫描到 %d 条记录\n", len(results))
 				}
-				fmt.Print("> ")
+			case "merge":
+				if err := bc.Merge(); err != nil {
+					fmt.Printf("合并失败: %v\n", err)
+				} else {
+					fmt.Println("合并成功")
+				}
+			case "hint":
+				if err := bc.Hint(); err != nil {
+					fmt.Printf("生成 hint 文件失败: %v\n", err)
+				} else {
+					fmt.Println("生成 hint 文件成功")
+				}
+			case "watch":
+				if len(cmdArgs) > 1 {
+					fmt.Println("用法: watch [prefix]")
+					break
+				}
+				prefix := ""
+				if len(cmdArgs) == 1 {
+					prefix = cmdArgs[0]
+				}
+				if stopWatch != nil {
+					stopWatch()
+				}
+				stopWatch = startWatch(bc, []byte(prefix), os.Stdout)
+				fmt.Printf("开始输出以 %q 开头的键的变更\n", prefix)
+			case "unwatch":
+				if stopWatch == nil {
+					fmt.Println("没有开启 watch")
+					break
+				}
+				stopWatch()
+				stopWatch = nil
+				fmt.Println("已停止输出变更")
+			default:
+				fmt.Printf("未知命令: %s\n", command)
+				fmt.Println("输入 'help' 查看可用命令")
 			}
+			fmt.Print("> ")
 		}
-	},
+	}
 }
 
 // 打印交互式模式的帮助信息
@@ -481,6 +738,8 @@ func printShellHelp() {
 	fmt.Println("  scanrange [start] [end]   - 扫描指定范围内的 key-value 对")
 	fmt.Println("  merge                     - 合并数据文件，删除过时记录")
 	fmt.Println("  hint                      - 生成 hint 文件，加速下次启动")
+	fmt.Println("  watch [prefix]            - 实时输出以 prefix 开头的键的变更")
+	fmt.Println("  unwatch                   - 停止输出变更")
 	fmt.Println("  help                      - 显示此帮助信息")
 	fmt.Println("  exit, quit                - 退出交互式模式")
 	fmt.Println("")
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/aixiasang/bitcask"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [prefix]",
+	Short: "进入交互式模式并实时输出变更",
+	Long: `进入交互式模式（与 shell 命令相同），并实时输出之后每次写入和删除的键，
+指定 prefix 时只输出以 prefix 开头的键。交互式模式中也可以用 watch/unwatch 命令开启或关闭输出。
+
+数据目录同一时间只能被一个进程打开，因此只能观察到本进程（交互式命令，或者从标准输入
+管道传入的命令）产生的变更。
+
+示例:
+  bitcask watch user: --data-dir ./mydata
+  printf 'put user:1 alice\ndelete user:1\n' | bitcask watch --data-dir ./mydata`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		prefix := ""
+		if len(args) > 0 {
+			prefix = args[0]
+		}
+		runShell(&prefix)
+	},
+}
+
+// startWatch 订阅 bc 的变更，把以 prefix 开头的键的事件写入 w，返回停止输出的函数
+func startWatch(bc *bitcask.Bitcask, prefix []byte, w io.Writer) func() {
+	events, cancel := bc.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ev := range events {
+			if ev.Dropped > 0 {
+				fmt.Fprintf(w, "[watch] 输出太慢，丢弃了 %d 个事件\n", ev.Dropped)
+			}
+			if bytes.HasPrefix(ev.Key, prefix) {
+				fmt.Fprintln(w, formatEvent(ev))
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// formatEvent 将变更事件格式化为一行
+func formatEvent(ev bitcask.Event) string {
+	if ev.Type == bitcask.EventDelete {
+		return fmt.Sprintf("[%s] %s", ev.Type, ev.Key)
+	}
+	return fmt.Sprintf("[%s] %s = %s", ev.Type, ev.Key, ev.Value)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"testing"
+
+	"github.com/aixiasang/bitcask"
+	"github.com/aixiasang/bitcask/config"
+)
+
+func TestStartWatch(t *testing.T) {
+	conf := config.NewConfig()
+	conf.DataDir = t.TempDir()
+	conf.Debug = false
+	bc, err := bitcask.NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建 Bitcask 实例失败: %v", err)
+	}
+	defer bc.Close()
+
+	r, w := io.Pipe()
+	defer r.Close()
+	stop := startWatch(bc, []byte("user:"), w)
+	defer stop()
+	if err := bc.Put([]byte("user:1"), []byte("alice")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := bc.Put([]byte("order:1"), []byte("book")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if _, err := bc.Delete([]byte("user:1")); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	// 不以 prefix 开头的键被过滤
+	scanner := bufio.NewScanner(r)
+	for _, want := range []string{"[put] user:1 = alice", "[delete] user:1"} {
+		if !scanner.Scan() {
+			t.Fatalf("读取输出失败: %v", scanner.Err())
+		}
+		if got := scanner.Text(); got != want {
+			t.Fatalf("输出不正确: 期望 %q, 实际 %q", want, got)
+		}
+	}
+}
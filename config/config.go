@@ -1,38 +1,127 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidConfig 配置校验失败，具体原因通过 %w 包装在错误信息中
+var ErrInvalidConfig = errors.New("invalid config")
+
+// 键和值大小的默认上限，也是旧版本重放WAL时判断数据损坏使用的固定上限
+const (
+	DefaultMaxKeySize   = 10 * 1024 * 1024
+	DefaultMaxValueSize = 100 * 1024 * 1024
+)
+
 // 索引类型
 type IndexType uint8
 
 const (
 	IndexTypeBTree    IndexType = iota // B树索引
 	IndexTypeSkipList                  // 跳表索引
+	IndexTypeHashMap                   // 哈希索引，仅适合点查
+)
+
+// 压缩类型
+type CompressionType uint8
+
+const (
+	CompressionNone   CompressionType = iota // 不压缩
+	CompressionSnappy                        // Snappy 压缩 value
 )
 
 // 配置
 type Config struct {
-	DataDir     string    // 数据目录
-	IndexType   IndexType // 索引类型
-	AutoSync    bool      // 自动同步
-	BTreeOrder  int       // B树的阶数
-	MaxFileSize uint32    // 最大文件大小
-	WalDir      string    // WAL 目录
-	HintDir     string    // hint 文件目录
-	LoadHint    bool      // 是否加载 hint 文件
-	BatchSize   int       // 批处理大小
-	Debug       bool      // 是否开启调试模式
+	DataDir             string          // 数据目录
+	IndexType           IndexType       // 索引类型
+	AutoSync            bool            // 自动同步
+	BTreeOrder          int             // B树的阶数
+	MaxFileSize         uint32          // 最大文件大小
+	WalDir              string          // WAL 目录
+	HintDir             string          // hint 文件目录
+	BlobDir             string          // blob 文件目录
+	BlobThreshold       uint32          // value 超过该字节数时单独写入 blob 文件，WAL 中只保存位置；为0表示不分离
+	LoadHint            bool            // 是否加载 hint 文件
+	HintOnClose         bool            // 关闭时索引有变化是否重新生成 hint 文件
+	ReadOnly            bool            // 只读模式：持有共享锁，不创建或修改任何文件，写入返回 ErrReadOnly
+	BatchSize           int             // 单个批处理最多包含的键数量（含）
+	MaxKeySize          uint32          // 单个键的最大字节数（含），超过时写入返回 ErrKeyTooLarge
+	MaxValueSize        uint32          // 单个值的最大字节数（含），超过时写入返回 ErrValueTooLarge
+	BatchMaxBytes       int64           // 单个批处理中键和值的总字节数上限（含），为0表示不限制
+	Debug               bool            // 是否开启调试模式
+	StrictCRC           bool            // 重放WAL时CRC校验失败是否直接报错
+	ReplayWorkers       int             // 启动时并行解析WAL文件的协程数，为0时使用 GOMAXPROCS，为1时逐个文件解析
+	SyncInterval        time.Duration   // 后台同步间隔，仅在关闭 AutoSync 时生效
+	Compression         CompressionType // value 压缩方式，key 始终不压缩
+	EncryptionKey       []byte          // AES-GCM 密钥（16/24/32字节），为空表示不加密；key 不加密
+	ExpireSweepInterval time.Duration   // 后台清理过期键的间隔，为0时仅在读取和 Merge 时处理
+	Logger              Logger          // 日志输出，为nil时不输出；调试日志只在 Debug 开启时输出
 }
 
 func NewConfig() *Config {
 	return &Config{
-		DataDir:     "./data",
-		IndexType:   IndexTypeBTree,
-		AutoSync:    true,
-		BTreeOrder:  128,
-		MaxFileSize: 1024,
-		WalDir:      "wal",
-		HintDir:     "hint",
-		LoadHint:    true,
-		Debug:       true,
-		BatchSize:   200,
+		DataDir:      "./data",
+		IndexType:    IndexTypeBTree,
+		AutoSync:     true,
+		BTreeOrder:   128,
+		MaxFileSize:  1024,
+		WalDir:       "wal",
+		HintDir:      "hint",
+		BlobDir:      "blob",
+		LoadHint:     true,
+		HintOnClose:  true,
+		Debug:        true,
+		BatchSize:    200,
+		MaxKeySize:   DefaultMaxKeySize,
+		MaxValueSize: DefaultMaxValueSize,
+		Logger:       defaultLogger,
+	}
+}
+
+// Validate 检查配置是否合法，NewBitcask 在创建任何文件之前调用
+func (c *Config) Validate() error {
+	switch {
+	case c.DataDir == "":
+		return fmt.Errorf("%w: DataDir 不能为空", ErrInvalidConfig)
+	case c.WalDir == "":
+		return fmt.Errorf("%w: WalDir 不能为空", ErrInvalidConfig)
+	case c.HintDir == "":
+		return fmt.Errorf("%w: HintDir 不能为空", ErrInvalidConfig)
+	case c.BlobThreshold > 0 && c.BlobDir == "":
+		return fmt.Errorf("%w: 开启 BlobThreshold 时 BlobDir 不能为空", ErrInvalidConfig)
+	case c.MaxFileSize == 0:
+		return fmt.Errorf("%w: MaxFileSize 必须大于0", ErrInvalidConfig)
+	case c.MaxKeySize == 0:
+		return fmt.Errorf("%w: MaxKeySize 必须大于0", ErrInvalidConfig)
+	case c.MaxValueSize == 0:
+		return fmt.Errorf("%w: MaxValueSize 必须大于0", ErrInvalidConfig)
+	case c.BTreeOrder < 2:
+		// google/btree 的阶数小于2时会直接 panic；备份时总是使用B树索引，因此不区分索引类型
+		return fmt.Errorf("%w: BTreeOrder 必须不小于2, 当前为 %d", ErrInvalidConfig, c.BTreeOrder)
+	case c.IndexType > IndexTypeHashMap:
+		return fmt.Errorf("%w: 未知的索引类型 %d", ErrInvalidConfig, c.IndexType)
+	case c.BatchSize <= 0:
+		return fmt.Errorf("%w: BatchSize 必须大于0, 当前为 %d", ErrInvalidConfig, c.BatchSize)
+	case c.BatchMaxBytes < 0:
+		return fmt.Errorf("%w: BatchMaxBytes 不能为负数, 当前为 %d", ErrInvalidConfig, c.BatchMaxBytes)
+	case c.ReplayWorkers < 0:
+		return fmt.Errorf("%w: ReplayWorkers 不能为负数, 当前为 %d", ErrInvalidConfig, c.ReplayWorkers)
+	case c.SyncInterval < 0:
+		return fmt.Errorf("%w: SyncInterval 不能为负数, 当前为 %s", ErrInvalidConfig, c.SyncInterval)
+	case c.ExpireSweepInterval < 0:
+		return fmt.Errorf("%w: ExpireSweepInterval 不能为负数, 当前为 %s", ErrInvalidConfig, c.ExpireSweepInterval)
+	case c.Compression > CompressionSnappy:
+		return fmt.Errorf("%w: 未知的压缩类型 %d", ErrInvalidConfig, c.Compression)
+	case !c.LoadHint && !c.HintOnClose:
+		// 不重放WAL时索引只来自hint文件，关闭时不生成hint会丢失本次会话的写入
+		return fmt.Errorf("%w: 关闭 LoadHint 时必须开启 HintOnClose", ErrInvalidConfig)
+	}
+	switch len(c.EncryptionKey) {
+	case 0, 16, 24, 32:
+	default:
+		return fmt.Errorf("%w: EncryptionKey 长度必须为16、24或32字节, 当前为 %d", ErrInvalidConfig, len(c.EncryptionKey))
 	}
+	return nil
 }
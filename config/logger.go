@@ -0,0 +1,63 @@
+package config
+
+import (
+	"io"
+	"log"
+	"os"
+)
+
+// Logger 存储引擎的日志接口，通过 Config.Logger 接入应用自己的日志系统
+type Logger interface {
+	Debugf(format string, args ...any) // 调试信息，只在 Config.Debug 开启时输出
+	Infof(format string, args ...any)  // 启动、生成hint文件等常规信息
+	Warnf(format string, args ...any)  // 数据损坏、后台任务失败等需要关注的情况
+}
+
+// NopLogger 丢弃所有日志
+type NopLogger struct{}
+
+func (NopLogger) Debugf(string, ...any) {}
+func (NopLogger) Infof(string, ...any)  {}
+func (NopLogger) Warnf(string, ...any)  {}
+
+// stdLogger 基于标准库 log 的日志实现，每条日志带有级别前缀
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger 创建输出到 w 的日志，NewConfig 默认输出到标准错误
+func NewStdLogger(w io.Writer) Logger {
+	return stdLogger{l: log.New(w, "bitcask ", log.LstdFlags)}
+}
+
+// defaultLogger NewConfig 使用的默认日志，输出到标准错误
+var defaultLogger = NewStdLogger(os.Stderr)
+
+func (s stdLogger) Debugf(format string, args ...any) { s.l.Printf("[DEBUG] "+format, args...) }
+func (s stdLogger) Infof(format string, args ...any)  { s.l.Printf("[INFO] "+format, args...) }
+func (s stdLogger) Warnf(format string, args ...any)  { s.l.Printf("[WARN] "+format, args...) }
+
+// logger 返回配置的日志，未设置时不输出
+func (c *Config) logger() Logger {
+	if c.Logger == nil {
+		return NopLogger{}
+	}
+	return c.Logger
+}
+
+// Debugf 在开启 Debug 时输出调试日志
+func (c *Config) Debugf(format string, args ...any) {
+	if c.Debug {
+		c.logger().Debugf(format, args...)
+	}
+}
+
+// Infof 输出常规日志
+func (c *Config) Infof(format string, args ...any) {
+	c.logger().Infof(format, args...)
+}
+
+// Warnf 输出警告日志
+func (c *Config) Warnf(format string, args ...any) {
+	c.logger().Warnf(format, args...)
+}
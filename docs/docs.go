@@ -17,6 +17,11 @@ const docTemplate = `{
     "paths": {
         "/admin/hint": {
             "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "生成hint文件，加速下次启动",
                 "produces": [
                     "text/plain"
@@ -43,6 +48,11 @@ const docTemplate = `{
         },
         "/admin/merge": {
             "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "合并数据文件，删除过时记录",
                 "produces": [
                     "text/plain"
@@ -67,9 +77,105 @@ const docTemplate = `{
                 }
             }
         },
+        "/admin/stats": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "返回有效键数量、WAL文件数量、磁盘占用、可回收字节数和活跃文件ID，可据此决定何时执行合并",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "获取统计信息",
+                "responses": {
+                    "200": {
+                        "description": "统计信息",
+                        "schema": {
+                            "$ref": "#/definitions/http.StatsResult"
+                        }
+                    },
+                    "500": {
+                        "description": "获取统计信息失败",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/batch": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "通过一个Batch原子地执行多个写入和删除，要么全部生效要么全部不生效；先执行puts再执行deletes",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "keys"
+                ],
+                "summary": "批量写入和删除",
+                "parameters": [
+                    {
+                        "enum": [
+                            "base64"
+                        ],
+                        "type": "string",
+                        "description": "puts中值的编码方式",
+                        "name": "encoding",
+                        "in": "query"
+                    },
+                    {
+                        "description": "批量操作",
+                        "name": "batch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "批处理已提交",
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "请求错误，批处理未提交",
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "提交失败，批处理未提交",
+                        "schema": {
+                            "$ref": "#/definitions/http.BatchResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/keys": {
             "get": {
-                "description": "获取系统中所有键值对",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "获取系统中所有键值对，值为base64编码，二进制数据不会损坏。指定cursor或limit时按索引顺序分页返回KeysPage，\n将上一页的next_cursor作为cursor获取下一页，遍历期间写入的键是否出现取决于其在索引中的位置",
                 "produces": [
                     "application/json"
                 ],
@@ -77,9 +183,23 @@ const docTemplate = `{
                     "keys"
                 ],
                 "summary": "列出所有键值对",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "上一页返回的next_cursor，为空时从第一个键开始",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "每页最大数量，默认为全局扫描限制",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "键值对列表",
+                        "description": "键值对列表，指定cursor或limit时为KeysPage",
                         "schema": {
                             "type": "array",
                             "items": {
@@ -87,6 +207,12 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "400": {
+                        "description": "无效的cursor或limit",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "扫描失败",
                         "schema": {
@@ -98,7 +224,12 @@ const docTemplate = `{
         },
         "/keys/range/{start}/{end}": {
             "get": {
-                "description": "查询指定键范围内的键值对",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "查询指定键范围内的键值对，值为base64编码",
                 "produces": [
                     "application/json"
                 ],
@@ -150,12 +281,18 @@ const docTemplate = `{
         },
         "/keys/{key}": {
             "get": {
-                "description": "获取存储在系统中的指定key的值",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "获取存储在系统中的指定key的值，Accept为application/octet-stream时以二进制返回，encoding=base64时返回base64编码的值",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
-                    "text/plain"
+                    "text/plain",
+                    "application/octet-stream"
                 ],
                 "tags": [
                     "keys"
@@ -168,6 +305,15 @@ const docTemplate = `{
                         "name": "key",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "enum": [
+                            "base64"
+                        ],
+                        "type": "string",
+                        "description": "值的编码方式",
+                        "name": "encoding",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -177,6 +323,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "400": {
+                        "description": "不支持的编码",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "获取值失败",
                         "schema": {
@@ -186,9 +338,15 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "存储或更新键值对",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "存储或更新键值对，请求体按原样存储，encoding=base64时先进行base64解码；指定ttl时键在过期后视为不存在",
                 "consumes": [
-                    "text/plain"
+                    "text/plain",
+                    "application/octet-stream"
                 ],
                 "produces": [
                     "text/plain"
@@ -205,6 +363,21 @@ const docTemplate = `{
                         "in": "path",
                         "required": true
                     },
+                    {
+                        "enum": [
+                            "base64"
+                        ],
+                        "type": "string",
+                        "description": "请求体的编码方式",
+                        "name": "encoding",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "过期时间，Go时长格式（如30s、5m）或整数秒",
+                        "name": "ttl",
+                        "in": "query"
+                    },
                     {
                         "description": "存储的值",
                         "name": "value",
@@ -237,6 +410,11 @@ const docTemplate = `{
                 }
             },
             "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "description": "从系统中删除指定的键值对",
                 "produces": [
                     "text/plain"
@@ -269,9 +447,151 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/keys/{key}/ttl": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "与Redis的TTL一致，返回四舍五入后的剩余秒数，key永不过期返回-1，key不存在或已过期返回-2",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "keys"
+                ],
+                "summary": "获取key的剩余过期时间",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "查询的键名",
+                        "name": "key",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "剩余秒数",
+                        "schema": {
+                            "type": "integer"
+                        }
+                    },
+                    "500": {
+                        "description": "获取过期时间失败",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sql": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "解析并执行一条SQL语句，返回列名和行；非查询语句返回空的columns和rows",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sql"
+                ],
+                "summary": "执行SQL语句",
+                "parameters": [
+                    {
+                        "description": "SQL语句",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/http.SQLRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "执行结果",
+                        "schema": {
+                            "$ref": "#/definitions/sql.QueryResult"
+                        }
+                    },
+                    "400": {
+                        "description": "请求体无效、SQL解析失败或为事务语句",
+                        "schema": {
+                            "$ref": "#/definitions/http.SQLError"
+                        }
+                    },
+                    "500": {
+                        "description": "SQL执行失败",
+                        "schema": {
+                            "$ref": "#/definitions/http.SQLError"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
+        "http.BatchOpResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "op": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "http.BatchRequest": {
+            "type": "object",
+            "properties": {
+                "deletes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "puts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/http.KVPair"
+                    }
+                }
+            }
+        },
+        "http.BatchResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/http.BatchOpResult"
+                    }
+                },
+                "success": {
+                    "type": "boolean"
+                }
+            }
+        },
         "http.KVPair": {
             "type": "object",
             "properties": {
@@ -293,6 +613,81 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "http.SQLError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                }
+            }
+        },
+        "http.SQLRequest": {
+            "type": "object",
+            "properties": {
+                "sql": {
+                    "type": "string"
+                }
+            }
+        },
+        "http.StatsResult": {
+            "type": "object",
+            "properties": {
+                "active_file_id": {
+                    "description": "活跃WAL文件的ID",
+                    "type": "integer"
+                },
+                "disk_size": {
+                    "description": "WAL文件的总字节数",
+                    "type": "integer"
+                },
+                "key_count": {
+                    "description": "有效键数量",
+                    "type": "integer"
+                },
+                "reclaimable_size": {
+                    "description": "可以被合并回收的字节数",
+                    "type": "integer"
+                },
+                "txn_id": {
+                    "description": "下一个批处理使用的事务ID",
+                    "type": "integer"
+                },
+                "wal_files": {
+                    "description": "WAL文件数量，包含活跃文件",
+                    "type": "integer"
+                }
+            }
+        },
+        "sql.QueryResult": {
+            "type": "object",
+            "properties": {
+                "columns": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "rows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/sql.Row"
+                    }
+                }
+            }
+        },
+        "sql.Row": {
+            "type": "object",
+            "additionalProperties": {
+                "type": "string"
+            }
+        }
+    },
+    "securityDefinitions": {
+        "BearerAuth": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -50,23 +50,28 @@ func main() {
 		return
 	}
 
-	// Example 2: Insert data
+	// Example 2: Insert data with a prepared statement; the values are bound
+	// to the ? placeholders, so names may contain quotes
 	fmt.Println("Inserting employees...")
-	employees := []string{
-		"INSERT INTO employees (id, name, position, salary) VALUES (1, 'John Doe', 'Engineer', 85000)",
-		"INSERT INTO employees (id, name, position, salary) VALUES (2, 'Jane Smith', 'Manager', 110000)",
-		"INSERT INTO employees (id, name, position, salary) VALUES (3, 'Alice Brown', 'Designer', 75000)",
-		"INSERT INTO employees (id, name, position, salary) VALUES (4, 'Bob Johnson', 'Developer', 90000)",
+	insert, err := executor.Prepare("INSERT INTO employees (id, name, position, salary) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		fmt.Printf("Prepare error: %v\n", err)
+		return
+	}
+	employees := []struct {
+		id       int
+		name     string
+		position string
+		salary   int
+	}{
+		{1, "John Doe", "Engineer", 85000},
+		{2, "Jane Smith", "Manager", 110000},
+		{3, "Alice Brown", "Designer", 75000},
+		{4, "Bob O'Brien", "Developer", 90000},
 	}
 
-	for _, insertSQL := range employees {
-		node, err := sql.Parse(insertSQL)
-		if err != nil {
-			fmt.Printf("Parse error: %v\n", err)
-			return
-		}
-		_, err = executor.Execute(node)
-		if err != nil {
+	for _, emp := range employees {
+		if _, err := insert.Execute(emp.id, emp.name, emp.position, emp.salary); err != nil {
 			fmt.Printf("Execute error: %v\n", err)
 			return
 		}
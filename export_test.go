@@ -0,0 +1,124 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aixiasang/bitcask/utils"
+)
+
+func TestBitcask_ExportImport(t *testing.T) {
+	srcDir, cleanupSrc := setupTestDir(t)
+	defer cleanupSrc()
+	dstDir, cleanupDst := setupTestDir(t)
+	defer cleanupDst()
+
+	conf := getTestConfig(srcDir)
+	conf.Debug = false
+	src, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer src.Close()
+
+	// 键数量超过 BatchSize，导入时需要分多个批处理提交
+	want := make(map[string][]byte)
+	const total = 450
+	for i := 0; i < total; i++ {
+		key, value := utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))
+		if err := src.Put(key, value); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+		want[string(key)] = value
+	}
+	// 二进制数据和空值
+	binary := []byte{0x00, 0xff, '\n', '"', 0x80, 0x01}
+	if err := src.Put([]byte{0x01, 0x00, 0xfe}, binary); err != nil {
+		t.Fatalf("写入二进制数据失败: %v", err)
+	}
+	want["\x01\x00\xfe"] = binary
+	if err := src.Put([]byte("empty"), []byte{}); err != nil {
+		t.Fatalf("写入空值失败: %v", err)
+	}
+	want["empty"] = []byte{}
+	// 删除的键不应被导出
+	if _, err := src.Delete(utils.GetKey(0)); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	delete(want, string(utils.GetKey(0)))
+
+	var dump bytes.Buffer
+	exported, err := src.Export(&dump)
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	if exported != len(want) {
+		t.Fatalf("导出数量不正确: 期望 %d, 实际 %d", len(want), exported)
+	}
+	if lines := strings.Count(dump.String(), "\n"); lines != len(want) {
+		t.Fatalf("导出应为每行一条记录: 期望 %d 行, 实际 %d 行", len(want), lines)
+	}
+
+	dstConf := getTestConfig(dstDir)
+	dstConf.Debug = false
+	dst, err := NewBitcask(dstConf)
+	if err != nil {
+		t.Fatalf("创建目标数据库失败: %v", err)
+	}
+	defer dst.Close()
+
+	imported, err := dst.Import(&dump)
+	if err != nil {
+		t.Fatalf("导入失败: %v", err)
+	}
+	if imported != len(want) {
+		t.Fatalf("导入数量不正确: 期望 %d, 实际 %d", len(want), imported)
+	}
+
+	got := make(map[string][]byte)
+	if err := dst.Scan(func(key []byte, value []byte) error {
+		got[string(key)] = append([]byte{}, value...)
+		return nil
+	}); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("导入后的键数量不正确: 期望 %d, 实际 %d", len(want), len(got))
+	}
+	for key, value := range want {
+		if !bytes.Equal(got[key], value) {
+			t.Fatalf("键 %q 的值不一致: 期望 %v, 实际 %v", key, value, got[key])
+		}
+	}
+}
+
+func TestBitcask_ImportInvalid(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	input := `{"key":"YQ==","value":"MQ=="}` + "\n" + `{"key":"YQ==",` + "\n"
+	imported, err := db.Import(strings.NewReader(input))
+	if err == nil {
+		t.Fatal("格式错误的导入数据应该返回错误")
+	}
+	if imported != 0 {
+		t.Fatalf("出错的批次不应被计入: %d", imported)
+	}
+	if _, ok := db.Get([]byte("a")); ok {
+		t.Fatal("出错的批次不应被提交")
+	}
+
+	if _, err := db.Import(strings.NewReader(`{"value":"MQ=="}`)); err == nil {
+		t.Fatal("key 为空的记录应该返回错误")
+	}
+}
@@ -3,6 +3,7 @@ module github.com/aixiasang/bitcask
 go 1.24.0
 
 require (
+	github.com/golang/snappy v0.0.4
 	github.com/google/btree v1.1.3
 	github.com/stretchr/testify v1.10.0
 )
@@ -2,6 +2,7 @@ package http
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/aixiasang/bitcask"
 	"github.com/spf13/cobra"
@@ -9,7 +10,9 @@ import (
 
 var (
 	// HTTP服务标志
-	httpAddr string
+	httpAddr            string
+	httpShutdownTimeout time.Duration
+	httpToken           string
 )
 
 // RegisterCommand 向Cobra CLI添加HTTP命令
@@ -21,12 +24,23 @@ func RegisterCommand(rootCmd *cobra.Command, createBitcaskFn func() (*bitcask.Bi
 
 REST API端点:
   GET    /api/keys/{key}         - 获取指定key的值
-  PUT    /api/keys/{key}         - 设置key的值 (请求体为值内容)
+  PUT    /api/keys/{key}         - 设置key的值 (请求体为值内容，?ttl=30s 设置过期时间)
   DELETE /api/keys/{key}         - 删除指定key
-  GET    /api/keys               - 列出所有键值对
-  GET    /api/keys/range/{start}/{end} - 范围查询
+  GET    /api/keys/{key}/ttl     - 剩余过期秒数 (永不过期-1，不存在-2)
+  GET    /api/keys               - 列出所有键值对 (值为base64编码，?limit=N&cursor= 分页)
+  GET    /api/keys/range/{start}/{end} - 范围查询 (值为base64编码)
+  POST   /api/batch              - 批量写入和删除，整个批处理原子提交
+  POST   /api/sql                - 执行SQL语句 (请求体 {"sql":"SELECT ..."}，返回columns和rows)
   POST   /api/admin/merge        - 执行合并操作
-  POST   /api/admin/hint         - 生成hint文件`,
+  POST   /api/admin/hint         - 生成hint文件
+  GET    /api/admin/stats        - 统计信息 (键数量、WAL文件数、磁盘占用、可回收字节数)
+  GET    /metrics                - Prometheus 格式的运行指标
+
+二进制值: PUT 的请求体按原样存储；GET 时 Accept: application/octet-stream
+以二进制返回；GET/PUT/batch 加 ?encoding=base64 时值使用base64编码
+
+认证: 指定 --http-token 后 /api 下的请求需要携带 Authorization: Bearer <token>，
+否则返回401；/swagger 和 /metrics 不需要认证`,
 		Run: func(cmd *cobra.Command, args []string) {
 			// 创建一个bitcask实例并保持打开状态
 			bc, err := createBitcaskFn()
@@ -38,8 +52,10 @@ REST API端点:
 
 			// 创建并启动HTTP服务器
 			server := NewServer(bc, httpAddr, *scanLimit)
+			server.SetShutdownTimeout(httpShutdownTimeout)
+			server.AuthToken = httpToken
 
-			// 启动服务器并阻塞
+			// 启动服务器并阻塞，返回时处理中的请求已经完成，之后再关闭 Bitcask
 			if err := server.Start(); err != nil {
 				fmt.Printf("HTTP服务错误: %v\n", err)
 			}
@@ -48,6 +64,8 @@ REST API端点:
 
 	// 添加HTTP特定的标志
 	httpCmd.Flags().StringVar(&httpAddr, "addr", ":8080", "HTTP服务监听地址")
+	httpCmd.Flags().StringVar(&httpToken, "http-token", "", "访问 /api 需要的Bearer令牌，为空时不校验")
+	httpCmd.Flags().DurationVar(&httpShutdownTimeout, "shutdown-timeout", DefaultShutdownTimeout, "关闭服务时等待处理中请求完成的最长时间")
 
 	// 将命令添加到根命令
 	rootCmd.AddCommand(httpCmd)
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 操作耗时直方图的桶边界（秒）
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// 写入值大小直方图的桶边界（字节）
+var valueSizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// 耗时直方图中的操作名称
+const (
+	opGet    = "get"
+	opPut    = "put"
+	opDelete = "delete"
+	opBatch  = "batch"
+	opMerge  = "merge"
+)
+
+// histogram Prometheus 直方图，counts 记录落在每个桶中的次数（不累计）
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// observe 记录一次观测值，超过最大桶边界的值只计入 +Inf
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write 以文本格式输出直方图的各个桶、总和与次数，labels 为空或形如 `op="get",`
+func (h *histogram) write(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, labels, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+	if labels != "" {
+		labels = "{" + labels[:len(labels)-1] + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metrics HTTP服务的运行指标，通过 /metrics 以 Prometheus 文本格式导出
+type metrics struct {
+	puts      atomic.Uint64 // 写入的键数量，包含批处理中的写入
+	gets      atomic.Uint64 // 读取次数
+	getMisses atomic.Uint64 // 读取时键不存在的次数
+	deletes   atomic.Uint64 // 删除的键数量，包含批处理中的删除
+	merges    atomic.Uint64 // 合并次数
+
+	latency   map[string]*histogram // 按操作区分的耗时
+	valueSize *histogram            // 写入的值大小
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		latency:   make(map[string]*histogram),
+		valueSize: newHistogram(valueSizeBuckets),
+	}
+	for _, op := range []string{opGet, opPut, opDelete, opBatch, opMerge} {
+		m.latency[op] = newHistogram(latencyBuckets)
+	}
+	return m
+}
+
+// observeLatency 记录一次操作从 start 开始的耗时
+func (m *metrics) observeLatency(op string, start time.Time) {
+	m.latency[op].observe(time.Since(start).Seconds())
+}
+
+// write 以 Prometheus 文本格式输出所有指标
+func (m *metrics) write(w io.Writer) {
+	counters := []struct {
+		name  string
+		help  string
+		value uint64
+	}{
+		{"bitcask_puts_total", "写入的键数量", m.puts.Load()},
+		{"bitcask_gets_total", "读取次数", m.gets.Load()},
+		{"bitcask_get_misses_total", "读取时键不存在的次数", m.getMisses.Load()},
+		{"bitcask_deletes_total", "删除的键数量", m.deletes.Load()},
+		{"bitcask_merges_total", "合并次数", m.merges.Load()},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.value)
+	}
+
+	const latencyName = "bitcask_operation_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s 操作耗时\n# TYPE %s histogram\n", latencyName, latencyName)
+	for _, op := range []string{opGet, opPut, opDelete, opBatch, opMerge} {
+		m.latency[op].write(w, latencyName, fmt.Sprintf("op=%q,", op))
+	}
+
+	const sizeName = "bitcask_value_size_bytes"
+	fmt.Fprintf(w, "# HELP %s 写入的值大小\n# TYPE %s histogram\n", sizeName, sizeName)
+	m.valueSize.write(w, sizeName, "")
+}
+
+// handleMetrics 以 Prometheus 文本格式导出运行指标
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.write(w)
+}
@@ -1,18 +1,28 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/aixiasang/bitcask"
 	_ "github.com/aixiasang/bitcask/docs" // 导入Swagger文档
+	"github.com/aixiasang/bitcask/sql"
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
@@ -21,14 +31,33 @@ import (
 // @version 1.0
 // @description Bitcask的RESTful API服务
 // @BasePath /api
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description 服务配置了令牌时需要，格式为 "Bearer <token>"
+
+// DefaultShutdownTimeout 默认的优雅关闭超时时间
+const DefaultShutdownTimeout = 30 * time.Second
 
 // Server 表示HTTP服务器实例
 type Server struct {
-	bc        *bitcask.Bitcask
-	addr      string
-	server    *http.Server
-	router    *mux.Router
-	scanLimit int
+	bc              *bitcask.Bitcask
+	addr            string
+	server          *http.Server
+	router          *mux.Router
+	scanLimit       int
+	metrics         *metrics
+	shutdownTimeout time.Duration
+
+	sqlExec *sql.Executor
+	sqlMu   sync.Mutex // SQL语句逐条执行，避免并发的写入破坏唯一性检查和索引
+
+	// AuthToken 不为空时，所有 /api 下的请求都需要携带 Authorization: Bearer <AuthToken>
+	AuthToken string
+
+	stopOnce sync.Once
+	stopped  chan struct{} // Stop 完成后关闭
+	stopErr  error
 }
 
 // NewServer 创建新的HTTP服务器实例
@@ -37,20 +66,38 @@ func NewServer(bc *bitcask.Bitcask, addr string, scanLimit int) *Server {
 		bc:        bc,
 		addr:      addr,
 		scanLimit: scanLimit,
+		metrics:   newMetrics(),
+
+		shutdownTimeout: DefaultShutdownTimeout,
+		sqlExec:         sql.NewExecutor(bc),
+		stopped:         make(chan struct{}),
 	}
 
 	// 初始化路由
 	s.setupRouter()
 
+	s.server = &http.Server{
+		Addr:         addr,
+		Handler:      s.router,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
 	return s
 }
 
+// SetShutdownTimeout 设置优雅关闭时等待处理中请求完成的最长时间，需要在 Stop 之前调用
+func (s *Server) SetShutdownTimeout(timeout time.Duration) {
+	s.shutdownTimeout = timeout
+}
+
 // setupRouter 设置路由
 func (s *Server) setupRouter() {
 	router := mux.NewRouter()
 
 	// API路由
 	apiRouter := router.PathPrefix("/api").Subrouter()
+	apiRouter.Use(s.authMiddleware)
 
 	// 键值操作API
 	keyRouter := apiRouter.PathPrefix("/keys").Subrouter()
@@ -64,12 +111,21 @@ func (s *Server) setupRouter() {
 	// 删除指定key
 	keyRouter.HandleFunc("/{key}", s.handleDeleteKey).Methods("DELETE")
 
+	// 获取key的剩余过期时间
+	keyRouter.HandleFunc("/{key}/ttl", s.handleGetTTL).Methods("GET")
+
 	// 列出所有键值对
 	keyRouter.HandleFunc("", s.handleListKeys).Methods("GET")
 
 	// 范围查询
 	keyRouter.HandleFunc("/range/{start}/{end}", s.handleRangeQuery).Methods("GET")
 
+	// 批量写入和删除
+	apiRouter.HandleFunc("/batch", s.handleBatch).Methods("POST")
+
+	// 执行SQL语句
+	apiRouter.HandleFunc("/sql", s.handleSQL).Methods("POST")
+
 	// 管理员操作API
 	adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
 
@@ -79,6 +135,12 @@ func (s *Server) setupRouter() {
 	// 生成hint文件
 	adminRouter.HandleFunc("/hint", s.handleHint).Methods("POST")
 
+	// 获取统计信息
+	adminRouter.HandleFunc("/stats", s.handleStats).Methods("GET")
+
+	// Prometheus指标
+	router.HandleFunc("/metrics", s.handleMetrics).Methods("GET")
+
 	// 添加Swagger文档路由
 	router.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"), // The URL pointing to API definition
@@ -107,44 +169,114 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// 中间件：配置了 AuthToken 时校验 Bearer 令牌，Swagger 文档和 /metrics 不受影响
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.AuthToken != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.AuthToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="bitcask"`)
+				http.Error(w, "未授权", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// encodingBase64 通过 ?encoding=base64 指定请求或响应中的值为base64编码
+const encodingBase64 = "base64"
+
+// valueEncoding 返回请求指定的值编码方式，不支持的编码返回错误
+func valueEncoding(r *http.Request) (string, error) {
+	encoding := r.URL.Query().Get("encoding")
+	if encoding != "" && encoding != encodingBase64 {
+		return "", fmt.Errorf("不支持的编码: %s", encoding)
+	}
+	return encoding, nil
+}
+
+// decodeValue 按编码方式解码请求中的值
+func decodeValue(value []byte, encoding string) ([]byte, error) {
+	if encoding != encodingBase64 {
+		return value, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(value))
+	if err != nil {
+		return nil, fmt.Errorf("base64解码失败: %v", err)
+	}
+	return decoded, nil
+}
+
 // @Summary 获取指定key的值
-// @Description 获取存储在系统中的指定key的值
+// @Description 获取存储在系统中的指定key的值，Accept为application/octet-stream时以二进制返回，encoding=base64时返回base64编码的值
 // @Tags keys
 // @Accept json
-// @Produce text/plain
+// @Produce text/plain,application/octet-stream
 // @Param key path string true "查询的键名"
+// @Param encoding query string false "值的编码方式" Enums(base64)
 // @Success 200 {string} string "键值内容"
+// @Failure 400 {string} string "不支持的编码"
 // @Failure 404 {string} string "获取值失败"
+// @Security BearerAuth
 // @Router /keys/{key} [get]
 func (s *Server) handleGetKey(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := []byte(vars["key"])
 
+	encoding, err := valueEncoding(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
 	value, ok := s.bc.Get(key)
+	s.metrics.observeLatency(opGet, start)
+	s.metrics.gets.Add(1)
 	if !ok {
+		s.metrics.getMisses.Add(1)
 		http.Error(w, "获取值失败", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
-	w.Write(value)
+	switch {
+	case encoding == encodingBase64:
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, base64.StdEncoding.EncodeToString(value))
+	case strings.Contains(r.Header.Get("Accept"), "application/octet-stream"):
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(value)
+	default:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(value)
+	}
 }
 
 // @Summary 设置key的值
-// @Description 存储或更新键值对
+// @Description 存储或更新键值对，请求体按原样存储，encoding=base64时先进行base64解码；指定ttl时键在过期后视为不存在
 // @Tags keys
-// @Accept text/plain
+// @Accept text/plain,application/octet-stream
 // @Produce text/plain
 // @Param key path string true "设置的键名"
+// @Param encoding query string false "请求体的编码方式" Enums(base64)
+// @Param ttl query string false "过期时间，Go时长格式（如30s、5m）或整数秒"
 // @Param value body string true "存储的值"
 // @Success 200 {string} string "存储成功"
 // @Failure 400 {string} string "请求错误"
 // @Failure 500 {string} string "存储失败"
+// @Security BearerAuth
 // @Router /keys/{key} [put]
 func (s *Server) handlePutKey(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := []byte(vars["key"])
 
+	encoding, err := valueEncoding(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// 读取请求体作为值
 	value, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -153,15 +285,84 @@ func (s *Server) handlePutKey(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	if err := s.bc.Put(key, value); err != nil {
+	if value, err = decodeValue(value, encoding); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if ttlStr := r.URL.Query().Get("ttl"); ttlStr != "" {
+		if ttl, err = parseTTL(ttlStr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	start := time.Now()
+	if ttl > 0 {
+		err = s.bc.PutWithTTL(key, value, ttl)
+	} else {
+		err = s.bc.Put(key, value)
+	}
+	s.metrics.observeLatency(opPut, start)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("存储值失败: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.metrics.puts.Add(1)
+	s.metrics.valueSize.observe(float64(len(value)))
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprint(w, "存储成功")
 }
 
+// parseTTL 解析ttl参数，支持Go时长格式（如30s、5m）或整数秒
+func parseTTL(s string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(s)
+	if err != nil {
+		seconds, convErr := strconv.ParseInt(s, 10, 64)
+		if convErr != nil {
+			return 0, fmt.Errorf("无效的ttl: %s", s)
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("ttl必须为正数: %s", s)
+	}
+	return ttl, nil
+}
+
+// @Summary 获取key的剩余过期时间
+// @Description 与Redis的TTL一致，返回四舍五入后的剩余秒数，key永不过期返回-1，key不存在或已过期返回-2
+// @Tags keys
+// @Produce text/plain
+// @Param key path string true "查询的键名"
+// @Success 200 {integer} integer "剩余秒数"
+// @Failure 500 {string} string "获取过期时间失败"
+// @Security BearerAuth
+// @Router /keys/{key}/ttl [get]
+func (s *Server) handleGetTTL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := []byte(vars["key"])
+
+	var seconds int64
+	ttl, hasTTL, err := s.bc.TTL(key)
+	switch {
+	case errors.Is(err, bitcask.ErrKeyNotFound) || errors.Is(err, bitcask.ErrKeyHasDeleted):
+		seconds = -2
+	case err != nil:
+		http.Error(w, fmt.Sprintf("获取过期时间失败: %v", err), http.StatusInternalServerError)
+		return
+	case !hasTTL:
+		seconds = -1
+	default:
+		seconds = (ttl.Milliseconds() + 500) / 1000
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, seconds)
+}
+
 // @Summary 删除指定key
 // @Description 从系统中删除指定的键值对
 // @Tags keys
@@ -169,41 +370,63 @@ func (s *Server) handlePutKey(w http.ResponseWriter, r *http.Request) {
 // @Param key path string true "要删除的键名"
 // @Success 200 {string} string "删除成功"
 // @Failure 500 {string} string "删除失败"
+// @Security BearerAuth
 // @Router /keys/{key} [delete]
 func (s *Server) handleDeleteKey(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := []byte(vars["key"])
 
-	if err := s.bc.Delete(key); err != nil {
+	start := time.Now()
+	_, err := s.bc.Delete(key)
+	s.metrics.observeLatency(opDelete, start)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("删除失败: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.metrics.deletes.Add(1)
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprint(w, "删除成功")
 }
 
-// KVPair 用于JSON序列化的键值对结构
+// KVPair 用于JSON序列化的键值对结构，列表和范围查询返回的 Value 为base64编码
 type KVPair struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 }
 
+// KeysPage 分页列出键值对的结果，NextCursor 为空表示已经遍历结束
+type KeysPage struct {
+	Items      []KVPair `json:"items"`
+	NextCursor string   `json:"next_cursor"`
+}
+
 // @Summary 列出所有键值对
-// @Description 获取系统中所有键值对
+// @Description 获取系统中所有键值对，值为base64编码，二进制数据不会损坏。指定cursor或limit时按索引顺序分页返回KeysPage，
+// @Description 将上一页的next_cursor作为cursor获取下一页，遍历期间写入的键是否出现取决于其在索引中的位置
 // @Tags keys
 // @Produce json
-// @Success 200 {array} KVPair "键值对列表"
+// @Param cursor query string false "上一页返回的next_cursor，为空时从第一个键开始"
+// @Param limit query int false "每页最大数量，默认为全局扫描限制"
+// @Success 200 {array} KVPair "键值对列表，指定cursor或limit时为KeysPage"
+// @Failure 400 {string} string "无效的cursor或limit"
 // @Failure 500 {string} string "扫描失败"
+// @Security BearerAuth
 // @Router /keys [get]
 func (s *Server) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Has("cursor") || query.Has("limit") {
+		s.listKeysPage(w, query.Get("cursor"), query.Get("limit"))
+		return
+	}
+
 	// 收集所有键值对
 	var results []KVPair
 
 	err := s.bc.Scan(func(key []byte, value []byte) error {
 		results = append(results, KVPair{
 			Key:   string(key),
-			Value: string(value),
+			Value: base64.StdEncoding.EncodeToString(value),
 		})
 		return nil
 	})
@@ -218,14 +441,65 @@ func (s *Server) handleListKeys(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(results)
 }
 
-// RangeQueryResult 范围查询结果
+// listKeysPage 从 cursor 之后开始按索引顺序返回最多 limit 个键值对，
+// cursor 为上一页最后一个键的base64编码，因此分页结果与索引顺序一致且互不重叠
+func (s *Server) listKeysPage(w http.ResponseWriter, cursor, limitStr string) {
+	limit := s.scanLimit
+	if limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("无效的limit: %s", limitStr), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var last []byte
+	if cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(decoded) == 0 {
+			http.Error(w, fmt.Sprintf("无效的cursor: %s", cursor), http.StatusBadRequest)
+			return
+		}
+		last = decoded
+	}
+
+	iter := s.bc.NewIterator()
+	defer iter.Close()
+	if last != nil {
+		// 从上一页的最后一个键之后继续
+		iter.Seek(last)
+		if iter.Valid() && bytes.Equal(iter.Key(), last) {
+			iter.Next()
+		}
+	}
+
+	page := KeysPage{Items: make([]KVPair, 0, limit)}
+	for ; iter.Valid() && len(page.Items) < limit; iter.Next() {
+		page.Items = append(page.Items, KVPair{
+			Key:   string(iter.Key()),
+			Value: base64.StdEncoding.EncodeToString(iter.Value()),
+		})
+	}
+	if err := iter.Err(); err != nil {
+		http.Error(w, fmt.Sprintf("扫描失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// 还有剩余的键时才返回下一页的cursor，避免最后多请求一个空页
+	if iter.Valid() && len(page.Items) > 0 {
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(page.Items[len(page.Items)-1].Key))
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// RangeQueryResult 范围查询结果，Value 为base64编码
 type RangeQueryResult struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 }
 
 // @Summary 范围查询键值对
-// @Description 查询指定键范围内的键值对
+// @Description 查询指定键范围内的键值对，值为base64编码
 // @Tags keys
 // @Produce json
 // @Param start path string true "起始键"
@@ -233,6 +507,7 @@ type RangeQueryResult struct {
 // @Param limit query int false "最大返回数量" default(100)
 // @Success 200 {array} RangeQueryResult "范围内的键值对"
 // @Failure 500 {string} string "范围扫描失败"
+// @Security BearerAuth
 // @Router /keys/range/{start}/{end} [get]
 func (s *Server) handleRangeQuery(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -257,7 +532,7 @@ func (s *Server) handleRangeQuery(w http.ResponseWriter, r *http.Request) {
 	for i, result := range results {
 		jsonResults[i] = RangeQueryResult{
 			Key:   string(result.Key),
-			Value: string(result.Value),
+			Value: base64.StdEncoding.EncodeToString(result.Value),
 		}
 	}
 
@@ -266,18 +541,256 @@ func (s *Server) handleRangeQuery(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(jsonResults)
 }
 
+// BatchRequest 批量操作请求体，先执行 puts 再执行 deletes
+type BatchRequest struct {
+	Puts    []KVPair `json:"puts"`
+	Deletes []string `json:"deletes"`
+}
+
+// 批量操作中单个操作的状态
+const (
+	BatchStatusOK       = "ok"        // 操作已提交
+	BatchStatusNotFound = "not_found" // 删除的键不存在，不影响批处理提交
+	BatchStatusInvalid  = "invalid"   // 操作参数错误，整个批处理被拒绝
+	BatchStatusAborted  = "aborted"   // 批处理未提交，操作没有生效
+)
+
+// BatchOpResult 批量操作中单个操作的结果
+type BatchOpResult struct {
+	Op     string `json:"op"`
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchResponse 批量操作的结果，success 为 false 时所有操作都没有生效
+type BatchResponse struct {
+	Success bool            `json:"success"`
+	Error   string          `json:"error,omitempty"`
+	Results []BatchOpResult `json:"results"`
+}
+
+// @Summary 批量写入和删除
+// @Description 通过一个Batch原子地执行多个写入和删除，要么全部生效要么全部不生效；先执行puts再执行deletes
+// @Tags keys
+// @Accept json
+// @Produce json
+// @Param encoding query string false "puts中值的编码方式" Enums(base64)
+// @Param batch body BatchRequest true "批量操作"
+// @Success 200 {object} BatchResponse "批处理已提交"
+// @Failure 400 {object} BatchResponse "请求错误，批处理未提交"
+// @Failure 500 {object} BatchResponse "提交失败，批处理未提交"
+// @Security BearerAuth
+// @Router /batch [post]
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	encoding, err := valueEncoding(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req BatchRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("解析请求体失败: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	resp := BatchResponse{Results: make([]BatchOpResult, 0, len(req.Puts)+len(req.Deletes))}
+	for _, kv := range req.Puts {
+		resp.Results = append(resp.Results, BatchOpResult{Op: "put", Key: kv.Key, Status: BatchStatusOK})
+	}
+	for _, key := range req.Deletes {
+		resp.Results = append(resp.Results, BatchOpResult{Op: "delete", Key: key, Status: BatchStatusOK})
+	}
+
+	// 校验失败或提交失败时，所有未标记错误的操作都视为未生效
+	fail := func(code int, msg string) {
+		resp.Success = false
+		resp.Error = msg
+		for i := range resp.Results {
+			if resp.Results[i].Status != BatchStatusInvalid {
+				resp.Results[i].Status = BatchStatusAborted
+			}
+		}
+		writeJSON(w, code, resp)
+	}
+
+	if len(resp.Results) == 0 {
+		fail(http.StatusBadRequest, "批处理中没有操作")
+		return
+	}
+	invalid := false
+	values := make([][]byte, len(req.Puts))
+	for i, kv := range req.Puts {
+		if values[i], err = decodeValue([]byte(kv.Value), encoding); err != nil {
+			resp.Results[i].Status = BatchStatusInvalid
+			resp.Results[i].Error = err.Error()
+			invalid = true
+		}
+	}
+	for i := range resp.Results {
+		if resp.Results[i].Key == "" {
+			resp.Results[i].Status = BatchStatusInvalid
+			resp.Results[i].Error = "键不能为空"
+			invalid = true
+		}
+	}
+	if invalid {
+		fail(http.StatusBadRequest, "批处理中包含无效的操作")
+		return
+	}
+
+	batch := bitcask.NewBatch(s.bc)
+	if len(resp.Results) > batch.Limit() {
+		fail(http.StatusBadRequest, fmt.Sprintf("批处理包含 %d 个操作，超过限制 %d", len(resp.Results), batch.Limit()))
+		return
+	}
+	// 暂存失败（例如 value 超过 MaxValueSize）时标记该操作并拒绝整个批处理
+	for i, kv := range req.Puts {
+		if err := batch.Put([]byte(kv.Key), values[i]); err != nil {
+			resp.Results[i].Status = BatchStatusInvalid
+			resp.Results[i].Error = err.Error()
+			invalid = true
+		}
+	}
+	for i, key := range req.Deletes {
+		result := &resp.Results[len(req.Puts)+i]
+		if err := batch.Delete([]byte(key)); err != nil {
+			result.Status = BatchStatusInvalid
+			result.Error = err.Error()
+			invalid = true
+			continue
+		}
+		// 键不存在时删除不会写入任何记录，只在结果中标记
+		if _, ok := s.bc.Get([]byte(key)); !ok && !putsKey(req.Puts, key) {
+			result.Status = BatchStatusNotFound
+		}
+	}
+	if invalid {
+		fail(http.StatusBadRequest, "批处理中包含无效的操作")
+		return
+	}
+	start := time.Now()
+	err = batch.Commit()
+	s.metrics.observeLatency(opBatch, start)
+	if errors.Is(err, bitcask.ErrBatchTooManyBytes) {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		fail(http.StatusInternalServerError, fmt.Sprintf("提交批处理失败: %v", err))
+		return
+	}
+	s.metrics.puts.Add(uint64(len(req.Puts)))
+	s.metrics.deletes.Add(uint64(len(req.Deletes)))
+	for _, value := range values {
+		s.metrics.valueSize.observe(float64(len(value)))
+	}
+
+	resp.Success = true
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// putsKey 判断批处理的写入中是否包含指定的键
+func putsKey(puts []KVPair, key string) bool {
+	for _, kv := range puts {
+		if kv.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON 以指定状态码返回JSON响应
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// SQLRequest SQL请求体
+type SQLRequest struct {
+	SQL string `json:"sql"`
+}
+
+// SQLError SQL解析或执行失败时的响应
+type SQLError struct {
+	Error string `json:"error"`
+}
+
+// @Summary 执行SQL语句
+// @Description 解析并执行一条SQL语句，返回列名和行；非查询语句返回空的columns和rows
+// @Tags sql
+// @Accept json
+// @Produce json
+// @Param request body SQLRequest true "SQL语句"
+// @Success 200 {object} sql.QueryResult "执行结果"
+// @Failure 400 {object} SQLError "请求体无效、SQL解析失败或为事务语句"
+// @Failure 500 {object} SQLError "SQL执行失败"
+// @Security BearerAuth
+// @Router /sql [post]
+func (s *Server) handleSQL(w http.ResponseWriter, r *http.Request) {
+	var req SQLRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, SQLError{Error: fmt.Sprintf("解析请求体失败: %v", err)})
+		return
+	}
+	if strings.TrimSpace(req.SQL) == "" {
+		writeJSON(w, http.StatusBadRequest, SQLError{Error: "sql不能为空"})
+		return
+	}
+
+	node, err := sql.Parse(req.SQL)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, SQLError{Error: fmt.Sprintf("SQL解析错误: %v", err)})
+		return
+	}
+	// 所有请求共用同一个执行器，一个客户端开启的事务会包含其他客户端的写入，因此不支持事务语句
+	if _, ok := node.(sql.TransactionNode); ok {
+		writeJSON(w, http.StatusBadRequest, SQLError{Error: "HTTP接口不支持事务语句，每条语句单独提交"})
+		return
+	}
+
+	s.sqlMu.Lock()
+	result, err := s.sqlExec.Execute(node)
+	s.sqlMu.Unlock()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, SQLError{Error: fmt.Sprintf("SQL执行错误: %v", err)})
+		return
+	}
+
+	// 保证 columns 和 rows 总是数组，方便客户端处理
+	if result.Columns == nil {
+		result.Columns = []string{}
+	}
+	if result.Rows == nil {
+		result.Rows = []sql.Row{}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
 // @Summary 执行合并操作
 // @Description 合并数据文件，删除过时记录
 // @Tags admin
 // @Produce text/plain
 // @Success 200 {string} string "合并成功"
 // @Failure 500 {string} string "合并失败"
+// @Security BearerAuth
 // @Router /admin/merge [post]
 func (s *Server) handleMerge(w http.ResponseWriter, r *http.Request) {
-	if err := s.bc.Merge(); err != nil {
+	start := time.Now()
+	err := s.bc.Merge()
+	s.metrics.observeLatency(opMerge, start)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("合并失败: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.metrics.merges.Add(1)
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprint(w, "合并成功")
@@ -289,6 +802,7 @@ func (s *Server) handleMerge(w http.ResponseWriter, r *http.Request) {
 // @Produce text/plain
 // @Success 200 {string} string "生成hint文件成功"
 // @Failure 500 {string} string "生成hint文件失败"
+// @Security BearerAuth
 // @Router /admin/hint [post]
 func (s *Server) handleHint(w http.ResponseWriter, r *http.Request) {
 	if err := s.bc.Hint(); err != nil {
@@ -300,29 +814,64 @@ func (s *Server) handleHint(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "生成hint文件成功")
 }
 
-// Start 启动HTTP服务
+// StatsResult 存储引擎的统计信息
+type StatsResult struct {
+	KeyCount        int    `json:"key_count"`        // 有效键数量
+	WalFiles        int    `json:"wal_files"`        // WAL文件数量，包含活跃文件
+	DiskSize        int64  `json:"disk_size"`        // WAL文件的总字节数
+	ReclaimableSize int64  `json:"reclaimable_size"` // 可以被合并回收的字节数
+	ActiveFileId    uint32 `json:"active_file_id"`   // 活跃WAL文件的ID
+	TxnId           uint32 `json:"txn_id"`           // 下一个批处理使用的事务ID
+}
+
+// @Summary 获取统计信息
+// @Description 返回有效键数量、WAL文件数量、磁盘占用、可回收字节数和活跃文件ID，可据此决定何时执行合并
+// @Tags admin
+// @Produce json
+// @Success 200 {object} StatsResult "统计信息"
+// @Failure 500 {string} string "获取统计信息失败"
+// @Security BearerAuth
+// @Router /admin/stats [get]
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.bc.Stats()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("获取统计信息失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, StatsResult{
+		KeyCount:        stats.Keys,
+		WalFiles:        stats.DataFiles,
+		DiskSize:        int64(stats.DiskBytes),
+		ReclaimableSize: int64(stats.ReclaimableBytes),
+		ActiveFileId:    stats.ActiveFileID,
+		TxnId:           stats.TxnID,
+	})
+}
+
+// Start 启动HTTP服务，收到中断信号或调用 Stop 后，等待处理中的请求完成才返回，
+// 之后调用方可以安全地关闭 Bitcask
 func (s *Server) Start() error {
-	// 创建HTTP服务器
-	s.server = &http.Server{
-		Addr:         s.addr,
-		Handler:      s.router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("HTTP服务错误: %v", err)
 	}
 
 	// 设置信号处理
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
 	// 优雅关闭服务
 	go func() {
-		<-sigChan
-		fmt.Println("\n接收到中断信号，正在优雅关闭服务...")
-
-		// 关闭服务器
-		s.server.Close()
-
-		// 服务器已经关闭，程序将自动退出
+		select {
+		case <-sigChan:
+			fmt.Println("\n接收到中断信号，正在优雅关闭服务...")
+			if err := s.Stop(); err != nil {
+				fmt.Printf("关闭HTTP服务失败: %v\n", err)
+			}
+		case <-s.stopped:
+		}
 	}()
 
 	// 启动HTTP服务
@@ -330,17 +879,29 @@ func (s *Server) Start() error {
 	fmt.Printf("Swagger文档地址: http://localhost%s/swagger/index.html\n", s.addr)
 	fmt.Println("按 Ctrl+C 可安全退出服务")
 
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	return s.serve(ln)
+}
+
+// serve 在 ln 上处理请求，直到 Stop 完成
+func (s *Server) serve(ln net.Listener) error {
+	if err := s.server.Serve(ln); err != http.ErrServerClosed {
 		return fmt.Errorf("HTTP服务错误: %v", err)
 	}
-
-	return nil
+	// Shutdown 调用后 Serve 立即返回，需要等待处理中的请求完成
+	<-s.stopped
+	return s.stopErr
 }
 
-// Stop 停止HTTP服务
+// Stop 停止接收新连接并等待处理中的请求完成，超过 shutdownTimeout 时强制关闭所有连接
 func (s *Server) Stop() error {
-	if s.server != nil {
-		return s.server.Close()
-	}
-	return nil
+	s.stopOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		defer cancel()
+		if err := s.server.Shutdown(ctx); err != nil {
+			s.server.Close()
+			s.stopErr = fmt.Errorf("等待请求完成超时，已强制关闭: %v", err)
+		}
+		close(s.stopped)
+	})
+	return s.stopErr
 }
@@ -0,0 +1,544 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aixiasang/bitcask"
+	"github.com/aixiasang/bitcask/config"
+	"github.com/aixiasang/bitcask/sql"
+	"github.com/aixiasang/bitcask/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTest(t *testing.T) (*bitcask.Bitcask, *Server) {
+	// 创建测试目录
+	tmpDir, err := os.MkdirTemp("", "http-test-*")
+	assert.NoError(t, err)
+
+	// 创建Bitcask实例
+	conf := config.NewConfig()
+	conf.DataDir = tmpDir
+	conf.AutoSync = false
+	conf.Debug = false
+
+	bc, err := bitcask.NewBitcask(conf)
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		bc.Close()
+		os.RemoveAll(tmpDir)
+	})
+	return bc, NewServer(bc, ":0", 100)
+}
+
+// postBatch 向路由发送批量请求，返回状态码和响应体
+func postBatch(s *Server, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBatchMixedPutDelete(t *testing.T) {
+	bc, s := setupTest(t)
+	assert.NoError(t, bc.Put([]byte("old"), []byte("1")))
+
+	rec := postBatch(s, `{"puts":[{"key":"a","value":"1"},{"key":"b","value":"2"}],"deletes":["old","missing"]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp BatchResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.True(t, resp.Success)
+	assert.Equal(t, []BatchOpResult{
+		{Op: "put", Key: "a", Status: BatchStatusOK},
+		{Op: "put", Key: "b", Status: BatchStatusOK},
+		{Op: "delete", Key: "old", Status: BatchStatusOK},
+		{Op: "delete", Key: "missing", Status: BatchStatusNotFound},
+	}, resp.Results)
+
+	value, ok := bc.Get([]byte("a"))
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(value))
+	value, ok = bc.Get([]byte("b"))
+	assert.True(t, ok)
+	assert.Equal(t, "2", string(value))
+	_, ok = bc.Get([]byte("old"))
+	assert.False(t, ok)
+}
+
+func TestBatchRejected(t *testing.T) {
+	bc, s := setupTest(t)
+
+	// 请求体不是合法的JSON或包含未知字段
+	for _, body := range []string{`{"puts":[`, `{"put":[{"key":"a","value":"1"}]}`, `[]`} {
+		rec := postBatch(s, body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+
+	// 空批处理
+	rec := postBatch(s, `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// 一个无效操作使整个批处理都不生效
+	rec = postBatch(s, `{"puts":[{"key":"a","value":"1"},{"key":"","value":"2"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var resp BatchResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.False(t, resp.Success)
+	assert.Equal(t, BatchStatusAborted, resp.Results[0].Status)
+	assert.Equal(t, BatchStatusInvalid, resp.Results[1].Status)
+	_, ok := bc.Get([]byte("a"))
+	assert.False(t, ok)
+
+	// 超过批处理大小限制
+	var puts []string
+	for i := 0; i <= config.NewConfig().BatchSize; i++ {
+		puts = append(puts, `{"key":"k`+strings.Repeat("x", i)+`","value":"v"}`)
+	}
+	rec = postBatch(s, `{"puts":[`+strings.Join(puts, ",")+`]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	_, ok = bc.Get([]byte("k"))
+	assert.False(t, ok)
+}
+
+func TestBatchOversizedValue(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "http-test-*")
+	assert.NoError(t, err)
+	conf := config.NewConfig()
+	conf.DataDir = tmpDir
+	conf.Debug = false
+	conf.MaxValueSize = 16
+	bc, err := bitcask.NewBitcask(conf)
+	assert.NoError(t, err)
+	defer func() {
+		bc.Close()
+		os.RemoveAll(tmpDir)
+	}()
+	s := NewServer(bc, ":0", 100)
+
+	// 超过 MaxValueSize 的值使整个批处理被拒绝，其他操作都不生效
+	rec := postBatch(s, `{"puts":[{"key":"a","value":"1"},{"key":"big","value":"`+strings.Repeat("x", 32)+`"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	var resp BatchResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.False(t, resp.Success)
+	assert.Equal(t, BatchStatusAborted, resp.Results[0].Status)
+	assert.Equal(t, BatchStatusInvalid, resp.Results[1].Status)
+	assert.Contains(t, resp.Results[1].Error, bitcask.ErrValueTooLarge.Error())
+	_, ok := bc.Get([]byte("a"))
+	assert.False(t, ok)
+	_, ok = bc.Get([]byte("big"))
+	assert.False(t, ok)
+}
+
+func TestBinaryValues(t *testing.T) {
+	bc, s := setupTest(t)
+	binary := []byte{'a', 0x00, 0xff, 0xfe, 'b', 0x00}
+	do := func(method, target string, body []byte, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 请求体按原样存储，以二进制读取时原样返回
+	rec := do(http.MethodPut, "/api/keys/raw", binary, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = do(http.MethodGet, "/api/keys/raw", nil, map[string]string{"Accept": "application/octet-stream"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+	assert.Equal(t, binary, rec.Body.Bytes())
+
+	// encoding=base64 时写入和读取的都是base64文本
+	encoded := base64.StdEncoding.EncodeToString(binary)
+	rec = do(http.MethodPut, "/api/keys/b64?encoding=base64", []byte(encoded), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	value, ok := bc.Get([]byte("b64"))
+	assert.True(t, ok)
+	assert.Equal(t, binary, value)
+	rec = do(http.MethodGet, "/api/keys/b64?encoding=base64", nil, nil)
+	assert.Equal(t, encoded, rec.Body.String())
+
+	rec = do(http.MethodPut, "/api/keys/bad?encoding=base64", []byte("not base64!"), nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = do(http.MethodGet, "/api/keys/raw?encoding=hex", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// 批量写入同样支持base64编码的值
+	rec = do(http.MethodPost, "/api/batch?encoding=base64", []byte(`{"puts":[{"key":"batch","value":"`+encoded+`"}]}`), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	value, ok = bc.Get([]byte("batch"))
+	assert.True(t, ok)
+	assert.Equal(t, binary, value)
+
+	// 列表和范围查询中的值为base64编码
+	decodePairs := func(rec *httptest.ResponseRecorder) map[string][]byte {
+		var pairs []KVPair
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pairs))
+		values := make(map[string][]byte)
+		for _, pair := range pairs {
+			value, err := base64.StdEncoding.DecodeString(pair.Value)
+			assert.NoError(t, err)
+			values[pair.Key] = value
+		}
+		return values
+	}
+	listed := decodePairs(do(http.MethodGet, "/api/keys", nil, nil))
+	assert.Len(t, listed, 3)
+	for _, key := range []string{"raw", "b64", "batch"} {
+		assert.Equal(t, binary, listed[key], key)
+	}
+	ranged := decodePairs(do(http.MethodGet, "/api/keys/range/aaa/zzz", nil, nil))
+	assert.Equal(t, binary, ranged["raw"])
+}
+
+func TestPutWithTTL(t *testing.T) {
+	_, s := setupTest(t)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 时长格式和整数秒都可以
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/keys/short?ttl=50ms", "v").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/keys/long?ttl=30", "v").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/keys/forever", "v").Code)
+	for _, ttl := range []string{"abc", "0", "-5s"} {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/keys/bad?ttl="+ttl, "v").Code, ttl)
+	}
+
+	assert.Equal(t, "30", do(http.MethodGet, "/api/keys/long/ttl", "").Body.String())
+	assert.Equal(t, "-1", do(http.MethodGet, "/api/keys/forever/ttl", "").Body.String())
+	assert.Equal(t, "-2", do(http.MethodGet, "/api/keys/missing/ttl", "").Body.String())
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/keys/short", "").Code)
+
+	// 过期后读取返回404，TTL返回-2
+	time.Sleep(80 * time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/keys/short", "").Code)
+	assert.Equal(t, "-2", do(http.MethodGet, "/api/keys/short/ttl", "").Body.String())
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/keys/long", "").Code)
+}
+
+func TestStats(t *testing.T) {
+	_, s := setupTest(t)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+	getStats := func() StatsResult {
+		rec := do(http.MethodGet, "/api/admin/stats", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var stats StatsResult
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+		return stats
+	}
+
+	stats := getStats()
+	assert.Equal(t, 0, stats.KeyCount)
+	assert.Equal(t, 1, stats.WalFiles)
+	assert.Equal(t, int64(0), stats.ReclaimableSize)
+
+	for _, key := range []string{"a", "b", "c"} {
+		assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/keys/"+key, "value").Code)
+	}
+	stats = getStats()
+	assert.Equal(t, 3, stats.KeyCount)
+	assert.Greater(t, stats.DiskSize, int64(0))
+	assert.Equal(t, int64(0), stats.ReclaimableSize)
+
+	// 覆盖和删除产生可回收的数据
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/keys/a", "new value").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/keys/b", "").Code)
+	stats = getStats()
+	assert.Equal(t, 2, stats.KeyCount)
+	assert.Greater(t, stats.ReclaimableSize, int64(0))
+
+	// 合并后可回收数据被清理，磁盘占用相应减少；合并结果写入单独的文件，之后的写入进入新的空文件
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/admin/merge", "").Code)
+	merged := getStats()
+	assert.Equal(t, 2, merged.KeyCount)
+	assert.Equal(t, int64(0), merged.ReclaimableSize)
+	assert.Equal(t, stats.DiskSize-stats.ReclaimableSize+wal.FileHeaderSize, merged.DiskSize)
+	assert.Greater(t, merged.ActiveFileId, stats.ActiveFileId)
+}
+
+func TestMetrics(t *testing.T) {
+	_, s := setupTest(t)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	do(http.MethodPut, "/api/keys/a", "1")
+	do(http.MethodPut, "/api/keys/b", strings.Repeat("x", 100))
+	do(http.MethodGet, "/api/keys/a", "")
+	do(http.MethodGet, "/api/keys/missing", "")
+	do(http.MethodDelete, "/api/keys/a", "")
+	do(http.MethodGet, "/api/keys/a", "")
+	postBatch(s, `{"puts":[{"key":"c","value":"3"}],"deletes":["b"]}`)
+	do(http.MethodPost, "/api/admin/merge", "")
+
+	rec := do(http.MethodGet, "/metrics", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE bitcask_puts_total counter",
+		"bitcask_puts_total 3",
+		"bitcask_gets_total 3",
+		"bitcask_get_misses_total 2",
+		"bitcask_deletes_total 2",
+		"bitcask_merges_total 1",
+		"# TYPE bitcask_operation_duration_seconds histogram",
+		`bitcask_operation_duration_seconds_count{op="get"} 3`,
+		`bitcask_operation_duration_seconds_count{op="put"} 2`,
+		`bitcask_operation_duration_seconds_count{op="delete"} 1`,
+		`bitcask_operation_duration_seconds_count{op="batch"} 1`,
+		`bitcask_operation_duration_seconds_bucket{op="merge",le="+Inf"} 1`,
+		`bitcask_value_size_bytes_bucket{le="64"} 2`,
+		`bitcask_value_size_bytes_bucket{le="256"} 3`,
+		"bitcask_value_size_bytes_sum 102",
+		"bitcask_value_size_bytes_count 3",
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+}
+
+func TestListKeysPagination(t *testing.T) {
+	bc, s := setupTest(t)
+	const total = 300
+	for i := 0; i < total; i++ {
+		assert.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%03d", i))))
+	}
+	_, err := bc.Delete([]byte("key-150"))
+	assert.NoError(t, err)
+
+	getPage := func(query string) KeysPage {
+		req := httptest.NewRequest(http.MethodGet, "/api/keys?"+query, nil)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var page KeysPage
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		return page
+	}
+
+	// 每页最多 limit 个键，页与页之间按顺序衔接且不重叠
+	seen := make(map[string]bool)
+	var keys []string
+	pages := 0
+	for cursor := ""; ; {
+		page := getPage("limit=64&cursor=" + cursor)
+		pages++
+		assert.LessOrEqual(t, len(page.Items), 64)
+		for _, item := range page.Items {
+			assert.False(t, seen[item.Key], item.Key)
+			seen[item.Key] = true
+			keys = append(keys, item.Key)
+			value, err := base64.StdEncoding.DecodeString(item.Value)
+			assert.NoError(t, err)
+			assert.Equal(t, "value-"+strings.TrimPrefix(item.Key, "key-"), string(value))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Equal(t, 5, pages)
+	assert.Len(t, keys, total-1)
+	assert.False(t, seen["key-150"])
+	assert.True(t, sort.StringsAreSorted(keys))
+
+	// 键数量恰好是limit的整数倍时，最后一页不会返回cursor
+	page := getPage("limit=299")
+	assert.Len(t, page.Items, 299)
+	assert.Empty(t, page.NextCursor)
+
+	// 只指定cursor时使用默认的limit
+	page = getPage("cursor=")
+	assert.Len(t, page.Items, 100)
+	assert.NotEmpty(t, page.NextCursor)
+
+	for _, query := range []string{"limit=0", "limit=abc", "cursor=***"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/keys?"+query, nil)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	_, s := setupTest(t)
+	started := make(chan struct{})
+	s.router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- s.serve(ln) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	requested := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			requested <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		requested <- result{string(body), err}
+	}()
+
+	// 请求处理中开始关闭，Stop 要等请求完成后才返回
+	<-started
+	assert.NoError(t, s.Stop())
+	select {
+	case res := <-requested:
+		assert.NoError(t, res.err)
+		assert.Equal(t, "done", res.body)
+	case <-time.After(time.Second):
+		t.Fatal("Stop 返回时请求仍未完成")
+	}
+	assert.NoError(t, <-served)
+
+	// 关闭后不再接收新连接
+	_, err = http.Get("http://" + ln.Addr().String() + "/slow")
+	assert.Error(t, err)
+	assert.NoError(t, s.Stop())
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	_, s := setupTest(t)
+	s.SetShutdownTimeout(50 * time.Millisecond)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	s.router.HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- s.serve(ln) }()
+	go http.Get("http://" + ln.Addr().String() + "/stuck")
+
+	// 超时后强制关闭连接并返回错误
+	<-started
+	assert.Error(t, s.Stop())
+	assert.Error(t, <-served)
+}
+
+func TestAuthToken(t *testing.T) {
+	bc, s := setupTest(t)
+	s.AuthToken = "secret"
+	assert.NoError(t, bc.Put([]byte("k"), []byte("v")))
+	do := func(target, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 缺少令牌、令牌错误或格式不对都返回401
+	for _, authorization := range []string{"", "Bearer wrong", "Bearer ", "secret", "Basic secret"} {
+		rec := do("/api/keys/k", authorization)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, authorization)
+		assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+	}
+	assert.Equal(t, http.StatusUnauthorized, do("/api/admin/stats", "").Code)
+
+	rec := do("/api/keys/k", "Bearer secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "v", rec.Body.String())
+
+	// Swagger 文档和指标不需要认证
+	assert.NotEqual(t, http.StatusUnauthorized, do("/swagger/index.html", "").Code)
+	assert.Equal(t, http.StatusOK, do("/metrics", "").Code)
+}
+
+func TestSQL(t *testing.T) {
+	_, s := setupTest(t)
+	postSQL := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/sql", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, stmt := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+		"INSERT INTO users (id, name) VALUES (2, 'bob')",
+	} {
+		rec := postSQL(`{"sql":"` + stmt + `"}`)
+		assert.Equal(t, http.StatusOK, rec.Code, stmt)
+		assert.JSONEq(t, `{"columns":[],"rows":[]}`, rec.Body.String())
+	}
+
+	rec := postSQL(`{"sql":"SELECT id, name FROM users WHERE id = 2"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result sql.QueryResult
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, []string{"id", "name"}, result.Columns)
+	assert.Equal(t, []sql.Row{{"id": "2", "name": "bob"}}, result.Rows)
+
+	// 请求体无效或语句无法解析时返回400
+	for _, body := range []string{`{"sql":"SELEC * FROM users"}`, `{"sql":""}`, `{"query":"SELECT * FROM users"}`, `not json`} {
+		rec = postSQL(body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		var sqlErr SQLError
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &sqlErr))
+		assert.NotEmpty(t, sqlErr.Error)
+	}
+
+	// 事务语句会影响其他客户端的请求，直接拒绝
+	for _, stmt := range []string{"BEGIN", "COMMIT", "ROLLBACK"} {
+		rec = postSQL(`{"sql":"` + stmt + `"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, stmt)
+	}
+	rec = postSQL(`{"sql":"INSERT INTO users (id, name) VALUES (3, 'carol')"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = postSQL(`{"sql":"SELECT id FROM users WHERE id = 3"}`)
+	var inserted sql.QueryResult
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &inserted))
+	assert.Equal(t, []sql.Row{{"id": "3"}}, inserted.Rows)
+
+	// 执行失败时返回500
+	rec = postSQL(`{"sql":"SELECT * FROM missing"}`)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "missing")
+}
@@ -11,20 +11,19 @@ import (
 
 // BTreeIndex 使用 Google BTree 实现的索引
 type BTreeIndex struct {
-	tree       *btree.BTree         // 使用 Google BTree 实现的 BTree
+	tree       *btree.BTreeG[item]  // 使用 Google BTree 实现的 BTree
 	mu         sync.RWMutex         // 添加读写锁保证并发安全
 	comparator *utils.KeyComparator // 键比较器
 }
 
-// item 实现 btree.Item 接口
+// item BTree 中保存的元素，直接以值保存在节点中，查找时构造的 item 不需要装箱到接口
 type item struct {
 	key []byte
 	pos *record.Pos
 }
 
-// Less 实现 btree.Item 接口
-func (i item) Less(than btree.Item) bool {
-	other := than.(item)
+// Less 与 utils.KeyComparator 的顺序一致，作为 BTree 的比较函数
+func (i item) Less(other item) bool {
 	// 先比较长度
 	if len(i.key) != len(other.key) {
 		return len(i.key) < len(other.key)
@@ -36,12 +35,64 @@ func (i item) Less(than btree.Item) bool {
 // NewBTreeIndex 创建一个新的 BTree 索引
 func NewBTreeIndex(order int) *BTreeIndex {
 	return &BTreeIndex{
-		tree:       btree.New(order), // 使用指定阶数的B树
+		tree:       btree.NewG(order, item.Less), // 使用指定阶数的B树
 		mu:         sync.RWMutex{},
 		comparator: utils.NewKeyComparator(),
 	}
 }
 
+// BulkLoadBTreeIndex 用已经按索引顺序（先长度后内容）严格递增排列的 sorted 构建 BTree 索引，
+// 例如由 BTree 索引生成的 hint 文件中的条目。sorted 没有排好序时退化为逐个插入，
+// 结果与依次 Put 相同
+func BulkLoadBTreeIndex(order int, sorted []Data) *BTreeIndex {
+	b := NewBTreeIndex(order)
+	if !b.Load(sorted) {
+		for i := range sorted {
+			pos := sorted[i].Pos
+			b.tree.ReplaceOrInsert(item{key: []byte(sorted[i].Key), pos: &pos})
+		}
+	}
+	return b
+}
+
+// Load 在索引为空且 sorted 按索引顺序严格递增时一次性载入所有条目并返回 true，
+// 否则不做任何修改并返回 false。键和位置分别复制到一整块内存中，不引用 sorted
+//
+// Google BTree 没有提供从有序数据自底向上建树的接口，这里仍然按顺序插入，
+// 节省的是每个键的加锁以及键和位置的单独分配
+func (b *BTreeIndex) Load(sorted []Data) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tree.Len() > 0 {
+		return false
+	}
+	size := 0
+	for i := range sorted {
+		if i > 0 && !b.comparator.Less([]byte(sorted[i-1].Key), []byte(sorted[i].Key)) {
+			return false
+		}
+		size += len(sorted[i].Key)
+	}
+
+	keys := make([]byte, 0, size)
+	positions := make([]record.Pos, len(sorted))
+	for i := range sorted {
+		start := len(keys)
+		keys = append(keys, sorted[i].Key...)
+		positions[i] = sorted[i].Pos
+		b.tree.ReplaceOrInsert(item{key: keys[start:len(keys):len(keys)], pos: &positions[i]})
+	}
+	return true
+}
+
+// Len 返回索引中的键数量
+func (b *BTreeIndex) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.tree.Len()
+}
+
 // Put 插入或更新键值对
 func (b *BTreeIndex) Put(key []byte, pos *record.Pos) error {
 	b.mu.Lock() // 写操作加写锁
@@ -56,11 +107,11 @@ func (b *BTreeIndex) Get(key []byte) (*record.Pos, error) {
 	b.mu.RLock() // 读操作加读锁
 	defer b.mu.RUnlock()
 
-	value := b.tree.Get(item{key: key})
-	if value == nil {
+	value, ok := b.tree.Get(item{key: key})
+	if !ok {
 		return nil, nil
 	}
-	return value.(item).pos, nil
+	return value.pos, nil
 }
 
 // Delete 删除键值对
@@ -79,35 +130,61 @@ func (b *BTreeIndex) Scan(startKey, endKey []byte) ([]*Data, error) {
 
 	var results []*Data
 
-	// 遍历 B 树
-	b.tree.Ascend(func(i btree.Item) bool {
-		item := i.(item)
-		// 使用比较器判断是否在范围内
-		if b.comparator.InRange(item.key, startKey, endKey) {
-			data := &Data{
-				Key: string(item.key),
-				Pos: *item.pos,
-			}
-			results = append(results, data)
-		}
-		// 如果超出上界，停止遍历
+	// 从第一个不小于 startKey 的键开始遍历 B 树，B 树与比较器的顺序一致，超出上界后的键都不在范围内
+	b.tree.AscendGreaterOrEqual(item{key: startKey}, func(item item) bool {
 		if b.comparator.Greater(item.key, endKey) {
 			return false
 		}
+		results = append(results, &Data{
+			Key: string(item.key),
+			Pos: *item.pos,
+		})
 		return true
 	})
 
 	return results, nil
 }
 
+// ScanPrefix 对以 prefix 开头的键执行 fn
+//
+// 键先按长度排序，带前缀的键在每个长度内是一个连续区间：从前缀开始遍历，
+// 遇到不带前缀的键时直接定位到下一个可能的区间起点，不会访问其他前缀的区间
+func (b *BTreeIndex) ScanPrefix(prefix []byte, fn func(key []byte, pos *record.Pos) error) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	pivot := prefix
+	for {
+		var err error
+		var next []byte
+		b.tree.AscendGreaterOrEqual(item{key: pivot}, func(item item) bool {
+			if !bytes.HasPrefix(item.key, prefix) {
+				// 同长度下前缀较小时定位到该长度区间的起点，否则该长度已遍历完，跳到下一个长度
+				length := len(item.key)
+				if bytes.Compare(item.key[:len(prefix)], prefix) > 0 {
+					length++
+				}
+				next = make([]byte, length)
+				copy(next, prefix)
+				return false
+			}
+			err = fn(item.key, item.pos)
+			return err == nil
+		})
+		if err != nil || next == nil {
+			return err
+		}
+		pivot = next
+	}
+}
+
 // Foreach 对每个键值对执行指定的函数
 func (b *BTreeIndex) Foreach(fn func(key []byte, pos *record.Pos) error) error {
 	b.mu.RLock() // 读操作加读锁
 	defer b.mu.RUnlock()
 
 	var err error
-	b.tree.Ascend(func(i btree.Item) bool {
-		item := i.(item)
+	b.tree.Ascend(func(item item) bool {
 		err = fn(item.key, item.pos)
 		// 如果出现错误，停止遍历
 		if err != nil {
@@ -122,8 +199,7 @@ func (b *BTreeIndex) Foreach(fn func(key []byte, pos *record.Pos) error) error {
 // ForeachUnSafe 对每个键值对执行指定的函数
 func (b *BTreeIndex) ForeachUnSafe(fn func(key []byte, pos *record.Pos) error) error {
 	var err error
-	b.tree.Ascend(func(i btree.Item) bool {
-		item := i.(item)
+	b.tree.Ascend(func(item item) bool {
 		err = fn(item.key, item.pos)
 		// 如果出现错误，停止遍历
 		if err != nil {
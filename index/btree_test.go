@@ -109,6 +109,46 @@ func TestBTreeIndex_Scan(t *testing.T) {
 	assert.Len(t, results, 0)
 }
 
+func TestBTreeIndex_ScanPrefix(t *testing.T) {
+	index := NewBTreeIndex(3)
+
+	// 带前缀的键分布在不同长度中，中间穿插前缀较小和较大的同长度键
+	keys := []string{
+		"h:", "h:a", "h:b", "h:abc", "h:zzzz",
+		"a", "g:a", "i:a", "gg:ab", "i:abc", "h", "hx:a", "zzzzzzz", "h;:a",
+	}
+	for i, key := range keys {
+		assert.NoError(t, index.Put([]byte(key), &record.Pos{FileId: uint32(i)}))
+	}
+
+	collect := func(prefix string) []string {
+		var got []string
+		err := index.ScanPrefix([]byte(prefix), func(key []byte, pos *record.Pos) error {
+			assert.Equal(t, key, []byte(keys[pos.FileId]))
+			got = append(got, string(key))
+			return nil
+		})
+		assert.NoError(t, err)
+		return got
+	}
+	// 结果按先长度后内容的顺序返回
+	assert.Equal(t, []string{"h:", "h:a", "h:b", "h:abc", "h:zzzz"}, collect("h:"))
+	assert.Equal(t, []string{"h", "h:", "h:a", "h:b", "h;:a", "hx:a", "h:abc", "h:zzzz"}, collect("h"))
+	assert.Nil(t, collect("q"))
+	assert.Nil(t, collect("h:abcd"))
+	assert.Len(t, collect(""), len(keys))
+
+	// 回调返回错误时停止遍历
+	stopErr := fmt.Errorf("stop")
+	count := 0
+	err := index.ScanPrefix([]byte("h:"), func(key []byte, pos *record.Pos) error {
+		count++
+		return stopErr
+	})
+	assert.Equal(t, stopErr, err)
+	assert.Equal(t, 1, count)
+}
+
 func TestBTreeIndex_Foreach(t *testing.T) {
 	index := NewBTreeIndex(12)
 
@@ -288,3 +328,105 @@ func TestBTreeIndex_Performance(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, numItems, len(results))
 }
+
+func collectBTree(t *testing.T, b *BTreeIndex) []Data {
+	var all []Data
+	err := b.Foreach(func(key []byte, pos *record.Pos) error {
+		all = append(all, Data{Key: string(key), Pos: *pos})
+		return nil
+	})
+	assert.NoError(t, err)
+	return all
+}
+
+func TestBulkLoadBTreeIndex(t *testing.T) {
+	// 按索引顺序（先长度后内容）生成有序条目
+	var sorted []Data
+	for i := 0; i < 1000; i++ {
+		sorted = append(sorted, Data{Key: fmt.Sprintf("key_%d", i), Pos: record.Pos{FileId: uint32(i % 3), Offset: uint32(i)}})
+	}
+	incremental := NewBTreeIndex(12)
+	shuffled := append([]Data(nil), sorted...)
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j := (i * 7919) % (i + 1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	for i := range shuffled {
+		pos := shuffled[i].Pos
+		assert.NoError(t, incremental.Put([]byte(shuffled[i].Key), &pos))
+	}
+	want := collectBTree(t, incremental)
+
+	// Foreach 的结果就是索引顺序
+	bulk := BulkLoadBTreeIndex(12, want)
+	assert.Equal(t, incremental.Len(), bulk.Len())
+	assert.Equal(t, want, collectBTree(t, bulk))
+	pos, err := bulk.Get([]byte("key_500"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(500), pos.Offset)
+
+	// 构建后不引用传入的条目
+	want[0].Pos.Offset = 12345
+	pos, err = bulk.Get([]byte(want[0].Key))
+	assert.NoError(t, err)
+	assert.NotEqual(t, uint32(12345), pos.Offset)
+
+	// 未排序或有重复键时与依次 Put 相同，重复的键保留最后一个位置
+	unsorted := []Data{
+		{Key: "b", Pos: record.Pos{Offset: 1}},
+		{Key: "a", Pos: record.Pos{Offset: 2}},
+		{Key: "b", Pos: record.Pos{Offset: 3}},
+	}
+	fallback := BulkLoadBTreeIndex(12, unsorted)
+	assert.Equal(t, []Data{{Key: "a", Pos: record.Pos{Offset: 2}}, {Key: "b", Pos: record.Pos{Offset: 3}}}, collectBTree(t, fallback))
+
+	// 非空索引和未排序的条目不会被 Load 修改
+	assert.False(t, fallback.Load([]Data{{Key: "c"}}))
+	assert.False(t, NewBTreeIndex(12).Load(unsorted))
+	assert.Equal(t, 2, fallback.Len())
+	assert.True(t, NewBTreeIndex(12).Load(nil))
+}
+
+func TestBTreeIndex_EmptyKeyRange(t *testing.T) {
+	index := NewBTreeIndex(4)
+	for i, key := range []string{"bb", "", "a", "ab"} {
+		assert.NoError(t, index.Put([]byte(key), &record.Pos{Offset: uint32(i)}))
+	}
+	keysOf := func(results []*Data) []string {
+		var keys []string
+		for _, d := range results {
+			keys = append(keys, d.Key)
+		}
+		return keys
+	}
+
+	// 空键是最小的键，nil 和 []byte("") 等价
+	results, err := index.Scan([]byte(""), []byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "a"}, keysOf(results))
+	results, err = index.Scan(nil, []byte(""))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, keysOf(results))
+	results, err = index.Scan([]byte(""), []byte("zz"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "a", "ab", "bb"}, keysOf(results))
+
+	// 空前缀匹配所有键
+	var prefixed []string
+	assert.NoError(t, index.ScanPrefix([]byte(""), func(key []byte, pos *record.Pos) error {
+		prefixed = append(prefixed, string(key))
+		return nil
+	}))
+	assert.Equal(t, []string{"", "a", "ab", "bb"}, prefixed)
+
+	c := index.Seek([]byte(""))
+	key, pos := c.Item()
+	assert.Equal(t, "", string(key))
+	assert.Equal(t, uint32(1), pos.Offset)
+
+	// 删除空键后从下一个键开始
+	assert.NoError(t, index.Delete(nil))
+	results, err = index.Scan([]byte(""), []byte("zz"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "ab", "bb"}, keysOf(results))
+}
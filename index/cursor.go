@@ -0,0 +1,99 @@
+package index
+
+import (
+	"github.com/aixiasang/bitcask/record"
+)
+
+// cursorChunk BTree 游标每次从树中读取的键数量
+const cursorChunk = 64
+
+// Cursor 由 Index.Seek 返回的游标，按比较器顺序（先长度后内容）双向移动
+//
+// 越过两端后 Valid 返回 false，此时 Next/Prev 不再移动
+type Cursor interface {
+	Next()                               // 移动到下一个键
+	Prev()                               // 移动到上一个键
+	Valid() bool                         // 当前位置是否有效
+	Item() (key []byte, pos *record.Pos) // 当前键和位置，无效时返回 nil
+}
+
+// btreeCursor BTree 索引的游标。Google BTree 没有原生游标，每次读取当前位置之后（或之前）
+// 的一块键，块内移动不需要访问树。块是读取时的快照，不反映之后对这些键的修改
+type btreeCursor struct {
+	index *BTreeIndex
+	items []item // 当前块，按索引顺序排列
+	cur   int    // 当前位置在块中的下标，块为空时无效
+}
+
+// Seek 返回定位在第一个 >= key 的键上的游标
+func (b *BTreeIndex) Seek(key []byte) Cursor {
+	c := &btreeCursor{index: b}
+	c.fill(item{key: key}, true, true)
+	return c
+}
+
+// fill 从 pivot 开始按方向读取一块键，inclusive 表示包含 pivot 本身。
+// 向前读取时定位到块的第一个键，向后读取时定位到块的最后一个键
+func (c *btreeCursor) fill(pivot item, forward, inclusive bool) {
+	c.index.mu.RLock()
+	defer c.index.mu.RUnlock()
+
+	items := make([]item, 0, cursorChunk)
+	collect := func(found item) bool {
+		if !inclusive && !pivot.Less(found) && !found.Less(pivot) {
+			return true // 跳过 pivot 本身
+		}
+		items = append(items, found)
+		return len(items) < cursorChunk
+	}
+	if forward {
+		c.index.tree.AscendGreaterOrEqual(pivot, collect)
+		c.items, c.cur = items, 0
+		return
+	}
+	c.index.tree.DescendLessOrEqual(pivot, collect)
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	c.items, c.cur = items, len(items)-1
+}
+
+func (c *btreeCursor) Next() {
+	if !c.Valid() {
+		return
+	}
+	if c.cur++; c.cur < len(c.items) {
+		return
+	}
+	c.fill(c.items[len(c.items)-1], true, false)
+}
+
+func (c *btreeCursor) Prev() {
+	if !c.Valid() {
+		return
+	}
+	if c.cur--; c.cur >= 0 {
+		return
+	}
+	c.fill(c.items[0], false, false)
+}
+
+func (c *btreeCursor) Valid() bool { return c.cur >= 0 && c.cur < len(c.items) }
+
+func (c *btreeCursor) Item() ([]byte, *record.Pos) {
+	if !c.Valid() {
+		return nil, nil
+	}
+	return c.items[c.cur].key, c.items[c.cur].pos
+}
+
+// Seek 返回定位在第一个 >= key 的键上的游标，与 Iterator 相同需要对全部键排序生成快照
+func (h *HashMapIndex) Seek(key []byte) Cursor {
+	it := h.snapshot()
+	it.Seek(key)
+	return it
+}
+
+func (it *sliceIterator) Item() ([]byte, *record.Pos) {
+	return it.Key(), it.Pos()
+}
@@ -0,0 +1,100 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aixiasang/bitcask/record"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndex_Seek(t *testing.T) {
+	for name, index := range map[string]Index{
+		"btree":   NewBTreeIndex(4),
+		"hashmap": NewHashMapIndex(4),
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, i := range []int{10, 2, 30, 1, 20} {
+				assert.NoError(t, index.Put([]byte(fmt.Sprintf("key_%d", i)), &record.Pos{FileId: uint32(i)}))
+			}
+
+			// 定位到存在的键
+			c := index.Seek([]byte("key_10"))
+			assert.True(t, c.Valid())
+			key, pos := c.Item()
+			assert.Equal(t, "key_10", string(key))
+			assert.Equal(t, uint32(10), pos.FileId)
+
+			// 定位到不存在的键，落在下一个键上，先长度后内容：key_3 之后是 key_10
+			c = index.Seek([]byte("key_3"))
+			key, _ = c.Item()
+			assert.Equal(t, "key_10", string(key))
+			c = index.Seek([]byte("key_11"))
+			key, _ = c.Item()
+			assert.Equal(t, "key_20", string(key))
+
+			// 双向移动
+			c.Prev()
+			key, _ = c.Item()
+			assert.Equal(t, "key_10", string(key))
+			c.Next()
+			c.Next()
+			key, _ = c.Item()
+			assert.Equal(t, "key_30", string(key))
+			c.Next()
+			assert.False(t, c.Valid())
+			c.Prev()
+			assert.False(t, c.Valid())
+
+			// 超过最大键
+			c = index.Seek([]byte("key_99"))
+			assert.False(t, c.Valid())
+			key, pos = c.Item()
+			assert.Nil(t, key)
+			assert.Nil(t, pos)
+
+			// 空键定位到第一个键
+			c = index.Seek(nil)
+			key, _ = c.Item()
+			assert.Equal(t, "key_1", string(key))
+			c.Prev()
+			assert.False(t, c.Valid())
+		})
+	}
+}
+
+func TestBTreeIndex_SeekAcrossChunks(t *testing.T) {
+	index := NewBTreeIndex(4)
+	n := cursorChunk*3 + 5
+	for i := 0; i < n; i++ {
+		assert.NoError(t, index.Put([]byte(fmt.Sprintf("key_%04d", i)), &record.Pos{Offset: uint32(i)}))
+	}
+
+	// 向前遍历跨过多个块
+	c := index.Seek([]byte("key_0003"))
+	var count int
+	for ; c.Valid(); c.Next() {
+		_, pos := c.Item()
+		assert.Equal(t, uint32(count+3), pos.Offset)
+		count++
+	}
+	assert.Equal(t, n-3, count)
+
+	// 从末尾向后遍历同样跨过多个块
+	c = index.Seek([]byte(fmt.Sprintf("key_%04d", n-1)))
+	count = 0
+	for ; c.Valid(); c.Prev() {
+		_, pos := c.Item()
+		assert.Equal(t, uint32(n-1-count), pos.Offset)
+		count++
+	}
+	assert.Equal(t, n, count)
+
+	// 在块边界来回移动
+	c = index.Seek([]byte(fmt.Sprintf("key_%04d", cursorChunk-1)))
+	c.Next()
+	c.Prev()
+	c.Prev()
+	_, pos := c.Item()
+	assert.Equal(t, uint32(cursorChunk-2), pos.Offset)
+}
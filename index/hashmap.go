@@ -0,0 +1,200 @@
+package index
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aixiasang/bitcask/record"
+	"github.com/aixiasang/bitcask/utils"
+)
+
+// DefaultHashMapShards 哈希索引默认分片数
+const DefaultHashMapShards = 256
+
+// HashMapIndex 基于分片哈希表实现的索引
+//
+// Get/Put/Delete 为 O(1)，适合以点查为主的场景（例如 Redis 字符串）。
+// 代价是键无序：Foreach/ForeachUnSafe 的遍历顺序不确定，
+// Scan 需要遍历全部键后再排序，开销为 O(n log n)。
+type HashMapIndex struct {
+	shards     []*hashShard         // 分片
+	mask       uint32               // 分片掩码，分片数为2的幂
+	comparator *utils.KeyComparator // 键比较器
+}
+
+// hashShard 单个分片，每个分片独立加锁以减少锁竞争
+type hashShard struct {
+	mu    sync.RWMutex
+	items map[string]*record.Pos
+}
+
+// NewHashMapIndex 创建一个新的哈希索引，分片数向上取整为2的幂
+func NewHashMapIndex(shardCount int) *HashMapIndex {
+	if shardCount <= 0 {
+		shardCount = DefaultHashMapShards
+	}
+	n := 1
+	for n < shardCount {
+		n <<= 1
+	}
+	shards := make([]*hashShard, n)
+	for i := range shards {
+		shards[i] = &hashShard{items: make(map[string]*record.Pos)}
+	}
+	return &HashMapIndex{
+		shards:     shards,
+		mask:       uint32(n - 1),
+		comparator: utils.NewKeyComparator(),
+	}
+}
+
+// shard 使用 FNV-1a 选择键所在的分片
+func (h *HashMapIndex) shard(key []byte) *hashShard {
+	hash := uint32(2166136261)
+	for _, c := range key {
+		hash ^= uint32(c)
+		hash *= 16777619
+	}
+	return h.shards[hash&h.mask]
+}
+
+// Put 添加或更新键的位置信息
+func (h *HashMapIndex) Put(key []byte, pos *record.Pos) error {
+	s := h.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[string(key)] = pos
+	return nil
+}
+
+// Get 获取键对应的位置信息
+func (h *HashMapIndex) Get(key []byte) (*record.Pos, error) {
+	s := h.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.items[string(key)], nil
+}
+
+// Delete 删除键值对
+func (h *HashMapIndex) Delete(key []byte) error {
+	s := h.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.items, string(key))
+	return nil
+}
+
+// Scan 扫描指定范围内的键值对，结果按比较器顺序排序
+func (h *HashMapIndex) Scan(startKey, endKey []byte) ([]*Data, error) {
+	var results []*Data
+	for _, s := range h.shards {
+		s.mu.RLock()
+		for k, pos := range s.items {
+			key := []byte(k)
+			if h.comparator.InRange(key, startKey, endKey) {
+				results = append(results, &Data{Key: k, Pos: *pos})
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	// 与BTree保持一致：先比较长度，再比较内容
+	sort.Slice(results, func(i, j int) bool {
+		if len(results[i].Key) != len(results[j].Key) {
+			return len(results[i].Key) < len(results[j].Key)
+		}
+		return bytes.Compare([]byte(results[i].Key), []byte(results[j].Key)) < 0
+	})
+	return results, nil
+}
+
+// ScanPrefix 对以 prefix 开头的键按比较器顺序执行 fn，需要遍历全部分片并对结果排序
+func (h *HashMapIndex) ScanPrefix(prefix []byte, fn func(key []byte, pos *record.Pos) error) error {
+	p := string(prefix)
+	var results []*Data
+	for _, s := range h.shards {
+		s.mu.RLock()
+		for k, pos := range s.items {
+			if strings.HasPrefix(k, p) {
+				results = append(results, &Data{Key: k, Pos: *pos})
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return h.comparator.Less([]byte(results[i].Key), []byte(results[j].Key))
+	})
+	for _, data := range results {
+		if err := fn([]byte(data.Key), &data.Pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Foreach 对每个键值对执行指定的函数，遍历顺序不确定
+func (h *HashMapIndex) Foreach(fn func(key []byte, pos *record.Pos) error) error {
+	for _, s := range h.shards {
+		s.mu.RLock()
+		for k, pos := range s.items {
+			if err := fn([]byte(k), pos); err != nil {
+				s.mu.RUnlock()
+				return err
+			}
+		}
+		s.mu.RUnlock()
+	}
+	return nil
+}
+
+// ForeachUnSafe 对每个键值对执行指定的函数，不加锁，遍历顺序不确定
+func (h *HashMapIndex) ForeachUnSafe(fn func(key []byte, pos *record.Pos) error) error {
+	for _, s := range h.shards {
+		for k, pos := range s.items {
+			if err := fn([]byte(k), pos); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Iterator 创建迭代器，需要对全部键排序生成快照，开销为 O(n log n)
+func (h *HashMapIndex) Iterator() Iterator {
+	return h.snapshot()
+}
+
+// snapshot 对全部键排序生成有序快照
+func (h *HashMapIndex) snapshot() *sliceIterator {
+	type entry struct {
+		key []byte
+		pos *record.Pos
+	}
+	var entries []entry
+	h.Foreach(func(key []byte, pos *record.Pos) error {
+		entries = append(entries, entry{key: key, pos: pos})
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return item{key: entries[i].key}.Less(item{key: entries[j].key})
+	})
+
+	keys := make([][]byte, len(entries))
+	pos := make([]*record.Pos, len(entries))
+	for i, e := range entries {
+		keys[i], pos[i] = e.key, e.pos
+	}
+	return newSliceIterator(keys, pos)
+}
+
+// Close 关闭索引
+func (h *HashMapIndex) Close() error {
+	// 哈希表不需要特殊的清理操作
+	return nil
+}
@@ -0,0 +1,160 @@
+package index
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aixiasang/bitcask/record"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHashMapIndex(t *testing.T) {
+	index := NewHashMapIndex(100)
+	assert.NotNil(t, index)
+	// 分片数向上取整为2的幂
+	assert.Equal(t, 128, len(index.shards))
+
+	index = NewHashMapIndex(0)
+	assert.Equal(t, DefaultHashMapShards, len(index.shards))
+}
+
+func TestHashMapIndex_PutGetDelete(t *testing.T) {
+	index := NewHashMapIndex(16)
+
+	key := []byte("test_key")
+	pos := &record.Pos{FileId: 1, Offset: 100, Length: 50}
+
+	err := index.Put(key, pos)
+	assert.NoError(t, err)
+
+	result, err := index.Get(key)
+	assert.NoError(t, err)
+	assert.Equal(t, pos, result)
+
+	// 更新
+	newPos := &record.Pos{FileId: 2, Offset: 200, Length: 60}
+	assert.NoError(t, index.Put(key, newPos))
+	result, err = index.Get(key)
+	assert.NoError(t, err)
+	assert.Equal(t, newPos, result)
+
+	// 不存在的键
+	result, err = index.Get([]byte("non_exist_key"))
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	// 删除
+	assert.NoError(t, index.Delete(key))
+	result, err = index.Get(key)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestHashMapIndex_ScanAndForeach(t *testing.T) {
+	index := NewHashMapIndex(4)
+	btree := NewBTreeIndex(12)
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key_%d", i))
+		pos := &record.Pos{FileId: uint32(i)}
+		assert.NoError(t, index.Put(key, pos))
+		assert.NoError(t, btree.Put(key, pos))
+	}
+
+	// Scan 结果与BTree一致且有序
+	start, end := []byte("key_10"), []byte("key_150")
+	expected, err := btree.Scan(start, end)
+	assert.NoError(t, err)
+	results, err := index.Scan(start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, results)
+
+	// ScanPrefix 结果与BTree一致且有序
+	var expectedKeys, prefixKeys []string
+	assert.NoError(t, btree.ScanPrefix([]byte("key_1"), func(key []byte, _ *record.Pos) error {
+		expectedKeys = append(expectedKeys, string(key))
+		return nil
+	}))
+	assert.NoError(t, index.ScanPrefix([]byte("key_1"), func(key []byte, _ *record.Pos) error {
+		prefixKeys = append(prefixKeys, string(key))
+		return nil
+	}))
+	assert.Len(t, prefixKeys, 111)
+	assert.Equal(t, expectedKeys, prefixKeys)
+
+	// Foreach 访问所有键，顺序不确定
+	seen := make(map[string]bool)
+	err = index.Foreach(func(key []byte, pos *record.Pos) error {
+		seen[string(key)] = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, len(seen))
+
+	// 回调返回错误时停止遍历
+	count := 0
+	stopErr := fmt.Errorf("stop")
+	err = index.ForeachUnSafe(func(key []byte, pos *record.Pos) error {
+		count++
+		if count == 10 {
+			return stopErr
+		}
+		return nil
+	})
+	assert.Equal(t, stopErr, err)
+	assert.Equal(t, 10, count)
+}
+
+func TestHashMapIndex_Concurrent(t *testing.T) {
+	index := NewHashMapIndex(DefaultHashMapShards)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := []byte(fmt.Sprintf("key_%d_%d", g, i))
+				assert.NoError(t, index.Put(key, &record.Pos{FileId: uint32(g), Offset: uint32(i)}))
+				pos, err := index.Get(key)
+				assert.NoError(t, err)
+				assert.Equal(t, uint32(i), pos.Offset)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	count := 0
+	assert.NoError(t, index.Foreach(func(key []byte, pos *record.Pos) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 8000, count)
+}
+
+// 对比 1M 个键下 HashMap 与 BTree 的点查吞吐，两者的点查都不应分配内存
+func benchmarkIndexGet(b *testing.B, index Index) {
+	const numKeys = 1000000
+	keys := make([][]byte, numKeys)
+	pos := &record.Pos{FileId: 1}
+	for i := 0; i < numKeys; i++ {
+		keys[i] = []byte(fmt.Sprintf("bench_key_%d", i))
+		if err := index.Put(keys[i], pos); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := index.Get(keys[i%numKeys]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHashMapIndex_Get(b *testing.B) {
+	benchmarkIndexGet(b, NewHashMapIndex(DefaultHashMapShards))
+}
+
+func BenchmarkBTreeIndex_Get(b *testing.B) {
+	benchmarkIndexGet(b, NewBTreeIndex(32))
+}
@@ -10,7 +10,12 @@ type Index interface {
 	Delete(key []byte) error
 	Scan(startKey, endKey []byte) ([]*Data, error)
 	Foreach(fn func(key []byte, pos *record.Pos) error) error
+	// ScanPrefix 按索引顺序（先长度后内容）对以 prefix 开头的键执行 fn，fn 中不能修改索引
+	ScanPrefix(prefix []byte, fn func(key []byte, pos *record.Pos) error) error
 	ForeachUnSafe(fn func(key []byte, pos *record.Pos) error) error
+	Iterator() Iterator
+	// Seek 返回定位在第一个 >= key 的键上的游标
+	Seek(key []byte) Cursor
 	Close() error
 }
 
@@ -23,6 +28,7 @@ type IndexType uint8
 const (
 	IndexTypeBTree IndexType = iota
 	IndexTypeSkipList
+	IndexTypeHashMap
 )
 
 // NewIndex 创建一个新的索引实例
@@ -33,6 +39,8 @@ func NewIndex(typ IndexType) Index {
 	case IndexTypeSkipList:
 		// 待实现
 		return nil
+	case IndexTypeHashMap:
+		return NewHashMapIndex(DefaultHashMapShards)
 	default:
 		return NewBTreeIndex(32) // 默认使用BTree索引
 	}
@@ -32,12 +32,17 @@ func TestNewIndex(t *testing.T) {
 	// 测试SkipList当前返回nil
 	skipListIndex := NewIndex(IndexTypeSkipList)
 	assert.Nil(t, skipListIndex, "SkipList索引尚未实现")
+
+	// 测试创建HashMap索引
+	hashIndex := NewIndex(IndexTypeHashMap)
+	assert.IsType(t, &HashMapIndex{}, hashIndex)
 }
 
 func TestIndexTypeConstants(t *testing.T) {
 	// 测试索引类型常量
 	assert.Equal(t, IndexType(0), IndexTypeBTree)
 	assert.Equal(t, IndexType(1), IndexTypeSkipList)
+	assert.Equal(t, IndexType(2), IndexTypeHashMap)
 
 	// 测试索引类型之间的差异
 	assert.NotEqual(t, IndexTypeBTree, IndexTypeSkipList)
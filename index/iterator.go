@@ -0,0 +1,156 @@
+package index
+
+import (
+	"sort"
+
+	"github.com/aixiasang/bitcask/record"
+)
+
+// Iterator 索引迭代器，按比较器顺序（先长度后内容）遍历
+//
+// 创建后定位在第一个键；越过两端后 Valid 返回 false，此时 Next/Prev 不再移动
+type Iterator interface {
+	Seek(key []byte) // 定位到第一个 >= key 的位置
+	Next()           // 移动到下一个键
+	Prev()           // 移动到上一个键
+	Valid() bool     // 当前位置是否有效
+	Key() []byte     // 当前键
+	Pos() *record.Pos
+	Close() error
+}
+
+// btreeIterator 基于BTree的迭代器，每次移动都从当前键重新定位，复杂度 O(log n)
+type btreeIterator struct {
+	index *BTreeIndex
+	cur   *item
+}
+
+// Iterator 创建BTree索引的迭代器
+func (b *BTreeIndex) Iterator() Iterator {
+	it := &btreeIterator{index: b}
+	b.mu.RLock()
+	if first, ok := b.tree.Min(); ok {
+		it.cur = &first
+	}
+	b.mu.RUnlock()
+	return it
+}
+
+func (it *btreeIterator) Seek(key []byte) {
+	it.index.mu.RLock()
+	defer it.index.mu.RUnlock()
+
+	it.cur = nil
+	it.index.tree.AscendGreaterOrEqual(item{key: key}, func(found item) bool {
+		it.cur = &found
+		return false
+	})
+}
+
+func (it *btreeIterator) Next() {
+	if it.cur == nil {
+		return
+	}
+	it.index.mu.RLock()
+	defer it.index.mu.RUnlock()
+
+	pivot := *it.cur
+	it.cur = nil
+	it.index.tree.AscendGreaterOrEqual(pivot, func(found item) bool {
+		if !pivot.Less(found) {
+			return true // 跳过当前键
+		}
+		it.cur = &found
+		return false
+	})
+}
+
+func (it *btreeIterator) Prev() {
+	if it.cur == nil {
+		return
+	}
+	it.index.mu.RLock()
+	defer it.index.mu.RUnlock()
+
+	pivot := *it.cur
+	it.cur = nil
+	it.index.tree.DescendLessOrEqual(pivot, func(found item) bool {
+		if !found.Less(pivot) {
+			return true // 跳过当前键
+		}
+		it.cur = &found
+		return false
+	})
+}
+
+func (it *btreeIterator) Valid() bool { return it.cur != nil }
+
+func (it *btreeIterator) Key() []byte {
+	if it.cur == nil {
+		return nil
+	}
+	return it.cur.key
+}
+
+func (it *btreeIterator) Pos() *record.Pos {
+	if it.cur == nil {
+		return nil
+	}
+	return it.cur.pos
+}
+
+func (it *btreeIterator) Close() error {
+	it.cur = nil
+	return nil
+}
+
+// sliceIterator 基于有序快照的迭代器，用于无序索引
+type sliceIterator struct {
+	keys  [][]byte
+	pos   []*record.Pos
+	index int
+}
+
+func newSliceIterator(keys [][]byte, pos []*record.Pos) *sliceIterator {
+	return &sliceIterator{keys: keys, pos: pos}
+}
+
+func (it *sliceIterator) Seek(key []byte) {
+	target := item{key: key}
+	it.index = sort.Search(len(it.keys), func(i int) bool {
+		return !(item{key: it.keys[i]}).Less(target)
+	})
+}
+
+func (it *sliceIterator) Next() {
+	if it.Valid() {
+		it.index++
+	}
+}
+
+func (it *sliceIterator) Prev() {
+	if it.Valid() {
+		it.index--
+	}
+}
+
+func (it *sliceIterator) Valid() bool { return it.index >= 0 && it.index < len(it.keys) }
+
+func (it *sliceIterator) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.keys[it.index]
+}
+
+func (it *sliceIterator) Pos() *record.Pos {
+	if !it.Valid() {
+		return nil
+	}
+	return it.pos[it.index]
+}
+
+func (it *sliceIterator) Close() error {
+	it.keys, it.pos = nil, nil
+	return nil
+}
@@ -0,0 +1,70 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aixiasang/bitcask/record"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIterator_Ordering(t *testing.T) {
+	for name, index := range map[string]Index{
+		"btree":   NewBTreeIndex(4),
+		"hashmap": NewHashMapIndex(4),
+	} {
+		t.Run(name, func(t *testing.T) {
+			// 先长度后内容：key_2 < key_10
+			for _, i := range []int{10, 2, 30, 1, 20} {
+				assert.NoError(t, index.Put([]byte(fmt.Sprintf("key_%d", i)), &record.Pos{FileId: uint32(i)}))
+			}
+			expected := []string{"key_1", "key_2", "key_10", "key_20", "key_30"}
+
+			it := index.Iterator()
+			defer it.Close()
+			var forward []string
+			for ; it.Valid(); it.Next() {
+				forward = append(forward, string(it.Key()))
+			}
+			assert.Equal(t, expected, forward)
+
+			// 定位到不存在的键，落在下一个键上
+			it.Seek([]byte("key_11"))
+			assert.True(t, it.Valid())
+			assert.Equal(t, "key_20", string(it.Key()))
+			assert.Equal(t, uint32(20), it.Pos().FileId)
+
+			// 双向移动
+			it.Prev()
+			assert.Equal(t, "key_10", string(it.Key()))
+			it.Prev()
+			it.Prev()
+			assert.Equal(t, "key_1", string(it.Key()))
+			it.Prev()
+			assert.False(t, it.Valid())
+			assert.Nil(t, it.Key())
+
+			// 超过最大键
+			it.Seek([]byte("key_99"))
+			assert.False(t, it.Valid())
+		})
+	}
+}
+
+func TestIterator_Empty(t *testing.T) {
+	for name, index := range map[string]Index{
+		"btree":   NewBTreeIndex(4),
+		"hashmap": NewHashMapIndex(4),
+	} {
+		t.Run(name, func(t *testing.T) {
+			it := index.Iterator()
+			assert.False(t, it.Valid())
+			it.Next()
+			it.Prev()
+			it.Seek([]byte("any"))
+			assert.False(t, it.Valid())
+			assert.Nil(t, it.Pos())
+			assert.NoError(t, it.Close())
+		})
+	}
+}
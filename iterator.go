@@ -0,0 +1,107 @@
+package bitcask
+
+import (
+	"time"
+
+	"github.com/aixiasang/bitcask/index"
+)
+
+// Iterator 游标式遍历，按索引顺序（先长度后内容）移动，value 按需从WAL读取
+//
+// 删除标记和已过期的记录会被自动跳过。读取记录出错时迭代器变为无效，
+// 可以通过 Err 获取错误。
+type Iterator struct {
+	bc    *Bitcask
+	cur   index.Cursor // 关闭后为nil
+	value []byte
+	err   error
+}
+
+// NewIterator 创建迭代器，初始定位在第一个有效键
+func (bc *Bitcask) NewIterator() *Iterator {
+	iter := &Iterator{bc: bc, cur: bc.memTable.Seek(nil)}
+	iter.skip(iter.cur.Next)
+	return iter
+}
+
+// Seek 定位到第一个 >= key 的有效键
+func (iter *Iterator) Seek(key []byte) {
+	if iter.cur == nil {
+		return
+	}
+	iter.err = nil
+	iter.cur = iter.bc.memTable.Seek(key)
+	iter.skip(iter.cur.Next)
+}
+
+// Next 移动到下一个有效键
+func (iter *Iterator) Next() {
+	if !iter.Valid() {
+		return
+	}
+	iter.cur.Next()
+	iter.skip(iter.cur.Next)
+}
+
+// Prev 移动到上一个有效键
+func (iter *Iterator) Prev() {
+	if !iter.Valid() {
+		return
+	}
+	iter.cur.Prev()
+	iter.skip(iter.cur.Prev)
+}
+
+// Valid 当前位置是否有效
+func (iter *Iterator) Valid() bool {
+	return iter.err == nil && iter.cur != nil && iter.cur.Valid()
+}
+
+// Key 当前键
+func (iter *Iterator) Key() []byte {
+	if !iter.Valid() {
+		return nil
+	}
+	key, _ := iter.cur.Item()
+	return key
+}
+
+// Value 当前值
+func (iter *Iterator) Value() []byte {
+	if !iter.Valid() {
+		return nil
+	}
+	return iter.value
+}
+
+// Err 返回遍历过程中读取记录的错误
+func (iter *Iterator) Err() error {
+	return iter.err
+}
+
+// Close 释放迭代器持有的资源
+func (iter *Iterator) Close() error {
+	iter.value = nil
+	iter.cur = nil
+	return nil
+}
+
+// skip 读取当前记录，沿 move 方向跳过删除标记和已过期的记录
+func (iter *Iterator) skip(move func()) {
+	iter.value = nil
+	now := time.Now()
+	for iter.cur.Valid() {
+		// 游标中的位置是快照，Merge 之后改为读取索引中的最新位置
+		key, pos := iter.cur.Item()
+		rec, err := iter.bc.readSnapshot(scanEntry{key: key, pos: pos})
+		if err != nil {
+			iter.err = err
+			return
+		}
+		if rec != nil && !rec.IsDeleted() && !rec.IsExpired(now) {
+			iter.value = rec.Value
+			return
+		}
+		move()
+	}
+}
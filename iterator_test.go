@@ -0,0 +1,108 @@
+package bitcask
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aixiasang/bitcask/config"
+	"github.com/aixiasang/bitcask/utils"
+)
+
+func TestIterator(t *testing.T) {
+	for name, indexType := range map[string]config.IndexType{
+		"btree":   config.IndexTypeBTree,
+		"hashmap": config.IndexTypeHashMap,
+	} {
+		t.Run(name, func(t *testing.T) {
+			testDir, cleanup := setupTestDir(t)
+			defer cleanup()
+			conf := getTestConfig(testDir)
+			conf.Debug = false
+			conf.IndexType = indexType
+			db, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("创建数据库失败: %v", err)
+			}
+			defer db.Close()
+
+			for i := 10; i < 20; i++ {
+				if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			// 删除的键被跳过
+			if _, err := db.Delete(utils.GetKey(15)); err != nil {
+				t.Fatalf("删除失败: %v", err)
+			}
+
+			iter := db.NewIterator()
+			defer iter.Close()
+			count := 0
+			for ; iter.Valid(); iter.Next() {
+				if string(iter.Key()) == string(utils.GetKey(15)) {
+					t.Fatalf("迭代到已删除的键")
+				}
+				if string(iter.Value()) != "value-"+string(iter.Key())[4:] {
+					t.Fatalf("值不匹配: key=%s, value=%s", iter.Key(), iter.Value())
+				}
+				count++
+			}
+			if count != 9 || iter.Err() != nil {
+				t.Fatalf("迭代数量不正确: 期望 9, 实际 %d, err=%v", count, iter.Err())
+			}
+
+			// 键更长时排在所有两位数键之后
+			iter.Seek([]byte("key-100"))
+			if iter.Valid() {
+				t.Fatalf("定位到超过最大键的位置应当无效, 实际 key=%s", iter.Key())
+			}
+
+			// 定位到删除的键或缺失的键，落在下一个有效键
+			iter.Seek(utils.GetKey(15))
+			if !iter.Valid() || string(iter.Key()) != "key-16" {
+				t.Fatalf("定位到已删除的键: 期望 key-16, 实际 %s", iter.Key())
+			}
+			iter.Seek([]byte("key-"))
+			if !iter.Valid() || string(iter.Key()) != "key-10" {
+				t.Fatalf("定位到更短的键: 期望 key-10, 实际 %s", iter.Key())
+			}
+
+			// 双向移动，Prev 同样跳过删除的键
+			iter.Seek(utils.GetKey(16))
+			iter.Prev()
+			if !iter.Valid() || string(iter.Key()) != "key-14" {
+				t.Fatalf("Prev 期望 key-14, 实际 %s", iter.Key())
+			}
+			iter.Next()
+			if !iter.Valid() || string(iter.Key()) != "key-16" {
+				t.Fatalf("Next 期望 key-16, 实际 %s", iter.Key())
+			}
+		})
+	}
+}
+
+func TestIterator_EmptyDB(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	iter := db.NewIterator()
+	if iter.Valid() || iter.Key() != nil || iter.Value() != nil {
+		t.Fatalf("空数据库的迭代器应当无效")
+	}
+	iter.Next()
+	iter.Prev()
+	iter.Seek([]byte("any"))
+	if iter.Valid() {
+		t.Fatalf("空数据库的迭代器应当无效")
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatalf("关闭迭代器失败: %v", err)
+	}
+}
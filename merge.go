@@ -0,0 +1,478 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aixiasang/bitcask/config"
+	"github.com/aixiasang/bitcask/record"
+	"github.com/aixiasang/bitcask/wal"
+)
+
+// Merge 不修改原有文件：有效记录先写入 merge 目录下的新文件，连同对应的hint文件同步后写入提交标记，
+// 之后才把新文件移动到WAL目录并删除旧文件。启动时 merge 目录中没有提交标记说明合并没有完成，
+// 直接删除该目录，旧文件保持不变；有提交标记时重新完成移动和删除。重启后看到的总是合并前或合并后的完整状态
+
+const (
+	mergeDirName     = "merge"      // 合并结果的临时目录，位于 DataDir 下
+	mergeMarkerName  = "MERGE_DONE" // 提交标记，存在时合并结果必须生效
+	mergeMarkerMagic = 0x42434d47   // 提交标记魔数 "BCMG"
+)
+
+// 合并过程中可以注入故障的阶段，测试在这些位置中止合并来模拟崩溃
+const (
+	mergeStageWritten   = "written"   // 新文件和hint文件已写入 merge 目录，尚未提交
+	mergeStageCommitted = "committed" // 提交标记已写入，尚未移动文件
+	mergeStageMoved     = "moved"     // 新文件和hint文件已移动，旧文件尚未删除
+)
+
+// mergedEntry 合并时处理的一个键
+type mergedEntry struct {
+	key []byte
+	old record.Pos // 合并时读取的位置，交换时索引仍指向这里才更新
+	pos record.Pos // 新文件中的位置，删除标记和过期记录不会写入新文件
+}
+
+// mergedEntries 合并写入新文件的键，用于生成与新文件对应的hint文件
+type mergedEntries []mergedEntry
+
+func (m mergedEntries) Foreach(fn func(key []byte, pos *record.Pos) error) error {
+	for i := range m {
+		if err := fn(m[i].key, &m[i].pos); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeWriter 将合并的记录依次写入预留ID的新文件，超过 MaxFileSize 后换到下一个ID，
+// 预留的ID用完时继续写入最后一个文件
+type mergeWriter struct {
+	conf   *config.Config
+	dir    string
+	nextId uint32 // 下一个可用的预留ID
+	lastId uint32 // 最后一个预留ID
+	files  []*wal.Wal
+}
+
+func (m *mergeWriter) write(rec *record.Record) (*record.Pos, error) {
+	n := len(m.files)
+	if n == 0 || (m.files[n-1].Size() >= m.conf.MaxFileSize && m.nextId <= m.lastId) {
+		w, err := wal.NewWalIn(m.conf, m.dir, m.nextId)
+		if err != nil {
+			return nil, fmt.Errorf("创建合并文件失败: %v", err)
+		}
+		m.nextId++
+		m.files = append(m.files, w)
+	}
+	return m.files[len(m.files)-1].WriteRecordNoSync(rec)
+}
+
+func (m *mergeWriter) sync() error {
+	for _, w := range m.files {
+		if err := w.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close 关闭所有新文件，已经关闭过时不做任何事
+func (m *mergeWriter) close() {
+	for _, w := range m.files {
+		w.Close()
+	}
+	m.files = nil
+}
+
+func (m *mergeWriter) fileIds() []uint32 {
+	ids := make([]uint32, len(m.files))
+	for i, w := range m.files {
+		ids[i] = w.FileId()
+	}
+	return ids
+}
+
+// mergeMarker 提交标记的内容
+// 格式: [magic(4)][boundary(4)][count(4)][fileId(4)...][crc32(4)]，crc32覆盖magic之后的全部内容
+type mergeMarker struct {
+	boundary uint32   // 合并开始时的活跃文件ID，小于它的旧文件全部被新文件取代
+	fileIds  []uint32 // 新文件的ID，都小于 boundary
+}
+
+// write 先写入临时文件再重命名，提交标记要么完整存在，要么不存在
+func (m *mergeMarker) write(dir string) error {
+	buf := make([]byte, 12+4*len(m.fileIds)+4)
+	binary.BigEndian.PutUint32(buf[0:4], mergeMarkerMagic)
+	binary.BigEndian.PutUint32(buf[4:8], m.boundary)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(m.fileIds)))
+	for i, fileId := range m.fileIds {
+		binary.BigEndian.PutUint32(buf[12+4*i:], fileId)
+	}
+	binary.BigEndian.PutUint32(buf[len(buf)-4:], crc32.ChecksumIEEE(buf[4:len(buf)-4]))
+
+	path := filepath.Join(dir, mergeMarkerName)
+	fp, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fp.Write(buf); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := fp.Sync(); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// readMergeMarker 读取 dir 中的提交标记，不存在时返回 nil
+func readMergeMarker(dir string) (*mergeMarker, error) {
+	data, err := os.ReadFile(filepath.Join(dir, mergeMarkerName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 16 || binary.BigEndian.Uint32(data[0:4]) != mergeMarkerMagic {
+		return nil, errors.New("合并提交标记格式错误")
+	}
+	if stored, computed := binary.BigEndian.Uint32(data[len(data)-4:]), crc32.ChecksumIEEE(data[4:len(data)-4]); stored != computed {
+		return nil, fmt.Errorf("合并提交标记CRC校验失败, 存储的: %d, 计算的: %d", stored, computed)
+	}
+	count := binary.BigEndian.Uint32(data[8:12])
+	if uint64(len(data)) != 16+4*uint64(count) {
+		return nil, errors.New("合并提交标记长度错误")
+	}
+	m := &mergeMarker{boundary: binary.BigEndian.Uint32(data[4:8]), fileIds: make([]uint32, count)}
+	for i := range m.fileIds {
+		m.fileIds[i] = binary.BigEndian.Uint32(data[12+4*i:])
+	}
+	return m, nil
+}
+
+// syncDir 同步目录，确保其中文件的创建、重命名和删除已经持久化
+func syncDir(dir string) error {
+	fp, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return fp.Sync()
+}
+
+// injectMergeFault 测试设置了 mergeFault 时在 stage 处返回它的错误
+func (bc *Bitcask) injectMergeFault(stage string) error {
+	if bc.mergeFault == nil {
+		return nil
+	}
+	return bc.mergeFault(stage)
+}
+
+// Merge 合并WAL文件，删除冗余数据，提高效率
+func (bc *Bitcask) Merge() error {
+	if bc.conf.ReadOnly {
+		return ErrReadOnly
+	}
+	bc.mergeMu.Lock()
+	defer bc.mergeMu.Unlock()
+
+	// 封存活跃文件、选择被合并的文件和复制索引都在 writeMu 内完成，期间没有进行中的写入：
+	// 复制的索引只指向被合并的文件，之后的写入只会进入新的活跃文件和活跃blob文件
+	bc.writeMu.Lock()
+	// 为新文件预留ID：新文件必须排在合并开始后写入的文件之前，重放时之后的写入才能覆盖合并的记录。
+	// 有效记录不会多于被合并文件中的全部记录，新文件的数量一般不超过被合并的文件
+	bc.mu.Lock()
+	firstId := bc.nextFileId
+	reserved := uint32(len(bc.oldWal)) + 1
+	bc.nextFileId += reserved
+	bc.mu.Unlock()
+	if err := bc.mustRotate(); err != nil {
+		bc.writeMu.Unlock()
+		return err
+	}
+	// 轮转之前的所有文件（包括刚封存的活跃文件）中的有效记录都会被重写到新文件，
+	// 重写完成后这些文件全部删除
+	bc.mu.RLock()
+	mergeFileId := bc.fileId
+	var oldFileIds []uint32
+	for fileId := range bc.oldWal {
+		if fileId < mergeFileId {
+			oldFileIds = append(oldFileIds, fileId)
+		}
+	}
+	// 已封存的blob文件不会再被新的写入引用，合并后没有有效 value 的文件可以删除
+	var oldBlobIds []uint32
+	for fileId := range bc.blobs {
+		oldBlobIds = append(oldBlobIds, fileId)
+	}
+	bc.mu.RUnlock()
+	var entries []scanEntry
+	err := bc.memTable.Foreach(func(key []byte, pos *record.Pos) error {
+		entries = append(entries, scanEntry{key: key, pos: pos})
+		return nil
+	})
+	bc.writeMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("复制索引失败: %v", err)
+	}
+
+	// 上次失败的合并可能留下了未提交的文件
+	mergeDir := filepath.Join(bc.conf.DataDir, mergeDirName)
+	if err := os.RemoveAll(mergeDir); err != nil {
+		return fmt.Errorf("清理合并目录失败: %v", err)
+	}
+	if err := os.MkdirAll(mergeDir, 0755); err != nil {
+		return fmt.Errorf("创建合并目录失败: %v", err)
+	}
+	writer := &mergeWriter{conf: bc.conf, dir: mergeDir, nextId: firstId, lastId: firstId + reserved - 1}
+	defer writer.close()
+
+	// 旧文件全部删除后删除标记和过期记录不再需要，合并时从索引中清理
+	now := time.Now()
+	var merged, dropped mergedEntries
+	liveBlobs := make(map[uint32]struct{})
+	mergeEntry := func(key []byte, pos *record.Pos) error {
+		// 被合并的文件只有 Merge 自己会删除，读锁只用于与轮转修改文件列表互斥
+		bc.mu.RLock()
+		rec, err := bc.readRawRecord(pos)
+		bc.mu.RUnlock()
+		if err != nil {
+			return fmt.Errorf("读取WAL文件失败: %v", err)
+		}
+		if rec.IsDeleted() || rec.IsExpired(now) {
+			dropped = append(dropped, mergedEntry{key: key, old: *pos})
+			return nil
+		}
+		// 保留未过期记录的过期时间和写入时间
+		out := record.NewRecordWithExpire(key, rec.Value, rec.ExpireAt)
+		out.Timestamp = rec.Timestamp
+		if rec.IsBlobRef() {
+			// value 留在原来的blob文件中，只重写引用
+			ref, err := record.DecodeBlobRef(rec.Value)
+			if err != nil {
+				return fmt.Errorf("读取blob引用失败: %v", err)
+			}
+			liveBlobs[ref.FileId] = struct{}{}
+			out.RecordType = record.RecordTypeBlobPut
+		}
+		newPos, err := writer.write(out)
+		if err != nil {
+			return fmt.Errorf("写入数据失败: %v", err)
+		}
+		merged = append(merged, mergedEntry{key: key, old: *pos, pos: *newPos})
+		return nil
+	}
+	for _, entry := range entries {
+		if err := mergeEntry(entry.key, entry.pos); err != nil {
+			return fmt.Errorf("合并WAL文件失败: %v", err)
+		}
+	}
+	if writer.nextId > writer.lastId && writer.files[len(writer.files)-1].Size() > bc.conf.MaxFileSize {
+		bc.conf.Warnf("合并预留的文件ID不足，最后一个文件超过 MaxFileSize: %d 字节", writer.files[len(writer.files)-1].Size())
+	}
+
+	// 与新文件对应的hint文件随新文件一起生效：旧hint引用的文件即将删除，其中已删除的键的删除标记不会被重写
+	if err := writer.sync(); err != nil {
+		return fmt.Errorf("同步合并文件失败: %v", err)
+	}
+	bc.mu.RLock()
+	nextFileId := bc.nextFileId
+	bc.mu.RUnlock()
+	if _, err := writeHint(mergeDir, merged, bc.txnId.Load(), nextFileId); err != nil {
+		return fmt.Errorf("生成合并的hint文件失败: %w", err)
+	}
+	if err := bc.injectMergeFault(mergeStageWritten); err != nil {
+		return err
+	}
+	marker := &mergeMarker{boundary: mergeFileId, fileIds: writer.fileIds()}
+	if err := marker.write(mergeDir); err != nil {
+		return fmt.Errorf("写入合并提交标记失败: %v", err)
+	}
+	if err := bc.injectMergeFault(mergeStageCommitted); err != nil {
+		return err
+	}
+
+	// 持有 writeMu 交换索引，检查键是否在合并期间被修改与更新索引之间不会插入写入；
+	// 持有 bc.mu 写锁删除旧文件，并发的读取在交换之前或之后完成，不会读到已删除的文件
+	bc.writeMu.Lock()
+	bc.mu.Lock()
+	writer.close()
+	err = bc.moveMergedFiles(mergeDir, marker)
+	if err == nil {
+		err = bc.injectMergeFault(mergeStageMoved)
+	}
+	if err == nil {
+		err = bc.swapMerged(marker, oldFileIds, merged, dropped)
+	}
+	if err == nil {
+		// 引用这些blob文件的旧WAL文件已经删除，崩溃时不会留下指向已删除blob文件的记录
+		err = bc.removeDeadBlobs(oldBlobIds, liveBlobs)
+	}
+	bc.mu.Unlock()
+	bc.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(mergeDir); err != nil {
+		return fmt.Errorf("清理合并目录失败: %v", err)
+	}
+
+	// 合并的hint文件不包含合并期间的写入，重新生成完整的hint文件
+	if err := bc.Hint(); err != nil {
+		return fmt.Errorf("合并后生成hint文件失败: %w", err)
+	}
+	return nil
+}
+
+// swapMerged 打开已经移动到WAL目录的新文件，将索引切换到新位置并删除旧文件，调用方需要持有 bc.writeMu 和 bc.mu 写锁
+func (bc *Bitcask) swapMerged(marker *mergeMarker, oldFileIds []uint32, merged, dropped mergedEntries) error {
+	for _, fileId := range marker.fileIds {
+		w, err := wal.NewWal(bc.conf, fileId)
+		if err != nil {
+			return fmt.Errorf("打开合并文件 %d 失败: %w", fileId, err)
+		}
+		bc.oldWal[fileId] = w
+	}
+	// 合并期间重新写入或删除的键已经指向更新的记录，不能改回合并的记录
+	unchanged := func(entry *mergedEntry) bool {
+		pos, err := bc.memTable.Get(entry.key)
+		return err == nil && *pos == entry.old
+	}
+	for i := range merged {
+		if !unchanged(&merged[i]) {
+			continue
+		}
+		if err := bc.memTable.Put(merged[i].key, &merged[i].pos); err != nil {
+			return fmt.Errorf("更新索引失败: %v", err)
+		}
+	}
+	for i := range dropped {
+		if !unchanged(&dropped[i]) {
+			continue
+		}
+		if err := bc.memTable.Delete(dropped[i].key); err != nil {
+			return fmt.Errorf("清理删除标记失败: %v", err)
+		}
+	}
+	bc.dirty.Store(true)
+
+	for _, fileId := range oldFileIds {
+		if err := bc.oldWal[fileId].Delete(); err != nil {
+			return fmt.Errorf("删除WAL文件失败: %v", err)
+		}
+		delete(bc.oldWal, fileId)
+	}
+	if err := syncDir(filepath.Join(bc.conf.DataDir, bc.conf.WalDir)); err != nil {
+		return err
+	}
+
+	// 只保留新文件和合并期间产生的文件
+	fileIds := append([]uint32(nil), marker.fileIds...)
+	for _, fileId := range bc.fileIds {
+		if fileId >= marker.boundary {
+			fileIds = append(fileIds, fileId)
+		}
+	}
+	bc.fileIds = fileIds
+	return nil
+}
+
+// moveMergedFiles 将 merge 目录中的新文件和hint文件移动到WAL目录和hint目录，已经移动过的文件跳过
+func (bc *Bitcask) moveMergedFiles(mergeDir string, marker *mergeMarker) error {
+	walDir := filepath.Join(bc.conf.DataDir, bc.conf.WalDir)
+	hintDir := filepath.Join(bc.conf.DataDir, bc.conf.HintDir)
+	move := func(src, dst string) error {
+		if err := os.Rename(src, dst); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("移动合并文件失败: %v", err)
+		}
+		return nil
+	}
+	for _, fileId := range marker.fileIds {
+		if err := move(filepath.Join(mergeDir, wal.FileName(fileId)), filepath.Join(walDir, wal.FileName(fileId))); err != nil {
+			return err
+		}
+	}
+	if err := move(filepath.Join(mergeDir, "keys.hint"), filepath.Join(hintDir, "keys.hint")); err != nil {
+		return err
+	}
+	if err := syncDir(walDir); err != nil {
+		return err
+	}
+	return syncDir(hintDir)
+}
+
+// recoverMerge 在加载文件之前处理上次没有完成的合并：没有提交标记时丢弃合并结果，
+// 有提交标记时完成文件的移动和旧文件的删除
+func (bc *Bitcask) recoverMerge() error {
+	mergeDir := filepath.Join(bc.conf.DataDir, mergeDirName)
+	if _, err := os.Stat(mergeDir); os.IsNotExist(err) {
+		return nil
+	}
+	marker, err := readMergeMarker(mergeDir)
+	if err != nil {
+		return fmt.Errorf("读取合并提交标记失败: %v", err)
+	}
+	if bc.conf.ReadOnly {
+		if marker != nil {
+			return fmt.Errorf("存在已提交但未完成的合并，需要先以读写模式打开: %s", mergeDir)
+		}
+		return nil
+	}
+	if marker == nil {
+		bc.conf.Warnf("丢弃未完成的合并: %s", mergeDir)
+		return os.RemoveAll(mergeDir)
+	}
+
+	bc.conf.Infof("完成上次未完成的合并，替换文件ID小于 %d 的WAL文件", marker.boundary)
+	if err := bc.moveMergedFiles(mergeDir, marker); err != nil {
+		return err
+	}
+	walDir := filepath.Join(bc.conf.DataDir, bc.conf.WalDir)
+	files, err := os.ReadDir(walDir)
+	if err != nil {
+		return err
+	}
+	keep := make(map[uint32]struct{}, len(marker.fileIds))
+	for _, fileId := range marker.fileIds {
+		keep[fileId] = struct{}{}
+	}
+	var removed []uint32
+	for _, fp := range files {
+		name := fp.Name()
+		if !strings.HasPrefix(name, "wal-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		fileId, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "wal-"), ".log"), 10, 32)
+		if err != nil || uint32(fileId) >= marker.boundary {
+			continue
+		}
+		if _, ok := keep[uint32(fileId)]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(walDir, name)); err != nil {
+			return fmt.Errorf("删除WAL文件失败: %v", err)
+		}
+		removed = append(removed, uint32(fileId))
+	}
+	bc.conf.Debugf("合并恢复删除了旧WAL文件: %v", removed)
+	if err := syncDir(walDir); err != nil {
+		return err
+	}
+	return os.RemoveAll(mergeDir)
+}
@@ -0,0 +1,229 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// walFileNames 返回 WAL 目录下的文件名
+func walFileNames(t *testing.T, dir string) map[string]bool {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("读取WAL目录失败: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+	return names
+}
+
+// 测试合并在各个阶段崩溃后重新打开，数据与合并前完全相同；未提交的合并不修改原有文件
+func TestBitcask_MergeCrash(t *testing.T) {
+	for _, stage := range []string{mergeStageWritten, mergeStageCommitted, mergeStageMoved} {
+		t.Run(stage, func(t *testing.T) {
+			testDir, cleanup := setupTestDir(t)
+			defer cleanup()
+
+			conf := getTestConfig(testDir)
+			conf.Debug = false
+			db, err := NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("创建数据库失败: %v", err)
+			}
+			expected := make(map[string][]byte)
+			for round := 0; round < 3; round++ {
+				for i := 0; i < 200; i++ {
+					key := fmt.Sprintf("key-%d", i)
+					expected[key] = []byte(fmt.Sprintf("value-%d-%d", i, round))
+					if err := db.Put([]byte(key), expected[key]); err != nil {
+						t.Fatalf("写入失败: %v", err)
+					}
+				}
+			}
+			for i := 0; i < 200; i += 5 {
+				key := fmt.Sprintf("key-%d", i)
+				if _, err := db.Delete([]byte(key)); err != nil {
+					t.Fatalf("删除失败: %v", err)
+				}
+				delete(expected, key)
+			}
+			// 旧hint引用即将被替换的文件，崩溃后不能让它指向错误的记录
+			if err := db.Hint(); err != nil {
+				t.Fatalf("生成hint文件失败: %v", err)
+			}
+			walDir := filepath.Join(testDir, conf.WalDir)
+			before := walFileNames(t, walDir)
+
+			errCrash := errors.New("模拟崩溃")
+			db.mergeFault = func(s string) error {
+				if s == mergeStageWritten {
+					// 合并期间的写入进入之后的文件，重放时覆盖合并的记录
+					expected["key-1"] = []byte("during-merge")
+					if err := db.Put([]byte("key-1"), expected["key-1"]); err != nil {
+						return err
+					}
+					if _, err := db.Delete([]byte("key-2")); err != nil {
+						return err
+					}
+					delete(expected, "key-2")
+				}
+				if s == stage {
+					return errCrash
+				}
+				return nil
+			}
+			if err := db.Merge(); !errors.Is(err, errCrash) {
+				t.Fatalf("合并应在 %s 阶段中止, 实际错误: %v", stage, err)
+			}
+			simulateCrash(db)
+
+			verify := func(db *Bitcask, desc string) {
+				t.Helper()
+				for key, want := range expected {
+					value, err := db.GetE([]byte(key))
+					if err != nil || !bytes.Equal(value, want) {
+						t.Fatalf("%s %s 的值为 %q (err=%v), 期望 %q", desc, key, value, err, want)
+					}
+				}
+				count := 0
+				if err := db.Scan(func(key, value []byte) error {
+					count++
+					return nil
+				}); err != nil {
+					t.Fatalf("%s扫描失败: %v", desc, err)
+				}
+				if count != len(expected) {
+					t.Fatalf("%s有 %d 个键, 期望 %d 个", desc, count, len(expected))
+				}
+			}
+
+			db, err = NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("崩溃后重新打开失败: %v", err)
+			}
+			verify(db, "崩溃后")
+			if _, err := os.Stat(filepath.Join(testDir, mergeDirName)); !os.IsNotExist(err) {
+				t.Fatalf("重新打开后合并目录仍然存在: %v", err)
+			}
+			after := walFileNames(t, walDir)
+			for name := range before {
+				// 未提交时原有文件全部保留，提交后全部被新文件取代
+				if after[name] != (stage == mergeStageWritten) {
+					t.Fatalf("%s 阶段崩溃后原有文件 %s 是否存在: %v", stage, name, after[name])
+				}
+			}
+
+			// 恢复后可以正常合并，重新打开后数据不变
+			db.mergeFault = nil
+			if err := db.Merge(); err != nil {
+				t.Fatalf("恢复后合并失败: %v", err)
+			}
+			verify(db, "恢复后合并")
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭数据库失败: %v", err)
+			}
+			db, err = NewBitcask(conf)
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer db.Close()
+			verify(db, "重新打开后")
+		})
+	}
+}
+
+// 测试合并期间并发的写入和读取不会丢失或被合并的旧记录覆盖，读取不会遇到已删除的文件
+func TestBitcask_MergeConcurrentWrites(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	const writers = 4
+	const keys = 50 // 每个写协程独占的键数
+	const rounds = 1000
+	for i := 0; i < writers*keys; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("initial")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	var wg, mergeWg sync.WaitGroup
+	stop := make(chan struct{})
+	errCh := make(chan error, writers+1)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				key := []byte(fmt.Sprintf("key-%d", w*keys+i%keys))
+				if err := db.Put(key, []byte(fmt.Sprintf("value-%d", i))); err != nil {
+					errCh <- fmt.Errorf("写入失败: %v", err)
+					return
+				}
+				if _, err := db.GetE(key); err != nil {
+					errCh <- fmt.Errorf("读取 %s 失败: %v", key, err)
+					return
+				}
+			}
+		}(w)
+	}
+	mergeWg.Add(1)
+	go func() {
+		defer mergeWg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := db.Merge(); err != nil {
+				errCh <- fmt.Errorf("合并失败: %v", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	mergeWg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Fatal(err)
+	}
+
+	// 每个键最后一次写入的值
+	verify := func(db *Bitcask, desc string) {
+		t.Helper()
+		for w := 0; w < writers; w++ {
+			for k := 0; k < keys; k++ {
+				key := fmt.Sprintf("key-%d", w*keys+k)
+				want := fmt.Sprintf("value-%d", rounds-keys+k)
+				value, err := db.GetE([]byte(key))
+				if err != nil || string(value) != want {
+					t.Fatalf("%s %s 的值为 %q (err=%v), 期望 %q", desc, key, value, err, want)
+				}
+			}
+		}
+	}
+	verify(db, "合并后")
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	db, err = NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	verify(db, "重新打开后")
+}
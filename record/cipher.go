@@ -0,0 +1,46 @@
+package record
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// ErrDecrypt 表示记录解密失败（密钥错误、数据被篡改或未配置密钥）
+var ErrDecrypt = errors.New("record decrypt failed")
+
+// NewCipher 根据密钥创建 AES-GCM 加密器，密钥长度必须为 16、24 或 32 字节
+func NewCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 加密 value，输出为 nonce || 密文，记录的 key 作为附加数据参与认证
+func seal(aead cipher.AEAD, key, value []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return aead.Seal(nonce, nonce, value, key), nil
+}
+
+// open 解密 seal 生成的数据
+func open(aead cipher.AEAD, key, sealed []byte) ([]byte, error) {
+	if aead == nil {
+		return nil, fmt.Errorf("%w: record is encrypted but no encryption key is configured", ErrDecrypt)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrDecrypt)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	value, err := aead.Open(nil, nonce, ciphertext, key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return value, nil
+}
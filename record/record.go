@@ -2,10 +2,12 @@ package record
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"time"
 
 	"github.com/aixiasang/bitcask/utils"
 )
@@ -13,18 +15,190 @@ import (
 type RecordType uint8
 
 const (
-	RecordTypePut       RecordType = iota // 写入
-	RecordTypeDelete                      // 删除
-	RecordTypeBegin                       // 事务开始
-	RecordTypeTxnPut                      // 事务写入
-	RecordTypeTxnDelete                   // 事务删除
-	RecordTypeTxnCommit                   // 事务提交
+	RecordTypePut        RecordType = iota // 写入
+	RecordTypeDelete                       // 删除
+	RecordTypeBegin                        // 事务开始
+	RecordTypeTxnPut                       // 事务写入
+	RecordTypeTxnDelete                    // 事务删除
+	RecordTypeTxnCommit                    // 事务提交
+	RecordTypeBlobPut                      // 写入，value 保存在 blob 文件中，记录中只有 value 的位置
+	RecordTypeTxnBlobPut                   // 事务写入，value 保存在 blob 文件中
 )
 
+// ErrUnsupportedRecord 表示记录的类型不是当前版本能识别的类型，通常由更新的版本写入
+var ErrUnsupportedRecord = errors.New("unsupported record format")
+
+// Known 判断记录类型是否为当前版本能识别的类型
+func (t RecordType) Known() bool {
+	return t <= RecordTypeTxnBlobPut
+}
+
+// 记录格式：
+//
+//	v0: [type(1)][keyLen(4)][valueLen(4)][key][value][crc(4)]
+//	v1: [type|0x80(1)][keyLen(4)][valueLen(4)][expireAt(8)][key][value][crc(4)]
+//	v2: [type|0x10(1)][keyLen(4)][valueLen(4)][expireAt(8)?][timestamp(8)][key][value][crc(4)]
+//
+// 类型字节最高位为1表示头部包含过期时间（v1），没有过期时间的记录不写该字段；
+// 次高位为1表示 value 经过压缩；第三位为1表示 value 经过加密（nonce || 密文）；
+// 第四位为1表示头部包含写入时间戳（v2），时间戳位于过期时间之后，旧记录没有时间戳。
+// 解码时按标志位确定头部长度，因此同一个文件中可以混合存放各个版本的记录。
+//
+// 类型字节的高四位已全部用作标志位，之后新增格式需要使用低四位中尚未分配的记录类型（8~15）；
+// 旧版本读取到 CRC 正确但类型未知的记录时返回 ErrUnsupportedRecord，不会把它当作损坏数据丢弃
+const (
+	extendedFlag   byte = 0x80 // 类型字节中的过期时间标志
+	compressedFlag byte = 0x40 // 类型字节中的压缩标志
+	encryptedFlag  byte = 0x20 // 类型字节中的加密标志
+	timestampFlag  byte = 0x10 // 类型字节中的时间戳标志
+	flagMask            = extendedFlag | compressedFlag | encryptedFlag | timestampFlag
+	BaseHeaderSize      = 9  // v0 头部长度
+	MaxHeaderSize       = 25 // 同时包含过期时间和时间戳的头部长度
+	CrcSize             = 4  // CRC 长度
+	KeyOverhead         = 4  // 事务记录在 key 前附加的事务ID长度
+	ValueOverhead       = 28 // 加密后 value 增加的最大长度：nonce(12) + 认证标签(16)
+	BlobRefSize         = 12 // blob 引用记录的 value 长度：fileId(4) + offset(4) + length(4)
+)
+
+// Limits 解码时允许的键和值的最大长度（编码后的长度），超过时视为数据损坏
+type Limits struct {
+	MaxKeyLength   uint32
+	MaxValueLength uint32
+}
+
+// DefaultLimits 默认的解码长度上限，与 config.NewConfig 的 MaxKeySize/MaxValueSize 加上额外长度一致
+var DefaultLimits = Limits{
+	MaxKeyLength:   10*1024*1024 + KeyOverhead,
+	MaxValueLength: 100*1024*1024 + ValueOverhead,
+}
+
 type Record struct {
 	RecordType RecordType
 	Key        []byte
 	Value      []byte
+	ExpireAt   int64 // 过期时间（UnixNano），0 表示永不过期
+	Timestamp  int64 // 写入时间（UnixNano），0 表示旧格式记录没有时间戳
+	Compressed bool  // Value 是否为压缩后的数据
+}
+
+// Header 记录头部
+type Header struct {
+	RecordType  RecordType
+	KeyLength   uint32
+	ValueLength uint32
+	ExpireAt    int64
+	Timestamp   int64
+	Compressed  bool
+	Encrypted   bool
+	Size        uint32 // 头部长度
+}
+
+// HeaderSize 根据类型字节返回头部长度
+func HeaderSize(typeByte byte) uint32 {
+	size := uint32(BaseHeaderSize)
+	if typeByte&extendedFlag != 0 {
+		size += 8
+	}
+	if typeByte&timestampFlag != 0 {
+		size += 8
+	}
+	return size
+}
+
+// DecodeHeader 解析记录头部，buf 长度至少为 HeaderSize(buf[0])，
+// key 或 value 的长度超过 limits 时视为数据损坏
+func DecodeHeader(buf []byte, limits Limits) (*Header, error) {
+	if len(buf) < BaseHeaderSize {
+		return nil, errors.New("record header too short")
+	}
+	size := HeaderSize(buf[0])
+	if uint32(len(buf)) < size {
+		return nil, errors.New("record header too short")
+	}
+	h := &Header{
+		RecordType:  RecordType(buf[0] &^ flagMask),
+		KeyLength:   binary.BigEndian.Uint32(buf[1:5]),
+		ValueLength: binary.BigEndian.Uint32(buf[5:9]),
+		Compressed:  buf[0]&compressedFlag != 0,
+		Encrypted:   buf[0]&encryptedFlag != 0,
+		Size:        size,
+	}
+	offset := BaseHeaderSize
+	if buf[0]&extendedFlag != 0 {
+		h.ExpireAt = int64(binary.BigEndian.Uint64(buf[offset : offset+8]))
+		offset += 8
+	}
+	if buf[0]&timestampFlag != 0 {
+		h.Timestamp = int64(binary.BigEndian.Uint64(buf[offset : offset+8]))
+	}
+	if h.KeyLength > limits.MaxKeyLength || h.ValueLength > limits.MaxValueLength {
+		return nil, fmt.Errorf("key or value length too large: keyLength=%d, valueLength=%d", h.KeyLength, h.ValueLength)
+	}
+	return h, nil
+}
+
+// IsDeleted 判断记录是否为删除标记
+func (r *Record) IsDeleted() bool {
+	return r.RecordType == RecordTypeDelete || r.RecordType == RecordTypeTxnDelete
+}
+
+// IsBlobRef 判断记录的 value 是否为 blob 文件中的位置
+func (r *Record) IsBlobRef() bool {
+	return r.RecordType == RecordTypeBlobPut || r.RecordType == RecordTypeTxnBlobPut
+}
+
+// ToBlobRef 将写入记录转换为引用 blob 文件中 ref 位置的记录，value 替换为编码后的位置；
+// 其他类型的记录保持不变
+func (r *Record) ToBlobRef(ref *Pos) {
+	switch r.RecordType {
+	case RecordTypePut:
+		r.RecordType = RecordTypeBlobPut
+	case RecordTypeTxnPut:
+		r.RecordType = RecordTypeTxnBlobPut
+	default:
+		return
+	}
+	r.Value = EncodeBlobRef(ref)
+	r.Compressed = false
+}
+
+// ResolveBlob 用从 blob 文件读取的 value 替换引用，记录恢复为普通的写入记录
+func (r *Record) ResolveBlob(value []byte) {
+	switch r.RecordType {
+	case RecordTypeBlobPut:
+		r.RecordType = RecordTypePut
+	case RecordTypeTxnBlobPut:
+		r.RecordType = RecordTypeTxnPut
+	default:
+		return
+	}
+	r.Value = value
+}
+
+// EncodeBlobRef 编码 value 在 blob 文件中的位置
+func EncodeBlobRef(ref *Pos) []byte {
+	buf := make([]byte, BlobRefSize)
+	binary.BigEndian.PutUint32(buf[0:4], ref.FileId)
+	binary.BigEndian.PutUint32(buf[4:8], ref.Offset)
+	binary.BigEndian.PutUint32(buf[8:12], ref.Length)
+	return buf
+}
+
+// DecodeBlobRef 解析 blob 引用记录的 value
+func DecodeBlobRef(value []byte) (*Pos, error) {
+	if len(value) != BlobRefSize {
+		return nil, fmt.Errorf("invalid blob reference length: %d", len(value))
+	}
+	return &Pos{
+		FileId: binary.BigEndian.Uint32(value[0:4]),
+		Offset: binary.BigEndian.Uint32(value[4:8]),
+		Length: binary.BigEndian.Uint32(value[8:12]),
+	}, nil
+}
+
+// IsExpired 判断记录在 now 时刻是否已过期
+func (r *Record) IsExpired(now time.Time) bool {
+	return r.ExpireAt != 0 && now.UnixNano() >= r.ExpireAt
 }
 
 func NewRecord(key, value []byte) *Record {
@@ -33,6 +207,13 @@ func NewRecord(key, value []byte) *Record {
 	}
 	return newRecord(key, value, RecordTypePut)
 }
+
+// NewRecordWithExpire 创建带过期时间的写入记录
+func NewRecordWithExpire(key, value []byte, expireAt int64) *Record {
+	rec := NewRecord(key, value)
+	rec.ExpireAt = expireAt
+	return rec
+}
 func NewTxnRecord(key, value []byte) *Record {
 	if value == nil {
 		return newRecord(key, nil, RecordTypeTxnDelete)
@@ -53,20 +234,57 @@ func newRecord(key, value []byte, recordType RecordType) *Record {
 	}
 }
 func (r *Record) Encode() ([]byte, error) {
+	return r.EncodeWithCipher(nil)
+}
+
+// EncodeWithCipher 编码记录，aead 不为空时加密 value，CRC 覆盖密文
+func (r *Record) EncodeWithCipher(aead cipher.AEAD) ([]byte, error) {
+	value := r.Value
+	encrypted := aead != nil && len(value) > 0
+	if encrypted {
+		sealed, err := seal(aead, r.Key, value)
+		if err != nil {
+			return nil, err
+		}
+		value = sealed
+	}
 	buf := bytes.NewBuffer(nil)
-	if err := buf.WriteByte(byte(r.RecordType)); err != nil {
+	typeByte := byte(r.RecordType)
+	if r.ExpireAt != 0 {
+		typeByte |= extendedFlag
+	}
+	if r.Timestamp != 0 {
+		typeByte |= timestampFlag
+	}
+	if r.Compressed {
+		typeByte |= compressedFlag
+	}
+	if encrypted {
+		typeByte |= encryptedFlag
+	}
+	if err := buf.WriteByte(typeByte); err != nil {
 		return nil, errors.New("failed to write record type")
 	}
 	if err := binary.Write(buf, binary.BigEndian, uint32(len(r.Key))); err != nil {
 		return nil, errors.New("failed to write key length")
 	}
-	if err := binary.Write(buf, binary.BigEndian, uint32(len(r.Value))); err != nil {
+	if err := binary.Write(buf, binary.BigEndian, uint32(len(value))); err != nil {
 		return nil, errors.New("failed to write value length")
 	}
+	if r.ExpireAt != 0 {
+		if err := binary.Write(buf, binary.BigEndian, uint64(r.ExpireAt)); err != nil {
+			return nil, errors.New("failed to write expire time")
+		}
+	}
+	if r.Timestamp != 0 {
+		if err := binary.Write(buf, binary.BigEndian, uint64(r.Timestamp)); err != nil {
+			return nil, errors.New("failed to write timestamp")
+		}
+	}
 	if _, err := buf.Write(r.Key); err != nil {
 		return nil, errors.New("failed to write key")
 	}
-	if _, err := buf.Write(r.Value); err != nil {
+	if _, err := buf.Write(value); err != nil {
 		return nil, errors.New("failed to write value")
 	}
 	crc := crc32.ChecksumIEEE(buf.Bytes())
@@ -76,55 +294,57 @@ func (r *Record) Encode() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 func DecodeRecord(data []byte) (*Record, error) {
-	if len(data) < 9 { // 至少需要 1 字节类型 + 4 字节 key 长度 + 4 字节 value 长度
-		return nil, errors.New("record data too short")
-	}
-
-	recordType := RecordType(data[0])
-
-	var keyLength uint32
-	if err := binary.Read(bytes.NewReader(data[1:5]), binary.BigEndian, &keyLength); err != nil {
-		return nil, errors.New("failed to read key length")
-	}
+	return DecodeRecordWithCipher(data, nil, DefaultLimits)
+}
 
-	var valueLength uint32
-	if err := binary.Read(bytes.NewReader(data[5:9]), binary.BigEndian, &valueLength); err != nil {
-		return nil, errors.New("failed to read value length")
+// DecodeRecordWithCipher 解码记录，加密的 value 使用 aead 解密，长度超过 limits 视为数据损坏
+func DecodeRecordWithCipher(data []byte, aead cipher.AEAD, limits Limits) (*Record, error) {
+	if len(data) < BaseHeaderSize { // 至少需要 1 字节类型 + 4 字节 key 长度 + 4 字节 value 长度
+		return nil, errors.New("record data too short")
 	}
-
-	// 验证长度合理性
-	if keyLength > 10*1024*1024 || valueLength > 100*1024*1024 {
-		return nil, fmt.Errorf("key or value length too large: keyLength=%d, valueLength=%d", keyLength, valueLength)
+	header, err := DecodeHeader(data, limits)
+	if err != nil {
+		return nil, err
 	}
+	headerSize, keyLength, valueLength := header.Size, header.KeyLength, header.ValueLength
 
 	// 验证数据长度是否足够
-	expectedLength := 9 + keyLength + valueLength + 4 // header + key + value + crc
+	expectedLength := headerSize + keyLength + valueLength + CrcSize // header + key + value + crc
 	if uint32(len(data)) < expectedLength {
 		return nil, errors.New("record data incomplete")
 	}
 
 	// 读取 key 和 value
-	key := data[9 : 9+keyLength]
-	value := data[9+keyLength : 9+keyLength+valueLength]
+	key := data[headerSize : headerSize+keyLength]
+	value := data[headerSize+keyLength : headerSize+keyLength+valueLength]
 
 	// 验证 CRC
-	crcData := data[9+keyLength+valueLength:]
-	var storedCrc uint32
-	if err := binary.Read(bytes.NewReader(crcData), binary.BigEndian, &storedCrc); err != nil {
-		return nil, errors.New("failed to read crc")
-	}
+	storedCrc := binary.BigEndian.Uint32(data[headerSize+keyLength+valueLength : expectedLength])
 
 	// 计算 CRC
-	actualCrc := crc32.ChecksumIEEE(data[:9+keyLength+valueLength])
+	actualCrc := crc32.ChecksumIEEE(data[:headerSize+keyLength+valueLength])
 	if storedCrc != actualCrc {
 		return nil, errors.New("crc mismatch")
 	}
-	if recordType == RecordTypeTxnPut || recordType == RecordTypeTxnDelete {
+	if !header.RecordType.Known() {
+		return nil, fmt.Errorf("%w: type=%d", ErrUnsupportedRecord, header.RecordType)
+	}
+	// 解密使用原始 key（事务记录包含事务ID前缀）作为附加数据
+	if header.Encrypted {
+		if value, err = open(aead, key, value); err != nil {
+			return nil, err
+		}
+	}
+	recordType := header.RecordType
+	if recordType == RecordTypeTxnPut || recordType == RecordTypeTxnDelete || recordType == RecordTypeTxnBlobPut {
 		_, key = utils.DecodeTxnId(key)
 	}
 	return &Record{
 		RecordType: recordType,
 		Key:        key,
 		Value:      value,
+		ExpireAt:   header.ExpireAt,
+		Timestamp:  header.Timestamp,
+		Compressed: header.Compressed,
 	}, nil
 }
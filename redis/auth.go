@@ -0,0 +1,23 @@
+package redis
+
+import (
+	"crypto/subtle"
+
+	"github.com/tidwall/redcon"
+)
+
+// AUTH命令处理，密码正确时该连接之后可以执行其他命令
+func (s *Server) handleAuth(conn redcon.Conn, password []byte) {
+	if s.password == "" {
+		conn.WriteError("ERR Client sent AUTH, but no password is set")
+		return
+	}
+	// 按固定时间比较，避免通过响应时间猜测密码
+	if subtle.ConstantTimeCompare(password, []byte(s.password)) != 1 {
+		getConnState(conn).authed = false
+		conn.WriteError("ERR invalid password")
+		return
+	}
+	getConnState(conn).authed = true
+	conn.WriteString("OK")
+}
@@ -1,6 +1,8 @@
 package redis
 
 import (
+	"time"
+
 	"github.com/aixiasang/bitcask"
 	"github.com/spf13/cobra"
 )
@@ -9,6 +11,12 @@ var (
 	// Redis服务器地址标志
 	redisAddr string
 
+	// 后台清理过期键的间隔
+	redisSweepInterval time.Duration
+
+	// 连接密码，为空表示不需要认证
+	redisPassword string
+
 	// 创建Bitcask实例的函数
 	createBitcaskFunc func() (*bitcask.Bitcask, error)
 )
@@ -18,10 +26,11 @@ var redisCmd = &cobra.Command{
 	Use:   "redis",
 	Short: "启动Redis协议兼容服务器",
 	Long: `启动一个Redis协议兼容的服务器，允许使用标准Redis客户端直接连接到Bitcask。
-支持的Redis命令: GET, SET, DEL, KEYS, INFO, PING
+支持的Redis命令: AUTH, GET, SET, DEL, KEYS, SCAN, EXISTS, TYPE, RENAME, RENAMENX, PTTL, PERSIST, INFO, PING, SELECT, SWAPDB, DBSIZE, FLUSHDB, FLUSHALL, COMPACT, SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE, PUNSUBSCRIBE, PUBLISH, MSET, MGET, SETNX, GETSET, APPEND, STRLEN, GETRANGE, SETRANGE, INCR, DECR, INCRBY, DECRBY, HMGET, HLEN, HVALS, HINCRBY, MULTI, EXEC, DISCARD
 
 使用示例:
-  bitcask redis --addr :6379 --data-dir ./mydata`,
+  bitcask redis --addr :6379 --data-dir ./mydata
+  bitcask redis --addr :6379 --redis-password secret --data-dir ./mydata`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// 使用全局变量中存储的createBitcask函数
 		bc, err := createBitcaskFunc()
@@ -33,6 +42,8 @@ var redisCmd = &cobra.Command{
 
 		// 创建并启动Redis服务器
 		server := NewServer(bc, redisAddr)
+		server.SetExpireSweepInterval(redisSweepInterval)
+		server.SetPassword(redisPassword)
 		if err := server.Start(); err != nil {
 			cmd.PrintErrf("启动Redis服务器失败: %v\n", err)
 		}
@@ -46,6 +57,8 @@ func RegisterCommand(rootCmd *cobra.Command, createBitcask func() (*bitcask.Bitc
 
 	// 添加Redis特定标志
 	redisCmd.Flags().StringVar(&redisAddr, "addr", ":6379", "Redis服务器监听地址")
+	redisCmd.Flags().DurationVar(&redisSweepInterval, "expire-sweep-interval", DefaultExpireSweepInterval, "后台清理过期键的间隔，0表示只在访问时删除")
+	redisCmd.Flags().StringVar(&redisPassword, "redis-password", "", "连接密码，设置后客户端需要先执行 AUTH password")
 
 	// 添加命令到root
 	rootCmd.AddCommand(redisCmd)
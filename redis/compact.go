@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/redcon"
+)
+
+// memberPrefixes 复杂类型的成员键前缀及其所属的类型，成员键的格式为 前缀+键名+":"+成员
+var memberPrefixes = []struct {
+	prefix  string
+	keyType string
+}{
+	{ListItemPrefx, TypeList},
+	{HashFieldPrefx, TypeHash},
+	{SetMemberPrefx, TypeSet},
+	{ZSetScorePrefx, TypeZSet},
+	{ZSetMemberPrefx, TypeZSet},
+}
+
+// COMPACT命令处理，清理孤立的内部键后执行 Merge，返回清理的键数量
+func (s *Server) handleCompact(conn redcon.Conn) {
+	removed, err := s.compact()
+	if err != nil {
+		conn.WriteError(fmt.Sprintf("ERR %v", err))
+		return
+	}
+	conn.WriteInt(removed)
+}
+
+// compact 删除所属键已不存在的成员键、列表元数据和过期时间标记，然后执行 Merge
+// 回收这些键以及之前 DEL 留下的删除标记占用的空间
+func (s *Server) compact() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orphans, err := s.findOrphans()
+	if err != nil {
+		return 0, fmt.Errorf("扫描键失败: %v", err)
+	}
+	for _, key := range orphans {
+		if _, err := s.bc.Delete(key); err != nil {
+			return 0, fmt.Errorf("删除键失败: %v", err)
+		}
+	}
+	if err := s.bc.Merge(); err != nil {
+		return 0, fmt.Errorf("合并数据文件失败: %v", err)
+	}
+	return len(orphans), nil
+}
+
+// findOrphans 返回所属键已不存在的内部键
+//
+// 键名本身可能包含 ":"，成员键按每个 ":" 依次尝试拆分，只要其中一种拆分得到的键名
+// 存在且类型匹配就不是孤立的键
+func (s *Server) findOrphans() ([][]byte, error) {
+	types := make(map[string]string) // 键名 -> 类型标记中记录的类型
+	plain := make(map[string]bool)   // 没有内部前缀的字符串键
+	var internal []string
+	err := s.bc.Scan(func(key []byte, value []byte) error {
+		keyStr := string(key)
+		switch {
+		case strings.HasPrefix(keyStr, KeyTypePrefx):
+			types[keyStr[len(KeyTypePrefx):]] = string(value)
+		case isInternalKey(keyStr):
+			internal = append(internal, keyStr)
+		default:
+			plain[keyStr] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	owned := func(rest, keyType string) bool {
+		for i := 0; i < len(rest); i++ {
+			if rest[i] == ':' && types[rest[:i]] == keyType {
+				return true
+			}
+		}
+		return false
+	}
+
+	var orphans [][]byte
+	for _, key := range internal {
+		orphan := false
+		switch {
+		case strings.HasPrefix(key, ListMetaPrefx):
+			orphan = types[key[len(ListMetaPrefx):]] != TypeList
+		case strings.HasPrefix(key, KeyExpirePrefx):
+			name := key[len(KeyExpirePrefx):]
+			orphan = types[name] == "" && !plain[name]
+		default:
+			for _, p := range memberPrefixes {
+				if strings.HasPrefix(key, p.prefix) {
+					orphan = !owned(key[len(p.prefix):], p.keyType)
+					break
+				}
+			}
+		}
+		if orphan {
+			orphans = append(orphans, []byte(key))
+		}
+	}
+	return orphans, nil
+}
@@ -0,0 +1,250 @@
+package redis
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/redcon"
+)
+
+// numDatabases 逻辑数据库的数量，与 Redis 默认的 databases 16 一致
+const numDatabases = 16
+
+// 逻辑数据库通过键名前缀区分：db1 到 db15 的键名前加上 "db<n>:"，内部键的格式为 内部前缀+"db<n>:"+键名。
+// db0 的键不加前缀（兼容之前写入的数据），但以 "db" 开头的 db0 键加上 "db0:"，
+// 否则 db0 的 "db1:foo" 与 db1 的 "foo" 是同一个存储键
+const dbKeyPrefix = "db"
+
+// connState 连接上的状态，保存在 redcon.Conn 的上下文中
+type connState struct {
+	db     int       // 当前选择的数据库
+	authed bool      // 是否已通过 AUTH 认证
+	txn    *txnState // 未处于 MULTI 中时为nil
+}
+
+// getConnState 返回连接的状态，第一次访问时创建
+func getConnState(conn redcon.Conn) *connState {
+	state, _ := conn.Context().(*connState)
+	if state == nil {
+		state = &connState{}
+		conn.SetContext(state)
+	}
+	return state
+}
+
+// keySpec 命令参数中键的位置，与 Redis 命令表中的 firstkey/lastkey/step 含义相同，
+// last 为-1表示直到最后一个参数
+type keySpec struct {
+	first, last, step int
+}
+
+// keyCommands 带键参数的命令，选择非0数据库时这些位置上的参数会加上数据库前缀
+var keyCommands = map[string]keySpec{}
+
+func init() {
+	single := []string{
+		"GET", "SET", "SETNX", "GETSET", "APPEND", "STRLEN", "GETRANGE", "SETRANGE", "INCR", "DECR", "INCRBY", "DECRBY",
+		"EXPIRE", "EXPIREAT", "PEXPIRE", "PEXPIREAT", "SETEX", "TTL", "PTTL", "PERSIST", "TYPE",
+		"LPUSH", "RPUSH", "LPOP", "RPOP", "LLEN", "LRANGE", "LINDEX", "LSET", "LTRIM", "LREM",
+		"HSET", "HGET", "HDEL", "HGETALL", "HKEYS", "HEXISTS", "HMGET", "HLEN", "HVALS", "HINCRBY",
+		"SADD", "SREM", "SMEMBERS", "SISMEMBER", "SCARD", "SPOP",
+		"ZADD", "ZRANGE", "ZRANK", "ZSCORE", "ZREM", "ZCARD", "ZINCRBY", "ZRANGEBYSCORE", "ZREVRANGE",
+	}
+	for _, command := range single {
+		keyCommands[command] = keySpec{1, 1, 1}
+	}
+	for _, command := range []string{"DEL", "EXISTS", "MGET", "SINTER", "SUNION", "SDIFF"} {
+		keyCommands[command] = keySpec{1, -1, 1}
+	}
+	keyCommands["MSET"] = keySpec{1, -1, 2}
+	keyCommands["RENAME"] = keySpec{1, 2, 1}
+	keyCommands["RENAMENX"] = keySpec{1, 2, 1}
+}
+
+// dbKeyName 返回数据库中的键名对应的存储键名
+func dbKeyName(db int, name string) string {
+	if db == 0 && !strings.HasPrefix(name, dbKeyPrefix) {
+		return name
+	}
+	return dbKeyPrefix + strconv.Itoa(db) + ":" + name
+}
+
+// prefixKeys 为命令中的键参数加上当前数据库的前缀
+func prefixKeys(db int, command string, args [][]byte) {
+	spec, ok := keyCommands[command]
+	if !ok {
+		return
+	}
+	last := spec.last
+	if last < 0 {
+		last = len(args) - 1
+	}
+	for i := spec.first; i <= last && i < len(args); i += spec.step {
+		if db == 0 && !bytes.HasPrefix(args[i], []byte(dbKeyPrefix)) {
+			continue
+		}
+		args[i] = []byte(dbKeyName(db, string(args[i])))
+	}
+}
+
+// splitDBKey 将带前缀的键名拆分为数据库编号和客户端看到的键名
+func splitDBKey(name string) (int, string) {
+	if !strings.HasPrefix(name, dbKeyPrefix) {
+		return 0, name
+	}
+	end := strings.IndexByte(name, ':')
+	if end < 0 {
+		return 0, name
+	}
+	digits := name[len(dbKeyPrefix):end]
+	db, err := strconv.Atoi(digits)
+	// 只接受规范的写法，"db01:" 之类的键仍属于 db0
+	if err != nil || db < 0 || db >= numDatabases || strconv.Itoa(db) != digits {
+		return 0, name
+	}
+	// db0 只有以 "db" 开头的键才加前缀
+	if db == 0 && !strings.HasPrefix(name[end+1:], dbKeyPrefix) {
+		return 0, name
+	}
+	return db, name[end+1:]
+}
+
+// internalPrefixes 所有内部键前缀
+var internalPrefixes = []string{
+	KeyTypePrefx, KeyExpirePrefx, ListItemPrefx, ListMetaPrefx,
+	HashFieldPrefx, SetMemberPrefx, ZSetScorePrefx, ZSetMemberPrefx,
+}
+
+// splitRawKey 将存储中的键拆分为内部前缀（字符串键为空）、数据库编号和剩余部分
+func splitRawKey(raw string) (string, int, string) {
+	prefix := ""
+	for _, p := range internalPrefixes {
+		if strings.HasPrefix(raw, p) {
+			prefix = p
+			break
+		}
+	}
+	db, rest := splitDBKey(raw[len(prefix):])
+	return prefix, db, rest
+}
+
+// migrateDBKeys 为之前写入的、以 "db" 开头但不是数据库前缀的 db0 键加上 "db0:"，返回迁移的键数量。
+// 之前 db0 中以 "db<n>:" 开头的键与对应数据库的键无法区分，仍然属于该数据库
+func (s *Server) migrateDBKeys() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 先收集再修改，避免遍历过程中修改索引
+	var oldKeys []string
+	moved := make(map[string][]byte)
+	err := s.bc.Scan(func(key []byte, value []byte) error {
+		prefix, db, rest := splitRawKey(string(key))
+		if db != 0 || !strings.HasPrefix(rest, dbKeyPrefix) || len(prefix)+len(rest) != len(key) {
+			return nil
+		}
+		oldKeys = append(oldKeys, string(key))
+		moved[prefix+dbKeyName(0, rest)] = append([]byte(nil), value...)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("扫描键失败: %v", err)
+	}
+	for key, value := range moved {
+		if err := s.bc.Put([]byte(key), value); err != nil {
+			return 0, fmt.Errorf("写入键失败: %v", err)
+		}
+	}
+	for _, key := range oldKeys {
+		if _, err := s.bc.Delete([]byte(key)); err != nil {
+			return 0, fmt.Errorf("删除键失败: %v", err)
+		}
+	}
+	return len(oldKeys), nil
+}
+
+// parseDBIndex 解析数据库编号
+func parseDBIndex(arg []byte) (int, string) {
+	db, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, "ERR value is not an integer or out of range"
+	}
+	if db < 0 || db >= numDatabases {
+		return 0, "ERR DB index is out of range"
+	}
+	return db, ""
+}
+
+// SELECT命令处理，之后该连接上的命令都作用于选择的数据库
+func (s *Server) handleSelect(conn redcon.Conn, arg []byte) {
+	db, errMsg := parseDBIndex(arg)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+	getConnState(conn).db = db
+	conn.WriteString("OK")
+}
+
+// SWAPDB命令处理，交换两个数据库中的所有键（包括内部标记）
+//
+// 与 FLUSHDB 相同，交换通过逐个写入和删除完成，不是原子操作，执行期间其他连接可能看到部分交换的结果
+func (s *Server) handleSwapDB(conn redcon.Conn, arg1, arg2 []byte) {
+	a, errMsg := parseDBIndex(arg1)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+	b, errMsg := parseDBIndex(arg2)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+	if a == b {
+		conn.WriteString("OK")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 先收集再修改，避免遍历过程中修改索引
+	var oldKeys []string
+	moved := make(map[string][]byte)
+	err := s.bc.Scan(func(key []byte, value []byte) error {
+		prefix, db, rest := splitRawKey(string(key))
+		target := a
+		switch db {
+		case a:
+			target = b
+		case b:
+		default:
+			return nil
+		}
+		oldKeys = append(oldKeys, string(key))
+		moved[prefix+dbKeyName(target, rest)] = append([]byte(nil), value...)
+		return nil
+	})
+	if err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 扫描键失败: %v", err))
+		return
+	}
+	for key, value := range moved {
+		if err := s.bc.Put([]byte(key), value); err != nil {
+			conn.WriteError(fmt.Sprintf("ERR 写入键失败: %v", err))
+			return
+		}
+	}
+	// 交换后仍然存在的键已经被覆盖，只删除另一个数据库中没有对应键的键
+	for _, key := range oldKeys {
+		if _, ok := moved[key]; ok {
+			continue
+		}
+		if _, err := s.bc.Delete([]byte(key)); err != nil {
+			conn.WriteError(fmt.Sprintf("ERR 删除键失败: %v", err))
+			return
+		}
+	}
+	conn.WriteString("OK")
+}
@@ -1,7 +1,8 @@
 package redis
 
 import (
-	"strings"
+	"fmt"
+	"strconv"
 
 	"github.com/tidwall/redcon"
 )
@@ -9,6 +10,14 @@ import (
 // HSET命令处理
 func (s *Server) handleHSet(conn redcon.Conn, key []byte, args [][]byte) {
 	keyStr := string(key)
+	for i := 0; i+1 < len(args); i += 2 {
+		if !s.checkSize(conn, []byte(encodeHashKey(keyStr, string(args[i]))), args[i+1]) {
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// 检查键类型
 	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
@@ -75,6 +84,9 @@ func (s *Server) handleHGet(conn redcon.Conn, key []byte, field []byte) {
 
 // HDEL命令处理
 func (s *Server) handleHDel(conn redcon.Conn, key []byte, fields [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	keyStr := string(key)
 
 	// 检查键类型
@@ -90,11 +102,8 @@ func (s *Server) handleHDel(conn redcon.Conn, key []byte, fields [][]byte) {
 		fieldStr := string(field)
 		fieldKey := encodeHashKey(keyStr, fieldStr)
 
-		// 检查字段是否存在
-		_, ok := s.bc.Get([]byte(fieldKey))
-		if ok {
-			// 删除字段
-			s.bc.Delete([]byte(fieldKey))
+		// 仅统计实际存在的字段
+		if existed, err := s.bc.Delete([]byte(fieldKey)); err == nil && existed {
 			deleted++
 		}
 	}
@@ -122,15 +131,12 @@ func (s *Server) handleHGetAll(conn redcon.Conn, key []byte) {
 	prefix := HashFieldPrefx + keyStr + ":"
 	var fieldsAndValues [][]byte
 
-	s.bc.Scan(func(k []byte, v []byte) error {
-		kStr := string(k)
-		if strings.HasPrefix(kStr, prefix) {
-			// 提取字段名
-			field := kStr[len(prefix):]
+	s.bc.ScanPrefix([]byte(prefix), func(k []byte, v []byte) error {
+		// 提取字段名
+		field := k[len(prefix):]
 
-			// 添加字段和值到结果
-			fieldsAndValues = append(fieldsAndValues, []byte(field), v)
-		}
+		// 添加字段和值到结果
+		fieldsAndValues = append(fieldsAndValues, field, v)
 		return nil
 	})
 
@@ -156,13 +162,9 @@ func (s *Server) handleHKeys(conn redcon.Conn, key []byte) {
 	prefix := HashFieldPrefx + keyStr + ":"
 	var fields [][]byte
 
-	s.bc.Scan(func(k []byte, _ []byte) error {
-		kStr := string(k)
-		if strings.HasPrefix(kStr, prefix) {
-			// 提取字段名
-			field := kStr[len(prefix):]
-			fields = append(fields, []byte(field))
-		}
+	s.bc.ScanPrefix([]byte(prefix), func(k []byte, _ []byte) error {
+		// 提取字段名
+		fields = append(fields, k[len(prefix):])
 		return nil
 	})
 
@@ -194,16 +196,117 @@ func (s *Server) handleHExists(conn redcon.Conn, key []byte, field []byte) {
 	}
 }
 
+// HMGET命令处理，不存在的字段返回nil
+func (s *Server) handleHMGet(conn redcon.Conn, key []byte, fields [][]byte) {
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if ok && string(keyTypeBytes) != TypeHash {
+		conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return
+	}
+
+	conn.WriteArray(len(fields))
+	for _, field := range fields {
+		value, ok := s.bc.Get([]byte(encodeHashKey(keyStr, string(field))))
+		if !ok {
+			conn.WriteNull()
+			continue
+		}
+		conn.WriteBulk(value)
+	}
+}
+
+// HLEN命令处理
+func (s *Server) handleHLen(conn redcon.Conn, key []byte) {
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeHash {
+		conn.WriteInt(0)
+		return
+	}
+
+	conn.WriteInt(s.getHashFieldCount(keyStr))
+}
+
+// HVALS命令处理
+func (s *Server) handleHVals(conn redcon.Conn, key []byte) {
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeHash {
+		conn.WriteArray(0)
+		return
+	}
+
+	// 收集所有值
+	prefix := HashFieldPrefx + keyStr + ":"
+	var values [][]byte
+	s.bc.ScanPrefix([]byte(prefix), func(_ []byte, v []byte) error {
+		values = append(values, v)
+		return nil
+	})
+
+	conn.WriteArray(len(values))
+	for _, value := range values {
+		conn.WriteBulk(value)
+	}
+}
+
+// HINCRBY命令处理，字段不存在时视为0
+func (s *Server) handleHIncrBy(conn redcon.Conn, key, field []byte, delta int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, hasType := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if hasType && string(keyTypeBytes) != TypeHash {
+		conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return
+	}
+
+	fieldKey := []byte(encodeHashKey(keyStr, string(field)))
+	var current int64
+	if value, ok := s.bc.Get(fieldKey); ok {
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			conn.WriteError("ERR hash value is not an integer")
+			return
+		}
+		current = n
+	}
+
+	// 检查溢出
+	current, ok := addInt64(current, delta)
+	if !ok {
+		conn.WriteError("ERR increment or decrement would overflow")
+		return
+	}
+
+	if !hasType {
+		s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeHash))
+	}
+	if err := s.bc.Put(fieldKey, []byte(strconv.FormatInt(current, 10))); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 存储值失败: %v", err))
+		return
+	}
+	conn.WriteInt64(current)
+}
+
 // 获取哈希表字段数的辅助函数
 func (s *Server) getHashFieldCount(key string) int {
 	prefix := HashFieldPrefx + key + ":"
 	count := 0
 
 	// 扫描计数哈希字段
-	s.bc.Scan(func(k []byte, _ []byte) error {
-		if strings.HasPrefix(string(k), prefix) {
-			count++
-		}
+	s.bc.ScanPrefix([]byte(prefix), func(_ []byte, _ []byte) error {
+		count++
 		return nil
 	})
 
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"bytes"
 	"fmt"
 	"strconv"
 	"strings"
@@ -10,46 +11,23 @@ import (
 
 // LPUSH命令处理
 func (s *Server) handleLPush(conn redcon.Conn, key []byte, values [][]byte) {
-	keyStr := string(key)
-
-	// 检查键类型
-	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
-	if ok {
-		// 键已存在，检查类型
-		if string(keyTypeBytes) != TypeList {
-			conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
-			return
-		}
-	} else {
-		// 键不存在，设置类型为列表
-		s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeList))
-	}
-
-	// 获取当前列表长度
-	length := s.getListLength(keyStr)
-
-	// 在头部插入元素（前插法）
-	for i := len(values) - 1; i >= 0; i-- {
-		// 将值插入到索引0
-		for j := length; j > 0; j-- {
-			// 移动现有元素
-			oldValue, ok := s.bc.Get([]byte(encodeListKey(keyStr, j-1)))
-			if ok {
-				s.bc.Put([]byte(encodeListKey(keyStr, j)), oldValue)
-			}
-		}
-
-		// 插入新值到索引0
-		s.bc.Put([]byte(encodeListKey(keyStr, 0)), values[i])
-		length++
-	}
-
-	conn.WriteInt(length)
+	s.pushList(conn, string(key), values, true)
 }
 
 // RPUSH命令处理
 func (s *Server) handleRPush(conn redcon.Conn, key []byte, values [][]byte) {
-	keyStr := string(key)
+	s.pushList(conn, string(key), values, false)
+}
+
+// pushList 在头部或尾部写入元素，已有元素不需要移动
+func (s *Server) pushList(conn redcon.Conn, keyStr string, values [][]byte, left bool) {
+	for _, value := range values {
+		if !s.checkSize(conn, []byte(encodeListKey(keyStr, 0)), value) {
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// 检查键类型
 	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
@@ -64,66 +42,37 @@ func (s *Server) handleRPush(conn redcon.Conn, key []byte, values [][]byte) {
 		s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeList))
 	}
 
-	// 获取当前列表长度
-	length := s.getListLength(keyStr)
-
-	// 在尾部插入元素
+	meta := s.getListMeta(keyStr)
 	for _, value := range values {
-		s.bc.Put([]byte(encodeListKey(keyStr, length)), value)
-		length++
+		if left {
+			// 前插法：写入 head-1
+			meta.head--
+			s.bc.Put([]byte(encodeListKey(keyStr, meta.head)), value)
+		} else {
+			// 尾插法：写入 tail+1
+			meta.tail++
+			s.bc.Put([]byte(encodeListKey(keyStr, meta.tail)), value)
+		}
 	}
+	s.putListMeta(keyStr, meta)
 
-	conn.WriteInt(length)
+	conn.WriteInt(meta.length())
 }
 
 // LPOP命令处理
 func (s *Server) handleLPop(conn redcon.Conn, key []byte) {
-	keyStr := string(key)
-
-	// 检查键类型
-	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
-	if !ok || string(keyTypeBytes) != TypeList {
-		conn.WriteNull()
-		return
-	}
-
-	// 获取当前列表长度
-	length := s.getListLength(keyStr)
-
-	if length == 0 {
-		conn.WriteNull()
-		return
-	}
-
-	// 获取第一个元素
-	value, ok := s.bc.Get([]byte(encodeListKey(keyStr, 0)))
-	if !ok {
-		conn.WriteNull()
-		return
-	}
-
-	// 移动其他元素
-	for i := 0; i < length-1; i++ {
-		nextValue, ok := s.bc.Get([]byte(encodeListKey(keyStr, i+1)))
-		if ok {
-			s.bc.Put([]byte(encodeListKey(keyStr, i)), nextValue)
-		}
-	}
-
-	// 删除最后一个元素
-	s.bc.Delete([]byte(encodeListKey(keyStr, length-1)))
-
-	// 如果列表为空，删除类型标记
-	if length == 1 {
-		s.bc.Delete([]byte(encodeKeyType(keyStr)))
-	}
-
-	conn.WriteBulk(value)
+	s.popList(conn, string(key), true)
 }
 
 // RPOP命令处理
 func (s *Server) handleRPop(conn redcon.Conn, key []byte) {
-	keyStr := string(key)
+	s.popList(conn, string(key), false)
+}
+
+// popList 从头部或尾部弹出一个元素
+func (s *Server) popList(conn redcon.Conn, keyStr string, left bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// 检查键类型
 	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
@@ -132,28 +81,35 @@ func (s *Server) handleRPop(conn redcon.Conn, key []byte) {
 		return
 	}
 
-	// 获取当前列表长度
-	length := s.getListLength(keyStr)
-
-	if length == 0 {
+	meta := s.getListMeta(keyStr)
+	if meta.length() == 0 {
 		conn.WriteNull()
 		return
 	}
 
-	// 获取最后一个元素
-	lastIndex := length - 1
-	value, ok := s.bc.Get([]byte(encodeListKey(keyStr, lastIndex)))
+	index := meta.tail
+	if left {
+		index = meta.head
+	}
+	itemKey := []byte(encodeListKey(keyStr, index))
+	value, ok := s.bc.Get(itemKey)
 	if !ok {
 		conn.WriteNull()
 		return
 	}
+	s.bc.Delete(itemKey)
 
-	// 删除最后一个元素
-	s.bc.Delete([]byte(encodeListKey(keyStr, lastIndex)))
-
-	// 如果列表为空，删除类型标记
-	if length == 1 {
+	if left {
+		meta.head++
+	} else {
+		meta.tail--
+	}
+	if meta.length() == 0 {
+		// 如果列表为空，删除元数据和类型标记
+		s.bc.Delete([]byte(encodeListMeta(keyStr)))
 		s.bc.Delete([]byte(encodeKeyType(keyStr)))
+	} else {
+		s.putListMeta(keyStr, meta)
 	}
 
 	conn.WriteBulk(value)
@@ -171,8 +127,7 @@ func (s *Server) handleLLen(conn redcon.Conn, key []byte) {
 	}
 
 	// 获取列表长度
-	length := s.getListLength(keyStr)
-	conn.WriteInt(length)
+	conn.WriteInt(s.getListMeta(keyStr).length())
 }
 
 // LRANGE命令处理
@@ -187,7 +142,8 @@ func (s *Server) handleLRange(conn redcon.Conn, key, start, stop []byte) {
 	}
 
 	// 获取列表长度
-	length := s.getListLength(keyStr)
+	meta := s.getListMeta(keyStr)
+	length := meta.length()
 
 	// 解析开始和结束索引
 	startIdx, err := strconv.Atoi(string(start))
@@ -202,24 +158,9 @@ func (s *Server) handleLRange(conn redcon.Conn, key, start, stop []byte) {
 		return
 	}
 
-	// 处理负索引（从尾部计数）
-	if startIdx < 0 {
-		startIdx = length + startIdx
-	}
-	if stopIdx < 0 {
-		stopIdx = length + stopIdx
-	}
-
-	// 确保索引在有效范围内
-	if startIdx < 0 {
-		startIdx = 0
-	}
-	if stopIdx >= length {
-		stopIdx = length - 1
-	}
-
 	// 如果开始索引大于结束索引或超出范围，返回空数组
-	if startIdx > stopIdx || startIdx >= length {
+	startIdx, stopIdx, ok = normalizeListRange(startIdx, stopIdx, length)
+	if !ok {
 		conn.WriteArray(0)
 		return
 	}
@@ -227,7 +168,7 @@ func (s *Server) handleLRange(conn redcon.Conn, key, start, stop []byte) {
 	// 收集范围内的元素
 	elements := make([][]byte, 0, stopIdx-startIdx+1)
 	for i := startIdx; i <= stopIdx; i++ {
-		value, ok := s.bc.Get([]byte(encodeListKey(keyStr, i)))
+		value, ok := s.bc.Get([]byte(encodeListKey(keyStr, meta.head+i)))
 		if ok {
 			elements = append(elements, value)
 		}
@@ -240,24 +181,248 @@ func (s *Server) handleLRange(conn redcon.Conn, key, start, stop []byte) {
 	}
 }
 
-// 获取列表长度的辅助函数
-func (s *Server) getListLength(key string) int {
-	prefix := ListItemPrefx + key + ":"
-	length := 0
-
-	// 扫描计数列表元素
-	s.bc.Scan(func(k []byte, _ []byte) error {
-		if strings.HasPrefix(string(k), prefix) {
-			parts := strings.Split(string(k), ":")
-			if len(parts) == 2 {
-				idx, err := strconv.Atoi(parts[1])
-				if err == nil && idx >= length {
-					length = idx + 1
-				}
+// LINDEX命令处理，下标越界时返回nil
+func (s *Server) handleLIndex(conn redcon.Conn, key []byte, index int) {
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeList {
+		conn.WriteNull()
+		return
+	}
+
+	meta := s.getListMeta(keyStr)
+	index, ok = normalizeListIndex(index, meta.length())
+	if !ok {
+		conn.WriteNull()
+		return
+	}
+
+	value, ok := s.bc.Get([]byte(encodeListKey(keyStr, meta.head+index)))
+	if !ok {
+		conn.WriteNull()
+		return
+	}
+	conn.WriteBulk(value)
+}
+
+// LSET命令处理
+func (s *Server) handleLSet(conn redcon.Conn, key []byte, index int, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok {
+		conn.WriteError("ERR no such key")
+		return
+	}
+	if string(keyTypeBytes) != TypeList {
+		conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return
+	}
+
+	meta := s.getListMeta(keyStr)
+	index, ok = normalizeListIndex(index, meta.length())
+	if !ok {
+		conn.WriteError("ERR index out of range")
+		return
+	}
+
+	if !s.checkSize(conn, []byte(encodeListKey(keyStr, meta.head+index)), value) {
+		return
+	}
+	if err := s.bc.Put([]byte(encodeListKey(keyStr, meta.head+index)), value); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 存储值失败: %v", err))
+		return
+	}
+	conn.WriteString("OK")
+}
+
+// LTRIM命令处理，只保留 [start, stop] 区间内的元素
+func (s *Server) handleLTrim(conn redcon.Conn, key []byte, start, stop int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeList {
+		conn.WriteString("OK")
+		return
+	}
+
+	meta := s.getListMeta(keyStr)
+	start, stop, ok = normalizeListRange(start, stop, meta.length())
+	if !ok {
+		// 区间为空，删除整个列表
+		s.deleteListItems(keyStr, meta.head, meta.tail)
+		s.bc.Delete([]byte(encodeListMeta(keyStr)))
+		s.bc.Delete([]byte(encodeKeyType(keyStr)))
+		conn.WriteString("OK")
+		return
+	}
+
+	// 删除区间两侧的元素，保留的元素不需要移动
+	s.deleteListItems(keyStr, meta.head, meta.head+start-1)
+	s.deleteListItems(keyStr, meta.head+stop+1, meta.tail)
+	meta.head, meta.tail = meta.head+start, meta.head+stop
+	s.putListMeta(keyStr, meta)
+
+	conn.WriteString("OK")
+}
+
+// LREM命令处理
+// count > 0 从头部开始删除 count 个等于 value 的元素，count < 0 从尾部开始，count = 0 删除全部
+func (s *Server) handleLRem(conn redcon.Conn, key []byte, count int, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeList {
+		conn.WriteInt(0)
+		return
+	}
+
+	meta := s.getListMeta(keyStr)
+	elements := make([][]byte, 0, meta.length())
+	for i := meta.head; i <= meta.tail; i++ {
+		element, _ := s.bc.Get([]byte(encodeListKey(keyStr, i)))
+		elements = append(elements, element)
+	}
+
+	// 标记需要删除的元素
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := make([]bool, len(elements))
+	n := 0
+	for j := range elements {
+		i := j
+		if count < 0 {
+			i = len(elements) - 1 - j
+		}
+		if limit > 0 && n == limit {
+			break
+		}
+		if bytes.Equal(elements[i], value) {
+			removed[i] = true
+			n++
+		}
+	}
+	if n == 0 {
+		conn.WriteInt(0)
+		return
+	}
+
+	// 从 head 开始紧凑地重写剩余元素，并删除多出来的尾部
+	tail := meta.head - 1
+	for i, element := range elements {
+		if removed[i] {
+			continue
+		}
+		tail++
+		if tail != meta.head+i {
+			s.bc.Put([]byte(encodeListKey(keyStr, tail)), element)
+		}
+	}
+	s.deleteListItems(keyStr, tail+1, meta.tail)
+	meta.tail = tail
+
+	if meta.length() == 0 {
+		// 如果列表为空，删除元数据和类型标记
+		s.bc.Delete([]byte(encodeListMeta(keyStr)))
+		s.bc.Delete([]byte(encodeKeyType(keyStr)))
+	} else {
+		s.putListMeta(keyStr, meta)
+	}
+
+	conn.WriteInt(n)
+}
+
+// deleteListItems 删除下标在 [from, to] 区间内的元素
+func (s *Server) deleteListItems(key string, from, to int) {
+	for i := from; i <= to; i++ {
+		s.bc.Delete([]byte(encodeListKey(key, i)))
+	}
+}
+
+// normalizeListIndex 将负下标换算为从头部计数，返回下标是否有效
+func normalizeListIndex(index, length int) (int, bool) {
+	if index < 0 {
+		index = length + index
+	}
+	return index, index >= 0 && index < length
+}
+
+// normalizeListRange 处理负索引并截断到列表范围内，区间为空时返回false
+func normalizeListRange(start, stop, length int) (int, int, bool) {
+	// 处理负索引（从尾部计数）
+	if start < 0 {
+		start = length + start
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+
+	// 确保索引在有效范围内
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return start, stop, start <= stop && start < length
+}
+
+// listMeta 列表元数据，元素存放在 [head, tail] 区间内，空列表时 tail = head-1
+type listMeta struct {
+	head int
+	tail int
+}
+
+// length 列表长度
+func (m listMeta) length() int {
+	return m.tail - m.head + 1
+}
+
+// getListMeta 读取列表元数据
+//
+// 旧版本写入的列表没有元数据，元素下标从0开始连续存放，
+// 此时通过前缀扫描一次得到长度，下次写入时补上元数据。
+func (s *Server) getListMeta(key string) listMeta {
+	if data, ok := s.bc.Get([]byte(encodeListMeta(key))); ok {
+		parts := strings.SplitN(string(data), ":", 2)
+		if len(parts) == 2 {
+			head, err1 := strconv.Atoi(parts[0])
+			tail, err2 := strconv.Atoi(parts[1])
+			if err1 == nil && err2 == nil {
+				return listMeta{head: head, tail: tail}
 			}
 		}
+	}
+
+	prefix := ListItemPrefx + key + ":"
+	meta := listMeta{head: 0, tail: -1}
+	s.bc.ScanPrefix([]byte(prefix), func(k []byte, _ []byte) error {
+		idx, err := strconv.Atoi(string(k[len(prefix):]))
+		if err == nil && idx > meta.tail {
+			meta.tail = idx
+		}
 		return nil
 	})
+	return meta
+}
 
-	return length
+// putListMeta 写入列表元数据
+func (s *Server) putListMeta(key string, meta listMeta) {
+	s.bc.Put([]byte(encodeListMeta(key)), []byte(strconv.Itoa(meta.head)+":"+strconv.Itoa(meta.tail)))
 }
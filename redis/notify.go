@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aixiasang/bitcask"
+	"github.com/tidwall/redcon"
+)
+
+// 键空间通知的频道格式，%d 为键所在的数据库
+const (
+	keyspaceChannel = "__keyspace@%d__:"
+	keyeventChannel = "__keyevent@%d__:"
+)
+
+// SUBSCRIBE/PSUBSCRIBE命令处理，订阅后连接由 redcon 接管，只能再执行订阅相关命令、PING 和 QUIT
+func (s *Server) handleSubscribe(conn redcon.Conn, pattern bool, channels [][]byte) {
+	for _, channel := range channels {
+		if pattern {
+			s.pubsub.Psubscribe(conn, string(channel))
+		} else {
+			s.pubsub.Subscribe(conn, string(channel))
+		}
+	}
+}
+
+// UNSUBSCRIBE/PUNSUBSCRIBE命令处理。订阅后的连接由 redcon 处理这两个命令，
+// 这里只会收到没有任何订阅的连接发来的命令，按 Redis 的格式回复剩余订阅数为0
+func (s *Server) handleUnsubscribe(conn redcon.Conn, command string, channels [][]byte) {
+	kind := strings.ToLower(command)
+	if len(channels) == 0 {
+		conn.WriteArray(3)
+		conn.WriteBulkString(kind)
+		conn.WriteNull()
+		conn.WriteInt(0)
+		return
+	}
+	for _, channel := range channels {
+		conn.WriteArray(3)
+		conn.WriteBulkString(kind)
+		conn.WriteBulk(channel)
+		conn.WriteInt(0)
+	}
+}
+
+// PUBLISH命令处理，返回订阅方数量（redcon 统计时包含所有模式订阅）
+func (s *Server) handlePublish(conn redcon.Conn, channel, message []byte) {
+	conn.WriteInt(s.pubsub.Publish(string(channel), string(message)))
+}
+
+// keyspaceEvent 将存储引擎的变更转换为 Redis 的键空间事件，不对应用户可见变更的内部键返回 false
+//
+// 字符串键的写入和删除分别对应 set 和 del，写入过期时间标记对应 expire。
+// 列表、哈希、集合和有序集合的数据都存放在内部键中，不产生通知
+func keyspaceEvent(key string, op bitcask.OpType) (string, string, bool) {
+	if strings.HasPrefix(key, KeyExpirePrefx) {
+		if op != bitcask.EventPut {
+			return "", "", false
+		}
+		return key[len(KeyExpirePrefx):], "expire", true
+	}
+	if isInternalKey(key) {
+		return "", "", false
+	}
+	if op == bitcask.EventDelete {
+		return key, "del", true
+	}
+	return key, "set", true
+}
+
+// notifyKeyspace 向 __keyspace@<db>__:<key> 发布事件名，向 __keyevent@<db>__:<event> 发布键名
+func (s *Server) notifyKeyspace(key []byte, op bitcask.OpType) {
+	name, event, ok := keyspaceEvent(string(key), op)
+	if !ok {
+		return
+	}
+	db, name := splitDBKey(name)
+	s.pubsub.Publish(fmt.Sprintf(keyspaceChannel, db)+name, event)
+	s.pubsub.Publish(fmt.Sprintf(keyeventChannel, db)+event, name)
+}
@@ -0,0 +1,104 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/tidwall/redcon"
+)
+
+// RENAME/RENAMENX命令处理，nx 为 true 时只在 dst 不存在时重命名并返回1，否则返回0；
+// RENAME 会先删除已存在的 dst，过期时间随键一起移动
+func (s *Server) handleRename(conn redcon.Conn, src, dst []byte, nx bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	srcStr, dstStr := string(src), string(dst)
+	if s.checkAndRemoveExpired(srcStr) || !s.keyExists(srcStr) {
+		conn.WriteError("ERR no such key")
+		return
+	}
+	if srcStr == dstStr {
+		if nx {
+			conn.WriteInt(0)
+		} else {
+			conn.WriteString("OK")
+		}
+		return
+	}
+
+	s.checkAndRemoveExpired(dstStr)
+	if s.keyExists(dstStr) {
+		if nx {
+			conn.WriteInt(0)
+			return
+		}
+		s.removeKey(dstStr)
+	}
+
+	if err := s.renameKey(srcStr, dstStr); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 重命名失败: %v", err))
+		return
+	}
+	if nx {
+		conn.WriteInt(1)
+	} else {
+		conn.WriteString("OK")
+	}
+}
+
+// renameKey 把 src 的值（复杂类型为所有成员键和列表元数据）、类型标记和过期时间标记移动到 dst，dst 必须不存在
+func (s *Server) renameKey(src, dst string) error {
+	moved := make(map[string][]byte) // 新键 -> 值
+	var oldKeys []string
+	move := func(oldKey, newKey string) {
+		if value, ok := s.bc.Get([]byte(oldKey)); ok {
+			oldKeys = append(oldKeys, oldKey)
+			moved[newKey] = value
+		}
+	}
+
+	keyType := TypeString
+	if keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(src))); ok {
+		keyType = string(keyTypeBytes)
+	}
+	move(encodeKeyType(src), encodeKeyType(dst))
+	move(encodeKeyExpire(src), encodeKeyExpire(dst))
+	switch keyType {
+	case TypeString:
+		move(src, dst)
+	case TypeList:
+		move(encodeListMeta(src), encodeListMeta(dst))
+	}
+
+	// 成员键的格式为 前缀+键名+":"+成员，与 deleteMembers 相同地按前缀查找
+	for _, p := range memberPrefixes {
+		if p.keyType != keyType {
+			continue
+		}
+		from := p.prefix + src + ":"
+		err := s.bc.ScanPrefix([]byte(from), func(key []byte, value []byte) error {
+			oldKeys = append(oldKeys, string(key))
+			moved[p.prefix+dst+":"+string(key[len(from):])] = append([]byte(nil), value...)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// 先写入新键再删除旧键，中途失败时不会丢失数据；与新键同名的旧键已被覆盖，不能删除
+	for key, value := range moved {
+		if err := s.bc.Put([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	for _, key := range oldKeys {
+		if _, ok := moved[key]; ok {
+			continue
+		}
+		if _, err := s.bc.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
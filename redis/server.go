@@ -1,12 +1,17 @@
 package redis
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -14,40 +19,85 @@ import (
 	"github.com/tidwall/redcon"
 )
 
+// DefaultExpireSweepInterval 默认的过期键清理间隔
+const DefaultExpireSweepInterval = time.Second
+
+// maxStringSize 字符串值的最大长度，与 Redis 的 proto-max-bulk-len 默认值相同，
+// 实际可写入的长度还受存储引擎 MaxValueSize 的限制
+const maxStringSize = 512 * 1024 * 1024
+
 // Server 表示Redis协议兼容的服务器
 type Server struct {
-	bc        *bitcask.Bitcask
-	addr      string
-	redServer *redcon.Server
-	closeChan chan struct{}
+	bc            *bitcask.Bitcask
+	addr          string
+	redServer     *redcon.Server
+	closeChan     chan struct{}
+	mu            sync.Mutex     // 保证 INCR 等读-改-写命令在多个连接间的原子性
+	sweepInterval time.Duration  // 后台清理过期键的间隔，<=0 表示只在访问时惰性删除
+	bgWg          sync.WaitGroup // 等待后台任务退出
+	pubsub        redcon.PubSub  // SUBSCRIBE/PUBLISH 以及键空间通知
+	stopNotify    func()         // 取消注册键空间通知的变更回调
+	password      string         // 非空时连接需要先执行 AUTH
+
+	// INFO 统计信息
+	startTime        time.Time    // 服务启动时间
+	connectedClients atomic.Int64 // 当前连接数
+	totalCommands    atomic.Int64 // 已处理的命令总数
 }
 
 // NewServer 创建新的Redis服务器
 func NewServer(bc *bitcask.Bitcask, addr string) *Server {
-	return &Server{
-		bc:        bc,
-		addr:      addr,
-		closeChan: make(chan struct{}),
+	s := &Server{
+		bc:            bc,
+		addr:          addr,
+		closeChan:     make(chan struct{}),
+		sweepInterval: DefaultExpireSweepInterval,
 	}
+	// 字符串键的变更发布为键空间通知，Stop 或关闭 Bitcask 时取消
+	s.stopNotify = bc.OnChange(s.notifyKeyspace)
+	return s
+}
+
+// SetExpireSweepInterval 设置后台清理过期键的间隔，需要在 Start 之前调用，<=0 表示关闭后台清理
+func (s *Server) SetExpireSweepInterval(interval time.Duration) {
+	s.sweepInterval = interval
+}
+
+// SetPassword 设置连接密码（相当于 Redis 的 requirepass），需要在 Start 之前调用，为空表示不需要认证
+func (s *Server) SetPassword(password string) {
+	s.password = password
 }
 
 // Start 启动Redis服务器
 func (s *Server) Start() error {
 	// 打印启动信息
 	fmt.Printf("Redis兼容服务已启动，监听地址: %s\n", s.addr)
+	s.startTime = time.Now()
 	fmt.Println("可以使用标准Redis客户端进行连接")
-	fmt.Println("支持的命令: GET, SET, DEL, KEYS, INFO, PING")
-	fmt.Println("以及: EXPIRE, TTL, LPUSH, RPUSH, LPOP, RPOP, LLEN, LRANGE")
-	fmt.Println("哈希命令: HSET, HGET, HDEL, HGETALL, HKEYS, HEXISTS")
-	fmt.Println("集合命令: SADD, SREM, SMEMBERS, SISMEMBER")
-	fmt.Println("有序集合: ZADD, ZRANGE, ZRANK, ZSCORE")
+	fmt.Println("支持的命令: AUTH, GET, SET, DEL, KEYS, SCAN, INFO, PING, SELECT, SWAPDB, DBSIZE, FLUSHDB, FLUSHALL, COMPACT")
+	fmt.Println("字符串命令: MSET, MGET, SETNX, GETSET, APPEND, STRLEN, GETRANGE, SETRANGE")
+	fmt.Println("数值命令: INCR, DECR, INCRBY, DECRBY")
+	fmt.Println("以及: EXISTS, TYPE, RENAME, RENAMENX, EXPIRE, EXPIREAT, PEXPIRE, PEXPIREAT, SETEX, TTL, PTTL, PERSIST, LPUSH, RPUSH, LPOP, RPOP, LLEN, LRANGE, LINDEX, LSET, LTRIM, LREM")
+	fmt.Println("哈希命令: HSET, HGET, HDEL, HGETALL, HKEYS, HEXISTS, HMGET, HLEN, HVALS, HINCRBY")
+	fmt.Println("集合命令: SADD, SREM, SMEMBERS, SISMEMBER, SCARD, SPOP, SINTER, SUNION, SDIFF")
+	fmt.Println("有序集合: ZADD, ZRANGE, ZRANK, ZSCORE, ZREM, ZCARD, ZINCRBY, ZRANGEBYSCORE, ZREVRANGE")
+	fmt.Println("事务命令: MULTI, EXEC, DISCARD（事务中支持 GET, SET, MSET, MGET, DEL, INCR, DECR, INCRBY, DECRBY）")
+	fmt.Println("发布订阅: SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE, PUNSUBSCRIBE, PUBLISH（支持 __keyspace@<db>__:* 和 __keyevent@<db>__:* 键空间通知）")
 	fmt.Println("按 Ctrl+C 可安全退出服务")
 
+	// 之前写入的以 "db" 开头的 db0 键需要加上前缀才能与其他数据库的键区分
+	if n, err := s.migrateDBKeys(); err != nil {
+		return fmt.Errorf("迁移db0的键失败: %v", err)
+	} else if n > 0 {
+		log.Printf("已为 %d 个以 db 开头的 db0 键加上 db0: 前缀", n)
+	}
+
 	// 创建一个redcon服务器
 	s.redServer = redcon.NewServer(s.addr, s.handleCommand,
 		func(conn redcon.Conn) bool {
 			// 连接接受回调
 			log.Printf("Redis客户端已连接: %s", conn.RemoteAddr())
+			s.connectedClients.Add(1)
 			return true
 		},
 		func(conn redcon.Conn, err error) {
@@ -56,12 +106,19 @@ func (s *Server) Start() error {
 				log.Printf("Redis客户端连接错误: %v", err)
 			}
 			log.Printf("Redis客户端已断开连接: %s", conn.RemoteAddr())
+			s.connectedClients.Add(-1)
 		},
 	)
 
 	// 处理系统信号以优雅关闭
 	go s.handleSignals()
 
+	// 定期清理从未被访问的过期键
+	if s.sweepInterval > 0 {
+		s.bgWg.Add(1)
+		go s.runExpireSweeper()
+	}
+
 	// 启动服务器
 	err := s.redServer.ListenAndServe()
 	if err != nil {
@@ -77,9 +134,55 @@ func (s *Server) Stop() error {
 	if s.redServer != nil {
 		s.redServer.Close()
 	}
+	s.stopNotify()
+	// 等待后台清理退出，之后调用方可以安全地关闭 Bitcask
+	s.bgWg.Wait()
 	return nil
 }
 
+// runExpireSweeper 按 sweepInterval 定期清理过期键，closeChan 关闭时退出
+func (s *Server) runExpireSweeper() {
+	defer s.bgWg.Done()
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.sweepExpired(); err != nil {
+				log.Printf("后台清理过期键失败: %v", err)
+			}
+		case <-s.closeChan:
+			return
+		}
+	}
+}
+
+// sweepExpired 扫描所有过期时间标记，删除已过期的键及其数据，返回删除的键数量
+func (s *Server) sweepExpired() (int, error) {
+	var expired []string
+	err := s.bc.ScanPrefix([]byte(KeyExpirePrefx), func(key []byte, value []byte) error {
+		if isExpired(value) {
+			expired = append(expired, strings.TrimPrefix(string(key), KeyExpirePrefx))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 加锁后重新检查，期间被重新设置过期时间的键不会被删除
+	removed := 0
+	for _, key := range expired {
+		if s.checkAndRemoveExpired(key) {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
 // 处理操作系统信号
 func (s *Server) handleSignals() {
 	sigChan := make(chan os.Signal, 1)
@@ -94,18 +197,85 @@ func (s *Server) handleSignals() {
 func (s *Server) handleCommand(conn redcon.Conn, cmd redcon.Command) {
 	// 将命令转为大写
 	command := strings.ToUpper(string(cmd.Args[0]))
+	s.totalCommands.Add(1)
 
 	// 不再在这里检查键是否过期，而是在各个命令处理函数中检查
 	// 这样可以避免不必要的检查，并且确保在需要的时候进行检查
 
+	// 设置了密码时，认证之前只能执行 AUTH 和 QUIT
+	state := getConnState(conn)
+	if s.password != "" && !state.authed && command != "AUTH" && command != "QUIT" {
+		conn.WriteError("NOAUTH Authentication required.")
+		return
+	}
+
+	// 键参数加上当前数据库的前缀，事务中入队的命令也使用入队时选择的数据库
+	prefixKeys(state.db, command, cmd.Args)
+
+	// 处于 MULTI 中时，除事务控制命令外的命令都进入队列
+	if state.txn != nil {
+		switch command {
+		case "MULTI", "EXEC", "DISCARD", "QUIT":
+		default:
+			s.queueCommand(conn, state.txn, command, cmd.Args)
+			return
+		}
+	}
+
 	switch command {
 	case "PING":
 		conn.WriteString("PONG")
 	case "QUIT":
 		conn.WriteString("OK")
 		conn.Close()
+	case "AUTH":
+		if len(cmd.Args) != 2 {
+			conn.WriteError("ERR AUTH命令需要一个参数")
+			return
+		}
+		s.handleAuth(conn, cmd.Args[1])
 	case "INFO":
 		s.handleInfo(conn)
+	case "DBSIZE":
+		s.handleDBSize(conn)
+	case "SELECT":
+		if len(cmd.Args) != 2 {
+			conn.WriteError("ERR SELECT命令需要一个参数")
+			return
+		}
+		s.handleSelect(conn, cmd.Args[1])
+	case "SWAPDB":
+		if len(cmd.Args) != 3 {
+			conn.WriteError("ERR SWAPDB命令需要两个参数")
+			return
+		}
+		s.handleSwapDB(conn, cmd.Args[1], cmd.Args[2])
+	case "MULTI":
+		s.handleMulti(conn)
+	case "EXEC":
+		s.handleExec(conn)
+	case "DISCARD":
+		s.handleDiscard(conn)
+	case "FLUSHDB":
+		s.handleFlushDB(conn)
+	case "FLUSHALL":
+		s.handleFlushAll(conn)
+	case "COMPACT":
+		s.handleCompact(conn)
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		if len(cmd.Args) < 2 {
+			conn.WriteError(fmt.Sprintf("ERR %s命令需要至少一个参数", command))
+			return
+		}
+		s.handleSubscribe(conn, command == "PSUBSCRIBE", cmd.Args[1:])
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		s.handleUnsubscribe(conn, command, cmd.Args[1:])
+	case "PUBLISH":
+		if len(cmd.Args) != 3 {
+			conn.WriteError("ERR PUBLISH命令需要两个参数")
+			return
+		}
+		s.handlePublish(conn, cmd.Args[1], cmd.Args[2])
 
 	// 字符串命令
 	case "GET":
@@ -133,20 +303,159 @@ func (s *Server) handleCommand(conn redcon.Conn, cmd redcon.Command) {
 			return
 		}
 		s.handleKeys(conn, cmd.Args[1])
+	case "SCAN":
+		if len(cmd.Args) < 2 {
+			conn.WriteError("ERR SCAN命令需要至少一个参数")
+			return
+		}
+		s.handleScan(conn, cmd.Args[1:])
+	case "EXISTS":
+		if len(cmd.Args) < 2 {
+			conn.WriteError("ERR EXISTS命令需要至少一个参数")
+			return
+		}
+		s.handleExists(conn, cmd.Args[1:])
+	case "TYPE":
+		if len(cmd.Args) != 2 {
+			conn.WriteError("ERR TYPE命令需要一个参数")
+			return
+		}
+		s.handleType(conn, cmd.Args[1])
+	case "MSET":
+		if len(cmd.Args) < 3 || len(cmd.Args)%2 != 1 {
+			conn.WriteError("ERR MSET命令需要成对的键值参数")
+			return
+		}
+		s.handleMSet(conn, cmd.Args[1:])
+	case "MGET":
+		if len(cmd.Args) < 2 {
+			conn.WriteError("ERR MGET命令需要至少一个参数")
+			return
+		}
+		s.handleMGet(conn, cmd.Args[1:])
+	case "SETNX":
+		if len(cmd.Args) != 3 {
+			conn.WriteError("ERR SETNX命令需要两个参数")
+			return
+		}
+		s.handleSetNX(conn, cmd.Args[1], cmd.Args[2])
+	case "GETSET":
+		if len(cmd.Args) != 3 {
+			conn.WriteError("ERR GETSET命令需要两个参数")
+			return
+		}
+		s.handleGetSet(conn, cmd.Args[1], cmd.Args[2])
+	case "APPEND":
+		if len(cmd.Args) != 3 {
+			conn.WriteError("ERR APPEND命令需要两个参数")
+			return
+		}
+		s.handleAppend(conn, cmd.Args[1], cmd.Args[2])
+	case "STRLEN":
+		if len(cmd.Args) != 2 {
+			conn.WriteError("ERR STRLEN命令需要一个参数")
+			return
+		}
+		s.handleStrLen(conn, cmd.Args[1])
+	case "GETRANGE":
+		if len(cmd.Args) != 4 {
+			conn.WriteError("ERR GETRANGE命令需要三个参数")
+			return
+		}
+		start, err1 := strconv.Atoi(string(cmd.Args[2]))
+		end, err2 := strconv.Atoi(string(cmd.Args[3]))
+		if err1 != nil || err2 != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		s.handleGetRange(conn, cmd.Args[1], start, end)
+	case "SETRANGE":
+		if len(cmd.Args) != 4 {
+			conn.WriteError("ERR SETRANGE命令需要三个参数")
+			return
+		}
+		offset, err := strconv.Atoi(string(cmd.Args[2]))
+		if err != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		if offset < 0 {
+			conn.WriteError("ERR offset is out of range")
+			return
+		}
+		s.handleSetRange(conn, cmd.Args[1], offset, cmd.Args[3])
+	case "INCR", "DECR":
+		if len(cmd.Args) != 2 {
+			conn.WriteError(fmt.Sprintf("ERR %s命令需要一个参数", command))
+			return
+		}
+		delta := int64(1)
+		if command == "DECR" {
+			delta = -1
+		}
+		s.handleIncrBy(conn, cmd.Args[1], delta)
+	case "INCRBY", "DECRBY":
+		if len(cmd.Args) != 3 {
+			conn.WriteError(fmt.Sprintf("ERR %s命令需要两个参数", command))
+			return
+		}
+		delta, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+		if err != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		if command == "DECRBY" {
+			if delta == math.MinInt64 {
+				conn.WriteError("ERR decrement would overflow")
+				return
+			}
+			delta = -delta
+		}
+		s.handleIncrBy(conn, cmd.Args[1], delta)
 
 	// 过期时间命令
-	case "EXPIRE":
+	case "EXPIRE", "EXPIREAT", "PEXPIRE", "PEXPIREAT":
 		if len(cmd.Args) != 3 {
-			conn.WriteError("ERR EXPIRE命令需要两个参数")
+			conn.WriteError(fmt.Sprintf("ERR %s命令需要两个参数", command))
+			return
+		}
+		s.handleExpire(conn, command, cmd.Args[1], cmd.Args[2])
+	case "SETEX":
+		if len(cmd.Args) != 4 {
+			conn.WriteError("ERR SETEX命令需要三个参数")
+			return
+		}
+		seconds, err := strconv.ParseInt(string(cmd.Args[2]), 10, 64)
+		if err != nil || seconds <= 0 {
+			conn.WriteError("ERR invalid expire time in 'setex' command")
 			return
 		}
-		s.handleExpire(conn, cmd.Args[1], cmd.Args[2])
+		// 等价于 SET key value EX seconds
+		s.handleSet(conn, [][]byte{cmd.Args[0], cmd.Args[1], cmd.Args[3], []byte("EX"), cmd.Args[2]})
 	case "TTL":
 		if len(cmd.Args) != 2 {
 			conn.WriteError("ERR TTL命令需要一个参数")
 			return
 		}
 		s.handleTTL(conn, cmd.Args[1])
+	case "PTTL":
+		if len(cmd.Args) != 2 {
+			conn.WriteError("ERR PTTL命令需要一个参数")
+			return
+		}
+		s.handlePTTL(conn, cmd.Args[1])
+	case "PERSIST":
+		if len(cmd.Args) != 2 {
+			conn.WriteError("ERR PERSIST命令需要一个参数")
+			return
+		}
+		s.handlePersist(conn, cmd.Args[1])
+	case "RENAME", "RENAMENX":
+		if len(cmd.Args) != 3 {
+			conn.WriteError(fmt.Sprintf("ERR %s命令需要两个参数", command))
+			return
+		}
+		s.handleRename(conn, cmd.Args[1], cmd.Args[2], command == "RENAMENX")
 
 	// 列表命令
 	case "LPUSH":
@@ -185,6 +494,51 @@ func (s *Server) handleCommand(conn redcon.Conn, cmd redcon.Command) {
 			return
 		}
 		s.handleLRange(conn, cmd.Args[1], cmd.Args[2], cmd.Args[3])
+	case "LINDEX":
+		if len(cmd.Args) != 3 {
+			conn.WriteError("ERR LINDEX命令需要两个参数")
+			return
+		}
+		index, err := strconv.Atoi(string(cmd.Args[2]))
+		if err != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		s.handleLIndex(conn, cmd.Args[1], index)
+	case "LSET":
+		if len(cmd.Args) != 4 {
+			conn.WriteError("ERR LSET命令需要三个参数")
+			return
+		}
+		index, err := strconv.Atoi(string(cmd.Args[2]))
+		if err != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		s.handleLSet(conn, cmd.Args[1], index, cmd.Args[3])
+	case "LTRIM":
+		if len(cmd.Args) != 4 {
+			conn.WriteError("ERR LTRIM命令需要三个参数")
+			return
+		}
+		start, err1 := strconv.Atoi(string(cmd.Args[2]))
+		stop, err2 := strconv.Atoi(string(cmd.Args[3]))
+		if err1 != nil || err2 != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		s.handleLTrim(conn, cmd.Args[1], start, stop)
+	case "LREM":
+		if len(cmd.Args) != 4 {
+			conn.WriteError("ERR LREM命令需要三个参数")
+			return
+		}
+		count, err := strconv.Atoi(string(cmd.Args[2]))
+		if err != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		s.handleLRem(conn, cmd.Args[1], count, cmd.Args[3])
 
 	// 哈希命令
 	case "HSET":
@@ -223,6 +577,35 @@ func (s *Server) handleCommand(conn redcon.Conn, cmd redcon.Command) {
 			return
 		}
 		s.handleHExists(conn, cmd.Args[1], cmd.Args[2])
+	case "HMGET":
+		if len(cmd.Args) < 3 {
+			conn.WriteError("ERR HMGET命令需要至少两个参数")
+			return
+		}
+		s.handleHMGet(conn, cmd.Args[1], cmd.Args[2:])
+	case "HLEN":
+		if len(cmd.Args) != 2 {
+			conn.WriteError("ERR HLEN命令需要一个参数")
+			return
+		}
+		s.handleHLen(conn, cmd.Args[1])
+	case "HVALS":
+		if len(cmd.Args) != 2 {
+			conn.WriteError("ERR HVALS命令需要一个参数")
+			return
+		}
+		s.handleHVals(conn, cmd.Args[1])
+	case "HINCRBY":
+		if len(cmd.Args) != 4 {
+			conn.WriteError("ERR HINCRBY命令需要三个参数")
+			return
+		}
+		delta, err := strconv.ParseInt(string(cmd.Args[3]), 10, 64)
+		if err != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		s.handleHIncrBy(conn, cmd.Args[1], cmd.Args[2], delta)
 
 	// 集合命令
 	case "SADD":
@@ -249,6 +632,39 @@ func (s *Server) handleCommand(conn redcon.Conn, cmd redcon.Command) {
 			return
 		}
 		s.handleSIsMember(conn, cmd.Args[1], cmd.Args[2])
+	case "SCARD":
+		if len(cmd.Args) != 2 {
+			conn.WriteError("ERR SCARD命令需要一个参数")
+			return
+		}
+		s.handleSCard(conn, cmd.Args[1])
+	case "SPOP":
+		if len(cmd.Args) != 2 && len(cmd.Args) != 3 {
+			conn.WriteError("ERR SPOP命令需要一个或两个参数")
+			return
+		}
+		if len(cmd.Args) == 2 {
+			s.handleSPop(conn, cmd.Args[1], 1, false)
+			return
+		}
+		count, err := strconv.Atoi(string(cmd.Args[2]))
+		if err != nil || count < 0 {
+			conn.WriteError("ERR value is out of range, must be positive")
+			return
+		}
+		s.handleSPop(conn, cmd.Args[1], count, true)
+	case "SINTER", "SUNION", "SDIFF":
+		if len(cmd.Args) < 2 {
+			conn.WriteError(fmt.Sprintf("ERR %s命令需要至少一个参数", command))
+			return
+		}
+		op := setOpInter
+		if command == "SUNION" {
+			op = setOpUnion
+		} else if command == "SDIFF" {
+			op = setOpDiff
+		}
+		s.handleSetOp(conn, cmd.Args[1:], op)
 
 	// 有序集合命令
 	case "ZADD":
@@ -275,13 +691,48 @@ func (s *Server) handleCommand(conn redcon.Conn, cmd redcon.Command) {
 			return
 		}
 		s.handleZScore(conn, cmd.Args[1], cmd.Args[2])
+	case "ZREM":
+		if len(cmd.Args) < 3 {
+			conn.WriteError("ERR ZREM命令需要至少两个参数")
+			return
+		}
+		s.handleZRem(conn, cmd.Args[1], cmd.Args[2:])
+	case "ZCARD":
+		if len(cmd.Args) != 2 {
+			conn.WriteError("ERR ZCARD命令需要一个参数")
+			return
+		}
+		s.handleZCard(conn, cmd.Args[1])
+	case "ZINCRBY":
+		if len(cmd.Args) != 4 {
+			conn.WriteError("ERR ZINCRBY命令需要三个参数")
+			return
+		}
+		delta, err := strconv.ParseFloat(string(cmd.Args[2]), 64)
+		if err != nil {
+			conn.WriteError("ERR value is not a valid float")
+			return
+		}
+		s.handleZIncrBy(conn, cmd.Args[1], delta, cmd.Args[3])
+	case "ZRANGEBYSCORE":
+		if len(cmd.Args) < 4 {
+			conn.WriteError("ERR ZRANGEBYSCORE命令需要至少三个参数")
+			return
+		}
+		s.handleZRangeByScore(conn, cmd.Args)
+	case "ZREVRANGE":
+		if len(cmd.Args) < 4 {
+			conn.WriteError("ERR ZREVRANGE命令需要至少三个参数")
+			return
+		}
+		s.handleZRevRange(conn, cmd.Args)
 
 	default:
 		conn.WriteError(fmt.Sprintf("ERR 不支持的命令: %s", command))
 	}
 }
 
-// 检查并移除过期键
+// 检查并移除过期键，调用方需要持有 s.mu；读命令不持有锁，使用 expireIfNeeded
 func (s *Server) checkAndRemoveExpired(key string) bool {
 	ttlKey := encodeKeyExpire(key)
 	ttlBytes, ok := s.bc.Get([]byte(ttlKey))
@@ -291,59 +742,81 @@ func (s *Server) checkAndRemoveExpired(key string) bool {
 
 	if isExpired(ttlBytes) {
 		// 键已过期，删除相关数据
-		keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(key)))
-		if ok {
-			keyType := string(keyTypeBytes)
-
-			// 根据键类型执行不同的删除策略
-			switch keyType {
-			case TypeString:
-				s.bc.Delete([]byte(key))
-			case TypeList, TypeHash, TypeSet, TypeZSet:
-				// 对于复杂数据类型，需要扫描并删除所有相关键
-				prefix := ""
-				switch keyType {
-				case TypeList:
-					prefix = ListItemPrefx + key
-				case TypeHash:
-					prefix = HashFieldPrefx + key
-				case TypeSet:
-					prefix = SetMemberPrefx + key
-				case TypeZSet:
-					prefix = ZSetScorePrefx + key
-				}
+		s.removeKey(key)
+		return true // 键已删除
+	}
+	return false // 键未过期
+}
 
-				if prefix != "" {
-					s.bc.Scan(func(k []byte, _ []byte) error {
-						if strings.HasPrefix(string(k), prefix) {
-							s.bc.Delete(k)
-						}
-						return nil
-					})
-				}
+// expireIfNeeded 供不持有 s.mu 的读命令检查过期，发现键已过期时加锁后重新检查再删除。
+// 期间其他连接可能已经用 SET 等写入了新值，不重新检查会把新值一起删掉
+func (s *Server) expireIfNeeded(key string) bool {
+	ttlBytes, ok := s.bc.Get([]byte(encodeKeyExpire(key)))
+	if !ok || !isExpired(ttlBytes) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkAndRemoveExpired(key)
+}
 
-				// 对于有序集合，还需要删除成员键
-				if keyType == TypeZSet {
-					prefix = ZSetMemberPrefx + key
-					s.bc.Scan(func(k []byte, _ []byte) error {
-						if strings.HasPrefix(string(k), prefix) {
-							s.bc.Delete(k)
-						}
-						return nil
-					})
-				}
-			}
-		} else {
-			// 可能是字符串类型但未设置类型标记
+// removeKey 删除任意类型的键及其成员、类型标记和过期时间标记
+func (s *Server) removeKey(key string) {
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(key)))
+	if ok {
+		keyType := string(keyTypeBytes)
+
+		// 根据键类型执行不同的删除策略
+		switch keyType {
+		case TypeString:
 			s.bc.Delete([]byte(key))
+		case TypeList, TypeHash, TypeSet, TypeZSet:
+			s.deleteMembers(key, keyType)
 		}
+	} else {
+		// 可能是字符串类型但未设置类型标记
+		s.bc.Delete([]byte(key))
+	}
 
-		// 删除类型标记和过期时间标记
-		s.bc.Delete([]byte(encodeKeyType(key)))
-		s.bc.Delete([]byte(ttlKey))
-		return true // 键已删除
+	// 删除类型标记和过期时间标记
+	s.bc.Delete([]byte(encodeKeyType(key)))
+	s.bc.Delete([]byte(encodeKeyExpire(key)))
+}
+
+// deleteMembers 删除复杂类型键的所有成员键，列表同时删除元数据，有序集合删除分数键和成员键
+func (s *Server) deleteMembers(key, keyType string) {
+	var prefixes []string
+	switch keyType {
+	case TypeList:
+		prefixes = []string{ListItemPrefx}
+	case TypeHash:
+		prefixes = []string{HashFieldPrefx}
+	case TypeSet:
+		prefixes = []string{SetMemberPrefx}
+	case TypeZSet:
+		prefixes = []string{ZSetScorePrefx, ZSetMemberPrefx}
+	}
+	// 成员键的格式为 前缀+键名+":"+成员，带上分隔符避免误删以该键名开头的其他键的成员
+	for _, prefix := range prefixes {
+		s.bc.ScanPrefix([]byte(prefix+key+":"), func(k []byte, _ []byte) error {
+			s.bc.Delete(k)
+			return nil
+		})
+	}
+	if keyType == TypeList {
+		s.bc.Delete([]byte(encodeListMeta(key)))
+	}
+}
+
+// prepareOverwrite 用字符串值覆盖键之前删除原有的其他类型的成员键，keepTTL 为false时同时清除过期时间，
+// 调用方需要持有 s.mu，之后写入类型标记和新值
+func (s *Server) prepareOverwrite(key string, keepTTL bool) {
+	if keyType, ok := s.bc.Get([]byte(encodeKeyType(key))); ok && string(keyType) != TypeString {
+		s.deleteMembers(key, string(keyType))
+	}
+	if !keepTTL {
+		s.bc.Delete([]byte(encodeKeyExpire(key)))
 	}
-	return false // 键未过期
 }
 
 // GET命令处理
@@ -351,7 +824,7 @@ func (s *Server) handleGet(conn redcon.Conn, key []byte) {
 	keyStr := string(key)
 
 	// 检查键是否过期
-	if s.checkAndRemoveExpired(keyStr) {
+	if s.expireIfNeeded(keyStr) {
 		conn.WriteNull()
 		return
 	}
@@ -374,11 +847,83 @@ func (s *Server) handleGet(conn redcon.Conn, key []byte) {
 	conn.WriteBulk(value)
 }
 
+// setOptions SET命令的可选参数
+type setOptions struct {
+	nx, xx   bool  // 条件写入
+	keepTTL  bool  // 保留原有过期时间
+	expireAt int64 // 过期时间（毫秒时间戳），0表示不过期
+}
+
+// parseSetOptions 解析 SET 命令 key value 之后的可选参数，失败时返回错误信息
+func parseSetOptions(args [][]byte) (setOptions, string) {
+	var opts setOptions
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "NX" && !opts.xx:
+			opts.nx = true
+		case option == "XX" && !opts.nx:
+			opts.xx = true
+		case option == "KEEPTTL" && opts.expireAt == 0:
+			opts.keepTTL = true
+		case (option == "EX" || option == "PX") && opts.expireAt == 0 && !opts.keepTTL && i+1 < len(args):
+			const invalid = "ERR invalid expire time in 'set' command"
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || n <= 0 {
+				return opts, invalid
+			}
+			if option == "EX" {
+				// 过期时间（秒），与 EXPIRE 相同，换算成毫秒或加上当前时间溢出时返回错误
+				if n > math.MaxInt64/1000 {
+					return opts, invalid
+				}
+				n *= 1000
+			}
+			expireAt, ok := addInt64(time.Now().UnixMilli(), n)
+			if !ok {
+				return opts, invalid
+			}
+			opts.expireAt = expireAt
+			i++
+		default:
+			return opts, "ERR syntax error"
+		}
+	}
+	return opts, ""
+}
+
 // SET命令处理
+// SET key value [NX|XX] [EX seconds|PX milliseconds|KEEPTTL]
 func (s *Server) handleSet(conn redcon.Conn, args [][]byte) {
 	key := string(args[1])
 	value := args[2]
 
+	// 解析可选参数
+	opts, errMsg := parseSetOptions(args[3:])
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+	nx, xx, keepTTL, expireAt := opts.nx, opts.xx, opts.keepTTL, opts.expireAt
+	if !s.checkSize(conn, args[1], value) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// NX/XX 条件不满足时返回nil
+	if nx || xx {
+		exists := !s.checkAndRemoveExpired(key) && s.keyExists(key)
+		if (nx && exists) || (xx && !exists) {
+			conn.WriteNull()
+			return
+		}
+	}
+
+	// 覆盖其他类型的键时删除原有成员；未指定 KEEPTTL 时覆盖写入会清除原有的过期时间
+	s.prepareOverwrite(key, keepTTL || expireAt > 0)
+
 	// 设置键类型为字符串
 	s.bc.Put([]byte(encodeKeyType(key)), []byte(TypeString))
 
@@ -388,35 +933,279 @@ func (s *Server) handleSet(conn redcon.Conn, args [][]byte) {
 		return
 	}
 
-	// 处理可选的过期时间参数
-	if len(args) > 3 {
-		option := strings.ToUpper(string(args[3]))
-		if option == "EX" && len(args) >= 5 {
-			// 过期时间（秒）
-			seconds, err := strconv.ParseInt(string(args[4]), 10, 64)
-			if err != nil {
-				conn.WriteError(fmt.Sprintf("ERR 无效的过期时间: %v", err))
-				return
-			}
-			expireAt := time.Now().Unix() + seconds
-			s.bc.Put([]byte(encodeKeyExpire(key)), []byte(strconv.FormatInt(expireAt, 10)))
-		} else if option == "PX" && len(args) >= 5 {
-			// 过期时间（毫秒）
-			millis, err := strconv.ParseInt(string(args[4]), 10, 64)
-			if err != nil {
-				conn.WriteError(fmt.Sprintf("ERR 无效的过期时间: %v", err))
-				return
-			}
-			expireAt := time.Now().Unix() + (millis / 1000)
-			s.bc.Put([]byte(encodeKeyExpire(key)), []byte(strconv.FormatInt(expireAt, 10)))
+	// 写入新的过期时间
+	if expireAt > 0 {
+		s.bc.Put([]byte(encodeKeyExpire(key)), formatExpireAt(expireAt))
+	}
+
+	conn.WriteString("OK")
+}
+
+// MSET命令处理，与 SET 相同地覆盖每个键，所有键值写完后只同步一次
+func (s *Server) handleMSet(conn redcon.Conn, args [][]byte) {
+	pairs := make(map[string][]byte, len(args))
+	for i := 0; i < len(args); i += 2 {
+		if !s.checkSize(conn, args[i], args[i+1]) {
+			return
 		}
+		key := string(args[i])
+		pairs[encodeKeyType(key)] = []byte(TypeString)
+		pairs[key] = args[i+1]
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < len(args); i += 2 {
+		s.prepareOverwrite(string(args[i]), false)
+	}
+	if err := s.bc.PutMulti(pairs); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 存储值失败: %v", err))
+		return
+	}
 	conn.WriteString("OK")
 }
 
+// MGET命令处理，不存在或不是字符串类型的键返回nil
+func (s *Server) handleMGet(conn redcon.Conn, keys [][]byte) {
+	conn.WriteArray(len(keys))
+	for _, key := range keys {
+		value, ok := s.getString(string(key))
+		if !ok {
+			conn.WriteNull()
+			continue
+		}
+		conn.WriteBulk(value)
+	}
+}
+
+// SETNX命令处理，仅在键不存在时写入
+func (s *Server) handleSetNX(conn redcon.Conn, key, value []byte) {
+	if !s.checkSize(conn, key, value) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	s.checkAndRemoveExpired(keyStr)
+	if _, ok := s.bc.Get([]byte(encodeKeyType(keyStr))); ok {
+		conn.WriteInt(0)
+		return
+	}
+	if _, ok := s.bc.Get(key); ok {
+		conn.WriteInt(0)
+		return
+	}
+
+	s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeString))
+	if err := s.bc.Put(key, value); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 存储值失败: %v", err))
+		return
+	}
+	conn.WriteInt(1)
+}
+
+// GETSET命令处理，写入新值并返回旧值
+func (s *Server) handleGetSet(conn redcon.Conn, key, value []byte) {
+	if !s.checkSize(conn, key, value) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	s.checkAndRemoveExpired(keyStr)
+	keyTypeBytes, hasType := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if hasType && string(keyTypeBytes) != TypeString {
+		conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return
+	}
+	old, ok := s.bc.Get(key)
+
+	// 与 SET 相同，写入新值后清除原有的过期时间
+	s.prepareOverwrite(keyStr, false)
+	if !hasType {
+		s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeString))
+	}
+	if err := s.bc.Put(key, value); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 存储值失败: %v", err))
+		return
+	}
+	if !ok {
+		conn.WriteNull()
+		return
+	}
+	conn.WriteBulk(old)
+}
+
+// getString 读取未过期的字符串值，键不存在或类型不是字符串时返回false
+func (s *Server) getString(key string) ([]byte, bool) {
+	if s.expireIfNeeded(key) {
+		return nil, false
+	}
+	if keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(key))); ok && string(keyTypeBytes) != TypeString {
+		return nil, false
+	}
+	return s.bc.Get([]byte(key))
+}
+
+// checkSize 检查要写入的键值是否超过存储引擎的 MaxKeySize/MaxValueSize，超过时写入错误回复并返回false
+//
+// 在写入类型标记等相关的键之前检查，避免超长的值只写入一部分或留下没有值的类型标记
+func (s *Server) checkSize(conn redcon.Conn, key, value []byte) bool {
+	if err := s.bc.CheckSize(key, value); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR %v", err))
+		return false
+	}
+	return true
+}
+
+// INCR/DECR/INCRBY/DECRBY命令处理，键不存在时视为0
+func (s *Server) handleIncrBy(conn redcon.Conn, key []byte, delta int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	s.checkAndRemoveExpired(keyStr)
+
+	// 检查键类型
+	keyTypeBytes, hasType := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if hasType && string(keyTypeBytes) != TypeString {
+		conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return
+	}
+
+	var current int64
+	if value, ok := s.bc.Get(key); ok {
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			conn.WriteError("ERR value is not an integer or out of range")
+			return
+		}
+		current = n
+	}
+
+	// 检查溢出
+	current, ok := addInt64(current, delta)
+	if !ok {
+		conn.WriteError("ERR increment or decrement would overflow")
+		return
+	}
+
+	if !hasType {
+		s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeString))
+	}
+	if err := s.bc.Put(key, []byte(strconv.FormatInt(current, 10))); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 存储值失败: %v", err))
+		return
+	}
+	conn.WriteInt64(current)
+}
+
+// APPEND命令处理，把 value 追加到字符串末尾，键不存在时创建，返回追加后的长度
+func (s *Server) handleAppend(conn redcon.Conn, key, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	s.checkAndRemoveExpired(keyStr)
+	keyTypeBytes, hasType := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if hasType && string(keyTypeBytes) != TypeString {
+		conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return
+	}
+	current, _ := s.bc.Get(key)
+	current = append(current, value...)
+	if !s.checkSize(conn, key, current) {
+		return
+	}
+
+	if !hasType {
+		s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeString))
+	}
+	if err := s.bc.Put(key, current); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 存储值失败: %v", err))
+		return
+	}
+	conn.WriteInt(len(current))
+}
+
+// STRLEN命令处理，键不存在时返回0
+func (s *Server) handleStrLen(conn redcon.Conn, key []byte) {
+	keyStr := string(key)
+	if keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr))); ok && string(keyTypeBytes) != TypeString {
+		conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return
+	}
+	value, _ := s.getString(keyStr)
+	conn.WriteInt(len(value))
+}
+
+// GETRANGE命令处理，返回 [start, end] 区间内的子串，负下标和越界的处理与 LRANGE 相同
+func (s *Server) handleGetRange(conn redcon.Conn, key []byte, start, end int) {
+	keyStr := string(key)
+	if keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr))); ok && string(keyTypeBytes) != TypeString {
+		conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return
+	}
+	value, _ := s.getString(keyStr)
+	start, end, ok := normalizeListRange(start, end, len(value))
+	if !ok {
+		conn.WriteBulkString("")
+		return
+	}
+	conn.WriteBulk(value[start : end+1])
+}
+
+// SETRANGE命令处理，从 offset 开始覆盖写入 value，原值不足 offset 时用零字节填充，返回写入后的长度
+//
+// value 为空时不修改也不创建键
+func (s *Server) handleSetRange(conn redcon.Conn, key []byte, offset int, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	s.checkAndRemoveExpired(keyStr)
+	keyTypeBytes, hasType := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if hasType && string(keyTypeBytes) != TypeString {
+		conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return
+	}
+	current, _ := s.bc.Get(key)
+	if len(value) == 0 {
+		conn.WriteInt(len(current))
+		return
+	}
+	// 与 Redis 相同先限制为512MB，避免过大的 offset 在检查存储引擎的上限之前就分配大量内存
+	if offset+len(value) > maxStringSize {
+		conn.WriteError("ERR string exceeds maximum allowed size (512MB)")
+		return
+	}
+
+	if end := offset + len(value); end > len(current) {
+		// 扩展的部分为零字节
+		current = append(current, make([]byte, end-len(current))...)
+	}
+	copy(current[offset:], value)
+	if !s.checkSize(conn, key, current) {
+		return
+	}
+
+	if !hasType {
+		s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeString))
+	}
+	if err := s.bc.Put(key, current); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 存储值失败: %v", err))
+		return
+	}
+	conn.WriteInt(len(current))
+}
+
 // DEL命令处理
 func (s *Server) handleDel(conn redcon.Conn, keys [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	var deleted int
 	for _, keyBytes := range keys {
 		key := string(keyBytes)
@@ -432,43 +1221,12 @@ func (s *Server) handleDel(conn redcon.Conn, keys [][]byte) {
 		// 根据键类型执行不同的删除策略
 		switch keyType {
 		case TypeString:
-			if err := s.bc.Delete(keyBytes); err == nil {
+			if existed, err := s.bc.Delete(keyBytes); err == nil && existed {
 				deleted++
 			}
 		case TypeList, TypeHash, TypeSet, TypeZSet:
-			// 对于复杂数据类型，需要扫描并删除所有相关键
-			prefix := ""
-			switch keyType {
-			case TypeList:
-				prefix = ListItemPrefx + key
-			case TypeHash:
-				prefix = HashFieldPrefx + key
-			case TypeSet:
-				prefix = SetMemberPrefx + key
-			case TypeZSet:
-				prefix = ZSetScorePrefx + key
-			}
-
-			if prefix != "" {
-				s.bc.Scan(func(k []byte, _ []byte) error {
-					if strings.HasPrefix(string(k), prefix) {
-						s.bc.Delete(k)
-					}
-					return nil
-				})
-				deleted++
-			}
-
-			// 对于有序集合，还需要删除成员键
-			if keyType == TypeZSet {
-				prefix = ZSetMemberPrefx + key
-				s.bc.Scan(func(k []byte, _ []byte) error {
-					if strings.HasPrefix(string(k), prefix) {
-						s.bc.Delete(k)
-					}
-					return nil
-				})
-			}
+			s.deleteMembers(key, keyType)
+			deleted++
 		}
 
 		// 删除类型标记和过期时间标记
@@ -478,10 +1236,10 @@ func (s *Server) handleDel(conn redcon.Conn, keys [][]byte) {
 	conn.WriteInt(deleted)
 }
 
-// KEYS命令处理
+// KEYS命令处理，只返回当前数据库中的键
 func (s *Server) handleKeys(conn redcon.Conn, pattern []byte) {
 	patternStr := string(pattern)
-	isAllKeys := patternStr == "*"
+	db := getConnState(conn).db
 
 	// 收集匹配的键
 	var matchedKeys [][]byte
@@ -491,14 +1249,12 @@ func (s *Server) handleKeys(conn redcon.Conn, pattern []byte) {
 	err := s.bc.Scan(func(key []byte, _ []byte) error {
 		keyStr := string(key)
 
-		// 跳过特殊前缀的键（用于内部存储）
-		if strings.HasPrefix(keyStr, KeyTypePrefx) ||
-			strings.HasPrefix(keyStr, KeyExpirePrefx) ||
-			strings.HasPrefix(keyStr, ListItemPrefx) ||
-			strings.HasPrefix(keyStr, HashFieldPrefx) ||
-			strings.HasPrefix(keyStr, SetMemberPrefx) ||
-			strings.HasPrefix(keyStr, ZSetScorePrefx) ||
-			strings.HasPrefix(keyStr, ZSetMemberPrefx) {
+		// 跳过特殊前缀的键（用于内部存储）和其他数据库的键
+		if isInternalKey(keyStr) {
+			return nil
+		}
+		keyDB, name := splitDBKey(keyStr)
+		if keyDB != db {
 			return nil
 		}
 
@@ -511,9 +1267,9 @@ func (s *Server) handleKeys(conn redcon.Conn, pattern []byte) {
 				return nil
 			}
 
-			// 如果是*或者键包含模式，则添加到结果中
-			if isAllKeys || strings.Contains(keyStr, patternStr) {
-				matchedKeys = append(matchedKeys, key)
+			// 按glob规则匹配
+			if matchPattern(patternStr, name) {
+				matchedKeys = append(matchedKeys, []byte(name))
 				seen[keyStr] = true
 			}
 		}
@@ -532,117 +1288,396 @@ func (s *Server) handleKeys(conn redcon.Conn, pattern []byte) {
 	}
 }
 
-// EXPIRE命令处理
-func (s *Server) handleExpire(conn redcon.Conn, key, seconds []byte) {
-	// 检查键是否存在
-	exists := false
-	keyStr := string(key)
+// SCAN命令处理
+// SCAN cursor [MATCH pattern] [COUNT n]，游标是上一次返回的最后一个键的编码，"0" 表示开始或结束，
+// 只返回当前数据库中的键，其他数据库的键同样计入 COUNT
+func (s *Server) handleScan(conn redcon.Conn, args [][]byte) {
+	db := getConnState(conn).db
+	var last []byte
+	if cursor := string(args[0]); cursor != "0" {
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(decoded) == 0 {
+			conn.WriteError("ERR invalid cursor")
+			return
+		}
+		last = decoded
+	}
 
-	_, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
-	if ok {
-		exists = true
-	} else {
-		// 检查是否是原始字符串键
-		_, ok := s.bc.Get(key)
-		if ok {
-			exists = true
-			// 设置键类型为字符串
-			s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeString))
+	// 解析可选参数
+	pattern := "*"
+	count := 10
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			conn.WriteError("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			n, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || n <= 0 {
+				conn.WriteError("ERR value is not an integer or out of range")
+				return
+			}
+			count = n
+		default:
+			conn.WriteError("ERR syntax error")
+			return
 		}
 	}
 
-	if !exists {
-		conn.WriteInt(0) // 键不存在
+	iter := s.bc.NewIterator()
+	defer iter.Close()
+	if last != nil {
+		// 从上一次的最后一个键之后继续
+		iter.Seek(last)
+		if iter.Valid() && bytes.Equal(iter.Key(), last) {
+			iter.Next()
+		}
+	}
+
+	// COUNT 限制的是本次检查的键数量，返回的键可能更少
+	var keys [][]byte
+	examined := 0
+	for ; iter.Valid() && examined < count; iter.Next() {
+		key := append([]byte(nil), iter.Key()...)
+		last = key
+		examined++
+
+		keyStr := string(key)
+		if isInternalKey(keyStr) {
+			continue
+		}
+		keyDB, name := splitDBKey(keyStr)
+		if keyDB != db || !matchPattern(pattern, name) {
+			continue
+		}
+		ttlBytes, ok := s.bc.Get([]byte(encodeKeyExpire(keyStr)))
+		if ok && isExpired(ttlBytes) {
+			continue
+		}
+		keys = append(keys, []byte(name))
+	}
+	if err := iter.Err(); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 扫描键失败: %v", err))
 		return
 	}
 
-	// 解析过期时间
-	secs, err := strconv.ParseInt(string(seconds), 10, 64)
+	next := "0"
+	if iter.Valid() {
+		next = base64.RawURLEncoding.EncodeToString(last)
+	}
+	conn.WriteArray(2)
+	conn.WriteBulkString(next)
+	conn.WriteArray(len(keys))
+	for _, key := range keys {
+		conn.WriteBulk(key)
+	}
+}
+
+// DBSIZE命令处理，返回当前数据库中用户可见的键数量（不含内部标记，已过期的键不计入）
+func (s *Server) handleDBSize(conn redcon.Conn) {
+	counts, err := s.keyCounts()
 	if err != nil {
-		conn.WriteError(fmt.Sprintf("ERR 无效的过期时间: %v", err))
+		conn.WriteError(fmt.Sprintf("ERR 扫描键失败: %v", err))
 		return
 	}
+	conn.WriteInt(counts[getConnState(conn).db])
+}
+
+// keyCounts 统计每个数据库中用户可见的键数量，复杂类型只计数一次，内部标记和已过期的键不计入
+func (s *Server) keyCounts() ([numDatabases]int, error) {
+	var counts [numDatabases]int
+	names := make(map[string]bool)
+	err := s.bc.Scan(func(key []byte, _ []byte) error {
+		keyStr := string(key)
+		if strings.HasPrefix(keyStr, KeyTypePrefx) {
+			// 复杂类型只通过类型标记计数一次
+			names[keyStr[len(KeyTypePrefx):]] = true
+		} else if !isInternalKey(keyStr) {
+			names[keyStr] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return counts, err
+	}
+
+	for name := range names {
+		ttlBytes, ok := s.bc.Get([]byte(encodeKeyExpire(name)))
+		if ok && isExpired(ttlBytes) {
+			continue
+		}
+		db, _ := splitDBKey(name)
+		counts[db]++
+	}
+	return counts, nil
+}
 
-	// 计算过期时间戳
-	expireAt := time.Now().Unix() + secs
+// FLUSHDB命令处理，删除当前数据库中的所有键（包括内部标记）后执行 Merge 回收空间
+func (s *Server) handleFlushDB(conn redcon.Conn) {
+	db := getConnState(conn).db
+	s.flushKeys(conn, func(key string) bool {
+		_, keyDB, _ := splitRawKey(key)
+		return keyDB == db
+	})
+}
 
-	// 存储过期时间
-	err = s.bc.Put([]byte(encodeKeyExpire(keyStr)), []byte(strconv.FormatInt(expireAt, 10)))
+// FLUSHALL命令处理，删除所有数据库中的键
+func (s *Server) handleFlushAll(conn redcon.Conn) {
+	s.flushKeys(conn, func(string) bool { return true })
+}
+
+// flushKeys 删除 match 返回 true 的所有键后执行 Merge
+func (s *Server) flushKeys(conn redcon.Conn, match func(key string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 先收集再删除，避免遍历过程中修改索引
+	var keys [][]byte
+	err := s.bc.Scan(func(key []byte, _ []byte) error {
+		if match(string(key)) {
+			keys = append(keys, append([]byte(nil), key...))
+		}
+		return nil
+	})
 	if err != nil {
-		conn.WriteError(fmt.Sprintf("ERR 设置过期时间失败: %v", err))
+		conn.WriteError(fmt.Sprintf("ERR 扫描键失败: %v", err))
 		return
 	}
+	for _, key := range keys {
+		if _, err := s.bc.Delete(key); err != nil {
+			conn.WriteError(fmt.Sprintf("ERR 删除键失败: %v", err))
+			return
+		}
+	}
 
-	conn.WriteInt(1) // 成功设置
+	if err := s.bc.Merge(); err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 合并数据文件失败: %v", err))
+		return
+	}
+	conn.WriteString("OK")
 }
 
-// TTL命令处理
-func (s *Server) handleTTL(conn redcon.Conn, key []byte) {
-	keyStr := string(key)
+// isInternalKey 是否为内部存储使用的键
+func isInternalKey(key string) bool {
+	return strings.HasPrefix(key, KeyTypePrefx) ||
+		strings.HasPrefix(key, KeyExpirePrefx) ||
+		strings.HasPrefix(key, ListItemPrefx) ||
+		strings.HasPrefix(key, ListMetaPrefx) ||
+		strings.HasPrefix(key, HashFieldPrefx) ||
+		strings.HasPrefix(key, SetMemberPrefx) ||
+		strings.HasPrefix(key, ZSetScorePrefx) ||
+		strings.HasPrefix(key, ZSetMemberPrefx)
+}
 
-	// 如果键已过期，则删除并返回-2
-	if s.checkAndRemoveExpired(keyStr) {
-		conn.WriteInt(-2) // 键不存在（已过期）
+// EXPIRE/EXPIREAT/PEXPIRE/PEXPIREAT命令处理
+// 统一换算为毫秒时间戳存储；时间戳已经过去时键立即被删除
+func (s *Server) handleExpire(conn redcon.Conn, command string, key, arg []byte) {
+	// 解析过期时间
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		conn.WriteError("ERR value is not an integer or out of range")
 		return
 	}
+	invalid := fmt.Sprintf("ERR invalid expire time in '%s' command", strings.ToLower(command))
+
+	// 计算过期时间戳（毫秒）
+	var expireAt int64
+	switch command {
+	case "EXPIRE", "EXPIREAT":
+		if n > math.MaxInt64/1000 || n < math.MinInt64/1000 {
+			conn.WriteError(invalid)
+			return
+		}
+		n *= 1000
+	}
+	switch command {
+	case "EXPIRE", "PEXPIRE":
+		var ok bool
+		if expireAt, ok = addInt64(time.Now().UnixMilli(), n); !ok {
+			conn.WriteError(invalid)
+			return
+		}
+	default:
+		expireAt = n
+	}
+
+	conn.WriteInt(s.setExpireAt(string(key), expireAt))
+}
+
+// setExpireAt 设置毫秒过期时间戳，键不存在时返回0
+func (s *Server) setExpireAt(keyStr string, expireAt int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// 检查键是否存在
-	exists := false
-	_, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
-	if ok {
-		exists = true
-	} else {
+	if s.checkAndRemoveExpired(keyStr) {
+		return 0 // 键已过期
+	}
+	if _, ok := s.bc.Get([]byte(encodeKeyType(keyStr))); !ok {
 		// 检查是否是原始字符串键
-		_, ok := s.bc.Get(key)
-		if ok {
-			exists = true
+		if _, ok := s.bc.Get([]byte(keyStr)); !ok {
+			return 0 // 键不存在
 		}
+		// 设置键类型为字符串
+		s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeString))
 	}
 
-	if !exists {
-		conn.WriteInt(-2) // 键不存在
+	// 存储过期时间
+	s.bc.Put([]byte(encodeKeyExpire(keyStr)), formatExpireAt(expireAt))
+
+	// 时间戳已经过去，立即删除
+	s.checkAndRemoveExpired(keyStr)
+	return 1 // 成功设置
+}
+
+// TTL命令处理，返回剩余秒数
+func (s *Server) handleTTL(conn redcon.Conn, key []byte) {
+	ttl := s.remainingTTL(string(key))
+	if ttl < 0 {
+		conn.WriteInt64(ttl)
 		return
 	}
+	// 与 Redis 一致，四舍五入到秒
+	conn.WriteInt64((ttl + 500) / 1000)
+}
+
+// PTTL命令处理，返回剩余毫秒数
+func (s *Server) handlePTTL(conn redcon.Conn, key []byte) {
+	conn.WriteInt64(s.remainingTTL(string(key)))
+}
+
+// remainingTTL 返回剩余的过期时间（毫秒），键不存在返回-2，永不过期返回-1
+func (s *Server) remainingTTL(keyStr string) int64 {
+	// 如果键已过期，则删除并返回-2
+	if s.expireIfNeeded(keyStr) {
+		return -2 // 键不存在（已过期）
+	}
+
+	// 检查键是否存在
+	if !s.keyExists(keyStr) {
+		return -2 // 键不存在
+	}
 
 	// 获取过期时间
 	ttlBytes, ok := s.bc.Get([]byte(encodeKeyExpire(keyStr)))
 	if !ok {
-		conn.WriteInt(-1) // 键永不过期
-		return
+		return -1 // 键永不过期
 	}
 
 	// 解析过期时间戳
-	expireAt, err := strconv.ParseInt(string(ttlBytes), 10, 64)
-	if err != nil {
-		conn.WriteInt(-1) // 无法解析过期时间
-		return
+	expireAt, ok := parseExpireAt(ttlBytes)
+	if !ok {
+		return -1 // 无法解析过期时间
 	}
 
 	// 计算剩余时间
-	ttl := expireAt - time.Now().Unix()
-	if ttl <= 0 {
+	ttl := expireAt - time.Now().UnixMilli()
+	if ttl < 0 {
 		// 键已过期，执行删除
-		s.checkAndRemoveExpired(keyStr)
-		conn.WriteInt(-2) // 键不存在（已过期）
+		s.expireIfNeeded(keyStr)
+		return -2 // 键不存在（已过期）
+	}
+	return ttl
+}
+
+// EXISTS命令处理，返回存在且未过期的键的数量
+func (s *Server) handleExists(conn redcon.Conn, keys [][]byte) {
+	count := 0
+	for _, key := range keys {
+		keyStr := string(key)
+		if !s.expireIfNeeded(keyStr) && s.keyExists(keyStr) {
+			count++
+		}
+	}
+	conn.WriteInt(count)
+}
+
+// TYPE命令处理
+func (s *Server) handleType(conn redcon.Conn, key []byte) {
+	keyStr := string(key)
+	if s.expireIfNeeded(keyStr) {
+		conn.WriteString("none")
 		return
 	}
 
-	conn.WriteInt(int(ttl))
+	if keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr))); ok {
+		conn.WriteString(string(keyTypeBytes))
+		return
+	}
+	// 没有类型标记的原始字符串键
+	if _, ok := s.bc.Get(key); ok {
+		conn.WriteString(TypeString)
+		return
+	}
+	conn.WriteString("none")
+}
+
+// PERSIST命令处理，移除过期时间
+func (s *Server) handlePersist(conn redcon.Conn, key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	if s.checkAndRemoveExpired(keyStr) || !s.keyExists(keyStr) {
+		conn.WriteInt(0) // 键不存在
+		return
+	}
+
+	existed, err := s.bc.Delete([]byte(encodeKeyExpire(keyStr)))
+	if err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 移除过期时间失败: %v", err))
+		return
+	}
+	if !existed {
+		conn.WriteInt(0) // 键没有过期时间
+		return
+	}
+	conn.WriteInt(1)
+}
+
+// keyExists 检查键是否存在（有类型标记或是原始字符串键），不检查过期
+func (s *Server) keyExists(key string) bool {
+	if _, ok := s.bc.Get([]byte(encodeKeyType(key))); ok {
+		return true
+	}
+	_, ok := s.bc.Get([]byte(key))
+	return ok
 }
 
 // 以下为下一轮实现的更多Redis命令的处理函数...
 
 // INFO命令处理
 func (s *Server) handleInfo(conn redcon.Conn) {
-	info := fmt.Sprintf(
-		"# Server\r\n" +
-			"redis_mode:standalone\r\n" +
-			"bitcask_compatible:yes\r\n" +
-			"redis_version:5.0.0\r\n" +
-			"# Stats\r\n" +
-			"connected_clients:1\r\n" +
-			"# Command Stats\r\n" +
-			"# Keyspace\r\n",
-	)
-	conn.WriteBulkString(info)
+	counts, err := s.keyCounts()
+	if err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 扫描键失败: %v", err))
+		return
+	}
+
+	var uptime int64
+	if !s.startTime.IsZero() {
+		uptime = int64(time.Since(s.startTime).Seconds())
+	}
+
+	var info strings.Builder
+	info.WriteString("# Server\r\n")
+	info.WriteString("redis_mode:standalone\r\n")
+	info.WriteString("bitcask_compatible:yes\r\n")
+	info.WriteString("redis_version:5.0.0\r\n")
+	fmt.Fprintf(&info, "uptime_in_seconds:%d\r\n", uptime)
+	info.WriteString("# Clients\r\n")
+	fmt.Fprintf(&info, "connected_clients:%d\r\n", s.connectedClients.Load())
+	info.WriteString("# Stats\r\n")
+	fmt.Fprintf(&info, "total_commands_processed:%d\r\n", s.totalCommands.Load())
+	info.WriteString("# Keyspace\r\n")
+	for db, keys := range counts {
+		if keys > 0 {
+			// 与 Redis 一致，不输出空库
+			fmt.Fprintf(&info, "db%d:keys=%d\r\n", db, keys)
+		}
+	}
+	conn.WriteBulkString(info.String())
 }
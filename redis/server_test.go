@@ -2,8 +2,13 @@ package redis
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,6 +19,12 @@ import (
 )
 
 func setupTest(t *testing.T) (*bitcask.Bitcask, *Server, string) {
+	return setupTestServer(t, nil, nil)
+}
+
+// setupTestServer 与 setupTest 相同，setConf 不为nil时在打开 Bitcask 之前修改配置，
+// configure 不为nil时在启动服务器之前调用
+func setupTestServer(t *testing.T, setConf func(*config.Config), configure func(*Server)) (*bitcask.Bitcask, *Server, string) {
 	// 创建测试目录
 	tmpDir, err := os.MkdirTemp("", "redis-test-*")
 	assert.NoError(t, err)
@@ -26,6 +37,9 @@ func setupTest(t *testing.T) (*bitcask.Bitcask, *Server, string) {
 	conf.MaxFileSize = 64 * 1024 * 1024 // 64MB
 	conf.AutoSync = true
 	conf.Debug = false
+	if setConf != nil {
+		setConf(conf)
+	}
 
 	bc, err := bitcask.NewBitcask(conf)
 	assert.NoError(t, err)
@@ -33,6 +47,9 @@ func setupTest(t *testing.T) (*bitcask.Bitcask, *Server, string) {
 	// 创建Redis服务器
 	addr := "127.0.0.1:6380" // 使用不同于默认Redis的端口
 	server := NewServer(bc, addr)
+	if configure != nil {
+		configure(server)
+	}
 
 	// 启动服务器
 	go func() {
@@ -105,259 +122,1840 @@ func TestStringOperations(t *testing.T) {
 	assert.Equal(t, int64(2), reply)
 }
 
-func TestExpireOperations(t *testing.T) {
+func TestSetOptions(t *testing.T) {
 	bc, server, tmpDir := setupTest(t)
 	defer teardownTest(t, bc, server, tmpDir)
 
 	conn := getRedisConn(t)
 	defer conn.Close()
 
-	// 设置一个键
-	_, err := conn.Do("SET", "expirekey", "value")
+	// NX：仅在键不存在时写入，条件不满足返回nil
+	reply, err := conn.Do("SET", "nxkey", "v1", "NX")
 	assert.NoError(t, err)
-
-	// 设置过期时间为2秒
-	reply, err := conn.Do("EXPIRE", "expirekey", 2)
+	assert.Equal(t, "OK", reply)
+	reply, err = conn.Do("SET", "nxkey", "v2", "NX")
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), reply)
-
-	// 检查TTL
-	reply, err = conn.Do("TTL", "expirekey")
+	assert.Nil(t, reply)
+	value, err := redis.String(conn.Do("GET", "nxkey"))
 	assert.NoError(t, err)
-	ttl := reply.(int64)
-	assert.True(t, ttl > 0 && ttl <= 2)
+	assert.Equal(t, "v1", value)
 
-	// 等待过期 - 增加等待时间，因为可能有延迟
-	time.Sleep(4000 * time.Millisecond)
+	// XX：仅在键存在时写入
+	reply, err = conn.Do("SET", "xxkey", "v1", "XX")
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+	reply, err = conn.Do("GET", "xxkey")
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+	reply, err = conn.Do("SET", "nxkey", "v3", "XX")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+	value, err = redis.String(conn.Do("GET", "nxkey"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v3", value)
 
-	// 验证键已过期 - 忽略具体返回值，只要能获取到值（即便是错误的）也认为测试失败
-	// 测试是否为nil的条件太严格，改为检查是否能继续测试
-	_, err = conn.Do("GET", "expirekey")
-	// 忽略具体错误，继续测试
+	// KEEPTTL 保留原有过期时间，普通 SET 清除过期时间
+	_, err = conn.Do("SET", "ttlkey", "v1", "EX", 100)
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "ttlkey", "v2", "KEEPTTL")
+	assert.NoError(t, err)
+	ttl, err := redis.Int(conn.Do("TTL", "ttlkey"))
+	assert.NoError(t, err)
+	assert.InDelta(t, 100, ttl, 1)
+	_, err = conn.Do("SET", "ttlkey", "v3")
+	assert.NoError(t, err)
+	ttl, err = redis.Int(conn.Do("TTL", "ttlkey"))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, ttl)
 
-	// 测试SET命令的EX选项 - 使用更短的过期时间和更长的等待时间
-	_, err = conn.Do("SET", "exkey", "exvalue", "EX", 1)
+	// PX 小于1000毫秒时保留毫秒精度
+	_, err = conn.Do("SET", "pxkey", "v", "PX", 300)
+	assert.NoError(t, err)
+	pttl, err := redis.Int(conn.Do("PTTL", "pxkey"))
+	assert.NoError(t, err)
+	assert.Greater(t, pttl, 0)
+	assert.LessOrEqual(t, pttl, 300)
+	time.Sleep(400 * time.Millisecond)
+	reply, err = conn.Do("GET", "pxkey")
 	assert.NoError(t, err)
+	assert.Nil(t, reply)
+	pttl, err = redis.Int(conn.Do("PTTL", "pxkey"))
+	assert.NoError(t, err)
+	assert.Equal(t, -2, pttl)
 
-	// 等待足够长的时间确保过期
-	time.Sleep(3000 * time.Millisecond)
+	// PTTL/TTL 对不存在和永不过期的键
+	pttl, err = redis.Int(conn.Do("PTTL", "missing"))
+	assert.NoError(t, err)
+	assert.Equal(t, -2, pttl)
+	pttl, err = redis.Int(conn.Do("PTTL", "nxkey"))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, pttl)
 
-	// 验证键已过期
-	exval, _ := conn.Do("GET", "exkey")
-	// 忽略具体返回值，测试是否为nil太严格
-	t.Logf("期望exkey已过期，实际值: %v", exval)
+	// 旧版本以秒存储的过期时间仍然可以读取
+	legacy := strconv.FormatInt(time.Now().Unix()+50, 10)
+	assert.NoError(t, bc.Put([]byte(encodeKeyExpire("nxkey")), []byte(legacy)))
+	ttl, err = redis.Int(conn.Do("TTL", "nxkey"))
+	assert.NoError(t, err)
+	assert.InDelta(t, 50, ttl, 1)
+
+	// 非法参数
+	_, err = conn.Do("SET", "k", "v", "NX", "XX")
+	assert.ErrorContains(t, err, "syntax error")
+	_, err = conn.Do("SET", "k", "v", "EX", 10, "KEEPTTL")
+	assert.ErrorContains(t, err, "syntax error")
+	_, err = conn.Do("SET", "k", "v", "PX")
+	assert.ErrorContains(t, err, "syntax error")
+	_, err = conn.Do("SET", "k", "v", "EX", 0)
+	assert.ErrorContains(t, err, "invalid expire time")
+
+	// 换算成毫秒或加上当前时间会溢出的过期时间
+	_, err = conn.Do("SET", "k", "v", "EX", int64(math.MaxInt64/1000+1))
+	assert.ErrorContains(t, err, "invalid expire time")
+	_, err = conn.Do("SET", "k", "v", "PX", int64(math.MaxInt64))
+	assert.ErrorContains(t, err, "invalid expire time")
+	_, err = conn.Do("SETEX", "k", int64(math.MaxInt64), "v")
+	assert.ErrorContains(t, err, "invalid expire time")
 }
 
-func TestListOperations(t *testing.T) {
+func TestExpireVariants(t *testing.T) {
 	bc, server, tmpDir := setupTest(t)
 	defer teardownTest(t, bc, server, tmpDir)
 
 	conn := getRedisConn(t)
 	defer conn.Close()
 
-	// 测试LPUSH和RPUSH
-	reply, err := conn.Do("LPUSH", "mylist", "value1", "value2")
-	assert.NoError(t, err)
-	assert.Equal(t, int64(2), reply)
+	for _, key := range []string{"k1", "k2", "k3", "k4", "past1", "past2"} {
+		_, err := conn.Do("SET", key, "v")
+		assert.NoError(t, err)
+	}
+	now := time.Now()
 
-	reply, err = conn.Do("RPUSH", "mylist", "value3", "value4")
+	// 各命令统一换算为毫秒时间戳，TTL/PTTL 一致
+	reply, err := conn.Do("EXPIREAT", "k1", now.Unix()+100)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(4), reply)
+	assert.Equal(t, int64(1), reply)
+	ttl, err := redis.Int(conn.Do("TTL", "k1"))
+	assert.NoError(t, err)
+	assert.InDelta(t, 100, ttl, 1)
 
-	// 测试LLEN
-	reply, err = conn.Do("LLEN", "mylist")
+	reply, err = conn.Do("PEXPIRE", "k2", 1200)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(4), reply)
+	assert.Equal(t, int64(1), reply)
+	pttl, err := redis.Int(conn.Do("PTTL", "k2"))
+	assert.NoError(t, err)
+	assert.Greater(t, pttl, 700)
+	assert.LessOrEqual(t, pttl, 1200)
+	ttl, err = redis.Int(conn.Do("TTL", "k2"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ttl)
 
-	// 测试LRANGE
-	reply, err = conn.Do("LRANGE", "mylist", 0, -1)
+	reply, err = conn.Do("PEXPIREAT", "k3", now.UnixMilli()+50000)
 	assert.NoError(t, err)
-	values := reply.([]interface{})
-	assert.Equal(t, 4, len(values))
+	assert.Equal(t, int64(1), reply)
+	ttl, err = redis.Int(conn.Do("TTL", "k3"))
+	assert.NoError(t, err)
+	assert.InDelta(t, 50, ttl, 1)
 
-	// 注意：根据实际实现，LPUSH可能把元素插到列表头部，所以顺序可能与预期不同
-	// 只检查内容是否存在，不检查顺序
-	valueStrings := make([]string, len(values))
-	for i, v := range values {
-		valueStrings[i] = string(v.([]byte))
+	// 不存在的键返回0
+	for _, cmd := range []string{"EXPIRE", "EXPIREAT", "PEXPIRE", "PEXPIREAT"} {
+		reply, err = conn.Do(cmd, "missing", 100)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), reply, cmd)
 	}
-	assert.Contains(t, valueStrings, "value1")
-	assert.Contains(t, valueStrings, "value2")
-	assert.Contains(t, valueStrings, "value3")
-	assert.Contains(t, valueStrings, "value4")
+	_, err = conn.Do("EXPIRE", "k4", "abc")
+	assert.ErrorContains(t, err, "not an integer")
 
-	// 测试LPOP和RPOP
-	popped1, err := conn.Do("LPOP", "mylist")
+	// 已经过去的绝对时间戳让键立即过期
+	reply, err = conn.Do("EXPIREAT", "past1", now.Unix()-10)
 	assert.NoError(t, err)
-	assert.NotNil(t, popped1)
-
-	popped2, err := conn.Do("RPOP", "mylist")
+	assert.Equal(t, int64(1), reply)
+	reply, err = conn.Do("PEXPIREAT", "past2", now.UnixMilli()-1)
 	assert.NoError(t, err)
-	assert.NotNil(t, popped2)
+	assert.Equal(t, int64(1), reply)
+	for _, key := range []string{"past1", "past2"} {
+		reply, err = conn.Do("GET", key)
+		assert.NoError(t, err)
+		assert.Nil(t, reply)
+		n, err := redis.Int(conn.Do("EXISTS", key))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+		_, ok := bc.Get([]byte(key))
+		assert.False(t, ok)
+	}
 
-	// 测试空列表
-	_, err = conn.Do("DEL", "mylist")
+	// SETEX
+	reply, err = conn.Do("SETEX", "sx", 30, "value")
 	assert.NoError(t, err)
-
-	reply, err = conn.Do("LPOP", "mylist")
+	assert.Equal(t, "OK", reply)
+	value, err := redis.String(conn.Do("GET", "sx"))
 	assert.NoError(t, err)
-	assert.Nil(t, reply)
+	assert.Equal(t, "value", value)
+	ttl, err = redis.Int(conn.Do("TTL", "sx"))
+	assert.NoError(t, err)
+	assert.InDelta(t, 30, ttl, 1)
+	_, err = conn.Do("SETEX", "sx", 0, "value")
+	assert.ErrorContains(t, err, "invalid expire time")
 }
 
-func TestHashOperations(t *testing.T) {
+func TestMultiStringOperations(t *testing.T) {
 	bc, server, tmpDir := setupTest(t)
 	defer teardownTest(t, bc, server, tmpDir)
 
 	conn := getRedisConn(t)
 	defer conn.Close()
 
-	// 测试HSET
-	reply, err := conn.Do("HSET", "myhash", "field1", "value1", "field2", "value2")
+	// MSET/MGET，MGET 按参数顺序返回，不存在的键为nil
+	reply, err := conn.Do("MSET", "k1", "v1", "k2", "v2", "k3", "v3")
 	assert.NoError(t, err)
-	assert.Equal(t, int64(2), reply)
-
-	// 测试HGET
-	reply, err = conn.Do("HGET", "myhash", "field1")
+	assert.Equal(t, "OK", reply)
+	_, err = conn.Do("RPUSH", "alist", "a")
 	assert.NoError(t, err)
-	assert.Equal(t, "value1", string(reply.([]byte)))
 
-	// 测试HEXISTS
-	reply, err = conn.Do("HEXISTS", "myhash", "field1")
+	values, err := redis.Values(conn.Do("MGET", "k3", "missing", "k1", "alist", "k2"))
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), reply)
+	assert.Equal(t, []interface{}{[]byte("v3"), nil, []byte("v1"), nil, []byte("v2")}, values)
+	keyType, ok := bc.Get([]byte(encodeKeyType("k2")))
+	assert.True(t, ok)
+	assert.Equal(t, TypeString, string(keyType))
 
-	reply, err = conn.Do("HEXISTS", "myhash", "nonexistent")
+	_, err = conn.Do("MSET", "k1", "v1", "k2")
+	assert.Error(t, err)
+
+	// SETNX 不覆盖已有的键
+	reply, err = conn.Do("SETNX", "k1", "other")
 	assert.NoError(t, err)
 	assert.Equal(t, int64(0), reply)
+	value, err := redis.String(conn.Do("GET", "k1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", value)
 
-	// 测试HGETALL
-	reply, err = conn.Do("HGETALL", "myhash")
+	reply, err = conn.Do("SETNX", "fresh", "new")
 	assert.NoError(t, err)
-	values := reply.([]interface{})
-	assert.Equal(t, 4, len(values))
+	assert.Equal(t, int64(1), reply)
+	value, err = redis.String(conn.Do("GET", "fresh"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new", value)
 
-	// 测试HKEYS
-	reply, err = conn.Do("HKEYS", "myhash")
+	reply, err = conn.Do("SETNX", "alist", "x")
 	assert.NoError(t, err)
-	keys := reply.([]interface{})
-	assert.Equal(t, 2, len(keys))
+	assert.Equal(t, int64(0), reply)
 
-	// 测试HDEL
-	reply, err = conn.Do("HDEL", "myhash", "field1", "nonexistent")
+	// GETSET 返回旧值
+	value, err = redis.String(conn.Do("GETSET", "k2", "v2-new"))
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), reply)
+	assert.Equal(t, "v2", value)
+	value, err = redis.String(conn.Do("GET", "k2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v2-new", value)
 
-	reply, err = conn.Do("HGET", "myhash", "field1")
+	reply, err = conn.Do("GETSET", "brand-new", "first")
 	assert.NoError(t, err)
 	assert.Nil(t, reply)
+	value, err = redis.String(conn.Do("GET", "brand-new"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first", value)
+
+	_, err = conn.Do("GETSET", "alist", "x")
+	assert.ErrorContains(t, err, "WRONGTYPE")
+
+	// MSET 和 GETSET 与 SET 相同，覆盖写入会清除原有的过期时间
+	for _, command := range [][]interface{}{{"MSET", "k1", "v1", "k2", "v2"}, {"GETSET", "k1", "v1"}} {
+		_, err = conn.Do("SET", "k1", "old", "EX", 100)
+		assert.NoError(t, err)
+		_, err = conn.Do(command[0].(string), command[1:]...)
+		assert.NoError(t, err)
+		ttl, err := redis.Int(conn.Do("TTL", "k1"))
+		assert.NoError(t, err)
+		assert.Equal(t, -1, ttl, command[0])
+	}
+
+	// MSET 覆盖复杂类型的键时删除原有的成员
+	_, err = conn.Do("HSET", "ahash", "f", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("MSET", "ahash", "s1", "alist", "s2")
+	assert.NoError(t, err)
+	values, err = redis.Values(conn.Do("MGET", "ahash", "alist"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("s1"), []byte("s2")}, values)
+	for _, prefix := range []string{HashFieldPrefx + "ahash:", ListItemPrefx + "alist:"} {
+		assert.NoError(t, bc.ScanPrefix([]byte(prefix), func(key, _ []byte) error {
+			t.Errorf("覆盖后仍有成员键: %s", key)
+			return nil
+		}))
+	}
+	_, ok = bc.Get([]byte(encodeListMeta("alist")))
+	assert.False(t, ok)
 }
 
-func TestSetOperations(t *testing.T) {
+func TestIncrOperations(t *testing.T) {
 	bc, server, tmpDir := setupTest(t)
 	defer teardownTest(t, bc, server, tmpDir)
 
 	conn := getRedisConn(t)
 	defer conn.Close()
 
-	// 测试SADD
-	reply, err := conn.Do("SADD", "myset", "member1", "member2", "member3")
+	// 键不存在时视为0
+	reply, err := conn.Do("INCR", "counter")
 	assert.NoError(t, err)
-	assert.Equal(t, int64(3), reply)
+	assert.Equal(t, int64(1), reply)
 
-	// 测试SISMEMBER
-	reply, err = conn.Do("SISMEMBER", "myset", "member1")
+	reply, err = conn.Do("INCRBY", "counter", 10)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), reply)
+	assert.Equal(t, int64(11), reply)
 
-	reply, err = conn.Do("SISMEMBER", "myset", "nonexistent")
+	reply, err = conn.Do("DECR", "counter")
 	assert.NoError(t, err)
-	assert.Equal(t, int64(0), reply)
+	assert.Equal(t, int64(10), reply)
 
-	// 测试SMEMBERS
-	reply, err = conn.Do("SMEMBERS", "myset")
+	reply, err = conn.Do("DECRBY", "counter", 15)
 	assert.NoError(t, err)
-	members := reply.([]interface{})
-	assert.Equal(t, 3, len(members))
+	assert.Equal(t, int64(-5), reply)
 
-	// 测试SREM
-	reply, err = conn.Do("SREM", "myset", "member1", "nonexistent")
+	// 结果以字符串形式存储，并设置字符串类型标记
+	value, err := redis.String(conn.Do("GET", "counter"))
 	assert.NoError(t, err)
-	assert.Equal(t, int64(1), reply)
+	assert.Equal(t, "-5", value)
+	keyType, ok := bc.Get([]byte(encodeKeyType("counter")))
+	assert.True(t, ok)
+	assert.Equal(t, TypeString, string(keyType))
 
-	reply, err = conn.Do("SISMEMBER", "myset", "member1")
+	// 非数字的值和增量
+	_, err = conn.Do("SET", "text", "abc")
 	assert.NoError(t, err)
-	assert.Equal(t, int64(0), reply)
+	_, err = conn.Do("INCR", "text")
+	assert.ErrorContains(t, err, "value is not an integer or out of range")
+	_, err = conn.Do("INCRBY", "counter", "x")
+	assert.ErrorContains(t, err, "value is not an integer or out of range")
+
+	// 溢出时返回错误且不修改原值
+	_, err = conn.Do("SET", "big", "9223372036854775807")
+	assert.NoError(t, err)
+	_, err = conn.Do("INCR", "big")
+	assert.ErrorContains(t, err, "overflow")
+	_, err = conn.Do("SET", "small", "-9223372036854775808")
+	assert.NoError(t, err)
+	_, err = conn.Do("DECRBY", "small", 1)
+	assert.ErrorContains(t, err, "overflow")
+	_, err = conn.Do("DECRBY", "counter", "-9223372036854775808")
+	assert.ErrorContains(t, err, "overflow")
+	value, err = redis.String(conn.Do("GET", "big"))
+	assert.NoError(t, err)
+	assert.Equal(t, "9223372036854775807", value)
+
+	// 类型不匹配
+	_, err = conn.Do("RPUSH", "alist", "a")
+	assert.NoError(t, err)
+	_, err = conn.Do("INCR", "alist")
+	assert.ErrorContains(t, err, "WRONGTYPE")
+
+	// 多个连接并发自增不丢失更新
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := getRedisConn(t)
+			defer c.Close()
+			for j := 0; j < 50; j++ {
+				_, err := c.Do("INCR", "shared")
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	total, err := redis.Int(conn.Do("GET", "shared"))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, total)
 }
 
-func TestZSetOperations(t *testing.T) {
+func TestExpireOperations(t *testing.T) {
 	bc, server, tmpDir := setupTest(t)
 	defer teardownTest(t, bc, server, tmpDir)
 
 	conn := getRedisConn(t)
 	defer conn.Close()
 
-	// 测试ZADD
-	reply, err := conn.Do("ZADD", "myzset", 1.0, "member1", 2.0, "member2", 3.0, "member3")
-	assert.NoError(t, err)
-	assert.Equal(t, int64(3), reply)
-
-	// 测试ZSCORE
-	reply, err = conn.Do("ZSCORE", "myzset", "member2")
+	// 设置一个键
+	_, err := conn.Do("SET", "expirekey", "value")
 	assert.NoError(t, err)
-	scoreStr := string(reply.([]byte))
-	// 允许浮点数格式的变化，只检查是否是2.0开头
-	assert.Contains(t, scoreStr, "2")
 
-	// 测试ZRANK
-	reply, err = conn.Do("ZRANK", "myzset", "member2")
+	// 设置过期时间为2秒
+	reply, err := conn.Do("EXPIRE", "expirekey", 2)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), reply)
 
-	reply, err = conn.Do("ZRANK", "myzset", "nonexistent")
+	// 检查TTL
+	reply, err = conn.Do("TTL", "expirekey")
 	assert.NoError(t, err)
-	assert.Nil(t, reply)
+	ttl := reply.(int64)
+	assert.True(t, ttl > 0 && ttl <= 2)
 
-	// 测试ZRANGE
-	reply, err = conn.Do("ZRANGE", "myzset", 0, -1, "WITHSCORES")
-	assert.NoError(t, err)
-	values := reply.([]interface{})
-	assert.Equal(t, 6, len(values))
-}
+	// 等待过期 - 增加等待时间，因为可能有延迟
+	time.Sleep(4000 * time.Millisecond)
 
-func TestPersistence(t *testing.T) {
-	// 创建测试目录
-	tmpDir, err := os.MkdirTemp("", "redis-persistence-*")
+	// 验证键已过期 - 忽略具体返回值，只要能获取到值（即便是错误的）也认为测试失败
+	// 测试是否为nil的条件太严格，改为检查是否能继续测试
+	_, err = conn.Do("GET", "expirekey")
+	// 忽略具体错误，继续测试
+
+	// 测试SET命令的EX选项 - 使用更短的过期时间和更长的等待时间
+	_, err = conn.Do("SET", "exkey", "exvalue", "EX", 1)
 	assert.NoError(t, err)
-	defer os.RemoveAll(tmpDir)
 
-	walDir := filepath.Join(tmpDir, "wal")
-	// hintDir := filepath.Join(tmpDir, "hint") // 注释掉未使用的变量
+	// 等待足够长的时间确保过期
+	time.Sleep(3000 * time.Millisecond)
 
-	// 第一次启动，写入数据
-	func() {
-		conf := config.NewConfig()
-		conf.DataDir = tmpDir
-		conf.WalDir = "wal"
-		conf.HintDir = "hint"
-		conf.AutoSync = true
+	// 验证键已过期
+	exval, _ := conn.Do("GET", "exkey")
+	// 忽略具体返回值，测试是否为nil太严格
+	t.Logf("期望exkey已过期，实际值: %v", exval)
+}
 
-		bc, err := bitcask.NewBitcask(conf)
-		assert.NoError(t, err)
-		defer bc.Close()
+func TestKeyOperations(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
 
-		addr := "127.0.0.1:6381"
-		server := NewServer(bc, addr)
-		go server.Start()
-		time.Sleep(500 * time.Millisecond)
-		defer server.Stop()
+	conn := getRedisConn(t)
+	defer conn.Close()
 
-		conn, err := redis.Dial("tcp", addr)
+	_, err := conn.Do("SET", "str", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("RPUSH", "list", "a")
+	assert.NoError(t, err)
+	_, err = conn.Do("HSET", "hash", "f", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("SADD", "set", "m")
+	assert.NoError(t, err)
+	_, err = conn.Do("ZADD", "zset", 1, "m")
+	assert.NoError(t, err)
+	// 没有类型标记的原始字符串键
+	assert.NoError(t, bc.Put([]byte("raw"), []byte("v")))
+
+	// TYPE 按类型标记返回
+	for key, expected := range map[string]string{
+		"str": TypeString, "list": TypeList, "hash": TypeHash, "set": TypeSet,
+		"zset": TypeZSet, "raw": TypeString, "missing": "none",
+	} {
+		reply, err := redis.String(conn.Do("TYPE", key))
 		assert.NoError(t, err)
-		defer conn.Close()
+		assert.Equal(t, expected, reply, key)
+	}
 
-		// 写入一些数据
-		_, err = conn.Do("SET", "persistkey", "persistvalue")
-		assert.NoError(t, err)
+	// EXISTS 返回存在的键数量，重复的键重复计数
+	reply, err := conn.Do("EXISTS", "str", "list", "missing", "raw", "str")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), reply)
+
+	// 已过期的键不计入，TYPE 返回 none
+	_, err = conn.Do("SET", "old", "v")
+	assert.NoError(t, err)
+	past := strconv.FormatInt(time.Now().Unix()-10, 10)
+	assert.NoError(t, bc.Put([]byte(encodeKeyExpire("old")), []byte(past)))
+	reply, err = conn.Do("EXISTS", "old", "str")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+	assert.NoError(t, bc.Put([]byte("old"), []byte("v")))
+	assert.NoError(t, bc.Put([]byte(encodeKeyExpire("old")), []byte(past)))
+	typeReply, err := redis.String(conn.Do("TYPE", "old"))
+	assert.NoError(t, err)
+	assert.Equal(t, "none", typeReply)
+
+	// PERSIST 移除过期时间
+	reply, err = conn.Do("EXPIRE", "str", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+	reply, err = conn.Do("PERSIST", "str")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+	reply, err = conn.Do("TTL", "str")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), reply)
+	_, ok := bc.Get([]byte(encodeKeyExpire("str")))
+	assert.False(t, ok)
+
+	// 没有过期时间或键不存在时返回0
+	reply, err = conn.Do("PERSIST", "str")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), reply)
+	reply, err = conn.Do("PERSIST", "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), reply)
+}
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, str string
+		matched      bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "user:", true},
+		{"user:*", "admin:1", false},
+		{"*:name", "user:1:name", true},
+		{"a**b", "axxb", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hallo", true},
+		{"h?llo", "hllo", false},
+		{"[ab]c", "ac", true},
+		{"[ab]c", "bc", true},
+		{"[ab]c", "cc", false},
+		{"[^ab]c", "cc", true},
+		{"[^ab]c", "ac", false},
+		{"key[0-9]", "key5", true},
+		{"key[0-9]", "keyx", false},
+		{"key[9-0]", "key5", true},
+		{"[a\\]]x", "]x", true},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"h\\?", "h?", true},
+		{"h\\?", "hx", false},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+		// 旧版本的“包含”语义需要显式写成 *sub*
+		{"*sub*", "has-sub-string", true},
+		{"*sub*", "nothing", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.matched, matchPattern(c.pattern, c.str), "pattern=%q str=%q", c.pattern, c.str)
+	}
+}
+
+func TestKeysPattern(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	for _, key := range []string{"user:1", "user:2", "admin:1", "hello", "hallo", "ac", "bc"} {
+		_, err := conn.Do("SET", key, "v")
+		assert.NoError(t, err)
+	}
+	_, err := conn.Do("HSET", "user:hash", "f", "v")
+	assert.NoError(t, err)
+
+	keys := func(pattern string) []string {
+		reply, err := redis.Strings(conn.Do("KEYS", pattern))
+		assert.NoError(t, err)
+		sort.Strings(reply)
+		return reply
+	}
+	// 内部前缀的键不会出现在结果中
+	assert.Equal(t, []string{"ac", "admin:1", "bc", "hallo", "hello", "user:1", "user:2"}, keys("*"))
+	assert.Equal(t, []string{"user:1", "user:2"}, keys("user:*"))
+	assert.Equal(t, []string{"hallo", "hello"}, keys("h?llo"))
+	assert.Equal(t, []string{"ac", "bc"}, keys("[ab]c"))
+	assert.Equal(t, []string{"admin:1", "user:1"}, keys("*:1"))
+	assert.Equal(t, []string{"admin:1"}, keys("*min*"))
+	assert.Empty(t, keys("user"))
+
+	// 已过期的键被跳过
+	past := strconv.FormatInt(time.Now().Unix()-10, 10)
+	assert.NoError(t, bc.Put([]byte(encodeKeyExpire("user:2")), []byte(past)))
+	assert.Equal(t, []string{"user:1"}, keys("user:*"))
+}
+
+func TestScan(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	expected := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("scan:%d", i)
+		_, err := conn.Do("SET", key, "v")
+		assert.NoError(t, err)
+		expected[key] = true
+	}
+	// 内部前缀的键不会出现在结果中
+	_, err := conn.Do("HSET", "scan:hash", "f", "v")
+	assert.NoError(t, err)
+
+	scanAll := func(args ...interface{}) []string {
+		var keys []string
+		cursor := "0"
+		for calls := 0; ; calls++ {
+			reply, err := redis.Values(conn.Do("SCAN", append([]interface{}{cursor}, args...)...))
+			assert.NoError(t, err)
+			assert.Len(t, reply, 2)
+			cursor, _ = redis.String(reply[0], nil)
+			page, err := redis.Strings(reply[1], nil)
+			assert.NoError(t, err)
+			keys = append(keys, page...)
+			if cursor == "0" {
+				return keys
+			}
+			// 插入新键不影响已有键的遍历
+			if calls == 3 {
+				_, err := conn.Do("SET", fmt.Sprintf("late:%d", calls), "v")
+				assert.NoError(t, err)
+			}
+			if calls > 1000 {
+				t.Fatalf("SCAN 没有结束")
+			}
+		}
+	}
+
+	// 多次调用覆盖全部键，且没有重复
+	keys := scanAll("COUNT", 7)
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		assert.False(t, seen[key], "重复的键: %s", key)
+		seen[key] = true
+	}
+	for key := range expected {
+		assert.True(t, seen[key], "遗漏的键: %s", key)
+	}
+	for key := range seen {
+		assert.True(t, expected[key] || strings.HasPrefix(key, "late:"), "多余的键: %s", key)
+	}
+
+	// MATCH 使用 glob 规则
+	matched := scanAll("MATCH", "scan:1?", "COUNT", 5)
+	sort.Strings(matched)
+	assert.Equal(t, []string{"scan:10", "scan:11", "scan:12", "scan:13", "scan:14", "scan:15", "scan:16", "scan:17", "scan:18", "scan:19"}, matched)
+
+	// 一次取完时直接返回0
+	reply, err := redis.Values(conn.Do("SCAN", 0, "COUNT", 1000))
+	assert.NoError(t, err)
+	cursor, _ := redis.String(reply[0], nil)
+	assert.Equal(t, "0", cursor)
+
+	_, err = conn.Do("SCAN", "!!", "COUNT", 10)
+	assert.ErrorContains(t, err, "invalid cursor")
+	_, err = conn.Do("SCAN", 0, "COUNT")
+	assert.ErrorContains(t, err, "syntax error")
+	_, err = conn.Do("SCAN", 0, "COUNT", 0)
+	assert.Error(t, err)
+}
+
+func TestDBSizeAndFlushDB(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	dbsize := func() int {
+		n, err := redis.Int(conn.Do("DBSIZE"))
+		assert.NoError(t, err)
+		return n
+	}
+	assert.Equal(t, 0, dbsize())
+
+	// 每种类型只计数一次，内部标记不计入
+	_, err := conn.Do("SET", "s1", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "s2", "v", "EX", 100)
+	assert.NoError(t, err)
+	_, err = conn.Do("RPUSH", "list", "a", "b", "c")
+	assert.NoError(t, err)
+	_, err = conn.Do("HSET", "hash", "f1", "v", "f2", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("SADD", "set", "m1", "m2")
+	assert.NoError(t, err)
+	_, err = conn.Do("ZADD", "zset", 1, "m")
+	assert.NoError(t, err)
+	assert.Equal(t, 6, dbsize())
+
+	// 已过期的键不计入
+	past := strconv.FormatInt(time.Now().Unix()-10, 10)
+	assert.NoError(t, bc.Put([]byte(encodeKeyExpire("s2")), []byte(past)))
+	assert.Equal(t, 5, dbsize())
+
+	// FLUSHDB 之后存储为空，仍然可以写入
+	reply, err := conn.Do("FLUSHDB")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+	assert.Equal(t, 0, dbsize())
+	count := 0
+	assert.NoError(t, bc.Scan(func(_, _ []byte) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 0, count)
+
+	_, err = conn.Do("SET", "after", "v")
+	assert.NoError(t, err)
+	value, err := redis.String(conn.Do("GET", "after"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v", value)
+	assert.Equal(t, 1, dbsize())
+}
+
+func TestSelectDB(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	dbsize := func() int {
+		n, err := redis.Int(conn.Do("DBSIZE"))
+		assert.NoError(t, err)
+		return n
+	}
+	selectDB := func(db int) {
+		reply, err := conn.Do("SELECT", db)
+		assert.NoError(t, err)
+		assert.Equal(t, "OK", reply)
+	}
+
+	_, err := conn.Do("SET", "k", "v0")
+	assert.NoError(t, err)
+	_, err = conn.Do("RPUSH", "list", "a", "b")
+	assert.NoError(t, err)
+
+	// db1 看不到 db0 的键，同名键互不影响
+	selectDB(1)
+	_, err = redis.String(conn.Do("GET", "k"))
+	assert.Equal(t, redis.ErrNil, err)
+	assert.Equal(t, 0, dbsize())
+	_, err = conn.Do("MSET", "k", "v1", "other", "x")
+	assert.NoError(t, err)
+	_, err = conn.Do("SADD", "set", "m")
+	assert.NoError(t, err)
+	_, err = conn.Do("EXPIRE", "other", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, dbsize())
+	keys, err := redis.Strings(conn.Do("KEYS", "*"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"k", "other"}, keys)
+	reply, err := redis.Values(conn.Do("SCAN", "0", "COUNT", 100))
+	assert.NoError(t, err)
+	scanned, err := redis.Strings(reply[1], nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"k", "other"}, scanned)
+
+	// 另一个连接默认使用 db0
+	other := getRedisConn(t)
+	defer other.Close()
+	value, err := redis.String(other.Do("GET", "k"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v0", value)
+	n, err := redis.Int(other.Do("DBSIZE"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	keys, err = redis.Strings(other.Do("KEYS", "*"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k"}, keys)
+
+	info, err := redis.String(other.Do("INFO"))
+	assert.NoError(t, err)
+	assert.Contains(t, info, "db0:keys=2\r\n")
+	assert.Contains(t, info, "db1:keys=3\r\n")
+
+	// 事务中的命令使用入队时选择的数据库
+	_, err = conn.Do("MULTI")
+	assert.NoError(t, err)
+	_, err = conn.Do("INCR", "counter")
+	assert.NoError(t, err)
+	_, err = conn.Do("EXEC")
+	assert.NoError(t, err)
+	_, err = redis.String(other.Do("GET", "counter"))
+	assert.Equal(t, redis.ErrNil, err)
+
+	// FLUSHDB 只清空当前数据库
+	reply2, err := conn.Do("FLUSHDB")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply2)
+	assert.Equal(t, 0, dbsize())
+	value, err = redis.String(other.Do("GET", "k"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v0", value)
+	length, err := redis.Int(other.Do("LLEN", "list"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, length)
+
+	// 参数错误
+	_, err = conn.Do("SELECT", 16)
+	assert.ErrorContains(t, err, "DB index is out of range")
+	_, err = conn.Do("SELECT", "x")
+	assert.ErrorContains(t, err, "not an integer")
+	_, err = conn.Do("SWAPDB", 0, -1)
+	assert.ErrorContains(t, err, "DB index is out of range")
+
+	// SWAPDB 交换两个数据库中的所有键，包括复杂类型和过期时间
+	_, err = conn.Do("SET", "k", "v1", "EX", 100)
+	assert.NoError(t, err)
+	_, err = conn.Do("HSET", "hash", "f", "v")
+	assert.NoError(t, err)
+	reply2, err = other.Do("SWAPDB", 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply2)
+	value, err = redis.String(other.Do("GET", "k"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", value)
+	ttl, err := redis.Int(other.Do("TTL", "k"))
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, 0)
+	field, err := redis.String(other.Do("HGET", "hash", "f"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v", field)
+	length, err = redis.Int(other.Do("LLEN", "list"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, length)
+
+	value, err = redis.String(conn.Do("GET", "k"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v0", value)
+	ttl, err = redis.Int(conn.Do("TTL", "k"))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, ttl)
+	items, err := redis.Strings(conn.Do("LRANGE", "list", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, items)
+	assert.Equal(t, 2, dbsize())
+
+	// FLUSHALL 清空所有数据库
+	reply2, err = conn.Do("FLUSHALL")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply2)
+	assert.Equal(t, 0, dbsize())
+	n, err = redis.Int(other.Do("DBSIZE"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+// 测试 db0 中以 "db<n>:" 开头的键与对应数据库的键互不影响，之前写入的以 "db" 开头的 db0 键在启动时迁移
+func TestSelectDBKeyCollision(t *testing.T) {
+	bc, server, tmpDir := setupTestServer(t, nil, func(s *Server) {
+		// 之前的版本中 db0 的键都不加前缀
+		assert.NoError(t, s.bc.Put([]byte("dbold"), []byte("legacy")))
+		assert.NoError(t, s.bc.Put([]byte(KeyTypePrefx+"dbold"), []byte(TypeString)))
+	})
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+	other := getRedisConn(t)
+	defer other.Close()
+	_, err := other.Do("SELECT", 1)
+	assert.NoError(t, err)
+
+	value, err := redis.String(conn.Do("GET", "dbold"))
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy", value)
+
+	_, err = conn.Do("SET", "db1:foo", "db0-value")
+	assert.NoError(t, err)
+	_, err = conn.Do("RPUSH", "db1:list", "a")
+	assert.NoError(t, err)
+	_, err = other.Do("SET", "foo", "db1-value")
+	assert.NoError(t, err)
+
+	value, err = redis.String(conn.Do("GET", "db1:foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "db0-value", value)
+	value, err = redis.String(other.Do("GET", "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "db1-value", value)
+
+	keys, err := redis.Strings(conn.Do("KEYS", "*"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"dbold", "db1:foo"}, keys)
+	n, err := redis.Int(conn.Do("DBSIZE"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	keys, err = redis.Strings(other.Do("KEYS", "*"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, keys)
+	reply, err := redis.Values(other.Do("SCAN", "0", "COUNT", 100))
+	assert.NoError(t, err)
+	scanned, err := redis.Strings(reply[1], nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, scanned)
+
+	// 清空 db0 不影响 db1 的同名键
+	_, err = conn.Do("FLUSHDB")
+	assert.NoError(t, err)
+	value, err = redis.String(other.Do("GET", "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "db1-value", value)
+	n, err = redis.Int(conn.Do("DBSIZE"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestDelKeysSharingPrefix(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// 删除 foo 不应影响以 foo 开头的其他键的成员
+	for _, key := range []string{"foo", "foobar"} {
+		_, err := conn.Do("RPUSH", key, "a", "b")
+		assert.NoError(t, err)
+		_, err = conn.Do("HSET", key+"h", "f", "v")
+		assert.NoError(t, err)
+		_, err = conn.Do("ZADD", key+"z", 1, "m")
+		assert.NoError(t, err)
+	}
+	n, err := redis.Int(conn.Do("DEL", "foo", "fooh", "fooz"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	items, err := redis.Strings(conn.Do("LRANGE", "foobar", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, items)
+	value, err := redis.String(conn.Do("HGET", "foobarh", "f"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v", value)
+	members, err := redis.Strings(conn.Do("ZRANGE", "foobarz", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"m"}, members)
+	items, err = redis.Strings(conn.Do("LRANGE", "foo", 0, -1))
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestCompact(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// 创建并删除大的列表和哈希，保留一个键名包含 ":" 的列表
+	for i := 0; i < 500; i++ {
+		_, err := conn.Do("RPUSH", "biglist", fmt.Sprintf("item-%d", i))
+		assert.NoError(t, err)
+		_, err = conn.Do("HSET", "bighash", fmt.Sprintf("field-%d", i), "v")
+		assert.NoError(t, err)
+	}
+	_, err := conn.Do("RPUSH", "keep:list", "a", "b")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "str", "v", "EX", 100)
+	assert.NoError(t, err)
+	n, err := redis.Int(conn.Do("DEL", "biglist", "bighash"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// 模拟旧版本或中途失败留下的孤立内部键
+	orphans := []string{
+		encodeListKey("ghost", 0),
+		encodeListMeta("ghost"),
+		encodeHashKey("ghost", "a:b"),
+		encodeSetKey("ghost", "m"),
+		encodeZSetScoreKey("ghost", "m"),
+		encodeZSetMemberKey("ghost", 1),
+		encodeKeyExpire("ghost"),
+		encodeHashKey("keep:list", "f"), // 所属键存在但类型不匹配
+	}
+	for _, key := range orphans {
+		assert.NoError(t, bc.Put([]byte(key), []byte("x")))
+	}
+
+	removed, err := redis.Int(conn.Do("COMPACT"))
+	assert.NoError(t, err)
+	assert.Equal(t, len(orphans), removed)
+
+	// 键空间中只剩下存活键及其内部键，删除标记已被 Merge 回收
+	var keys []string
+	assert.NoError(t, bc.Scan(func(key, _ []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	}))
+	sort.Strings(keys)
+	assert.Equal(t, []string{
+		encodeListKey("keep:list", 0),
+		encodeListKey("keep:list", 1),
+		encodeListMeta("keep:list"),
+		encodeKeyExpire("str"),
+		encodeKeyType("keep:list"),
+		encodeKeyType("str"),
+		"str",
+	}, keys)
+	stats, err := bc.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, len(keys), stats.Keys)
+	assert.Equal(t, uint64(0), stats.ReclaimableBytes)
+
+	items, err := redis.Strings(conn.Do("LRANGE", "keep:list", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, items)
+
+	// 没有孤立键时返回0
+	removed, err = redis.Int(conn.Do("COMPACT"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+}
+
+func TestListOperations(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// 测试LPUSH和RPUSH
+	reply, err := conn.Do("LPUSH", "mylist", "value1", "value2")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), reply)
+
+	reply, err = conn.Do("RPUSH", "mylist", "value3", "value4")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), reply)
+
+	// 测试LLEN
+	reply, err = conn.Do("LLEN", "mylist")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), reply)
+
+	// 测试LRANGE
+	reply, err = conn.Do("LRANGE", "mylist", 0, -1)
+	assert.NoError(t, err)
+	values := reply.([]interface{})
+	assert.Equal(t, 4, len(values))
+
+	// 注意：根据实际实现，LPUSH可能把元素插到列表头部，所以顺序可能与预期不同
+	// 只检查内容是否存在，不检查顺序
+	valueStrings := make([]string, len(values))
+	for i, v := range values {
+		valueStrings[i] = string(v.([]byte))
+	}
+	assert.Contains(t, valueStrings, "value1")
+	assert.Contains(t, valueStrings, "value2")
+	assert.Contains(t, valueStrings, "value3")
+	assert.Contains(t, valueStrings, "value4")
+
+	// 测试LPOP和RPOP
+	popped1, err := conn.Do("LPOP", "mylist")
+	assert.NoError(t, err)
+	assert.NotNil(t, popped1)
+
+	popped2, err := conn.Do("RPOP", "mylist")
+	assert.NoError(t, err)
+	assert.NotNil(t, popped2)
+
+	// 测试空列表
+	_, err = conn.Do("DEL", "mylist")
+	assert.NoError(t, err)
+
+	reply, err = conn.Do("LPOP", "mylist")
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+}
+
+func TestListInterleaved(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// 与一个切片模型对照，交替在两端写入和弹出
+	var model []string
+	for i := 0; i < 50; i++ {
+		value := fmt.Sprintf("v%d", i)
+		switch i % 5 {
+		case 0, 3:
+			reply, err := conn.Do("LPUSH", "ilist", value)
+			assert.NoError(t, err)
+			model = append([]string{value}, model...)
+			assert.Equal(t, int64(len(model)), reply)
+		case 1, 4:
+			reply, err := conn.Do("RPUSH", "ilist", value)
+			assert.NoError(t, err)
+			model = append(model, value)
+			assert.Equal(t, int64(len(model)), reply)
+		case 2:
+			if i%10 == 2 {
+				reply, err := redis.String(conn.Do("LPOP", "ilist"))
+				assert.NoError(t, err)
+				assert.Equal(t, model[0], reply)
+				model = model[1:]
+			} else {
+				reply, err := redis.String(conn.Do("RPOP", "ilist"))
+				assert.NoError(t, err)
+				assert.Equal(t, model[len(model)-1], reply)
+				model = model[:len(model)-1]
+			}
+		}
+	}
+
+	values, err := redis.Strings(conn.Do("LRANGE", "ilist", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, model, values)
+
+	values, err = redis.Strings(conn.Do("LRANGE", "ilist", 2, 4))
+	assert.NoError(t, err)
+	assert.Equal(t, model[2:5], values)
+
+	length, err := redis.Int(conn.Do("LLEN", "ilist"))
+	assert.NoError(t, err)
+	assert.Equal(t, len(model), length)
+
+	// LPUSH 多个值时，最后一个值位于头部
+	_, err = conn.Do("LPUSH", "order", "a", "b", "c")
+	assert.NoError(t, err)
+	values, err = redis.Strings(conn.Do("LRANGE", "order", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "b", "a"}, values)
+
+	// 弹空后列表被删除，再次写入从空列表开始
+	for range model {
+		_, err = conn.Do("RPOP", "ilist")
+		assert.NoError(t, err)
+	}
+	reply, err := conn.Do("LPOP", "ilist")
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+	_, ok := bc.Get([]byte(encodeListMeta("ilist")))
+	assert.False(t, ok)
+
+	reply, err = conn.Do("RPUSH", "ilist", "again")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+
+	// DEL 同时删除元数据
+	_, err = conn.Do("DEL", "ilist")
+	assert.NoError(t, err)
+	_, ok = bc.Get([]byte(encodeListMeta("ilist")))
+	assert.False(t, ok)
+
+	// 兼容没有元数据的旧列表：元素下标从0开始连续存放
+	assert.NoError(t, bc.Put([]byte(encodeKeyType("legacy")), []byte(TypeList)))
+	for i, v := range []string{"x", "y", "z"} {
+		assert.NoError(t, bc.Put([]byte(encodeListKey("legacy", i)), []byte(v)))
+	}
+	reply, err = conn.Do("RPUSH", "legacy", "w")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), reply)
+	values, err = redis.Strings(conn.Do("LRANGE", "legacy", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"x", "y", "z", "w"}, values)
+}
+
+func TestListIndexOperations(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	lrange := func(key string) []string {
+		values, err := redis.Strings(conn.Do("LRANGE", key, 0, -1))
+		assert.NoError(t, err)
+		return values
+	}
+
+	// LPUSH 让头部下标为负数，确保各命令基于元数据换算下标
+	_, err := conn.Do("RPUSH", "l", "b", "c", "d")
+	assert.NoError(t, err)
+	_, err = conn.Do("LPUSH", "l", "a")
+	assert.NoError(t, err)
+
+	// LINDEX 支持负下标，越界返回nil
+	value, err := redis.String(conn.Do("LINDEX", "l", 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "a", value)
+	value, err = redis.String(conn.Do("LINDEX", "l", -1))
+	assert.NoError(t, err)
+	assert.Equal(t, "d", value)
+	for _, index := range []int{4, -5, 100} {
+		reply, err := conn.Do("LINDEX", "l", index)
+		assert.NoError(t, err)
+		assert.Nil(t, reply)
+	}
+	reply, err := conn.Do("LINDEX", "missing", 0)
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+
+	// LSET
+	reply, err = conn.Do("LSET", "l", -2, "C")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+	assert.Equal(t, []string{"a", "b", "C", "d"}, lrange("l"))
+	_, err = conn.Do("LSET", "l", 4, "x")
+	assert.ErrorContains(t, err, "index out of range")
+	_, err = conn.Do("LSET", "l", -5, "x")
+	assert.ErrorContains(t, err, "index out of range")
+	_, err = conn.Do("LSET", "missing", 0, "x")
+	assert.ErrorContains(t, err, "no such key")
+
+	// LTRIM
+	_, err = conn.Do("RPUSH", "t", "0", "1", "2", "3", "4", "5")
+	assert.NoError(t, err)
+	reply, err = conn.Do("LTRIM", "t", 1, -2)
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, lrange("t"))
+	_, err = conn.Do("RPUSH", "t", "6")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4", "6"}, lrange("t"))
+	_, err = conn.Do("LTRIM", "t", 5, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, lrange("t"))
+	_, ok := bc.Get([]byte(encodeKeyType("t")))
+	assert.False(t, ok)
+
+	// LREM 按 count 的符号决定方向
+	reset := func() {
+		_, err := conn.Do("DEL", "r")
+		assert.NoError(t, err)
+		_, err = conn.Do("RPUSH", "r", "x", "a", "x", "b", "x", "c")
+		assert.NoError(t, err)
+	}
+	reset()
+	n, err := redis.Int(conn.Do("LREM", "r", 2, "x"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"a", "b", "x", "c"}, lrange("r"))
+
+	reset()
+	n, err = redis.Int(conn.Do("LREM", "r", -2, "x"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"x", "a", "b", "c"}, lrange("r"))
+
+	reset()
+	n, err = redis.Int(conn.Do("LREM", "r", 0, "x"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"a", "b", "c"}, lrange("r"))
+	length, err := redis.Int(conn.Do("LLEN", "r"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, length)
+
+	n, err = redis.Int(conn.Do("LREM", "r", 0, "missing"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// 删除全部元素后列表被删除
+	_, err = conn.Do("DEL", "only")
+	assert.NoError(t, err)
+	_, err = conn.Do("RPUSH", "only", "x", "x")
+	assert.NoError(t, err)
+	n, err = redis.Int(conn.Do("LREM", "only", 0, "x"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, ok = bc.Get([]byte(encodeKeyType("only")))
+	assert.False(t, ok)
+}
+
+// 写入数千个元素，每次写入的数据量应保持不变（不移动已有元素）
+func TestListPushCost(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	walSize := func() int64 {
+		var size int64
+		entries, err := os.ReadDir(filepath.Join(tmpDir, "wal"))
+		assert.NoError(t, err)
+		for _, entry := range entries {
+			info, err := entry.Info()
+			assert.NoError(t, err)
+			size += info.Size()
+		}
+		return size
+	}
+
+	const total = 3000
+	batch := make([]interface{}, 0, 101)
+	var first, last int64
+	for i := 0; i < total; i += 100 {
+		batch = append(batch[:0], "biglist")
+		for j := 0; j < 100; j++ {
+			batch = append(batch, fmt.Sprintf("%06d", i+j))
+		}
+		cmd := "RPUSH"
+		if (i/100)%2 == 0 {
+			cmd = "LPUSH"
+		}
+		before := walSize()
+		_, err := conn.Do(cmd, batch...)
+		assert.NoError(t, err)
+		delta := walSize() - before
+		if i == 0 {
+			first = delta
+		}
+		last = delta
+	}
+	// 下标位数增长会让键略微变长，但不应随列表长度线性增长
+	assert.Less(t, last, first*2)
+
+	length, err := redis.Int(conn.Do("LLEN", "biglist"))
+	assert.NoError(t, err)
+	assert.Equal(t, total, length)
+
+	for i := 0; i < total; i++ {
+		cmd := "RPOP"
+		if i%2 == 0 {
+			cmd = "LPOP"
+		}
+		_, err := redis.String(conn.Do(cmd, "biglist"))
+		assert.NoError(t, err)
+	}
+	reply, err := conn.Do("LLEN", "biglist")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), reply)
+}
+
+func TestHashOperations(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// 测试HSET
+	reply, err := conn.Do("HSET", "myhash", "field1", "value1", "field2", "value2")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), reply)
+
+	// 测试HGET
+	reply, err = conn.Do("HGET", "myhash", "field1")
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", string(reply.([]byte)))
+
+	// 测试HEXISTS
+	reply, err = conn.Do("HEXISTS", "myhash", "field1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+
+	reply, err = conn.Do("HEXISTS", "myhash", "nonexistent")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), reply)
+
+	// 测试HGETALL
+	reply, err = conn.Do("HGETALL", "myhash")
+	assert.NoError(t, err)
+	values := reply.([]interface{})
+	assert.Equal(t, 4, len(values))
+
+	// 测试HKEYS
+	reply, err = conn.Do("HKEYS", "myhash")
+	assert.NoError(t, err)
+	keys := reply.([]interface{})
+	assert.Equal(t, 2, len(keys))
+
+	// 测试HDEL
+	reply, err = conn.Do("HDEL", "myhash", "field1", "nonexistent")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+
+	reply, err = conn.Do("HGET", "myhash", "field1")
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+}
+
+func TestHashExtraOperations(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	_, err := conn.Do("HSET", "user", "name", "alice", "age", "30", "city", "paris")
+	assert.NoError(t, err)
+
+	// HMGET 命中和未命中混合，按参数顺序返回
+	values, err := redis.Values(conn.Do("HMGET", "user", "age", "missing", "name"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("30"), nil, []byte("alice")}, values)
+	values, err = redis.Values(conn.Do("HMGET", "nohash", "a", "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{nil, nil}, values)
+
+	// HLEN 和 HVALS
+	length, err := redis.Int(conn.Do("HLEN", "user"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, length)
+	length, err = redis.Int(conn.Do("HLEN", "nohash"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, length)
+	vals, err := redis.Strings(conn.Do("HVALS", "user"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"alice", "30", "paris"}, vals)
+
+	// HINCRBY，字段不存在时视为0
+	n, err := redis.Int64(conn.Do("HINCRBY", "user", "age", 5))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(35), n)
+	n, err = redis.Int64(conn.Do("HINCRBY", "user", "visits", -2))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-2), n)
+	length, err = redis.Int(conn.Do("HLEN", "user"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, length)
+
+	// 不存在的哈希表会被创建
+	n, err = redis.Int64(conn.Do("HINCRBY", "counters", "hits", 1))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	keyType, ok := bc.Get([]byte(encodeKeyType("counters")))
+	assert.True(t, ok)
+	assert.Equal(t, TypeHash, string(keyType))
+
+	// 非整数字段和非整数增量
+	_, err = conn.Do("HINCRBY", "user", "name", 1)
+	assert.ErrorContains(t, err, "hash value is not an integer")
+	_, err = conn.Do("HINCRBY", "user", "age", "x")
+	assert.ErrorContains(t, err, "value is not an integer or out of range")
+	value, err := redis.String(conn.Do("HGET", "user", "name"))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", value)
+
+	// 类型不匹配
+	_, err = conn.Do("SET", "str", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("HINCRBY", "str", "f", 1)
+	assert.ErrorContains(t, err, "WRONGTYPE")
+	_, err = conn.Do("HMGET", "str", "f")
+	assert.ErrorContains(t, err, "WRONGTYPE")
+}
+
+func TestSetOperations(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// 测试SADD
+	reply, err := conn.Do("SADD", "myset", "member1", "member2", "member3")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), reply)
+
+	// 测试SISMEMBER
+	reply, err = conn.Do("SISMEMBER", "myset", "member1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+
+	reply, err = conn.Do("SISMEMBER", "myset", "nonexistent")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), reply)
+
+	// 测试SMEMBERS
+	reply, err = conn.Do("SMEMBERS", "myset")
+	assert.NoError(t, err)
+	members := reply.([]interface{})
+	assert.Equal(t, 3, len(members))
+
+	// 测试SREM
+	reply, err = conn.Do("SREM", "myset", "member1", "nonexistent")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+
+	reply, err = conn.Do("SISMEMBER", "myset", "member1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), reply)
+}
+
+func TestSetAlgebra(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	_, err := conn.Do("SADD", "s1", "a", "b", "c", "d")
+	assert.NoError(t, err)
+	_, err = conn.Do("SADD", "s2", "c", "d", "e")
+	assert.NoError(t, err)
+	_, err = conn.Do("SADD", "s3", "d", "x")
+	assert.NoError(t, err)
+	_, err = conn.Do("SADD", "disjoint", "y", "z")
+	assert.NoError(t, err)
+
+	members := func(cmd string, keys ...interface{}) []string {
+		reply, err := redis.Strings(conn.Do(cmd, keys...))
+		assert.NoError(t, err)
+		return reply
+	}
+
+	// SCARD
+	n, err := redis.Int(conn.Do("SCARD", "s1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	n, err = redis.Int(conn.Do("SCARD", "missing"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// 有交集的集合
+	assert.ElementsMatch(t, []string{"c", "d"}, members("SINTER", "s1", "s2"))
+	assert.ElementsMatch(t, []string{"d"}, members("SINTER", "s1", "s2", "s3"))
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e"}, members("SUNION", "s1", "s2"))
+	assert.ElementsMatch(t, []string{"a", "b"}, members("SDIFF", "s1", "s2"))
+	assert.ElementsMatch(t, []string{"a", "b"}, members("SDIFF", "s1", "s2", "s3"))
+	assert.ElementsMatch(t, []string{"e"}, members("SDIFF", "s2", "s1"))
+
+	// 不相交的集合和不存在的键
+	assert.Empty(t, members("SINTER", "s1", "disjoint"))
+	assert.ElementsMatch(t, []string{"c", "d", "e", "y", "z"}, members("SUNION", "s2", "disjoint"))
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d"}, members("SDIFF", "s1", "disjoint"))
+	assert.Empty(t, members("SINTER", "s1", "missing"))
+	assert.ElementsMatch(t, []string{"c", "d", "e"}, members("SUNION", "s2", "missing"))
+
+	_, err = conn.Do("SET", "str", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("SUNION", "s1", "str")
+	assert.ErrorContains(t, err, "WRONGTYPE")
+
+	// SPOP 移除并返回成员
+	popped, err := redis.String(conn.Do("SPOP", "s2"))
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"c", "d", "e"}, popped)
+	ok, err := redis.Int(conn.Do("SISMEMBER", "s2", popped))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, ok)
+	n, err = redis.Int(conn.Do("SCARD", "s2"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	poppedAll := members("SPOP", "s1", 10)
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d"}, poppedAll)
+	_, exists := bc.Get([]byte(encodeKeyType("s1")))
+	assert.False(t, exists)
+
+	reply, err := conn.Do("SPOP", "s1")
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+	assert.Empty(t, members("SPOP", "s1", 2))
+}
+
+func TestZSetOperations(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// 测试ZADD
+	reply, err := conn.Do("ZADD", "myzset", 1.0, "member1", 2.0, "member2", 3.0, "member3")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), reply)
+
+	// 测试ZSCORE
+	reply, err = conn.Do("ZSCORE", "myzset", "member2")
+	assert.NoError(t, err)
+	scoreStr := string(reply.([]byte))
+	// 允许浮点数格式的变化，只检查是否是2.0开头
+	assert.Contains(t, scoreStr, "2")
+
+	// 测试ZRANK
+	reply, err = conn.Do("ZRANK", "myzset", "member2")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reply)
+
+	reply, err = conn.Do("ZRANK", "myzset", "nonexistent")
+	assert.NoError(t, err)
+	assert.Nil(t, reply)
+
+	// 测试ZRANGE
+	reply, err = conn.Do("ZRANGE", "myzset", 0, -1, "WITHSCORES")
+	assert.NoError(t, err)
+	values := reply.([]interface{})
+	assert.Equal(t, 6, len(values))
+}
+
+func TestZSetExtraOperations(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	_, err := conn.Do("ZADD", "z", 1, "a", 2, "b", 2, "c", 3, "d", 5, "e")
+	assert.NoError(t, err)
+
+	members := func(args ...interface{}) []string {
+		reply, err := redis.Strings(conn.Do(args[0].(string), args[1:]...))
+		assert.NoError(t, err)
+		return reply
+	}
+
+	// ZCARD
+	n, err := redis.Int(conn.Do("ZCARD", "z"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	// ZRANGEBYSCORE 闭区间、开区间和无穷边界
+	assert.Equal(t, []string{"b", "c", "d"}, members("ZRANGEBYSCORE", "z", 2, 3))
+	assert.Equal(t, []string{"d"}, members("ZRANGEBYSCORE", "z", "(2", 3))
+	assert.Equal(t, []string{"b", "c"}, members("ZRANGEBYSCORE", "z", 2, "(3"))
+	assert.Empty(t, members("ZRANGEBYSCORE", "z", "(2", "(3"))
+	assert.Equal(t, []string{"a", "b", "c"}, members("ZRANGEBYSCORE", "z", "-inf", "(3"))
+	assert.Equal(t, []string{"d", "e"}, members("ZRANGEBYSCORE", "z", 3, "+inf"))
+	assert.Empty(t, members("ZRANGEBYSCORE", "z", 4, 2))
+	withScores, err := redis.Strings(conn.Do("ZRANGEBYSCORE", "z", 5, 5, "WITHSCORES"))
+	assert.NoError(t, err)
+	assert.Len(t, withScores, 2)
+	assert.Equal(t, "e", withScores[0])
+	_, err = conn.Do("ZRANGEBYSCORE", "z", "x", 5)
+	assert.ErrorContains(t, err, "not a float")
+
+	// ZREVRANGE 分数相同的成员按成员逆序排列
+	assert.Equal(t, []string{"e", "d", "c", "b", "a"}, members("ZREVRANGE", "z", 0, -1))
+	assert.Equal(t, []string{"c", "b"}, members("ZREVRANGE", "z", 2, 3))
+	assert.Equal(t, []string{"b", "c"}, members("ZRANGE", "z", 1, 2))
+
+	// ZINCRBY
+	score, err := redis.Float64(conn.Do("ZINCRBY", "z", 2.5, "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3.5, score)
+	assert.Equal(t, []string{"d", "a", "e"}, members("ZRANGEBYSCORE", "z", 3, 10))
+	score, err = redis.Float64(conn.Do("ZINCRBY", "z", 1, "new"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, score)
+	score, err = redis.Float64(conn.Do("ZINCRBY", "fresh", -1, "m"))
+	assert.NoError(t, err)
+	assert.Equal(t, -1.0, score)
+
+	// ZREM 同时删除分数键和成员键
+	reply, err := conn.Do("ZREM", "z", "b", "missing", "e")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), reply)
+	_, ok := bc.Get([]byte(encodeZSetScoreKey("z", "b")))
+	assert.False(t, ok)
+	_, ok = bc.Get([]byte(encodeZSetMemberKey("z", 5)))
+	assert.False(t, ok)
+	assert.Equal(t, []string{"new", "c", "d", "a"}, members("ZRANGE", "z", 0, -1))
+
+	// 删除全部成员后类型标记也被删除
+	_, err = conn.Do("ZREM", "fresh", "m")
+	assert.NoError(t, err)
+	_, ok = bc.Get([]byte(encodeKeyType("fresh")))
+	assert.False(t, ok)
+	n, err = redis.Int(conn.Do("ZCARD", "fresh"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestExpireSweeper(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "redis-test-*")
+	assert.NoError(t, err)
+	conf := config.NewConfig()
+	conf.DataDir = tmpDir
+	bc, err := bitcask.NewBitcask(conf)
+	assert.NoError(t, err)
+
+	// 使用较短的清理间隔
+	server := NewServer(bc, "127.0.0.1:6380")
+	server.SetExpireSweepInterval(20 * time.Millisecond)
+	go server.Start()
+	time.Sleep(500 * time.Millisecond)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	_, err = conn.Do("SET", "short", "v", "PX", 50)
+	assert.NoError(t, err)
+	_, err = conn.Do("RPUSH", "list", "a", "b")
+	assert.NoError(t, err)
+	_, err = conn.Do("PEXPIRE", "list", 50)
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "long", "v", "EX", 100)
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "plain", "v")
+	assert.NoError(t, err)
+
+	// 不访问过期的键，等待后台清理
+	time.Sleep(300 * time.Millisecond)
+
+	for _, key := range []string{"short", encodeKeyType("short"), encodeKeyExpire("short"),
+		encodeKeyType("list"), encodeKeyExpire("list"), encodeListMeta("list")} {
+		_, ok := bc.Get([]byte(key))
+		assert.False(t, ok, "%s 应该已被后台清理", key)
+	}
+	count := 0
+	assert.NoError(t, bc.ScanPrefix([]byte(ListItemPrefx+"list"), func(_, _ []byte) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 0, count)
+
+	keys, err := redis.Strings(conn.Do("KEYS", "*"))
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"long", "plain"}, keys)
+	ttl, err := redis.Int(conn.Do("TTL", "long"))
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, 90)
+}
+
+func TestMultiExec(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+	other := getRedisConn(t)
+	defer other.Close()
+
+	_, err := conn.Do("SET", "old", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "counter", "10")
+	assert.NoError(t, err)
+
+	reply, err := conn.Do("MULTI")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+
+	for _, args := range [][]interface{}{
+		{"SET", "k1", "v1"},
+		{"SET", "k2", "v2"},
+		{"MSET", "k3", "v3", "k4", "v4"},
+		{"DEL", "old"},
+		{"INCRBY", "counter", 5},
+		{"GET", "k1"},
+	} {
+		reply, err := conn.Do(args[0].(string), args[1:]...)
+		assert.NoError(t, err)
+		assert.Equal(t, "QUEUED", reply)
+	}
+
+	// EXEC 之前其他连接看不到任何修改
+	values, err := redis.Values(other.Do("MGET", "k1", "k2", "k3", "k4"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{nil, nil, nil, nil}, values)
+	old, err := redis.String(other.Do("GET", "old"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v", old)
+
+	// EXEC 按顺序返回每条命令的结果，事务内的读能看到之前的写
+	results, err := redis.Values(conn.Do("EXEC"))
+	assert.NoError(t, err)
+	assert.Len(t, results, 6)
+	assert.Equal(t, "OK", results[0])
+	assert.Equal(t, "OK", results[2])
+	assert.Equal(t, int64(1), results[3])
+	assert.Equal(t, int64(15), results[4])
+	assert.Equal(t, []byte("v1"), results[5])
+
+	// EXEC 之后所有修改同时可见
+	strs, err := redis.Strings(other.Do("MGET", "k1", "k2", "k3", "k4"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1", "v2", "v3", "v4"}, strs)
+	_, err = redis.String(other.Do("GET", "old"))
+	assert.Equal(t, redis.ErrNil, err)
+	counter, err := redis.Int(other.Do("GET", "counter"))
+	assert.NoError(t, err)
+	assert.Equal(t, 15, counter)
+	keyType, err := redis.String(other.Do("TYPE", "k3"))
+	assert.NoError(t, err)
+	assert.Equal(t, "string", keyType)
+
+	// 执行时的错误只影响该命令
+	_, err = conn.Do("RPUSH", "list", "a")
+	assert.NoError(t, err)
+	_, err = conn.Do("MULTI")
+	assert.NoError(t, err)
+	_, err = conn.Do("INCR", "list")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "k5", "v5")
+	assert.NoError(t, err)
+	results, err = redis.Values(conn.Do("EXEC"))
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.IsType(t, redis.Error(""), results[0])
+	assert.Contains(t, results[0].(redis.Error).Error(), "WRONGTYPE")
+	assert.Equal(t, "OK", results[1])
+
+	// 控制命令的错误用法
+	_, err = conn.Do("EXEC")
+	assert.Error(t, err)
+	_, err = conn.Do("DISCARD")
+	assert.Error(t, err)
+	_, err = conn.Do("MULTI")
+	assert.NoError(t, err)
+	_, err = conn.Do("MULTI")
+	assert.Error(t, err)
+	_, err = conn.Do("DISCARD")
+	assert.NoError(t, err)
+}
+
+func TestMultiDiscard(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	_, err := conn.Do("SET", "k1", "old")
+	assert.NoError(t, err)
+
+	_, err = conn.Do("MULTI")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "k1", "new")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "k2", "v2")
+	assert.NoError(t, err)
+	reply, err := conn.Do("DISCARD")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+
+	// DISCARD 之后没有任何修改，连接回到普通模式
+	value, err := redis.String(conn.Do("GET", "k1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "old", value)
+	_, err = redis.String(conn.Do("GET", "k2"))
+	assert.Equal(t, redis.ErrNil, err)
+
+	// 入队时出错，EXEC 丢弃整个事务
+	_, err = conn.Do("MULTI")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "k2", "v2")
+	assert.NoError(t, err)
+	_, err = conn.Do("LPUSH", "list", "a")
+	assert.Error(t, err)
+	_, err = conn.Do("GET")
+	assert.Error(t, err)
+	_, err = conn.Do("EXEC")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "EXECABORT")
+
+	_, err = redis.String(conn.Do("GET", "k2"))
+	assert.Equal(t, redis.ErrNil, err)
+	exists, err := redis.Int(conn.Do("EXISTS", "list"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, exists)
+}
+
+func TestPersistence(t *testing.T) {
+	// 创建测试目录
+	tmpDir, err := os.MkdirTemp("", "redis-persistence-*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	walDir := filepath.Join(tmpDir, "wal")
+	// hintDir := filepath.Join(tmpDir, "hint") // 注释掉未使用的变量
+
+	// 第一次启动，写入数据
+	func() {
+		conf := config.NewConfig()
+		conf.DataDir = tmpDir
+		conf.WalDir = "wal"
+		conf.HintDir = "hint"
+		conf.AutoSync = true
+
+		bc, err := bitcask.NewBitcask(conf)
+		assert.NoError(t, err)
+		defer bc.Close()
+
+		addr := "127.0.0.1:6381"
+		server := NewServer(bc, addr)
+		go server.Start()
+		time.Sleep(500 * time.Millisecond)
+		defer server.Stop()
+
+		conn, err := redis.Dial("tcp", addr)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		// 写入一些数据
+		_, err = conn.Do("SET", "persistkey", "persistvalue")
+		assert.NoError(t, err)
 
 		_, err = conn.Do("HSET", "persishash", "field", "value")
 		assert.NoError(t, err)
@@ -440,3 +2038,546 @@ func TestInfo(t *testing.T) {
 	assert.Contains(t, info, "connected_clients")
 	// 移除对used_memory的检查，因为服务器可能没有包含此字段
 }
+
+func TestInfoStats(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+	other := getRedisConn(t)
+	defer other.Close()
+	_, err := other.Do("PING")
+	assert.NoError(t, err)
+
+	info, err := redis.String(conn.Do("INFO"))
+	assert.NoError(t, err)
+	assert.Contains(t, info, "connected_clients:2\r\n")
+	assert.NotContains(t, info, "db0:")
+
+	_, err = conn.Do("SET", "k1", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("RPUSH", "list", "a", "b")
+	assert.NoError(t, err)
+	_, err = conn.Do("HSET", "hash", "f", "v")
+	assert.NoError(t, err)
+
+	info, err = redis.String(conn.Do("INFO"))
+	assert.NoError(t, err)
+	assert.Contains(t, info, "db0:keys=3\r\n")
+	assert.Contains(t, info, "uptime_in_seconds:")
+
+	// 命令计数包含之前所有连接上的命令
+	var processed int
+	for _, line := range strings.Split(info, "\r\n") {
+		if v, ok := strings.CutPrefix(line, "total_commands_processed:"); ok {
+			processed, err = strconv.Atoi(v)
+			assert.NoError(t, err)
+		}
+	}
+	assert.GreaterOrEqual(t, processed, 5)
+
+	// 断开连接后连接数减少
+	assert.NoError(t, other.Close())
+	time.Sleep(100 * time.Millisecond)
+	info, err = redis.String(conn.Do("INFO"))
+	assert.NoError(t, err)
+	assert.Contains(t, info, "connected_clients:1\r\n")
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	sub := redis.PubSubConn{Conn: getRedisConn(t)}
+	defer sub.Close()
+	assert.NoError(t, sub.PSubscribe("__keyspace@0__:*"))
+	assert.NoError(t, sub.Subscribe("__keyevent@0__:del"))
+	for i := 0; i < 2; i++ {
+		_, ok := sub.ReceiveWithTimeout(time.Second).(redis.Subscription)
+		assert.True(t, ok, "应收到订阅确认")
+	}
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+	_, err := conn.Do("SET", "foo", "bar", "EX", "100")
+	assert.NoError(t, err)
+	// 内部键被过滤，哈希的修改不产生通知
+	_, err = conn.Do("HSET", "hash", "f", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("DEL", "foo")
+	assert.NoError(t, err)
+
+	receive := func() redis.Message {
+		switch msg := sub.ReceiveWithTimeout(time.Second).(type) {
+		case redis.Message:
+			return msg
+		case error:
+			t.Fatalf("接收通知失败: %v", msg)
+		default:
+			t.Fatalf("收到意外的消息: %#v", msg)
+		}
+		return redis.Message{}
+	}
+	want := []struct{ channel, data string }{
+		{"__keyspace@0__:foo", "set"},
+		{"__keyspace@0__:foo", "expire"},
+		{"__keyspace@0__:foo", "del"},
+		{"__keyevent@0__:del", "foo"},
+	}
+	for _, w := range want {
+		msg := receive()
+		assert.Equal(t, w.channel, msg.Channel)
+		assert.Equal(t, w.data, string(msg.Data))
+	}
+
+	// PUBLISH 返回的数量包含所有模式订阅（redcon 的行为），这里只检查至少有一个订阅方
+	n, err := redis.Int(conn.Do("PUBLISH", "__keyevent@0__:del", "manual"))
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 1)
+	msg := receive()
+	assert.Equal(t, "manual", string(msg.Data))
+}
+
+func TestPubSub(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	// 没有订阅时 UNSUBSCRIBE 返回剩余订阅数0
+	conn := getRedisConn(t)
+	defer conn.Close()
+	reply, err := redis.Values(conn.Do("UNSUBSCRIBE", "news"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("unsubscribe"), []byte("news"), int64(0)}, reply)
+
+	sub := redis.PubSubConn{Conn: getRedisConn(t)}
+	defer sub.Close()
+	assert.NoError(t, sub.Subscribe("news"))
+	assert.NoError(t, sub.PSubscribe("log.*"))
+	for i := 0; i < 2; i++ {
+		_, ok := sub.ReceiveWithTimeout(time.Second).(redis.Subscription)
+		assert.True(t, ok, "应收到订阅确认")
+	}
+
+	receive := func() redis.Message {
+		msg, ok := sub.ReceiveWithTimeout(time.Second).(redis.Message)
+		if !ok {
+			t.Fatal("应收到消息")
+		}
+		return msg
+	}
+	_, err = conn.Do("PUBLISH", "news", "hello")
+	assert.NoError(t, err)
+	msg := receive()
+	assert.Equal(t, "news", msg.Channel)
+	assert.Equal(t, "", msg.Pattern)
+	assert.Equal(t, "hello", string(msg.Data))
+
+	// 不匹配模式的频道收不到消息，匹配的频道带有模式
+	_, err = conn.Do("PUBLISH", "other", "ignored")
+	assert.NoError(t, err)
+	_, err = conn.Do("PUBLISH", "log.error", "disk full")
+	assert.NoError(t, err)
+	msg = receive()
+	assert.Equal(t, "log.error", msg.Channel)
+	assert.Equal(t, "log.*", msg.Pattern)
+	assert.Equal(t, "disk full", string(msg.Data))
+
+	// 取消订阅后不再收到该频道的消息
+	assert.NoError(t, sub.Unsubscribe("news"))
+	unsub, ok := sub.ReceiveWithTimeout(time.Second).(redis.Subscription)
+	assert.True(t, ok, "应收到取消订阅确认")
+	assert.Equal(t, "unsubscribe", unsub.Kind)
+	assert.Equal(t, "news", unsub.Channel)
+	// redcon 只统计同类订阅，剩余的模式订阅不计入
+	assert.Equal(t, 0, unsub.Count)
+	_, err = conn.Do("PUBLISH", "news", "after")
+	assert.NoError(t, err)
+	_, err = conn.Do("PUBLISH", "log.info", "still here")
+	assert.NoError(t, err)
+	msg = receive()
+	assert.Equal(t, "log.info", msg.Channel)
+	assert.Equal(t, "still here", string(msg.Data))
+}
+
+func TestAuth(t *testing.T) {
+	bc, server, tmpDir := setupTestServer(t, nil, func(s *Server) { s.SetPassword("secret") })
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// 认证之前其他命令都被拒绝
+	_, err := conn.Do("PING")
+	assert.ErrorContains(t, err, "NOAUTH Authentication required")
+	_, err = conn.Do("SET", "k", "v")
+	assert.ErrorContains(t, err, "NOAUTH")
+	_, err = conn.Do("MULTI")
+	assert.ErrorContains(t, err, "NOAUTH")
+	_, ok := bc.Get([]byte("k"))
+	assert.False(t, ok)
+
+	_, err = conn.Do("AUTH", "wrong")
+	assert.ErrorContains(t, err, "invalid password")
+	_, err = conn.Do("GET", "k")
+	assert.ErrorContains(t, err, "NOAUTH")
+
+	// 认证之后可以正常执行命令
+	reply, err := conn.Do("AUTH", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+	_, err = conn.Do("SET", "k", "v")
+	assert.NoError(t, err)
+	value, err := redis.String(conn.Do("GET", "k"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v", value)
+
+	// 认证状态按连接记录
+	other, err := redis.Dial("tcp", "127.0.0.1:6380", redis.DialPassword("secret"))
+	assert.NoError(t, err)
+	defer other.Close()
+	value, err = redis.String(other.Do("GET", "k"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v", value)
+
+	anonymous := getRedisConn(t)
+	defer anonymous.Close()
+	_, err = anonymous.Do("GET", "k")
+	assert.ErrorContains(t, err, "NOAUTH")
+}
+
+func TestAuthWithoutPassword(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	_, err := conn.Do("AUTH", "secret")
+	assert.ErrorContains(t, err, "no password is set")
+	reply, err := conn.Do("PING")
+	assert.NoError(t, err)
+	assert.Equal(t, "PONG", reply)
+}
+
+func TestRename(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// src 不存在
+	_, err := conn.Do("RENAME", "missing", "dst")
+	assert.ErrorContains(t, err, "no such key")
+	_, err = conn.Do("RENAMENX", "missing", "dst")
+	assert.ErrorContains(t, err, "no such key")
+
+	// 字符串键连同过期时间一起移动
+	_, err = conn.Do("SET", "s", "v", "EX", 100)
+	assert.NoError(t, err)
+	reply, err := conn.Do("RENAME", "s", "s2")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+	_, err = redis.String(conn.Do("GET", "s"))
+	assert.Equal(t, redis.ErrNil, err)
+	value, err := redis.String(conn.Do("GET", "s2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v", value)
+	ttl, err := redis.Int(conn.Do("TTL", "s2"))
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, 0)
+	_, ok := bc.Get([]byte(encodeKeyExpire("s")))
+	assert.False(t, ok)
+
+	// 哈希的所有字段移动到新键下，旧键的成员键全部删除
+	_, err = conn.Do("HSET", "h", "f1", "v1", "f2", "v2")
+	assert.NoError(t, err)
+	_, err = conn.Do("HSET", "hx", "f", "other")
+	assert.NoError(t, err)
+	_, err = conn.Do("RENAME", "h", "h2")
+	assert.NoError(t, err)
+	fields, err := redis.StringMap(conn.Do("HGETALL", "h2"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"f1": "v1", "f2": "v2"}, fields)
+	exists, err := redis.Int(conn.Do("EXISTS", "h"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, exists)
+	leftover := 0
+	assert.NoError(t, bc.ScanPrefix([]byte(HashFieldPrefx+"h:"), func(_, _ []byte) error {
+		leftover++
+		return nil
+	}))
+	assert.Equal(t, 0, leftover)
+	// 以旧键名开头的其他键不受影响
+	value, err = redis.String(conn.Do("HGET", "hx", "f"))
+	assert.NoError(t, err)
+	assert.Equal(t, "other", value)
+
+	// 列表和有序集合
+	_, err = conn.Do("RPUSH", "l", "a", "b", "c")
+	assert.NoError(t, err)
+	_, err = conn.Do("RENAME", "l", "l2")
+	assert.NoError(t, err)
+	items, err := redis.Strings(conn.Do("LRANGE", "l2", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, items)
+	_, err = conn.Do("RPUSH", "l2", "d")
+	assert.NoError(t, err)
+	length, err := redis.Int(conn.Do("LLEN", "l2"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, length)
+
+	_, err = conn.Do("ZADD", "z", 2, "b", 1, "a")
+	assert.NoError(t, err)
+	_, err = conn.Do("RENAME", "z", "z2")
+	assert.NoError(t, err)
+	members, err := redis.Strings(conn.Do("ZRANGE", "z2", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+	score, err := redis.Float64(conn.Do("ZSCORE", "z2", "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, score)
+	keyType, err := redis.String(conn.Do("TYPE", "z"))
+	assert.NoError(t, err)
+	assert.Equal(t, "none", keyType)
+
+	// RENAMENX 不覆盖已存在的键
+	n, err := redis.Int(conn.Do("RENAMENX", "s2", "h2"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	value, err = redis.String(conn.Do("GET", "s2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v", value)
+	n, err = redis.Int(conn.Do("RENAMENX", "s2", "s3"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// RENAME 覆盖不同类型的已存在键
+	_, err = conn.Do("RENAME", "s3", "h2")
+	assert.NoError(t, err)
+	keyType, err = redis.String(conn.Do("TYPE", "h2"))
+	assert.NoError(t, err)
+	assert.Equal(t, TypeString, keyType)
+	value, err = redis.String(conn.Do("GET", "h2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v", value)
+	_, ok = bc.Get([]byte(encodeHashKey("h2", "f1")))
+	assert.False(t, ok)
+
+	// 重命名为自身
+	reply, err = conn.Do("RENAME", "h2", "h2")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+	n, err = redis.Int(conn.Do("RENAMENX", "h2", "h2"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestStringRangeOperations(t *testing.T) {
+	bc, server, tmpDir := setupTest(t)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// APPEND 在键不存在时创建键
+	n, err := redis.Int(conn.Do("APPEND", "s", "Hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	keyType, err := redis.String(conn.Do("TYPE", "s"))
+	assert.NoError(t, err)
+	assert.Equal(t, TypeString, keyType)
+	n, err = redis.Int(conn.Do("APPEND", "s", " World"))
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+	value, err := redis.String(conn.Do("GET", "s"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello World", value)
+
+	n, err = redis.Int(conn.Do("STRLEN", "s"))
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+	n, err = redis.Int(conn.Do("STRLEN", "missing"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// GETRANGE 支持负下标，越界时截断
+	getRange := func(start, end int) string {
+		value, err := redis.String(conn.Do("GETRANGE", "s", start, end))
+		assert.NoError(t, err)
+		return value
+	}
+	assert.Equal(t, "Hello", getRange(0, 4))
+	assert.Equal(t, "World", getRange(-5, -1))
+	assert.Equal(t, "Hello World", getRange(0, -1))
+	assert.Equal(t, "World", getRange(6, 100))
+	assert.Equal(t, "", getRange(5, 3))
+	assert.Equal(t, "", getRange(20, 30))
+	value, err = redis.String(conn.Do("GETRANGE", "missing", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	// SETRANGE 覆盖写入，超出原长度时用零字节填充
+	n, err = redis.Int(conn.Do("SETRANGE", "s", 6, "Redis"))
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+	value, err = redis.String(conn.Do("GET", "s"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello Redis", value)
+
+	n, err = redis.Int(conn.Do("SETRANGE", "padded", 3, "abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, 6, n)
+	value, err = redis.String(conn.Do("GET", "padded"))
+	assert.NoError(t, err)
+	assert.Equal(t, "\x00\x00\x00abc", value)
+
+	n, err = redis.Int(conn.Do("SETRANGE", "s", 13, "!"))
+	assert.NoError(t, err)
+	assert.Equal(t, 14, n)
+	value, err = redis.String(conn.Do("GET", "s"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello Redis\x00\x00!", value)
+
+	// 空值不创建键
+	n, err = redis.Int(conn.Do("SETRANGE", "empty", 5, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	exists, err := redis.Int(conn.Do("EXISTS", "empty"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, exists)
+
+	_, err = conn.Do("SETRANGE", "s", -1, "x")
+	assert.ErrorContains(t, err, "offset is out of range")
+
+	// 其他类型返回 WRONGTYPE
+	_, err = conn.Do("RPUSH", "list", "a")
+	assert.NoError(t, err)
+	_, err = conn.Do("APPEND", "list", "x")
+	assert.ErrorContains(t, err, "WRONGTYPE")
+	_, err = conn.Do("STRLEN", "list")
+	assert.ErrorContains(t, err, "WRONGTYPE")
+	_, err = conn.Do("GETRANGE", "list", 0, -1)
+	assert.ErrorContains(t, err, "WRONGTYPE")
+	_, err = conn.Do("SETRANGE", "list", 0, "x")
+	assert.ErrorContains(t, err, "WRONGTYPE")
+}
+
+func TestMultiExecWriteFailure(t *testing.T) {
+	bc, server, tmpDir := setupTestServer(t, func(conf *config.Config) {
+		conf.MaxValueSize = 1024
+	}, nil)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// 超长的值使整个事务被丢弃，不会留下没有值的类型标记
+	_, err := conn.Do("MULTI")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "k1", "v1")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "big", strings.Repeat("x", 2048))
+	assert.NoError(t, err)
+	_, err = conn.Do("EXEC")
+	assert.ErrorContains(t, err, "EXECABORT")
+	assert.ErrorContains(t, err, "value 长度超过限制")
+	_, err = redis.String(conn.Do("GET", "k1"))
+	assert.Equal(t, redis.ErrNil, err)
+	keyType, err := redis.String(conn.Do("TYPE", "big"))
+	assert.NoError(t, err)
+	assert.Equal(t, "none", keyType)
+
+	// 事务中的 SET 覆盖其他类型的键时删除原有的成员
+	_, err = conn.Do("RPUSH", "list", "a", "b")
+	assert.NoError(t, err)
+	_, err = conn.Do("HSET", "hash", "f", "v")
+	assert.NoError(t, err)
+	_, err = conn.Do("MULTI")
+	assert.NoError(t, err)
+	_, err = conn.Do("SET", "list", "v1")
+	assert.NoError(t, err)
+	_, err = conn.Do("MSET", "hash", "v2")
+	assert.NoError(t, err)
+	_, err = conn.Do("EXEC")
+	assert.NoError(t, err)
+	_, ok := bc.Get([]byte(encodeListMeta("list")))
+	assert.False(t, ok)
+	var leftover []string
+	for _, p := range memberPrefixes {
+		for _, key := range []string{"list", "hash"} {
+			bc.ScanPrefix([]byte(p.prefix+key+":"), func(k []byte, _ []byte) error {
+				leftover = append(leftover, string(k))
+				return nil
+			})
+		}
+	}
+	assert.Empty(t, leftover)
+	value, err := redis.String(conn.Do("GET", "list"))
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", value)
+}
+
+func TestPipelineOversizedValue(t *testing.T) {
+	// 很小的文件大小使几乎每次写入都会轮转文件，值的上限为1MB
+	bc, server, tmpDir := setupTestServer(t, func(conf *config.Config) {
+		conf.MaxFileSize = 1024
+		conf.MaxValueSize = 1024 * 1024
+	}, nil)
+	defer teardownTest(t, bc, server, tmpDir)
+
+	conn := getRedisConn(t)
+	defer conn.Close()
+
+	// 流水线中的命令按顺序执行，超长的值只使该命令失败
+	const n = 100
+	value := func(i int) string {
+		return strings.Repeat(strconv.Itoa(i%10), 2048)
+	}
+	for i := 0; i < n; i++ {
+		if i == n/2 {
+			assert.NoError(t, conn.Send("SET", "big", strings.Repeat("x", 2*1024*1024)))
+		}
+		assert.NoError(t, conn.Send("SET", fmt.Sprintf("key%d", i), value(i)))
+	}
+	assert.NoError(t, conn.Send("APPEND", "key0", strings.Repeat("x", 1024*1024)))
+	assert.NoError(t, conn.Send("RPUSH", "list", "a", strings.Repeat("x", 2*1024*1024)))
+	assert.NoError(t, conn.Send("HSET", "hash", "f", strings.Repeat("x", 2*1024*1024)))
+	assert.NoError(t, conn.Send("GET", "key1"))
+	assert.NoError(t, conn.Flush())
+
+	for i := 0; i <= n; i++ {
+		reply, err := conn.Receive()
+		if i == n/2 {
+			assert.ErrorContains(t, err, "value 长度超过限制")
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, "OK", reply)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := conn.Receive()
+		assert.ErrorContains(t, err, "value 长度超过限制")
+	}
+	reply, err := redis.String(conn.Receive())
+	assert.NoError(t, err)
+	assert.Equal(t, value(1), reply)
+
+	// 失败的命令没有留下类型标记或部分写入的数据
+	for _, key := range []string{"big", "list", "hash"} {
+		keyType, err := redis.String(conn.Do("TYPE", key))
+		assert.NoError(t, err)
+		assert.Equal(t, "none", keyType, key)
+	}
+	for i := 0; i < n; i++ {
+		got, err := redis.String(conn.Do("GET", fmt.Sprintf("key%d", i)))
+		assert.NoError(t, err)
+		assert.Equal(t, value(i), got)
+	}
+
+	_, err = conn.Do("SETRANGE", "key0", 512*1024*1024, "x")
+	assert.ErrorContains(t, err, "exceeds maximum allowed size")
+	_, err = conn.Do("SETRANGE", "key0", 1024*1024, "x")
+	assert.ErrorContains(t, err, "value 长度超过限制")
+}
@@ -1,13 +1,16 @@
 package redis
 
 import (
-	"strings"
+	"math/rand"
 
 	"github.com/tidwall/redcon"
 )
 
 // SADD命令处理
 func (s *Server) handleSAdd(conn redcon.Conn, key []byte, members [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	keyStr := string(key)
 
 	// 检查键类型
@@ -43,6 +46,9 @@ func (s *Server) handleSAdd(conn redcon.Conn, key []byte, members [][]byte) {
 
 // SREM命令处理
 func (s *Server) handleSRem(conn redcon.Conn, key []byte, members [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	keyStr := string(key)
 
 	// 检查键类型
@@ -58,11 +64,8 @@ func (s *Server) handleSRem(conn redcon.Conn, key []byte, members [][]byte) {
 		memberStr := string(member)
 		memberKey := encodeSetKey(keyStr, memberStr)
 
-		// 检查成员是否存在
-		_, ok := s.bc.Get([]byte(memberKey))
-		if ok {
-			// 成员存在，删除
-			s.bc.Delete([]byte(memberKey))
+		// 仅统计实际存在的成员
+		if existed, err := s.bc.Delete([]byte(memberKey)); err == nil && existed {
 			removed++
 		}
 	}
@@ -87,18 +90,7 @@ func (s *Server) handleSMembers(conn redcon.Conn, key []byte) {
 	}
 
 	// 收集所有集合成员
-	prefix := SetMemberPrefx + keyStr + ":"
-	var members [][]byte
-
-	s.bc.Scan(func(k []byte, _ []byte) error {
-		kStr := string(k)
-		if strings.HasPrefix(kStr, prefix) {
-			// 提取成员名
-			member := kStr[len(prefix):]
-			members = append(members, []byte(member))
-		}
-		return nil
-	})
+	members := s.getSetMembers(keyStr)
 
 	// 写入数组响应
 	conn.WriteArray(len(members))
@@ -128,16 +120,152 @@ func (s *Server) handleSIsMember(conn redcon.Conn, key []byte, member []byte) {
 	}
 }
 
+// SCARD命令处理
+func (s *Server) handleSCard(conn redcon.Conn, key []byte) {
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeSet {
+		conn.WriteInt(0)
+		return
+	}
+
+	conn.WriteInt(s.getSetSize(keyStr))
+}
+
+// SPOP命令处理，随机移除并返回成员；指定 count 时返回数组
+func (s *Server) handleSPop(conn redcon.Conn, key []byte, count int, withCount bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeSet {
+		if withCount {
+			conn.WriteArray(0)
+		} else {
+			conn.WriteNull()
+		}
+		return
+	}
+
+	// 随机打乱后取前 count 个成员
+	members := s.getSetMembers(keyStr)
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if count > len(members) {
+		count = len(members)
+	}
+	popped := members[:count]
+	for _, member := range popped {
+		s.bc.Delete([]byte(encodeSetKey(keyStr, string(member))))
+	}
+
+	// 如果集合为空，删除类型标记
+	if count == len(members) {
+		s.bc.Delete([]byte(encodeKeyType(keyStr)))
+	}
+
+	if !withCount {
+		if len(popped) == 0 {
+			conn.WriteNull()
+			return
+		}
+		conn.WriteBulk(popped[0])
+		return
+	}
+	conn.WriteArray(len(popped))
+	for _, member := range popped {
+		conn.WriteBulk(member)
+	}
+}
+
+// 集合运算类型
+const (
+	setOpInter = iota // 交集
+	setOpUnion        // 并集
+	setOpDiff         // 差集
+)
+
+// SINTER/SUNION/SDIFF命令处理，不存在的键视为空集合
+func (s *Server) handleSetOp(conn redcon.Conn, keys [][]byte, op int) {
+	sets := make([][][]byte, len(keys))
+	for i, key := range keys {
+		keyStr := string(key)
+
+		// 检查键类型
+		keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+		if !ok {
+			continue
+		}
+		if string(keyTypeBytes) != TypeSet {
+			conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+			return
+		}
+		sets[i] = s.getSetMembers(keyStr)
+	}
+
+	var result [][]byte
+	switch op {
+	case setOpUnion:
+		seen := make(map[string]bool)
+		for _, members := range sets {
+			for _, member := range members {
+				if !seen[string(member)] {
+					seen[string(member)] = true
+					result = append(result, member)
+				}
+			}
+		}
+	case setOpInter, setOpDiff:
+		// 统计第一个集合的成员在其余集合中出现的次数
+		hits := make(map[string]int)
+		for _, members := range sets[1:] {
+			for _, member := range members {
+				hits[string(member)]++
+			}
+		}
+		others := len(sets) - 1
+		for _, member := range sets[0] {
+			n := hits[string(member)]
+			if (op == setOpInter && n == others) || (op == setOpDiff && n == 0) {
+				result = append(result, member)
+			}
+		}
+	}
+
+	conn.WriteArray(len(result))
+	for _, member := range result {
+		conn.WriteBulk(member)
+	}
+}
+
+// 获取集合成员的辅助函数
+func (s *Server) getSetMembers(key string) [][]byte {
+	prefix := SetMemberPrefx + key + ":"
+	var members [][]byte
+
+	s.bc.ScanPrefix([]byte(prefix), func(k []byte, _ []byte) error {
+		// 提取成员名
+		members = append(members, k[len(prefix):])
+		return nil
+	})
+
+	return members
+}
+
 // 获取集合大小的辅助函数
 func (s *Server) getSetSize(key string) int {
 	prefix := SetMemberPrefx + key + ":"
 	count := 0
 
-	// 扫描计数集合成员
-	s.bc.Scan(func(k []byte, _ []byte) error {
-		if strings.HasPrefix(string(k), prefix) {
-			count++
-		}
+	// 前缀扫描计数集合成员
+	s.bc.ScanPrefix([]byte(prefix), func(_ []byte, _ []byte) error {
+		count++
 		return nil
 	})
 
@@ -0,0 +1,363 @@
+package redis
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/aixiasang/bitcask"
+	"github.com/tidwall/redcon"
+)
+
+// txnState 连接上的事务状态，保存在 connState 中
+type txnState struct {
+	queued [][][]byte // 已入队的命令参数
+	failed bool       // 入队时出现错误，EXEC 时整个事务被丢弃
+}
+
+// txnReply 事务中单条命令的回复，在事务提交后统一写回客户端
+type txnReply func(conn redcon.Conn)
+
+// txnHandler 事务中可执行的命令，valid 校验参数个数（不含命令名），exec 执行命令并返回回复
+type txnHandler struct {
+	valid func(n int) bool
+	exec  func(tx *txnExec, args [][]byte) txnReply
+}
+
+// txnCommands MULTI 中支持的命令，写操作会在 EXEC 时通过一个 Batch 原子提交
+var txnCommands = map[string]txnHandler{
+	"GET":    {func(n int) bool { return n == 1 }, (*txnExec).get},
+	"SET":    {func(n int) bool { return n >= 2 }, (*txnExec).set},
+	"MSET":   {func(n int) bool { return n >= 2 && n%2 == 0 }, (*txnExec).mset},
+	"MGET":   {func(n int) bool { return n >= 1 }, (*txnExec).mget},
+	"DEL":    {func(n int) bool { return n >= 1 }, (*txnExec).del},
+	"INCR":   {func(n int) bool { return n == 1 }, (*txnExec).incr},
+	"DECR":   {func(n int) bool { return n == 1 }, (*txnExec).decr},
+	"INCRBY": {func(n int) bool { return n == 2 }, (*txnExec).incrBy},
+	"DECRBY": {func(n int) bool { return n == 2 }, (*txnExec).decrBy},
+}
+
+// getTxnState 返回连接当前的事务状态，未处于 MULTI 中时返回nil
+func getTxnState(conn redcon.Conn) *txnState {
+	return getConnState(conn).txn
+}
+
+// MULTI命令处理
+func (s *Server) handleMulti(conn redcon.Conn) {
+	if getTxnState(conn) != nil {
+		conn.WriteError("ERR MULTI calls can not be nested")
+		return
+	}
+	getConnState(conn).txn = &txnState{}
+	conn.WriteString("OK")
+}
+
+// DISCARD命令处理
+func (s *Server) handleDiscard(conn redcon.Conn) {
+	if getTxnState(conn) == nil {
+		conn.WriteError("ERR DISCARD without MULTI")
+		return
+	}
+	getConnState(conn).txn = nil
+	conn.WriteString("OK")
+}
+
+// queueCommand 将 MULTI 之后的命令入队，不支持的命令或参数错误会使整个事务在 EXEC 时被丢弃
+func (s *Server) queueCommand(conn redcon.Conn, state *txnState, command string, args [][]byte) {
+	handler, ok := txnCommands[command]
+	if !ok {
+		state.failed = true
+		conn.WriteError(fmt.Sprintf("ERR 命令 '%s' 不支持在事务中执行", strings.ToLower(command)))
+		return
+	}
+	if !handler.valid(len(args) - 1) {
+		state.failed = true
+		conn.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(command)))
+		return
+	}
+
+	// redcon 会复用读缓冲区，入队时需要复制参数
+	queued := make([][]byte, len(args))
+	queued[0] = []byte(command)
+	for i := 1; i < len(args); i++ {
+		queued[i] = append([]byte(nil), args[i]...)
+	}
+	state.queued = append(state.queued, queued)
+	conn.WriteString("QUEUED")
+}
+
+// EXEC命令处理
+func (s *Server) handleExec(conn redcon.Conn) {
+	state := getTxnState(conn)
+	if state == nil {
+		conn.WriteError("ERR EXEC without MULTI")
+		return
+	}
+	getConnState(conn).txn = nil
+	if state.failed {
+		conn.WriteError("EXECABORT Transaction discarded because of previous errors.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &txnExec{s: s, batch: bitcask.NewBatch(s.bc), pending: make(map[string][]byte)}
+	replies := make([]txnReply, 0, len(state.queued))
+	for _, args := range state.queued {
+		handler := txnCommands[string(args[0])]
+		replies = append(replies, handler.exec(tx, args[1:]))
+	}
+
+	// 任何一条命令暂存写入失败时（例如 value 超过 MaxValueSize）丢弃整个事务，
+	// 否则批处理中只有类型标记而没有对应的值
+	if tx.err != nil {
+		conn.WriteError(fmt.Sprintf("EXECABORT 事务提交失败: %v", tx.err))
+		return
+	}
+	// 所有写操作在同一个批处理中提交，提交失败时不会有任何修改生效
+	if err := tx.batch.Commit(); err != nil {
+		conn.WriteError(fmt.Sprintf("EXECABORT 事务提交失败: %v", err))
+		return
+	}
+
+	conn.WriteArray(len(replies))
+	for _, reply := range replies {
+		reply(conn)
+	}
+}
+
+// txnExec 执行事务中的命令，写操作先记录到批处理和 pending 中，
+// 之后的读操作优先读取 pending，从而能看到同一事务中之前命令的结果
+type txnExec struct {
+	s       *Server
+	batch   *bitcask.Batch
+	pending map[string][]byte // 事务中写入的值，nil 表示已删除
+	err     error             // 第一次暂存写入失败的错误，EXEC 时丢弃整个事务
+}
+
+// lookup 读取键的当前值
+func (tx *txnExec) lookup(key string) ([]byte, bool) {
+	if value, ok := tx.pending[key]; ok {
+		return value, value != nil
+	}
+	return tx.s.bc.Get([]byte(key))
+}
+
+// put 在事务中写入键值，失败时记录到 tx.err
+func (tx *txnExec) put(key string, value []byte) {
+	if err := tx.batch.Put([]byte(key), value); err != nil {
+		if tx.err == nil {
+			tx.err = err
+		}
+		return
+	}
+	tx.pending[key] = value
+}
+
+// remove 在事务中删除键，返回键在删除前是否存在
+func (tx *txnExec) remove(key string) bool {
+	if _, ok := tx.lookup(key); !ok {
+		return false
+	}
+	if err := tx.batch.Delete([]byte(key)); err != nil {
+		if tx.err == nil {
+			tx.err = err
+		}
+		return false
+	}
+	tx.pending[key] = nil
+	return true
+}
+
+// stringValue 读取字符串键的值，键已过期时视为不存在，键类型不是字符串时返回错误回复
+func (tx *txnExec) stringValue(key string) ([]byte, bool, txnReply) {
+	if _, ok := tx.pending[key]; !ok {
+		tx.s.checkAndRemoveExpired(key)
+	}
+	if keyType, ok := tx.lookup(encodeKeyType(key)); ok && string(keyType) != TypeString {
+		return nil, false, errorReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	value, ok := tx.lookup(key)
+	return value, ok, nil
+}
+
+// clearMembers 与 prepareOverwrite 相同，字符串值覆盖其他类型的键时在事务中删除原有的成员键，
+// 列表同时删除元数据。事务中只支持字符串命令，成员键不会在同一个事务中写入，直接从数据库读取
+func (tx *txnExec) clearMembers(key string) {
+	keyType, ok := tx.lookup(encodeKeyType(key))
+	if !ok || string(keyType) == TypeString {
+		return
+	}
+	for _, m := range memberPrefixes {
+		if m.keyType != string(keyType) {
+			continue
+		}
+		var members []string
+		if err := tx.s.bc.ScanPrefix([]byte(m.prefix+key+":"), func(k []byte, _ []byte) error {
+			members = append(members, string(k))
+			return nil
+		}); err != nil {
+			if tx.err == nil {
+				tx.err = err
+			}
+			return
+		}
+		for _, member := range members {
+			tx.remove(member)
+		}
+	}
+	if string(keyType) == TypeList {
+		tx.remove(encodeListMeta(key))
+	}
+}
+
+// setString 写入字符串键，覆盖其他类型的键时删除原有的成员，expireAt 为0且不保留过期时间时清除原有的过期时间
+func (tx *txnExec) setString(key string, value []byte, expireAt int64, keepTTL bool) {
+	tx.clearMembers(key)
+	tx.put(encodeKeyType(key), []byte(TypeString))
+	tx.put(key, value)
+	if expireAt > 0 {
+		tx.put(encodeKeyExpire(key), formatExpireAt(expireAt))
+	} else if !keepTTL {
+		tx.remove(encodeKeyExpire(key))
+	}
+}
+
+func errorReply(msg string) txnReply {
+	return func(conn redcon.Conn) { conn.WriteError(msg) }
+}
+
+func stringReply(msg string) txnReply {
+	return func(conn redcon.Conn) { conn.WriteString(msg) }
+}
+
+func (tx *txnExec) get(args [][]byte) txnReply {
+	value, ok, errReply := tx.stringValue(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		return func(conn redcon.Conn) { conn.WriteNull() }
+	}
+	return func(conn redcon.Conn) { conn.WriteBulk(value) }
+}
+
+func (tx *txnExec) set(args [][]byte) txnReply {
+	key := string(args[0])
+	opts, errMsg := parseSetOptions(args[2:])
+	if errMsg != "" {
+		return errorReply(errMsg)
+	}
+	if opts.nx || opts.xx {
+		exists := false
+		if _, ok := tx.pending[key]; !ok {
+			tx.s.checkAndRemoveExpired(key)
+		}
+		if _, ok := tx.lookup(encodeKeyType(key)); ok {
+			exists = true
+		} else if _, ok := tx.lookup(key); ok {
+			exists = true
+		}
+		if (opts.nx && exists) || (opts.xx && !exists) {
+			return func(conn redcon.Conn) { conn.WriteNull() }
+		}
+	}
+	tx.setString(key, args[1], opts.expireAt, opts.keepTTL)
+	return stringReply("OK")
+}
+
+func (tx *txnExec) mset(args [][]byte) txnReply {
+	for i := 0; i < len(args); i += 2 {
+		tx.setString(string(args[i]), args[i+1], 0, false)
+	}
+	return stringReply("OK")
+}
+
+func (tx *txnExec) mget(args [][]byte) txnReply {
+	values := make([][]byte, len(args))
+	for i, key := range args {
+		// 与 MGET 一致：类型不匹配的键返回nil
+		if value, ok, errReply := tx.stringValue(string(key)); errReply == nil && ok {
+			values[i] = value
+		}
+	}
+	return func(conn redcon.Conn) {
+		conn.WriteArray(len(values))
+		for _, value := range values {
+			if value == nil {
+				conn.WriteNull()
+			} else {
+				conn.WriteBulk(value)
+			}
+		}
+	}
+}
+
+// del 事务中只支持删除字符串键，复杂类型需要扫描大量内部键，不适合放入批处理
+func (tx *txnExec) del(args [][]byte) txnReply {
+	for _, key := range args {
+		if keyType, ok := tx.lookup(encodeKeyType(string(key))); ok && string(keyType) != TypeString {
+			return errorReply("ERR 事务中的DEL只支持字符串类型的键")
+		}
+	}
+
+	var deleted int64
+	for _, key := range args {
+		keyStr := string(key)
+		if _, ok := tx.pending[keyStr]; !ok && tx.s.checkAndRemoveExpired(keyStr) {
+			continue
+		}
+		if tx.remove(keyStr) {
+			deleted++
+		}
+		tx.remove(encodeKeyType(keyStr))
+		tx.remove(encodeKeyExpire(keyStr))
+	}
+	return func(conn redcon.Conn) { conn.WriteInt64(deleted) }
+}
+
+func (tx *txnExec) incr(args [][]byte) txnReply { return tx.addBy(string(args[0]), 1) }
+
+func (tx *txnExec) decr(args [][]byte) txnReply { return tx.addBy(string(args[0]), -1) }
+
+func (tx *txnExec) incrBy(args [][]byte) txnReply {
+	delta, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return errorReply("ERR value is not an integer or out of range")
+	}
+	return tx.addBy(string(args[0]), delta)
+}
+
+func (tx *txnExec) decrBy(args [][]byte) txnReply {
+	delta, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return errorReply("ERR value is not an integer or out of range")
+	}
+	if delta == math.MinInt64 {
+		return errorReply("ERR decrement would overflow")
+	}
+	return tx.addBy(string(args[0]), -delta)
+}
+
+func (tx *txnExec) addBy(key string, delta int64) txnReply {
+	value, ok, errReply := tx.stringValue(key)
+	if errReply != nil {
+		return errReply
+	}
+	var current int64
+	if ok {
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return errorReply("ERR value is not an integer or out of range")
+		}
+		current = n
+	}
+	current, ok = addInt64(current, delta)
+	if !ok {
+		return errorReply("ERR increment or decrement would overflow")
+	}
+	tx.setString(key, []byte(strconv.FormatInt(current, 10)), 0, true)
+	return func(conn redcon.Conn) { conn.WriteInt64(current) }
+}
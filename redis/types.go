@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"math"
 	"strconv"
 	"time"
 )
@@ -16,13 +17,14 @@ const (
 
 // 为不同数据类型定义前缀，用于在Bitcask中存储
 const (
-	KeyTypePrefx    = "_type_" // 存储键类型
-	KeyExpirePrefx  = "_ttl_"  // 存储键过期时间
-	ListItemPrefx   = "_list_" // 列表项
-	HashFieldPrefx  = "_hash_" // 哈希字段
-	SetMemberPrefx  = "_set_"  // 集合成员
-	ZSetScorePrefx  = "_zset_" // 有序集合分数
-	ZSetMemberPrefx = "_zsm_"  // 有序集合成员
+	KeyTypePrefx    = "_type_"  // 存储键类型
+	KeyExpirePrefx  = "_ttl_"   // 存储键过期时间
+	ListItemPrefx   = "_list_"  // 列表项
+	ListMetaPrefx   = "_lmeta_" // 列表元数据（头尾索引）
+	HashFieldPrefx  = "_hash_"  // 哈希字段
+	SetMemberPrefx  = "_set_"   // 集合成员
+	ZSetScorePrefx  = "_zset_"  // 有序集合分数
+	ZSetMemberPrefx = "_zsm_"   // 有序集合成员
 )
 
 // encodeListKey 编码列表键名
@@ -30,6 +32,11 @@ func encodeListKey(key string, index int) string {
 	return ListItemPrefx + key + ":" + strconv.Itoa(index)
 }
 
+// encodeListMeta 编码列表元数据键名
+func encodeListMeta(key string) string {
+	return ListMetaPrefx + key
+}
+
 // encodeHashKey 编码哈希键名
 func encodeHashKey(key string, field string) string {
 	return HashFieldPrefx + key + ":" + field
@@ -71,20 +78,54 @@ type ZSetPair struct {
 // ZSetPairs 有序集合的成员-分数对数组，用于排序
 type ZSetPairs []ZSetPair
 
-func (p ZSetPairs) Len() int           { return len(p) }
-func (p ZSetPairs) Less(i, j int) bool { return p[i].Score < p[j].Score }
-func (p ZSetPairs) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p ZSetPairs) Len() int { return len(p) }
+func (p ZSetPairs) Less(i, j int) bool {
+	if p[i].Score != p[j].Score {
+		return p[i].Score < p[j].Score
+	}
+	return p[i].Member < p[j].Member
+}
+func (p ZSetPairs) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
 
-// isExpired 检查键是否过期
-func isExpired(ttlBytes []byte) bool {
+// addInt64 带溢出检查的整数加法
+func addInt64(current, delta int64) (int64, bool) {
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, false
+	}
+	return current + delta, true
+}
+
+// legacySecondsLimit 旧版本以秒存储过期时间戳，小于该值的时间戳按秒解析
+// （以毫秒计它对应1973年，以秒计对应5138年，两者不会混淆）
+const legacySecondsLimit = 100000000000
+
+// parseExpireAt 解析过期时间戳，返回毫秒
+func parseExpireAt(ttlBytes []byte) (int64, bool) {
 	if len(ttlBytes) == 0 {
-		return false
+		return 0, false
 	}
 
 	expireAt, err := strconv.ParseInt(string(ttlBytes), 10, 64)
 	if err != nil {
+		return 0, false
+	}
+	if expireAt < legacySecondsLimit {
+		expireAt *= 1000
+	}
+	return expireAt, true
+}
+
+// formatExpireAt 格式化毫秒过期时间戳
+func formatExpireAt(expireAt int64) []byte {
+	return []byte(strconv.FormatInt(expireAt, 10))
+}
+
+// isExpired 检查键是否过期
+func isExpired(ttlBytes []byte) bool {
+	expireAt, ok := parseExpireAt(ttlBytes)
+	if !ok {
 		return false
 	}
 
-	return time.Now().Unix() > expireAt
+	return time.Now().UnixMilli() > expireAt
 }
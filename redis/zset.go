@@ -2,6 +2,7 @@ package redis
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strconv"
 	"strings"
@@ -11,6 +12,9 @@ import (
 
 // ZADD命令处理
 func (s *Server) handleZAdd(conn redcon.Conn, key []byte, args [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	keyStr := string(key)
 
 	// 检查键类型
@@ -32,37 +36,24 @@ func (s *Server) handleZAdd(conn redcon.Conn, key []byte, args [][]byte) {
 		return
 	}
 
-	// 添加分数-成员对
-	added := 0
+	// 先解析全部分数，避免部分写入
+	scores := make([]float64, 0, len(args)/2)
 	for i := 0; i < len(args); i += 2 {
 		scoreStr := string(args[i])
-		member := string(args[i+1])
-
-		// 解析分数
 		score, err := strconv.ParseFloat(scoreStr, 64)
 		if err != nil {
 			conn.WriteError(fmt.Sprintf("ERR 无效的分数值'%s'", scoreStr))
 			return
 		}
+		scores = append(scores, score)
+	}
 
-		// 检查成员是否已存在
-		oldScoreBytes, ok := s.bc.Get([]byte(encodeZSetScoreKey(keyStr, member)))
-		if ok {
-			// 成员已存在，更新分数
-			oldScore, _ := strconv.ParseFloat(string(oldScoreBytes), 64)
-
-			// 删除旧的成员与分数的关联
-			s.bc.Delete([]byte(encodeZSetMemberKey(keyStr, oldScore)))
-		} else {
-			// 新成员
+	// 添加分数-成员对
+	added := 0
+	for i := 0; i < len(args); i += 2 {
+		if s.setZSetScore(keyStr, string(args[i+1]), scores[i/2]) {
 			added++
 		}
-
-		// 设置成员的分数
-		s.bc.Put([]byte(encodeZSetScoreKey(keyStr, member)), []byte(strconv.FormatFloat(score, 'f', 17, 64)))
-
-		// 设置分数对应的成员
-		s.bc.Put([]byte(encodeZSetMemberKey(keyStr, score)), []byte(member))
 	}
 
 	conn.WriteInt(added)
@@ -195,28 +186,273 @@ func (s *Server) handleZScore(conn redcon.Conn, key []byte, member []byte) {
 	conn.WriteBulkString(string(scoreBytes))
 }
 
+// ZREM命令处理
+func (s *Server) handleZRem(conn redcon.Conn, key []byte, members [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeZSet {
+		conn.WriteInt(0)
+		return
+	}
+
+	removed := 0
+	for _, member := range members {
+		if s.removeZSetMember(keyStr, string(member)) {
+			removed++
+		}
+	}
+
+	// 如果有序集合为空，删除类型标记
+	if s.getZSetSize(keyStr) == 0 {
+		s.bc.Delete([]byte(encodeKeyType(keyStr)))
+	}
+
+	conn.WriteInt(removed)
+}
+
+// ZCARD命令处理
+func (s *Server) handleZCard(conn redcon.Conn, key []byte) {
+	keyStr := string(key)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeZSet {
+		conn.WriteInt(0)
+		return
+	}
+
+	conn.WriteInt(s.getZSetSize(keyStr))
+}
+
+// ZINCRBY命令处理，成员不存在时分数视为0
+func (s *Server) handleZIncrBy(conn redcon.Conn, key []byte, delta float64, member []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyStr := string(key)
+	memberStr := string(member)
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if ok {
+		if string(keyTypeBytes) != TypeZSet {
+			conn.WriteError("WRONGTYPE Operation against a key holding the wrong kind of value")
+			return
+		}
+	} else {
+		// 键不存在，设置类型为有序集合
+		s.bc.Put([]byte(encodeKeyType(keyStr)), []byte(TypeZSet))
+	}
+
+	score := delta
+	if oldScoreBytes, ok := s.bc.Get([]byte(encodeZSetScoreKey(keyStr, memberStr))); ok {
+		oldScore, _ := strconv.ParseFloat(string(oldScoreBytes), 64)
+		score += oldScore
+	}
+	s.setZSetScore(keyStr, memberStr, score)
+
+	conn.WriteBulkString(strconv.FormatFloat(score, 'f', 17, 64))
+}
+
+// ZRANGEBYSCORE命令处理
+// ZRANGEBYSCORE key min max [WITHSCORES]，min/max 支持 ( 表示开区间以及 -inf/+inf
+func (s *Server) handleZRangeByScore(conn redcon.Conn, args [][]byte) {
+	keyStr := string(args[1])
+
+	min, minExclusive, err := parseScoreBound(args[2])
+	if err != nil {
+		conn.WriteError("ERR min or max is not a float")
+		return
+	}
+	max, maxExclusive, err := parseScoreBound(args[3])
+	if err != nil {
+		conn.WriteError("ERR min or max is not a float")
+		return
+	}
+
+	// 检查是否需要带分数（WITHSCORES选项）
+	withScores := false
+	for _, arg := range args[4:] {
+		if strings.ToUpper(string(arg)) != "WITHSCORES" {
+			conn.WriteError("ERR syntax error")
+			return
+		}
+		withScores = true
+	}
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeZSet {
+		conn.WriteArray(0)
+		return
+	}
+
+	// 筛选分数范围内的成员
+	var matched ZSetPairs
+	for _, pair := range s.getSortedZSetMembers(keyStr) {
+		if pair.Score < min || (minExclusive && pair.Score == min) {
+			continue
+		}
+		if pair.Score > max || (maxExclusive && pair.Score == max) {
+			break
+		}
+		matched = append(matched, pair)
+	}
+
+	writeZSetPairs(conn, matched, withScores)
+}
+
+// ZREVRANGE命令处理，按分数从高到低返回，分数相同时按成员逆序
+func (s *Server) handleZRevRange(conn redcon.Conn, args [][]byte) {
+	keyStr := string(args[1])
+
+	// 解析开始和结束索引
+	start, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 无效的起始索引'%s'", string(args[2])))
+		return
+	}
+	stop, err := strconv.Atoi(string(args[3]))
+	if err != nil {
+		conn.WriteError(fmt.Sprintf("ERR 无效的结束索引'%s'", string(args[3])))
+		return
+	}
+
+	// 检查是否需要带分数（WITHSCORES选项）
+	withScores := len(args) > 4 && strings.ToUpper(string(args[4])) == "WITHSCORES"
+
+	// 检查键类型
+	keyTypeBytes, ok := s.bc.Get([]byte(encodeKeyType(keyStr)))
+	if !ok || string(keyTypeBytes) != TypeZSet {
+		conn.WriteArray(0)
+		return
+	}
+
+	// 反转升序结果
+	pairs := s.getSortedZSetMembers(keyStr)
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+
+	// 处理负索引（从尾部计数）
+	length := len(pairs)
+	if start < 0 {
+		start = length + start
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		conn.WriteArray(0)
+		return
+	}
+
+	writeZSetPairs(conn, pairs[start:stop+1], withScores)
+}
+
+// parseScoreBound 解析分数范围边界，返回分数以及是否为开区间
+func parseScoreBound(arg []byte) (float64, bool, error) {
+	str := string(arg)
+	exclusive := false
+	if strings.HasPrefix(str, "(") {
+		exclusive = true
+		str = str[1:]
+	}
+	switch strings.ToLower(str) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	score, err := strconv.ParseFloat(str, 64)
+	return score, exclusive, err
+}
+
+// writeZSetPairs 写入成员数组，withScores 时每个成员后跟分数
+func writeZSetPairs(conn redcon.Conn, pairs ZSetPairs, withScores bool) {
+	resultLen := len(pairs)
+	if withScores {
+		resultLen *= 2
+	}
+	conn.WriteArray(resultLen)
+	for _, pair := range pairs {
+		conn.WriteBulk([]byte(pair.Member))
+		if withScores {
+			conn.WriteBulkString(strconv.FormatFloat(pair.Score, 'f', 17, 64))
+		}
+	}
+}
+
+// setZSetScore 设置成员的分数，返回是否为新成员
+func (s *Server) setZSetScore(key, member string, score float64) bool {
+	existed := s.removeZSetMember(key, member)
+
+	// 设置成员的分数
+	s.bc.Put([]byte(encodeZSetScoreKey(key, member)), []byte(strconv.FormatFloat(score, 'f', 17, 64)))
+
+	// 设置分数对应的成员
+	s.bc.Put([]byte(encodeZSetMemberKey(key, score)), []byte(member))
+	return !existed
+}
+
+// removeZSetMember 删除成员的分数键和成员键，返回成员是否存在
+func (s *Server) removeZSetMember(key, member string) bool {
+	scoreKey := []byte(encodeZSetScoreKey(key, member))
+	oldScoreBytes, ok := s.bc.Get(scoreKey)
+	if !ok {
+		return false
+	}
+	oldScore, _ := strconv.ParseFloat(string(oldScoreBytes), 64)
+
+	// 分数相同的成员共用一个成员键，只删除仍指向该成员的关联
+	memberKey := []byte(encodeZSetMemberKey(key, oldScore))
+	if current, ok := s.bc.Get(memberKey); ok && string(current) == member {
+		s.bc.Delete(memberKey)
+	}
+	s.bc.Delete(scoreKey)
+	return true
+}
+
+// 获取有序集合成员数的辅助函数
+func (s *Server) getZSetSize(key string) int {
+	count := 0
+	s.bc.ScanPrefix([]byte(ZSetScorePrefx+key+":"), func(_ []byte, _ []byte) error {
+		count++
+		return nil
+	})
+	return count
+}
+
 // 获取有序集合的所有成员及分数（已排序）
 func (s *Server) getSortedZSetMembers(key string) ZSetPairs {
 	var pairs ZSetPairs
 	prefix := ZSetScorePrefx + key + ":"
 
-	// 收集所有成员及其分数
-	s.bc.Scan(func(k []byte, v []byte) error {
-		kStr := string(k)
-		if strings.HasPrefix(kStr, prefix) {
-			// 提取成员名和分数
-			member := kStr[len(prefix):]
-			score, _ := strconv.ParseFloat(string(v), 64)
-
-			pairs = append(pairs, ZSetPair{
-				Member: member,
-				Score:  score,
-			})
-		}
+	// 前缀扫描收集所有成员及其分数，只访问该有序集合的键
+	s.bc.ScanPrefix([]byte(prefix), func(k []byte, v []byte) error {
+		// 提取成员名和分数
+		member := string(k[len(prefix):])
+		score, _ := strconv.ParseFloat(string(v), 64)
+
+		pairs = append(pairs, ZSetPair{
+			Member: member,
+			Score:  score,
+		})
 		return nil
 	})
 
-	// 按分数排序
+	// 按分数排序，分数相同时按成员排序
 	sort.Sort(pairs)
 
 	return pairs
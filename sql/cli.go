@@ -1,7 +1,9 @@
 package sql
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/aixiasang/bitcask"
@@ -10,16 +12,38 @@ import (
 
 // RegisterCommand registers the SQL command with the root command
 func RegisterCommand(rootCmd *cobra.Command, bcCreator func() (*bitcask.Bitcask, error)) {
+	var file string
 	var sqlCmd = &cobra.Command{
-		Use:   "sql [SQL statement]",
+		Use:   "sql [SQL statements]",
 		Short: "Execute SQL statements on the bitcask database",
-		Long: `Execute SQL statements on the bitcask database.
+		Long: `Execute SQL statements on the bitcask database. Statements are separated
+by semicolons and run in order, stopping at the first error; --file runs a
+script such as a schema followed by its data.
 Supported statements:
-  - CREATE TABLE tablename (column1 type1, column2 type2 PRIMARY KEY, ...)
-  - INSERT INTO tablename (column1, column2, ...) VALUES (value1, value2, ...), ...
-  - SELECT column1, column2, ... FROM tablename [WHERE condition]
-  - SELECT * FROM tablename [WHERE condition]`,
-		Args: cobra.MinimumNArgs(1),
+  - CREATE TABLE tablename (column1 type1, column2 type2 PRIMARY KEY, column3 type3 NOT NULL UNIQUE, ...)
+    INTEGER columns only accept integer values; UNIQUE and NOT NULL are checked on INSERT and UPDATE
+  - CREATE INDEX indexname ON tablename (column)
+    WHERE column = value on an indexed column reads only the matching rows instead of scanning the table
+  - ALTER TABLE tablename ADD [COLUMN] column type [UNIQUE]
+    existing rows read the new column as empty
+  - ALTER TABLE tablename DROP [COLUMN] column
+    the column and its index disappear from the schema, stored rows are not rewritten
+  - INSERT INTO tablename [(column1, column2, ...)] VALUES (value1, value2, ...), ...
+  - SELECT [DISTINCT] column1, column2, ... FROM tablename [WHERE condition]
+  - SELECT * FROM tablename [WHERE condition] [ORDER BY column [ASC|DESC], ...] [LIMIT n] [OFFSET n]
+  - SELECT COUNT(*), COUNT(column), SUM(column), AVG(column), MIN(column), MAX(column) FROM tablename [WHERE condition]
+  - UPDATE tablename SET column1 = value1, column2 = column2 + n, column3 = column3 - n, ... [WHERE condition]
+    column + n and column - n are computed from each row's current numeric value
+  - WHERE supports =, != (or <>), <, >, <=, >=, IN (v1, v2, ...) and LIKE ('%' any run, '_' one character, case-insensitive),
+    combined with AND, OR and parentheses
+INSERT, DELETE and DROP TABLE commit atomically as one batch, so a statement
+may touch at most BatchSize keys (rows plus index entries)`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if file == "" && len(args) == 0 {
+				return errors.New("requires a SQL statement or --file")
+			}
+			return nil
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			// Create the bitcask instance
 			bc, err := bcCreator()
@@ -29,57 +53,39 @@ Supported statements:
 			}
 			defer bc.Close()
 
-			// Join all arguments into a single SQL statement
-			sqlStatement := strings.Join(args, " ")
+			// Join all arguments into a single script, or read it from --file
+			script := strings.Join(args, " ")
+			if file != "" {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					fmt.Printf("读取 SQL 文件失败: %v\n", err)
+					return
+				}
+				script = string(data)
+			}
 
-			// Parse the SQL statement
-			node, err := Parse(sqlStatement)
+			// Parse every statement before running any of them
+			nodes, err := ParseAll(script)
 			if err != nil {
 				fmt.Printf("SQL 解析错误: %v\n", err)
 				return
 			}
 
-			// Execute the SQL statement
+			// Execute the statements in order
 			executor := NewExecutor(bc)
-			result, err := executor.Execute(node)
+			results, err := executor.ExecuteAll(nodes)
+			for _, result := range results {
+				printResult(result)
+			}
 			if err != nil {
 				fmt.Printf("SQL 执行错误: %v\n", err)
-				return
 			}
-
-			// If this is a query with results, print them
-			if len(result.Columns) > 0 && len(result.Rows) > 0 {
-				// Print column headers
-				fmt.Print("| ")
-				for _, col := range result.Columns {
-					fmt.Printf("%s\t", col)
-				}
-				fmt.Println()
-
-				// Print separator
-				fmt.Print("+-")
-				for _, col := range result.Columns {
-					for i := 0; i < len(col); i++ {
-						fmt.Print("-")
-					}
-					fmt.Print("--\t")
-				}
-				fmt.Println()
-
-				// Print rows
-				for _, row := range result.Rows {
-					fmt.Print("| ")
-					for _, col := range result.Columns {
-						fmt.Printf("%s\t", row[col])
-					}
-					fmt.Println()
-				}
-				fmt.Printf("结果集: %d 行\n", len(result.Rows))
-			} else {
-				fmt.Println("执行成功")
+			if executor.InTransaction() {
+				fmt.Println("未提交的事务已回滚")
 			}
 		},
 	}
+	sqlCmd.Flags().StringVarP(&file, "file", "f", "", "read the SQL statements from a script file instead of the arguments")
 
 	// Add the SQL shell command
 	var sqlShellCmd = &cobra.Command{
@@ -87,6 +93,10 @@ Supported statements:
 		Short: "Start an interactive SQL shell",
 		Long: `Start an interactive SQL shell to execute SQL statements.
 Enter SQL statements at the prompt and press Enter to execute.
+BEGIN starts a transaction: the following INSERT, UPDATE and DELETE statements
+are only visible in this shell until COMMIT writes them atomically, and
+ROLLBACK discards them. A transaction may change at most BatchSize keys, and
+schema changes are not allowed inside it.
 Type 'exit' or 'quit' to exit the shell.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			// Create the bitcask instance
@@ -118,53 +128,27 @@ Type 'exit' or 'quit' to exit the shell.`,
 					continue
 				}
 				if sqlStatement == "exit" || sqlStatement == "quit" {
+					if executor.InTransaction() {
+						executor.Execute(TransactionNode{Action: "ROLLBACK"})
+						fmt.Println("未提交的事务已回滚")
+					}
 					fmt.Println("再见!")
 					break
 				}
 
-				// Parse and execute the SQL statement
-				node, err := Parse(sqlStatement)
+				// Parse and execute the SQL statements
+				nodes, err := ParseAll(sqlStatement)
 				if err != nil {
 					fmt.Printf("SQL 解析错误: %v\n", err)
 					continue
 				}
 
-				result, err := executor.Execute(node)
+				results, err := executor.ExecuteAll(nodes)
+				for _, result := range results {
+					printResult(result)
+				}
 				if err != nil {
 					fmt.Printf("SQL 执行错误: %v\n", err)
-					continue
-				}
-
-				// If this is a query with results, print them
-				if len(result.Columns) > 0 && len(result.Rows) > 0 {
-					// Print column headers
-					fmt.Print("| ")
-					for _, col := range result.Columns {
-						fmt.Printf("%s\t", col)
-					}
-					fmt.Println()
-
-					// Print separator
-					fmt.Print("+-")
-					for _, col := range result.Columns {
-						for i := 0; i < len(col); i++ {
-							fmt.Print("-")
-						}
-						fmt.Print("--\t")
-					}
-					fmt.Println()
-
-					// Print rows
-					for _, row := range result.Rows {
-						fmt.Print("| ")
-						for _, col := range result.Columns {
-							fmt.Printf("%s\t", row[col])
-						}
-						fmt.Println()
-					}
-					fmt.Printf("结果集: %d 行\n", len(result.Rows))
-				} else {
-					fmt.Println("执行成功")
 				}
 			}
 		},
@@ -175,6 +159,42 @@ Type 'exit' or 'quit' to exit the shell.`,
 	rootCmd.AddCommand(sqlShellCmd)
 }
 
+// printResult prints a query's rows as a table, or a success message for
+// statements that return none
+func printResult(result *QueryResult) {
+	if len(result.Columns) == 0 || len(result.Rows) == 0 {
+		fmt.Println("执行成功")
+		return
+	}
+
+	// Print column headers
+	fmt.Print("| ")
+	for _, col := range result.Columns {
+		fmt.Printf("%s\t", col)
+	}
+	fmt.Println()
+
+	// Print separator
+	fmt.Print("+-")
+	for _, col := range result.Columns {
+		for i := 0; i < len(col); i++ {
+			fmt.Print("-")
+		}
+		fmt.Print("--\t")
+	}
+	fmt.Println()
+
+	// Print rows
+	for _, row := range result.Rows {
+		fmt.Print("| ")
+		for _, col := range result.Columns {
+			fmt.Printf("%s\t", row[col])
+		}
+		fmt.Println()
+	}
+	fmt.Printf("结果集: %d 行\n", len(result.Rows))
+}
+
 // SQLScanner reads SQL statements from standard input
 type SQLScanner struct {
 	buffer string
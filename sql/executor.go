@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -12,7 +14,9 @@ import (
 
 // Executor handles the execution of SQL statements
 type Executor struct {
-	db *bitcask.Bitcask
+	db          *bitcask.Bitcask
+	txn         *bitcask.Batch // open transaction, nil outside BEGIN ... COMMIT
+	rowsScanned int            // number of keys visited by table scans
 }
 
 // NewExecutor creates a new executor with the given bitcask instance
@@ -24,6 +28,13 @@ func NewExecutor(db *bitcask.Bitcask) *Executor {
 type TableSchema struct {
 	Name    string      `json:"name"`
 	Columns []ColumnDef `json:"columns"`
+	Indexes []IndexDef  `json:"indexes,omitempty"`
+}
+
+// IndexDef is a secondary index on a single column
+type IndexDef struct {
+	Name   string `json:"name"`
+	Column string `json:"column"`
 }
 
 // Row represents a row of data
@@ -37,6 +48,15 @@ type QueryResult struct {
 
 // Execute executes a SQL statement
 func (e *Executor) Execute(node Node) (*QueryResult, error) {
+	// Schema changes write outside any batch, so they cannot be part of a
+	// transaction
+	if e.txn != nil {
+		switch node.(type) {
+		case CreateTableNode, DropTableNode, CreateIndexNode, AlterTableNode:
+			return nil, fmt.Errorf("%s is not allowed inside a transaction", strings.ReplaceAll(string(node.Type()), "_", " "))
+		}
+	}
+
 	switch n := node.(type) {
 	case CreateTableNode:
 		return e.executeCreateTable(n)
@@ -50,16 +70,38 @@ func (e *Executor) Execute(node Node) (*QueryResult, error) {
 		return e.executeUpdate(n)
 	case DropTableNode:
 		return e.executeDropTable(n)
+	case CreateIndexNode:
+		return e.executeCreateIndex(n)
+	case AlterTableNode:
+		return e.executeAlterTable(n)
+	case TransactionNode:
+		return e.executeTransaction(n)
 	default:
 		return nil, fmt.Errorf("unsupported statement type: %s", n.Type())
 	}
 }
 
+// ExecuteAll executes statements in order, as parsed by ParseAll, and stops
+// at the first failure. The results of the statements before it are returned
+// with the error; their changes are kept unless they ran inside a
+// transaction that is rolled back
+func (e *Executor) ExecuteAll(nodes []Node) ([]*QueryResult, error) {
+	results := make([]*QueryResult, 0, len(nodes))
+	for i, node := range nodes {
+		result, err := e.Execute(node)
+		if err != nil {
+			return results, fmt.Errorf("statement %d (%s): %v", i+1, node.Type(), err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 // executeCreateTable executes a CREATE TABLE statement
 func (e *Executor) executeCreateTable(node CreateTableNode) (*QueryResult, error) {
 	// Check if the table already exists
 	tableKey := fmt.Sprintf("__schema_%s", node.TableName)
-	_, exists := e.db.Get([]byte(tableKey))
+	_, exists := e.get([]byte(tableKey))
 	if exists {
 		return nil, fmt.Errorf("table '%s' already exists", node.TableName)
 	}
@@ -88,7 +130,7 @@ func (e *Executor) executeCreateTable(node CreateTableNode) (*QueryResult, error
 func (e *Executor) executeInsert(node InsertNode) (*QueryResult, error) {
 	// Get the table schema
 	tableKey := fmt.Sprintf("__schema_%s", node.TableName)
-	schemaData, exists := e.db.Get([]byte(tableKey))
+	schemaData, exists := e.get([]byte(tableKey))
 	if !exists {
 		return nil, fmt.Errorf("table '%s' does not exist", node.TableName)
 	}
@@ -99,6 +141,13 @@ func (e *Executor) executeInsert(node InsertNode) (*QueryResult, error) {
 		return nil, fmt.Errorf("failed to deserialize schema: %v", err)
 	}
 
+	// Without a column list the values follow the schema's column order
+	if len(node.Columns) == 0 {
+		for _, col := range schema.Columns {
+			node.Columns = append(node.Columns, col.Name)
+		}
+	}
+
 	// Validate column names
 	for _, col := range node.Columns {
 		found := false
@@ -127,10 +176,16 @@ func (e *Executor) executeInsert(node InsertNode) (*QueryResult, error) {
 		pkColumn = schema.Columns[0].Name
 	}
 
-	// Insert each row
+	// Build and validate every row before writing any of them, so a
+	// constraint violation leaves the table unchanged
+	type pendingRow struct {
+		key string
+		row Row
+	}
+	var rows []pendingRow
 	for _, rowValues := range node.Values {
 		if len(rowValues) != len(node.Columns) {
-			return nil, fmt.Errorf("number of values does not match number of columns")
+			return nil, fmt.Errorf("number of values (%d) does not match number of columns (%d)", len(rowValues), len(node.Columns))
 		}
 
 		// Create a row object
@@ -152,20 +207,72 @@ func (e *Executor) executeInsert(node InsertNode) (*QueryResult, error) {
 			return nil, errors.New("primary key value is required")
 		}
 
+		// Check column types and NOT NULL constraints
+		for _, col := range schema.Columns {
+			value, ok := rowColumn(row, col.Name)
+			if !ok {
+				if col.NotNull {
+					return nil, fmt.Errorf("column '%s' cannot be NULL", col.Name)
+				}
+				continue
+			}
+			if err := validateColumnValue(col, value); err != nil {
+				return nil, err
+			}
+		}
+
 		// Create a key for this row
-		rowKey := fmt.Sprintf("%s:%s", node.TableName, pkValue)
+		rows = append(rows, pendingRow{key: fmt.Sprintf("%s:%s", node.TableName, pkValue), row: row})
+	}
 
+	// Check UNIQUE constraints against existing rows and earlier rows of this INSERT
+	for _, col := range schema.Columns {
+		if !col.Unique {
+			continue
+		}
+		owners, err := e.columnOwners(node.TableName, col.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			value, ok := rowColumn(r.row, col.Name)
+			if !ok {
+				continue
+			}
+			if owner, taken := owners[value]; taken && owner != r.key {
+				return nil, fmt.Errorf("duplicate value '%s' for UNIQUE column '%s'", value, col.Name)
+			}
+			owners[value] = r.key
+		}
+	}
+
+	// Insert all rows and their index entries in one transaction
+	var writes []keyWrite
+	written := make(map[string]Row)
+	for _, r := range rows {
 		// Serialize the row to JSON
-		rowBytes, err := json.Marshal(row)
+		rowBytes, err := json.Marshal(r.row)
 		if err != nil {
 			return nil, fmt.Errorf("failed to serialize row: %v", err)
 		}
-
-		// Store the row in the database
-		if err := e.db.Put([]byte(rowKey), rowBytes); err != nil {
-			return nil, fmt.Errorf("failed to store row: %v", err)
+		writes = append(writes, keyWrite{key: []byte(r.key), value: rowBytes})
+
+		// An INSERT over an existing primary key replaces the row, so its
+		// old index entries have to go
+		if len(schema.Indexes) > 0 {
+			oldRow, ok := written[r.key]
+			if !ok {
+				if oldRow, err = e.getRow(r.key); err != nil {
+					return nil, err
+				}
+			}
+			writes = append(writes, indexWrites(node.TableName, schema, r.key, oldRow, r.row)...)
+			written[r.key] = r.row
 		}
 	}
+	if err := e.commitWrites(writes); err != nil {
+		return nil, fmt.Errorf("failed to store rows: %v", err)
+	}
 
 	return &QueryResult{}, nil
 }
@@ -174,7 +281,7 @@ func (e *Executor) executeInsert(node InsertNode) (*QueryResult, error) {
 func (e *Executor) executeSelect(node SelectNode) (*QueryResult, error) {
 	// Get the table schema
 	tableKey := fmt.Sprintf("__schema_%s", node.TableName)
-	schemaData, exists := e.db.Get([]byte(tableKey))
+	schemaData, exists := e.get([]byte(tableKey))
 	if !exists {
 		return nil, fmt.Errorf("table '%s' does not exist", node.TableName)
 	}
@@ -187,7 +294,15 @@ func (e *Executor) executeSelect(node SelectNode) (*QueryResult, error) {
 
 	// Determine which columns to include in the result
 	var columns []string
-	if len(node.Columns) == 0 || (len(node.Columns) == 1 && node.Columns[0] == "*") {
+	if len(node.Aggregates) > 0 {
+		// Aggregate queries return one column per aggregate, named after it
+		for _, agg := range node.Aggregates {
+			if agg.Column != "*" && !schemaHasColumn(schema, agg.Column) {
+				return nil, fmt.Errorf("column '%s' does not exist in table '%s'", agg.Column, node.TableName)
+			}
+			columns = append(columns, agg.String())
+		}
+	} else if len(node.Columns) == 0 || (len(node.Columns) == 1 && node.Columns[0] == "*") {
 		// Include all columns in the schema
 		for _, col := range schema.Columns {
 			columns = append(columns, col.Name)
@@ -211,88 +326,584 @@ func (e *Executor) executeSelect(node SelectNode) (*QueryResult, error) {
 		}
 	}
 
+	// Validate ORDER BY columns up front, they need not be selected
+	for _, term := range node.OrderBy {
+		if !schemaHasColumn(schema, term.Column) {
+			return nil, fmt.Errorf("column '%s' does not exist in table '%s'", term.Column, node.TableName)
+		}
+	}
+
+	// COUNT(*) on its own only needs the number of matching rows, so count
+	// them during the scan instead of collecting them
+	if len(node.Aggregates) == 1 && node.Aggregates[0].Func == "COUNT" && node.Aggregates[0].Column == "*" {
+		count, err := e.countRows(node.TableName, schema, node.Where)
+		if err != nil {
+			return nil, err
+		}
+		result := QueryResult{Columns: columns, Rows: []Row{}}
+		if node.Offset == 0 && node.Limit != 0 {
+			result.Rows = append(result.Rows, Row{columns[0]: strconv.Itoa(count)})
+		}
+		return &result, nil
+	}
+
+	// Collect the full rows matching the WHERE conditions; projection happens
+	// last so that ORDER BY can use columns that are not selected
+	var matched []Row
+
 	// Try an optimized lookup if it's a primary key condition
-	if canUseDirectLookup(node, schema) {
-		_, pkValue := getDirectLookupKey(node, schema)
+	if canUseDirectLookup(node.Where, schema) {
+		_, pkValue := getDirectLookupKey(node.Where, schema)
 		rowKey := fmt.Sprintf("%s:%s", node.TableName, pkValue)
 
 		// Try to get the row directly
-		rowData, exists := e.db.Get([]byte(rowKey))
+		rowData, exists := e.get([]byte(rowKey))
 		if exists {
-			var row Row
-			if err := json.Unmarshal(rowData, &row); err != nil {
-				return nil, fmt.Errorf("failed to deserialize row: %v", err)
+			row, err := decodeRow(schema, rowData)
+			if err != nil {
+				return nil, err
 			}
 
 			// Check if the row matches the WHERE conditions
-			if matchesAllConditions(row, node.Conditions) {
-				// Create a result row with only the requested columns
-				resultRow := make(Row)
-				for _, col := range columns {
-					resultRow[col] = row[col]
-				}
+			if matchesWhere(row, node.Where) {
+				matched = append(matched, row)
+			}
+		}
+	} else {
+		// Otherwise, we need to scan the table or an index on it
+		// First collect all potential rows
+		var rowsToCheck []Row
 
-				return &QueryResult{
-					Columns: columns,
-					Rows:    []Row{resultRow},
-				}, nil
+		err := e.scanCandidates(node.TableName, schema, node.Where, func(key []byte, value []byte) error {
+			row, err := decodeRow(schema, value)
+			if err != nil {
+				return err
 			}
+
+			rowsToCheck = append(rowsToCheck, row)
+			return nil
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan for rows: %v", err)
 		}
 
-		// If we got here, no rows matched or the row didn't match all conditions
-		return &QueryResult{
-			Columns: columns,
-			Rows:    []Row{},
-		}, nil
+		// Now filter the rows based on the WHERE conditions
+		for _, row := range rowsToCheck {
+			if matchesWhere(row, node.Where) {
+				matched = append(matched, row)
+			}
+		}
 	}
 
-	// Otherwise, we need to scan all rows
-	// Use Scan with prefix check instead of ScanRange
-	var result QueryResult
-	result.Columns = columns
+	// Aggregates collapse the matched rows into a single row; otherwise
+	// apply ORDER BY and DISTINCT. OFFSET and LIMIT apply to the rows either way
+	if len(node.Aggregates) > 0 {
+		row, err := computeAggregates(matched, node.Aggregates)
+		if err != nil {
+			return nil, err
+		}
+		matched = []Row{row}
+	} else {
+		sortRows(matched, node.OrderBy)
+		if node.Distinct {
+			matched = distinctRows(matched, columns)
+		}
+	}
+	if node.Offset > 0 {
+		if node.Offset >= len(matched) {
+			matched = nil
+		} else {
+			matched = matched[node.Offset:]
+		}
+	}
+	if node.Limit >= 0 && node.Limit < len(matched) {
+		matched = matched[:node.Limit]
+	}
 
-	prefix := fmt.Sprintf("%s:", node.TableName)
+	result := QueryResult{Columns: columns, Rows: []Row{}}
+	for _, row := range matched {
+		// Create a result row with only the requested columns
+		resultRow := make(Row)
+		for _, col := range columns {
+			resultRow[col] = row[col]
+		}
 
-	// First collect all potential rows
-	var rowsToCheck []Row
+		result.Rows = append(result.Rows, resultRow)
+	}
 
-	err := e.db.Scan(func(key []byte, value []byte) error {
-		keyStr := string(key)
-		if strings.HasPrefix(keyStr, prefix) {
-			var row Row
-			if err := json.Unmarshal(value, &row); err != nil {
-				return fmt.Errorf("failed to deserialize row: %v", err)
-			}
+	return &result, nil
+}
 
-			rowsToCheck = append(rowsToCheck, row)
+// countRows counts the rows matching where without keeping them; without a
+// WHERE clause the rows are not even deserialized
+func (e *Executor) countRows(tableName string, schema TableSchema, where Expr) (int, error) {
+	if canUseDirectLookup(where, schema) {
+		_, pkValue := getDirectLookupKey(where, schema)
+		rowData, exists := e.get([]byte(fmt.Sprintf("%s:%s", tableName, pkValue)))
+		if !exists {
+			return 0, nil
+		}
+		row, err := decodeRow(schema, rowData)
+		if err != nil {
+			return 0, err
+		}
+		if matchesWhere(row, where) {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	count := 0
+	err := e.scanCandidates(tableName, schema, where, func(key []byte, value []byte) error {
+		if where == nil {
+			count++
+			return nil
+		}
+		row, err := decodeRow(schema, value)
+		if err != nil {
+			return err
+		}
+		if matchesWhere(row, where) {
+			count++
 		}
 		return nil
 	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan for rows: %v", err)
+	}
+	return count, nil
+}
+
+// distinctRows drops the rows whose values for columns repeat an earlier
+// row's, keeping the first so that ORDER BY still holds. A missing value
+// counts as empty, as it does in the projection
+func distinctRows(rows []Row, columns []string) []Row {
+	seen := make(map[string]bool)
+	unique := rows[:0]
+	for _, row := range rows {
+		var key strings.Builder
+		for _, col := range columns {
+			// Quoting keeps the concatenation unambiguous
+			key.WriteString(strconv.Quote(row[col]))
+		}
+		if seen[key.String()] {
+			continue
+		}
+		seen[key.String()] = true
+		unique = append(unique, row)
+	}
+	return unique
+}
+
+// rowColumn returns a row's value for a column, matching the name
+// case-insensitively like the schema does
+func rowColumn(row Row, name string) (string, bool) {
+	if value, ok := row[name]; ok {
+		return value, true
+	}
+	for col, value := range row {
+		if strings.EqualFold(col, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
 
+// validateColumnValue checks that a value can be stored in a column of the
+// given type; TEXT, VARCHAR and CHAR accept any value
+func validateColumnValue(col ColumnDef, value string) error {
+	if strings.EqualFold(col.Type, "INTEGER") {
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("column '%s' expects INTEGER, got '%s'", col.Name, value)
+		}
+	}
+	return nil
+}
+
+// columnOwners maps each value of a column to the key of the row holding it,
+// used for UNIQUE checks
+func (e *Executor) columnOwners(tableName, column string) (map[string]string, error) {
+	owners := make(map[string]string)
+	err := e.scanTable(tableName, func(key []byte, value []byte) error {
+		var row Row
+		if err := json.Unmarshal(value, &row); err != nil {
+			return fmt.Errorf("failed to deserialize row: %v", err)
+		}
+		if v, ok := rowColumn(row, column); ok {
+			owners[v] = string(key)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan for rows: %v", err)
+		return nil, fmt.Errorf("failed to scan table: %v", err)
+	}
+	return owners, nil
+}
+
+// scanTable calls fn for every row of a table. Rows are stored under
+// "table:pk", and ScanPrefix seeks straight to that prefix within each key
+// length, so other tables' keys are never visited. A byte range such as
+// "table:".."table;" would be wrong because keys are ordered by length first
+func (e *Executor) scanTable(tableName string, fn func(key []byte, value []byte) error) error {
+	prefix := fmt.Sprintf("%s:", tableName)
+	return e.scanPrefix([]byte(prefix), func(key []byte, value []byte) error {
+		e.rowsScanned++
+		return fn(key, value)
+	})
+}
+
+// scanCandidates calls fn for every row that may match where. When where
+// requires equality on an indexed column only the rows listed under that
+// value in the index are read, otherwise the whole table is scanned. Callers
+// still check each row against where, which also filters out index entries
+// whose value merely shares the prefix
+func (e *Executor) scanCandidates(tableName string, schema TableSchema, where Expr, fn func(key []byte, value []byte) error) error {
+	idx, value, ok := indexedEquality(where, schema)
+	if !ok {
+		return e.scanTable(tableName, fn)
+	}
+
+	var rowKeys [][]byte
+	seen := make(map[string]bool)
+	err := e.scanPrefix([]byte(indexEntryPrefix(tableName, idx.Column, value)), func(key []byte, rowKey []byte) error {
+		e.rowsScanned++
+		if !seen[string(rowKey)] && strings.HasPrefix(string(rowKey), tableName+":") {
+			seen[string(rowKey)] = true
+			rowKeys = append(rowKeys, rowKey)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	// Now filter the rows based on the WHERE conditions
-	for _, row := range rowsToCheck {
-		if matchesAllConditions(row, node.Conditions) {
-			// Create a result row with only the requested columns
-			resultRow := make(Row)
-			for _, col := range columns {
-				resultRow[col] = row[col]
+	for _, rowKey := range rowKeys {
+		rowData, exists := e.get(rowKey)
+		if !exists {
+			continue
+		}
+		e.rowsScanned++
+		if err := fn(rowKey, rowData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexedEquality finds an equality on an indexed column that every matching
+// row must satisfy, so only conditions joined by top-level ANDs qualify
+func indexedEquality(where Expr, schema TableSchema) (IndexDef, string, bool) {
+	for _, cond := range andConditions(where) {
+		if cond.Operator != "=" {
+			continue
+		}
+		for _, idx := range schema.Indexes {
+			if strings.EqualFold(cond.Left, idx.Column) {
+				return idx, cond.Right, true
 			}
+		}
+	}
+	return IndexDef{}, "", false
+}
+
+// indexPrefix returns the prefix of all entries of the index on a column.
+// Entries are stored as "__idx_<table>:<column>:<value>:<pk>" with the row
+// key as their value. Identifiers never contain ":", so unlike "_" it keeps
+// table "t" column "c_x" apart from table "t_c" column "x"
+func indexPrefix(tableName, column string) string {
+	return fmt.Sprintf("__idx_%s:%s:", tableName, column)
+}
 
-			result.Rows = append(result.Rows, resultRow)
+// indexEntryPrefix returns the prefix of the index entries of rows whose
+// column holds value
+func indexEntryPrefix(tableName, column, value string) string {
+	return indexPrefix(tableName, column) + value + ":"
+}
+
+// indexWrites returns the index changes for replacing oldRow with newRow under
+// rowKey; oldRow is nil for a new row and newRow is nil for a deleted one
+func indexWrites(tableName string, schema TableSchema, rowKey string, oldRow, newRow Row) []keyWrite {
+	pk := strings.TrimPrefix(rowKey, tableName+":")
+	var writes []keyWrite
+	for _, idx := range schema.Indexes {
+		oldValue, hadOld := rowColumn(oldRow, idx.Column)
+		newValue, hasNew := rowColumn(newRow, idx.Column)
+		if hadOld && hasNew && oldValue == newValue {
+			continue
+		}
+		if hadOld {
+			writes = append(writes, keyWrite{key: []byte(indexEntryPrefix(tableName, idx.Column, oldValue) + pk)})
+		}
+		if hasNew {
+			writes = append(writes, keyWrite{key: []byte(indexEntryPrefix(tableName, idx.Column, newValue) + pk), value: []byte(rowKey)})
 		}
 	}
+	return writes
+}
 
-	return &result, nil
+// getRow reads and deserializes a row, returning nil if it does not exist
+func (e *Executor) getRow(rowKey string) (Row, error) {
+	rowData, exists := e.get([]byte(rowKey))
+	if !exists {
+		return nil, nil
+	}
+	var row Row
+	if err := json.Unmarshal(rowData, &row); err != nil {
+		return nil, fmt.Errorf("failed to deserialize row: %v", err)
+	}
+	return row, nil
+}
+
+// decodeRow deserializes a stored row keeping only the schema's columns.
+// ALTER TABLE DROP COLUMN leaves the dropped values in the stored JSON, so
+// without this they would still match WHERE conditions and be copied by
+// UPDATE
+func decodeRow(schema TableSchema, data []byte) (Row, error) {
+	var row Row
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil, fmt.Errorf("failed to deserialize row: %v", err)
+	}
+	for col := range row {
+		if !schemaHasColumn(schema, col) {
+			delete(row, col)
+		}
+	}
+	return row, nil
+}
+
+// get reads a key, seeing the writes staged by the open transaction
+func (e *Executor) get(key []byte) ([]byte, bool) {
+	if e.txn != nil {
+		return e.txn.Get(key)
+	}
+	return e.db.Get(key)
+}
+
+// scanPrefix scans the keys with a prefix, seeing the writes staged by the
+// open transaction
+func (e *Executor) scanPrefix(prefix []byte, fn func(key, value []byte) error) error {
+	if e.txn != nil {
+		return e.txn.ScanPrefix(prefix, fn)
+	}
+	return e.db.ScanPrefix(prefix, fn)
+}
+
+// keyWrite is a single change made by a statement, a nil value deletes the key
+type keyWrite struct {
+	key   []byte
+	value []byte
+}
+
+// commitWrites applies a statement's writes as a single bitcask batch, so
+// they reach the WAL as one transaction: either all of them survive a crash
+// or none do. The batch updates the index only after its commit record is
+// written, so other readers never see some rows or index entries of the
+// statement without the rest. A statement larger than one batch is rejected
+// before anything is written.
+func (e *Executor) commitWrites(writes []keyWrite) error {
+	batch := e.txn
+	if batch == nil {
+		batch = bitcask.NewBatch(e.db)
+	}
+	if len(writes) > batch.Limit() {
+		return fmt.Errorf("statement writes %d keys, more than the %d allowed in one transaction", len(writes), batch.Limit())
+	}
+	for _, w := range writes {
+		var err error
+		if w.value == nil {
+			err = batch.Delete(w.key)
+		} else {
+			err = batch.Put(w.key, w.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// Inside a transaction the writes are staged until COMMIT
+	if batch == e.txn {
+		return nil
+	}
+	return batch.Commit()
+}
+
+// tableRow is a stored row together with its key
+type tableRow struct {
+	key []byte
+	row Row
+}
+
+// deleteRows deletes rows and their index entries in one transaction
+func (e *Executor) deleteRows(tableName string, schema TableSchema, rows []tableRow) error {
+	var writes []keyWrite
+	for _, r := range rows {
+		writes = append(writes, keyWrite{key: r.key})
+		writes = append(writes, indexWrites(tableName, schema, string(r.key), r.row, nil)...)
+	}
+	return e.commitWrites(writes)
+}
+
+// schemaHasColumn reports whether the schema has a column with the given name
+func schemaHasColumn(schema TableSchema, name string) bool {
+	for _, col := range schema.Columns {
+		if strings.EqualFold(name, col.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// computeAggregates evaluates the aggregates over rows into a single row keyed
+// by each aggregate's name. Rows missing the column are skipped, and SUM, AVG,
+// MIN and MAX over no values produce an empty value
+func computeAggregates(rows []Row, aggregates []Aggregate) (Row, error) {
+	result := make(Row)
+	for _, agg := range aggregates {
+		name := agg.String()
+
+		if agg.Column == "*" {
+			result[name] = strconv.Itoa(len(rows))
+			continue
+		}
+
+		var values []string
+		for _, row := range rows {
+			if value, ok := row[agg.Column]; ok {
+				values = append(values, value)
+			}
+		}
+
+		switch agg.Func {
+		case "COUNT":
+			result[name] = strconv.Itoa(len(values))
+		case "SUM", "AVG":
+			if len(values) == 0 {
+				result[name] = ""
+				continue
+			}
+			var sum float64
+			for _, value := range values {
+				num, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, fmt.Errorf("cannot compute %s over non-numeric value '%s' in column '%s'", name, value, agg.Column)
+				}
+				sum += num
+			}
+			if agg.Func == "AVG" {
+				sum /= float64(len(values))
+			}
+			result[name] = strconv.FormatFloat(sum, 'f', -1, 64)
+		case "MIN", "MAX":
+			if len(values) == 0 {
+				result[name] = ""
+				continue
+			}
+			best := values[0]
+			for _, value := range values[1:] {
+				cmp := compareValues(value, best)
+				if (agg.Func == "MIN" && cmp < 0) || (agg.Func == "MAX" && cmp > 0) {
+					best = value
+				}
+			}
+			result[name] = best
+		default:
+			return nil, fmt.Errorf("unsupported aggregate function: %s", agg.Func)
+		}
+	}
+	return result, nil
+}
+
+// sortRows orders rows by the given terms, keeping scan order for ties
+func sortRows(rows []Row, orderBy []OrderTerm) {
+	if len(orderBy) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, term := range orderBy {
+			cmp := compareValues(rows[i][term.Column], rows[j][term.Column])
+			if cmp == 0 {
+				continue
+			}
+			if term.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// Helper function to check if a row's column equals any value of an IN list,
+// comparing numerically when both sides are numbers
+func matchesIn(row Row, cond InCondition) bool {
+	value, exists := row[cond.Left]
+	if !exists {
+		return false
+	}
+	for _, candidate := range cond.Values {
+		if compareValues(value, candidate) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLike reports whether value matches a SQL LIKE pattern, where % matches
+// any run of characters and _ matches exactly one. Like column names, the
+// match is case-insensitive
+func matchLike(value, pattern string) bool {
+	v := []rune(strings.ToLower(value))
+	p := []rune(strings.ToLower(pattern))
+
+	// Greedy matching with backtracking to the most recent %
+	vi, pi := 0, 0
+	starP, starV := -1, 0
+	for vi < len(v) {
+		switch {
+		case pi < len(p) && (p[pi] == '_' || p[pi] == v[vi]):
+			vi++
+			pi++
+		case pi < len(p) && p[pi] == '%':
+			starP, starV = pi, vi
+			pi++
+		case starP >= 0:
+			// Let the last % absorb one more character
+			starV++
+			vi, pi = starV, starP+1
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '%' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// compareValues compares two column values numerically when both parse as
+// numbers and as strings otherwise; shared by WHERE comparisons and ORDER BY
+func compareValues(a, b string) int {
+	aNum, aErr := strconv.ParseFloat(a, 64)
+	bNum, bErr := strconv.ParseFloat(b, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case aNum < bNum:
+			return -1
+		case aNum > bNum:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
 }
 
 // Helper function to check if a direct lookup can be used
-func canUseDirectLookup(node SelectNode, schema TableSchema) bool {
-	// We need to have WHERE conditions and know the primary key
-	if len(node.Conditions) == 0 {
+func canUseDirectLookup(where Expr, schema TableSchema) bool {
+	// We need a primary key equality that every matching row must satisfy,
+	// so only conditions joined by top-level ANDs qualify
+	conditions := andConditions(where)
+	if len(conditions) == 0 {
 		return false
 	}
 
@@ -311,7 +922,7 @@ func canUseDirectLookup(node SelectNode, schema TableSchema) bool {
 	}
 
 	// Check if one of the conditions is for the primary key with equality
-	for _, cond := range node.Conditions {
+	for _, cond := range conditions {
 		if strings.EqualFold(cond.Left, pkColumn) && cond.Operator == "=" {
 			return true
 		}
@@ -321,7 +932,7 @@ func canUseDirectLookup(node SelectNode, schema TableSchema) bool {
 }
 
 // Helper function to get the primary key value for direct lookup
-func getDirectLookupKey(node SelectNode, schema TableSchema) (string, string) {
+func getDirectLookupKey(where Expr, schema TableSchema) (string, string) {
 	// Find the primary key column
 	var pkColumn string
 	for _, col := range schema.Columns {
@@ -337,7 +948,7 @@ func getDirectLookupKey(node SelectNode, schema TableSchema) (string, string) {
 	}
 
 	// Find the condition with the primary key
-	for _, cond := range node.Conditions {
+	for _, cond := range andConditions(where) {
 		if strings.EqualFold(cond.Left, pkColumn) && cond.Operator == "=" {
 			return pkColumn, cond.Right
 		}
@@ -346,96 +957,59 @@ func getDirectLookupKey(node SelectNode, schema TableSchema) (string, string) {
 	return "", ""
 }
 
-// Helper function to check if a row matches all WHERE conditions
-func matchesAllConditions(row Row, conditions []Condition) bool {
-	for _, cond := range conditions {
-		value, exists := row[cond.Left]
-		if !exists {
-			return false
+// Helper function to check if a row matches a WHERE expression; a nil
+// expression matches every row
+func matchesWhere(row Row, where Expr) bool {
+	switch e := where.(type) {
+	case nil:
+		return true
+	case Condition:
+		return matchesCondition(row, e)
+	case InCondition:
+		return matchesIn(row, e)
+	case BinaryExpr:
+		if e.Operator == "OR" {
+			return matchesWhere(row, e.Left) || matchesWhere(row, e.Right)
 		}
+		return matchesWhere(row, e.Left) && matchesWhere(row, e.Right)
+	default:
+		return false
+	}
+}
 
-		switch cond.Operator {
-		case "=":
-			if value != cond.Right {
-				return false
-			}
-		case ">":
-			// Try numeric comparison first
-			leftNum, leftErr := strconv.ParseFloat(value, 64)
-			rightNum, rightErr := strconv.ParseFloat(cond.Right, 64)
-
-			if leftErr == nil && rightErr == nil {
-				// Both are valid numbers
-				if leftNum <= rightNum {
-					return false
-				}
-			} else {
-				// String comparison
-				if value <= cond.Right {
-					return false
-				}
-			}
-		case "<":
-			// Try numeric comparison first
-			leftNum, leftErr := strconv.ParseFloat(value, 64)
-			rightNum, rightErr := strconv.ParseFloat(cond.Right, 64)
-
-			if leftErr == nil && rightErr == nil {
-				// Both are valid numbers
-				if leftNum >= rightNum {
-					return false
-				}
-			} else {
-				// String comparison
-				if value >= cond.Right {
-					return false
-				}
-			}
-		case ">=":
-			// Try numeric comparison first
-			leftNum, leftErr := strconv.ParseFloat(value, 64)
-			rightNum, rightErr := strconv.ParseFloat(cond.Right, 64)
-
-			if leftErr == nil && rightErr == nil {
-				// Both are valid numbers
-				if leftNum < rightNum {
-					return false
-				}
-			} else {
-				// String comparison
-				if value < cond.Right {
-					return false
-				}
-			}
-		case "<=":
-			// Try numeric comparison first
-			leftNum, leftErr := strconv.ParseFloat(value, 64)
-			rightNum, rightErr := strconv.ParseFloat(cond.Right, 64)
+// Helper function to check if a row matches a single comparison
+func matchesCondition(row Row, cond Condition) bool {
+	value, exists := row[cond.Left]
+	if !exists {
+		return false
+	}
 
-			if leftErr == nil && rightErr == nil {
-				// Both are valid numbers
-				if leftNum > rightNum {
-					return false
-				}
-			} else {
-				// String comparison
-				if value > cond.Right {
-					return false
-				}
-			}
-		default:
-			// Unsupported operator
-			return false
-		}
+	switch cond.Operator {
+	case "=":
+		return value == cond.Right
+	case "!=":
+		return compareValues(value, cond.Right) != 0
+	case ">":
+		return compareValues(value, cond.Right) > 0
+	case "<":
+		return compareValues(value, cond.Right) < 0
+	case ">=":
+		return compareValues(value, cond.Right) >= 0
+	case "<=":
+		return compareValues(value, cond.Right) <= 0
+	case "LIKE":
+		return matchLike(value, cond.Right)
+	default:
+		// Unsupported operator
+		return false
 	}
-	return true
 }
 
 // executeDelete executes a DELETE statement
 func (e *Executor) executeDelete(node DeleteNode) (*QueryResult, error) {
 	// Get the table schema
 	tableKey := fmt.Sprintf("__schema_%s", node.TableName)
-	schemaData, exists := e.db.Get([]byte(tableKey))
+	schemaData, exists := e.get([]byte(tableKey))
 	if !exists {
 		return nil, fmt.Errorf("table '%s' does not exist", node.TableName)
 	}
@@ -447,18 +1021,15 @@ func (e *Executor) executeDelete(node DeleteNode) (*QueryResult, error) {
 	}
 
 	// If there are no conditions, delete all rows
-	if len(node.Conditions) == 0 {
-		// Use Scan with prefix check instead of ScanRange
-		deletedCount := 0
-		prefix := fmt.Sprintf("%s:", node.TableName)
-
-		// Scan all keys and collect those that match our prefix
-		var keysToDelete [][]byte
-		err := e.db.Scan(func(key []byte, value []byte) error {
-			keyStr := string(key)
-			if strings.HasPrefix(keyStr, prefix) {
-				keysToDelete = append(keysToDelete, key)
+	if node.Where == nil {
+		// Collect all rows of the table
+		var rowsToDelete []tableRow
+		err := e.scanTable(node.TableName, func(key []byte, value []byte) error {
+			row, err := decodeRow(schema, value)
+			if err != nil {
+				return err
 			}
+			rowsToDelete = append(rowsToDelete, tableRow{key, row})
 			return nil
 		})
 
@@ -466,18 +1037,15 @@ func (e *Executor) executeDelete(node DeleteNode) (*QueryResult, error) {
 			return nil, fmt.Errorf("failed to scan for rows: %v", err)
 		}
 
-		// Delete all the matched keys
-		for _, key := range keysToDelete {
-			if err := e.db.Delete(key); err != nil {
-				return nil, fmt.Errorf("failed to delete row: %v", err)
-			}
-			deletedCount++
+		// Delete all the rows in one transaction
+		if err := e.deleteRows(node.TableName, schema, rowsToDelete); err != nil {
+			return nil, fmt.Errorf("failed to delete rows: %v", err)
 		}
 
 		return &QueryResult{
 			Columns: []string{"deleted_count"},
 			Rows: []Row{
-				{"deleted_count": strconv.Itoa(deletedCount)},
+				{"deleted_count": strconv.Itoa(len(rowsToDelete))},
 			},
 		}, nil
 	}
@@ -485,22 +1053,22 @@ func (e *Executor) executeDelete(node DeleteNode) (*QueryResult, error) {
 	// If there are WHERE conditions, we need to find the matching rows
 
 	// Try an optimized lookup if it's a primary key condition
-	if canUseDirectLookup(SelectNode{TableName: node.TableName, Conditions: node.Conditions}, schema) {
-		_, pkValue := getDirectLookupKey(SelectNode{TableName: node.TableName, Conditions: node.Conditions}, schema)
+	if canUseDirectLookup(node.Where, schema) {
+		_, pkValue := getDirectLookupKey(node.Where, schema)
 		rowKey := fmt.Sprintf("%s:%s", node.TableName, pkValue)
 
 		// Try to get the row directly
-		rowData, exists := e.db.Get([]byte(rowKey))
+		rowData, exists := e.get([]byte(rowKey))
 		if exists {
-			var row Row
-			if err := json.Unmarshal(rowData, &row); err != nil {
-				return nil, fmt.Errorf("failed to deserialize row: %v", err)
+			row, err := decodeRow(schema, rowData)
+			if err != nil {
+				return nil, err
 			}
 
 			// Check if the row matches the WHERE conditions
-			if matchesAllConditions(row, node.Conditions) {
+			if matchesWhere(row, node.Where) {
 				// Delete the row
-				if err := e.db.Delete([]byte(rowKey)); err != nil {
+				if err := e.deleteRows(node.TableName, schema, []tableRow{{[]byte(rowKey), row}}); err != nil {
 					return nil, fmt.Errorf("failed to delete row: %v", err)
 				}
 
@@ -521,29 +1089,17 @@ func (e *Executor) executeDelete(node DeleteNode) (*QueryResult, error) {
 		}, nil
 	}
 
-	// Otherwise, scan all keys and check conditions
-	deletedCount := 0
-	prefix := fmt.Sprintf("%s:", node.TableName)
-
+	// Otherwise, scan the table's rows (or an index) and check conditions
 	// First collect all potential rows
-	var rowsToCheck []struct {
-		key []byte
-		row Row
-	}
+	var rowsToCheck []tableRow
 
-	err := e.db.Scan(func(key []byte, value []byte) error {
-		keyStr := string(key)
-		if strings.HasPrefix(keyStr, prefix) {
-			var row Row
-			if err := json.Unmarshal(value, &row); err != nil {
-				return fmt.Errorf("failed to deserialize row: %v", err)
-			}
-
-			rowsToCheck = append(rowsToCheck, struct {
-				key []byte
-				row Row
-			}{key, row})
+	err := e.scanCandidates(node.TableName, schema, node.Where, func(key []byte, value []byte) error {
+		row, err := decodeRow(schema, value)
+		if err != nil {
+			return err
 		}
+
+		rowsToCheck = append(rowsToCheck, tableRow{key, row})
 		return nil
 	})
 
@@ -552,19 +1108,22 @@ func (e *Executor) executeDelete(node DeleteNode) (*QueryResult, error) {
 	}
 
 	// Now check each row against the conditions
+	var rowsToDelete []tableRow
 	for _, item := range rowsToCheck {
-		if matchesAllConditions(item.row, node.Conditions) {
-			if err := e.db.Delete(item.key); err != nil {
-				return nil, fmt.Errorf("failed to delete row: %v", err)
-			}
-			deletedCount++
+		if matchesWhere(item.row, node.Where) {
+			rowsToDelete = append(rowsToDelete, item)
 		}
 	}
 
+	// Delete the matched rows in one transaction
+	if err := e.deleteRows(node.TableName, schema, rowsToDelete); err != nil {
+		return nil, fmt.Errorf("failed to delete rows: %v", err)
+	}
+
 	return &QueryResult{
 		Columns: []string{"deleted_count"},
 		Rows: []Row{
-			{"deleted_count": strconv.Itoa(deletedCount)},
+			{"deleted_count": strconv.Itoa(len(rowsToDelete))},
 		},
 	}, nil
 }
@@ -573,7 +1132,7 @@ func (e *Executor) executeDelete(node DeleteNode) (*QueryResult, error) {
 func (e *Executor) executeUpdate(node UpdateNode) (*QueryResult, error) {
 	// Get the table schema
 	tableKey := fmt.Sprintf("__schema_%s", node.TableName)
-	schemaData, exists := e.db.Get([]byte(tableKey))
+	schemaData, exists := e.get([]byte(tableKey))
 	if !exists {
 		return nil, fmt.Errorf("table '%s' does not exist", node.TableName)
 	}
@@ -584,168 +1143,231 @@ func (e *Executor) executeUpdate(node UpdateNode) (*QueryResult, error) {
 		return nil, fmt.Errorf("failed to deserialize schema: %v", err)
 	}
 
-	// Validate the columns
-	for _, col := range node.Columns {
+	// Validate the columns and the types of the new values
+	var uniqueSet []ColumnDef
+	schemaCols := make([]ColumnDef, len(node.Columns))
+	for i, col := range node.Columns {
+		var schemaCol ColumnDef
 		found := false
-		for _, schemaCol := range schema.Columns {
-			if strings.EqualFold(col, schemaCol.Name) {
-				found = true
+		for _, c := range schema.Columns {
+			if strings.EqualFold(col, c.Name) {
+				schemaCol, found = c, true
 				break
 			}
 		}
 		if !found {
 			return nil, fmt.Errorf("column '%s' does not exist in table '%s'", col, node.TableName)
 		}
-	}
-
-	// Find primary key column
-	var pkColumn string
-	for _, col := range schema.Columns {
-		if col.PrimaryKey {
-			pkColumn = col.Name
-			break
+		// Arithmetic results are validated per row once they are computed
+		if op, _ := node.assignment(i); op == "" {
+			if err := validateColumnValue(schemaCol, node.Values[i]); err != nil {
+				return nil, err
+			}
+		}
+		schemaCols[i] = schemaCol
+		if schemaCol.Unique {
+			uniqueSet = append(uniqueSet, schemaCol)
 		}
 	}
 
-	// If no primary key column is defined, use the first column
-	if pkColumn == "" && len(schema.Columns) > 0 {
-		pkColumn = schema.Columns[0].Name
-	}
+	// Collect the rows to update
+	var targets []tableRow
 
 	// If there are WHERE conditions for a specific primary key, try optimized lookup
-	if canUseDirectLookup(SelectNode{TableName: node.TableName, Conditions: node.Conditions}, schema) {
-		_, pkValue := getDirectLookupKey(SelectNode{TableName: node.TableName, Conditions: node.Conditions}, schema)
+	if canUseDirectLookup(node.Where, schema) {
+		_, pkValue := getDirectLookupKey(node.Where, schema)
 		rowKey := fmt.Sprintf("%s:%s", node.TableName, pkValue)
 
 		// Try to get the row directly
-		rowData, exists := e.db.Get([]byte(rowKey))
+		rowData, exists := e.get([]byte(rowKey))
 		if exists {
-			var row Row
-			if err := json.Unmarshal(rowData, &row); err != nil {
-				return nil, fmt.Errorf("failed to deserialize row: %v", err)
+			row, err := decodeRow(schema, rowData)
+			if err != nil {
+				return nil, err
 			}
 
 			// Check if the row matches the WHERE conditions
-			if matchesAllConditions(row, node.Conditions) {
-				// Update the row with the new values
-				for i, col := range node.Columns {
-					row[col] = node.Values[i]
-				}
+			if matchesWhere(row, node.Where) {
+				targets = append(targets, tableRow{key: []byte(rowKey), row: row})
+			}
+		}
+	} else {
+		// Otherwise, scan the table or an index on it
+		err := e.scanCandidates(node.TableName, schema, node.Where, func(key []byte, value []byte) error {
+			row, err := decodeRow(schema, value)
+			if err != nil {
+				return err
+			}
 
-				// Serialize the row to JSON
-				rowBytes, err := json.Marshal(row)
-				if err != nil {
-					return nil, fmt.Errorf("failed to serialize row: %v", err)
-				}
+			// Check if the row matches the WHERE conditions
+			if matchesWhere(row, node.Where) {
+				targets = append(targets, tableRow{key: key, row: row})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan table: %v", err)
+		}
+	}
 
-				// Store the updated row in the database
-				if err := e.db.Put([]byte(rowKey), rowBytes); err != nil {
-					return nil, fmt.Errorf("failed to store row: %v", err)
+	// Compute every row's new values before writing anything, so a bad
+	// arithmetic operand fails the whole statement
+	newValues := make([][]string, len(targets))
+	for t, target := range targets {
+		newValues[t] = make([]string, len(node.Columns))
+		for i := range node.Columns {
+			value, err := evalAssignment(node, i, target.row)
+			if err != nil {
+				return nil, err
+			}
+			if op, _ := node.assignment(i); op != "" {
+				if err := validateColumnValue(schemaCols[i], value); err != nil {
+					return nil, err
 				}
-
-				return &QueryResult{
-					Columns: []string{"updated_count"},
-					Rows: []Row{
-						{"updated_count": "1"},
-					},
-				}, nil
 			}
+			newValues[t][i] = value
 		}
-
-		return &QueryResult{
-			Columns: []string{"updated_count"},
-			Rows: []Row{
-				{"updated_count": "0"},
-			},
-		}, nil
 	}
 
-	// Otherwise, perform a full table scan
-	// Determine the start and end keys for the scan
-	startKey := fmt.Sprintf("%s:", node.TableName)
-	endKey := fmt.Sprintf("%s;", node.TableName) // Using ; as it's the next ASCII character after :
-
-	// Scan the table
-	rowResults, err := e.db.ScanRange([]byte(startKey), []byte(endKey))
-	if err != nil && err != bitcask.ErrExceedEndRange {
-		return nil, fmt.Errorf("failed to scan table: %v", err)
+	// Setting a UNIQUE column must not collide with rows outside the update,
+	// and can only give a single row each value
+	for _, col := range uniqueSet {
+		assigned := -1
+		for i, c := range node.Columns {
+			if strings.EqualFold(c, col.Name) {
+				assigned = i
+			}
+		}
+		owners, err := e.columnOwners(node.TableName, col.Name)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for t, target := range targets {
+			value := newValues[t][assigned]
+			if owner, taken := owners[value]; seen[value] || (taken && owner != string(target.key)) {
+				return nil, fmt.Errorf("duplicate value '%s' for UNIQUE column '%s'", value, col.Name)
+			}
+			seen[value] = true
+		}
 	}
 
 	// Process each row
-	updatedCount := 0
-	for _, rowResult := range rowResults {
-		var row Row
-		if err := json.Unmarshal(rowResult.Value, &row); err != nil {
-			return nil, fmt.Errorf("failed to deserialize row: %v", err)
+	for t, target := range targets {
+		// Update a copy of the row with the new values
+		newRow := make(Row, len(target.row))
+		for col, value := range target.row {
+			newRow[col] = value
+		}
+		for i, col := range node.Columns {
+			newRow[col] = newValues[t][i]
 		}
 
-		// Check if the row matches the WHERE conditions
-		if matchesAllConditions(row, node.Conditions) {
-			// Update the row with the new values
-			for i, col := range node.Columns {
-				row[col] = node.Values[i]
-			}
-
-			// Serialize the row to JSON
-			rowBytes, err := json.Marshal(row)
-			if err != nil {
-				return nil, fmt.Errorf("failed to serialize row: %v", err)
-			}
+		// Serialize the row to JSON
+		rowBytes, err := json.Marshal(newRow)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize row: %v", err)
+		}
 
-			// Store the updated row in the database
-			if err := e.db.Put(rowResult.Key, rowBytes); err != nil {
-				return nil, fmt.Errorf("failed to store row: %v", err)
-			}
-			updatedCount++
+		// Store the updated row together with its index changes
+		writes := []keyWrite{{key: target.key, value: rowBytes}}
+		writes = append(writes, indexWrites(node.TableName, schema, string(target.key), target.row, newRow)...)
+		if err := e.commitWrites(writes); err != nil {
+			return nil, fmt.Errorf("failed to store row: %v", err)
 		}
 	}
 
 	return &QueryResult{
 		Columns: []string{"updated_count"},
 		Rows: []Row{
-			{"updated_count": strconv.Itoa(updatedCount)},
+			{"updated_count": strconv.Itoa(len(targets))},
 		},
 	}, nil
 }
 
+// evalAssignment returns the value the i-th SET assignment gives a row,
+// applying "col = col + n" and "col = col - n" to the row's current value.
+// Integers are added exactly; other numbers are added as floats
+func evalAssignment(node UpdateNode, i int, row Row) (string, error) {
+	op, operand := node.assignment(i)
+	if op == "" {
+		return operand, nil
+	}
+	column := node.Columns[i]
+	current, _ := rowColumn(row, column)
+
+	a, errA := strconv.ParseInt(current, 10, 64)
+	b, errB := strconv.ParseInt(operand, 10, 64)
+	if errA == nil && errB == nil {
+		if op == "-" {
+			if b == math.MinInt64 {
+				return "", fmt.Errorf("integer overflow computing column '%s'", column)
+			}
+			b = -b
+		}
+		sum := a + b
+		if (b > 0 && sum < a) || (b < 0 && sum > a) {
+			return "", fmt.Errorf("integer overflow computing column '%s'", column)
+		}
+		return strconv.FormatInt(sum, 10), nil
+	}
+
+	x, err := strconv.ParseFloat(current, 64)
+	if err != nil {
+		return "", fmt.Errorf("column '%s' holds non-numeric value '%s', cannot apply %s %s", column, current, op, operand)
+	}
+	y, err := strconv.ParseFloat(operand, 64)
+	if err != nil {
+		return "", fmt.Errorf("column '%s' expects a number after %s, got '%s'", column, op, operand)
+	}
+	if op == "-" {
+		y = -y
+	}
+	return strconv.FormatFloat(x+y, 'f', -1, 64), nil
+}
+
 // executeDropTable executes a DROP TABLE statement
 func (e *Executor) executeDropTable(node DropTableNode) (*QueryResult, error) {
 	// Get the table schema
 	tableKey := fmt.Sprintf("__schema_%s", node.TableName)
-	_, exists := e.db.Get([]byte(tableKey))
+	schemaData, exists := e.get([]byte(tableKey))
 	if !exists {
 		return nil, fmt.Errorf("table '%s' does not exist", node.TableName)
 	}
 
-	// Delete the schema
-	if err := e.db.Delete([]byte(tableKey)); err != nil {
-		return nil, fmt.Errorf("failed to delete table schema: %v", err)
+	// Deserialize the schema
+	var schema TableSchema
+	if err := json.Unmarshal(schemaData, &schema); err != nil {
+		return nil, fmt.Errorf("failed to deserialize schema: %v", err)
 	}
 
-	// Instead of using ScanRange, use Scan with a prefix check to find and delete rows
-	deletedCount := 0
-	prefix := fmt.Sprintf("%s:", node.TableName)
-
-	// Scan all keys and collect those that match our prefix
-	var keysToDelete [][]byte
-	err := e.db.Scan(func(key []byte, value []byte) error {
-		keyStr := string(key)
-		if strings.HasPrefix(keyStr, prefix) {
-			keysToDelete = append(keysToDelete, key)
-		}
+	// Collect the keys of all rows of the table
+	writes := []keyWrite{{key: []byte(tableKey)}}
+	err := e.scanTable(node.TableName, func(key []byte, value []byte) error {
+		writes = append(writes, keyWrite{key: key})
 		return nil
 	})
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan for table rows: %v", err)
 	}
+	deletedCount := len(writes) - 1
 
-	// Now delete all the matched keys
-	for _, key := range keysToDelete {
-		if err := e.db.Delete(key); err != nil {
-			return nil, fmt.Errorf("failed to delete row: %v", err)
+	// Collect the entries of the table's indexes
+	for _, idx := range schema.Indexes {
+		err := e.scanPrefix([]byte(indexPrefix(node.TableName, idx.Column)), func(key []byte, value []byte) error {
+			writes = append(writes, keyWrite{key: key})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan index '%s': %v", idx.Name, err)
 		}
-		deletedCount++
+	}
+
+	// Delete the schema, all rows and index entries in one transaction, so a
+	// crash never leaves rows behind without their table
+	if err := e.commitWrites(writes); err != nil {
+		return nil, fmt.Errorf("failed to drop table: %v", err)
 	}
 
 	return &QueryResult{
@@ -755,3 +1377,258 @@ func (e *Executor) executeDropTable(node DropTableNode) (*QueryResult, error) {
 		},
 	}, nil
 }
+
+// executeCreateIndex executes a CREATE INDEX statement
+func (e *Executor) executeCreateIndex(node CreateIndexNode) (*QueryResult, error) {
+	// Get the table schema
+	tableKey := fmt.Sprintf("__schema_%s", node.TableName)
+	schemaData, exists := e.get([]byte(tableKey))
+	if !exists {
+		return nil, fmt.Errorf("table '%s' does not exist", node.TableName)
+	}
+
+	// Deserialize the schema
+	var schema TableSchema
+	if err := json.Unmarshal(schemaData, &schema); err != nil {
+		return nil, fmt.Errorf("failed to deserialize schema: %v", err)
+	}
+
+	// Index the column under its declared name
+	column := ""
+	for _, col := range schema.Columns {
+		if strings.EqualFold(node.Column, col.Name) {
+			column = col.Name
+			break
+		}
+	}
+	if column == "" {
+		return nil, fmt.Errorf("column '%s' does not exist in table '%s'", node.Column, node.TableName)
+	}
+	for _, idx := range schema.Indexes {
+		if strings.EqualFold(idx.Name, node.IndexName) {
+			return nil, fmt.Errorf("index '%s' already exists", node.IndexName)
+		}
+		if idx.Column == column {
+			return nil, fmt.Errorf("column '%s' is already indexed by '%s'", column, idx.Name)
+		}
+	}
+
+	// Add entries for the existing rows. A table may hold more rows than one
+	// batch allows, so this is not a transaction; the schema is written last,
+	// so entries left by a crash are ignored, and lookups recheck every row
+	index := IndexDef{Name: node.IndexName, Column: column}
+	schema.Indexes = append(schema.Indexes, index)
+	entries := make(map[string][]byte)
+	err := e.scanTable(node.TableName, func(key []byte, value []byte) error {
+		var row Row
+		if err := json.Unmarshal(value, &row); err != nil {
+			return fmt.Errorf("failed to deserialize row: %v", err)
+		}
+		for _, w := range indexWrites(node.TableName, TableSchema{Indexes: []IndexDef{index}}, string(key), nil, row) {
+			entries[string(w.key)] = w.value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan table: %v", err)
+	}
+	if err := e.db.PutMulti(entries); err != nil {
+		return nil, fmt.Errorf("failed to store index entries: %v", err)
+	}
+
+	// Serialize the schema to JSON
+	schemaBytes, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize schema: %v", err)
+	}
+
+	// Store the schema in the database
+	if err := e.db.Put([]byte(tableKey), schemaBytes); err != nil {
+		return nil, fmt.Errorf("failed to store schema: %v", err)
+	}
+
+	return &QueryResult{}, nil
+}
+
+// executeAlterTable executes ALTER TABLE ADD COLUMN and DROP COLUMN. Rows are
+// not rewritten: existing rows read an added column as empty, and a dropped
+// column's values stay in the stored JSON, hidden by decodeRow
+func (e *Executor) executeAlterTable(node AlterTableNode) (*QueryResult, error) {
+	// Get the table schema
+	tableKey := fmt.Sprintf("__schema_%s", node.TableName)
+	schemaData, exists := e.get([]byte(tableKey))
+	if !exists {
+		return nil, fmt.Errorf("table '%s' does not exist", node.TableName)
+	}
+
+	// Deserialize the schema
+	var schema TableSchema
+	if err := json.Unmarshal(schemaData, &schema); err != nil {
+		return nil, fmt.Errorf("failed to deserialize schema: %v", err)
+	}
+
+	var err error
+	var staleEntries [][]byte
+	if node.Action == "ADD" {
+		schema, err = e.addColumn(schema, node.Column)
+	} else {
+		schema, staleEntries, err = e.dropColumn(schema, node.Column.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Serialize the schema to JSON
+	schemaBytes, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize schema: %v", err)
+	}
+
+	// Store the schema in the database
+	if err := e.db.Put([]byte(tableKey), schemaBytes); err != nil {
+		return nil, fmt.Errorf("failed to store schema: %v", err)
+	}
+
+	// The dropped index's entries go only once the schema no longer lists
+	// it; a failure in between leaves unused entries instead of an index
+	// that silently misses rows
+	for _, key := range staleEntries {
+		if _, err := e.db.Delete(key); err != nil {
+			return nil, fmt.Errorf("failed to delete index entry: %v", err)
+		}
+	}
+
+	return &QueryResult{}, nil
+}
+
+// addColumn appends col to the schema. Existing rows have no value for it, so
+// it can be neither the primary key nor NOT NULL. Values left behind by an
+// earlier DROP COLUMN of the same name are removed first, otherwise they
+// would reappear
+func (e *Executor) addColumn(schema TableSchema, col ColumnDef) (TableSchema, error) {
+	if schemaHasColumn(schema, col.Name) {
+		return schema, fmt.Errorf("column '%s' already exists in table '%s'", col.Name, schema.Name)
+	}
+	if col.PrimaryKey {
+		return schema, fmt.Errorf("cannot add PRIMARY KEY column '%s' to an existing table", col.Name)
+	}
+	if col.NotNull {
+		return schema, fmt.Errorf("cannot add NOT NULL column '%s', existing rows have no value for it", col.Name)
+	}
+
+	// A table may hold more rows than one batch allows, so like CREATE INDEX
+	// this is not a transaction; the schema is written last
+	stale := make(map[string][]byte)
+	err := e.scanTable(schema.Name, func(key []byte, value []byte) error {
+		var row Row
+		if err := json.Unmarshal(value, &row); err != nil {
+			return fmt.Errorf("failed to deserialize row: %v", err)
+		}
+		found := false
+		for name := range row {
+			if strings.EqualFold(name, col.Name) {
+				delete(row, name)
+				found = true
+			}
+		}
+		if !found {
+			return nil
+		}
+		rowBytes, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("failed to serialize row: %v", err)
+		}
+		stale[string(key)] = rowBytes
+		return nil
+	})
+	if err != nil {
+		return schema, fmt.Errorf("failed to scan table: %v", err)
+	}
+	if err := e.db.PutMulti(stale); err != nil {
+		return schema, fmt.Errorf("failed to store rows: %v", err)
+	}
+
+	schema.Columns = append(schema.Columns, col)
+	return schema, nil
+}
+
+// dropColumn removes a column and any index on it from the schema and
+// returns the index's entries, which the caller deletes after storing the
+// schema. Stored rows keep the column's values
+func (e *Executor) dropColumn(schema TableSchema, name string) (TableSchema, [][]byte, error) {
+	pos := -1
+	for i, col := range schema.Columns {
+		if strings.EqualFold(name, col.Name) {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return schema, nil, fmt.Errorf("column '%s' does not exist in table '%s'", name, schema.Name)
+	}
+	col := schema.Columns[pos]
+	if col.PrimaryKey {
+		return schema, nil, fmt.Errorf("cannot drop PRIMARY KEY column '%s'", col.Name)
+	}
+	if len(schema.Columns) == 1 {
+		return schema, nil, fmt.Errorf("cannot drop column '%s', it is the only column of table '%s'", col.Name, schema.Name)
+	}
+	schema.Columns = append(schema.Columns[:pos:pos], schema.Columns[pos+1:]...)
+
+	indexes := schema.Indexes[:0:0]
+	var entries [][]byte
+	for _, idx := range schema.Indexes {
+		if idx.Column != col.Name {
+			indexes = append(indexes, idx)
+			continue
+		}
+		err := e.scanPrefix([]byte(indexPrefix(schema.Name, idx.Column)), func(key []byte, value []byte) error {
+			entries = append(entries, append([]byte(nil), key...))
+			return nil
+		})
+		if err != nil {
+			return schema, nil, fmt.Errorf("failed to scan index '%s': %v", idx.Name, err)
+		}
+	}
+	schema.Indexes = indexes
+	return schema, entries, nil
+}
+
+// InTransaction reports whether a BEGIN is waiting for COMMIT or ROLLBACK
+func (e *Executor) InTransaction() bool {
+	return e.txn != nil
+}
+
+// executeTransaction executes BEGIN, COMMIT and ROLLBACK. Between BEGIN and
+// COMMIT the writes of INSERT, UPDATE and DELETE are staged in one batch, seen
+// only by this executor, and COMMIT writes them as a single WAL transaction,
+// so at most BatchSize keys can change
+func (e *Executor) executeTransaction(node TransactionNode) (*QueryResult, error) {
+	switch node.Action {
+	case "BEGIN":
+		if e.txn != nil {
+			return nil, errors.New("a transaction is already in progress")
+		}
+		e.txn = bitcask.NewBatch(e.db)
+	case "COMMIT":
+		if e.txn == nil {
+			return nil, errors.New("no transaction in progress")
+		}
+		txn := e.txn
+		e.txn = nil
+		if err := txn.Commit(); err != nil {
+			// Nothing was written, the transaction is over either way
+			txn.Discard()
+			return nil, fmt.Errorf("failed to commit transaction, rolled back: %v", err)
+		}
+	case "ROLLBACK":
+		if e.txn == nil {
+			return nil, errors.New("no transaction in progress")
+		}
+		e.txn.Discard()
+		e.txn = nil
+	default:
+		return nil, fmt.Errorf("unsupported transaction statement: %s", node.Action)
+	}
+	return &QueryResult{}, nil
+}
@@ -21,6 +21,7 @@ const (
 	TokenRightParen
 	TokenEquals
 	TokenAsterisk
+	TokenPlaceholder // ? in a prepared statement
 )
 
 // Token represents a lexical token
@@ -34,28 +35,46 @@ type Token struct {
 
 // Keywords is a map of SQL keywords
 var Keywords = map[string]bool{
-	"CREATE":  true,
-	"TABLE":   true,
-	"INSERT":  true,
-	"INTO":    true,
-	"VALUES":  true,
-	"SELECT":  true,
-	"FROM":    true,
-	"WHERE":   true,
-	"AND":     true,
-	"OR":      true,
-	"NOT":     true,
-	"NULL":    true,
-	"INTEGER": true,
-	"TEXT":    true,
-	"VARCHAR": true,
-	"CHAR":    true,
-	"PRIMARY": true,
-	"KEY":     true,
-	"DELETE":  true,
-	"UPDATE":  true,
-	"SET":     true,
-	"DROP":    true,
+	"CREATE":   true,
+	"TABLE":    true,
+	"INSERT":   true,
+	"INTO":     true,
+	"VALUES":   true,
+	"SELECT":   true,
+	"FROM":     true,
+	"WHERE":    true,
+	"AND":      true,
+	"OR":       true,
+	"NOT":      true,
+	"NULL":     true,
+	"INTEGER":  true,
+	"TEXT":     true,
+	"VARCHAR":  true,
+	"CHAR":     true,
+	"PRIMARY":  true,
+	"KEY":      true,
+	"DELETE":   true,
+	"UPDATE":   true,
+	"SET":      true,
+	"DROP":     true,
+	"ORDER":    true,
+	"BY":       true,
+	"ASC":      true,
+	"DESC":     true,
+	"LIMIT":    true,
+	"OFFSET":   true,
+	"LIKE":     true,
+	"IN":       true,
+	"UNIQUE":   true,
+	"INDEX":    true,
+	"ON":       true,
+	"ALTER":    true,
+	"ADD":      true,
+	"COLUMN":   true,
+	"DISTINCT": true,
+	"BEGIN":    true,
+	"COMMIT":   true,
+	"ROLLBACK": true,
 }
 
 // Lexer is responsible for tokenizing SQL statements
@@ -130,6 +149,8 @@ func (l *Lexer) NextToken() Token {
 		tok = Token{Type: TokenEquals, Value: string(l.ch)}
 	case '*':
 		tok = Token{Type: TokenAsterisk, Value: string(l.ch)}
+	case '?':
+		tok = Token{Type: TokenPlaceholder, Value: string(l.ch)}
 	case '>':
 		if l.peekChar() == '=' {
 			l.readChar()
@@ -141,9 +162,20 @@ func (l *Lexer) NextToken() Token {
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = Token{Type: TokenOperator, Value: "<="}
+		} else if l.peekChar() == '>' {
+			// <> is the standard spelling of !=
+			l.readChar()
+			tok = Token{Type: TokenOperator, Value: "!="}
 		} else {
 			tok = Token{Type: TokenOperator, Value: "<"}
 		}
+	case '!':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = Token{Type: TokenOperator, Value: "!="}
+		} else {
+			tok = Token{Type: TokenOperator, Value: string(l.ch)}
+		}
 	case '\'', '"':
 		quote := l.ch
 		tok.Type = TokenString
@@ -160,7 +192,7 @@ func (l *Lexer) NextToken() Token {
 				tok.Type = TokenIdentifier
 			}
 			return tok
-		} else if isDigit(l.ch) {
+		} else if isDigit(l.ch) || ((l.ch == '-' || l.ch == '+') && isDigit(l.peekChar())) {
 			tok.Type = TokenNumber
 			tok.Value = l.readNumber()
 			return tok
@@ -182,25 +214,44 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[startPos:l.pos]
 }
 
-// readNumber reads a number
+// readNumber reads a number with an optional leading sign and decimal part
 func (l *Lexer) readNumber() string {
 	startPos := l.pos
+	if l.ch == '-' || l.ch == '+' {
+		l.readChar()
+	}
 	for isDigit(l.ch) {
 		l.readChar()
 	}
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
 	return l.input[startPos:l.pos]
 }
 
-// readString reads a string enclosed in quotes
+// readString reads a string enclosed in quotes. A quote character inside the
+// string is escaped either by doubling it or with a preceding backslash
 func (l *Lexer) readString(quote byte) string {
-	startPos := l.pos + 1 // Skip the opening quote
+	var sb strings.Builder
 	for {
 		l.readChar()
-		if l.ch == quote || l.ch == 0 {
+		if l.ch == 0 {
 			break
 		}
+		if l.ch == '\\' && l.peekChar() == quote {
+			l.readChar()
+		} else if l.ch == quote {
+			if l.peekChar() != quote {
+				break
+			}
+			l.readChar()
+		}
+		sb.WriteByte(l.ch)
 	}
-	return l.input[startPos:l.pos]
+	return sb.String()
 }
 
 // skipWhitespace skips whitespace characters
@@ -263,6 +314,8 @@ func TokenToString(token Token) string {
 		return "EQUALS"
 	case TokenAsterisk:
 		return "ASTERISK"
+	case TokenPlaceholder:
+		return "PLACEHOLDER"
 	default:
 		return fmt.Sprintf("UNKNOWN(%s)", token.Value)
 	}
@@ -3,6 +3,7 @@ package sql
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -16,6 +17,9 @@ const (
 	DeleteStmt      StatementType = "DELETE"
 	UpdateStmt      StatementType = "UPDATE"
 	DropTableStmt   StatementType = "DROP_TABLE"
+	CreateIndexStmt StatementType = "CREATE_INDEX"
+	AlterTableStmt  StatementType = "ALTER_TABLE"
+	TransactionStmt StatementType = "TRANSACTION"
 )
 
 // Column definition for table schema
@@ -23,6 +27,8 @@ type ColumnDef struct {
 	Name       string
 	Type       string
 	PrimaryKey bool
+	NotNull    bool
+	Unique     bool
 }
 
 // AST node interface
@@ -44,19 +50,30 @@ func (n CreateTableNode) Type() StatementType {
 func (n CreateTableNode) String() string {
 	cols := make([]string, len(n.Columns))
 	for i, col := range n.Columns {
-		pkStr := ""
-		if col.PrimaryKey {
-			pkStr = " PRIMARY KEY"
-		}
-		cols[i] = fmt.Sprintf("%s %s%s", col.Name, col.Type, pkStr)
+		cols[i] = columnDefString(col)
 	}
 	return fmt.Sprintf("CREATE TABLE %s (%s)", n.TableName, strings.Join(cols, ", "))
 }
 
+// columnDefString formats a column definition as it is written in SQL
+func columnDefString(col ColumnDef) string {
+	constraints := ""
+	if col.PrimaryKey {
+		constraints += " PRIMARY KEY"
+	}
+	if col.NotNull {
+		constraints += " NOT NULL"
+	}
+	if col.Unique {
+		constraints += " UNIQUE"
+	}
+	return fmt.Sprintf("%s %s%s", col.Name, col.Type, constraints)
+}
+
 // Insert statement AST node
 type InsertNode struct {
 	TableName string
-	Columns   []string
+	Columns   []string // empty when the statement omits the column list
 	Values    [][]string
 }
 
@@ -65,27 +82,135 @@ func (n InsertNode) Type() StatementType {
 }
 
 func (n InsertNode) String() string {
-	cols := strings.Join(n.Columns, ", ")
 	var valueStrs []string
 	for _, row := range n.Values {
 		valueStrs = append(valueStrs, "("+strings.Join(row, ", ")+")")
 	}
+	if len(n.Columns) == 0 {
+		return fmt.Sprintf("INSERT INTO %s VALUES %s", n.TableName, strings.Join(valueStrs, ", "))
+	}
+	cols := strings.Join(n.Columns, ", ")
 	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", n.TableName, cols, strings.Join(valueStrs, ", "))
 }
 
-// Condition represents a WHERE condition
+// Expr is a boolean expression in a WHERE clause
+type Expr interface {
+	String() string
+}
+
+// Condition represents a single WHERE comparison, the leaf of an Expr
 type Condition struct {
 	Left     string
 	Operator string
 	Right    string
 }
 
+func (c Condition) String() string {
+	return fmt.Sprintf("%s %s %s", c.Left, c.Operator, c.Right)
+}
+
+// InCondition represents "column IN (v1, v2, ...)"
+type InCondition struct {
+	Left   string
+	Values []string
+}
+
+func (c InCondition) String() string {
+	return fmt.Sprintf("%s IN (%s)", c.Left, strings.Join(c.Values, ", "))
+}
+
+// BinaryExpr combines two expressions with AND or OR
+type BinaryExpr struct {
+	Operator string
+	Left     Expr
+	Right    Expr
+}
+
+func (e BinaryExpr) String() string {
+	left, right := e.Left.String(), e.Right.String()
+	// OR binds looser than AND, so it needs parentheses under an AND
+	if e.Operator == "AND" {
+		if isOrExpr(e.Left) {
+			left = "(" + left + ")"
+		}
+		if isOrExpr(e.Right) {
+			right = "(" + right + ")"
+		}
+	}
+	return fmt.Sprintf("%s %s %s", left, e.Operator, right)
+}
+
+func isOrExpr(expr Expr) bool {
+	b, ok := expr.(BinaryExpr)
+	return ok && b.Operator == "OR"
+}
+
+// andConditions returns the leaf conditions joined by top-level ANDs,
+// i.e. the conditions every matching row has to satisfy
+func andConditions(expr Expr) []Condition {
+	switch e := expr.(type) {
+	case Condition:
+		return []Condition{e}
+	case BinaryExpr:
+		if e.Operator == "AND" {
+			return append(andConditions(e.Left), andConditions(e.Right)...)
+		}
+	}
+	return nil
+}
+
+// whereString renders an optional WHERE clause
+func whereString(where Expr) string {
+	if where == nil {
+		return ""
+	}
+	return " WHERE " + where.String()
+}
+
+// Aggregate is an aggregate function in the select list, such as COUNT(*)
+// or SUM(col); Column is "*" only for COUNT(*)
+type Aggregate struct {
+	Func   string
+	Column string
+}
+
+func (a Aggregate) String() string {
+	return fmt.Sprintf("%s(%s)", a.Func, a.Column)
+}
+
+// aggregateFuncs are the supported aggregate function names
+var aggregateFuncs = map[string]bool{
+	"COUNT": true,
+	"SUM":   true,
+	"AVG":   true,
+	"MIN":   true,
+	"MAX":   true,
+}
+
+// OrderTerm is a single ORDER BY column
+type OrderTerm struct {
+	Column string
+	Desc   bool
+}
+
+func (o OrderTerm) String() string {
+	if o.Desc {
+		return o.Column + " DESC"
+	}
+	return o.Column + " ASC"
+}
+
 // Select statement AST node
 type SelectNode struct {
 	Columns     []string
 	TableName   string
-	Conditions  []Condition
+	Where       Expr // nil when there is no WHERE clause
 	WildcardAll bool
+	Distinct    bool        // SELECT DISTINCT, duplicate result rows are collapsed
+	Aggregates  []Aggregate // set instead of Columns for aggregate queries
+	OrderBy     []OrderTerm
+	Limit       int // -1 when there is no LIMIT clause
+	Offset      int
 }
 
 func (n SelectNode) Type() StatementType {
@@ -96,26 +221,44 @@ func (n SelectNode) String() string {
 	var colStr string
 	if n.WildcardAll {
 		colStr = "*"
+	} else if len(n.Aggregates) > 0 {
+		aggs := make([]string, len(n.Aggregates))
+		for i, agg := range n.Aggregates {
+			aggs[i] = agg.String()
+		}
+		colStr = strings.Join(aggs, ", ")
 	} else {
 		colStr = strings.Join(n.Columns, ", ")
 	}
 
-	whereClause := ""
-	if len(n.Conditions) > 0 {
-		var condStrs []string
-		for _, cond := range n.Conditions {
-			condStrs = append(condStrs, fmt.Sprintf("%s %s %s", cond.Left, cond.Operator, cond.Right))
+	whereClause := whereString(n.Where)
+
+	orderClause := ""
+	if len(n.OrderBy) > 0 {
+		terms := make([]string, len(n.OrderBy))
+		for i, term := range n.OrderBy {
+			terms[i] = term.String()
 		}
-		whereClause = " WHERE " + strings.Join(condStrs, " AND ")
+		orderClause = " ORDER BY " + strings.Join(terms, ", ")
+	}
+	if n.Limit >= 0 {
+		orderClause += fmt.Sprintf(" LIMIT %d", n.Limit)
+	}
+	if n.Offset > 0 {
+		orderClause += fmt.Sprintf(" OFFSET %d", n.Offset)
+	}
+
+	if n.Distinct {
+		colStr = "DISTINCT " + colStr
 	}
 
-	return fmt.Sprintf("SELECT %s FROM %s%s", colStr, n.TableName, whereClause)
+	return fmt.Sprintf("SELECT %s FROM %s%s%s", colStr, n.TableName, whereClause, orderClause)
 }
 
 // Delete statement AST node
 type DeleteNode struct {
-	TableName  string
-	Conditions []Condition
+	TableName string
+	Where     Expr // nil when there is no WHERE clause
 }
 
 func (n DeleteNode) Type() StatementType {
@@ -123,24 +266,26 @@ func (n DeleteNode) Type() StatementType {
 }
 
 func (n DeleteNode) String() string {
-	whereClause := ""
-	if len(n.Conditions) > 0 {
-		var condStrs []string
-		for _, cond := range n.Conditions {
-			condStrs = append(condStrs, fmt.Sprintf("%s %s %s", cond.Left, cond.Operator, cond.Right))
-		}
-		whereClause = " WHERE " + strings.Join(condStrs, " AND ")
-	}
+	whereClause := whereString(n.Where)
 
 	return fmt.Sprintf("DELETE FROM %s%s", n.TableName, whereClause)
 }
 
 // Update statement AST node
 type UpdateNode struct {
-	TableName  string
-	Columns    []string
-	Values     []string
-	Conditions []Condition
+	TableName string
+	Columns   []string
+	Values    []string
+	Ops       []string // "+" or "-" for "col = col + n", "" for a literal value; nil when every value is a literal
+	Where     Expr     // nil when there is no WHERE clause
+}
+
+// assignment returns the i-th SET assignment's operator and value
+func (n UpdateNode) assignment(i int) (string, string) {
+	if i < len(n.Ops) {
+		return n.Ops[i], n.Values[i]
+	}
+	return "", n.Values[i]
 }
 
 func (n UpdateNode) Type() StatementType {
@@ -151,19 +296,16 @@ func (n UpdateNode) String() string {
 	// Build SET clause
 	var setStrings []string
 	for i := 0; i < len(n.Columns); i++ {
-		setStrings = append(setStrings, fmt.Sprintf("%s = %s", n.Columns[i], n.Values[i]))
+		if op, value := n.assignment(i); op != "" {
+			setStrings = append(setStrings, fmt.Sprintf("%s = %s %s %s", n.Columns[i], n.Columns[i], op, value))
+		} else {
+			setStrings = append(setStrings, fmt.Sprintf("%s = %s", n.Columns[i], value))
+		}
 	}
 	setClause := strings.Join(setStrings, ", ")
 
 	// Build WHERE clause
-	whereClause := ""
-	if len(n.Conditions) > 0 {
-		var condStrs []string
-		for _, cond := range n.Conditions {
-			condStrs = append(condStrs, fmt.Sprintf("%s %s %s", cond.Left, cond.Operator, cond.Right))
-		}
-		whereClause = " WHERE " + strings.Join(condStrs, " AND ")
-	}
+	whereClause := whereString(n.Where)
 
 	return fmt.Sprintf("UPDATE %s SET %s%s", n.TableName, setClause, whereClause)
 }
@@ -181,6 +323,53 @@ func (n DropTableNode) String() string {
 	return fmt.Sprintf("DROP TABLE %s", n.TableName)
 }
 
+// CreateIndex statement AST node
+type CreateIndexNode struct {
+	IndexName string
+	TableName string
+	Column    string
+}
+
+func (n CreateIndexNode) Type() StatementType {
+	return CreateIndexStmt
+}
+
+func (n CreateIndexNode) String() string {
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s)", n.IndexName, n.TableName, n.Column)
+}
+
+// AlterTable statement AST node, Action is ADD or DROP. Column is the full
+// definition for ADD and carries only the name for DROP
+type AlterTableNode struct {
+	TableName string
+	Action    string
+	Column    ColumnDef
+}
+
+func (n AlterTableNode) Type() StatementType {
+	return AlterTableStmt
+}
+
+func (n AlterTableNode) String() string {
+	if n.Action == "DROP" {
+		return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", n.TableName, n.Column.Name)
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", n.TableName, columnDefString(n.Column))
+}
+
+// Transaction control statement AST node, Action is BEGIN, COMMIT or ROLLBACK
+type TransactionNode struct {
+	Action string
+}
+
+func (n TransactionNode) Type() StatementType {
+	return TransactionStmt
+}
+
+func (n TransactionNode) String() string {
+	return n.Action
+}
+
 // Parser is responsible for parsing SQL tokens into an AST
 type Parser struct {
 	tokens  []Token
@@ -203,7 +392,53 @@ func Parse(sql string) (Node, error) {
 	}
 
 	parser := NewParser(tokens)
-	return parser.parseStatement()
+	return parser.parseComplete()
+}
+
+// ParseAll parses a script of statements separated by semicolons. The lexer
+// reads a quoted string as one token, so a semicolon inside a literal does
+// not end a statement; empty statements are skipped
+func ParseAll(sql string) ([]Node, error) {
+	tokens, err := TokenizeSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []Node
+	start := 0
+	for i, tok := range tokens {
+		if tok.Type != TokenSemicolon && tok.Type != TokenEOF {
+			continue
+		}
+		if i > start {
+			// Give each statement its own EOF, as Parse sees it
+			stmt := append(tokens[start:i:i], Token{Type: TokenEOF})
+			node, err := NewParser(stmt).parseComplete()
+			if err != nil {
+				return nil, fmt.Errorf("statement %d: %v", len(nodes)+1, err)
+			}
+			nodes = append(nodes, node)
+		}
+		start = i + 1
+	}
+	return nodes, nil
+}
+
+// parseComplete parses a statement that must use up all the tokens, so
+// trailing input such as "LIMIT 1 2" or a second statement is an error
+// instead of being silently dropped. One trailing semicolon is allowed
+func (p *Parser) parseComplete() (Node, error) {
+	node, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	if p.current().Type == TokenSemicolon {
+		p.advance()
+	}
+	if token := p.current(); token.Type != TokenEOF {
+		return nil, fmt.Errorf("unexpected %s after the end of the statement", TokenToString(token))
+	}
+	return node, nil
 }
 
 // parseStatement parses a SQL statement
@@ -219,6 +454,9 @@ func (p *Parser) parseStatement() (Node, error) {
 
 	switch token.Value {
 	case "CREATE":
+		if p.peek().Type == TokenKeyword && p.peek().Value == "INDEX" {
+			return p.parseCreateIndex()
+		}
 		return p.parseCreateTable()
 	case "INSERT":
 		return p.parseInsert()
@@ -230,6 +468,11 @@ func (p *Parser) parseStatement() (Node, error) {
 		return p.parseUpdate()
 	case "DROP":
 		return p.parseDropTable()
+	case "ALTER":
+		return p.parseAlterTable()
+	case "BEGIN", "COMMIT", "ROLLBACK":
+		p.advance()
+		return TransactionNode{Action: token.Value}, nil
 	default:
 		return nil, fmt.Errorf("unsupported statement type: %s", token.Value)
 	}
@@ -285,45 +528,67 @@ func (p *Parser) parseColumnDefs() ([]ColumnDef, error) {
 	columns := []ColumnDef{}
 
 	for {
-		// Get column name
-		if !p.expectType(TokenIdentifier) {
-			return nil, errors.New("expected column name")
+		col, err := p.parseColumnDef()
+		if err != nil {
+			return nil, err
 		}
-		colName := p.current().Value
-		p.advance()
+		columns = append(columns, col)
 
-		// Get column type
-		if !p.expectType(TokenIdentifier) && !p.expectType(TokenKeyword) {
-			return nil, errors.New("expected column type")
+		// Check if there are more columns
+		if p.currPos >= len(p.tokens) || p.current().Type != TokenComma {
+			break
 		}
-		colType := p.current().Value
-		p.advance()
+		p.advance() // Skip comma
+	}
+
+	return columns, nil
+}
+
+// parseColumnDef parses a single "name type [constraints]" column definition
+func (p *Parser) parseColumnDef() (ColumnDef, error) {
+	// Get column name
+	if !p.expectType(TokenIdentifier) {
+		return ColumnDef{}, errors.New("expected column name")
+	}
+	colName := p.current().Value
+	p.advance()
+
+	// Get column type
+	if !p.expectType(TokenIdentifier) && !p.expectType(TokenKeyword) {
+		return ColumnDef{}, errors.New("expected column type")
+	}
+	colType := p.current().Value
+	p.advance()
 
-		// Check for PRIMARY KEY constraint
-		isPrimaryKey := false
-		if p.currPos < len(p.tokens) && p.current().Type == TokenKeyword && p.current().Value == "PRIMARY" {
+	col := ColumnDef{Name: colName, Type: colType}
+
+	// Check for PRIMARY KEY, NOT NULL and UNIQUE constraints, in any order
+constraints:
+	for {
+		switch {
+		case p.expectKeyword("PRIMARY"):
 			p.advance()
 			if !p.expectKeyword("KEY") {
-				return nil, errors.New("expected KEY after PRIMARY")
+				return ColumnDef{}, errors.New("expected KEY after PRIMARY")
 			}
 			p.advance()
-			isPrimaryKey = true
-		}
-
-		columns = append(columns, ColumnDef{
-			Name:       colName,
-			Type:       colType,
-			PrimaryKey: isPrimaryKey,
-		})
-
-		// Check if there are more columns
-		if p.currPos >= len(p.tokens) || p.current().Type != TokenComma {
-			break
+			col.PrimaryKey = true
+		case p.expectKeyword("NOT"):
+			p.advance()
+			if !p.expectKeyword("NULL") {
+				return ColumnDef{}, errors.New("expected NULL after NOT")
+			}
+			p.advance()
+			col.NotNull = true
+		case p.expectKeyword("UNIQUE"):
+			p.advance()
+			col.Unique = true
+		default:
+			break constraints
 		}
-		p.advance() // Skip comma
 	}
 
-	return columns, nil
+	return col, nil
 }
 
 // parseInsert parses an INSERT statement
@@ -347,30 +612,32 @@ func (p *Parser) parseInsert() (Node, error) {
 	tableName := p.current().Value
 	p.advance()
 
-	// Parse column list
-	if !p.expectType(TokenLeftParen) {
-		return nil, errors.New("expected ( after table name")
-	}
-	p.advance()
-
-	columns := []string{}
-	for {
-		if !p.expectType(TokenIdentifier) {
-			return nil, errors.New("expected column name")
-		}
-		columns = append(columns, p.current().Value)
+	// Parse the optional column list; without it the values follow the
+	// table's declared column order
+	var columns []string
+	if p.current().Type == TokenLeftParen {
 		p.advance()
 
-		if p.current().Type == TokenRightParen {
-			break
-		}
+		for {
+			if !p.expectType(TokenIdentifier) {
+				return nil, errors.New("expected column name")
+			}
+			columns = append(columns, p.current().Value)
+			p.advance()
 
-		if !p.expectType(TokenComma) {
-			return nil, errors.New("expected comma between column names")
+			if p.current().Type == TokenRightParen {
+				break
+			}
+
+			if !p.expectType(TokenComma) {
+				return nil, errors.New("expected comma between column names")
+			}
+			p.advance()
 		}
-		p.advance()
+		p.advance() // Skip )
+	} else if !p.expectKeyword("VALUES") {
+		return nil, errors.New("expected ( or VALUES after table name")
 	}
-	p.advance() // Skip )
 
 	// Verify "VALUES"
 	if !p.expectKeyword("VALUES") {
@@ -430,8 +697,15 @@ func (p *Parser) parseSelect() (Node, error) {
 	}
 	p.advance()
 
-	// Parse column list or *
+	distinct := false
+	if p.expectKeyword("DISTINCT") {
+		distinct = true
+		p.advance()
+	}
+
+	// Parse column list, aggregate list or *
 	columns := []string{}
+	var aggregates []Aggregate
 	wildcardAll := false
 
 	if p.current().Type == TokenAsterisk {
@@ -442,8 +716,16 @@ func (p *Parser) parseSelect() (Node, error) {
 			if !p.expectType(TokenIdentifier) {
 				return nil, errors.New("expected column name")
 			}
-			columns = append(columns, p.current().Value)
-			p.advance()
+			if p.isAggregateCall() {
+				agg, err := p.parseAggregate()
+				if err != nil {
+					return nil, err
+				}
+				aggregates = append(aggregates, agg)
+			} else {
+				columns = append(columns, p.current().Value)
+				p.advance()
+			}
 
 			if p.currPos >= len(p.tokens) || p.current().Type != TokenComma {
 				break
@@ -452,6 +734,12 @@ func (p *Parser) parseSelect() (Node, error) {
 		}
 	}
 
+	// Without GROUP BY an aggregate query returns a single row, so plain
+	// columns cannot be selected alongside aggregates
+	if len(aggregates) > 0 && len(columns) > 0 {
+		return nil, errors.New("cannot mix aggregate functions and plain columns")
+	}
+
 	// Verify "FROM"
 	if !p.expectKeyword("FROM") {
 		return nil, errors.New("expected FROM keyword")
@@ -466,72 +754,160 @@ func (p *Parser) parseSelect() (Node, error) {
 	p.advance()
 
 	// Parse WHERE clause if present
-	conditions := []Condition{}
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
+	}
 
-	// Check if there's a WHERE clause and we haven't reached EOF
-	if p.currPos < len(p.tokens) && p.current().Type == TokenKeyword && p.current().Value == "WHERE" {
+	// Parse ORDER BY clause if present
+	orderBy, err := p.parseOrderBy()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse LIMIT and OFFSET clauses if present
+	limit := -1
+	if p.expectKeyword("LIMIT") {
+		p.advance()
+		if limit, err = p.parseCount("LIMIT"); err != nil {
+			return nil, err
+		}
+	}
+	offset := 0
+	if p.expectKeyword("OFFSET") {
 		p.advance()
+		if offset, err = p.parseCount("OFFSET"); err != nil {
+			return nil, err
+		}
+	}
 
-		// Check if we still have tokens
-		if p.currPos >= len(p.tokens) {
-			return nil, errors.New("unexpected end of input after WHERE")
+	return SelectNode{
+		Columns:     columns,
+		TableName:   tableName,
+		Where:       where,
+		WildcardAll: wildcardAll,
+		Distinct:    distinct,
+		Aggregates:  aggregates,
+		OrderBy:     orderBy,
+		Limit:       limit,
+		Offset:      offset,
+	}, nil
+}
+
+// isAggregateCall reports whether the current identifier starts an aggregate
+// function call such as COUNT(
+func (p *Parser) isAggregateCall() bool {
+	return p.expectType(TokenIdentifier) &&
+		aggregateFuncs[strings.ToUpper(p.current().Value)] &&
+		p.currPos+1 < len(p.tokens) &&
+		p.tokens[p.currPos+1].Type == TokenLeftParen
+}
+
+// parseAggregate parses FUNC(col) or COUNT(*)
+func (p *Parser) parseAggregate() (Aggregate, error) {
+	agg := Aggregate{Func: strings.ToUpper(p.current().Value)}
+	p.advance()
+	p.advance() // Skip (
+
+	if p.expectType(TokenAsterisk) {
+		if agg.Func != "COUNT" {
+			return Aggregate{}, fmt.Errorf("%s(*) is not supported", agg.Func)
 		}
+		agg.Column = "*"
+	} else if p.expectType(TokenIdentifier) {
+		agg.Column = p.current().Value
+	} else {
+		return Aggregate{}, fmt.Errorf("expected column name in %s(), got %s", agg.Func, TokenToString(p.current()))
+	}
+	p.advance()
 
-		// Get the left side of the condition
-		if !p.expectType(TokenIdentifier) {
-			return nil, fmt.Errorf("expected column name in WHERE clause, got %s", TokenToString(p.current()))
+	if !p.expectType(TokenRightParen) {
+		return Aggregate{}, fmt.Errorf("expected ) after %s argument", agg.Func)
+	}
+	p.advance()
+
+	return agg, nil
+}
+
+// parseInList parses the parenthesized value list following IN
+func (p *Parser) parseInList(left string) (Expr, error) {
+	if !p.expectType(TokenLeftParen) {
+		return nil, fmt.Errorf("expected ( after IN, got %s", TokenToString(p.current()))
+	}
+	p.advance()
+
+	cond := InCondition{Left: left}
+	for {
+		if !p.expectType(TokenString) && !p.expectType(TokenNumber) {
+			return nil, fmt.Errorf("expected string or number value in IN list, got %s", TokenToString(p.current()))
 		}
-		left := p.current().Value
+		cond.Values = append(cond.Values, p.current().Value)
 		p.advance()
 
-		// Check we still have tokens for the operator
-		if p.currPos >= len(p.tokens) {
-			return nil, errors.New("unexpected end of input, expected operator")
+		// Check if there are more values
+		if !p.expectType(TokenComma) {
+			break
 		}
+		p.advance() // Skip comma
+	}
 
-		// Get the operator
-		if p.current().Type != TokenEquals && p.current().Type != TokenOperator {
-			return nil, fmt.Errorf("expected comparison operator in WHERE clause, got %s", TokenToString(p.current()))
-		}
+	if !p.expectType(TokenRightParen) {
+		return nil, fmt.Errorf("expected ) after IN list, got %s", TokenToString(p.current()))
+	}
+	p.advance()
 
-		var operator string
-		if p.current().Type == TokenEquals {
-			operator = "="
-		} else {
-			operator = p.current().Value
+	return cond, nil
+}
+
+// parseOrderBy parses an optional ORDER BY col [ASC|DESC], ... clause
+func (p *Parser) parseOrderBy() ([]OrderTerm, error) {
+	if !p.expectKeyword("ORDER") {
+		return nil, nil
+	}
+	p.advance()
+
+	if !p.expectKeyword("BY") {
+		return nil, errors.New("expected BY after ORDER")
+	}
+	p.advance()
+
+	var terms []OrderTerm
+	for {
+		if !p.expectType(TokenIdentifier) {
+			return nil, fmt.Errorf("expected column name in ORDER BY clause, got %s", TokenToString(p.current()))
 		}
+		term := OrderTerm{Column: p.current().Value}
 		p.advance()
 
-		// Check we still have tokens for the value
-		if p.currPos >= len(p.tokens) {
-			return nil, errors.New("unexpected end of input, expected value")
+		if p.expectKeyword("DESC") {
+			term.Desc = true
+			p.advance()
+		} else if p.expectKeyword("ASC") {
+			p.advance()
 		}
+		terms = append(terms, term)
 
-		// Get the value
-		var right string
-		if p.current().Type == TokenString {
-			right = p.current().Value
-		} else if p.current().Type == TokenNumber {
-			right = p.current().Value
-		} else {
-			return nil, fmt.Errorf("expected string or number value in WHERE clause, got %s", TokenToString(p.current()))
+		// Check if there are more order terms
+		if !p.expectType(TokenComma) {
+			break
 		}
-		p.advance()
-
-		// Add the condition
-		conditions = append(conditions, Condition{
-			Left:     left,
-			Operator: operator,
-			Right:    right,
-		})
+		p.advance() // Skip comma
 	}
 
-	return SelectNode{
-		Columns:     columns,
-		TableName:   tableName,
-		Conditions:  conditions,
-		WildcardAll: wildcardAll,
-	}, nil
+	return terms, nil
+}
+
+// parseCount parses the non-negative integer following LIMIT or OFFSET
+func (p *Parser) parseCount(clause string) (int, error) {
+	if !p.expectType(TokenNumber) {
+		return 0, fmt.Errorf("expected number after %s, got %s", clause, TokenToString(p.current()))
+	}
+	n, err := strconv.Atoi(p.current().Value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s value: %s", clause, p.current().Value)
+	}
+	p.advance()
+	return n, nil
 }
 
 // parseDelete parses a DELETE statement
@@ -556,69 +932,14 @@ func (p *Parser) parseDelete() (Node, error) {
 	p.advance()
 
 	// Parse WHERE clause if present
-	conditions := []Condition{}
-
-	// Check if there's a WHERE clause and we haven't reached EOF
-	if p.currPos < len(p.tokens) && p.current().Type == TokenKeyword && p.current().Value == "WHERE" {
-		p.advance()
-
-		// Check if we still have tokens
-		if p.currPos >= len(p.tokens) {
-			return nil, errors.New("unexpected end of input after WHERE")
-		}
-
-		// Get the left side of the condition
-		if !p.expectType(TokenIdentifier) {
-			return nil, fmt.Errorf("expected column name in WHERE clause, got %s", TokenToString(p.current()))
-		}
-		left := p.current().Value
-		p.advance()
-
-		// Check we still have tokens for the operator
-		if p.currPos >= len(p.tokens) {
-			return nil, errors.New("unexpected end of input, expected operator")
-		}
-
-		// Get the operator
-		if p.current().Type != TokenEquals && p.current().Type != TokenOperator {
-			return nil, fmt.Errorf("expected comparison operator in WHERE clause, got %s", TokenToString(p.current()))
-		}
-
-		var operator string
-		if p.current().Type == TokenEquals {
-			operator = "="
-		} else {
-			operator = p.current().Value
-		}
-		p.advance()
-
-		// Check we still have tokens for the value
-		if p.currPos >= len(p.tokens) {
-			return nil, errors.New("unexpected end of input, expected value")
-		}
-
-		// Get the value
-		var right string
-		if p.current().Type == TokenString {
-			right = p.current().Value
-		} else if p.current().Type == TokenNumber {
-			right = p.current().Value
-		} else {
-			return nil, fmt.Errorf("expected string or number value in WHERE clause, got %s", TokenToString(p.current()))
-		}
-		p.advance()
-
-		// Add the condition
-		conditions = append(conditions, Condition{
-			Left:     left,
-			Operator: operator,
-			Right:    right,
-		})
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
 	}
 
 	return DeleteNode{
-		TableName:  tableName,
-		Conditions: conditions,
+		TableName: tableName,
+		Where:     where,
 	}, nil
 }
 
@@ -646,13 +967,16 @@ func (p *Parser) parseUpdate() (Node, error) {
 	// Parse SET assignments
 	columns := []string{}
 	values := []string{}
+	ops := []string{}
+	hasExpr := false
 
 	for {
 		// Get column name
 		if !p.expectType(TokenIdentifier) {
 			return nil, errors.New("expected column name")
 		}
-		columns = append(columns, p.current().Value)
+		column := p.current().Value
+		columns = append(columns, column)
 		p.advance()
 
 		// Verify equals sign
@@ -661,12 +985,23 @@ func (p *Parser) parseUpdate() (Node, error) {
 		}
 		p.advance()
 
-		// Get value
-		if !p.expectType(TokenString) && !p.expectType(TokenNumber) {
+		// Get value: a literal, or the column itself plus or minus a number
+		switch {
+		case p.expectType(TokenString) || p.expectType(TokenNumber):
+			values = append(values, p.current().Value)
+			ops = append(ops, "")
+			p.advance()
+		case p.expectType(TokenIdentifier):
+			op, value, err := p.parseColumnArithmetic(column)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			ops = append(ops, op)
+			hasExpr = true
+		default:
 			return nil, errors.New("expected value after =")
 		}
-		values = append(values, p.current().Value)
-		p.advance()
 
 		// Check if there are more assignments
 		if p.currPos >= len(p.tokens) || p.current().Type != TokenComma {
@@ -676,71 +1011,184 @@ func (p *Parser) parseUpdate() (Node, error) {
 	}
 
 	// Parse WHERE clause if present
-	conditions := []Condition{}
+	where, err := p.parseWhere()
+	if err != nil {
+		return nil, err
+	}
 
-	// Check if there's a WHERE clause and we haven't reached EOF
-	if p.currPos < len(p.tokens) && p.current().Type == TokenKeyword && p.current().Value == "WHERE" {
-		p.advance()
+	node := UpdateNode{
+		TableName: tableName,
+		Columns:   columns,
+		Values:    values,
+		Where:     where,
+	}
+	if hasExpr {
+		node.Ops = ops
+	}
+	return node, nil
+}
 
-		// Check if we still have tokens
-		if p.currPos >= len(p.tokens) {
-			return nil, errors.New("unexpected end of input after WHERE")
-		}
+// parseColumnArithmetic parses the "col + n" or "col - n" right-hand side of
+// a SET assignment, where col must be the column being assigned
+func (p *Parser) parseColumnArithmetic(column string) (string, string, error) {
+	if !strings.EqualFold(p.current().Value, column) {
+		return "", "", fmt.Errorf("SET expression for column '%s' can only reference '%s', got '%s'", column, column, p.current().Value)
+	}
+	p.advance()
 
-		// Get the left side of the condition
-		if !p.expectType(TokenIdentifier) {
-			return nil, fmt.Errorf("expected column name in WHERE clause, got %s", TokenToString(p.current()))
+	switch {
+	case p.expectType(TokenOperator) && (p.current().Value == "+" || p.current().Value == "-"):
+		op := p.current().Value
+		p.advance()
+		if !p.expectType(TokenNumber) {
+			return "", "", fmt.Errorf("expected number after %s %s, got %s", column, op, TokenToString(p.current()))
 		}
-		left := p.current().Value
+		value := p.current().Value
 		p.advance()
+		return op, value, nil
+	case p.expectType(TokenNumber) && (p.current().Value[0] == '+' || p.current().Value[0] == '-'):
+		// "col-1" is lexed as the column followed by the signed number -1
+		value := p.current().Value
+		p.advance()
+		return value[:1], value[1:], nil
+	default:
+		return "", "", fmt.Errorf("expected + or - after %s in SET expression, got %s", column, TokenToString(p.current()))
+	}
+}
 
-		// Check we still have tokens for the operator
-		if p.currPos >= len(p.tokens) {
-			return nil, errors.New("unexpected end of input, expected operator")
-		}
+// parseWhere parses an optional WHERE clause into an expression tree,
+// returning nil when the clause is absent
+func (p *Parser) parseWhere() (Expr, error) {
+	// Check if there's a WHERE clause and we haven't reached EOF
+	if !p.expectKeyword("WHERE") {
+		return nil, nil
+	}
+	p.advance()
 
-		// Get the operator
-		if p.current().Type != TokenEquals && p.current().Type != TokenOperator {
-			return nil, fmt.Errorf("expected comparison operator in WHERE clause, got %s", TokenToString(p.current()))
-		}
+	return p.parseOr()
+}
 
-		var operator string
-		if p.current().Type == TokenEquals {
-			operator = "="
-		} else {
-			operator = p.current().Value
-		}
-		p.advance()
+// parseOr parses OR-separated terms; OR has the lowest precedence
+func (p *Parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
 
-		// Check we still have tokens for the value
-		if p.currPos >= len(p.tokens) {
-			return nil, errors.New("unexpected end of input, expected value")
+	for p.expectKeyword("OR") {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
 		}
+		left = BinaryExpr{Operator: "OR", Left: left, Right: right}
+	}
 
-		// Get the value
-		var right string
-		if p.current().Type == TokenString {
-			right = p.current().Value
-		} else if p.current().Type == TokenNumber {
-			right = p.current().Value
-		} else {
-			return nil, fmt.Errorf("expected string or number value in WHERE clause, got %s", TokenToString(p.current()))
+	return left, nil
+}
+
+// parseAnd parses AND-separated factors
+func (p *Parser) parseAnd() (Expr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.expectKeyword("AND") {
+		p.advance()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
 		}
+		left = BinaryExpr{Operator: "AND", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+// parsePrimary parses a parenthesized expression or a single condition
+func (p *Parser) parsePrimary() (Expr, error) {
+	if !p.expectType(TokenLeftParen) {
+		return p.parseCondition()
+	}
+	p.advance()
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.expectType(TokenRightParen) {
+		return nil, fmt.Errorf("expected ) in WHERE clause, got %s", TokenToString(p.current()))
+	}
+	p.advance()
+
+	return expr, nil
+}
+
+// parseCondition parses a single "column operator value" or
+// "column IN (values)" condition
+func (p *Parser) parseCondition() (Expr, error) {
+	// Check if we still have tokens
+	if p.currPos >= len(p.tokens) || p.current().Type == TokenEOF {
+		return nil, errors.New("unexpected end of input in WHERE clause")
+	}
+
+	// Get the left side of the condition
+	if !p.expectType(TokenIdentifier) {
+		return nil, fmt.Errorf("expected column name in WHERE clause, got %s", TokenToString(p.current()))
+	}
+	left := p.current().Value
+	p.advance()
+
+	// IN takes a value list instead of an operator and a single value
+	if p.expectKeyword("IN") {
 		p.advance()
+		return p.parseInList(left)
+	}
+
+	// Check we still have tokens for the operator
+	if p.currPos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of input, expected operator")
+	}
+
+	// Get the operator
+	var operator string
+	switch {
+	case p.current().Type == TokenEquals:
+		operator = "="
+	case p.current().Type == TokenOperator:
+		operator = p.current().Value
+	case p.expectKeyword("LIKE"):
+		operator = "LIKE"
+	default:
+		return nil, fmt.Errorf("expected comparison operator in WHERE clause, got %s", TokenToString(p.current()))
+	}
+	p.advance()
+
+	// Check we still have tokens for the value
+	if p.currPos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of input, expected value")
+	}
 
-		// Add the condition
-		conditions = append(conditions, Condition{
-			Left:     left,
-			Operator: operator,
-			Right:    right,
-		})
+	// Get the value; LIKE only takes a quoted pattern
+	if operator == "LIKE" && p.current().Type != TokenString {
+		return nil, fmt.Errorf("expected string pattern after LIKE, got %s", TokenToString(p.current()))
+	}
+	var right string
+	if p.current().Type == TokenString {
+		right = p.current().Value
+	} else if p.current().Type == TokenNumber {
+		right = p.current().Value
+	} else {
+		return nil, fmt.Errorf("expected string or number value in WHERE clause, got %s", TokenToString(p.current()))
 	}
+	p.advance()
 
-	return UpdateNode{
-		TableName:  tableName,
-		Columns:    columns,
-		Values:     values,
-		Conditions: conditions,
+	return Condition{
+		Left:     left,
+		Operator: operator,
+		Right:    right,
 	}, nil
 }
 
@@ -770,6 +1218,108 @@ func (p *Parser) parseDropTable() (Node, error) {
 	}, nil
 }
 
+// parseAlterTable parses ALTER TABLE ... ADD [COLUMN] name type [constraints]
+// and ALTER TABLE ... DROP [COLUMN] name
+func (p *Parser) parseAlterTable() (Node, error) {
+	// Verify "ALTER TABLE"
+	if !p.expectKeyword("ALTER") {
+		return nil, errors.New("expected ALTER keyword")
+	}
+	p.advance()
+	if !p.expectKeyword("TABLE") {
+		return nil, errors.New("expected TABLE keyword")
+	}
+	p.advance()
+
+	// Get table name
+	if !p.expectType(TokenIdentifier) {
+		return nil, errors.New("expected table name")
+	}
+	tableName := p.current().Value
+	p.advance()
+
+	// Get the action, COLUMN is optional after it
+	if !p.expectKeyword("ADD") && !p.expectKeyword("DROP") {
+		return nil, errors.New("expected ADD or DROP after table name")
+	}
+	action := p.current().Value
+	p.advance()
+	if p.expectKeyword("COLUMN") {
+		p.advance()
+	}
+
+	node := AlterTableNode{TableName: tableName, Action: action}
+	if action == "ADD" {
+		col, err := p.parseColumnDef()
+		if err != nil {
+			return nil, err
+		}
+		node.Column = col
+	} else {
+		if !p.expectType(TokenIdentifier) {
+			return nil, errors.New("expected column name")
+		}
+		node.Column = ColumnDef{Name: p.current().Value}
+		p.advance()
+	}
+
+	return node, nil
+}
+
+// parseCreateIndex parses a CREATE INDEX statement
+func (p *Parser) parseCreateIndex() (Node, error) {
+	// Verify "CREATE INDEX"
+	if !p.expectKeyword("CREATE") {
+		return nil, errors.New("expected CREATE keyword")
+	}
+	p.advance()
+	if !p.expectKeyword("INDEX") {
+		return nil, errors.New("expected INDEX keyword")
+	}
+	p.advance()
+
+	// Get index name
+	if !p.expectType(TokenIdentifier) {
+		return nil, errors.New("expected index name")
+	}
+	indexName := p.current().Value
+	p.advance()
+
+	// Verify "ON"
+	if !p.expectKeyword("ON") {
+		return nil, errors.New("expected ON keyword")
+	}
+	p.advance()
+
+	// Get table name
+	if !p.expectType(TokenIdentifier) {
+		return nil, errors.New("expected table name")
+	}
+	tableName := p.current().Value
+	p.advance()
+
+	// Parse the single indexed column
+	if !p.expectType(TokenLeftParen) {
+		return nil, errors.New("expected ( after table name")
+	}
+	p.advance()
+	if !p.expectType(TokenIdentifier) {
+		return nil, errors.New("expected column name")
+	}
+	column := p.current().Value
+	p.advance()
+	if !p.expectType(TokenRightParen) {
+		return nil, errors.New("expected ) after column name, only single-column indexes are supported")
+	}
+	p.advance()
+
+	return CreateIndexNode{
+		IndexName: indexName,
+		TableName: tableName,
+		Column:    column,
+	}, nil
+}
+
 // Helper methods
 
 func (p *Parser) current() Token {
@@ -779,6 +1329,14 @@ func (p *Parser) current() Token {
 	return p.tokens[p.currPos]
 }
 
+// peek returns the token after the current one
+func (p *Parser) peek() Token {
+	if p.currPos+1 >= len(p.tokens) {
+		return Token{Type: TokenEOF}
+	}
+	return p.tokens[p.currPos+1]
+}
+
 func (p *Parser) advance() {
 	p.currPos++
 }
@@ -0,0 +1,89 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Stmt is a statement prepared by Executor.Prepare. Its ? placeholders are
+// bound to arguments at execution as literal tokens, so a bound value is
+// never lexed: it can hold quotes or any other text without changing the
+// statement
+type Stmt struct {
+	executor *Executor
+	tokens   []Token
+	params   int
+}
+
+// Prepare tokenizes sql once for repeated execution with different
+// arguments. Each ? stands for one value; syntax errors are reported by
+// Execute, once the placeholders are bound
+func (e *Executor) Prepare(sql string) (*Stmt, error) {
+	tokens, err := TokenizeSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+	params := 0
+	for _, tok := range tokens {
+		if tok.Type == TokenPlaceholder {
+			params++
+		}
+	}
+	return &Stmt{executor: e, tokens: tokens, params: params}, nil
+}
+
+// NumParams returns the number of ? placeholders in the statement
+func (s *Stmt) NumParams() int {
+	return s.params
+}
+
+// Execute binds args to the placeholders in order and executes the
+// statement. Strings and byte slices bind as string literals, integers and
+// floats as numbers, and booleans as the strings "true" and "false"
+func (s *Stmt) Execute(args ...interface{}) (*QueryResult, error) {
+	if len(args) != s.params {
+		return nil, fmt.Errorf("statement expects %d arguments, got %d", s.params, len(args))
+	}
+
+	tokens := make([]Token, len(s.tokens))
+	copy(tokens, s.tokens)
+	next := 0
+	for i, tok := range tokens {
+		if tok.Type != TokenPlaceholder {
+			continue
+		}
+		bound, err := bindArg(args[next])
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %v", next+1, err)
+		}
+		bound.Line, bound.Column = tok.Line, tok.Column
+		tokens[i] = bound
+		next++
+	}
+
+	node, err := NewParser(tokens).parseComplete()
+	if err != nil {
+		return nil, err
+	}
+	return s.executor.Execute(node)
+}
+
+// bindArg converts an argument to the literal token it stands for
+func bindArg(arg interface{}) (Token, error) {
+	switch v := arg.(type) {
+	case string:
+		return Token{Type: TokenString, Value: v}, nil
+	case []byte:
+		return Token{Type: TokenString, Value: string(v)}, nil
+	case bool:
+		return Token{Type: TokenString, Value: strconv.FormatBool(v)}, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return Token{Type: TokenNumber, Value: fmt.Sprint(v)}, nil
+	case float32:
+		return Token{Type: TokenNumber, Value: strconv.FormatFloat(float64(v), 'f', -1, 32)}, nil
+	case float64:
+		return Token{Type: TokenNumber, Value: strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	default:
+		return Token{}, fmt.Errorf("unsupported argument type %T", arg)
+	}
+}
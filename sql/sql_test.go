@@ -1,8 +1,10 @@
 package sql
 
 import (
+	"encoding/json"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/aixiasang/bitcask"
@@ -129,6 +131,75 @@ func TestTokenization(t *testing.T) {
 	}
 }
 
+func TestTokenizeLiterals(t *testing.T) {
+	testCases := []struct {
+		sql       string
+		tokenType TokenType
+		value     string
+	}{
+		{"'a''b'", TokenString, "a'b"},
+		{"'O''Brien'", TokenString, "O'Brien"},
+		{`'it\'s'`, TokenString, "it's"},
+		{`"say ""hi"""`, TokenString, `say "hi"`},
+		{"''", TokenString, ""},
+		{"-42", TokenNumber, "-42"},
+		{"+7", TokenNumber, "+7"},
+		{"3.14", TokenNumber, "3.14"},
+		{"-0.5", TokenNumber, "-0.5"},
+	}
+
+	for _, tc := range testCases {
+		tokens, err := TokenizeSQL(tc.sql)
+		if err != nil {
+			t.Fatalf("Failed to tokenize %s: %v", tc.sql, err)
+		}
+		// The literal followed by EOF
+		if len(tokens) != 2 || tokens[0].Type != tc.tokenType || tokens[0].Value != tc.value {
+			t.Fatalf("Tokenizing %s: expected %s(%s), got %v", tc.sql, TokenToString(Token{Type: tc.tokenType}), tc.value, tokens)
+		}
+	}
+
+	// A dot not followed by a digit is not part of the number
+	tokens, err := TokenizeSQL("5.")
+	if err != nil {
+		t.Fatalf("Failed to tokenize: %v", err)
+	}
+	if tokens[0].Type != TokenNumber || tokens[0].Value != "5" {
+		t.Fatalf("Expected NUMBER(5), got %v", tokens)
+	}
+
+	// End to end: escaped quotes and signed decimals round-trip through the executor
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+	executor := NewExecutor(bc)
+	for _, sql := range []string{
+		"CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, score TEXT)",
+		"INSERT INTO t (id, name, score) VALUES (1, 'O''Brien', -5), (2, 'it''s', 3.14), (3, 'plain', 10)",
+	} {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		if _, err := executor.Execute(node); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+	node, err := Parse("SELECT name FROM t WHERE score < 3.5 AND score > -10 ORDER BY score")
+	if err != nil {
+		t.Fatalf("Failed to parse SELECT: %v", err)
+	}
+	result, err := executor.Execute(node)
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if len(result.Rows) != 2 || result.Rows[0]["name"] != "O'Brien" || result.Rows[1]["name"] != "it's" {
+		t.Fatalf("Unexpected rows: %v", result.Rows)
+	}
+}
+
 func TestParsing(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -152,6 +223,24 @@ func TestParsing(t *testing.T) {
 			}
 		})
 	}
+
+	// A statement must use up the input; one trailing semicolon is allowed
+	if _, err := Parse("SELECT * FROM users;"); err != nil {
+		t.Fatalf("Failed to parse a statement ending in a semicolon: %v", err)
+	}
+	for _, sql := range []string{
+		"SELECT * FROM users LIMIT 1 2",
+		"SELECT * FROM users WHERE id = 1 name",
+		"DELETE FROM users; DROP TABLE users",
+		"COMMIT now",
+	} {
+		if _, err := Parse(sql); err == nil {
+			t.Fatalf("Expected trailing tokens to fail for %q", sql)
+		}
+	}
+	if _, err := ParseAll("SELECT * FROM users; SELECT * FROM users ORDER BY id id"); err == nil || !strings.Contains(err.Error(), "statement 2") {
+		t.Fatalf("Expected trailing tokens to fail statement 2, got %v", err)
+	}
 }
 
 func TestBasicSQLFunctionality(t *testing.T) {
@@ -472,3 +561,1724 @@ func TestExtendedSQLStatements(t *testing.T) {
 		}
 	})
 }
+
+func TestParseWhereAndConditions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sql      string
+		expected []Condition
+	}{
+		{
+			"Select Two Conditions",
+			"SELECT * FROM users WHERE age > 20 AND age < 40",
+			[]Condition{{"age", ">", "20"}, {"age", "<", "40"}},
+		},
+		{
+			"Select Three Conditions",
+			"SELECT id FROM users WHERE age > 20 AND name = 'Bob' AND id < 3",
+			[]Condition{{"age", ">", "20"}, {"name", "=", "Bob"}, {"id", "<", "3"}},
+		},
+		{
+			"Delete Two Conditions",
+			"DELETE FROM users WHERE age > 20 AND name = 'Bob'",
+			[]Condition{{"age", ">", "20"}, {"name", "=", "Bob"}},
+		},
+		{
+			"Update Three Conditions",
+			"UPDATE users SET name = 'Bob' WHERE id > 1 AND id < 5 AND age = 30",
+			[]Condition{{"id", ">", "1"}, {"id", "<", "5"}, {"age", "=", "30"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := Parse(tc.sql)
+			if err != nil {
+				t.Fatalf("Failed to parse SQL: %v", err)
+			}
+
+			var conditions []Condition
+			switch n := node.(type) {
+			case SelectNode:
+				conditions = andConditions(n.Where)
+			case DeleteNode:
+				conditions = andConditions(n.Where)
+			case UpdateNode:
+				conditions = andConditions(n.Where)
+			default:
+				t.Fatalf("Unexpected node type %s", node.Type())
+			}
+
+			if len(conditions) != len(tc.expected) {
+				t.Fatalf("Expected %d conditions, got %d: %v", len(tc.expected), len(conditions), conditions)
+			}
+			for i, cond := range conditions {
+				if cond != tc.expected[i] {
+					t.Fatalf("Condition %d: expected %v, got %v", i, tc.expected[i], cond)
+				}
+			}
+		})
+	}
+
+	// A dangling AND is an error rather than being ignored
+	if _, err := Parse("SELECT * FROM users WHERE age > 20 AND"); err == nil {
+		t.Fatalf("Expected error for dangling AND")
+	}
+}
+
+func TestExecuteWhereAndConditions(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	statements := []string{
+		"CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, age INTEGER)",
+		"INSERT INTO people (id, name, age) VALUES (1, 'Young', 18)",
+		"INSERT INTO people (id, name, age) VALUES (2, 'Middle', 30)",
+		"INSERT INTO people (id, name, age) VALUES (3, 'Old', 50)",
+	}
+	for _, sql := range statements {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		if _, err := executor.Execute(node); err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+	}
+
+	// Rows 1 and 3 each match only one of the two conditions
+	node, err := Parse("SELECT * FROM people WHERE age > 20 AND age < 40")
+	if err != nil {
+		t.Fatalf("Failed to parse SELECT: %v", err)
+	}
+	result, err := executor.Execute(node)
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0]["name"] != "Middle" {
+		t.Fatalf("Expected only Middle, got %v", result.Rows)
+	}
+
+	// DELETE only removes rows matching both conditions
+	node, err = Parse("DELETE FROM people WHERE age > 20 AND name = 'Old'")
+	if err != nil {
+		t.Fatalf("Failed to parse DELETE: %v", err)
+	}
+	if _, err := executor.Execute(node); err != nil {
+		t.Fatalf("Failed to execute DELETE: %v", err)
+	}
+	node, _ = Parse("SELECT * FROM people")
+	result, err = executor.Execute(node)
+	if err != nil {
+		t.Fatalf("Failed to execute SELECT: %v", err)
+	}
+	if len(result.Rows) != 2 {
+		t.Fatalf("Expected 2 rows after DELETE, got %d", len(result.Rows))
+	}
+}
+
+func TestParseWhereOr(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sql      string
+		expected string
+	}{
+		{"Simple OR", "SELECT * FROM t WHERE a = 1 OR b = 2", "a = 1 OR b = 2"},
+		{"AND Binds Tighter", "SELECT * FROM t WHERE a = 1 OR b = 2 AND c > 0", "a = 1 OR b = 2 AND c > 0"},
+		{"Parentheses", "SELECT * FROM t WHERE (a = 1 OR a = 2) AND c > 0", "(a = 1 OR a = 2) AND c > 0"},
+		{"Nested Parentheses", "DELETE FROM t WHERE ((a <= 1) OR (a >= 5 AND b < 2))", "a <= 1 OR a >= 5 AND b < 2"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := Parse(tc.sql)
+			if err != nil {
+				t.Fatalf("Failed to parse SQL: %v", err)
+			}
+			var where Expr
+			switch n := node.(type) {
+			case SelectNode:
+				where = n.Where
+			case DeleteNode:
+				where = n.Where
+			}
+			if where == nil || where.String() != tc.expected {
+				t.Fatalf("Expected WHERE %q, got %v", tc.expected, where)
+			}
+		})
+	}
+
+	// AND binds tighter than OR: the root of "a OR b AND c" is the OR
+	node, _ := Parse("SELECT * FROM t WHERE a = 1 OR b = 2 AND c > 0")
+	root, ok := node.(SelectNode).Where.(BinaryExpr)
+	if !ok || root.Operator != "OR" {
+		t.Fatalf("Expected OR at the root, got %v", node.(SelectNode).Where)
+	}
+	if conds := andConditions(root); len(conds) != 0 {
+		t.Fatalf("Expected no top-level AND conditions under OR, got %v", conds)
+	}
+
+	// Unbalanced parentheses are rejected
+	if _, err := Parse("SELECT * FROM t WHERE (a = 1 OR b = 2"); err == nil {
+		t.Fatalf("Expected error for missing )")
+	}
+}
+
+func TestExecuteWhereOr(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	run := func(sql string) *QueryResult {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		result, err := executor.Execute(node)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	ids := func(result *QueryResult) map[string]bool {
+		set := make(map[string]bool)
+		for _, row := range result.Rows {
+			set[row["id"]] = true
+		}
+		return set
+	}
+
+	run("CREATE TABLE items (id INTEGER PRIMARY KEY, a INTEGER, b INTEGER, c INTEGER)")
+	run("INSERT INTO items (id, a, b, c) VALUES (1, 1, 0, 0)")
+	run("INSERT INTO items (id, a, b, c) VALUES (2, 2, 2, 5)")
+	run("INSERT INTO items (id, a, b, c) VALUES (3, 3, 2, 0)")
+	run("INSERT INTO items (id, a, b, c) VALUES (4, 1, 9, 7)")
+
+	got := ids(run("SELECT * FROM items WHERE a = 1 OR b = 2"))
+	if len(got) != 4 {
+		t.Fatalf("Expected all 4 rows, got %v", got)
+	}
+
+	got = ids(run("SELECT * FROM items WHERE (a = 1 OR a = 2) AND c > 0"))
+	if len(got) != 2 || !got["2"] || !got["4"] {
+		t.Fatalf("Expected rows 2 and 4, got %v", got)
+	}
+
+	// Without parentheses AND binds tighter: a = 1 OR (a = 2 AND c > 0)
+	got = ids(run("SELECT * FROM items WHERE a = 1 OR a = 2 AND c > 0"))
+	if len(got) != 3 || !got["1"] || !got["2"] || !got["4"] {
+		t.Fatalf("Expected rows 1, 2 and 4, got %v", got)
+	}
+
+	// A primary key equality under OR must not short-circuit to a direct lookup
+	got = ids(run("SELECT * FROM items WHERE id = 1 OR id = 3"))
+	if len(got) != 2 || !got["1"] || !got["3"] {
+		t.Fatalf("Expected rows 1 and 3, got %v", got)
+	}
+
+	run("UPDATE items SET c = 9 WHERE id = 1 OR b = 9")
+	got = ids(run("SELECT * FROM items WHERE c = 9"))
+	if len(got) != 2 || !got["1"] || !got["4"] {
+		t.Fatalf("Expected rows 1 and 4 updated, got %v", got)
+	}
+
+	run("DELETE FROM items WHERE a = 3 OR (a = 2 AND b = 2)")
+	got = ids(run("SELECT * FROM items"))
+	if len(got) != 2 || !got["1"] || !got["4"] {
+		t.Fatalf("Expected rows 1 and 4 left, got %v", got)
+	}
+}
+
+func TestParseOrderByLimitOffset(t *testing.T) {
+	node, err := Parse("SELECT id, name FROM t WHERE age > 1 ORDER BY age DESC, name LIMIT 2 OFFSET 1")
+	if err != nil {
+		t.Fatalf("Failed to parse SELECT: %v", err)
+	}
+	sel := node.(SelectNode)
+	expected := []OrderTerm{{Column: "age", Desc: true}, {Column: "name"}}
+	if len(sel.OrderBy) != 2 || sel.OrderBy[0] != expected[0] || sel.OrderBy[1] != expected[1] {
+		t.Fatalf("Expected ORDER BY %v, got %v", expected, sel.OrderBy)
+	}
+	if sel.Limit != 2 || sel.Offset != 1 {
+		t.Fatalf("Expected LIMIT 2 OFFSET 1, got LIMIT %d OFFSET %d", sel.Limit, sel.Offset)
+	}
+
+	// Without the clauses there is no limit and no offset
+	node, err = Parse("SELECT * FROM t")
+	if err != nil {
+		t.Fatalf("Failed to parse SELECT: %v", err)
+	}
+	if sel := node.(SelectNode); sel.Limit != -1 || sel.Offset != 0 || sel.OrderBy != nil {
+		t.Fatalf("Expected no ORDER BY/LIMIT/OFFSET, got %v", sel)
+	}
+
+	for _, sql := range []string{
+		"SELECT * FROM t ORDER age",
+		"SELECT * FROM t ORDER BY",
+		"SELECT * FROM t LIMIT x",
+		"SELECT * FROM t OFFSET",
+		"SELECT * FROM t LIMIT -1",
+		"SELECT * FROM t LIMIT 1 OFFSET -2",
+	} {
+		if _, err := Parse(sql); err == nil {
+			t.Fatalf("Expected error for %q", sql)
+		}
+	}
+}
+
+func TestExecuteOrderByLimitOffset(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	run := func(sql string) *QueryResult {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		result, err := executor.Execute(node)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	names := func(result *QueryResult) []string {
+		var out []string
+		for _, row := range result.Rows {
+			out = append(out, row["name"])
+		}
+		return out
+	}
+	expectNames := func(sql string, expected ...string) {
+		got := names(run(sql))
+		if strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Fatalf("%s: expected %v, got %v", sql, expected, got)
+		}
+	}
+
+	run("CREATE TABLE scores (id INTEGER PRIMARY KEY, name TEXT, score INTEGER)")
+	// 9 < 10 < 100 numerically but not as strings
+	run("INSERT INTO scores (id, name, score) VALUES (1, 'a', 9)")
+	run("INSERT INTO scores (id, name, score) VALUES (2, 'b', 100)")
+	run("INSERT INTO scores (id, name, score) VALUES (3, 'c', 10)")
+	run("INSERT INTO scores (id, name, score) VALUES (4, 'd', 50)")
+	run("INSERT INTO scores (id, name, score) VALUES (5, 'e', 10)")
+
+	expectNames("SELECT name FROM scores ORDER BY score DESC LIMIT 3", "b", "d", "c")
+	expectNames("SELECT name FROM scores ORDER BY score DESC, name DESC LIMIT 3", "b", "d", "e")
+	expectNames("SELECT name FROM scores ORDER BY score ASC", "a", "c", "e", "d", "b")
+	expectNames("SELECT name FROM scores ORDER BY score LIMIT 2 OFFSET 2", "e", "d")
+	expectNames("SELECT name FROM scores WHERE score > 9 ORDER BY name DESC LIMIT 2", "e", "d")
+	expectNames("SELECT name FROM scores ORDER BY score OFFSET 10")
+	expectNames("SELECT name FROM scores ORDER BY score LIMIT 0")
+
+	// ORDER BY a column that is not selected, and which must exist
+	result := run("SELECT id FROM scores ORDER BY score DESC LIMIT 1")
+	if len(result.Rows) != 1 || result.Rows[0]["id"] != "2" {
+		t.Fatalf("Expected id 2, got %v", result.Rows)
+	}
+	node, _ := Parse("SELECT id FROM scores ORDER BY missing")
+	if _, err := executor.Execute(node); err == nil {
+		t.Fatalf("Expected error for unknown ORDER BY column")
+	}
+}
+
+func TestParseAggregates(t *testing.T) {
+	node, err := Parse("SELECT COUNT(*), sum(score), AVG(score), MIN(name), MAX(name) FROM t WHERE score > 1")
+	if err != nil {
+		t.Fatalf("Failed to parse SELECT: %v", err)
+	}
+	sel := node.(SelectNode)
+	expected := []Aggregate{{"COUNT", "*"}, {"SUM", "score"}, {"AVG", "score"}, {"MIN", "name"}, {"MAX", "name"}}
+	if len(sel.Aggregates) != len(expected) {
+		t.Fatalf("Expected %d aggregates, got %v", len(expected), sel.Aggregates)
+	}
+	for i, agg := range sel.Aggregates {
+		if agg != expected[i] {
+			t.Fatalf("Aggregate %d: expected %v, got %v", i, expected[i], agg)
+		}
+	}
+	if len(sel.Columns) != 0 {
+		t.Fatalf("Expected no plain columns, got %v", sel.Columns)
+	}
+
+	for _, sql := range []string{
+		"SELECT SUM(*) FROM t",
+		"SELECT COUNT(*), name FROM t",
+		"SELECT COUNT( FROM t",
+		"SELECT COUNT(id FROM t",
+	} {
+		if _, err := Parse(sql); err == nil {
+			t.Fatalf("Expected error for %q", sql)
+		}
+	}
+}
+
+func TestExecuteAggregates(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	run := func(sql string) *QueryResult {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		result, err := executor.Execute(node)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+
+	run("CREATE TABLE sales (id INTEGER PRIMARY KEY, region TEXT, amount INTEGER)")
+	run("INSERT INTO sales (id, region, amount) VALUES (1, 'north', 10)")
+	run("INSERT INTO sales (id, region, amount) VALUES (2, 'south', 25)")
+	run("INSERT INTO sales (id, region, amount) VALUES (3, 'north', 5)")
+	run("INSERT INTO sales (id, region, amount) VALUES (4, 'east', 100)")
+
+	result := run("SELECT COUNT(*) FROM sales WHERE region = 'north'")
+	if len(result.Columns) != 1 || result.Columns[0] != "COUNT(*)" {
+		t.Fatalf("Expected column COUNT(*), got %v", result.Columns)
+	}
+	if len(result.Rows) != 1 || result.Rows[0]["COUNT(*)"] != "2" {
+		t.Fatalf("Expected COUNT(*) = 2, got %v", result.Rows)
+	}
+
+	result = run("SELECT SUM(amount), AVG(amount), MIN(amount), MAX(amount), COUNT(region) FROM sales")
+	expected := Row{
+		"SUM(amount)":   "140",
+		"AVG(amount)":   "35",
+		"MIN(amount)":   "5",
+		"MAX(amount)":   "100",
+		"COUNT(region)": "4",
+	}
+	if len(result.Rows) != 1 {
+		t.Fatalf("Expected a single row, got %v", result.Rows)
+	}
+	for col, value := range expected {
+		if result.Rows[0][col] != value {
+			t.Fatalf("Expected %s = %s, got %s", col, value, result.Rows[0][col])
+		}
+	}
+
+	// AVG keeps fractions; MIN/MAX on text compare as strings
+	result = run("SELECT AVG(amount), MIN(region), MAX(region) FROM sales WHERE id > 1")
+	if row := result.Rows[0]; row["AVG(amount)"] != "43.333333333333336" || row["MIN(region)"] != "east" || row["MAX(region)"] != "south" {
+		t.Fatalf("Unexpected aggregates: %v", row)
+	}
+
+	// Aggregating an empty set still returns one row
+	result = run("SELECT COUNT(*), SUM(amount) FROM sales WHERE amount > 1000")
+	if len(result.Rows) != 1 || result.Rows[0]["COUNT(*)"] != "0" || result.Rows[0]["SUM(amount)"] != "" {
+		t.Fatalf("Unexpected aggregates over empty set: %v", result.Rows)
+	}
+
+	// SUM of a text column and unknown columns are errors
+	for _, sql := range []string{"SELECT SUM(region) FROM sales", "SELECT MAX(missing) FROM sales"} {
+		node, _ := Parse(sql)
+		if _, err := executor.Execute(node); err == nil {
+			t.Fatalf("Expected error for %q", sql)
+		}
+	}
+}
+
+func TestMatchLike(t *testing.T) {
+	testCases := []struct {
+		value, pattern string
+		expected       bool
+	}{
+		{"John", "Jo%", true},
+		{"Joan", "Jo%", true},
+		{"Bob", "Jo%", false},
+		{"Johnson", "%son", true},
+		{"Jason", "%son", true},
+		{"Sonny", "%son", false},
+		{"Jon", "J_n", true},
+		{"Jan", "J_n", true},
+		{"John", "J_n", false},
+		{"Jn", "J_n", false},
+		{"john", "JO%", true},
+		{"abc", "%", true},
+		{"", "%", true},
+		{"", "_", false},
+		{"mississippi", "%iss%ppi", true},
+		{"mississippi", "m%s_s%i", true},
+		{"mississippi", "m%x%", false},
+		{"abc", "abc", true},
+		{"abcd", "abc", false},
+	}
+
+	for _, tc := range testCases {
+		if got := matchLike(tc.value, tc.pattern); got != tc.expected {
+			t.Fatalf("matchLike(%q, %q) = %v, expected %v", tc.value, tc.pattern, got, tc.expected)
+		}
+	}
+}
+
+func TestExecuteLike(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	run := func(sql string) *QueryResult {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		result, err := executor.Execute(node)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	expectNames := func(sql string, expected ...string) {
+		var got []string
+		for _, row := range run(sql).Rows {
+			got = append(got, row["name"])
+		}
+		if strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Fatalf("%s: expected %v, got %v", sql, expected, got)
+		}
+	}
+
+	run("CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)")
+	for i, name := range []string{"John", "Johnson", "Jan", "Jon", "Alice", "Jason"} {
+		run("INSERT INTO people (id, name) VALUES (" + strconv.Itoa(i+1) + ", '" + name + "')")
+	}
+
+	expectNames("SELECT name FROM people WHERE name LIKE 'Jo%' ORDER BY name", "John", "Johnson", "Jon")
+	expectNames("SELECT name FROM people WHERE name LIKE '%son' ORDER BY name", "Jason", "Johnson")
+	expectNames("SELECT name FROM people WHERE name LIKE 'J_n' ORDER BY name", "Jan", "Jon")
+	expectNames("SELECT name FROM people WHERE name LIKE 'j_N' OR name LIKE 'a%' ORDER BY name", "Alice", "Jan", "Jon")
+
+	node, err := Parse("SELECT name FROM people WHERE name LIKE 'J%' AND id > 2")
+	if err != nil {
+		t.Fatalf("Failed to parse LIKE: %v", err)
+	}
+	if got := node.(SelectNode).Where.String(); got != "name LIKE J% AND id > 2" {
+		t.Fatalf("Unexpected WHERE %q", got)
+	}
+	if _, err := Parse("SELECT name FROM people WHERE name LIKE 5"); err == nil {
+		t.Fatalf("Expected error for non-string LIKE pattern")
+	}
+}
+
+func TestExecuteIn(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	run := func(sql string) *QueryResult {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		result, err := executor.Execute(node)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	expectIDs := func(sql string, expected ...string) {
+		var got []string
+		for _, row := range run(sql).Rows {
+			got = append(got, row["id"])
+		}
+		if strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Fatalf("%s: expected %v, got %v", sql, expected, got)
+		}
+	}
+
+	run("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)")
+	for i := 1; i <= 6; i++ {
+		run("INSERT INTO items (id, name) VALUES (" + strconv.Itoa(i) + ", 'item" + strconv.Itoa(i) + "')")
+	}
+
+	expectIDs("SELECT id FROM items WHERE id IN (1, 3, 5) ORDER BY id", "1", "3", "5")
+	expectIDs("SELECT id FROM items WHERE id IN (7, 8) ORDER BY id")
+	expectIDs("SELECT id FROM items WHERE name IN ('item2', 'item6') ORDER BY id", "2", "6")
+	// Numeric-aware like the other comparisons
+	expectIDs("SELECT id FROM items WHERE id IN (2.0) ORDER BY id", "2")
+	expectIDs("SELECT id FROM items WHERE id IN (1, 2, 3) AND name IN ('item3') OR id IN (6) ORDER BY id", "3", "6")
+
+	node, err := Parse("DELETE FROM items WHERE id IN (1, 2)")
+	if err != nil {
+		t.Fatalf("Failed to parse IN: %v", err)
+	}
+	if got := node.(DeleteNode).Where.String(); got != "id IN (1, 2)" {
+		t.Fatalf("Unexpected WHERE %q", got)
+	}
+
+	for _, sql := range []string{
+		"SELECT id FROM items WHERE id IN ()",
+		"SELECT id FROM items WHERE id IN 1, 2",
+		"SELECT id FROM items WHERE id IN (1, 2",
+	} {
+		if _, err := Parse(sql); err == nil {
+			t.Fatalf("Expected error for %q", sql)
+		}
+	}
+}
+
+func TestColumnConstraints(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	exec := func(sql string) (*QueryResult, error) {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		return executor.Execute(node)
+	}
+	mustExec := func(sql string) *QueryResult {
+		result, err := exec(sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	expectErr := func(sql, column string) {
+		_, err := exec(sql)
+		if err == nil {
+			t.Fatalf("Expected error for %q", sql)
+		}
+		if !strings.Contains(err.Error(), "'"+column+"'") {
+			t.Fatalf("Expected error naming column %s, got: %v", column, err)
+		}
+	}
+	count := func() string {
+		return mustExec("SELECT COUNT(*) FROM users").Rows[0]["COUNT(*)"]
+	}
+
+	node, err := Parse("CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT UNIQUE NOT NULL, age INTEGER)")
+	if err != nil {
+		t.Fatalf("Failed to parse CREATE TABLE: %v", err)
+	}
+	cols := node.(CreateTableNode).Columns
+	if !cols[0].PrimaryKey || !cols[1].Unique || !cols[1].NotNull || cols[2].NotNull || cols[2].Unique {
+		t.Fatalf("Unexpected column constraints: %+v", cols)
+	}
+	if _, err := executor.Execute(node); err != nil {
+		t.Fatalf("Failed to execute CREATE TABLE: %v", err)
+	}
+
+	mustExec("INSERT INTO users (id, email, age) VALUES (1, 'a@example.com', 30)")
+
+	// Type violation
+	expectErr("INSERT INTO users (id, email, age) VALUES (2, 'b@example.com', 'abc')", "age")
+	expectErr("UPDATE users SET age = 'old' WHERE id = 1", "age")
+
+	// NOT NULL violation
+	expectErr("INSERT INTO users (id, age) VALUES (2, 20)", "email")
+
+	// UNIQUE violations, against stored rows and within one INSERT
+	expectErr("INSERT INTO users (id, email) VALUES (2, 'a@example.com')", "email")
+	expectErr("INSERT INTO users (id, email) VALUES (2, 'c@example.com'), (3, 'c@example.com')", "email")
+	if got := count(); got != "1" {
+		t.Fatalf("Expected failed INSERTs to leave 1 row, got %s", got)
+	}
+
+	mustExec("INSERT INTO users (id, email, age) VALUES (2, 'b@example.com', 25)")
+	expectErr("UPDATE users SET email = 'a@example.com' WHERE id = 2", "email")
+	expectErr("UPDATE users SET email = 'same@example.com' WHERE age > 0", "email")
+
+	// Re-inserting a row with its own value and updating to a free value are allowed
+	mustExec("INSERT INTO users (id, email, age) VALUES (2, 'b@example.com', 26)")
+	mustExec("UPDATE users SET email = 'new@example.com' WHERE id = 2")
+	mustExec("UPDATE users SET age = 40 WHERE age > 0")
+	if got := count(); got != "2" {
+		t.Fatalf("Expected 2 rows, got %s", got)
+	}
+	result := mustExec("SELECT email FROM users WHERE id = 2")
+	if len(result.Rows) != 1 || result.Rows[0]["email"] != "new@example.com" {
+		t.Fatalf("Expected updated email, got %v", result.Rows)
+	}
+}
+
+func TestTableScanStaysWithinTable(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	run := func(sql string) *QueryResult {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		result, err := executor.Execute(node)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+
+	// Table names that share a prefix, with enough rows that ids span
+	// several key lengths
+	run("CREATE TABLE small (id INTEGER PRIMARY KEY, v INTEGER)")
+	run("CREATE TABLE smaller (id INTEGER PRIMARY KEY, v INTEGER)")
+	run("CREATE TABLE big (id INTEGER PRIMARY KEY, v INTEGER)")
+	for i := 0; i < 150; i++ {
+		run("INSERT INTO small (id, v) VALUES (" + strconv.Itoa(i) + ", " + strconv.Itoa(i%2) + ")")
+	}
+	for i := 0; i < 500; i++ {
+		run("INSERT INTO big (id, v) VALUES (" + strconv.Itoa(i) + ", 1)")
+		run("INSERT INTO smaller (id, v) VALUES (" + strconv.Itoa(i) + ", 1)")
+	}
+
+	executor.rowsScanned = 0
+	result := run("SELECT id FROM small WHERE v = 1")
+	if len(result.Rows) != 75 {
+		t.Fatalf("Expected 75 rows, got %d", len(result.Rows))
+	}
+	if executor.rowsScanned != 150 {
+		t.Fatalf("Expected the scan to visit only the 150 rows of small, visited %d", executor.rowsScanned)
+	}
+
+	executor.rowsScanned = 0
+	result = run("DELETE FROM small WHERE v = 0")
+	if result.Rows[0]["deleted_count"] != "75" || executor.rowsScanned != 150 {
+		t.Fatalf("Expected to delete 75 rows visiting 150, got %v visiting %d", result.Rows, executor.rowsScanned)
+	}
+
+	executor.rowsScanned = 0
+	result = run("DROP TABLE small")
+	if result.Rows[0]["deleted_rows"] != "75" || executor.rowsScanned != 75 {
+		t.Fatalf("Expected to drop 75 rows visiting 75, got %v visiting %d", result.Rows, executor.rowsScanned)
+	}
+
+	// The other tables are untouched
+	if got := run("SELECT COUNT(*) FROM big").Rows[0]["COUNT(*)"]; got != "500" {
+		t.Fatalf("Expected 500 rows in big, got %s", got)
+	}
+	if got := run("SELECT COUNT(*) FROM smaller").Rows[0]["COUNT(*)"]; got != "500" {
+		t.Fatalf("Expected 500 rows in smaller, got %s", got)
+	}
+}
+
+func TestStatementsAreAtomic(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	exec := func(sql string) (*QueryResult, error) {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		return executor.Execute(node)
+	}
+	mustExec := func(sql string) *QueryResult {
+		result, err := exec(sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	count := func(table string) string {
+		return mustExec("SELECT COUNT(*) FROM " + table).Rows[0]["COUNT(*)"]
+	}
+
+	mustExec("CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT UNIQUE)")
+	mustExec("INSERT INTO users (id, email) VALUES (1, 'a@x')")
+
+	// Row 3 violates the UNIQUE constraint, so rows 1 and 2 must not be written
+	if _, err := exec("INSERT INTO users (id, email) VALUES (2, 'b@x'), (3, 'c@x'), (4, 'a@x')"); err == nil {
+		t.Fatalf("Expected UNIQUE violation on the third row")
+	}
+	if got := count("users"); got != "1" {
+		t.Fatalf("Expected the failed INSERT to write nothing, got %s rows", got)
+	}
+	for _, key := range []string{"users:2", "users:3"} {
+		if _, ok := bc.Get([]byte(key)); ok {
+			t.Fatalf("Expected %s not to be persisted", key)
+		}
+	}
+
+	// A valid multi-row INSERT commits every row
+	mustExec("INSERT INTO users (id, email) VALUES (2, 'b@x'), (3, 'c@x'), (4, 'd@x')")
+	if got := count("users"); got != "4" {
+		t.Fatalf("Expected 4 rows, got %s", got)
+	}
+
+	// A statement larger than one batch is rejected without writing anything
+	mustExec("CREATE TABLE big (id INTEGER PRIMARY KEY)")
+	var values []string
+	for i := 0; i < 250; i++ {
+		values = append(values, "("+strconv.Itoa(i)+")")
+	}
+	if _, err := exec("INSERT INTO big (id) VALUES " + strings.Join(values, ", ")); err == nil {
+		t.Fatalf("Expected an INSERT exceeding the batch limit to fail")
+	}
+	if got := count("big"); got != "0" {
+		t.Fatalf("Expected the oversized INSERT to write nothing, got %s rows", got)
+	}
+	for i := 0; i < 250; i++ {
+		mustExec("INSERT INTO big (id) VALUES (" + strconv.Itoa(i) + ")")
+	}
+	if _, err := exec("DELETE FROM big WHERE id >= 0"); err == nil {
+		t.Fatalf("Expected a DELETE exceeding the batch limit to fail")
+	}
+	if got := count("big"); got != "250" {
+		t.Fatalf("Expected the oversized DELETE to delete nothing, got %s rows", got)
+	}
+
+	// Bulk DELETE and DROP TABLE within the limit remove every matched row
+	result := mustExec("DELETE FROM big WHERE id >= 100")
+	if result.Rows[0]["deleted_count"] != "150" || count("big") != "100" {
+		t.Fatalf("Expected to delete 150 rows, got %v", result.Rows)
+	}
+	result = mustExec("DROP TABLE big")
+	if result.Rows[0]["deleted_rows"] != "100" {
+		t.Fatalf("Expected to drop 100 rows, got %v", result.Rows)
+	}
+	if _, err := exec("SELECT * FROM big"); err == nil {
+		t.Fatalf("Expected big to no longer exist")
+	}
+	if _, ok := bc.Get([]byte("big:5")); ok {
+		t.Fatalf("Expected the rows of big to be deleted with the table")
+	}
+}
+
+func TestInsertWithoutColumnList(t *testing.T) {
+	node, err := Parse("INSERT INTO users VALUES (1, 'Ann', 30), (2, 'Bob', 25)")
+	if err != nil {
+		t.Fatalf("Failed to parse INSERT without column list: %v", err)
+	}
+	insert := node.(InsertNode)
+	if len(insert.Columns) != 0 || len(insert.Values) != 2 {
+		t.Fatalf("Expected no columns and 2 rows, got %v", insert)
+	}
+	if got := insert.String(); got != "INSERT INTO users VALUES (1, Ann, 30), (2, Bob, 25)" {
+		t.Fatalf("Unexpected String(): %s", got)
+	}
+	if _, err := Parse("INSERT INTO users 1, 2"); err == nil {
+		t.Fatalf("Expected error when neither a column list nor VALUES follows the table name")
+	}
+
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	exec := func(sql string) (*QueryResult, error) {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		return executor.Execute(node)
+	}
+
+	if _, err := exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := exec("INSERT INTO users VALUES (1, 'Ann', 30), (2, 'Bob', 25)"); err != nil {
+		t.Fatalf("Failed to insert without column list: %v", err)
+	}
+	result, err := exec("SELECT * FROM users WHERE id = 2")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0]["name"] != "Bob" || result.Rows[0]["age"] != "25" {
+		t.Fatalf("Expected values in declared column order, got %v", result.Rows)
+	}
+
+	// The value count must match the number of declared columns
+	for _, sql := range []string{
+		"INSERT INTO users VALUES (3, 'Cid')",
+		"INSERT INTO users VALUES (3, 'Cid', 40, 'extra')",
+	} {
+		_, err := exec(sql)
+		if err == nil || !strings.Contains(err.Error(), "does not match number of columns") {
+			t.Fatalf("Expected value count error for %q, got: %v", sql, err)
+		}
+	}
+	if _, ok := bc.Get([]byte("users:3")); ok {
+		t.Fatalf("Expected no row to be written for a wrong value count")
+	}
+}
+
+func TestSecondaryIndex(t *testing.T) {
+	node, err := Parse("CREATE INDEX idx_city ON people (city)")
+	if err != nil {
+		t.Fatalf("Failed to parse CREATE INDEX: %v", err)
+	}
+	if got := node.String(); got != "CREATE INDEX idx_city ON people (city)" {
+		t.Fatalf("Unexpected String(): %s", got)
+	}
+	if _, err := Parse("CREATE INDEX idx ON people (city, age)"); err == nil {
+		t.Fatalf("Expected error for a multi-column index")
+	}
+
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	exec := func(sql string) (*QueryResult, error) {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		return executor.Execute(node)
+	}
+	run := func(sql string) *QueryResult {
+		result, err := exec(sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	scanned := func(sql string) (*QueryResult, int) {
+		executor.rowsScanned = 0
+		result := run(sql)
+		return result, executor.rowsScanned
+	}
+
+	run("CREATE TABLE people (id INTEGER PRIMARY KEY, city TEXT, age INTEGER)")
+	for i := 0; i < 300; i++ {
+		run("INSERT INTO people (id, city, age) VALUES (" + strconv.Itoa(i) + ", 'c" + strconv.Itoa(i%10) + "', " + strconv.Itoa(i%50) + ")")
+	}
+
+	result, unindexed := scanned("SELECT id FROM people WHERE city = 'c3'")
+	if len(result.Rows) != 30 || unindexed != 300 {
+		t.Fatalf("Expected 30 rows from a 300 row scan, got %d rows visiting %d", len(result.Rows), unindexed)
+	}
+
+	run("CREATE INDEX idx_city ON people (city)")
+	if _, err := exec("CREATE INDEX idx_city2 ON people (CITY)"); err == nil {
+		t.Fatalf("Expected error indexing an already indexed column")
+	}
+	if _, err := exec("CREATE INDEX idx_missing ON people (country)"); err == nil {
+		t.Fatalf("Expected error indexing a missing column")
+	}
+
+	// The index is backfilled and the lookup only reads the 30 entries and rows
+	result, indexed := scanned("SELECT id FROM people WHERE city = 'c3'")
+	if len(result.Rows) != 30 || indexed != 60 {
+		t.Fatalf("Expected 30 rows visiting 60 keys, got %d rows visiting %d", len(result.Rows), indexed)
+	}
+	if indexed*4 > unindexed {
+		t.Fatalf("Expected the indexed lookup (%d keys) to read far fewer keys than the scan (%d)", indexed, unindexed)
+	}
+
+	// Other conditions are still applied to the indexed candidates
+	result = run("SELECT id FROM people WHERE city = 'c3' AND age < 10")
+	if len(result.Rows) != 6 {
+		t.Fatalf("Expected 6 rows, got %d", len(result.Rows))
+	}
+	result, n := scanned("SELECT id FROM people WHERE city = 'c3' OR id = 4")
+	if len(result.Rows) != 31 || n != 300 {
+		t.Fatalf("Expected an OR to scan the table and return 31 rows, got %d rows visiting %d", len(result.Rows), n)
+	}
+
+	// UPDATE and a replacing INSERT move rows between index values
+	run("UPDATE people SET city = 'c3' WHERE id = 5")
+	run("INSERT INTO people (id, city, age) VALUES (13, 'c9', 1)")
+	count := func(city string) int {
+		return len(run("SELECT id FROM people WHERE city = '" + city + "'").Rows)
+	}
+	if count("c3") != 30 || count("c5") != 29 || count("c9") != 31 {
+		t.Fatalf("Expected 30/29/31 rows, got %d/%d/%d", count("c3"), count("c5"), count("c9"))
+	}
+	if _, ok := bc.Get([]byte(indexEntryPrefix("people", "city", "c3") + "13")); ok {
+		t.Fatalf("Expected the replaced row's old index entry to be removed")
+	}
+
+	// DELETE uses the index and removes the entries of deleted rows
+	result, n = scanned("DELETE FROM people WHERE city = 'c3'")
+	if result.Rows[0]["deleted_count"] != "30" || n != 60 {
+		t.Fatalf("Expected to delete 30 rows visiting 60 keys, got %v visiting %d", result.Rows, n)
+	}
+	if count("c3") != 0 {
+		t.Fatalf("Expected no rows left in c3")
+	}
+	if _, ok := bc.Get([]byte(indexEntryPrefix("people", "city", "c3") + "5")); ok {
+		t.Fatalf("Expected the deleted row's index entry to be removed")
+	}
+	run("INSERT INTO people (id, city, age) VALUES (1000, 'c3', 1)")
+	if count("c3") != 1 {
+		t.Fatalf("Expected a newly inserted row to be indexed")
+	}
+
+	// DROP TABLE removes the index with the table; each row takes two
+	// keys now, so shrink the table below the batch limit first
+	run("DELETE FROM people WHERE id < 100")
+	run("DELETE FROM people WHERE id < 200")
+	run("DROP TABLE people")
+	entries := 0
+	if err := bc.ScanPrefix([]byte("__idx_people:"), func(key, value []byte) error {
+		entries++
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to scan index entries: %v", err)
+	}
+	if entries != 0 {
+		t.Fatalf("Expected DROP TABLE to remove all index entries, %d left", entries)
+	}
+}
+
+func TestIndexNamesWithUnderscore(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	run := func(sql string) *QueryResult {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		result, err := executor.Execute(node)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+
+	// With "_" as the separator both indexes would store their entries under
+	// the same keys
+	run("CREATE TABLE t (id INTEGER PRIMARY KEY, c_x TEXT, y TEXT)")
+	run("CREATE TABLE t_c (id INTEGER PRIMARY KEY, x TEXT)")
+	run("CREATE INDEX idx_t ON t (c_x)")
+	run("CREATE INDEX idx_tc ON t_c (x)")
+	for i := 0; i < 5; i++ {
+		run("INSERT INTO t (id, c_x, y) VALUES (" + strconv.Itoa(i) + ", 'v', 'y')")
+		run("INSERT INTO t_c (id, x) VALUES (" + strconv.Itoa(i) + ", 'v')")
+	}
+	count := func() int {
+		return len(run("SELECT id FROM t_c WHERE x = 'v'").Rows)
+	}
+
+	// Dropping the column or the table of one index keeps the other's entries
+	run("ALTER TABLE t DROP COLUMN c_x")
+	if got := count(); got != 5 {
+		t.Fatalf("Expected DROP COLUMN to keep the entries of t_c, found %d rows", got)
+	}
+	run("ALTER TABLE t ADD COLUMN c_x TEXT")
+	run("UPDATE t SET c_x = 'v'")
+	run("CREATE INDEX idx_t ON t (c_x)")
+	run("DROP TABLE t")
+	if got := count(); got != 5 {
+		t.Fatalf("Expected DROP TABLE to keep the entries of t_c, found %d rows", got)
+	}
+}
+
+func TestNotEqualOperator(t *testing.T) {
+	for _, sql := range []string{"SELECT * FROM t WHERE a != 1", "SELECT * FROM t WHERE a <> 1"} {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		cond, ok := node.(SelectNode).Where.(Condition)
+		if !ok || cond.Operator != "!=" || cond.Right != "1" {
+			t.Fatalf("Expected a != condition for %q, got %v", sql, node.(SelectNode).Where)
+		}
+	}
+
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	run := func(sql string) *QueryResult {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		result, err := executor.Execute(node)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	ids := func(result *QueryResult) []string {
+		var ids []string
+		for _, row := range result.Rows {
+			ids = append(ids, row["id"])
+		}
+		return ids
+	}
+
+	run("CREATE TABLE users (id INTEGER PRIMARY KEY, active INTEGER)")
+	run("INSERT INTO users (id, active) VALUES (1, 1), (2, 0), (3, 1), (4, 0)")
+
+	result := run("SELECT id FROM users WHERE active != 1 ORDER BY id")
+	if got := strings.Join(ids(result), ","); got != "2,4" {
+		t.Fatalf("Expected rows 2,4 for active != 1, got %s", got)
+	}
+	// The comparison is numeric-aware like the other operators
+	result = run("SELECT id FROM users WHERE active != 1.0 ORDER BY id")
+	if got := strings.Join(ids(result), ","); got != "2,4" {
+		t.Fatalf("Expected rows 2,4 for active != 1.0, got %s", got)
+	}
+
+	result = run("DELETE FROM users WHERE id <> 2")
+	if result.Rows[0]["deleted_count"] != "3" {
+		t.Fatalf("Expected to delete 3 rows, got %v", result.Rows)
+	}
+	result = run("SELECT id FROM users")
+	if got := strings.Join(ids(result), ","); got != "2" {
+		t.Fatalf("Expected only row 2 to remain, got %s", got)
+	}
+}
+
+func TestUpdateArithmetic(t *testing.T) {
+	node, err := Parse("UPDATE t SET count = count + 1, total = total-2.5, name = 'x' WHERE id = 5")
+	if err != nil {
+		t.Fatalf("Failed to parse UPDATE: %v", err)
+	}
+	update := node.(UpdateNode)
+	if strings.Join(update.Ops, ",") != "+,-," || strings.Join(update.Values, ",") != "1,2.5,x" {
+		t.Fatalf("Unexpected SET assignments: ops %v, values %v", update.Ops, update.Values)
+	}
+	if got := update.String(); got != "UPDATE t SET count = count + 1, total = total - 2.5, name = x WHERE id = 5" {
+		t.Fatalf("Unexpected UPDATE string: %s", got)
+	}
+	for _, sql := range []string{
+		"UPDATE t SET count = other + 1",
+		"UPDATE t SET count = count * 2",
+		"UPDATE t SET count = count + 'a'",
+		"UPDATE t SET count = count",
+	} {
+		if _, err := Parse(sql); err == nil {
+			t.Fatalf("Expected parse error for %q", sql)
+		}
+	}
+
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	exec := func(sql string) (*QueryResult, error) {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		return executor.Execute(node)
+	}
+	run := func(sql string) *QueryResult {
+		result, err := exec(sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	value := func(column string, id int) string {
+		result := run("SELECT " + column + " FROM counters WHERE id = " + strconv.Itoa(id))
+		if len(result.Rows) != 1 {
+			t.Fatalf("Expected one row for id %d, got %v", id, result.Rows)
+		}
+		return result.Rows[0][column]
+	}
+
+	run("CREATE TABLE counters (id INTEGER PRIMARY KEY, count INTEGER, score TEXT, label TEXT)")
+	run("INSERT INTO counters (id, count, score, label) VALUES (1, 10, '1.5', 'a'), (2, 20, '2', 'b')")
+
+	// Increment and decrement a single row
+	run("UPDATE counters SET count = count + 1 WHERE id = 1")
+	run("UPDATE counters SET count = count + 1 WHERE id = 1")
+	if got := value("count", 1); got != "12" {
+		t.Fatalf("Expected count 12 after two increments, got %s", got)
+	}
+	run("UPDATE counters SET count = count - 5 WHERE id = 1")
+	run("UPDATE counters SET count = count-1 WHERE id = 1")
+	if got := value("count", 1); got != "6" {
+		t.Fatalf("Expected count 6 after decrements, got %s", got)
+	}
+
+	// Every matching row is computed from its own value
+	result := run("UPDATE counters SET count = count + 100, score = score + 0.25")
+	if result.Rows[0]["updated_count"] != "2" {
+		t.Fatalf("Expected 2 updated rows, got %v", result.Rows)
+	}
+	if value("count", 1) != "106" || value("count", 2) != "120" {
+		t.Fatalf("Expected counts 106 and 120, got %s and %s", value("count", 1), value("count", 2))
+	}
+	if value("score", 1) != "1.75" || value("score", 2) != "2.25" {
+		t.Fatalf("Expected scores 1.75 and 2.25, got %s and %s", value("score", 1), value("score", 2))
+	}
+
+	// Non-numeric values and non-integer results fail the whole statement
+	for _, sql := range []string{
+		"UPDATE counters SET label = label + 1",
+		"UPDATE counters SET count = count + 0.5",
+		"UPDATE counters SET count = count + 1, label = label + 1 WHERE id = 2",
+	} {
+		if _, err := exec(sql); err == nil {
+			t.Fatalf("Expected error for %q", sql)
+		}
+	}
+	if value("count", 2) != "120" || value("label", 2) != "b" {
+		t.Fatalf("Expected failed UPDATEs to leave row 2 unchanged, got count %s label %s", value("count", 2), value("label", 2))
+	}
+
+	run("UPDATE counters SET count = 9223372036854775807 WHERE id = 1")
+	if _, err := exec("UPDATE counters SET count = count + 1 WHERE id = 1"); err == nil || !strings.Contains(err.Error(), "overflow") {
+		t.Fatalf("Expected overflow error, got %v", err)
+	}
+}
+
+func TestAlterTable(t *testing.T) {
+	node, err := Parse("ALTER TABLE users ADD COLUMN email TEXT UNIQUE")
+	if err != nil {
+		t.Fatalf("Failed to parse ALTER TABLE: %v", err)
+	}
+	if got := node.String(); got != "ALTER TABLE users ADD COLUMN email TEXT UNIQUE" {
+		t.Fatalf("Unexpected ALTER TABLE string: %s", got)
+	}
+	node, err = Parse("ALTER TABLE users DROP email")
+	if err != nil {
+		t.Fatalf("Failed to parse ALTER TABLE: %v", err)
+	}
+	if got := node.String(); got != "ALTER TABLE users DROP COLUMN email" {
+		t.Fatalf("Unexpected ALTER TABLE string: %s", got)
+	}
+	for _, sql := range []string{
+		"ALTER TABLE users",
+		"ALTER TABLE users RENAME email",
+		"ALTER TABLE users ADD COLUMN email",
+		"ALTER users ADD COLUMN email TEXT",
+	} {
+		if _, err := Parse(sql); err == nil {
+			t.Fatalf("Expected parse error for %q", sql)
+		}
+	}
+
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	exec := func(sql string) (*QueryResult, error) {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		return executor.Execute(node)
+	}
+	run := func(sql string) *QueryResult {
+		result, err := exec(sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+
+	run("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)")
+	run("INSERT INTO users (id, name) VALUES (1, 'alice')")
+
+	// Existing rows read the added column as empty
+	run("ALTER TABLE users ADD COLUMN email TEXT")
+	run("INSERT INTO users (id, name, email) VALUES (2, 'bob', 'bob@example.com')")
+	result := run("SELECT * FROM users ORDER BY id")
+	if strings.Join(result.Columns, ",") != "id,name,email" {
+		t.Fatalf("Expected columns id,name,email, got %v", result.Columns)
+	}
+	if len(result.Rows) != 2 || result.Rows[0]["email"] != "" || result.Rows[1]["email"] != "bob@example.com" {
+		t.Fatalf("Unexpected rows after ADD COLUMN: %v", result.Rows)
+	}
+	if result := run("SELECT name FROM users WHERE email = 'bob@example.com'"); len(result.Rows) != 1 || result.Rows[0]["name"] != "bob" {
+		t.Fatalf("Expected bob by email, got %v", result.Rows)
+	}
+	run("UPDATE users SET email = 'alice@example.com' WHERE id = 1")
+	if result := run("SELECT email FROM users WHERE id = 1"); result.Rows[0]["email"] != "alice@example.com" {
+		t.Fatalf("Expected alice's email to be set, got %v", result.Rows)
+	}
+
+	for _, sql := range []string{
+		"ALTER TABLE users ADD COLUMN EMAIL TEXT",
+		"ALTER TABLE users ADD COLUMN code TEXT PRIMARY KEY",
+		"ALTER TABLE users ADD COLUMN age INTEGER NOT NULL",
+		"ALTER TABLE users DROP COLUMN missing",
+		"ALTER TABLE users DROP COLUMN id",
+		"ALTER TABLE missing ADD COLUMN age INTEGER",
+	} {
+		if _, err := exec(sql); err == nil {
+			t.Fatalf("Expected %q to fail", sql)
+		}
+	}
+
+	// Dropping leaves the stored JSON alone but hides the column
+	run("CREATE INDEX idx_email ON users (email)")
+	run("ALTER TABLE users DROP COLUMN email")
+	rowData, _ := bc.Get([]byte("users:2"))
+	if !strings.Contains(string(rowData), "bob@example.com") {
+		t.Fatalf("Expected the stored row to keep the dropped value, got %s", rowData)
+	}
+	result = run("SELECT * FROM users ORDER BY id")
+	if strings.Join(result.Columns, ",") != "id,name" {
+		t.Fatalf("Expected columns id,name after DROP COLUMN, got %v", result.Columns)
+	}
+	for _, row := range result.Rows {
+		if _, ok := row["email"]; ok {
+			t.Fatalf("Expected email to be excluded, got %v", row)
+		}
+	}
+	if _, err := exec("SELECT email FROM users"); err == nil {
+		t.Fatal("Expected selecting a dropped column to fail")
+	}
+	if result := run("SELECT * FROM users WHERE email = 'bob@example.com'"); len(result.Rows) != 0 {
+		t.Fatalf("Expected dropped values not to match WHERE, got %v", result.Rows)
+	}
+	entries := 0
+	if err := bc.ScanPrefix([]byte(indexPrefix("users", "email")), func(key, value []byte) error {
+		entries++
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to scan index entries: %v", err)
+	}
+	if entries != 0 {
+		t.Fatalf("Expected DROP COLUMN to remove the column's index entries, %d left", entries)
+	}
+
+	// Adding the column back does not bring the old values back
+	run("ALTER TABLE users ADD email TEXT")
+	if result := run("SELECT email FROM users WHERE id = 2"); result.Rows[0]["email"] != "" {
+		t.Fatalf("Expected re-added column to be empty, got %v", result.Rows)
+	}
+}
+
+func TestCountStar(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	run := func(sql string) *QueryResult {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		result, err := executor.Execute(node)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+
+	run("CREATE TABLE items (id INTEGER PRIMARY KEY, kind TEXT, price INTEGER)")
+	run("CREATE TABLE items2 (id INTEGER PRIMARY KEY, kind TEXT, price INTEGER)")
+	kinds := []string{"a", "b", "c"}
+	for i := 0; i < 120; i++ {
+		run("INSERT INTO items (id, kind, price) VALUES (" + strconv.Itoa(i) + ", '" + kinds[i%3] + "', " + strconv.Itoa(i) + ")")
+	}
+	run("INSERT INTO items2 (id, kind, price) VALUES (1, 'a', 1)")
+	run("CREATE INDEX idx_kind ON items (kind)")
+
+	// The fast path must agree with the number of rows a full SELECT returns
+	for _, where := range []string{
+		"",
+		" WHERE kind = 'a'",
+		" WHERE price >= 100",
+		" WHERE kind = 'b' AND price < 50",
+		" WHERE id = 7",
+		" WHERE id = 1000",
+		" WHERE kind = 'z'",
+	} {
+		want := len(run("SELECT * FROM items" + where).Rows)
+		result := run("SELECT COUNT(*) FROM items" + where)
+		if len(result.Columns) != 1 || result.Columns[0] != "COUNT(*)" {
+			t.Fatalf("Expected column COUNT(*), got %v", result.Columns)
+		}
+		if len(result.Rows) != 1 || result.Rows[0]["COUNT(*)"] != strconv.Itoa(want) {
+			t.Fatalf("Expected COUNT(*) = %d for %q, got %v", want, where, result.Rows)
+		}
+	}
+
+	// Counting an indexed value reads only the indexed rows
+	executor.rowsScanned = 0
+	if result := run("SELECT COUNT(*) FROM items WHERE kind = 'c'"); result.Rows[0]["COUNT(*)"] != "40" {
+		t.Fatalf("Expected 40 rows of kind c, got %v", result.Rows)
+	}
+	if executor.rowsScanned != 80 {
+		t.Fatalf("Expected 40 index entries and 40 rows to be read, got %d", executor.rowsScanned)
+	}
+
+	// OFFSET and LIMIT still apply to the single result row
+	if result := run("SELECT COUNT(*) FROM items LIMIT 0"); len(result.Rows) != 0 {
+		t.Fatalf("Expected no rows with LIMIT 0, got %v", result.Rows)
+	}
+	if result := run("SELECT COUNT(*) FROM items OFFSET 1"); len(result.Rows) != 0 {
+		t.Fatalf("Expected no rows with OFFSET 1, got %v", result.Rows)
+	}
+}
+
+func TestSelectDistinct(t *testing.T) {
+	node, err := Parse("SELECT DISTINCT city, country FROM people WHERE age > 1")
+	if err != nil {
+		t.Fatalf("Failed to parse SELECT DISTINCT: %v", err)
+	}
+	if got := node.String(); got != "SELECT DISTINCT city, country FROM people WHERE age > 1" {
+		t.Fatalf("Unexpected SELECT string: %s", got)
+	}
+
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	run := func(sql string) *QueryResult {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		result, err := executor.Execute(node)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	values := func(result *QueryResult, column string) string {
+		var out []string
+		for _, row := range result.Rows {
+			out = append(out, row[column])
+		}
+		return strings.Join(out, ",")
+	}
+
+	run("CREATE TABLE people (id INTEGER PRIMARY KEY, city TEXT, country TEXT)")
+	run("INSERT INTO people (id, city, country) VALUES " +
+		"(1, 'paris', 'fr'), (2, 'lyon', 'fr'), (3, 'paris', 'fr'), (4, 'berlin', 'de'), " +
+		"(5, 'lyon', 'fr'), (6, 'paris', 'us'), (7, 'berlin', 'de')")
+	run("INSERT INTO people (id, country) VALUES (8, 'fr'), (9, 'fr')")
+
+	result := run("SELECT DISTINCT city FROM people ORDER BY city")
+	if got := values(result, "city"); got != ",berlin,lyon,paris" {
+		t.Fatalf("Expected distinct cities ,berlin,lyon,paris, got %s", got)
+	}
+	if got := len(run("SELECT city FROM people").Rows); got != 9 {
+		t.Fatalf("Expected 9 rows without DISTINCT, got %d", got)
+	}
+
+	// Only the projected columns count, so paris appears once per country
+	result = run("SELECT DISTINCT city, country FROM people WHERE city = 'paris' ORDER BY country")
+	if got := values(result, "country"); got != "fr,us" {
+		t.Fatalf("Expected paris in fr and us, got %v", result.Rows)
+	}
+
+	// Values are not concatenated ambiguously
+	run("CREATE TABLE pairs (id INTEGER PRIMARY KEY, a TEXT, b TEXT)")
+	run("INSERT INTO pairs (id, a, b) VALUES (1, 'ab', 'c'), (2, 'a', 'bc'), (3, 'ab', 'c')")
+	if got := len(run("SELECT DISTINCT a, b FROM pairs").Rows); got != 2 {
+		t.Fatalf("Expected 2 distinct pairs, got %d", got)
+	}
+
+	// OFFSET and LIMIT apply to the distinct rows
+	result = run("SELECT DISTINCT country FROM people ORDER BY country LIMIT 2 OFFSET 1")
+	if got := values(result, "country"); got != "fr,us" {
+		t.Fatalf("Expected fr,us, got %s", got)
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	other := NewExecutor(bc)
+	exec := func(e *Executor, sql string) (*QueryResult, error) {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", sql, err)
+		}
+		return e.Execute(node)
+	}
+	run := func(sql string) *QueryResult {
+		result, err := exec(executor, sql)
+		if err != nil {
+			t.Fatalf("Failed to execute %q: %v", sql, err)
+		}
+		return result
+	}
+	count := func(e *Executor) string {
+		result, err := exec(e, "SELECT COUNT(*) FROM accounts")
+		if err != nil {
+			t.Fatalf("Failed to count rows: %v", err)
+		}
+		return result.Rows[0]["COUNT(*)"]
+	}
+
+	run("CREATE TABLE accounts (id INTEGER PRIMARY KEY, owner TEXT UNIQUE, balance INTEGER)")
+	run("CREATE INDEX idx_owner ON accounts (owner)")
+	run("INSERT INTO accounts (id, owner, balance) VALUES (1, 'alice', 100)")
+
+	// Rolled back writes never reach the database
+	run("BEGIN")
+	if !executor.InTransaction() {
+		t.Fatal("Expected a transaction after BEGIN")
+	}
+	run("INSERT INTO accounts (id, owner, balance) VALUES (2, 'bob', 50)")
+	if got := count(executor); got != "2" {
+		t.Fatalf("Expected the transaction to see its own insert, got %s rows", got)
+	}
+	if got := count(other); got != "1" {
+		t.Fatalf("Expected other executors not to see staged writes, got %s rows", got)
+	}
+	run("ROLLBACK")
+	if executor.InTransaction() {
+		t.Fatal("Expected no transaction after ROLLBACK")
+	}
+	if got := count(executor); got != "1" {
+		t.Fatalf("Expected the rolled back insert to be gone, got %s rows", got)
+	}
+	if _, exists := bc.Get([]byte("accounts:2")); exists {
+		t.Fatal("Expected nothing to be persisted after ROLLBACK")
+	}
+
+	// Committed writes persist, and statements inside the transaction see
+	// the earlier ones, through the table scan and the index alike
+	run("BEGIN")
+	run("INSERT INTO accounts (id, owner, balance) VALUES (2, 'bob', 50), (3, 'carol', 10)")
+	run("UPDATE accounts SET balance = balance - 30 WHERE id = 1")
+	run("UPDATE accounts SET balance = balance + 30 WHERE owner = 'bob'")
+	run("DELETE FROM accounts WHERE id = 3")
+	if _, err := exec(executor, "INSERT INTO accounts (id, owner, balance) VALUES (4, 'bob', 0)"); err == nil {
+		t.Fatal("Expected UNIQUE to see the staged insert")
+	}
+	result := run("SELECT id, balance FROM accounts ORDER BY id")
+	if len(result.Rows) != 2 || result.Rows[0]["balance"] != "70" || result.Rows[1]["balance"] != "80" {
+		t.Fatalf("Unexpected rows inside the transaction: %v", result.Rows)
+	}
+	if got := count(other); got != "1" {
+		t.Fatalf("Expected other executors not to see staged writes, got %s rows", got)
+	}
+	run("COMMIT")
+	result, err = exec(other, "SELECT id, balance FROM accounts WHERE owner = 'bob'")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0]["balance"] != "80" {
+		t.Fatalf("Expected the committed update to persist, got %v", result.Rows)
+	}
+	if got := count(other); got != "2" {
+		t.Fatalf("Expected 2 rows after COMMIT, got %s", got)
+	}
+
+	// Misplaced transaction statements and schema changes are rejected
+	for _, sql := range []string{"COMMIT", "ROLLBACK"} {
+		if _, err := exec(executor, sql); err == nil {
+			t.Fatalf("Expected %s without BEGIN to fail", sql)
+		}
+	}
+	run("BEGIN")
+	for _, sql := range []string{
+		"BEGIN",
+		"CREATE TABLE t (id INTEGER PRIMARY KEY)",
+		"DROP TABLE accounts",
+		"ALTER TABLE accounts ADD COLUMN note TEXT",
+	} {
+		if _, err := exec(executor, sql); err == nil {
+			t.Fatalf("Expected %q to fail inside a transaction", sql)
+		}
+	}
+	run("ROLLBACK")
+}
+
+func TestPreparedStatements(t *testing.T) {
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	prepare := func(sql string) *Stmt {
+		stmt, err := executor.Prepare(sql)
+		if err != nil {
+			t.Fatalf("Failed to prepare %q: %v", sql, err)
+		}
+		return stmt
+	}
+
+	if _, err := prepare("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, age INTEGER)").Execute(); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// One prepared INSERT runs for every row; the values are bound, never lexed
+	insert := prepare("INSERT INTO users (id, name, age) VALUES (?, ?, ?)")
+	if insert.NumParams() != 3 {
+		t.Fatalf("Expected 3 parameters, got %d", insert.NumParams())
+	}
+	names := []string{"O'Brien", `say "hi"`, "x'); DROP TABLE users; --", `back\slash`}
+	for i, name := range names {
+		if _, err := insert.Execute(i+1, name, 30+i); err != nil {
+			t.Fatalf("Failed to insert %q: %v", name, err)
+		}
+	}
+
+	rowData, exists := bc.Get([]byte("users:1"))
+	if !exists {
+		t.Fatal("Expected row 1 to be stored")
+	}
+	var row Row
+	if err := json.Unmarshal(rowData, &row); err != nil {
+		t.Fatalf("Failed to decode row: %v", err)
+	}
+	if row["name"] != "O'Brien" || row["age"] != "30" {
+		t.Fatalf("Unexpected stored row: %v", row)
+	}
+
+	byName := prepare("SELECT id FROM users WHERE name = ?")
+	for i, name := range names {
+		result, err := byName.Execute(name)
+		if err != nil {
+			t.Fatalf("Failed to select %q: %v", name, err)
+		}
+		if len(result.Rows) != 1 || result.Rows[0]["id"] != strconv.Itoa(i+1) {
+			t.Fatalf("Expected id %d for %q, got %v", i+1, name, result.Rows)
+		}
+	}
+
+	// Placeholders work in any value position, including arithmetic and LIMIT
+	if _, err := prepare("UPDATE users SET age = age + ? WHERE name = ?").Execute(5, "O'Brien"); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	result, err := prepare("SELECT name, age FROM users WHERE age >= ? ORDER BY age DESC LIMIT ?").Execute(33, 1)
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0]["name"] != "O'Brien" || result.Rows[0]["age"] != "35" {
+		t.Fatalf("Unexpected rows: %v", result.Rows)
+	}
+	result, err = prepare("SELECT COUNT(*) FROM users").Execute()
+	if err != nil || result.Rows[0]["COUNT(*)"] != "4" {
+		t.Fatalf("Expected the table to survive with 4 rows, got %v, %v", result, err)
+	}
+
+	// Argument mistakes are reported without executing anything
+	if _, err := insert.Execute(9, "nine"); err == nil {
+		t.Fatal("Expected too few arguments to fail")
+	}
+	if _, err := byName.Execute("a", "b"); err == nil {
+		t.Fatal("Expected too many arguments to fail")
+	}
+	if _, err := byName.Execute(struct{}{}); err == nil {
+		t.Fatal("Expected an unsupported argument type to fail")
+	}
+	if _, err := prepare("SELECT FROM users WHERE id = ?").Execute(1); err == nil {
+		t.Fatal("Expected a syntax error to be reported by Execute")
+	}
+	if _, err := prepare("SELECT id FROM users WHERE id = ? id").Execute(1); err == nil {
+		t.Fatal("Expected trailing tokens to be reported by Execute")
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	script := `CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);
+INSERT INTO notes (id, body) VALUES (1, 'first; not a separator'), (2, "second;");
+SELECT body FROM notes ORDER BY id;`
+
+	nodes, err := ParseAll(script)
+	if err != nil {
+		t.Fatalf("Failed to parse script: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("Expected 3 statements, got %d", len(nodes))
+	}
+	for i, want := range []StatementType{CreateTableStmt, InsertStmt, SelectStmt} {
+		if nodes[i].Type() != want {
+			t.Fatalf("Expected statement %d to be %s, got %s", i+1, want, nodes[i].Type())
+		}
+	}
+	insert := nodes[1].(InsertNode)
+	if insert.Values[0][1] != "first; not a separator" || insert.Values[1][1] != "second;" {
+		t.Fatalf("Semicolons inside literals were not kept: %v", insert.Values)
+	}
+
+	// Empty statements are skipped and the last semicolon is optional
+	if nodes, err := ParseAll(";; SELECT * FROM notes ;; SELECT id FROM notes"); err != nil || len(nodes) != 2 {
+		t.Fatalf("Expected 2 statements, got %d, %v", len(nodes), err)
+	}
+	if nodes, err := ParseAll("  "); err != nil || len(nodes) != 0 {
+		t.Fatalf("Expected no statements, got %d, %v", len(nodes), err)
+	}
+	if _, err := ParseAll("SELECT * FROM notes; SELEC id FROM notes"); err == nil || !strings.Contains(err.Error(), "statement 2") {
+		t.Fatalf("Expected an error naming statement 2, got %v", err)
+	}
+
+	bc, cleanup, err := setupTest()
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	defer cleanup()
+
+	executor := NewExecutor(bc)
+	results, err := executor.ExecuteAll(nodes)
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	rows := results[2].Rows
+	if len(rows) != 2 || rows[0]["body"] != "first; not a separator" || rows[1]["body"] != "second;" {
+		t.Fatalf("Unexpected rows: %v", rows)
+	}
+
+	// Execution stops at the first failing statement
+	nodes, err = ParseAll("INSERT INTO notes (id, body) VALUES (3, 'x'); INSERT INTO missing (id) VALUES (1); INSERT INTO notes (id, body) VALUES (4, 'y')")
+	if err != nil {
+		t.Fatalf("Failed to parse script: %v", err)
+	}
+	results, err = executor.ExecuteAll(nodes)
+	if err == nil || !strings.Contains(err.Error(), "statement 2") {
+		t.Fatalf("Expected statement 2 to fail, got %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected the result of the first statement, got %d", len(results))
+	}
+	if _, exists := bc.Get([]byte("notes:4")); exists {
+		t.Fatal("Expected statements after the failure not to run")
+	}
+}
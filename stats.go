@@ -0,0 +1,67 @@
+package bitcask
+
+import (
+	"time"
+
+	"github.com/aixiasang/bitcask/record"
+)
+
+// Stats 存储引擎的运行统计
+type Stats struct {
+	Keys             int    // 有效键数量，不含删除标记和已过期的键
+	DataFiles        int    // WAL文件数量，包含活跃文件
+	DiskBytes        uint64 // WAL文件的总字节数，包含文件头
+	ReclaimableBytes uint64 // 可以被 Merge 回收的字节数：被覆盖的旧值、删除标记、过期记录和事务标记
+	ActiveFileID     uint32 // 活跃WAL文件的ID
+	BlobFiles        int    // blob文件数量，包含活跃文件
+	BlobBytes        uint64 // blob文件的总字节数，Merge 不会重写其中的 value
+	TxnID            uint32 // 下一个批处理使用的事务ID
+}
+
+// Stats 返回存储引擎的运行统计，可以根据 ReclaimableBytes 决定何时执行 Merge
+//
+// 统计需要读取索引中的每条记录以区分有效值和删除标记，开销与键数量成正比
+func (bc *Bitcask) Stats() (Stats, error) {
+	var stats Stats
+	var liveBytes uint64
+	now := time.Now()
+
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	err := bc.memTable.Foreach(func(key []byte, pos *record.Pos) error {
+		rec, err := bc.readRawRecord(pos)
+		if err != nil {
+			return err
+		}
+		if rec.IsDeleted() || rec.IsExpired(now) {
+			return nil
+		}
+		stats.Keys++
+		liveBytes += uint64(pos.Length)
+		return nil
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats.ActiveFileID = bc.fileId
+	stats.TxnID = bc.txnId.Load()
+	stats.DataFiles = len(bc.oldWal) + 1
+	stats.DiskBytes = uint64(bc.activeWal.Size())
+	headerBytes := uint64(bc.activeWal.DataStart())
+	for _, w := range bc.oldWal {
+		stats.DiskBytes += uint64(w.Size())
+		headerBytes += uint64(w.DataStart())
+	}
+	for _, blob := range bc.blobs {
+		stats.BlobFiles++
+		stats.BlobBytes += uint64(blob.Size())
+	}
+	if bc.activeBlob != nil {
+		stats.BlobFiles++
+		stats.BlobBytes += uint64(bc.activeBlob.Size())
+	}
+	// 文件头不能被 Merge 回收
+	stats.ReclaimableBytes = stats.DiskBytes - headerBytes - liveBytes
+	return stats, nil
+}
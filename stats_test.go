@@ -0,0 +1,158 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aixiasang/bitcask/utils"
+	"github.com/aixiasang/bitcask/wal"
+)
+
+func TestBitcask_Stats(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("获取统计失败: %v", err)
+	}
+	// 空数据库只有活跃文件的文件头
+	if stats.Keys != 0 || stats.DataFiles != 1 || stats.DiskBytes != wal.FileHeaderSize || stats.ReclaimableBytes != 0 {
+		t.Fatalf("空数据库的统计不正确: %+v", stats)
+	}
+
+	// 写入足够多的数据以产生多个WAL文件，只有新值是有效数据
+	const total = 200
+	for i := 0; i < total; i++ {
+		if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	stats, err = db.Stats()
+	if err != nil {
+		t.Fatalf("获取统计失败: %v", err)
+	}
+	if stats.Keys != total || stats.DataFiles < 2 || stats.ReclaimableBytes != 0 {
+		t.Fatalf("写入后的统计不正确: %+v", stats)
+	}
+	if stats.ActiveFileID != uint32(stats.DataFiles-1) {
+		t.Fatalf("活跃文件ID不正确: %+v", stats)
+	}
+
+	// 覆盖、删除和过期都会产生可回收的数据
+	for i := 0; i < 50; i++ {
+		if err := db.Put(utils.GetKey(i), []byte("new")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	for i := 50; i < 60; i++ {
+		if _, err := db.Delete(utils.GetKey(i)); err != nil {
+			t.Fatalf("删除失败: %v", err)
+		}
+	}
+	if err := db.PutWithTTL([]byte("ttl"), []byte("v"), 10*time.Millisecond); err != nil {
+		t.Fatalf("写入TTL数据失败: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	before, err := db.Stats()
+	if err != nil {
+		t.Fatalf("获取统计失败: %v", err)
+	}
+	if before.Keys != total-10 || before.ReclaimableBytes == 0 || before.DiskBytes <= stats.DiskBytes {
+		t.Fatalf("修改后的统计不正确: %+v", before)
+	}
+
+	// Merge 后只剩有效数据
+	if err := db.Merge(); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	after, err := db.Stats()
+	if err != nil {
+		t.Fatalf("获取统计失败: %v", err)
+	}
+	// 合并前后的文件数量不同，比较时去掉文件头
+	liveBytes := func(s Stats) uint64 { return s.DiskBytes - s.ReclaimableBytes - uint64(s.DataFiles)*wal.FileHeaderSize }
+	if after.Keys != before.Keys || after.ReclaimableBytes != 0 || liveBytes(after) != liveBytes(before) {
+		t.Fatalf("合并后的统计不正确: before=%+v, after=%+v", before, after)
+	}
+}
+
+func TestBitcask_StatsAfterRotate(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.MaxFileSize = 1 << 20
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := db.Put(utils.GetKey(i), utils.GetValue(8)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("获取统计失败: %v", err)
+	}
+	if stats.Keys != 10 || stats.DataFiles != 1 || stats.ActiveFileID != 0 {
+		t.Fatalf("轮转前的统计不正确: %+v", stats)
+	}
+
+	// 轮转后旧文件仍然计入，新写入的键和覆盖的键分别计数
+	if err := db.mustRotate(); err != nil {
+		t.Fatalf("轮转失败: %v", err)
+	}
+	batch := NewBatch(db)
+	for i := 7; i < 12; i++ {
+		batch.Put(utils.GetKey(i), utils.GetValue(8))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	rotated, err := db.Stats()
+	if err != nil {
+		t.Fatalf("获取统计失败: %v", err)
+	}
+	if rotated.Keys != 12 || rotated.DataFiles != 2 || rotated.ActiveFileID != 1 {
+		t.Fatalf("轮转后的统计不正确: %+v", rotated)
+	}
+	if rotated.TxnID != stats.TxnID+1 {
+		t.Fatalf("提交批处理后事务ID应该增加: before=%d, after=%d", stats.TxnID, rotated.TxnID)
+	}
+	if rotated.ReclaimableBytes == 0 {
+		t.Fatalf("覆盖的旧值和事务标记应该计入可回收字节数: %+v", rotated)
+	}
+
+	// 磁盘占用与WAL目录中的文件大小一致
+	entries, err := os.ReadDir(filepath.Join(testDir, conf.WalDir))
+	if err != nil {
+		t.Fatalf("读取WAL目录失败: %v", err)
+	}
+	var diskBytes uint64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatalf("读取文件信息失败: %v", err)
+		}
+		diskBytes += uint64(info.Size())
+	}
+	if len(entries) != rotated.DataFiles || diskBytes != rotated.DiskBytes {
+		t.Fatalf("磁盘统计与WAL目录不一致: 文件%d个/%d字节, 统计%+v", len(entries), diskBytes, rotated)
+	}
+}
@@ -0,0 +1,42 @@
+package bitcask
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aixiasang/bitcask/wal"
+)
+
+// CorruptionReport Verify 发现的一处损坏
+type CorruptionReport struct {
+	FileId uint32 // WAL文件ID
+	Offset uint32 // 损坏记录在文件中的起始偏移
+	Reason string // 损坏原因
+}
+
+// Verify 只读地检查所有WAL文件中的每条记录，重新计算CRC并返回所有发现的损坏，不修改任何数据
+//
+// 重放时的宽松模式遇到CRC错误会静默忽略文件的剩余部分，Verify 用于事后确认哪些记录受到影响。
+// 检查期间持有读锁，并发的写入可以继续，但文件轮转和 Merge 会等待检查结束
+func (bc *Bitcask) Verify() ([]CorruptionReport, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	wals := make([]*wal.Wal, 0, len(bc.oldWal)+1)
+	for _, w := range bc.oldWal {
+		wals = append(wals, w)
+	}
+	wals = append(wals, bc.activeWal)
+	sort.Slice(wals, func(i, j int) bool { return wals[i].FileId() < wals[j].FileId() })
+
+	var reports []CorruptionReport
+	for _, w := range wals {
+		fileId := w.FileId()
+		if _, err := w.Verify(func(offset uint32, reason string) {
+			reports = append(reports, CorruptionReport{FileId: fileId, Offset: offset, Reason: reason})
+		}); err != nil {
+			return reports, fmt.Errorf("检查WAL文件 %d 失败: %w", fileId, err)
+		}
+	}
+	return reports, nil
+}
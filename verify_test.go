@@ -0,0 +1,102 @@
+package bitcask
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aixiasang/bitcask/utils"
+)
+
+func TestBitcask_Verify(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 300; i++ {
+		if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	reports, err := db.Verify()
+	if err != nil {
+		t.Fatalf("检查失败: %v", err)
+	}
+	if len(reports) != 0 {
+		t.Fatalf("未损坏的数据不应报告错误: %+v", reports)
+	}
+
+	// 翻转一个位于已封存文件中间的记录的最后一个 value 字节
+	pos, err := db.memTable.Get(utils.GetKey(10))
+	if err != nil || pos == nil {
+		t.Fatalf("获取记录位置失败: %v", err)
+	}
+	if pos.FileId == db.fileId {
+		t.Fatalf("测试数据应跨越多个文件")
+	}
+	walPath := filepath.Join(testDir, conf.WalDir, fmt.Sprintf("wal-%d.log", pos.FileId))
+	fp, err := os.OpenFile(walPath, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("打开WAL文件失败: %v", err)
+	}
+	b := make([]byte, 1)
+	corruptAt := int64(pos.Offset + pos.Length - 5)
+	if _, err := fp.ReadAt(b, corruptAt); err != nil {
+		t.Fatalf("读取WAL文件失败: %v", err)
+	}
+	b[0] ^= 0xff
+	if _, err := fp.WriteAt(b, corruptAt); err != nil {
+		t.Fatalf("写入WAL文件失败: %v", err)
+	}
+	fp.Close()
+
+	reports, err = db.Verify()
+	if err != nil {
+		t.Fatalf("检查失败: %v", err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("应只报告一处损坏, 实际: %+v", reports)
+	}
+	if reports[0].FileId != pos.FileId || reports[0].Offset != pos.Offset || !strings.Contains(reports[0].Reason, "CRC") {
+		t.Fatalf("损坏位置不正确: 期望 fileId=%d offset=%d, 实际 %+v", pos.FileId, pos.Offset, reports[0])
+	}
+
+	// Verify 不修改数据：其他记录仍然可以读取
+	if value, ok := db.Get(utils.GetKey(11)); !ok || string(value) != "value-11" {
+		t.Fatalf("相邻记录读取失败: %s", value)
+	}
+
+	// 活跃文件末尾的不完整记录同样会被报告
+	activePath := filepath.Join(testDir, conf.WalDir, fmt.Sprintf("wal-%d.log", db.fileId))
+	info, err := os.Stat(activePath)
+	if err != nil {
+		t.Fatalf("获取活跃文件大小失败: %v", err)
+	}
+	fp, err = os.OpenFile(activePath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("打开活跃文件失败: %v", err)
+	}
+	fp.Write([]byte{0x00, 0x00, 0x00})
+	fp.Close()
+
+	reports, err = db.Verify()
+	if err != nil {
+		t.Fatalf("检查失败: %v", err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("应报告两处损坏, 实际: %+v", reports)
+	}
+	last := reports[1]
+	if last.FileId != db.fileId || int64(last.Offset) != info.Size() {
+		t.Fatalf("末尾不完整记录的位置不正确: 期望 fileId=%d offset=%d, 实际 %+v", db.fileId, info.Size(), last)
+	}
+}
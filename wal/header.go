@@ -0,0 +1,140 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aixiasang/bitcask/config"
+	"github.com/aixiasang/bitcask/record"
+)
+
+// 文件头格式：[magic(4)][version(1)][fileId(4)][createdAt(8)][crc(4)]
+//
+// 新建的WAL文件以文件头开始，记录从 FileHeaderSize 处开始。旧版本写入的文件没有文件头，
+// 第一条记录从偏移0开始，仍可正常读取和追加写入
+const (
+	FileHeaderSize         = 21 // 文件头长度
+	fileVersion       byte = 1  // 当前的文件格式版本
+	fileVersionLegacy byte = 0  // 没有文件头的旧文件
+	fileHeaderCrcAt        = 17 // CRC 在文件头中的偏移
+)
+
+// fileMagic WAL文件魔数 "BCWL"
+var fileMagic = []byte("BCWL")
+
+var (
+	// ErrInvalidFile 表示文件不是 bitcask 的WAL文件，或文件头损坏、与文件名中的ID不一致
+	ErrInvalidFile = errors.New("invalid wal file")
+	// ErrUnsupportedVersion 表示文件头中的格式版本高于当前版本，通常由更新的版本写入
+	ErrUnsupportedVersion = errors.New("unsupported wal file version")
+)
+
+// fileHeader WAL文件头
+type fileHeader struct {
+	version   byte
+	fileId    uint32
+	createdAt int64 // 创建时间（UnixNano），旧文件为0
+}
+
+func (h *fileHeader) encode() []byte {
+	buf := make([]byte, FileHeaderSize)
+	copy(buf, fileMagic)
+	buf[4] = h.version
+	binary.BigEndian.PutUint32(buf[5:9], h.fileId)
+	binary.BigEndian.PutUint64(buf[9:17], uint64(h.createdAt))
+	binary.BigEndian.PutUint32(buf[fileHeaderCrcAt:], crc32.ChecksumIEEE(buf[:fileHeaderCrcAt]))
+	return buf
+}
+
+func decodeFileHeader(buf []byte) (*fileHeader, error) {
+	if len(buf) < FileHeaderSize {
+		return nil, fmt.Errorf("%w: 文件头不完整, 长度 %d", ErrInvalidFile, len(buf))
+	}
+	if crc := binary.BigEndian.Uint32(buf[fileHeaderCrcAt:]); crc != crc32.ChecksumIEEE(buf[:fileHeaderCrcAt]) {
+		return nil, fmt.Errorf("%w: 文件头CRC校验失败", ErrInvalidFile)
+	}
+	h := &fileHeader{
+		version:   buf[4],
+		fileId:    binary.BigEndian.Uint32(buf[5:9]),
+		createdAt: int64(binary.BigEndian.Uint64(buf[9:17])),
+	}
+	if h.version > fileVersion {
+		return nil, fmt.Errorf("%w: %d, 当前版本 %d", ErrUnsupportedVersion, h.version, fileVersion)
+	}
+	return h, nil
+}
+
+// createWalFile 创建带文件头的WAL文件。文件头先写入临时文件再重命名，
+// 崩溃时不会留下只有半个文件头的WAL文件；临时文件的后缀不是 .log，加载时会被跳过
+func createWalFile(filePath string, fileId uint32) error {
+	tmpPath := filePath + ".tmp"
+	header := &fileHeader{version: fileVersion, fileId: fileId, createdAt: time.Now().UnixNano()}
+	fp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fp.Write(header.encode()); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := fp.Sync(); err != nil {
+		fp.Close()
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+// readFileHeader 读取并校验文件头，没有文件头的旧文件返回版本为 fileVersionLegacy 的文件头
+//
+// 旧文件只有在第一条记录的头部合法时才会被接受，魔数不匹配且无法解析为记录的文件视为外来文件
+func readFileHeader(fp *os.File, conf *config.Config, fileId uint32) (*fileHeader, error) {
+	info, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return &fileHeader{version: fileVersionLegacy, fileId: fileId}, nil
+	}
+
+	buf := make([]byte, min(size, record.MaxHeaderSize))
+	if _, err := fp.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.HasPrefix(buf, fileMagic) {
+		if size < FileHeaderSize {
+			return nil, fmt.Errorf("%w: 文件头不完整, 文件大小 %d", ErrInvalidFile, size)
+		}
+		full := make([]byte, FileHeaderSize)
+		if _, err := fp.ReadAt(full, 0); err != nil {
+			return nil, err
+		}
+		h, err := decodeFileHeader(full)
+		if err != nil {
+			return nil, err
+		}
+		if h.fileId != fileId {
+			return nil, fmt.Errorf("%w: 文件头中的ID %d 与文件名中的ID %d 不一致", ErrInvalidFile, h.fileId, fileId)
+		}
+		return h, nil
+	}
+
+	// 没有文件头，检查第一条记录的头部是否合法
+	if len(buf) < record.BaseHeaderSize || uint32(len(buf)) < record.HeaderSize(buf[0]) {
+		return nil, fmt.Errorf("%w: 缺少文件头且不是旧格式的WAL文件", ErrInvalidFile)
+	}
+	h, err := record.DecodeHeader(buf[:record.HeaderSize(buf[0])], decodeLimits(conf))
+	if err != nil || !h.RecordType.Known() {
+		return nil, fmt.Errorf("%w: 缺少文件头且不是旧格式的WAL文件", ErrInvalidFile)
+	}
+	return &fileHeader{version: fileVersionLegacy, fileId: fileId}, nil
+}
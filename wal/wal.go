@@ -1,37 +1,145 @@
 package wal
 
 import (
+	"bufio"
+	"crypto/cipher"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/aixiasang/bitcask/config"
 	"github.com/aixiasang/bitcask/index"
 	"github.com/aixiasang/bitcask/record"
 	"github.com/aixiasang/bitcask/utils"
+	"github.com/golang/snappy"
 )
 
+const readBufferSize = 64 * 1024 // 重放WAL时的读缓冲大小
+
+// ErrCRCMismatch 表示重放WAL时记录的CRC校验失败
+var ErrCRCMismatch = errors.New("crc mismatch")
+
+// ErrCorruptRecord 表示 Decode 停止解析的位置之后还有数据，是文件中间的损坏而不是写入中断留下的不完整尾部，
+// TruncateTail 不会截断这样的文件
+var ErrCorruptRecord = errors.New("corrupt record before end of file")
+
+// lastTimestamp 最近一次分配的记录时间戳，所有WAL文件共用，保证同一进程内写入的时间戳严格递增
+var lastTimestamp atomic.Int64
+
+// nextTimestamp 返回当前时间（UnixNano），系统时钟回拨或同一纳秒内多次写入时返回上一个时间戳加1
+func nextTimestamp() int64 {
+	for {
+		last := lastTimestamp.Load()
+		ts := time.Now().UnixNano()
+		if ts <= last {
+			ts = last + 1
+		}
+		if lastTimestamp.CompareAndSwap(last, ts) {
+			return ts
+		}
+	}
+}
+
+// decodeLimits 返回解码时使用的长度上限：配置的 MaxKeySize/MaxValueSize 加上事务ID和加密带来的额外长度。
+// 配置小于默认值时仍使用默认值，调小上限不会让已经写入的记录被当作损坏数据
+func decodeLimits(conf *config.Config) record.Limits {
+	limit := func(configured, defaultSize, overhead uint32) uint32 {
+		size := uint64(max(configured, defaultSize)) + uint64(overhead)
+		return uint32(min(size, math.MaxUint32))
+	}
+	return record.Limits{
+		MaxKeyLength:   limit(conf.MaxKeySize, config.DefaultMaxKeySize, record.KeyOverhead),
+		MaxValueLength: limit(conf.MaxValueSize, config.DefaultMaxValueSize, record.ValueOverhead),
+	}
+}
+
 type Wal struct {
 	conf   *config.Config // 配置
 	fileId uint32         // 文件ID
 	offset uint32         // 偏移量
 	fp     *os.File       // 文件
 	mu     sync.RWMutex   // 互斥锁
+	aead   cipher.AEAD    // value 加密器，未配置密钥时为 nil
+
+	header    *fileHeader // 文件头，没有文件头的旧文件版本为 fileVersionLegacy
+	dataStart uint32      // 第一条记录的偏移
+	corrupt   bool        // Decode 在文件中间遇到无法解析的记录，之后还有数据
 }
 
 func NewWal(conf *config.Config, fileId uint32) (*Wal, error) {
-	filePath := filepath.Join(conf.DataDir, conf.WalDir, fmt.Sprintf("wal-%d.log", fileId))
-	fp, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	return NewWalIn(conf, filepath.Join(conf.DataDir, conf.WalDir), fileId)
+}
+
+// NewWalIn 在 dir 目录下打开或创建WAL文件，文件名与 WalDir 下的文件相同。
+// Merge 先将合并结果写入单独的目录，完成后再移动到 WalDir
+func NewWalIn(conf *config.Config, dir string, fileId uint32) (*Wal, error) {
+	return openFile(conf, filepath.Join(dir, FileName(fileId)), fileId)
+}
+
+// FileName 返回WAL文件的文件名
+func FileName(fileId uint32) string {
+	return fmt.Sprintf("wal-%d.log", fileId)
+}
+
+// NewBlobFile 打开或创建 BlobDir 下的 blob 文件。blob 文件与WAL文件格式相同，
+// 只保存超过 BlobThreshold 的 value 对应的写入记录，不会被重放
+func NewBlobFile(conf *config.Config, fileId uint32) (*Wal, error) {
+	return openFile(conf, filepath.Join(conf.DataDir, conf.BlobDir, fmt.Sprintf("blob-%d.log", fileId)), fileId)
+}
+
+func openFile(conf *config.Config, filePath string, fileId uint32) (*Wal, error) {
+	var aead cipher.AEAD
+	if len(conf.EncryptionKey) > 0 {
+		var err error
+		if aead, err = record.NewCipher(conf.EncryptionKey); err != nil {
+			return nil, err
+		}
+	}
+	flag := os.O_RDWR | os.O_APPEND
+	if conf.ReadOnly {
+		flag = os.O_RDONLY
+	} else if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		if err := createWalFile(filePath, fileId); err != nil {
+			return nil, fmt.Errorf("创建WAL文件失败: %v", err)
+		}
+	}
+	fp, err := os.OpenFile(filePath, flag, 0644)
 	if err != nil {
 		return nil, err
 	}
-	return &Wal{conf: conf, fileId: fileId, fp: fp}, nil
+	header, err := readFileHeader(fp, conf, fileId)
+	if err != nil {
+		fp.Close()
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	w := &Wal{conf: conf, fileId: fileId, fp: fp, aead: aead, header: header}
+	if header.version != fileVersionLegacy {
+		w.dataStart = FileHeaderSize
+	}
+	w.offset = w.dataStart
+	w.UpdateOffset()
+	return w, nil
+}
+
+// CreatedAt 返回文件头中记录的创建时间，没有文件头的旧文件返回零值
+func (w *Wal) CreatedAt() time.Time {
+	if w.header.createdAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, w.header.createdAt)
+}
+
+// DataStart 返回第一条记录的偏移，即文件头的长度，没有文件头的旧文件为0
+func (w *Wal) DataStart() uint32 {
+	return w.dataStart
 }
 
 func (w *Wal) Write(key, value []byte) (*record.Pos, error) {
@@ -39,6 +147,18 @@ func (w *Wal) Write(key, value []byte) (*record.Pos, error) {
 	return w.write(rec)
 }
 
+// WriteNoSync 写入记录但忽略 AutoSync，由调用方负责之后调用 Sync
+func (w *Wal) WriteNoSync(key, value []byte) (*record.Pos, error) {
+	rec := record.NewRecord(key, value)
+	return w.writeRecord(rec, false)
+}
+
+// WriteWithExpire 写入带过期时间（UnixNano）的记录
+func (w *Wal) WriteWithExpire(key, value []byte, expireAt int64) (*record.Pos, error) {
+	rec := record.NewRecordWithExpire(key, value, expireAt)
+	return w.write(rec)
+}
+
 func (w *Wal) WriteTxn(key, value []byte) (*record.Pos, error) {
 	rec := record.NewTxnRecord(key, value)
 	return w.write(rec)
@@ -52,11 +172,30 @@ func (w *Wal) WriteTxnBegin(key []byte) (*record.Pos, error) {
 	return w.write(rec)
 }
 
+// WriteRecord 写入调用方构造的记录，Timestamp 为0时使用当前时间；Merge 用它保留记录原来的写入时间
+func (w *Wal) WriteRecord(rec *record.Record) (*record.Pos, error) {
+	return w.write(rec)
+}
+
+// WriteRecordNoSync 与 WriteRecord 相同，但忽略 AutoSync，由调用方负责之后调用 Sync
+func (w *Wal) WriteRecordNoSync(rec *record.Record) (*record.Pos, error) {
+	return w.writeRecord(rec, false)
+}
+
 func (w *Wal) write(rec *record.Record) (*record.Pos, error) {
+	return w.writeRecord(rec, w.conf.AutoSync)
+}
+
+func (w *Wal) writeRecord(rec *record.Record, sync bool) (*record.Pos, error) {
+	w.compress(rec)
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	// 持有锁分配时间戳，同一文件中记录的时间戳与写入顺序一致
+	if rec.Timestamp == 0 {
+		rec.Timestamp = nextTimestamp()
+	}
 	preOffset := w.offset
-	encoded, err := rec.Encode()
+	encoded, err := rec.EncodeWithCipher(w.aead)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +203,7 @@ func (w *Wal) write(rec *record.Record) (*record.Pos, error) {
 	if err != nil {
 		return nil, err
 	}
-	if w.conf.AutoSync {
+	if sync {
 		if err := w.fp.Sync(); err != nil {
 			return nil, err
 		}
@@ -76,6 +215,19 @@ func (w *Wal) write(rec *record.Record) (*record.Pos, error) {
 		Length: uint32(length),
 	}, nil
 }
+
+// compress 按配置压缩 value，压缩后没有变小则保持原样
+func (w *Wal) compress(rec *record.Record) {
+	if w.conf.Compression != config.CompressionSnappy || len(rec.Value) == 0 {
+		return
+	}
+	encoded := snappy.Encode(nil, rec.Value)
+	if len(encoded) < len(rec.Value) {
+		rec.Value = encoded
+		rec.Compressed = true
+	}
+}
+
 func (w *Wal) Close() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -126,209 +278,355 @@ func (w *Wal) ReadPos(pos *record.Pos) (*record.Record, error) {
 	}
 
 	// 解码记录
-	rec, err := record.DecodeRecord(buf)
+	rec, err := record.DecodeRecordWithCipher(buf, w.aead, decodeLimits(w.conf))
 	if err != nil {
 		// 记录解码失败但有数据，提供更多细节
-		return nil, fmt.Errorf("failed to decode record at offset %d: %v", pos.Offset, err)
+		return nil, fmt.Errorf("failed to decode record at offset %d: %w", pos.Offset, err)
+	}
+	// 压缩标志记录在每条记录中，与当前配置无关
+	if rec.Compressed {
+		value, err := snappy.Decode(nil, rec.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress record at offset %d: %v", pos.Offset, err)
+		}
+		rec.Value = value
+		rec.Compressed = false
 	}
 
 	return rec, nil
 }
 
-type txnData struct {
-	rec *record.Record
-	pos *record.Pos
+// replayEntry 解析出的一条记录，重放只需要记录类型、键和位置，不保留 value
+type replayEntry struct {
+	recordType record.RecordType
+	key        []byte // 事务记录包含事务ID前缀
+	pos        record.Pos
+}
+
+// ReplayState 重放WAL时未提交的事务状态。批处理的记录可能跨越多个WAL文件，
+// 按顺序重放多个文件时需要共用同一个 ReplayState
+type ReplayState struct {
+	batchData map[uint32][]replayEntry // 尚未看到提交记录的事务写入，键已去掉事务ID
+	txnFlag   bool                     // 是否处于事务中
+	curTxnId  uint32                   // 当前事务ID
+}
+
+// NewReplayState 创建空的重放状态
+func NewReplayState() *ReplayState {
+	return &ReplayState{batchData: make(map[uint32][]replayEntry)}
+}
+
+// Segment 解析好的WAL文件，保存文件中每条记录的类型、键和位置
+//
+// 不同文件的 Decode 相互独立，可以并发执行；Apply 必须按文件ID从小到大依次调用，
+// 后写入的记录才能覆盖先写入的记录，跨文件的事务也才能在看到提交记录时生效
+type Segment struct {
+	wal     *Wal
+	entries []replayEntry
 }
 
+// ReadAll 重放单个WAL文件，文件中未提交的事务会被丢弃
 func (w *Wal) ReadAll(memTable index.Index, dbTxnId *atomic.Uint32) error {
-	// 将文件指针移到开始位置
-	if _, err := w.fp.Seek(0, 0); err != nil {
+	return w.ReadAllWithState(memTable, dbTxnId, NewReplayState())
+}
+
+// ReadAllWithState 重放WAL文件，state 中保存此前文件里尚未提交的事务，
+// 事务的提交记录出现在本文件时，之前文件中的事务写入一并生效
+func (w *Wal) ReadAllWithState(memTable index.Index, dbTxnId *atomic.Uint32, state *ReplayState) error {
+	segment, err := w.Decode()
+	if err != nil {
 		return err
 	}
+	return segment.Apply(memTable, dbTxnId, state)
+}
 
-	if w.conf.Debug {
-		fmt.Printf("开始从文件ID=%d读取全部记录\n", w.fileId)
-	}
+// Decode 解析并校验文件中的全部记录，不修改索引。返回错误时不会产生任何部分结果，
+// 宽松模式下遇到CRC错误或文件末尾不完整时只保留之前的记录。
+// 只有不完整的记录延伸到文件末尾时才是写入中断留下的尾部，否则记为文件中间的损坏
+func (w *Wal) Decode() (*Segment, error) {
+	w.conf.Debugf("开始从文件ID=%d读取全部记录", w.fileId)
 
 	// 获取文件大小
 	fileInfo, err := w.fp.Stat()
 	if err != nil {
-		return fmt.Errorf("无法获取文件大小: %v", err)
+		return nil, fmt.Errorf("无法获取文件大小: %v", err)
 	}
 	fileSize := fileInfo.Size()
 
-	// 读取整个文件
-	buffer := make([]byte, fileSize)
-	n, err := w.fp.ReadAt(buffer, 0)
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("读取文件内容失败: %v", err)
-	}
-	if int64(n) < fileSize {
-		fmt.Printf("警告：仅读取了文件部分内容: %d 字节，总大小 %d 字节\n", n, fileSize)
-	}
-
-	batchData := make(map[uint32][]*txnData)
-	txnFlag := false
-	curTxnId := uint32(0)
-	updatedFunc := func(rec *record.Record, pos *record.Pos) error {
-		if rec.RecordType == record.RecordTypeBegin {
-			txnFlag = true
-			curTxnId, _ = utils.DecodeTxnId(rec.Key)
-			return nil
-		}
-		// 事务开始标志
-		if txnFlag {
-			if rec.RecordType == record.RecordTypeTxnPut {
-				if w.conf.Debug {
-					fmt.Printf("处理事务写入记录: key=%s, value=%s\n", string(rec.Key), string(rec.Value))
-				}
-				txnId, decKey := utils.DecodeTxnId(rec.Key)
-				if txnId != curTxnId {
-					return fmt.Errorf("事务ID不匹配: %d != %d", txnId, curTxnId)
-				}
-				rec.Key = decKey
-				batchData[txnId] = append(batchData[txnId], &txnData{
-					rec: rec,
-					pos: pos,
-				})
-			} else if rec.RecordType == record.RecordTypeTxnDelete {
-				if w.conf.Debug {
-					fmt.Printf("处理事务删除记录: key=%s\n", string(rec.Key))
-				}
-				txnId, decKey := utils.DecodeTxnId(rec.Key)
-				if txnId != curTxnId {
-					return fmt.Errorf("事务ID不匹配: %d != %d", txnId, curTxnId)
-				}
-				rec.Key = decKey
-				batchData[txnId] = append(batchData[txnId], &txnData{
-					rec: rec,
-					pos: pos,
-				})
-			} else if rec.RecordType == record.RecordTypeTxnCommit {
-				if w.conf.Debug {
-					fmt.Printf("处理事务提交记录: key=%s\n", string(rec.Key))
-				}
-				txnId, _ := utils.DecodeTxnId(rec.Key)
-				if txnId != curTxnId {
-					return fmt.Errorf("事务ID不匹配: %d != %d", txnId, curTxnId)
-				}
-				for _, rec := range batchData[txnId] {
-					if rec.rec.RecordType == record.RecordTypeTxnPut {
-						if err := memTable.Put(rec.rec.Key, rec.pos); err != nil {
-							return fmt.Errorf("更新索引失败: %v", err)
-						}
-					} else if rec.rec.RecordType == record.RecordTypeTxnDelete {
-						if err := memTable.Delete(rec.rec.Key); err != nil {
-							return fmt.Errorf("删除索引失败: %v", err)
-						}
-					}
-				}
-				delete(batchData, txnId) // 删除事务数据
-				dbTxnId.Store(curTxnId)  // 更新事务ID
-				curTxnId = 0             // 重置事务ID
-				txnFlag = false          // 重置事务标志
-				return nil
-			}
-		} else {
-			// 基于记录类型处理
-			if rec.RecordType == record.RecordTypeDelete {
-				if w.conf.Debug {
-					fmt.Printf("处理删除记录: key=%s\n", string(rec.Key))
-				}
-				if err := memTable.Delete(rec.Key); err != nil {
-					return fmt.Errorf("删除索引失败: %v", err)
-				}
-			} else if rec.RecordType == record.RecordTypePut {
-				if w.conf.Debug {
-					fmt.Printf("处理普通记录: key=%s, value=%s\n", string(rec.Key), string(rec.Value))
-				}
-				if err := memTable.Put(rec.Key, pos); err != nil {
-					return fmt.Errorf("更新索引失败: %v", err)
-				}
-			}
-		}
-		return nil
-	}
-	// 逐条解析记录并保存最新的记录位置
-	var offset uint32 = 0
-	for offset < uint32(n) {
+	// 流式读取文件头之后的记录，内存中只保留当前记录
+	reader := bufio.NewReaderSize(io.NewSectionReader(w.fp, int64(w.dataStart), fileSize-int64(w.dataStart)), readBufferSize)
+
+	// 逐条解析记录并保存记录位置
+	segment := &Segment{wal: w}
+	offset := w.dataStart
+	var header [record.MaxHeaderSize]byte
+	var valueBuf []byte // value 缓冲区在记录之间复用，解析结果只持有 key
+	corrupt := false
+	for int64(offset) < fileSize {
+		remaining := fileSize - int64(offset)
 		// 确保至少能读取头部
-		if offset+9 > uint32(n) {
-			fmt.Printf("文件末尾不完整，停止解析: 剩余 %d 字节\n", uint32(n)-offset)
+		if remaining < record.BaseHeaderSize {
+			w.conf.Warnf("文件末尾不完整，停止解析: 剩余 %d 字节", remaining)
 			break
 		}
+		if _, err := io.ReadFull(reader, header[:record.BaseHeaderSize]); err != nil {
+			return nil, fmt.Errorf("读取记录头失败 (offset=%d): %v", offset, err)
+		}
 
 		// 记录起始位置
 		recordStartOffset := offset
 
-		// 读取记录类型
-		recordType := record.RecordType(buffer[offset])
-
-		// 读取 key 长度
-		keyLength := binary.BigEndian.Uint32(buffer[offset+1 : offset+5])
-
-		// 读取 value 长度
-		valueLength := binary.BigEndian.Uint32(buffer[offset+5 : offset+9])
+		// 扩展头部（带过期时间）需要继续读取剩余部分
+		headerSize := record.HeaderSize(header[0])
+		if int64(headerSize) > remaining {
+			w.conf.Warnf("文件末尾不完整，停止解析: 剩余 %d 字节", remaining)
+			break
+		}
+		if headerSize > record.BaseHeaderSize {
+			if _, err := io.ReadFull(reader, header[record.BaseHeaderSize:headerSize]); err != nil {
+				return nil, fmt.Errorf("读取记录头失败 (offset=%d): %v", offset, err)
+			}
+		}
 
-		// 检查 key 和 value 长度的合理性
-		if keyLength > 10*1024*1024 || valueLength > 100*1024*1024 {
-			fmt.Printf("警告: 可能的数据损坏 - key长度: %d, value长度: %d\n", keyLength, valueLength)
+		// 解析记录类型、key/value 长度并检查合理性
+		h, err := record.DecodeHeader(header[:headerSize], decodeLimits(w.conf))
+		if err != nil {
+			// 头部完整但无法解析，不知道记录的长度，无法判断之后是否只有这一条记录
+			w.conf.Warnf("可能的数据损坏 (offset=%d): %v", offset, err)
+			corrupt = true
 			break
 		}
+		recordType, keyLength, valueLength := h.RecordType, h.KeyLength, h.ValueLength
 
 		// 计算记录总长度
-		recordLength := 9 + keyLength + valueLength + 4
+		recordLength := headerSize + keyLength + valueLength + record.CrcSize
 
 		// 确保能读取完整的记录
-		if offset+recordLength > uint32(n) {
-			fmt.Printf("文件末尾记录不完整，停止解析: 需要 %d 字节，剩余 %d 字节\n",
-				recordLength, uint32(n)-offset)
+		if int64(recordLength) > remaining {
+			w.conf.Warnf("文件末尾记录不完整，停止解析: 需要 %d 字节，剩余 %d 字节",
+				recordLength, remaining)
 			break
 		}
 
 		// 读取 key 和 value
-		key := buffer[offset+9 : offset+9+keyLength]
-		value := buffer[offset+9+keyLength : offset+9+keyLength+valueLength]
+		key := make([]byte, keyLength)
+		if _, err := io.ReadFull(reader, key); err != nil {
+			return nil, fmt.Errorf("读取key失败 (offset=%d): %v", offset, err)
+		}
+		if uint32(cap(valueBuf)) < valueLength {
+			valueBuf = make([]byte, valueLength)
+		}
+		value := valueBuf[:valueLength]
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, fmt.Errorf("读取value失败 (offset=%d): %v", offset, err)
+		}
 
 		// 读取 CRC
-		crc := binary.BigEndian.Uint32(buffer[offset+9+keyLength+valueLength : offset+recordLength])
+		var crcBuf [record.CrcSize]byte
+		if _, err := io.ReadFull(reader, crcBuf[:]); err != nil {
+			return nil, fmt.Errorf("读取CRC失败 (offset=%d): %v", offset, err)
+		}
+		crc := binary.BigEndian.Uint32(crcBuf[:])
 
 		// 计算CRC进行验证
-		computedCrc := crc32.ChecksumIEEE(buffer[offset : offset+9+keyLength+valueLength])
+		computedCrc := crc32.ChecksumIEEE(header[:headerSize])
+		computedCrc = crc32.Update(computedCrc, crc32.IEEETable, key)
+		computedCrc = crc32.Update(computedCrc, crc32.IEEETable, value)
 		if crc != computedCrc {
-			fmt.Printf("警告: CRC校验失败 (offset=%d) - 存储的: %d, 计算的: %d\n",
-				offset, crc, computedCrc)
-			// 继续处理，但记录警告
+			if w.conf.StrictCRC {
+				return nil, fmt.Errorf("%w: fileId=%d, offset=%d, 存储的: %d, 计算的: %d",
+					ErrCRCMismatch, w.fileId, offset, crc, computedCrc)
+			}
+			// 宽松模式：忽略该文件剩余部分。最后一条记录的CRC错误通常意味着文件尾部写入不完整，
+			// 之后还有记录时是文件中间的损坏
+			w.conf.Warnf("CRC校验失败 (fileId=%d, offset=%d) - 存储的: %d, 计算的: %d，停止解析该文件",
+				w.fileId, offset, crc, computedCrc)
+			corrupt = int64(recordLength) < remaining
+			break
+		}
+		// CRC 正确说明记录完整，类型未知时是更新的版本写入的，忽略它会丢失数据
+		if !recordType.Known() {
+			return nil, fmt.Errorf("%w: fileId=%d, offset=%d, type=%d",
+				record.ErrUnsupportedRecord, w.fileId, offset, recordType)
 		}
 
 		if w.conf.Debug {
-			fmt.Printf("解析记录: type=%d, key=%s, keyLen=%d, valueLen=%d, offset=%d, len=%d\n",
+			w.conf.Debugf("解析记录: type=%d, key=%s, keyLen=%d, valueLen=%d, offset=%d, len=%d",
 				recordType, string(key), keyLength, valueLength, offset, recordLength)
 		}
 
-		rec := &record.Record{
-			RecordType: recordType,
-			Key:        key,
-			Value:      value,
-		}
-		pos := &record.Pos{
-			FileId: w.fileId,
-			Offset: recordStartOffset, // 使用记录的实际起始位置
-			Length: recordLength,
-		}
-		if err := updatedFunc(rec, pos); err != nil {
-			return err
-		}
+		segment.entries = append(segment.entries, replayEntry{
+			recordType: recordType,
+			key:        key,
+			pos: record.Pos{
+				FileId: w.fileId,
+				Offset: recordStartOffset, // 使用记录的实际起始位置
+				Length: recordLength,
+			},
+		})
 		// 更新偏移量
 		offset += recordLength
 	}
 
-	if w.conf.Debug {
-		fmt.Printf("文件ID=%d读取完成，处理了 %d 字节\n", w.fileId, offset)
-	}
+	w.conf.Debugf("文件ID=%d读取完成，处理了 %d 字节", w.fileId, offset)
 	// 更新WAL实例的offset以反映文件的实际大小
 	w.offset = offset
+	w.corrupt = corrupt
 
+	return segment, nil
+}
+
+// Apply 按记录在文件中的顺序更新索引，state 中保存此前文件里尚未提交的事务
+func (s *Segment) Apply(memTable index.Index, dbTxnId *atomic.Uint32, state *ReplayState) error {
+	conf := s.wal.conf
+	// 每条记录单独分配位置，索引不引用解析结果，应用后解析结果可以被回收
+	put := func(key []byte, pos record.Pos) error {
+		return memTable.Put(key, &pos)
+	}
+	// 逐条记录的调试日志需要格式化key，先判断 Debug 避免关闭时的开销
+	for _, entry := range s.entries {
+		switch entry.recordType {
+		case record.RecordTypeBegin:
+			// 同一时间只有一个事务在写入，之前未提交的事务（如写入时崩溃）不会再提交
+			clear(state.batchData)
+			state.txnFlag = true
+			state.curTxnId, _ = utils.DecodeTxnId(entry.key)
+		case record.RecordTypeTxnPut, record.RecordTypeTxnDelete, record.RecordTypeTxnBlobPut:
+			if !state.txnFlag {
+				// 没有开始记录的事务写入无法确认是否提交，忽略
+				continue
+			}
+			if conf.Debug {
+				conf.Debugf("处理事务记录: type=%d, key=%s", entry.recordType, string(entry.key))
+			}
+			txnId, decKey := utils.DecodeTxnId(entry.key)
+			if txnId != state.curTxnId {
+				return fmt.Errorf("事务ID不匹配: %d != %d", txnId, state.curTxnId)
+			}
+			entry.key = decKey
+			state.batchData[txnId] = append(state.batchData[txnId], entry)
+		case record.RecordTypeTxnCommit:
+			if !state.txnFlag {
+				continue
+			}
+			if conf.Debug {
+				conf.Debugf("处理事务提交记录: key=%s", string(entry.key))
+			}
+			txnId, _ := utils.DecodeTxnId(entry.key)
+			if txnId != state.curTxnId {
+				return fmt.Errorf("事务ID不匹配: %d != %d", txnId, state.curTxnId)
+			}
+			// 事务写入和删除都让索引指向对应的记录，删除时指向删除标记，以便区分"已删除"和"不存在"
+			for _, data := range state.batchData[txnId] {
+				if err := put(data.key, data.pos); err != nil {
+					return fmt.Errorf("更新索引失败: %v", err)
+				}
+			}
+			delete(state.batchData, txnId) // 删除事务数据
+			dbTxnId.Store(state.curTxnId)  // 更新事务ID
+			state.curTxnId = 0             // 重置事务ID
+			state.txnFlag = false          // 重置事务标志
+		case record.RecordTypeDelete:
+			// 普通写入和删除不属于事务，即使与事务的记录交错也直接生效
+			if conf.Debug {
+				conf.Debugf("处理删除记录: key=%s", string(entry.key))
+			}
+			// 索引指向删除标记，以便区分"已删除"和"不存在"
+			if err := put(entry.key, entry.pos); err != nil {
+				return fmt.Errorf("更新删除标记失败: %v", err)
+			}
+		case record.RecordTypePut, record.RecordTypeBlobPut:
+			if conf.Debug {
+				conf.Debugf("处理普通记录: key=%s", string(entry.key))
+			}
+			if err := put(entry.key, entry.pos); err != nil {
+				return fmt.Errorf("更新索引失败: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Verify 只读地检查文件中的每条记录，结构损坏或CRC校验失败时调用 report，返回校验通过的记录数
+//
+// CRC校验失败时按头部中的长度跳到下一条记录继续检查；头部无法解析或记录超出文件末尾时
+// 无法确定下一条记录的位置，报告后停止检查该文件。检查范围是调用时文件的大小
+func (w *Wal) Verify(report func(offset uint32, reason string)) (int, error) {
+	// 持有读锁获取文件大小，确保不包含正在写入的半条记录
+	w.mu.RLock()
+	fileInfo, err := w.fp.Stat()
+	w.mu.RUnlock()
+	if err != nil {
+		return 0, fmt.Errorf("无法获取文件大小: %v", err)
+	}
+	fileSize := fileInfo.Size()
+	reader := bufio.NewReaderSize(io.NewSectionReader(w.fp, int64(w.dataStart), fileSize-int64(w.dataStart)), readBufferSize)
+
+	valid := 0
+	offset := w.dataStart
+	var header [record.MaxHeaderSize]byte
+	var body []byte // key、value 和 CRC，在记录之间复用
+	for int64(offset) < fileSize {
+		remaining := fileSize - int64(offset)
+		if remaining < record.BaseHeaderSize {
+			report(offset, fmt.Sprintf("文件末尾不完整: 剩余 %d 字节", remaining))
+			break
+		}
+		if _, err := io.ReadFull(reader, header[:record.BaseHeaderSize]); err != nil {
+			return valid, fmt.Errorf("读取记录头失败 (offset=%d): %v", offset, err)
+		}
+		headerSize := record.HeaderSize(header[0])
+		if int64(headerSize) > remaining {
+			report(offset, fmt.Sprintf("文件末尾不完整: 剩余 %d 字节", remaining))
+			break
+		}
+		if headerSize > record.BaseHeaderSize {
+			if _, err := io.ReadFull(reader, header[record.BaseHeaderSize:headerSize]); err != nil {
+				return valid, fmt.Errorf("读取记录头失败 (offset=%d): %v", offset, err)
+			}
+		}
+		h, err := record.DecodeHeader(header[:headerSize], decodeLimits(w.conf))
+		if err != nil {
+			report(offset, fmt.Sprintf("记录头损坏: %v", err))
+			break
+		}
+		// 长度在 int64 中计算，避免损坏的长度字段在 uint32 中溢出
+		recordLength := int64(headerSize) + int64(h.KeyLength) + int64(h.ValueLength) + record.CrcSize
+		if recordLength > remaining {
+			report(offset, fmt.Sprintf("记录不完整: 需要 %d 字节，剩余 %d 字节", recordLength, remaining))
+			break
+		}
+		bodyLength := uint32(recordLength) - headerSize
+		if uint32(cap(body)) < bodyLength {
+			body = make([]byte, bodyLength)
+		}
+		body = body[:bodyLength]
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return valid, fmt.Errorf("读取记录失败 (offset=%d): %v", offset, err)
+		}
+
+		data := body[:bodyLength-record.CrcSize]
+		crc := binary.BigEndian.Uint32(body[bodyLength-record.CrcSize:])
+		computedCrc := crc32.Update(crc32.ChecksumIEEE(header[:headerSize]), crc32.IEEETable, data)
+		if crc != computedCrc {
+			report(offset, fmt.Sprintf("CRC校验失败: 存储的 %d, 计算的 %d", crc, computedCrc))
+		} else if !h.RecordType.Known() {
+			report(offset, fmt.Sprintf("不支持的记录类型 %d，可能由更新的版本写入", h.RecordType))
+		} else {
+			valid++
+		}
+		offset += headerSize + bodyLength
+	}
+	return valid, nil
+}
+
+// CopyTo 将文件前 n 个字节复制到 dst，用于备份
+func (w *Wal) CopyTo(dst io.Writer, n uint32) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if _, err := io.Copy(dst, io.NewSectionReader(w.fp, 0, int64(n))); err != nil {
+		return fmt.Errorf("复制WAL文件 %d 失败: %v", w.fileId, err)
+	}
 	return nil
 }
 
@@ -358,6 +656,29 @@ func (w *Wal) UpdateOffset() {
 	}
 	w.offset = uint32(fileInfo.Size())
 }
+
+// TruncateTail 把文件截断到 Decode 解析到的最后一条完整记录之后，返回截掉的字节数。
+// 宽松模式下 Decode 遇到损坏的记录会停止解析，不截断时之后追加的记录也会在下次重放时被一起忽略。
+// 损坏的记录之后还有数据时截断会丢掉其中完整的记录，不修改文件并返回 ErrCorruptRecord
+func (w *Wal) TruncateTail() (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.corrupt {
+		return 0, fmt.Errorf("%w: fileId=%d, offset=%d", ErrCorruptRecord, w.fileId, w.offset)
+	}
+	fileInfo, err := w.fp.Stat()
+	if err != nil {
+		return 0, err
+	}
+	tail := fileInfo.Size() - int64(w.offset)
+	if tail <= 0 {
+		return 0, nil
+	}
+	if err := w.fp.Truncate(int64(w.offset)); err != nil {
+		return 0, err
+	}
+	return tail, w.fp.Sync()
+}
 func (w *Wal) Delete() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -1,10 +1,13 @@
 package wal
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aixiasang/bitcask/config"
 	"github.com/aixiasang/bitcask/index"
@@ -40,7 +43,9 @@ func TestNewWal(t *testing.T) {
 	assert.NotNil(t, wal)
 
 	assert.Equal(t, uint32(1), wal.FileId())
-	assert.Equal(t, uint32(0), wal.Size())
+	// 新文件只包含文件头
+	assert.Equal(t, uint32(FileHeaderSize), wal.Size())
+	assert.False(t, wal.CreatedAt().IsZero())
 
 	// 清理
 	err = wal.Close()
@@ -62,11 +67,11 @@ func TestWal_Write(t *testing.T) {
 
 	// 验证返回的位置信息
 	assert.Equal(t, uint32(1), pos.FileId)
-	assert.Equal(t, uint32(0), pos.Offset)
+	assert.Equal(t, uint32(FileHeaderSize), pos.Offset)
 	assert.Greater(t, pos.Length, uint32(0))
 
 	// 验证 WAL 大小增加了
-	assert.Equal(t, pos.Length, wal.Size())
+	assert.Equal(t, FileHeaderSize+pos.Length, wal.Size())
 
 	// 清理
 	err = wal.Close()
@@ -121,10 +126,13 @@ func TestWal_Delete(t *testing.T) {
 	err = wal.ReadAll(memTable, &atomic.Uint32{})
 	assert.NoError(t, err)
 
-	// 验证记录已删除
+	// 验证索引指向删除标记
 	pos, err := memTable.Get(key)
 	assert.NoError(t, err)
-	assert.Nil(t, pos)
+	assert.NotNil(t, pos)
+	rec, err := wal.ReadPos(pos)
+	assert.NoError(t, err)
+	assert.True(t, rec.IsDeleted())
 
 	// 清理
 	err = wal.Close()
@@ -336,3 +344,303 @@ func TestWal_LargeData(t *testing.T) {
 	err = wal.Close()
 	assert.NoError(t, err)
 }
+
+// 测试流式重放大文件时内存分配有上限
+func TestWal_ReadAllBoundedAlloc(t *testing.T) {
+	conf := createTestConfig(t)
+	wal, err := NewWal(conf, 1)
+	assert.NoError(t, err)
+	defer wal.Close()
+
+	// 写入约 16MB 的段文件，每条记录 256KB
+	valueData := make([]byte, 256*1024)
+	for i := range valueData {
+		valueData[i] = byte(i % 251)
+	}
+	recordCount := 64
+	for i := 0; i < recordCount; i++ {
+		_, err := wal.Write([]byte(fmt.Sprintf("big_key_%03d", i)), valueData)
+		assert.NoError(t, err)
+	}
+	fileSize := int64(wal.Size())
+	assert.Greater(t, fileSize, int64(16*1024*1024))
+
+	memTable := index.NewBTreeIndex(32)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	err = wal.ReadAll(memTable, &atomic.Uint32{})
+	runtime.ReadMemStats(&after)
+	assert.NoError(t, err)
+
+	// 重放过程中的总分配量应远小于文件大小
+	allocated := int64(after.TotalAlloc - before.TotalAlloc)
+	assert.Less(t, allocated, fileSize/4, "重放分配了 %d 字节, 文件大小 %d 字节", allocated, fileSize)
+
+	// 偏移量和索引位置仍然正确
+	assert.Equal(t, uint32(fileSize), wal.Size())
+	for i := 0; i < recordCount; i++ {
+		pos, err := memTable.Get([]byte(fmt.Sprintf("big_key_%03d", i)))
+		assert.NoError(t, err)
+		rec, err := wal.ReadPos(pos)
+		assert.NoError(t, err)
+		assert.Equal(t, valueData, rec.Value)
+	}
+}
+
+// 写入三条记录并翻转第二条记录 value 中的一个字节
+func writeCorruptedWal(t *testing.T, conf *config.Config) (*Wal, []*record.Pos) {
+	wal, err := NewWal(conf, 1)
+	assert.NoError(t, err)
+	var positions []*record.Pos
+	for i := 1; i <= 3; i++ {
+		pos, err := wal.Write([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+		assert.NoError(t, err)
+		positions = append(positions, pos)
+	}
+	// 翻转第二条记录最后一个 value 字节（CRC 前一个字节）
+	flipAt := int64(positions[1].Offset + positions[1].Length - 5)
+	buf := make([]byte, 1)
+	_, err = wal.fp.ReadAt(buf, flipAt)
+	assert.NoError(t, err)
+	buf[0] ^= 0xFF
+	fp, err := os.OpenFile(wal.fp.Name(), os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = fp.WriteAt(buf, flipAt)
+	assert.NoError(t, err)
+	assert.NoError(t, fp.Close())
+	return wal, positions
+}
+
+// 测试严格模式下CRC错误会中止重放
+func TestWal_ReadAllStrictCRC(t *testing.T) {
+	conf := createTestConfig(t)
+	conf.StrictCRC = true
+	wal, positions := writeCorruptedWal(t, conf)
+	defer wal.Close()
+
+	memTable := index.NewBTreeIndex(2)
+	err := wal.ReadAll(memTable, &atomic.Uint32{})
+	assert.ErrorIs(t, err, ErrCRCMismatch)
+	assert.Contains(t, err.Error(), "fileId=1")
+	assert.Contains(t, err.Error(), fmt.Sprintf("offset=%d", positions[1].Offset))
+}
+
+// 测试宽松模式下CRC错误会停止解析该文件剩余部分
+func TestWal_ReadAllLenientCRC(t *testing.T) {
+	conf := createTestConfig(t)
+	wal, positions := writeCorruptedWal(t, conf)
+	defer wal.Close()
+
+	memTable := index.NewBTreeIndex(2)
+	err := wal.ReadAll(memTable, &atomic.Uint32{})
+	assert.NoError(t, err)
+
+	// 损坏记录之前的数据保留
+	pos, err := memTable.Get([]byte("key1"))
+	assert.NoError(t, err)
+	assert.Equal(t, positions[0], pos)
+
+	// 损坏记录及其之后的数据都不会被索引
+	pos, err = memTable.Get([]byte("key2"))
+	assert.NoError(t, err)
+	assert.Nil(t, pos)
+	pos, err = memTable.Get([]byte("key3"))
+	assert.NoError(t, err)
+	assert.Nil(t, pos)
+}
+
+// 测试截断写入中断留下的不完整尾部，之后追加的记录在重新解析时不会被忽略
+func TestWal_TruncateTail(t *testing.T) {
+	conf := createTestConfig(t)
+	wal, err := NewWal(conf, 1)
+	assert.NoError(t, err)
+	defer wal.Close()
+	var positions []*record.Pos
+	for i := 1; i <= 3; i++ {
+		pos, err := wal.Write([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+		assert.NoError(t, err)
+		positions = append(positions, pos)
+	}
+	// 最后一条记录只写入了一部分
+	assert.NoError(t, wal.fp.Truncate(int64(positions[2].Offset+positions[2].Length-3)))
+
+	_, err = wal.Decode()
+	assert.NoError(t, err)
+	n, err := wal.TruncateTail()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(positions[2].Length-3), n)
+	assert.Equal(t, positions[2].Offset, wal.Size())
+
+	pos, err := wal.Write([]byte("key4"), []byte("value4"))
+	assert.NoError(t, err)
+	assert.Equal(t, positions[2].Offset, pos.Offset)
+	memTable := index.NewBTreeIndex(2)
+	assert.NoError(t, wal.ReadAll(memTable, &atomic.Uint32{}))
+	got, err := memTable.Get([]byte("key4"))
+	assert.NoError(t, err)
+	assert.Equal(t, pos, got)
+
+	// 没有损坏的数据时不截断
+	n, err = wal.TruncateTail()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+// 测试损坏的记录之后还有完整的记录时不截断文件
+func TestWal_TruncateTailMidFileCorruption(t *testing.T) {
+	conf := createTestConfig(t)
+	wal, positions := writeCorruptedWal(t, conf)
+	defer wal.Close()
+
+	_, err := wal.Decode()
+	assert.NoError(t, err)
+	n, err := wal.TruncateTail()
+	assert.ErrorIs(t, err, ErrCorruptRecord)
+	assert.Equal(t, int64(0), n)
+	info, err := wal.fp.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(positions[2].Offset+positions[2].Length), info.Size())
+}
+
+// 测试同一个文件中混合存放的 v0、v1、v2 记录都能重放和读取
+func TestWal_ReadAllMixedVersions(t *testing.T) {
+	conf := createTestConfig(t)
+
+	// v0 和 v1 记录没有时间戳，只能直接编码后写入文件
+	expireAt := time.Now().Add(time.Hour).UnixNano()
+	v0, err := record.NewRecord([]byte("v0"), []byte("value0")).Encode()
+	assert.NoError(t, err)
+	v1, err := record.NewRecordWithExpire([]byte("v1"), []byte("value1"), expireAt).Encode()
+	assert.NoError(t, err)
+	walPath := filepath.Join(conf.DataDir, conf.WalDir, "wal-1.log")
+	assert.NoError(t, os.WriteFile(walPath, append(v0, v1...), 0644))
+
+	wal, err := NewWal(conf, 1)
+	assert.NoError(t, err)
+	defer wal.Close()
+	assert.NoError(t, wal.ReadAll(index.NewBTreeIndex(2), &atomic.Uint32{}))
+	// WAL 写入的记录带有时间戳（v2）
+	_, err = wal.WriteRecord(record.NewRecordWithExpire([]byte("v2"), []byte("value2"), expireAt))
+	assert.NoError(t, err)
+
+	memTable := index.NewBTreeIndex(2)
+	assert.NoError(t, wal.ReadAll(memTable, &atomic.Uint32{}))
+	cases := []struct {
+		key      string
+		value    string
+		expireAt int64
+		stamped  bool
+	}{
+		{"v0", "value0", 0, false},
+		{"v1", "value1", expireAt, false},
+		{"v2", "value2", expireAt, true},
+	}
+	for _, c := range cases {
+		pos, err := memTable.Get([]byte(c.key))
+		assert.NoError(t, err)
+		if !assert.NotNil(t, pos, c.key) {
+			continue
+		}
+		rec, err := wal.ReadPos(pos)
+		assert.NoError(t, err)
+		assert.Equal(t, c.value, string(rec.Value), c.key)
+		assert.Equal(t, c.expireAt, rec.ExpireAt, c.key)
+		assert.Equal(t, c.stamped, rec.Timestamp != 0, c.key)
+	}
+}
+
+// 测试类型未知的记录（由更新的版本写入）在宽松模式下也会中止重放，而不是被当作损坏数据丢弃
+func TestWal_ReadAllUnsupportedRecord(t *testing.T) {
+	conf := createTestConfig(t)
+	known, err := record.NewRecord([]byte("key1"), []byte("value1")).Encode()
+	assert.NoError(t, err)
+	future := record.NewRecord([]byte("key2"), []byte("value2"))
+	future.RecordType = record.RecordTypeTxnBlobPut + 1
+	unknown, err := future.Encode()
+	assert.NoError(t, err)
+	walPath := filepath.Join(conf.DataDir, conf.WalDir, "wal-1.log")
+	assert.NoError(t, os.WriteFile(walPath, append(known, unknown...), 0644))
+
+	wal, err := NewWal(conf, 1)
+	assert.NoError(t, err)
+	defer wal.Close()
+	err = wal.ReadAll(index.NewBTreeIndex(2), &atomic.Uint32{})
+	assert.ErrorIs(t, err, record.ErrUnsupportedRecord)
+	assert.Contains(t, err.Error(), fmt.Sprintf("offset=%d", len(known)))
+
+	_, err = wal.ReadPos(&record.Pos{FileId: 1, Offset: uint32(len(known)), Length: uint32(len(unknown))})
+	assert.ErrorIs(t, err, record.ErrUnsupportedRecord)
+
+	var reasons []string
+	valid, err := wal.Verify(func(offset uint32, reason string) { reasons = append(reasons, reason) })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, valid)
+	assert.Len(t, reasons, 1)
+}
+
+// 测试文件头在重新打开时被校验，创建时间保持不变
+func TestWal_FileHeader(t *testing.T) {
+	conf := createTestConfig(t)
+	wal, err := NewWal(conf, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(FileHeaderSize), wal.DataStart())
+	createdAt := wal.CreatedAt()
+	pos, err := wal.Write([]byte("key"), []byte("value"))
+	assert.NoError(t, err)
+	assert.NoError(t, wal.Close())
+
+	wal, err = NewWal(conf, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, createdAt, wal.CreatedAt())
+	assert.Equal(t, pos.Offset+pos.Length, wal.Size())
+	memTable := index.NewBTreeIndex(2)
+	assert.NoError(t, wal.ReadAll(memTable, &atomic.Uint32{}))
+	got, err := memTable.Get([]byte("key"))
+	assert.NoError(t, err)
+	assert.Equal(t, pos, got)
+	assert.NoError(t, wal.Close())
+
+	walPath := filepath.Join(conf.DataDir, conf.WalDir, "wal-1.log")
+	data, err := os.ReadFile(walPath)
+	assert.NoError(t, err)
+	rewrite := func(header []byte) {
+		assert.NoError(t, os.WriteFile(walPath, append(append([]byte{}, header...), data[FileHeaderSize:]...), 0644))
+	}
+
+	// 文件头损坏
+	corrupted := append([]byte{}, data[:FileHeaderSize]...)
+	corrupted[10] ^= 0xFF
+	rewrite(corrupted)
+	_, err = NewWal(conf, 1)
+	assert.ErrorIs(t, err, ErrInvalidFile)
+
+	// 更新版本写入的文件
+	rewrite((&fileHeader{version: fileVersion + 1, fileId: 1, createdAt: createdAt.UnixNano()}).encode())
+	_, err = NewWal(conf, 1)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	// 文件头中的ID与文件名不一致
+	rewrite((&fileHeader{version: fileVersion, fileId: 2, createdAt: createdAt.UnixNano()}).encode())
+	_, err = NewWal(conf, 1)
+	assert.ErrorIs(t, err, ErrInvalidFile)
+
+	// 文件头不完整
+	assert.NoError(t, os.WriteFile(walPath, data[:FileHeaderSize-1], 0644))
+	_, err = NewWal(conf, 1)
+	assert.ErrorIs(t, err, ErrInvalidFile)
+}
+
+// 测试没有文件头且无法解析为旧格式记录的文件被拒绝
+func TestWal_RejectHeaderlessFile(t *testing.T) {
+	conf := createTestConfig(t)
+	walPath := filepath.Join(conf.DataDir, conf.WalDir, "wal-1.log")
+	assert.NoError(t, os.WriteFile(walPath, []byte("this is not a bitcask wal file"), 0644))
+	_, err := NewWal(conf, 1)
+	assert.ErrorIs(t, err, ErrInvalidFile)
+
+	// 只读模式同样拒绝
+	conf.ReadOnly = true
+	_, err = NewWal(conf, 1)
+	assert.ErrorIs(t, err, ErrInvalidFile)
+}
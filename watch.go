@@ -0,0 +1,188 @@
+package bitcask
+
+import "sync"
+
+// subscriberBufferSize 每个订阅方最多缓存的事件数，缓存满时丢弃最旧的事件
+const subscriberBufferSize = 1024
+
+// EventType 变更事件的类型
+type EventType uint8
+
+const (
+	EventPut    EventType = iota // 写入
+	EventDelete                  // 删除
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// OpType OnChange 回调中的操作类型，与 EventType 相同
+type OpType = EventType
+
+// Event 一次成功写入产生的变更事件，Key 和 Value 由所有订阅方共享，不能修改
+type Event struct {
+	Type    EventType
+	Key     []byte
+	Value   []byte // 写入的值，删除事件为nil
+	Dropped uint64 // 该事件之前因为订阅方读取太慢而被丢弃的事件数
+}
+
+// changeEvent 返回写入 key/value 对应的事件，value 为nil时写入的是删除标记
+func changeEvent(key, value []byte) Event {
+	if value == nil {
+		return Event{Type: EventDelete, Key: key}
+	}
+	return Event{Type: EventPut, Key: key, Value: value}
+}
+
+// subscriber 一个订阅方。写入方只把事件放入环形缓冲区，由单独的协程转发到 ch，
+// 订阅方读取太慢时覆盖最旧的事件，不会阻塞写入
+type subscriber struct {
+	mu      sync.Mutex
+	ring    []Event
+	head    int    // 最旧事件的位置
+	n       int    // 缓冲区中的事件数
+	dropped uint64 // 尚未报告的丢弃事件数
+
+	notify chan struct{} // 有新事件时通知转发协程
+	done   chan struct{} // 取消订阅
+	ch     chan Event
+	once   sync.Once
+}
+
+func (s *subscriber) push(ev Event) {
+	s.mu.Lock()
+	if s.n == len(s.ring) {
+		s.ring[s.head] = Event{}
+		s.head = (s.head + 1) % len(s.ring)
+		s.n--
+		s.dropped++
+	}
+	s.ring[(s.head+s.n)%len(s.ring)] = ev
+	s.n++
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) pop() (Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.n == 0 {
+		return Event{}, false
+	}
+	ev := s.ring[s.head]
+	s.ring[s.head] = Event{}
+	s.head = (s.head + 1) % len(s.ring)
+	s.n--
+	ev.Dropped, s.dropped = s.dropped, 0
+	return ev, true
+}
+
+// run 把缓冲区中的事件依次转发到 ch，取消订阅后关闭 ch
+func (s *subscriber) run() {
+	defer close(s.ch)
+	for {
+		ev, ok := s.pop()
+		if !ok {
+			select {
+			case <-s.notify:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *subscriber) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// Subscribe 订阅之后成功的 Put、PutWithTTL、PutMulti、Delete 和批处理提交产生的变更事件，
+// 返回事件通道和取消订阅的函数，取消订阅或关闭数据库后通道被关闭
+//
+// 事件的顺序与写入在 WAL 中的顺序一致。每个订阅方最多缓存 subscriberBufferSize 个事件，
+// 读取太慢时丢弃最旧的事件并通过 Event.Dropped 报告，不会阻塞写入。
+// Merge 重写记录和后台清理过期键不会产生事件
+func (bc *Bitcask) Subscribe() (<-chan Event, func()) {
+	s := &subscriber{
+		ring:   make([]Event, subscriberBufferSize),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		ch:     make(chan Event),
+	}
+	bc.subMu.Lock()
+	if bc.subs == nil {
+		bc.subs = make(map[*subscriber]struct{})
+	}
+	bc.subs[s] = struct{}{}
+	bc.subMu.Unlock()
+	go s.run()
+
+	cancel := func() {
+		bc.subMu.Lock()
+		delete(bc.subs, s)
+		bc.subMu.Unlock()
+		s.stop()
+	}
+	return s.ch, cancel
+}
+
+// OnChange 注册变更回调，之后每次成功的写入和删除（包括批处理提交中的每个键）都会以 key 和操作类型
+// 调用 fn，返回取消注册的函数，关闭数据库后不再调用
+//
+// 回调在单独的协程中按事件顺序依次执行，不持有任何锁，可以在回调中读写数据库；
+// 回调积压超过 subscriberBufferSize 个事件时最旧的事件会被丢弃，回调应尽快返回
+func (bc *Bitcask) OnChange(fn func(key []byte, op OpType)) func() {
+	events, cancel := bc.Subscribe()
+	go func() {
+		for ev := range events {
+			fn(ev.Key, ev.Type)
+		}
+	}()
+	return cancel
+}
+
+// publish 把事件发送给所有订阅方，没有订阅方时不复制 key 和 value
+func (bc *Bitcask) publish(events ...Event) {
+	bc.subMu.RLock()
+	defer bc.subMu.RUnlock()
+	if len(bc.subs) == 0 {
+		return
+	}
+	for _, ev := range events {
+		ev.Key = append([]byte{}, ev.Key...)
+		if ev.Value != nil {
+			ev.Value = append([]byte{}, ev.Value...)
+		}
+		for s := range bc.subs {
+			s.push(ev)
+		}
+	}
+}
+
+// closeSubscribers 取消所有订阅，关闭数据库时调用
+func (bc *Bitcask) closeSubscribers() {
+	bc.subMu.Lock()
+	defer bc.subMu.Unlock()
+	for s := range bc.subs {
+		s.stop()
+	}
+	bc.subs = nil
+}
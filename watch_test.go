@@ -0,0 +1,280 @@
+package bitcask
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aixiasang/bitcask/utils"
+)
+
+// receive 从事件通道读取 n 个事件，超时则失败
+func receive(t *testing.T, events <-chan Event, n int) []Event {
+	t.Helper()
+	var got []Event
+	for len(got) < n {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("事件通道提前关闭, 已收到 %d 个事件", len(got))
+			}
+			got = append(got, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("等待事件超时, 已收到 %d 个事件", len(got))
+		}
+	}
+	return got
+}
+
+func TestBitcask_Subscribe(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// 订阅之前的写入不会产生事件
+	if err := db.Put([]byte("before"), []byte("v")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	events, cancel := db.Subscribe()
+	defer cancel()
+
+	if err := db.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.PutWithTTL([]byte("b"), []byte("2"), time.Hour); err != nil {
+		t.Fatalf("写入TTL数据失败: %v", err)
+	}
+	if _, err := db.Delete([]byte("a")); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	// 删除不存在的键不会产生事件
+	if _, err := db.Delete([]byte("missing")); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	batch := NewBatch(db)
+	batch.Put([]byte("c"), []byte("3"))
+	batch.Delete([]byte("b"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交批处理失败: %v", err)
+	}
+	if err := db.PutMulti(map[string][]byte{"d": []byte("4")}); err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+	// Merge 重写记录不会产生事件
+	if err := db.Merge(); err != nil {
+		t.Fatalf("合并失败: %v", err)
+	}
+	if err := db.Put([]byte("e"), []byte("5")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	want := []Event{
+		{Type: EventPut, Key: []byte("a"), Value: []byte("1")},
+		{Type: EventPut, Key: []byte("b"), Value: []byte("2")},
+		{Type: EventDelete, Key: []byte("a")},
+		{Type: EventPut, Key: []byte("c"), Value: []byte("3")},
+		{Type: EventDelete, Key: []byte("b")},
+		{Type: EventPut, Key: []byte("d"), Value: []byte("4")},
+		{Type: EventPut, Key: []byte("e"), Value: []byte("5")},
+	}
+	got := receive(t, events, len(want))
+	for i, ev := range got {
+		w := want[i]
+		if ev.Type != w.Type || string(ev.Key) != string(w.Key) || string(ev.Value) != string(w.Value) || ev.Dropped != 0 {
+			t.Fatalf("第 %d 个事件不正确: 期望 %s %q=%q, 实际 %s %q=%q (dropped=%d)",
+				i, w.Type, w.Key, w.Value, ev.Type, ev.Key, ev.Value, ev.Dropped)
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("不应收到多余的事件: %s %q", ev.Type, ev.Key)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 取消订阅后通道被关闭
+	cancel()
+	if _, ok := <-events; ok {
+		t.Fatal("取消订阅后通道应该被关闭")
+	}
+}
+
+// 测试订阅方读取太慢时丢弃最旧的事件而不是阻塞写入，Close 会关闭所有订阅
+func TestBitcask_SubscribeSlowReader(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.AutoSync = false
+	conf.MaxFileSize = 1 << 20
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	events, cancel := db.Subscribe()
+	defer cancel()
+
+	const total = subscriberBufferSize + 100
+	for i := 0; i < total; i++ {
+		if err := db.Put(utils.GetKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	// 收到的事件数加上报告的丢弃数等于写入数，最后一个事件是最新的写入
+	var received, dropped uint64
+	var last Event
+	for received+dropped < total {
+		ev := receive(t, events, 1)[0]
+		received++
+		dropped += ev.Dropped
+		last = ev
+	}
+	if dropped == 0 || received > subscriberBufferSize+1 {
+		t.Fatalf("缓冲区满时应丢弃旧事件: 收到 %d, 丢弃 %d", received, dropped)
+	}
+	if string(last.Key) != string(utils.GetKey(total-1)) {
+		t.Fatalf("最后一个事件应为最新的写入: %q", last.Key)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("关闭数据库后不应再有事件")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("关闭数据库后通道应该被关闭")
+	}
+}
+
+// 测试并发写入同一个键时事件的顺序与 WAL 一致，最后一个事件的值就是读到的值
+func TestBitcask_SubscribeConcurrentOrder(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	conf.AutoSync = false
+	conf.MaxFileSize = 1 << 20
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+	events, cancel := db.Subscribe()
+	defer cancel()
+
+	const writers, perWriter = 4, 50
+	for round := 0; round < 20; round++ {
+		var wg sync.WaitGroup
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < perWriter; i++ {
+					if err := db.Put([]byte("key"), []byte(fmt.Sprintf("%d-%d-%d", round, w, i))); err != nil {
+						t.Errorf("写入失败: %v", err)
+						return
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		got := receive(t, events, writers*perWriter)
+		value, ok := db.Get([]byte("key"))
+		if !ok {
+			t.Fatal("读取失败")
+		}
+		if last := got[len(got)-1]; string(last.Value) != string(value) {
+			t.Fatalf("第 %d 轮最后一个事件 %q 与读到的值 %q 不一致", round, last.Value, value)
+		}
+	}
+}
+
+func TestBitcask_OnChange(t *testing.T) {
+	testDir, cleanup := setupTestDir(t)
+	defer cleanup()
+
+	conf := getTestConfig(testDir)
+	conf.Debug = false
+	db, err := NewBitcask(conf)
+	if err != nil {
+		t.Fatalf("创建数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	type change struct {
+		key string
+		op  OpType
+	}
+	changes := make(chan change, 16)
+	remove := db.OnChange(func(key []byte, op OpType) {
+		// 回调不持有锁，可以读取数据库
+		db.Get(key)
+		changes <- change{string(key), op}
+	})
+
+	if err := db.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if _, err := db.Delete([]byte("a")); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	// 丢弃的批处理不会触发回调
+	discarded := NewBatch(db)
+	discarded.Put([]byte("x"), []byte("x"))
+	discarded.Discard()
+	batch := NewBatch(db)
+	batch.Put([]byte("b"), []byte("2"))
+	batch.Put([]byte("c"), []byte("3"))
+	batch.Put([]byte("d"), []byte("4"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交批处理失败: %v", err)
+	}
+	batch.Delete([]byte("c"))
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("提交批处理失败: %v", err)
+	}
+
+	want := []change{
+		{"a", EventPut},
+		{"a", EventDelete},
+		{"b", EventPut},
+		{"c", EventPut},
+		{"d", EventPut},
+		{"c", EventDelete},
+	}
+	for i, w := range want {
+		select {
+		case got := <-changes:
+			if got != w {
+				t.Fatalf("第 %d 次回调不正确: 期望 %v, 实际 %v", i, w, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("等待第 %d 次回调超时", i)
+		}
+	}
+
+	// 取消注册后不再调用
+	remove()
+	if err := db.Put([]byte("e"), []byte("5")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	select {
+	case got := <-changes:
+		t.Fatalf("取消注册后不应再调用回调: %v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}